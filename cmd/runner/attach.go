@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// attachDrain is how long output is still relayed after the attached shell
+// exited, for background jobs that hold the terminal open.
+const attachDrain = 200 * time.Millisecond
+
+// handleAttach starts a shell on a terminal of its own and relays it over
+// conn in frames until the shell exits or the client goes away (see
+// protocol.RequestAttach). The session shell serving exec is not touched, so
+// exec keeps working while a client is attached.
+func (s *server) handleAttach(conn net.Conn, r *bufio.Reader, req protocol.Request) {
+	if req.Rows < 0 || req.Cols < 0 || req.Rows > math.MaxUint16 || req.Cols > math.MaxUint16 {
+		s.writeResponse(conn, errorResponse(req.ID, fmt.Sprintf("invalid terminal size %dx%d", req.Rows, req.Cols)))
+		return
+	}
+	size := pty.Winsize{Rows: protocol.DefaultTerminalRows, Cols: protocol.DefaultTerminalCols}
+	if req.Rows > 0 {
+		size.Rows = uint16(req.Rows)
+	}
+	if req.Cols > 0 {
+		size.Cols = uint16(req.Cols)
+	}
+	ptmx, cmd, err := startTerminal(req.Shell, &size)
+	if err != nil {
+		s.writeResponse(conn, errorResponse(req.ID, err.Error()))
+		return
+	}
+	defer ptmx.Close()
+	s.writeResponse(conn, protocol.Response{ID: req.ID, Type: protocol.ResponseAttach, OK: true})
+
+	// The client going away hangs up the shell, like closing a terminal
+	// window.
+	go func() {
+		for {
+			in, err := protocol.ReadRequestFrame(r)
+			if err != nil {
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGHUP)
+				return
+			}
+			switch in.Type {
+			case protocol.RequestInput:
+				data, err := base64.StdEncoding.DecodeString(in.ContentBase64)
+				if err == nil {
+					ptmx.Write(data)
+				}
+			case protocol.RequestResize:
+				if in.Rows > 0 && in.Rows <= math.MaxUint16 {
+					size.Rows = uint16(in.Rows)
+				}
+				if in.Cols > 0 && in.Cols <= math.MaxUint16 {
+					size.Cols = uint16(in.Cols)
+				}
+				pty.Setsize(ptmx, &size)
+			}
+		}
+	}()
+
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- waitExitCode(cmd)
+		// Reads end once every process closed the terminal; do not wait
+		// for background jobs of the shell that keep it open.
+		time.Sleep(attachDrain)
+		if ptmx.SetReadDeadline(time.Now()) != nil {
+			ptmx.Close()
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ptmx.Read(buf)
+		if n > 0 {
+			if err := protocol.WriteResponseFrame(conn, protocol.Response{
+				ID:            req.ID,
+				Type:          protocol.ResponseOutput,
+				ContentBase64: base64.StdEncoding.EncodeToString(buf[:n]),
+			}); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	code := <-exitCode
+	if err := protocol.WriteResponseFrame(conn, protocol.Response{ID: req.ID, Type: protocol.ResponseExit, ExitCode: code}); err != nil {
+		fmt.Fprintf(os.Stderr, "write exit frame: %v\n", err)
+	}
+}
+
+// startTerminal starts a protocol.Shells name, or the session shell for "",
+// in /workspace on a new PTY of size.
+func startTerminal(name string, size *pty.Winsize) (*os.File, *exec.Cmd, error) {
+	if name == "" {
+		return startShell(findShell(), "/workspace", size)
+	}
+	path, _, err := resolveShell(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd := exec.Command(path)
+	cmd.Dir = "/workspace"
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	ptmx, err := pty.StartWithSize(cmd, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pty start: %w", err)
+	}
+	return ptmx, cmd, nil
+}
+
+// waitExitCode waits for cmd and returns its exit code, 128+n for a shell
+// killed by signal n.
+func waitExitCode(cmd *exec.Cmd) int {
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// captureDrainTimeout is how long output still in the FIFO is waited for once
+// the command has finished. Processes it left running in the background may
+// keep the FIFO open; what they write later is dropped.
+const captureDrainTimeout = 200 * time.Millisecond
+
+// cappedBuffer keeps the first limit bytes written to it. The buffer is not
+// embedded: its ReadFrom would let io.Copy bypass the limit.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		b.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Bytes() []byte { return b.buf.Bytes() }
+
+// outputCapture collects the output of one shell command through a FIFO, so
+// it bypasses the PTY and arrives byte for byte.
+type outputCapture struct {
+	path string
+	r, w *os.File
+	out  cappedBuffer
+	done chan struct{}
+}
+
+// startOutputCapture creates the FIFO the next command writes to, keeping up
+// to limit bytes of it. The runner
+// holds a write end itself until finish, so the reader does not see EOF
+// before the command has opened the FIFO.
+func startOutputCapture(limit int) (*outputCapture, error) {
+	path := filepath.Join(stageDir, fmt.Sprintf("out-%d", time.Now().UnixNano()))
+	os.Remove(path)
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return nil, err
+	}
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	w, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		r.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	c := &outputCapture{
+		path: path,
+		r:    r,
+		w:    w,
+		out:  cappedBuffer{limit: limit},
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			c.out.Write(buf[:n])
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// finish stops the capture once the command has exited and returns what it
+// wrote.
+func (c *outputCapture) finish() (data []byte, truncated bool) {
+	c.w.Close()
+	os.Remove(c.path)
+	select {
+	case <-c.done:
+	case <-time.After(captureDrainTimeout):
+		c.r.SetReadDeadline(time.Now())
+		<-c.done
+	}
+	c.r.Close()
+	return c.out.Bytes(), c.out.truncated
+}
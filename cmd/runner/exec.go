@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/p-arndt/sandkasten/protocol"
@@ -29,40 +32,112 @@ func (s *server) handleExec(req protocol.Request) protocol.Response {
 
 	timeout := getTimeout(req.TimeoutMs)
 
+	interpreter := "bash"
+	if req.Shell != "" {
+		path, _, err := resolveShell(req.Shell)
+		if err != nil {
+			return errorResponse(req.ID, err.Error())
+		}
+		interpreter = path
+	}
+
+	// A shell that exited would never print the sentinel; replace it first.
+	restarted := false
+	if s.shell.exited() {
+		if err := s.restartShell(req.KeepCwd); err != nil {
+			return errorResponse(req.ID, "restart shell: "+err.Error())
+		}
+		restarted = true
+	}
+
+	// Base64 output is read from a FIFO instead of the PTY, whose line
+	// discipline would rewrite it.
+	var capture *outputCapture
+	if req.OutputBase64 {
+		var err error
+		if capture, err = startOutputCapture(req.Base64OutputLimit()); err != nil {
+			return errorResponse(req.ID, "capture output: "+err.Error())
+		}
+	}
+
 	// Drain any pending output
 	s.shellBuf.ReadAndReset()
 
 	// Build and execute command
 	beginMarker, endMarker := buildSentinels(req.ID)
-	cmdStr := buildWrappedCommand(beginMarker, endMarker, req.Cmd)
+	outputPath := ""
+	if capture != nil {
+		outputPath = capture.path
+	}
+	cmdStr := buildWrappedCommand(beginMarker, endMarker, req.Cmd, interpreter, outputPath)
 
 	start := time.Now()
 	if _, err := s.ptmx.Write([]byte(cmdStr)); err != nil {
+		if capture != nil {
+			capture.finish()
+		}
 		return errorResponse(req.ID, "write to pty: "+err.Error())
 	}
 
 	// Wait for command completion
-	return s.waitForCompletion(req.ID, beginMarker, endMarker, req.RawOutput, timeout, start)
+	resp := s.waitForCompletion(req, beginMarker, endMarker, timeout, start)
+	if capture != nil {
+		data, truncated := capture.finish()
+		// A timeout or shell exit (exit code -1) keeps its message.
+		if resp.Type == protocol.ResponseExec && resp.ExitCode >= 0 {
+			setBase64Output(&resp, data, truncated)
+		}
+	}
+	if resp.Cwd != "" {
+		s.cwd = resp.Cwd
+	}
+	resp.ShellRestarted = resp.ShellRestarted || restarted
+	return resp
 }
 
 // handleExecStateless runs the command directly via exec.Command, no persistent shell.
 // Saves memory and startup time. No cwd/env persistence between execs.
 func (s *server) handleExecStateless(req protocol.Request) protocol.Response {
 	timeout := getTimeout(req.TimeoutMs)
-	shell := findShell()
+	shell, flag := findShell(), "-c"
+	if req.Shell != "" {
+		var err error
+		if shell, flag, err = resolveShell(req.Shell); err != nil {
+			return errorResponse(req.ID, err.Error())
+		}
+	}
 
-	cmd := exec.Command(shell, "-c", req.Cmd)
+	cmd := exec.Command(shell, flag, req.Cmd)
 	cmd.Dir = "/workspace"
+	// Run the command in a process group of its own so a timeout ends the
+	// processes it started too.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Processes that left the group may hold the output pipes open.
+	cmd.WaitDelay = time.Second
 	cmd.Env = append(cmd.Env,
-		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"PATH="+execPath,
 		"HOME=/home/sandbox",
 		"TERM=xterm",
 		"LANG=C.UTF-8",
 	)
+	// Later entries win, so a deterministic session's LANG replaces the default.
+	cmd.Env = append(cmd.Env, sessionEnv()...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	// Base64 output keeps stdout and stderr interleaved as written; a single
+	// writer makes exec use one pipe for both. So do timestamped lines.
+	combined := cappedBuffer{limit: req.Base64OutputLimit()}
+	var timed timedBuffer
+	switch {
+	case req.OutputBase64:
+		cmd.Stdout = &combined
+		cmd.Stderr = &combined
+	case req.LineTimestamps:
+		cmd.Stdout = &timed
+		cmd.Stderr = &timed
+	}
 
 	start := time.Now()
 	if err := cmd.Start(); err != nil {
@@ -77,9 +152,11 @@ func (s *server) handleExecStateless(req protocol.Request) protocol.Response {
 	case execErr = <-done:
 		// Command finished
 	case <-time.After(timeout):
-		cmd.Process.Kill()
+		killed := killProcessGroup(cmd.Process.Pid, killGrace(req))
 		<-done
-		return timeoutResponse(req.ID, timeout, start)
+		resp := timeoutResponse(req.ID, timeout, start)
+		resp.Killed = killed
+		return resp
 	}
 
 	output := stdout.String() + stderr.String()
@@ -87,19 +164,22 @@ func (s *server) handleExecStateless(req protocol.Request) protocol.Response {
 		output = normalizeLineEndings(output)
 		output = stripANSI(output)
 	}
-	truncated := truncateOutput(&output)
+	truncated := truncateOutput(&output, req)
 
 	exitCode := 0
 	if execErr != nil {
 		if exitErr, ok := execErr.(*exec.ExitError); ok {
 			exitCode = exitErr.ExitCode()
+		} else if req.OutputBase64 {
+			// The output is not text to append the error to.
+			return errorResponse(req.ID, "exec: "+execErr.Error())
 		} else {
 			exitCode = -1
 			output = output + "\nexec error: " + execErr.Error()
 		}
 	}
 
-	return protocol.Response{
+	resp := protocol.Response{
 		ID:         req.ID,
 		Type:       protocol.ResponseExec,
 		ExitCode:   exitCode,
@@ -108,6 +188,50 @@ func (s *server) handleExecStateless(req protocol.Request) protocol.Response {
 		Truncated:  truncated,
 		DurationMs: time.Since(start).Milliseconds(),
 	}
+	switch {
+	case req.OutputBase64:
+		setBase64Output(&resp, combined.Bytes(), combined.truncated)
+	case req.LineTimestamps:
+		full := timed.buf.String()
+		resp.Lines, resp.Truncated = truncateLines(outputLines(full, 0, len(full), timed.arrivals, !req.RawOutput), req)
+		resp.Output = ""
+	}
+	return resp
+}
+
+// setBase64Output replaces the output of resp with the raw bytes data,
+// base64-encoded.
+func setBase64Output(resp *protocol.Response, data []byte, truncated bool) {
+	resp.Output = base64.StdEncoding.EncodeToString(data)
+	resp.Truncated = truncated
+	resp.OutputBase64 = true
+}
+
+// execPath is the PATH of stateless commands; selectable shells are looked up
+// on it as well.
+const execPath = "/usr/local/bin:/usr/bin:/bin"
+
+// resolveShell returns the binary for a protocol.Shells name and the flag it
+// takes for a program on the command line. The error starts with
+// protocol.ErrShellUnavailable so the daemon can report it as a bad request.
+func resolveShell(name string) (path, flag string, err error) {
+	candidates, ok := protocol.Shells[name]
+	if !ok {
+		return "", "", fmt.Errorf("%s: unknown shell %q", protocol.ErrShellUnavailable, name)
+	}
+	flag = "-c"
+	if name == "node" {
+		flag = "-e"
+	}
+	for _, bin := range candidates {
+		for _, dir := range filepath.SplitList(execPath) {
+			p := filepath.Join(dir, bin)
+			if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+				return p, flag, nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("%s: %s is not installed in this image", protocol.ErrShellUnavailable, name)
 }
 
 // getTimeout returns command timeout with 30s default.
@@ -119,6 +243,12 @@ func getTimeout(timeoutMs int) time.Duration {
 	return timeout
 }
 
+// killGrace returns the time between SIGTERM and SIGKILL for a timed-out
+// command of req.
+func killGrace(req protocol.Request) time.Duration {
+	return time.Duration(max(req.KillGraceMs, 0)) * time.Millisecond
+}
+
 // buildSentinels creates unique begin/end markers for command output.
 func buildSentinels(requestID string) (begin, end string) {
 	begin = fmt.Sprintf("%s:%s", protocol.SentinelBegin, requestID)
@@ -128,12 +258,17 @@ func buildSentinels(requestID string) (begin, end string) {
 
 // buildWrappedCommand wraps user command with sentinels for output capture.
 // The command is base64-encoded so it is never interpreted as part of the wrapper
-// script, preventing injection via newlines or shell metacharacters.
-func buildWrappedCommand(beginMarker, endMarker, cmd string) string {
+// script, preventing injection via newlines or shell metacharacters. It is
+// piped into interpreter, which reads the program from stdin. With outputPath
+// the interpreter's stdout and stderr go to that file instead of the PTY.
+func buildWrappedCommand(beginMarker, endMarker, cmd, interpreter, outputPath string) string {
 	encoded := base64.StdEncoding.EncodeToString([]byte(cmd))
+	if outputPath != "" {
+		interpreter += " >'" + outputPath + "' 2>&1"
+	}
 	return fmt.Sprintf(
-		"printf '%%s\\n' '%s'\n__b64='%s'; echo \"$__b64\" | base64 -d | bash\nprintf '\\n%s:%%d:%%s\\n' \"$?\" \"$PWD\"\n",
-		beginMarker, encoded, endMarker,
+		"printf '%%s\\n' '%s'\n__b64='%s'; echo \"$__b64\" | base64 -d | %s\nprintf '\\n%s:%%d:%%s\\n' \"$?\" \"$PWD\"\n",
+		beginMarker, encoded, interpreter, endMarker,
 	)
 }
 
@@ -141,66 +276,136 @@ func buildWrappedCommand(beginMarker, endMarker, cmd string) string {
 // echoes the printf command line, so we must look for this to avoid matching the echo.
 func endSentinelLine(endMarker string) string { return "\n" + endMarker }
 
-// waitForCompletion polls for command output until end sentinel or timeout.
-func (s *server) waitForCompletion(requestID, beginMarker, endMarker string, rawOutput bool, timeout time.Duration, start time.Time) protocol.Response {
-	deadline := time.After(timeout)
+// waitForCompletion collects command output until the end sentinel line or timeout.
+// It wakes on every PTY write, so responses return as soon as the sentinel arrives.
+func (s *server) waitForCompletion(req protocol.Request, beginMarker, endMarker string, timeout time.Duration, start time.Time) protocol.Response {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
 	var accumulated []byte
 	endLine := endSentinelLine(endMarker)
+	shell := s.shell
+	// Output kept from the end when trimming runaway output: enough for the
+	// end sentinel, or for the tail of head_tail truncation.
+	limit := req.OutputLimit()
+	tailKeep := 4096
+	if req.Truncate == protocol.TruncateHeadTail {
+		tailKeep += limit / 2
+	}
+	var arrivals []arrival
 
 	for {
 		select {
-		case <-deadline:
-			return timeoutResponse(requestID, timeout, start)
+		case <-deadline.C:
+			return s.timeoutInShell(req, timeout, start)
+
+		case <-shell.done:
+			return s.shellExitedDuringExec(req, accumulated, arrivals, beginMarker, endMarker, start)
 
-		case <-time.After(50 * time.Millisecond):
+		case <-s.shellBuf.Notify():
 			chunk := s.shellBuf.ReadAndReset()
-			if len(chunk) > 0 {
-				accumulated = append(accumulated, chunk...)
+			if len(chunk) == 0 {
+				continue
+			}
+			accumulated = append(accumulated, chunk...)
+			if req.LineTimestamps {
+				arrivals = append(arrivals, arrival{offset: len(accumulated), at: time.Now().UnixMilli()})
 			}
 
+			// Only complete once the sentinel line is terminated; otherwise the
+			// exit code/cwd after the marker may still be in flight.
 			full := string(accumulated)
-			if idx := strings.Index(full, endLine); idx >= 0 {
-				return buildExecResponse(requestID, full, beginMarker, endMarker, rawOutput, start)
+			if idx := strings.Index(full, endLine); idx >= 0 && strings.Contains(full[idx+len(endLine):], "\n") {
+				return buildExecResponse(req, full, beginMarker, endMarker, arrivals, start)
 			}
 
 			// Guard against runaway output
-			if len(accumulated) > protocol.MaxOutputBytes*2 {
+			if len(accumulated) > limit*2 {
 				// Keep the first chunk (containing beginMarker) and the last chunk (for endMarker)
-				firstPart := accumulated[:protocol.MaxOutputBytes]
-				lastPart := accumulated[len(accumulated)-4096:]
+				firstPart := accumulated[:limit]
+				lastPart := accumulated[len(accumulated)-tailKeep:]
 
 				newAccumulated := make([]byte, 0, len(firstPart)+len(lastPart))
 				newAccumulated = append(newAccumulated, firstPart...)
 				newAccumulated = append(newAccumulated, lastPart...)
+				arrivals = cutArrivals(arrivals, len(firstPart), len(accumulated)-len(newAccumulated))
 				accumulated = newAccumulated
 			}
 		}
 	}
 }
 
+// timeoutInShell ends the job of a timed-out command in the persistent shell
+// and, if req asks for it, resets the shell afterwards.
+func (s *server) timeoutInShell(req protocol.Request, timeout time.Duration, start time.Time) protocol.Response {
+	var killed []protocol.KilledProcess
+	if pgrp := s.foregroundGroup(); pgrp > 0 {
+		killed = killProcessGroup(pgrp, killGrace(req))
+	}
+	resp := timeoutResponse(req.ID, timeout, start)
+	resp.Killed = killed
+	if req.ResetShell {
+		if err := s.resetShell(); err != nil {
+			fmt.Fprintf(os.Stderr, "reset shell: %v\n", err)
+		} else {
+			resp.ShellReset = true
+			resp.Cwd = "/workspace"
+		}
+	}
+	return resp
+}
+
+// shellExitedDuringExec restarts a shell that exited while running req and
+// reports the command as failed with the output it produced so far.
+func (s *server) shellExitedDuringExec(req protocol.Request, accumulated []byte, arrivals []arrival, beginMarker, endMarker string, start time.Time) protocol.Response {
+	exit := s.shell.String()
+	if err := s.restartShell(req.KeepCwd); err != nil {
+		return errorResponse(req.ID, fmt.Sprintf("shell %s; restart shell: %v", exit, err))
+	}
+	resp := buildExecResponse(req, string(accumulated), beginMarker, endMarker, arrivals, start)
+	resp.ExitCode = -1
+	resp.Cwd = s.cwd
+	note := "shell " + exit + " during the command; a new shell was started"
+	if req.LineTimestamps && !req.OutputBase64 {
+		resp.Lines = append(resp.Lines, protocol.OutputLine{Timestamp: time.Now().UnixMilli(), Text: note})
+	} else {
+		if resp.Output != "" {
+			resp.Output += "\n"
+		}
+		resp.Output += note
+	}
+	resp.ShellRestarted = true
+	return resp
+}
+
 // buildExecResponse parses command output and builds response.
-func buildExecResponse(requestID, full, beginMarker, endMarker string, rawOutput bool, start time.Time) protocol.Response {
+// With req.LineTimestamps the output goes to Lines, stamped from arrivals.
+func buildExecResponse(req protocol.Request, full, beginMarker, endMarker string, arrivals []arrival, start time.Time) protocol.Response {
 	exitCode, cwd := parseEndSentinel(full, endMarker)
+	resp := protocol.Response{
+		ID:         req.ID,
+		Type:       protocol.ResponseExec,
+		ExitCode:   exitCode,
+		Cwd:        cwd,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if req.LineTimestamps && !req.OutputBase64 {
+		from, to := outputBounds(full, beginMarker, endMarker)
+		resp.Lines, resp.Truncated = truncateLines(outputLines(full, from, to, arrivals, !req.RawOutput), req)
+		return resp
+	}
+
 	output := extractOutput(full, beginMarker, endMarker)
-	if rawOutput {
+	if req.RawOutput {
 		output = extractRawOutput(full, beginMarker, endMarker)
 	}
-	if !rawOutput {
+	if !req.RawOutput {
 		output = removeSentinelLines(output)
 		output = normalizeLineEndings(output)
 		output = stripANSI(output)
 	}
-	truncated := truncateOutput(&output)
-
-	return protocol.Response{
-		ID:         requestID,
-		Type:       protocol.ResponseExec,
-		ExitCode:   exitCode,
-		Cwd:        cwd,
-		Output:     output,
-		Truncated:  truncated,
-		DurationMs: time.Since(start).Milliseconds(),
-	}
+	resp.Truncated = truncateOutput(&output, req)
+	resp.Output = output
+	return resp
 }
 
 func normalizeLineEndings(s string) string {
@@ -256,65 +461,47 @@ func stripANSI(s string) string {
 }
 
 // extractOutput extracts command output between begin and end markers.
-// We look for the real sentinel lines (the printf output), not the echoed command
-// lines, so that "printf '...'" never appears in the returned output.
 func extractOutput(full, beginMarker, endMarker string) string {
-	output := full
-
-	// Skip to after the real begin marker line (printf output is marker then \n)
-	beginLine := "\n" + beginMarker
-	if idx := strings.Index(output, beginLine); idx >= 0 {
-		output = output[idx+len(beginLine):]
-		if nl := strings.Index(output, "\n"); nl >= 0 {
-			output = output[nl+1:]
-		}
-	} else if strings.HasPrefix(output, beginMarker) {
-		output = output[len(beginMarker):]
-		if nl := strings.Index(output, "\n"); nl >= 0 {
-			output = output[nl+1:]
-		}
-	}
-
-	// Trim at the real end sentinel line (newline + marker), not the echoed "printf '\n..."
-	endLine := endSentinelLine(endMarker)
-	if endIdx := strings.Index(output, endLine); endIdx >= 0 {
-		output = output[:endIdx]
-	}
-
-	return strings.TrimRight(output, "\n")
+	from, to := outputBounds(full, beginMarker, endMarker)
+	return strings.TrimRight(full[from:to], "\n")
 }
 
 func extractRawOutput(full, beginMarker, endMarker string) string {
-	output := full
+	from, to := outputBounds(full, beginMarker, endMarker)
+	return full[from:to]
+}
 
+// outputBounds returns where command output starts and ends in full.
+// We look for the real sentinel lines (the printf output), not the echoed command
+// lines, so that "printf '...'" never appears in the returned output.
+func outputBounds(full, beginMarker, endMarker string) (from, to int) {
+	// Skip to after the real begin marker line (printf output is marker then \n)
 	beginLine := "\n" + beginMarker
-	if idx := strings.Index(output, beginLine); idx >= 0 {
-		output = output[idx+len(beginLine):]
-		if nl := strings.Index(output, "\n"); nl >= 0 {
-			output = output[nl+1:]
-		}
-	} else if strings.HasPrefix(output, beginMarker) {
-		output = output[len(beginMarker):]
-		if nl := strings.Index(output, "\n"); nl >= 0 {
-			output = output[nl+1:]
+	if idx := strings.Index(full, beginLine); idx >= 0 {
+		from = idx + len(beginLine)
+	} else if strings.HasPrefix(full, beginMarker) {
+		from = len(beginMarker)
+	}
+	if from > 0 {
+		if nl := strings.Index(full[from:], "\n"); nl >= 0 {
+			from += nl + 1
 		}
 	}
 
-	endLine := endSentinelLine(endMarker)
-	if endIdx := strings.Index(output, endLine); endIdx >= 0 {
-		output = output[:endIdx]
+	// Trim at the real end sentinel line (newline + marker), not the echoed "printf '\n..."
+	to = len(full)
+	if endIdx := strings.Index(full[from:], endSentinelLine(endMarker)); endIdx >= 0 {
+		to = from + endIdx
 	}
-
-	return output
+	return from, to
 }
 
-// truncateOutput limits output size to protocol maximum.
-func truncateOutput(output *string) bool {
-	if len(*output) > protocol.MaxOutputBytes {
-		*output = (*output)[:protocol.MaxOutputBytes]
-		return true
-	}
-	return false
+// truncateOutput limits output to the output limit of req in its truncation
+// mode, see protocol.TruncateOutput.
+func truncateOutput(output *string, req protocol.Request) bool {
+	var truncated bool
+	*output, truncated = protocol.TruncateOutput(*output, req.OutputLimit(), req.Truncate)
+	return truncated
 }
 
 // timeoutResponse creates timeout error response.
@@ -6,27 +6,40 @@ import (
 	"sync"
 )
 
-// ringBuffer is a simple bounded byte buffer for PTY output.
+// ringBuffer is a simple bounded byte buffer for PTY output. Readers wait on
+// Notify instead of polling.
 type ringBuffer struct {
-	mu   sync.Mutex
-	data []byte
-	cap  int
+	mu     sync.Mutex
+	data   []byte
+	cap    int
+	notify chan struct{}
 }
 
 func newRingBuffer(cap int) *ringBuffer {
-	return &ringBuffer{data: make([]byte, 0, cap), cap: cap}
+	return &ringBuffer{data: make([]byte, 0, cap), cap: cap, notify: make(chan struct{}, 1)}
 }
 
 func (rb *ringBuffer) Write(p []byte) (int, error) {
 	rb.mu.Lock()
-	defer rb.mu.Unlock()
 	rb.data = append(rb.data, p...)
 	if len(rb.data) > rb.cap {
 		rb.data = rb.data[len(rb.data)-rb.cap:]
 	}
+	rb.mu.Unlock()
+
+	// Coalesce wake-ups: one pending signal is enough since readers drain all data.
+	select {
+	case rb.notify <- struct{}{}:
+	default:
+	}
 	return len(p), nil
 }
 
+// Notify receives a value after new data has been written.
+func (rb *ringBuffer) Notify() <-chan struct{} {
+	return rb.notify
+}
+
 func (rb *ringBuffer) ReadAndReset() []byte {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"golang.org/x/sys/unix"
+)
+
+// maxKilledCommandBytes caps the command line reported per killed process.
+const maxKilledCommandBytes = 256
+
+// foregroundGroup returns the process group in the foreground of the shell's
+// PTY, or 0 when that is the shell itself. The interactive shell runs every
+// command in a job of its own, so this is the group of a still running exec.
+func (s *server) foregroundGroup() int {
+	rc, err := s.ptmx.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	pgrp := 0
+	rc.Control(func(fd uintptr) {
+		pgrp, err = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	})
+	if err != nil || pgrp <= 0 || pgrp == int(s.shellPID.Load()) {
+		return 0
+	}
+	return pgrp
+}
+
+// killProcessGroup sends SIGTERM to the process group pgrp, waits up to
+// grace for it to exit, then sends SIGKILL to what is left. It returns the
+// processes found in the group and the signal that ended each.
+func killProcessGroup(pgrp int, grace time.Duration) []protocol.KilledProcess {
+	procs := groupProcesses(pgrp)
+	if len(procs) == 0 {
+		return nil
+	}
+
+	if grace > 0 {
+		syscall.Kill(-pgrp, syscall.SIGTERM)
+		// Stopped processes only see SIGTERM once they run again.
+		syscall.Kill(-pgrp, syscall.SIGCONT)
+		deadline := time.Now().Add(grace)
+		for time.Now().Before(deadline) && len(groupProcesses(pgrp)) > 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	remaining := make(map[int]bool)
+	for _, p := range groupProcesses(pgrp) {
+		remaining[p.PID] = true
+	}
+	if len(remaining) > 0 {
+		syscall.Kill(-pgrp, syscall.SIGKILL)
+	}
+	for i := range procs {
+		procs[i].Signal = "SIGTERM"
+		if remaining[procs[i].PID] {
+			procs[i].Signal = "SIGKILL"
+		}
+	}
+	return procs
+}
+
+// groupProcesses lists the live (non-zombie) processes of process group pgrp.
+func groupProcesses(pgrp int) []protocol.KilledProcess {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var procs []protocol.KilledProcess
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		comm, state, group, ok := parseProcStat(stat)
+		if !ok || group != pgrp || state == "Z" {
+			continue
+		}
+		procs = append(procs, protocol.KilledProcess{PID: pid, Command: processCommand(pid, comm)})
+	}
+	return procs
+}
+
+// parseProcStat extracts the command name, state and process group from the
+// contents of /proc/<pid>/stat. The name is in parentheses and may itself
+// contain spaces and parentheses, so the fields are taken after the last ')'.
+func parseProcStat(stat []byte) (comm, state string, pgrp int, ok bool) {
+	open, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return "", "", 0, false
+	}
+	comm = string(stat[open+1 : end])
+	// Fields after the name: state ppid pgrp ...
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 3 {
+		return "", "", 0, false
+	}
+	pgrp, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", "", 0, false
+	}
+	return comm, fields[0], pgrp, true
+}
+
+// processCommand returns the command line of pid, falling back to its name.
+func processCommand(pid int, comm string) string {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	cmd := strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	if err != nil || cmd == "" {
+		cmd = comm
+	}
+	if len(cmd) > maxKilledCommandBytes {
+		cmd = cmd[:maxKilledCommandBytes]
+	}
+	return cmd
+}
+
+// resetShell returns the persistent shell to a known state after a timed-out
+// command: sane terminal settings without echo and /workspace as cwd.
+func (s *server) resetShell() error {
+	marker := fmt.Sprintf("__SANDKASTEN_RESET_%d__", time.Now().UnixNano())
+	cmd := fmt.Sprintf("stty sane -echo >/dev/null 2>&1; cd /workspace; printf '%%s\\n' '%s'\n", marker)
+	if _, err := s.ptmx.Write([]byte(cmd)); err != nil {
+		return fmt.Errorf("write reset: %w", err)
+	}
+	if err := waitForShellMarker(s, marker, 2*time.Second); err != nil {
+		return err
+	}
+	s.shellBuf.ReadAndReset()
+	return nil
+}
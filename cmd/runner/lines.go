@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// lineOverhead approximates the JSON encoding of a protocol.OutputLine around
+// its text; it counts against the output limit.
+const lineOverhead = 32
+
+// arrival records the time by which the first offset bytes of output had been
+// received.
+type arrival struct {
+	offset int
+	at     int64 // unix ms
+}
+
+// timedBuffer collects output and when each write of it arrived.
+type timedBuffer struct {
+	buf      bytes.Buffer
+	arrivals []arrival
+}
+
+func (b *timedBuffer) Write(p []byte) (int, error) {
+	b.buf.Write(p)
+	b.arrivals = append(b.arrivals, arrival{offset: b.buf.Len(), at: time.Now().UnixMilli()})
+	return len(p), nil
+}
+
+// outputLines splits full[start:end] into lines stamped with the time their
+// last byte arrived. With clean, lines are cleaned like exec output: sentinel
+// lines are dropped, line endings normalized, ANSI stripped and trailing
+// empty lines removed.
+func outputLines(full string, start, end int, arrivals []arrival, clean bool) []protocol.OutputLine {
+	var lines []protocol.OutputLine
+	a := 0
+	for pos := start; pos < end; {
+		lineEnd, next := end, end
+		if nl := strings.IndexByte(full[pos:end], '\n'); nl >= 0 {
+			lineEnd, next = pos+nl, pos+nl+1
+		}
+		for a < len(arrivals)-1 && arrivals[a].offset < next {
+			a++
+		}
+		text := full[pos:lineEnd]
+		pos = next
+		if clean {
+			if strings.Contains(text, protocol.SentinelBegin) || strings.Contains(text, protocol.SentinelEnd) {
+				continue
+			}
+			text = stripANSI(normalizeLineEndings(text))
+		}
+		at := time.Now().UnixMilli()
+		if len(arrivals) > 0 {
+			at = arrivals[a].at
+		}
+		lines = append(lines, protocol.OutputLine{Timestamp: at, Text: text})
+	}
+	if clean {
+		for len(lines) > 0 && lines[len(lines)-1].Text == "" {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	return lines
+}
+
+// truncateLines limits lines to the output limit of req like truncateOutput,
+// but drops whole lines; only a line at the cut is shortened. With
+// protocol.TruncateHeadTail a marker line replaces the dropped middle.
+func truncateLines(lines []protocol.OutputLine, req protocol.Request) ([]protocol.OutputLine, bool) {
+	limit, mode := req.OutputLimit(), req.Truncate
+	size := func(l protocol.OutputLine) int { return len(l.Text) + lineOverhead }
+	total := 0
+	for _, l := range lines {
+		total += size(l)
+	}
+	if total <= limit {
+		return lines, false
+	}
+
+	marker := protocol.OutputLine{Text: strings.Trim(protocol.TruncatedMarker, "\n")}
+	budget := limit
+	if mode == protocol.TruncateHeadTail {
+		budget = (budget - size(marker)) / 2
+	}
+	head, used := 0, 0
+	for ; head < len(lines) && used+size(lines[head]) <= budget; head++ {
+		used += size(lines[head])
+	}
+	out := lines[:head:head]
+	if room := budget - used - lineOverhead; room > 0 {
+		cut := lines[head]
+		cut.Text, _ = protocol.TruncateOutput(cut.Text, room, protocol.TruncateHead)
+		out = append(out, cut)
+	}
+	if mode != protocol.TruncateHeadTail {
+		return out, true
+	}
+
+	tail := len(lines)
+	for used = 0; tail > head+1 && used+size(lines[tail-1]) <= budget; tail-- {
+		used += size(lines[tail-1])
+	}
+	marker.Timestamp = lines[head].Timestamp
+	out = append(out, marker)
+	return append(out, lines[tail:]...), true
+}
+
+// cutArrivals adjusts arrivals to the removal of n bytes of output at from.
+func cutArrivals(arrivals []arrival, from, n int) []arrival {
+	out := arrivals[:0]
+	for _, a := range arrivals {
+		switch {
+		case a.offset <= from:
+			out = append(out, a)
+		case a.offset > from+n:
+			a.offset -= n
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -22,11 +22,27 @@ func main() {
 		return
 	}
 
+	// Install mode: copy this binary to a path shared with another container
+	// (Kubernetes init container).
+	if len(os.Args) > 1 && os.Args[1] == "--install" {
+		if len(os.Args) < 3 {
+			fmt.Fprintf(os.Stderr, "usage: runner --install <path>\n")
+			os.Exit(1)
+		}
+		if err := install(os.Args[2]); err != nil {
+			fmt.Fprintf(os.Stderr, "install: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Server mode: start shell (or stateless direct exec), listen on socket
+	h := takeHandoff()
+	startRandomShim()
 	if isStatelessMode() {
-		runStatelessServer()
+		runStatelessServer(h)
 	} else {
-		runServer()
+		runServer(h)
 	}
 }
 
@@ -49,6 +65,18 @@ func runClient(reqJSON string) {
 	}
 }
 
+func install(dst string) error {
+	src, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0755)
+}
+
 func sendRequest(conn net.Conn, reqJSON string) error {
 	_, err := conn.Write([]byte(reqJSON + "\n"))
 	return err
@@ -56,7 +84,7 @@ func sendRequest(conn net.Conn, reqJSON string) error {
 
 func readResponse(conn net.Conn) error {
 	scanner := bufio.NewScanner(conn)
-	scanner.Buffer(make([]byte, protocol.MaxOutputBytes+4096), protocol.MaxOutputBytes+4096)
+	scanner.Buffer(make([]byte, 64*1024), protocol.MaxLineBytes)
 
 	if scanner.Scan() {
 		fmt.Println(scanner.Text())
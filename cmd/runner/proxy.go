@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// handleProxy connects to a TCP port on the sandbox's loopback interface and
+// relays bytes between it and conn until either side closes. This lets the
+// daemon reach dev servers without any network interface but lo, i.e. in
+// network_mode none.
+func (s *server) handleProxy(conn net.Conn, req protocol.Request) {
+	target, err := dialLoopback(req.Port)
+	if err != nil {
+		s.writeResponse(conn, protocol.Response{
+			ID:    req.ID,
+			Type:  protocol.ResponseError,
+			Error: err.Error(),
+		})
+		return
+	}
+	defer target.Close()
+
+	s.writeResponse(conn, protocol.Response{ID: req.ID, Type: protocol.ResponseProxy, OK: true})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(target, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, target)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// dialLoopback connects to port on 127.0.0.1, falling back to ::1 for servers
+// that only bind the IPv6 "localhost".
+func dialLoopback(port int) (net.Conn, error) {
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	var err error
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		var c net.Conn
+		c, err = net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), 5*time.Second)
+		if err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("connect to port %d: %w", port, err)
+}
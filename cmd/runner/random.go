@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+)
+
+// Env vars of deterministic sessions (set by nsinit from the create request)
+const envRandomSeed = "SANDKASTEN_RANDOM_SEED" // seeds the random device FIFOs
+
+// deterministicEnv lists the variables nsinit sets for deterministic
+// sessions; stateless execs pass them on from the runner's environment.
+var deterministicEnv = []string{"TZ", "LANG", "LC_ALL", "PYTHONHASHSEED", "LD_PRELOAD", "FAKETIME"}
+
+// randomDevices are the FIFOs the daemon puts in place of the kernel's random
+// devices in deterministic sessions.
+var randomDevices = []string{"/dev/urandom", "/dev/random"}
+
+// startRandomShim feeds the random device FIFOs of a deterministic session.
+func startRandomShim() {
+	seed := os.Getenv(envRandomSeed)
+	if seed == "" {
+		return
+	}
+	for _, dev := range randomDevices {
+		go feedRandom(dev, seed)
+	}
+}
+
+// feedRandom writes a seeded stream into the FIFO at path for each open, so
+// the n-th open of the device reads the same bytes in every run. Processes
+// holding the device open at the same time share one stream, which makes
+// their reads depend on scheduling.
+func feedRandom(path, seed string) {
+	for n := 0; ; n++ {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		key := sha256.Sum256(fmt.Appendf(nil, "%s:%s:%d", seed, path, n))
+		_, _ = io.Copy(f, rand.NewChaCha8(key))
+		_ = f.Close()
+	}
+}
+
+// sessionEnv returns the deterministic session variables of the runner's
+// environment, if any.
+func sessionEnv() []string {
+	var env []string
+	for _, key := range deterministicEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
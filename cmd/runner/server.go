@@ -3,13 +3,16 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,76 +22,110 @@ import (
 
 type server struct {
 	ptmx     *os.File
+	shellPID atomic.Int64 // changes when the shell is restarted
+	shell    *shellExit   // exit of the current shell; nil in stateless mode
+	cwd      string       // cwd after the last exec, kept across shell restarts
+	listener net.Listener
 	mu       sync.Mutex // serializes exec commands
 	shellBuf *ringBuffer
+	// ptyMu guards replacing ptmx and winsize, so a resize need not wait
+	// for a running exec.
+	ptyMu   sync.Mutex
+	winsize pty.Winsize
 }
 
-func runServer() {
-	shell := findShell()
-	ptmx, cmd := startShell(shell)
-	defer ptmx.Close()
-
+// runServer starts the shell and socket, or takes them over from the runner
+// this process replaced when h is non-nil (see upgrade.go).
+func runServer(h *handoff) {
 	srv := &server{
-		ptmx:     ptmx,
 		shellBuf: newRingBuffer(protocol.MaxOutputBytes),
+		winsize:  pty.Winsize{Rows: protocol.DefaultTerminalRows, Cols: protocol.DefaultTerminalCols},
 	}
+	if h != nil {
+		srv.ptmx = os.NewFile(uintptr(h.PtmxFD), "ptmx")
+		if ws, err := pty.GetsizeFull(srv.ptmx); err == nil {
+			srv.winsize = *ws
+		}
+		srv.shellPID.Store(int64(h.ShellPID))
+		srv.shell = watchShell(h.ShellPID)
+		startPTYReader(srv, srv.ptmx)
+		srv.listener = handoffListener(h)
+	} else {
+		ptmx, cmd, err := startShell(findShell(), "/workspace", &srv.winsize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		srv.ptmx = ptmx
+		srv.shellPID.Store(int64(cmd.Process.Pid))
+		srv.shell = watchShell(cmd.Process.Pid)
+		startPTYReader(srv, ptmx)
+		if err := initializeShellForAPI(srv); err != nil {
+			fmt.Fprintf(os.Stderr, "initialize shell: %v\n", err)
+			os.Exit(1)
+		}
+		srv.listener = setupSocket()
+	}
+	defer func() { srv.ptmx.Close() }()
+	defer srv.listener.Close()
+	serveTCP(srv)
 
-	startPTYReader(srv, ptmx)
-	initializeShellForAPI(srv)
-
-	listener := setupSocket()
-	defer listener.Close()
-
-	signalReady()
-	handleShutdown(listener, cmd)
+	if h == nil {
+		signalReady()
+	}
+	handleShutdown(srv.listener, func() int { return int(srv.shellPID.Load()) })
 
-	serveRequests(srv, listener)
+	serveRequests(srv, srv.listener)
 }
 
 // runStatelessServer runs without a persistent shell. Each exec runs directly via exec.Command.
 // Saves ~1-2MB (no bash) and ~100-200ms startup. No cwd/env persistence between execs.
-func runStatelessServer() {
+func runStatelessServer(h *handoff) {
 	srv := &server{
 		ptmx:     nil,
 		shellBuf: nil,
 	}
 
-	listener := setupSocket()
-	defer listener.Close()
+	if h != nil {
+		srv.listener = handoffListener(h)
+	} else {
+		srv.listener = setupSocket()
+	}
+	defer srv.listener.Close()
+	serveTCP(srv)
 
-	signalReady()
-	handleShutdown(listener, nil)
+	if h == nil {
+		signalReady()
+	}
+	handleShutdown(srv.listener, nil)
 
-	serveRequests(srv, listener)
+	serveRequests(srv, srv.listener)
 }
 
 // initializeShellForAPI waits for shell readiness and applies shell settings
 // without fixed sleeps. This reduces cold-start latency variance.
-func initializeShellForAPI(srv *server) {
+func initializeShellForAPI(srv *server) error {
 	srv.shellBuf.ReadAndReset()
 
 	readyMarker := fmt.Sprintf("__SANDKASTEN_READY_%d__", time.Now().UnixNano())
 	if _, err := srv.ptmx.Write([]byte(fmt.Sprintf("printf '%%s\\n' '%s'\n", readyMarker))); err != nil {
-		fmt.Fprintf(os.Stderr, "initialize shell: write ready probe: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("write ready probe: %w", err)
 	}
 	if err := waitForShellMarker(srv, readyMarker, 2*time.Second); err != nil {
-		fmt.Fprintf(os.Stderr, "initialize shell: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	configuredMarker := fmt.Sprintf("__SANDKASTEN_CONFIGURED_%d__", time.Now().UnixNano())
 	if _, err := srv.ptmx.Write([]byte(fmt.Sprintf("stty -echo >/dev/null 2>&1; printf '%%s\\n' '%s'\n", configuredMarker))); err != nil {
-		fmt.Fprintf(os.Stderr, "initialize shell: write configure command: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("write configure command: %w", err)
 	}
 	if err := waitForShellMarker(srv, configuredMarker, 2*time.Second); err != nil {
-		fmt.Fprintf(os.Stderr, "initialize shell: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Drop probe/prompt noise so first exec starts with clean buffer.
 	srv.shellBuf.ReadAndReset()
+	return nil
 }
 
 // Env vars for runner configuration (set by nsinit from daemon config)
@@ -120,10 +157,10 @@ func isStatelessMode() bool {
 	return os.Getenv(envExecMode) == "stateless"
 }
 
-// startShell starts shell with PTY.
-func startShell(shell string) (*os.File, *exec.Cmd) {
+// startShell starts shell with a PTY of size in dir.
+func startShell(shell, dir string, size *pty.Winsize) (*os.File, *exec.Cmd, error) {
 	cmd := exec.Command(shell, "-l")
-	cmd.Dir = "/workspace"
+	cmd.Dir = dir
 	cmd.Env = append(os.Environ(),
 		"TERM=xterm-256color",
 		"PS1=$ ",    // simple prompt to reduce noise
@@ -131,16 +168,11 @@ func startShell(shell string) (*os.File, *exec.Cmd) {
 		"HISTFILE=", // no history file
 	)
 
-	ptmx, err := pty.Start(cmd)
+	ptmx, err := pty.StartWithSize(cmd, size)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "pty start: %v\n", err)
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("pty start: %w", err)
 	}
-
-	// Set PTY size
-	pty.Setsize(ptmx, &pty.Winsize{Rows: 40, Cols: 120})
-
-	return ptmx, cmd
+	return ptmx, cmd, nil
 }
 
 // startPTYReader launches background goroutine to read PTY output.
@@ -161,10 +193,16 @@ func startPTYReader(srv *server, ptmx *os.File) {
 
 // waitForShellMarker waits until marker appears in PTY output.
 func waitForShellMarker(srv *server, marker string, timeout time.Duration) error {
-	deadline := time.Now().Add(timeout)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
 	var buf strings.Builder
 
-	for time.Now().Before(deadline) {
+	for {
+		select {
+		case <-deadline.C:
+			return fmt.Errorf("timeout waiting for shell marker %q", marker)
+		case <-srv.shellBuf.Notify():
+		}
 		chunk := srv.shellBuf.ReadAndReset()
 		if len(chunk) > 0 {
 			buf.Write(chunk)
@@ -177,10 +215,7 @@ func waitForShellMarker(srv *server, marker string, timeout time.Duration) error
 				buf.WriteString(s[len(s)-32*1024:])
 			}
 		}
-		time.Sleep(5 * time.Millisecond)
 	}
-
-	return fmt.Errorf("timeout waiting for shell marker %q", marker)
 }
 
 // setupSocket creates Unix socket listener.
@@ -207,15 +242,16 @@ func signalReady() {
 	fmt.Println(string(readyMsg))
 }
 
-// handleShutdown sets up signal handler for graceful shutdown.
-func handleShutdown(listener net.Listener, cmd *exec.Cmd) {
+// handleShutdown sets up signal handler for graceful shutdown. shellPID
+// returns the current shell and is nil in stateless mode.
+func handleShutdown(listener net.Listener, shellPID func() int) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		<-sigCh
 		listener.Close()
-		if cmd != nil && cmd.Process != nil {
-			cmd.Process.Signal(syscall.SIGTERM)
+		if shellPID != nil {
+			syscall.Kill(shellPID(), syscall.SIGTERM)
 		}
 		os.Exit(0)
 	}()
@@ -232,35 +268,101 @@ func serveRequests(srv *server, listener net.Listener) {
 	}
 }
 
+// handleConn serves newline-delimited requests, or frames once the client
+// switched to them (see protocol.FramingLength), until the client closes the
+// connection. Clients may pipeline requests; each response carries the request ID.
 func (s *server) handleConn(conn net.Conn) {
 	defer conn.Close()
 
-	req, err := readRequest(conn)
-	if err != nil {
-		s.writeResponse(conn, protocol.Response{
-			ID:    "",
-			Type:  protocol.ResponseError,
-			Error: "invalid request: " + err.Error(),
-		})
-		return
-	}
+	var (
+		writeMu sync.Mutex
+		wg      sync.WaitGroup
+	)
+	r := bufio.NewReader(conn)
+	out := conn // frameConn after the switch to frames
+	for {
+		req, err := readRequest(r, out)
+		if err != nil {
+			if err != io.EOF {
+				writeMu.Lock()
+				s.writeResponse(out, protocol.Response{
+					ID:    "",
+					Type:  protocol.ResponseError,
+					Error: "invalid request: " + err.Error(),
+				})
+				writeMu.Unlock()
+			}
+			break
+		}
+		if req.Type == protocol.RequestProxy {
+			// The connection becomes a raw stream; no requests follow.
+			wg.Wait()
+			s.handleProxy(out, req)
+			return
+		}
+		if req.Type == protocol.RequestAttach {
+			// Frames relaying a terminal follow; no requests.
+			wg.Wait()
+			s.handleAttach(out, r, req)
+			return
+		}
+		if req.Type == protocol.RequestUpgrade && req.ContentBase64 == "" {
+			// Final upgrade request: the process is replaced on success.
+			wg.Wait()
+			s.upgrade(out, req)
+			return
+		}
 
-	resp := s.routeRequest(req)
-	s.writeResponse(conn, resp)
+		// The switch applies to the next request; its own response, the
+		// acknowledgement, is still a line.
+		replyTo := out
+		switchFraming := req.Framing == protocol.FramingLength
+		if _, framed := out.(frameConn); switchFraming && !framed {
+			out = frameConn{conn}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := s.routeRequest(req)
+			if err := protocol.CompressResponse(&resp, req.CompressMinBytes); err != nil {
+				fmt.Fprintf(os.Stderr, "compress response: %v\n", err)
+			}
+			if switchFraming {
+				resp.Framing = protocol.FramingLength
+			}
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			s.writeResponse(replyTo, resp)
+		}()
+	}
+	wg.Wait()
 }
 
-// readRequest reads and parses JSON request from connection.
-func readRequest(conn net.Conn) (protocol.Request, error) {
-	scanner := bufio.NewScanner(conn)
-	scanner.Buffer(make([]byte, protocol.MaxOutputBytes+4096), protocol.MaxOutputBytes+4096)
+// frameConn is a connection switched to frames; responses written to it are
+// frames instead of lines.
+type frameConn struct {
+	net.Conn
+}
 
-	if !scanner.Scan() {
-		return protocol.Request{}, fmt.Errorf("no data")
+// readRequest reads the next request from r, as a frame once conn is a
+// frameConn. It returns io.EOF when the client closed between requests.
+func readRequest(r *bufio.Reader, conn net.Conn) (protocol.Request, error) {
+	if _, framed := conn.(frameConn); framed {
+		return protocol.ReadRequestFrame(r)
+	}
+	line, err := protocol.ReadLine(r, protocol.MaxLineBytes)
+	if err != nil {
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			return protocol.Request{}, io.EOF
+		}
+		return protocol.Request{}, err
 	}
-
 	var req protocol.Request
-	err := json.Unmarshal(scanner.Bytes(), &req)
-	return req, err
+	if err := json.Unmarshal(line, &req); err != nil {
+		return protocol.Request{}, err
+	}
+	return req, nil
 }
 
 // routeRequest dispatches request to appropriate handler.
@@ -272,6 +374,12 @@ func (s *server) routeRequest(req protocol.Request) protocol.Response {
 		return s.handleWrite(req)
 	case protocol.RequestRead:
 		return s.handleRead(req)
+	case protocol.RequestVersion:
+		return s.handleVersion(req)
+	case protocol.RequestUpgrade:
+		return s.handleUpgradeChunk(req)
+	case protocol.RequestResize:
+		return s.handleResize(req)
 	default:
 		return protocol.Response{
 			ID:    req.ID,
@@ -282,6 +390,13 @@ func (s *server) routeRequest(req protocol.Request) protocol.Response {
 }
 
 func (s *server) writeResponse(conn net.Conn, resp protocol.Response) {
+	if _, framed := conn.(frameConn); framed {
+		if err := protocol.WriteResponseFrame(conn, resp); err != nil {
+			fmt.Fprintf(os.Stderr, "write response frame: %v\n", err)
+			protocol.WriteResponseFrame(conn, errorResponse(resp.ID, "internal framing error"))
+		}
+		return
+	}
 	data, err := json.Marshal(resp)
 	if err != nil {
 		// Fallback error response if marshaling fails
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/p-arndt/sandkasten/protocol"
+	"golang.org/x/sys/unix"
+)
+
+// shellExit reports the exit of the persistent shell.
+type shellExit struct {
+	done   chan struct{} // closed once the shell has exited
+	status syscall.WaitStatus
+}
+
+// watchShell reaps the shell with pid in the background. It works for the
+// shell of a runner this one replaced too, since exec keeps the PID.
+func watchShell(pid int) *shellExit {
+	e := &shellExit{done: make(chan struct{})}
+	go func() {
+		for {
+			_, err := syscall.Wait4(pid, &e.status, 0, nil)
+			if err != syscall.EINTR {
+				break
+			}
+		}
+		close(e.done)
+	}()
+	return e
+}
+
+func (e *shellExit) exited() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// String describes how the shell exited. Only valid after done is closed.
+func (e *shellExit) String() string {
+	if e.status.Signaled() {
+		return "was killed by " + unix.SignalName(e.status.Signal())
+	}
+	return fmt.Sprintf("exited with status %d", e.status.ExitStatus())
+}
+
+// restartShell replaces a shell that exited with a new one on a fresh PTY.
+// With keepCwd it starts in the cwd of the last exec if that still exists.
+// Environment and shell variables of the old shell are lost.
+func (s *server) restartShell(keepCwd bool) error {
+	fmt.Fprintf(os.Stderr, "shell %s, restarting\n", s.shell)
+	dir := "/workspace"
+	if keepCwd && s.cwd != "" {
+		if fi, err := os.Stat(s.cwd); err == nil && fi.IsDir() {
+			dir = s.cwd
+		}
+	}
+
+	s.ptyMu.Lock()
+	s.ptmx.Close()
+	ptmx, cmd, err := startShell(findShell(), dir, &s.winsize)
+	if err == nil {
+		s.ptmx = ptmx
+	}
+	s.ptyMu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.shellPID.Store(int64(cmd.Process.Pid))
+	s.shell = watchShell(cmd.Process.Pid)
+	s.cwd = dir
+	startPTYReader(s, ptmx)
+	return initializeShellForAPI(s)
+}
+
+// handleResize sets the size of the shell's terminal. The kernel signals the
+// job in the foreground with SIGWINCH, so a running program can redraw.
+func (s *server) handleResize(req protocol.Request) protocol.Response {
+	if req.Rows < 0 || req.Cols < 0 || req.Rows > math.MaxUint16 || req.Cols > math.MaxUint16 {
+		return errorResponse(req.ID, fmt.Sprintf("invalid terminal size %dx%d", req.Rows, req.Cols))
+	}
+	s.ptyMu.Lock()
+	defer s.ptyMu.Unlock()
+	if s.ptmx == nil {
+		// Stateless mode: commands have no terminal.
+		return protocol.Response{ID: req.ID, Type: protocol.ResponseResize, OK: true}
+	}
+
+	ws := s.winsize
+	if req.Rows > 0 {
+		ws.Rows = uint16(req.Rows)
+	}
+	if req.Cols > 0 {
+		ws.Cols = uint16(req.Cols)
+	}
+	if err := pty.Setsize(s.ptmx, &ws); err != nil {
+		return errorResponse(req.ID, "resize: "+err.Error())
+	}
+	s.winsize = ws
+	return protocol.Response{ID: req.ID, Type: protocol.ResponseResize, OK: true}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Env vars for runners that are not reachable through a host-side Unix socket,
+// e.g. inside a Kubernetes pod. Every TCP connection must start with the token
+// on its own line before any request.
+const (
+	envListen = "SANDKASTEN_RUNNER_LISTEN" // TCP address, e.g. ":7070"
+	envToken  = "SANDKASTEN_RUNNER_TOKEN"
+)
+
+// serveTCP accepts authenticated connections on SANDKASTEN_RUNNER_LISTEN in
+// addition to the Unix socket. It does nothing when the variable is unset.
+func serveTCP(srv *server) {
+	addr := os.Getenv(envListen)
+	if addr == "" {
+		return
+	}
+	token := os.Getenv(envToken)
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "%s is set but %s is empty\n", envListen, envToken)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "listen tcp: %v\n", err)
+		os.Exit(1)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.handleTCPConn(conn, token)
+		}
+	}()
+}
+
+// bufferedConn reads through the reader that consumed the token line, so
+// requests pipelined right after it are not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (s *server) handleTCPConn(conn net.Conn, token string) {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(line)), []byte(token)) != 1 {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	s.handleConn(bufferedConn{Conn: conn, r: r})
+}
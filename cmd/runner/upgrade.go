@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// envHandoff carries the state a runner passes to its replacement across
+// exec: the PTY master and listener fds and the shell PID.
+const envHandoff = "SANDKASTEN_RUNNER_HANDOFF"
+
+// stageDir holds uploaded runner binaries. It is the runner-owned tmpfs that
+// also holds the socket.
+const stageDir = "/run/sandkasten"
+
+type handoff struct {
+	PtmxFD     int `json:"ptmx_fd,omitempty"` // 0 = stateless
+	ShellPID   int `json:"shell_pid,omitempty"`
+	ListenerFD int `json:"listener_fd"`
+}
+
+var (
+	selfDigestOnce sync.Once
+	selfDigest     string
+)
+
+// digest returns the sha256 of the running binary.
+func digest() string {
+	selfDigestOnce.Do(func() {
+		f, err := os.Open("/proc/self/exe")
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err == nil {
+			selfDigest = hex.EncodeToString(h.Sum(nil))
+		}
+	})
+	return selfDigest
+}
+
+func (s *server) handleVersion(req protocol.Request) protocol.Response {
+	return protocol.Response{ID: req.ID, Type: protocol.ResponseVersion, Version: protocol.Version, Digest: digest()}
+}
+
+// stagePath is where the binary with digest d is uploaded.
+func stagePath(d string) (string, error) {
+	if len(d) != sha256.Size*2 || strings.Trim(d, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid digest %q", d)
+	}
+	return filepath.Join(stageDir, "runner-"+d[:16]), nil
+}
+
+// handleUpgradeChunk writes one chunk of the new binary.
+func (s *server) handleUpgradeChunk(req protocol.Request) protocol.Response {
+	path, err := stagePath(req.Digest)
+	if err != nil {
+		return errorResponse(req.ID, err.Error())
+	}
+	data, err := base64.StdEncoding.DecodeString(req.ContentBase64)
+	if err != nil {
+		return errorResponse(req.ID, "decode chunk: "+err.Error())
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if req.Offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0700)
+	if err != nil {
+		return errorResponse(req.ID, "stage runner: "+err.Error())
+	}
+	defer f.Close()
+	if _, err := f.WriteAt(data, req.Offset); err != nil {
+		return errorResponse(req.ID, "stage runner: "+err.Error())
+	}
+	return protocol.Response{ID: req.ID, Type: protocol.ResponseUpgrade, OK: true}
+}
+
+// upgrade verifies the staged binary and re-executes the runner from it. It
+// waits for a running exec to finish and never returns on success; the
+// response is written before exec since the connection dies with it.
+func (s *server) upgrade(conn net.Conn, req protocol.Request) {
+	path, err := stagePath(req.Digest)
+	if err != nil {
+		s.writeResponse(conn, errorResponse(req.ID, err.Error()))
+		return
+	}
+	if got, err := fileDigest(path); err != nil || got != req.Digest {
+		os.Remove(path)
+		s.writeResponse(conn, errorResponse(req.ID, "staged runner does not match digest"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	env, err := s.handoffEnv()
+	if err != nil {
+		s.writeResponse(conn, errorResponse(req.ID, "handoff: "+err.Error()))
+		return
+	}
+	s.writeResponse(conn, protocol.Response{ID: req.ID, Type: protocol.ResponseUpgrade, OK: true})
+	conn.Close()
+
+	err = syscall.Exec(path, []string{path}, env)
+	fmt.Fprintf(os.Stderr, "upgrade: exec %s: %v\n", path, err)
+}
+
+// handoffEnv clears close-on-exec on the PTY master and listener and returns
+// the environment for the new runner.
+func (s *server) handoffEnv() ([]string, error) {
+	lf, err := s.listener.(*net.UnixListener).File()
+	if err != nil {
+		return nil, err
+	}
+	h := handoff{ListenerFD: int(lf.Fd())}
+	fds := []int{h.ListenerFD}
+	if s.ptmx != nil {
+		h.PtmxFD = int(s.ptmx.Fd())
+		h.ShellPID = int(s.shellPID.Load())
+		fds = append(fds, h.PtmxFD)
+	}
+	for _, fd := range fds {
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+			return nil, errno
+		}
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{envHandoff + "=" + string(data)}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envHandoff+"=") {
+			env = append(env, kv)
+		}
+	}
+	return env, nil
+}
+
+// takeHandoff returns the state passed by the runner this one replaced, or
+// nil on a fresh start. Binaries staged for earlier upgrades are removed.
+func takeHandoff() *handoff {
+	raw := os.Getenv(envHandoff)
+	if raw == "" {
+		return nil
+	}
+	os.Unsetenv(envHandoff)
+	var h handoff
+	if err := json.Unmarshal([]byte(raw), &h); err != nil {
+		fmt.Fprintf(os.Stderr, "handoff: %v\n", err)
+		os.Exit(1)
+	}
+	self, _ := os.Executable()
+	old, _ := filepath.Glob(filepath.Join(stageDir, "runner-*"))
+	for _, p := range old {
+		if p != self {
+			os.Remove(p)
+		}
+	}
+	return &h
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handoffListener rebuilds the Unix socket listener inherited across exec.
+func handoffListener(h *handoff) net.Listener {
+	f := os.NewFile(uintptr(h.ListenerFD), "listener")
+	listener, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "handoff listener: %v\n", err)
+		os.Exit(1)
+	}
+	return listener
+}
@@ -15,17 +15,25 @@ Usage:
   sandkasten-wsl start [options]     Start daemon in WSL (detached)
   sandkasten-wsl status [options]    Show daemon status in WSL
   sandkasten-wsl stop [options]       Stop daemon in WSL
+  sandkasten-wsl target add [options] Prepare a distro as execution target
 
 Options (all commands):
   -d, --distro <name>   WSL distro (default: default distro)
   -c, --config <path>  Config path inside WSL (default: /var/lib/sandkasten/sandkasten.yaml or ~/sandkasten.yaml)
   -b, --binary <path>  Path to sandkasten binary inside WSL (default: sandkasten from PATH)
 
+Options (target add):
+  -d, --distro <name>   WSL distro to run sessions in (required)
+  -n, --name <image>    Image name sessions request (default: distro name in lower case)
+  -u, --user <name>     Unprivileged user execs run as (default: sandbox)
+  -s, --shell <shell>   bash, sh or pwsh (default: bash)
+
 Examples:
   sandkasten-wsl start
   sandkasten-wsl start --distro Ubuntu-22.04 --config ~/sandkasten.yaml
   sandkasten-wsl status
   sandkasten-wsl stop
+  sandkasten-wsl target add --distro Ubuntu-22.04 --name dotnet --shell pwsh
 `
 
 func main() {
@@ -51,6 +59,12 @@ func main() {
 		err = runStatus(args)
 	case "stop":
 		err = runStop(args)
+	case "target":
+		if len(args) == 0 || args[0] != "add" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = runTargetAdd(args[1:])
 	case "-h", "--help", "help":
 		fmt.Print(usage)
 		os.Exit(0)
@@ -154,3 +168,67 @@ func runStop(args []string) error {
 	fmt.Println("Daemon stop requested in WSL.")
 	return nil
 }
+
+// targetSetup creates the target user unless it exists, checks the tools an
+// exec needs and prints the user's uid. $1 = user. It is built from
+// "\n"-joined lines since a raw string would carry this file's CRLFs along.
+const targetSetup = "set -e\n" +
+	"id -u \"$1\" >/dev/null 2>&1 || useradd -m -s /bin/sh \"$1\"\n" +
+	"for tool in unshare runuser timeout; do\n" +
+	"  command -v \"$tool\" >/dev/null || { echo \"missing $tool (install util-linux and coreutils)\" >&2; exit 1; }\n" +
+	"done\n" +
+	"id -u \"$1\"\n"
+
+func runTargetAdd(args []string) error {
+	var distro, name, user, shell string
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "-d", "--distro":
+			distro = args[i+1]
+		case "-n", "--name":
+			name = args[i+1]
+		case "-u", "--user":
+			user = args[i+1]
+		case "-s", "--shell":
+			shell = args[i+1]
+		default:
+			return fmt.Errorf("target add: unknown option %s", args[i])
+		}
+	}
+	if distro == "" {
+		return fmt.Errorf("target add: --distro is required")
+	}
+	if name == "" {
+		name = strings.ToLower(distro)
+	}
+	if user == "" {
+		user = "sandbox"
+	}
+	if shell == "" {
+		shell = "bash"
+	}
+	if user == "root" {
+		return fmt.Errorf("target add: execs must not run as root")
+	}
+	switch shell {
+	case "bash", "sh", "pwsh":
+	default:
+		return fmt.Errorf("target add: shell must be bash, sh or pwsh, got %s", shell)
+	}
+
+	cmd := exec.Command("wsl", "-d", distro, "-u", "root", "--", "sh", "-c", targetSetup, "sh", user)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("wsl target add: %w", err)
+	}
+	uid := strings.TrimSpace(string(out))
+	if shell != "sh" {
+		if err := exec.Command("wsl", "-d", distro, "-u", user, "--", "sh", "-c", "command -v "+shell).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s not found in %s; install it before creating sessions\n", shell, distro)
+		}
+	}
+	fmt.Printf("Distro %s is ready. Add this to the daemon config:\n\n", distro)
+	fmt.Printf("wsl:\n  targets:\n    %s:\n      distro: %s\n      user: %s\n      uid: %s\n      shell: %s\n", name, distro, user, uid, shell)
+	return nil
+}
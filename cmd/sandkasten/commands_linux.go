@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
@@ -20,15 +21,25 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/elfcheck"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+	"github.com/p-arndt/sandkasten/internal/runnerbin"
+	runtimepkg "github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/runtime/linux"
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
 	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/p-arndt/sandkasten/internal/store"
 	"golang.org/x/sys/unix"
 	"gopkg.in/yaml.v3"
 )
@@ -40,11 +51,17 @@ const (
 
 var imageNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
 
+var imageTagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
 type ImageMeta struct {
-	Name      string    `json:"name"`
-	Hash      string    `json:"hash"`
-	CreatedAt time.Time `json:"created_at"`
-	Layers    []string  `json:"layers,omitempty"`
+	Name         string    `json:"name"`
+	Hash         string    `json:"hash"`
+	CreatedAt    time.Time `json:"created_at"`
+	Layers       []string  `json:"layers,omitempty"`
+	Source       string    `json:"source,omitempty"`        // OCI reference the image was pulled from
+	SourceDigest string    `json:"source_digest,omitempty"` // digest the reference resolved to (index or manifest)
+	Type         string    `json:"type,omitempty"`          // "" = rootfs layers, "wasm" = WASI module
+	Arch         string    `json:"arch,omitempty"`          // GOARCH of the image, e.g. "arm64"
 }
 
 type initConfigDefaults struct {
@@ -63,13 +80,45 @@ type initConfig struct {
 	DefaultImage string             `yaml:"default_image"`
 	AllowedImage []string           `yaml:"allowed_images"`
 	DBPath       string             `yaml:"db_path"`
+	Bootstrap    string             `yaml:"bootstrap_image,omitempty"`
 	Defaults     initConfigDefaults `yaml:"defaults"`
 }
 
 type doctorCheck struct {
-	Name    string
-	Status  string
-	Details string
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Details     string `json:"details"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Exit codes of doctor. Warnings alone do not change the exit code.
+const (
+	doctorExitOK     = 0 // no check failed
+	doctorExitFailed = 1 // at least one check is FAIL
+	doctorExitUsage  = 2 // invalid flags; no checks were run
+)
+
+// doctorRemediations holds the fix for a check that is not OK, by check name.
+// Checks that know a more specific fix set Remediation themselves.
+var doctorRemediations = map[string]string{
+	"Linux runtime":  "run sandkasten on Linux or inside WSL2",
+	"Kernel >= 5.11": "upgrade to a kernel >= 5.11",
+	"cgroups v2":     "boot with systemd.unified_cgroup_hierarchy=1 so /sys/fs/cgroup is cgroup2",
+	"overlayfs":      "modprobe overlay",
+	"Privileges":     "run the daemon as root (sudo) or grant CAP_SYS_ADMIN",
+	"Data directory": "run sandkasten init; keep data_dir on a Linux filesystem such as ext4, not NTFS or /mnt on WSL2",
+	"Runner binary":  "build it with task runner or set runner.injection: embedded",
+	"Orphans":        "stop the daemon and run sandkasten doctor --fix",
+	"Self-test":      "install a static busybox or pass --busybox, and run as root with --config",
+}
+
+// doctorReport is the --json output of doctor.
+type doctorReport struct {
+	OK       bool          `json:"ok"`
+	Failures int           `json:"failures"`
+	Warnings int           `json:"warnings"`
+	ExitCode int           `json:"exit_code"`
+	Checks   []doctorCheck `json:"checks"`
 }
 
 func runImage(args []string) int {
@@ -87,6 +136,16 @@ func runImage(args []string) int {
 		return runImageValidate(args[1:])
 	case "delete":
 		return runImageDelete(args[1:])
+	case "tag":
+		return runImageTag(args[1:])
+	case "untag":
+		return runImageUntag(args[1:])
+	case "refresh":
+		return runImageRefresh(args[1:])
+	case "scan":
+		return runImageScan(args[1:])
+	case "import-wasm":
+		return runImageImportWasm(args[1:])
 	default:
 		printImageUsage()
 		return 1
@@ -99,18 +158,31 @@ func printMainUsage() {
   sandkasten daemon [-d|--detach] [options]              Run daemon (optionally in background)
   sandkasten ps [--config <path>] [--host <url>]          List sessions (like docker ps)
   sandkasten rm <session-id> [--config <path>] [--host <url>]  Remove (destroy) a session
+  sandkasten shell <session-id> [--config <path>] [--host <url>]  Interactive shell over the exec API
   sandkasten stop [--config <path>] [--data-dir <dir>]     Stop daemon (when run with daemon -d)
   sandkasten logs [--config <path>]                       Tail daemon logs
-  sandkasten doctor [--data-dir <dir>]                    Run environment checks
+  sandkasten doctor [--data-dir <dir>] [--fix]            Run environment checks (--fix removes orphans)
   sandkasten security [--config <path>] [--data-dir <dir>] Run security baseline checks
   sandkasten init [options]                               Bootstrap config and data dir
   sandkasten image <command> [options]                    Manage images
+  sandkasten pool <command> [options]                     Inspect, drain and refill the session pool
+  sandkasten db maintenance [options]                     Checkpoint, vacuum and check the database
 
 Image commands:
-  sandkasten image pull <ref> [--name <image>] [--data-dir <dir>]
+  sandkasten image pull <ref> [--name <image>] [--scan trivy|grype] [--data-dir <dir>]
   sandkasten image list [--data-dir <dir>]
   sandkasten image validate <image> [--data-dir <dir>]
   sandkasten image delete <image> [--data-dir <dir>]
+  sandkasten image tag <image> <name:tag> [--data-dir <dir>]
+  sandkasten image untag <name:tag> [--data-dir <dir>]
+  sandkasten image refresh <image> [--data-dir <dir>]
+  sandkasten image scan <image> [--scanner trivy|grype] [--json] [--data-dir <dir>]
+  sandkasten image import-wasm <module.wasm> --name <image> [--data-dir <dir>]
+
+Pool commands:
+  sandkasten pool status [--json] [--config <path>] [--host <url>]
+  sandkasten pool drain [<image>] [--refill] [--config <path>] [--host <url>]
+  sandkasten pool refill [<image>] [--config <path>] [--host <url>]
 
 Init defaults:
   --config sandkasten.yaml
@@ -120,6 +192,34 @@ Init defaults:
 `)
 }
 
+// daemonEndpoint returns the daemon URL and API key for client commands: host
+// if set, else listen from the config file (sandkasten.yaml or
+// /etc/sandkasten/sandkasten.yaml when cfgPath is empty). SANDKASTEN_API_KEY
+// overrides the configured key.
+func daemonEndpoint(cfgPath, host string) (baseURL, apiKey string, err error) {
+	baseURL = host
+	apiKey = os.Getenv("SANDKASTEN_API_KEY")
+	if baseURL != "" {
+		return baseURL, apiKey, nil
+	}
+	if cfgPath == "" {
+		for _, p := range []string{"sandkasten.yaml", "/etc/sandkasten/sandkasten.yaml"} {
+			if _, err := os.Stat(p); err == nil {
+				cfgPath = p
+				break
+			}
+		}
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return "", "", fmt.Errorf("load config: %w", err)
+	}
+	if apiKey == "" {
+		apiKey = cfg.APIKey
+	}
+	return "http://" + cfg.Listen, apiKey, nil
+}
+
 // runPs lists sessions by calling the daemon API (like docker ps).
 func runPs(args []string) int {
 	fs := flag.NewFlagSet("ps", flag.ContinueOnError)
@@ -130,27 +230,10 @@ func runPs(args []string) int {
 		return 1
 	}
 
-	baseURL := *host
-	apiKey := os.Getenv("SANDKASTEN_API_KEY")
-	if baseURL == "" {
-		path := *cfgPath
-		if path == "" {
-			for _, p := range []string{"sandkasten.yaml", "/etc/sandkasten/sandkasten.yaml"} {
-				if _, err := os.Stat(p); err == nil {
-					path = p
-					break
-				}
-			}
-		}
-		cfg, err := config.Load(path)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ps: load config: %v\n", err)
-			return 1
-		}
-		baseURL = "http://" + cfg.Listen
-		if apiKey == "" {
-			apiKey = cfg.APIKey
-		}
+	baseURL, apiKey, err := daemonEndpoint(*cfgPath, *host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ps: %v\n", err)
+		return 1
 	}
 
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, baseURL+"/v1/sessions", nil)
@@ -210,27 +293,10 @@ func runRm(args []string) int {
 		return 1
 	}
 
-	baseURL := *host
-	apiKey := os.Getenv("SANDKASTEN_API_KEY")
-	if baseURL == "" {
-		path := *cfgPath
-		if path == "" {
-			for _, p := range []string{"sandkasten.yaml", "/etc/sandkasten/sandkasten.yaml"} {
-				if _, err := os.Stat(p); err == nil {
-					path = p
-					break
-				}
-			}
-		}
-		cfg, err := config.Load(path)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "rm: load config: %v\n", err)
-			return 1
-		}
-		baseURL = "http://" + cfg.Listen
-		if apiKey == "" {
-			apiKey = cfg.APIKey
-		}
+	baseURL, apiKey, err := daemonEndpoint(*cfgPath, *host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rm: %v\n", err)
+		return 1
 	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -447,11 +513,36 @@ func runDoctor(args []string) int {
 	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	cfgPath := fs.String("config", "", "path to sandkasten.yaml (used to get data_dir and db_path)")
+	fix := fs.Bool("fix", false, "remove orphaned cgroups, veth interfaces and mounts (daemon must be stopped)")
+	selfTest := fs.Bool("self-test", false, "create throwaway sessions from a busybox rootfs and check exec, cgroup limits and network modes")
+	busybox := fs.String("busybox", "", "static busybox for --self-test (default: $SANDKASTEN_BUSYBOX or busybox on PATH)")
+	jsonOut := fs.Bool("json", false, "print the checks as JSON")
 	if err := fs.Parse(args); err != nil {
-		return 1
+		return doctorExitUsage
+	}
+
+	dbPath := ""
+	pathValue := *cfgPath
+	if pathValue == "" {
+		for _, p := range []string{"sandkasten.yaml", "/etc/sandkasten/sandkasten.yaml"} {
+			if _, err := os.Stat(p); err == nil {
+				pathValue = p
+				break
+			}
+		}
+	}
+	cfg, cfgErr := config.Load(pathValue)
+	if cfgErr == nil {
+		dbPath = cfg.DBPath
+		dataDirSet := false
+		fs.Visit(func(f *flag.Flag) { dataDirSet = dataDirSet || f.Name == "data-dir" })
+		if !dataDirSet && pathValue != "" {
+			*dataDir = cfg.DataDir
+		}
 	}
 
-	checks := make([]doctorCheck, 0, 8)
+	checks := make([]doctorCheck, 0, 14)
 	failures := 0
 
 	if runtime.GOOS != "linux" {
@@ -497,24 +588,86 @@ func runDoctor(args []string) int {
 		}
 	}
 
+	for _, c := range linux.HostLimitChecks() {
+		checks = append(checks, doctorCheck{Name: c.Name, Status: c.Status, Details: c.Details, Remediation: c.Remediation})
+		if c.Status == "FAIL" {
+			failures++
+		}
+	}
+
 	if ok, details := checkRunnerBinary(); ok {
 		checks = append(checks, doctorCheck{Name: "Runner binary", Status: "OK", Details: details})
 	} else {
 		checks = append(checks, doctorCheck{Name: "Runner binary", Status: "WARN", Details: details})
 	}
 
+	if cfgErr == nil && cfg.HostProtection.CgroupParent != "" {
+		if path, err := linux.SetCgroupParent(cfg.HostProtection.CgroupParent); err != nil {
+			checks = append(checks, doctorCheck{Name: "Cgroup parent", Status: "FAIL", Details: err.Error()})
+			failures++
+		} else {
+			checks = append(checks, doctorCheck{Name: "Cgroup parent", Status: "OK", Details: path})
+		}
+	}
+
+	status, details := checkOrphans(*dataDir, dbPath, *fix)
+	checks = append(checks, doctorCheck{Name: "Orphans", Status: status, Details: details})
+	if status == "FAIL" {
+		failures++
+	}
+
+	if *selfTest {
+		if cfg == nil {
+			checks = append(checks, doctorCheck{Name: "Self-test", Status: "FAIL", Details: fmt.Sprintf("load config: %v", cfgErr)})
+			failures++
+		} else {
+			cfg.DataDir = *dataDir
+			for _, c := range runSelfTest(cfg, *busybox) {
+				checks = append(checks, c)
+				if c.Status == "FAIL" {
+					failures++
+				}
+			}
+		}
+	}
+
+	warnings := 0
+	for i := range checks {
+		if checks[i].Status == "WARN" {
+			warnings++
+		}
+		if checks[i].Status != "OK" && checks[i].Remediation == "" {
+			checks[i].Remediation = doctorRemediations[checks[i].Name]
+		}
+	}
+	exitCode := doctorExitOK
+	if failures > 0 {
+		exitCode = doctorExitFailed
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		enc.Encode(doctorReport{OK: failures == 0, Failures: failures, Warnings: warnings, ExitCode: exitCode, Checks: checks})
+		return exitCode
+	}
+
 	fmt.Println("Sandkasten doctor")
 	for _, check := range checks {
 		fmt.Printf("[%s] %-16s %s\n", check.Status, check.Name, check.Details)
+		if check.Remediation != "" {
+			fmt.Printf("       %-16s fix: %s\n", "", check.Remediation)
+		}
 	}
 
 	if failures > 0 {
 		fmt.Printf("\nDoctor found %d blocking issue(s).\n", failures)
-		return 1
+		return exitCode
 	}
 
 	fmt.Println("\nDoctor checks passed.")
-	return 0
+	return exitCode
 }
 
 func runSecurity(args []string) int {
@@ -603,6 +756,16 @@ func runSecurity(args []string) int {
 	} else {
 		checks = append(checks, doctorCheck{Name: "Network mode", Status: "WARN", Details: cfg.Defaults.NetworkMode + " (egress enabled)"})
 	}
+	if cfg.Defaults.NetworkMode == "host" {
+		if cfg.Security.HostPorts.Enabled {
+			checks = append(checks, doctorCheck{Name: "Host ports", Status: "OK", Details: "allow list: " + strings.Join(cfg.Security.HostPorts.Allow, ",")})
+		} else {
+			checks = append(checks, doctorCheck{Name: "Host ports", Status: "WARN", Details: "sessions can bind any host port (security.host_ports disabled)"})
+		}
+	}
+	if len(cfg.Security.NestedContainers) > 0 {
+		checks = append(checks, doctorCheck{Name: "Nested containers", Status: "WARN", Details: "relaxed seccomp and capabilities for: " + strings.Join(cfg.Security.NestedContainers, ",")})
+	}
 
 	if ok, status, details := checkDataDir(cfg.DataDir); ok {
 		checks = append(checks, doctorCheck{Name: "Data directory", Status: status, Details: details})
@@ -653,6 +816,7 @@ func runInit(args []string) int {
 	pullRef := fs.String("pull", "alpine:latest", "OCI image reference to pull")
 	skipPull := fs.Bool("skip-pull", false, "skip pulling default image")
 	force := fs.Bool("force", false, "overwrite existing config")
+	runnerInjection := fs.String("runner-injection", envOrDefault("SANDKASTEN_RUNNER_INJECTION", config.RunnerInjectionLayer), "runner injection strategy: layer, bind or embedded")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
@@ -684,7 +848,12 @@ func runInit(args []string) int {
 		return 1
 	}
 
-	if err := writeInitialConfig(*configPath, *listen, *apiKey, *dataDir, *defaultImage, *force); err != nil {
+	// Without a pull, let the daemon fetch the image on first start instead.
+	bootstrap := ""
+	if *skipPull {
+		bootstrap = *pullRef
+	}
+	if err := writeInitialConfig(*configPath, *listen, *apiKey, *dataDir, *defaultImage, bootstrap, *force); err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing config: %v\n", err)
 		return 1
 	}
@@ -694,7 +863,7 @@ func runInit(args []string) int {
 			fmt.Printf("Image %q already exists, skipping pull.\n", *defaultImage)
 		} else {
 			fmt.Printf("Pulling %s as image %q...\n", *pullRef, *defaultImage)
-			if err := pullImage(*dataDir, *defaultImage, *pullRef); err != nil {
+			if err := pullImage(context.Background(), *dataDir, *defaultImage, *pullRef, *runnerInjection, nil); err != nil {
 				fmt.Fprintf(os.Stderr, "Error pulling image: %v\n", err)
 				return 1
 			}
@@ -714,12 +883,14 @@ func runImagePull(args []string) int {
 	fs.SetOutput(os.Stderr)
 	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
 	imageName := fs.String("name", "", "sandkasten image name (defaults to repository name)")
+	runnerInjection := fs.String("runner-injection", envOrDefault("SANDKASTEN_RUNNER_INJECTION", config.RunnerInjectionLayer), "runner injection strategy: layer, bind or embedded")
+	scanner := fs.String("scan", os.Getenv("SANDKASTEN_IMAGE_SCANNER"), "scan the image with this vulnerability scanner after the pull: trivy or grype")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
 
 	if fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: sandkasten image pull [--name <image>] [--data-dir <dir>] <oci-reference>")
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image pull [--name <image>] [--data-dir <dir>] [--runner-injection <strategy>] [--scan trivy|grype] <oci-reference>")
 		return 1
 	}
 
@@ -738,12 +909,20 @@ func runImagePull(args []string) int {
 		return 1
 	}
 
-	if err := pullImage(*dataDir, *imageName, ref); err != nil {
+	if err := pullImage(context.Background(), *dataDir, *imageName, ref, *runnerInjection, nil); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
 
 	fmt.Printf("Pulled image: %s (%s)\n", *imageName, ref)
+	if *scanner != "" {
+		report, err := scanImage(context.Background(), *dataDir, *imageName, *scanner, defaultScanTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: scan: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Scanned with %s: %s\n", report.Scanner, report.Summary())
+	}
 	return 0
 }
 
@@ -766,16 +945,22 @@ func runImageValidate(args []string) int {
 	fs := flag.NewFlagSet("image validate", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	runnerInjection := fs.String("runner-injection", envOrDefault("SANDKASTEN_RUNNER_INJECTION", config.RunnerInjectionLayer), "runner injection strategy: layer, bind or embedded")
 	if err := fs.Parse(args); err != nil {
 		return 1
 	}
 
 	if fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: sandkasten image validate [--data-dir <dir>] <image>")
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image validate [--data-dir <dir>] [--runner-injection <strategy>] <image>")
 		return 1
 	}
 
-	if err := validateImage(*dataDir, fs.Arg(0)); err != nil {
+	image, err := linux.ResolveImageRef(*dataDir, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := validateImage(*dataDir, image, *runnerInjection); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
@@ -806,7 +991,102 @@ func runImageDelete(args []string) int {
 	return 0
 }
 
-func pullImage(dataDir, nameValue, ref string) (err error) {
+func runImageTag(args []string) int {
+	fs := flag.NewFlagSet("image tag", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image tag [--data-dir <dir>] <image> <name:tag>")
+		return 1
+	}
+
+	previous, err := tagImage(*dataDir, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if previous != "" {
+		fmt.Printf("Re-tagged %s (was %s)\n", fs.Arg(1), previous)
+	} else {
+		fmt.Printf("Tagged %s\n", fs.Arg(1))
+	}
+	return 0
+}
+
+func runImageUntag(args []string) int {
+	fs := flag.NewFlagSet("image untag", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image untag [--data-dir <dir>] <name:tag>")
+		return 1
+	}
+
+	tags, err := linux.ReadImageTags(*dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if _, ok := tags[fs.Arg(0)]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: tag %s not found\n", fs.Arg(0))
+		return 1
+	}
+	delete(tags, fs.Arg(0))
+	if err := linux.WriteImageTags(*dataDir, tags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Untagged %s\n", fs.Arg(0))
+	return 0
+}
+
+// tagImage points ref ("name:tag") at source, which may itself be a tag. It
+// returns the image the tag pointed to before, if any.
+func tagImage(dataDir, source, ref string) (string, error) {
+	name, tag, ok := strings.Cut(ref, ":")
+	if !ok || !imageNamePattern.MatchString(name) || !imageTagPattern.MatchString(tag) {
+		return "", fmt.Errorf("invalid tag %q (want name:tag)", ref)
+	}
+	target, err := linux.ResolveImageRef(dataDir, source)
+	if err != nil {
+		return "", err
+	}
+	if !imageExists(dataDir, target) {
+		return "", fmt.Errorf("image %s not found", source)
+	}
+	if imageExists(dataDir, ref) {
+		return "", fmt.Errorf("%s is an image name", ref)
+	}
+
+	tags, err := linux.ReadImageTags(dataDir)
+	if err != nil {
+		return "", err
+	}
+	previous := tags[ref]
+	tags[ref] = target
+	if err := linux.WriteImageTags(dataDir, tags); err != nil {
+		return "", err
+	}
+	if previous == target {
+		previous = ""
+	}
+	return previous, nil
+}
+
+// pullImage pulls ref from a registry into data_dir as image nameValue. With
+// runner injection "layer" the runner is copied into the shared runner layer;
+// other strategies leave the image store untouched. With a non-nil logger
+// each layer is logged as it is extracted.
+func pullImage(ctx context.Context, dataDir, nameValue, ref, runnerInjection string, logger *slog.Logger) (err error) {
 	if !imageNamePattern.MatchString(nameValue) {
 		return fmt.Errorf("invalid image name %q", nameValue)
 	}
@@ -832,21 +1112,83 @@ func pullImage(dataDir, nameValue, ref string) (err error) {
 		return fmt.Errorf("parse reference: %w", err)
 	}
 
-	img, err := remote.Image(parsedRef, remote.WithContext(context.Background()))
+	desc, img, arch, err := fetchImage(ctx, parsedRef)
+	if err != nil {
+		return err
+	}
+
+	layerIDs, err := pullLayers(dataDir, nameValue, img, logger)
+	if err != nil {
+		return err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("compute digest: %w", err)
+	}
+
+	meta := ImageMeta{
+		Name:         nameValue,
+		Hash:         digest.String(),
+		CreatedAt:    time.Now().UTC(),
+		Layers:       layerIDs,
+		Source:       ref,
+		SourceDigest: desc.Digest.String(),
+		Arch:         arch,
+	}
+	if err := writeMeta(filepath.Join(imageDir, "meta.json"), meta); err != nil {
+		return err
+	}
+
+	if runnerInjection == config.RunnerInjectionLayer {
+		if err := injectRunner(dataDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchImage resolves ref to the image for the host: a multi-arch index
+// resolves to its linux/<GOARCH> manifest (the registry client would pick
+// linux/amd64 otherwise) and a single-arch image must be runnable on the
+// host, natively or through a binfmt_misc handler. It returns the
+// descriptor ref resolved to, the image and its architecture.
+func fetchImage(ctx context.Context, ref name.Reference) (*remote.Descriptor, v1.Image, string, error) {
+	desc, err := remote.Get(ref, remote.WithContext(ctx), remote.WithPlatform(v1.Platform{OS: "linux", Architecture: runtime.GOARCH}))
 	if err != nil {
-		return fmt.Errorf("pull image: %w", err)
+		return nil, nil, "", fmt.Errorf("pull image: %w", err)
 	}
+	img, err := desc.Image()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("pull image: %w", err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("read image config: %w", err)
+	}
+	if cfg.OS != "" && cfg.OS != "linux" {
+		return nil, nil, "", fmt.Errorf("image %s is built for %s, not linux", ref, cfg.OS)
+	}
+	if cfg.Architecture != "" && !elfcheck.HostCanRun(cfg.Architecture) {
+		return nil, nil, "", fmt.Errorf("image %s is built for %s, host is %s and has no binfmt_misc handler for it", ref, cfg.Architecture, runtime.GOARCH)
+	}
+	return desc, img, cfg.Architecture, nil
+}
 
+// pullLayers extracts the layers of img that are not in the layer store yet and
+// returns all layer IDs, bottom first.
+func pullLayers(dataDir, nameValue string, img v1.Image, logger *slog.Logger) ([]string, error) {
 	layers, err := img.Layers()
 	if err != nil {
-		return fmt.Errorf("resolve layers: %w", err)
+		return nil, fmt.Errorf("resolve layers: %w", err)
 	}
 
 	var layerIDs []string
-	for _, layer := range layers {
+	for i, layer := range layers {
 		digest, err := layer.Digest()
 		if err != nil {
-			return fmt.Errorf("layer digest: %w", err)
+			return nil, fmt.Errorf("layer digest: %w", err)
 		}
 		layerID := digest.Hex
 		layerIDs = append(layerIDs, layerID)
@@ -855,43 +1197,49 @@ func pullImage(dataDir, nameValue, ref string) (err error) {
 		if _, err := os.Stat(layerRootfs); err == nil {
 			continue // Already extracted
 		}
+		if logger != nil {
+			size, _ := layer.Size()
+			logger.Info("pulling image layer", "image", nameValue, "layer", fmt.Sprintf("%d/%d", i+1, len(layers)), "digest", layerID[:12], "size_bytes", size)
+		}
 		if err := os.MkdirAll(layerRootfs, 0755); err != nil {
-			return fmt.Errorf("create layer rootfs: %w", err)
+			return nil, fmt.Errorf("create layer rootfs: %w", err)
 		}
 
 		reader, err := layer.Uncompressed()
 		if err != nil {
-			return fmt.Errorf("open layer: %w", err)
+			return nil, fmt.Errorf("open layer: %w", err)
 		}
 
 		if err := extractLayer(layerRootfs, reader); err != nil {
 			reader.Close()
-			return fmt.Errorf("extract layer %s: %w", layerID, err)
+			// Do not leave a partial layer behind; it would count as extracted.
+			_ = os.RemoveAll(filepath.Dir(layerRootfs))
+			return nil, fmt.Errorf("extract layer %s: %w", layerID, err)
 		}
 		if err := reader.Close(); err != nil {
-			return fmt.Errorf("close layer: %w", err)
+			return nil, fmt.Errorf("close layer: %w", err)
 		}
 	}
+	return layerIDs, nil
+}
 
-	digest, err := img.Digest()
-	if err != nil {
-		return fmt.Errorf("compute digest: %w", err)
-	}
-
-	meta := ImageMeta{
-		Name:      nameValue,
-		Hash:      digest.String(),
-		CreatedAt: time.Now().UTC(),
-		Layers:    layerIDs,
+// provisionDefaultImage pulls bootstrap_image as the default image when the
+// default image is missing, e.g. on a host set up with `init --skip-pull`.
+func provisionDefaultImage(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	if cfg.BootstrapImage == "" || imageExists(cfg.DataDir, cfg.DefaultImage) {
+		return nil
 	}
-	if err := writeMeta(filepath.Join(imageDir, "meta.json"), meta); err != nil {
-		return err
+	if len(cfg.AllowedImages) > 0 && !slices.Contains(cfg.AllowedImages, cfg.DefaultImage) {
+		return fmt.Errorf("default image %q is not in allowed_images", cfg.DefaultImage)
 	}
 
-	if err := injectRunner(dataDir); err != nil {
-		return err
+	logger.Info("default image missing, pulling bootstrap image", "image", cfg.DefaultImage, "ref", cfg.BootstrapImage)
+	start := time.Now()
+	if err := pullImage(ctx, cfg.DataDir, cfg.DefaultImage, cfg.BootstrapImage, cfg.Runner.Injection, logger); err != nil {
+		return fmt.Errorf("pull %s: %w", cfg.BootstrapImage, err)
 	}
-
+	logger.Info("default image provisioned", "image", cfg.DefaultImage, "duration", time.Since(start).Round(time.Millisecond))
+	scanPulledImage(ctx, cfg, cfg.DefaultImage, logger)
 	return nil
 }
 
@@ -906,6 +1254,17 @@ func listImages(dataDir string) error {
 		return fmt.Errorf("read images dir: %w", err)
 	}
 
+	tags, err := linux.ReadImageTags(dataDir)
+	if err != nil {
+		return err
+	}
+	tagsByImage := make(map[string][]string)
+	for ref, image := range tags {
+		tagsByImage[image] = append(tagsByImage[image], ref)
+	}
+
+	var metas []ImageMeta
+	layerUsers := make(map[string]int)
 	fmt.Println("Images:")
 	for _, entry := range entries {
 		if !entry.IsDir() {
@@ -922,13 +1281,46 @@ func listImages(dataDir string) error {
 			fmt.Printf("  - %s (invalid metadata)\n", entry.Name())
 			continue
 		}
-		fmt.Printf("  - %s (created: %s)\n", meta.Name, meta.CreatedAt.Format(time.RFC3339))
+		metas = append(metas, meta)
+		for _, layer := range meta.Layers {
+			layerUsers[layer]++
+		}
+	}
+
+	for _, meta := range metas {
+		shared := 0
+		for _, layer := range meta.Layers {
+			if layerUsers[layer] > 1 {
+				shared++
+			}
+		}
+		line := fmt.Sprintf("  - %s (created: %s, layers: %d, shared: %d)", meta.Name, meta.CreatedAt.Format(time.RFC3339), len(meta.Layers), shared)
+		if meta.Arch != "" && meta.Arch != runtime.GOARCH {
+			line = fmt.Sprintf("  - %s (created: %s, layers: %d, shared: %d, arch: %s)", meta.Name, meta.CreatedAt.Format(time.RFC3339), len(meta.Layers), shared, meta.Arch)
+		}
+		if meta.Type != "" {
+			line = fmt.Sprintf("  - %s (created: %s, type: %s)", meta.Name, meta.CreatedAt.Format(time.RFC3339), meta.Type)
+		}
+		if refs := tagsByImage[meta.Name]; len(refs) > 0 {
+			sort.Strings(refs)
+			line += " tags: " + strings.Join(refs, ", ")
+		}
+		if report, err := imagescan.Read(filepath.Join(imageDir, meta.Name)); err == nil && report != nil {
+			if report.ImageDigest == meta.Hash {
+				line += " vulnerabilities: " + report.Summary()
+			} else {
+				line += " vulnerabilities: not scanned since refresh"
+			}
+		}
+		fmt.Println(line)
 	}
 
 	return nil
 }
 
-func validateImage(dataDir, nameValue string) error {
+// validateImage checks that image nameValue is complete. The runner is only
+// required in the image store for runner injection "layer".
+func validateImage(dataDir, nameValue, runnerInjection string) error {
 	imageDir := filepath.Join(dataDir, "images", nameValue)
 	metaPath := filepath.Join(imageDir, "meta.json")
 
@@ -944,16 +1336,30 @@ func validateImage(dataDir, nameValue string) error {
 		return fmt.Errorf("parse meta: %w", err)
 	}
 
+	if meta.Type == wasm.ImageType {
+		return validateWasmImage(imageDir)
+	}
+
 	if len(meta.Layers) > 0 {
 		for _, layer := range meta.Layers {
 			if _, err := os.Stat(filepath.Join(dataDir, "layers", layer, "rootfs")); err != nil {
 				return fmt.Errorf("missing layer: %s", layer)
 			}
 		}
-		if _, err := os.Stat(filepath.Join(dataDir, "layers", "runner", "rootfs", "usr", "local", "bin", "runner")); err != nil {
-			return fmt.Errorf("missing runner layer")
+		var lowerDirs []string
+		if runnerInjection == config.RunnerInjectionLayer {
+			runner := filepath.Join(dataDir, "layers", "runner", "rootfs", "usr", "local", "bin", "runner")
+			if _, err := os.Stat(runner); err != nil {
+				return fmt.Errorf("missing runner layer")
+			}
+			if err := elfcheck.CheckRunner(runner); err != nil {
+				return err
+			}
 		}
-		return nil
+		for i := len(meta.Layers) - 1; i >= 0; i-- {
+			lowerDirs = append(lowerDirs, filepath.Join(dataDir, "layers", meta.Layers[i], "rootfs"))
+		}
+		return elfcheck.CheckExecutable(lowerDirs, "/bin/sh")
 	}
 
 	rootfsDir := filepath.Join(imageDir, "rootfs")
@@ -963,9 +1369,9 @@ func validateImage(dataDir, nameValue string) error {
 		return fmt.Errorf("image rootfs not found")
 	}
 
-	required := []string{
-		"bin/sh",
-		"usr/local/bin/runner",
+	required := []string{"bin/sh"}
+	if runnerInjection == config.RunnerInjectionLayer {
+		required = append(required, "usr/local/bin/runner")
 	}
 
 	for _, rel := range required {
@@ -974,6 +1380,12 @@ func validateImage(dataDir, nameValue string) error {
 			return fmt.Errorf("required file missing: /%s", rel)
 		}
 	}
+	if err := elfcheck.CheckExecutable([]string{rootfsDir}, "/bin/sh"); err != nil {
+		return err
+	}
+	if runnerInjection != config.RunnerInjectionLayer {
+		return nil
+	}
 
 	runnerPath := filepath.Join(rootfsDir, "usr", "local", "bin", "runner")
 	info, err := os.Stat(runnerPath)
@@ -984,10 +1396,25 @@ func validateImage(dataDir, nameValue string) error {
 		return fmt.Errorf("runner is not executable")
 	}
 
-	return nil
+	return elfcheck.CheckRunner(runnerPath)
 }
 
 func deleteImage(dataDir, nameValue string) error {
+	tags, err := linux.ReadImageTags(dataDir)
+	if err != nil {
+		return err
+	}
+	var refs []string
+	for ref, image := range tags {
+		if image == nameValue {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) > 0 {
+		sort.Strings(refs)
+		return fmt.Errorf("image %s is tagged as %s; re-tag or untag first", nameValue, strings.Join(refs, ", "))
+	}
+
 	imageDir := filepath.Join(dataDir, "images", nameValue)
 	if err := os.RemoveAll(imageDir); err != nil {
 		return fmt.Errorf("remove image: %w", err)
@@ -1083,23 +1510,30 @@ func extractLayer(rootfsDir string, layerReader io.Reader) error {
 	}
 }
 
+// writeMeta replaces metaPath atomically; the daemon reads meta.json on every
+// create, so a refresh repoints an image in a single rename.
 func writeMeta(metaPath string, meta ImageMeta) error {
-	metaFile, err := os.Create(metaPath)
+	data, err := json.Marshal(meta)
 	if err != nil {
-		return fmt.Errorf("create meta file: %w", err)
+		return fmt.Errorf("encode meta: %w", err)
 	}
-	defer metaFile.Close()
-
-	if err := json.NewEncoder(metaFile).Encode(meta); err != nil {
+	tmp := metaPath + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+	if err := os.Rename(tmp, metaPath); err != nil {
+		os.Remove(tmp)
 		return fmt.Errorf("write meta: %w", err)
 	}
-
 	return nil
 }
 
+// injectRunner copies the host-architecture runner next to the daemon into
+// the shared runner layer. A runner that is there but cannot run on this host
+// (wrong architecture, dynamically linked) is replaced.
 func injectRunner(dataDir string) error {
 	runnerDst := filepath.Join(dataDir, "layers", "runner", "rootfs", "usr", "local", "bin", "runner")
-	if _, err := os.Stat(runnerDst); err == nil {
+	if _, err := os.Stat(runnerDst); err == nil && elfcheck.CheckRunner(runnerDst) == nil {
 		return nil // already injected
 	}
 
@@ -1111,19 +1545,26 @@ func injectRunner(dataDir string) error {
 	if err != nil {
 		return fmt.Errorf("get executable path: %w", err)
 	}
-	binDir := filepath.Dir(exePath)
-	runnerSrc := filepath.Join(binDir, "runner")
-
-	if _, err := os.Stat(runnerSrc); errors.Is(err, fs.ErrNotExist) {
-		return fmt.Errorf("runner binary not found at %s - run 'task build' first", runnerSrc)
+	runnerSrc, err := runnerbin.Find(filepath.Dir(exePath))
+	if err != nil {
+		return err
+	}
+	if err := elfcheck.CheckRunner(runnerSrc); err != nil {
+		return err
 	}
 
-	if err := copyFile(runnerSrc, runnerDst); err != nil {
+	tmp := runnerDst + ".tmp"
+	if err := copyFile(runnerSrc, tmp); err != nil {
 		return fmt.Errorf("copy runner: %w", err)
 	}
-	if err := os.Chmod(runnerDst, 0755); err != nil {
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.Remove(tmp)
 		return fmt.Errorf("chmod runner: %w", err)
 	}
+	if err := os.Rename(tmp, runnerDst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("install runner: %w", err)
+	}
 
 	return nil
 }
@@ -1223,12 +1664,97 @@ Commands:
   list [--data-dir <dir>]                           List available images
   validate <image> [--data-dir <dir>]               Validate an image
   delete <image> [--data-dir <dir>]                 Delete an image
+  tag <image> <name:tag> [--data-dir <dir>]         Point a tag at an image (re-tags if it exists)
+  untag <name:tag> [--data-dir <dir>]               Remove a tag
+  refresh <image> [--data-dir <dir>]                Re-pull if the source reference moved
+  scan <image> [--scanner trivy|grype] [--json]     Scan for known vulnerabilities and keep the report
+  import-wasm <file> --name <image> [--data-dir <dir>]  Import a WASI module as a wasm image
 
 Environment:
-  SANDKASTEN_DATA_DIR   Data directory (default: /var/lib/sandkasten)
+  SANDKASTEN_DATA_DIR       Data directory (default: /var/lib/sandkasten)
+  SANDKASTEN_IMAGE_SCANNER  Scanner for scan, and for pull when set (trivy or grype)
 `)
 }
 
+// checkOrphans looks for cgroups, veth interfaces and mounts whose session is
+// not running or pooled according to the store. With fix it removes them; that
+// is refused while a detached daemon is running, because a session it is still
+// creating is not in the store yet.
+func checkOrphans(dataDir, dbPath string, fix bool) (string, string) {
+	resources, err := linux.ScanHostResources(dataDir)
+	if err != nil {
+		return "WARN", "scan failed: " + err.Error()
+	}
+	if len(resources) == 0 {
+		return "OK", "none found"
+	}
+	if dbPath == "" {
+		return "WARN", "no database found; pass --config to check for orphans"
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return "WARN", fmt.Sprintf("database %s not found; pass --config to check for orphans", dbPath)
+	}
+
+	st, err := store.Open(dbPath, 1)
+	if err != nil {
+		return "WARN", "open store: " + err.Error()
+	}
+	if err := st.CheckSchema(context.Background()); err != nil {
+		st.Close()
+		return "WARN", err.Error()
+	}
+	running, errRunning := st.ListRunningSessions()
+	pooled, errPooled := st.ListPoolIdleSessions()
+	st.Close()
+	if err := errors.Join(errRunning, errPooled); err != nil {
+		return "WARN", "list sessions: " + err.Error()
+	}
+	var live []string
+	for _, sess := range append(running, pooled...) {
+		live = append(live, sess.ID)
+	}
+
+	orphans := runtimepkg.Orphaned(resources, live)
+	if len(orphans) == 0 {
+		return "OK", "none found"
+	}
+	names := make([]string, 0, len(orphans))
+	for _, o := range orphans {
+		names = append(names, o.Kind+" "+o.Name)
+	}
+	summary := fmt.Sprintf("%d orphaned: %s", len(orphans), strings.Join(names, ", "))
+	if !fix {
+		return "WARN", summary + " (run with --fix to remove)"
+	}
+	if daemonRunning(dataDir) {
+		return "FAIL", summary + " (stop the daemon before --fix)"
+	}
+
+	var failed []string
+	for _, o := range orphans {
+		if err := linux.CleanupHostResource(o); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return "FAIL", fmt.Sprintf("removed %d of %d: %s", len(orphans)-len(failed), len(orphans), strings.Join(failed, "; "))
+	}
+	return "OK", fmt.Sprintf("removed %d orphaned resource(s)", len(orphans))
+}
+
+// daemonRunning reports whether the PID file of a detached daemon points at a live process.
+func daemonRunning(dataDir string) bool {
+	data, err := os.ReadFile(filepath.Join(dataDir, "run", "sandkasten.pid"))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return unix.Kill(pid, 0) == nil
+}
+
 func checkKernelVersion() (bool, string) {
 	var uts unix.Utsname
 	if err := unix.Uname(&uts); err != nil {
@@ -1292,11 +1818,14 @@ func checkRunnerBinary() (bool, string) {
 	if err != nil {
 		return false, fmt.Sprintf("cannot determine executable path: %v", err)
 	}
-	runnerPath := filepath.Join(filepath.Dir(exePath), "runner")
-	if _, err := os.Stat(runnerPath); err != nil {
-		return false, fmt.Sprintf("runner missing at %s", runnerPath)
+	runnerPath, err := runnerbin.Find(filepath.Dir(exePath))
+	if err != nil {
+		return false, err.Error()
+	}
+	if err := elfcheck.CheckRunner(runnerPath); err != nil {
+		return false, err.Error()
 	}
-	return true, runnerPath
+	return true, runnerPath + " (static, " + runtime.GOARCH + ")"
 }
 
 func charsToString(chars []byte) string {
@@ -1345,7 +1874,7 @@ func nearestExistingDir(pathValue string) string {
 	}
 }
 
-func writeInitialConfig(configPath, listen, apiKey, dataDir, defaultImage string, force bool) error {
+func writeInitialConfig(configPath, listen, apiKey, dataDir, defaultImage, bootstrap string, force bool) error {
 	if !force {
 		if _, err := os.Stat(configPath); err == nil {
 			return fmt.Errorf("config %s already exists (use --force to overwrite)", configPath)
@@ -1363,6 +1892,7 @@ func writeInitialConfig(configPath, listen, apiKey, dataDir, defaultImage string
 		DefaultImage: defaultImage,
 		AllowedImage: []string{defaultImage},
 		DBPath:       filepath.Join(dataDir, "sandkasten.db"),
+		Bootstrap:    bootstrap,
 		Defaults: initConfigDefaults{
 			CPULimit:         1.0,
 			MemLimitMB:       512,
@@ -0,0 +1,15 @@
+//go:build linux && containerd
+
+package main
+
+import (
+	"log/slog"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime/containerd"
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
+)
+
+func newContainerdRuntime(cfg *config.Config, logger *slog.Logger) (wasm.Runtime, error) {
+	return containerd.NewDriver(cfg, logger)
+}
@@ -0,0 +1,189 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+func runDB(args []string) int {
+	if len(args) == 0 {
+		printDBUsage()
+		return 1
+	}
+
+	switch args[0] {
+	case "maintenance":
+		return runDBMaintenance(args[1:])
+	case "migrate":
+		return runDBMigrate(args[1:])
+	default:
+		printDBUsage()
+		return 1
+	}
+}
+
+func printDBUsage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  sandkasten db maintenance [--config <path>] [--vacuum] [--full-check] [--json]
+  sandkasten db migrate [--config <path>] [--status] [--to <version>] [--json]
+`)
+}
+
+// runDBMaintenance runs one WAL checkpoint / vacuum / integrity check pass.
+// It is safe to run while the daemon is up; --vacuum briefly blocks writers.
+func runDBMaintenance(args []string) int {
+	fs := flag.NewFlagSet("db maintenance", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	cfgPath := fs.String("config", "", "path to sandkasten.yaml (used to get db_path)")
+	vacuum := fs.Bool("vacuum", false, "run a full VACUUM instead of an incremental one")
+	fullCheck := fs.Bool("full-check", false, "run integrity_check instead of quick_check")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	cfg, err := loadDBConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: load config: %v\n", err)
+		return 1
+	}
+
+	st, err := store.Open(cfg.DBPath, 1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: open %s: %v\n", cfg.DBPath, err)
+		return 1
+	}
+	defer st.Close()
+
+	rep, err := st.Maintenance(context.Background(), store.MaintenanceOptions{
+		Vacuum:             *vacuum,
+		FullIntegrityCheck: *fullCheck,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: %v\n", err)
+		return 1
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	} else {
+		fmt.Printf("database:        %s\n", cfg.DBPath)
+		fmt.Printf("wal checkpoint:  %d/%d frames (busy=%v)\n", rep.CheckpointedFrames, rep.WALFrames, rep.CheckpointBusy)
+		fmt.Printf("free pages:      %d -> %d (vacuumed=%v)\n", rep.FreelistPagesBefore, rep.FreelistPagesAfter, rep.Vacuumed)
+		fmt.Printf("integrity:       %s\n", integrityStatus(rep))
+		for _, e := range rep.IntegrityErrors {
+			fmt.Printf("  %s\n", e)
+		}
+		fmt.Printf("duration:        %s\n", rep.Duration)
+	}
+
+	if !rep.IntegrityOK {
+		return 1
+	}
+	return 0
+}
+
+func integrityStatus(rep *store.MaintenanceReport) string {
+	if rep.IntegrityOK {
+		return "ok"
+	}
+	return fmt.Sprintf("FAIL (%d problems)", len(rep.IntegrityErrors))
+}
+
+// loadDBConfig loads the config at path, or at the first default location
+// that exists.
+func loadDBConfig(path string) (*config.Config, error) {
+	if path == "" {
+		for _, p := range []string{"sandkasten.yaml", "/etc/sandkasten/sandkasten.yaml"} {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+	return config.Load(path)
+}
+
+// runDBMigrate shows or changes the schema version of the database. Stop the
+// daemon first: it does not expect the schema to change under it.
+func runDBMigrate(args []string) int {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	cfgPath := fs.String("config", "", "path to sandkasten.yaml (used to get db_path)")
+	statusOnly := fs.Bool("status", false, "only show applied and pending migrations")
+	to := fs.Int("to", -1, "migrate up or down to this version (default: latest)")
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	cfg, err := loadDBConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: load config: %v\n", err)
+		return 1
+	}
+	st, err := store.Open(cfg.DBPath, 1)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: open %s: %v\n", cfg.DBPath, err)
+		return 1
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+	var ran []store.Migration
+	if !*statusOnly {
+		ran, err = st.Migrate(ctx, *to)
+		for _, m := range ran {
+			if !*jsonOut {
+				fmt.Printf("migrated:        %04d_%s\n", m.Version, m.Name)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "db: %v\n", err)
+			return 1
+		}
+	}
+	status, err := st.MigrationStatus(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "db: %v\n", err)
+		return 1
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]any{"ran": ran, "status": status})
+		return 0
+	}
+	fmt.Printf("database:        %s\n", cfg.DBPath)
+	fmt.Printf("schema version:  %d (latest %d)\n", status.Current, status.Latest)
+	for _, m := range status.Pending {
+		fmt.Printf("pending:         %04d_%s\n", m.Version, m.Name)
+	}
+	return 0
+}
+
+// prepareSchema brings the schema of st to the latest version at daemon
+// start, or with autoMigrate off only checks that it is there.
+func prepareSchema(st *store.Store, autoMigrate bool, logger *slog.Logger) error {
+	ctx := context.Background()
+	if !autoMigrate {
+		return st.CheckSchema(ctx)
+	}
+	ran, err := st.Migrate(ctx, -1)
+	for _, m := range ran {
+		logger.Info("applied schema migration", "version", m.Version, "name", m.Name)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+// leaseHolderID names this daemon in the lease so operators can tell which
+// host and process is primary.
+func leaseHolderID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// waitForLease blocks as a warm standby until this daemon holds the lease.
+// It runs before the runtime driver and reaper start, so a standby never
+// touches the primary's sessions.
+func waitForLease(st *store.Store, holder string, ttl time.Duration, logger *slog.Logger) error {
+	standby := false
+	for {
+		ok, err := st.AcquireLease(holder, ttl)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if standby {
+				logger.Info("primary lease expired, taking over", "holder", holder)
+			}
+			return nil
+		}
+		if !standby {
+			standby = true
+			l, _ := st.GetLease()
+			if l != nil {
+				logger.Info("standby: another daemon holds the lease", "primary", l.Holder, "expires_at", l.ExpiresAt)
+			}
+		}
+		time.Sleep(ttl / 3)
+	}
+}
+
+// keepLease renews the lease until ctx is done. If the lease is lost, or
+// can't be renewed before it would expire, the daemon exits: a standby may
+// already have taken over, and two daemons must never run the same sessions.
+func keepLease(ctx context.Context, st *store.Store, holder string, ttl time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := st.AcquireLease(holder, ttl)
+		switch {
+		case err != nil && time.Since(renewed) < ttl:
+			logger.Warn("renew daemon lease", "error", err)
+		case err != nil:
+			logger.Error("daemon lease expired, exiting", "error", err)
+			os.Exit(1)
+		case !ok:
+			logger.Error("daemon lease taken over by another daemon, exiting")
+			os.Exit(1)
+		default:
+			renewed = time.Now()
+		}
+	}
+}
@@ -0,0 +1,153 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+	"github.com/p-arndt/sandkasten/internal/runtime/linux"
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
+)
+
+// defaultScanTimeout bounds a scan started from the command line.
+const defaultScanTimeout = 10 * time.Minute
+
+func runImageScan(args []string) int {
+	fs := flag.NewFlagSet("image scan", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	scanner := fs.String("scanner", envOrDefault("SANDKASTEN_IMAGE_SCANNER", imagescan.ScannerTrivy), "vulnerability scanner: trivy or grype")
+	timeout := fs.Duration("timeout", defaultScanTimeout, "time limit for the scan")
+	jsonOut := fs.Bool("json", false, "print the full report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image scan [--scanner trivy|grype] [--timeout <duration>] [--json] [--data-dir <dir>] <image>")
+		return 1
+	}
+
+	image, err := linux.ResolveImageRef(*dataDir, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	report, err := scanImage(context.Background(), *dataDir, image, *scanner, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("Scanned %s with %s: %s\n", fs.Arg(0), report.Scanner, report.Summary())
+	for _, f := range report.Findings {
+		if imagescan.SeverityRank(f.Severity) < imagescan.SeverityRank("high") {
+			continue
+		}
+		fixed := "no fix"
+		if f.FixedVersion != "" {
+			fixed = "fixed in " + f.FixedVersion
+		}
+		fmt.Printf("  %-8s %-20s %s %s (%s)\n", strings.ToUpper(f.Severity), f.ID, f.Package, f.Version, fixed)
+	}
+	return 0
+}
+
+// scanImage scans the current version of image with scanner and stores the
+// report next to its meta.json, replacing any earlier one.
+func scanImage(ctx context.Context, dataDir, image, scanner string, timeout time.Duration) (*imagescan.Report, error) {
+	imageDir := filepath.Join(dataDir, "images", image)
+	data, err := os.ReadFile(filepath.Join(imageDir, "meta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read image metadata: %w", err)
+	}
+	var meta ImageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parse image metadata: %w", err)
+	}
+	if meta.Type == wasm.ImageType {
+		return nil, fmt.Errorf("image %s is a wasm module; only rootfs images can be scanned", image)
+	}
+
+	rootfs, cleanup, err := imageRootfs(dataDir, image, meta.Layers)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	report, err := imagescan.Scan(ctx, scanner, rootfs, timeout)
+	if err != nil {
+		return nil, err
+	}
+	report.ImageDigest = meta.Hash
+	if err := imagescan.Write(imageDir, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// imageRootfs returns the root filesystem of an image as sessions see it,
+// without the runner layer. Images of several layers are merged in a
+// read-only overlay that cleanup unmounts.
+func imageRootfs(dataDir, image string, layers []string) (string, func(), error) {
+	switch len(layers) {
+	case 0:
+		return filepath.Join(dataDir, "images", image, "rootfs"), func() {}, nil
+	case 1:
+		return filepath.Join(dataDir, "layers", layers[0], "rootfs"), func() {}, nil
+	}
+
+	lower := make([]string, 0, len(layers))
+	for i := len(layers) - 1; i >= 0; i-- {
+		lower = append(lower, filepath.Join(dataDir, "layers", layers[i], "rootfs"))
+	}
+	mnt, err := os.MkdirTemp(dataDir, "scan-")
+	if err != nil {
+		return "", nil, fmt.Errorf("create scan mount: %w", err)
+	}
+	if err := linux.MountOverlayReadOnly(strings.Join(lower, ":"), mnt); err != nil {
+		os.Remove(mnt)
+		return "", nil, err
+	}
+	return mnt, func() {
+		_ = linux.UmountDetach(mnt)
+		os.Remove(mnt)
+	}, nil
+}
+
+// scanPulledImage scans an image the daemon just pulled or refreshed when
+// image_scan.on_pull is set. A failed scan leaves the image unscanned; it
+// does not undo the pull.
+func scanPulledImage(ctx context.Context, cfg *config.Config, image string, logger *slog.Logger) {
+	if !cfg.ImageScan.OnPull {
+		return
+	}
+	report, err := scanImage(ctx, cfg.DataDir, image, cfg.ImageScan.Scanner, time.Duration(cfg.ImageScan.TimeoutSeconds)*time.Second)
+	if err != nil {
+		logger.Warn("image scan failed", "image", image, "scanner", cfg.ImageScan.Scanner, "error", err)
+		return
+	}
+	logger.Info("image scanned", "image", image, "scanner", report.Scanner, "findings", report.Summary())
+	if s := cfg.ImageScan.BlockSeverity; s != "" && report.AtLeast(s) > 0 {
+		logger.Warn("image blocked by vulnerability scan", "image", image, "block_severity", s)
+	}
+}
@@ -11,22 +11,37 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"time"
 
 	"github.com/p-arndt/sandkasten/internal/api"
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/fscrypt"
+	"github.com/p-arndt/sandkasten/internal/health"
+	"github.com/p-arndt/sandkasten/internal/hooks"
+	"github.com/p-arndt/sandkasten/internal/jobs"
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/oidc"
+	"github.com/p-arndt/sandkasten/internal/policy"
 	"github.com/p-arndt/sandkasten/internal/pool"
 	"github.com/p-arndt/sandkasten/internal/reaper"
 	runtimepkg "github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/runtime/kube"
 	"github.com/p-arndt/sandkasten/internal/runtime/linux"
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
+	"github.com/p-arndt/sandkasten/internal/runtime/wsl"
+	"github.com/p-arndt/sandkasten/internal/scan"
 	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/p-arndt/sandkasten/internal/store"
 )
 
 var Version = "dev"
 
+// reaperInterval is how often expired sessions are reaped.
+const reaperInterval = 30 * time.Second
+
 func main() {
 	if isNsinit() {
 		if err := runNsinit(); err != nil {
@@ -57,10 +72,16 @@ func main() {
 			os.Exit(runPs(os.Args[2:]))
 		case "rm":
 			os.Exit(runRm(os.Args[2:]))
+		case "pool":
+			os.Exit(runPool(os.Args[2:]))
+		case "shell":
+			os.Exit(runShell(os.Args[2:]))
 		case "stop":
 			os.Exit(runStop(os.Args[2:]))
 		case "logs":
 			os.Exit(runLogs(os.Args[2:]))
+		case "db":
+			os.Exit(runDB(os.Args[2:]))
 		case "daemon":
 			os.Exit(runDaemon(os.Args[2:]))
 		case "version":
@@ -76,9 +97,45 @@ func main() {
 	os.Exit(runDaemon(os.Args[1:]))
 }
 
+// daemonRuntime is what the daemon needs from a runtime driver.
+type daemonRuntime interface {
+	runtimepkg.Driver
+	reaper.ReaperRuntime
+	session.ImageResolver
+}
+
+// newRuntime returns the driver selected by cfg.Runtime, with wasm images
+// served in-process on top of it.
+func newRuntime(cfg *config.Config, logger *slog.Logger) (daemonRuntime, error) {
+	var (
+		rt  wasm.Runtime
+		err error
+	)
+	switch cfg.Runtime {
+	case "linux":
+		rt, err = linux.NewDriver(cfg, logger)
+	case "containerd":
+		rt, err = newContainerdRuntime(cfg, logger)
+	case "kubernetes":
+		rt, err = kube.NewDriver(cfg, logger)
+	default:
+		return nil, fmt.Errorf("unknown runtime %q (want linux, containerd or kubernetes)", cfg.Runtime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.WSL.Targets) > 0 {
+		rt = wsl.NewDriver(cfg, rt, logger)
+	}
+	return wasm.NewDriver(cfg, rt, logger), nil
+}
+
 func runDaemon(args []string) int {
 	if runtime.GOOS != "linux" {
 		fmt.Fprintf(os.Stderr, "Error: sandkasten daemon requires Linux (or WSL2)\n")
+		if runtime.GOOS == "darwin" {
+			fmt.Fprintf(os.Stderr, "For development on macOS, run it in a Lima VM: go run ./cmd/sandkasten-lima help\n")
+		}
 		return 1
 	}
 
@@ -157,16 +214,113 @@ func runDaemon(args []string) int {
 		}
 		logger.Warn("no API key configured — running in open access mode (dev only; do not use in production)")
 	}
+	if err := cfg.ValidateTenants(); err != nil {
+		logger.Error("invalid tenants config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateCORS(); err != nil {
+		logger.Error("invalid cors config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateRunner(); err != nil {
+		logger.Error("invalid runner config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateExec(); err != nil {
+		logger.Error("invalid config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateCPU(); err != nil {
+		logger.Error("invalid cpu config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateHTTP(); err != nil {
+		logger.Error("invalid http config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateHostProtection(); err != nil {
+		logger.Error("invalid host_protection config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateCleanup(); err != nil {
+		logger.Error("invalid destroy_hooks or workspace retention config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateSharedChannels(); err != nil {
+		logger.Error("invalid shared_channels config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateAdmission(); err != nil {
+		logger.Error("invalid admission config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateWSL(); err != nil {
+		logger.Error("invalid wsl config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateHA(); err != nil {
+		logger.Error("invalid ha config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateHealth(); err != nil {
+		logger.Error("invalid health config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateImageScan(); err != nil {
+		logger.Error("invalid image scan config", "error", err)
+		return 1
+	}
+	if err := cfg.ValidateNotifications(); err != nil {
+		logger.Error("invalid notifications config", "error", err)
+		return 1
+	}
+	notifier, err := notify.New(cfg.Notifications, logger)
+	if err != nil {
+		logger.Error("notifications", "error", err)
+		return 1
+	}
+	if notifier != nil {
+		logger.Info("notifications enabled", "channels", len(cfg.Notifications.Channels), "rules", len(cfg.Notifications.Rules))
+	}
 
-	st, err := store.New(cfg.DBPath, cfg.DBMaxOpenConns)
+	st, err := store.Open(cfg.DBPath, cfg.DBMaxOpenConns)
 	if err != nil {
 		logger.Error("open store", "error", err)
 		return 1
 	}
 	defer st.Close()
+	if err := prepareSchema(st, cfg.DBAutoMigrate, logger); err != nil {
+		logger.Error("store schema", "error", err)
+		return 1
+	}
+	st.SetSlowQueryLog(time.Duration(cfg.DBSlowQueryMs)*time.Millisecond, logger)
+	if cfg.DBActivityFlushMs > 0 {
+		st.EnableSessionCache()
+	}
 	logger.Debug("store opened", "db_path", cfg.DBPath)
+	diag := withFailureSpikes(st, notifier, cfg.Notifications.CreateFailureSpike)
 
-	rt, err := linux.NewDriver(cfg, logger)
+	if cfg.HA.Enabled {
+		holder := leaseHolderID()
+		ttl := time.Duration(cfg.HA.LeaseSeconds) * time.Second
+		if err := waitForLease(st, holder, ttl, logger); err != nil {
+			logger.Error("daemon lease", "error", err)
+			return 1
+		}
+		logger.Info("holding daemon lease", "holder", holder, "lease_s", cfg.HA.LeaseSeconds)
+		leaseCtx, stopLease := context.WithCancel(context.Background())
+		go keepLease(leaseCtx, st, holder, ttl, logger)
+		// Runs after the runtime is closed, so a standby can take over
+		// without waiting for the lease to expire.
+		defer func() {
+			stopLease()
+			if err := st.ReleaseLease(holder); err != nil {
+				logger.Warn("release daemon lease", "error", err)
+			}
+		}()
+	}
+
+	rt, err := newRuntime(cfg, logger)
 	if err != nil {
 		logger.Error("runtime driver", "error", err)
 		return 1
@@ -181,9 +335,83 @@ func runDaemon(args []string) int {
 		return 1
 	}
 	logger.Info("runtime driver OK")
+
+	// Pulling and refreshing images only applies to the local image store.
+	localImages := cfg.Runtime == "linux"
+	var refreshed []string
+	if localImages {
+		if err := provisionDefaultImage(ctx, cfg, logger); err != nil {
+			logger.Warn("auto-provision default image", "error", err)
+		}
+
+		if err := validateImageRefresh(cfg.ImageRefresh); err != nil {
+			logger.Error("image refresh policy", "error", err)
+			return 1
+		}
+		refreshed, err = refreshImages(ctx, cfg, refreshOnStart, logger)
+		if err != nil {
+			logger.Warn("image refresh failed", "error", err)
+		}
+	}
+
+	// Validate images before the pool starts refilling so a broken image is
+	// reported once here instead of on every create.
+	var imageStatus []session.ImageStatus
+	if cfg.ImageValidation != "off" {
+		imageStatus = session.CheckImages(ctx, rt, session.ConfiguredImages(cfg))
+		broken := 0
+		for _, st := range imageStatus {
+			if st.Available {
+				continue
+			}
+			broken++
+			logger.Warn("image unavailable", "image", st.Name, "error", st.Error)
+			delete(cfg.Pool.Images, st.Name)
+		}
+		if broken > 0 && cfg.ImageValidation == "fail" {
+			logger.Error("refusing to start: image validation failed", "unavailable", broken)
+			return 1
+		}
+		logger.Info("images validated", "total", len(imageStatus), "unavailable", broken)
+	}
+
+	// Background work runs as named jobs; GET /v1/system/jobs reports them.
+	runner := jobs.New(logger)
+	if cfg.DBMaintenanceSeconds > 0 {
+		runner.Start(ctx, jobs.Job{
+			Name:     "db-maintenance",
+			Interval: time.Duration(cfg.DBMaintenanceSeconds) * time.Second,
+			Run:      func(ctx context.Context) error { return st.MaintenancePass(ctx, logger) },
+		})
+	}
+	if cfg.DBActivityFlushMs > 0 {
+		runner.Start(ctx, jobs.Job{
+			Name:     "activity-flush",
+			Interval: time.Duration(cfg.DBActivityFlushMs) * time.Millisecond,
+			Run:      func(context.Context) error { return st.FlushActivity() },
+		})
+	}
 	logger.Debug("reaper and API server starting")
 
+	rpr := reaper.New(st, rt, reaperInterval, logger)
+
+	var workspaces session.WorkspaceManager
+	if cfg.Workspace.Enabled && cfg.Workspace.Encryption.Enabled {
+		enc, err := fscrypt.New(filepath.Join(cfg.DataDir, "workspaces"), cfg.Workspace.Encryption.KeyFile)
+		if err != nil {
+			logger.Error("workspace encryption", "error", err)
+			return 1
+		}
+		if err := enc.Check(); err != nil {
+			logger.Error("workspace encryption", "error", err)
+			return 1
+		}
+		workspaces = enc
+		logger.Info("workspace encryption enabled", "key_file", cfg.Workspace.Encryption.KeyFile)
+	}
+
 	var pl session.ContainerPool
+	var recycler imageRecycler
 	if cfg.Pool.Enabled {
 		poolCfg := pool.PoolConfig{
 			Store:      st,
@@ -191,50 +419,212 @@ func runDaemon(args []string) int {
 			SessionTTL: cfg.SessionTTLSeconds,
 			PoolExpiry: 1 * time.Hour, // 1 hour for pool_idle sessions
 			CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*pool.CreateResult, error) {
+				if workspaceID != "" && workspaces != nil {
+					if err := workspaces.Create(ctx, workspaceID, nil); err != nil {
+						return nil, err
+					}
+				}
 				info, err := rt.Create(ctx, runtimepkg.CreateOpts{
 					SessionID:   sessionID,
 					Image:       image,
 					WorkspaceID: workspaceID,
 				})
 				if err != nil {
+					session.RecordCreateFailure(diag, session.CreateFailureSourcePool, sessionID, image, err)
 					return nil, err
 				}
-				return &pool.CreateResult{InitPID: info.InitPID, CgroupPath: info.CgroupPath}, nil
+				if cmds := cfg.ImageSetup[image]; len(cmds) > 0 {
+					if err := session.RunSetupHooks(ctx, rt, sessionID, cmds, cfg.Defaults.MaxExecTimeoutMs); err != nil {
+						session.RecordCreateFailure(diag, session.CreateFailureSourcePool, sessionID, image, err)
+						_ = rt.Destroy(ctx, sessionID)
+						return nil, err
+					}
+				}
+				return &pool.CreateResult{InitPID: info.InitPID, CgroupPath: info.CgroupPath, ImageDigest: info.ImageDigest}, nil
 			},
+			IsRunning:    rt.IsRunning,
+			DestroyFunc:  rt.Destroy,
+			ReclaimAfter: time.Duration(cfg.Pool.ReclaimAfterSeconds) * time.Second,
+		}
+		if r, ok := rt.(runtimepkg.MemoryReclaimer); ok {
+			poolCfg.ReclaimFunc = r.ReclaimMemory
+		}
+		if r, ok := rt.(runtimepkg.MemoryPressureReporter); ok && cfg.HostProtection.MemoryPressure > 0 {
+			poolCfg.HostCheck = func() error {
+				return runtimepkg.CheckMemoryPressure(r, cfg.HostProtection.MemoryPressure)
+			}
 		}
 		if p := pool.New(cfg, poolCfg); p != nil {
 			pl = p
-			go p.RefillAll(ctx)
+			recycler = p
+			if poolCfg.ReclaimFunc != nil && poolCfg.ReclaimAfter > 0 {
+				runner.Start(ctx, jobs.Job{
+					Name:     "pool-reclaim",
+					Interval: 30 * time.Second,
+					Run: func(ctx context.Context) error {
+						p.ReclaimIdle(ctx)
+						return nil
+					},
+				})
+			}
+			// Not retried: a second Recycle would discard the fresh sessions.
+			runner.Start(ctx, jobs.Job{
+				Name:  "pool-startup",
+				After: rpr.Reconciled(),
+				Run: func(ctx context.Context) error {
+					_, err := p.Reconcile(ctx)
+					// Adopted sessions of images updated at startup run the old version.
+					for _, image := range refreshed {
+						p.Recycle(ctx, image)
+					}
+					p.RefillAll(ctx)
+					return err
+				},
+			})
 		}
 	}
+	if localImages && len(cfg.ImageRefresh) > 0 {
+		job := imageRefreshJob(cfg, recycler, logger)
+		job.Retry = jobs.DefaultRetry
+		runner.Start(ctx, job)
+	}
+
+	mgr := session.NewManager(cfg, st, rt, workspaces, pl)
+	mgr.SetAuditStore(st)
+	mgr.SetDiagnosticsStore(diag)
+	mgr.SetWorkspaceStore(st)
+	mgr.SetImageStatus(imageStatus)
+	mgr.SetImageResolver(rt)
+	if cfg.Usage.Enabled {
+		mgr.SetUsageStore(st)
+	}
+	if cfg.Policy.Enabled {
+		pol, err := policy.New(cfg.Policy, cfg.Defaults.NetworkMode)
+		if err != nil {
+			logger.Error("load command policy", "error", err)
+			return 1
+		}
+		mgr.SetPolicy(pol)
+		logger.Info("command policy enabled", "deny_patterns", len(cfg.Policy.DenyPatterns), "deny_prefixes", len(cfg.Policy.DenyPrefixes), "allow_patterns", len(cfg.Policy.AllowPatterns))
+	}
+
+	if cfg.Approval.Enabled {
+		q, err := session.NewApprovalQueue(cfg.Approval, cfg.Defaults.NetworkMode)
+		if err != nil {
+			logger.Error("approval workflow", "error", err)
+			return 1
+		}
+		mgr.SetApprovals(q)
+		logger.Info("approval workflow enabled", "exec_patterns", len(cfg.Approval.ExecPatterns), "networked_sessions", cfg.Approval.NetworkedSessions)
+	}
+
+	scanner, err := scan.New(cfg.Scan)
+	if err != nil {
+		logger.Error("content scan hook", "error", err)
+		return 1
+	}
+	if scanner != nil {
+		mgr.SetScanner(scanner)
+		logger.Info("content scan hook enabled", "command", len(cfg.Scan.Command) > 0, "url", cfg.Scan.URL != "")
+	}
 
-	mgr := session.NewManager(cfg, st, rt, nil, pl)
+	if n := hooks.New(cfg.DestroyHooks, cfg.DataDir); n != nil {
+		mgr.SetDestroyNotifier(n)
+	}
+	if h := cfg.DestroyHooks; len(h.Commands) > 0 || len(h.HostCommand) > 0 || h.WebhookURL != "" {
+		logger.Info("destroy hooks enabled", "commands", len(h.Commands), "host_command", len(h.HostCommand) > 0, "webhook", h.WebhookURL != "")
+	}
 
-	rpr := reaper.New(st, rt, 30*time.Second, logger)
+	if notifier != nil {
+		mgr.SetNotifier(notifier)
+		rpr.SetNotifier(notifier)
+	}
 	rpr.SetSessionManager(mgr)
-	go rpr.Run(ctx)
+	runner.Start(ctx, jobs.Job{Name: "reconcile", Immediate: true, Retry: jobs.DefaultRetry, Run: rpr.Reconcile})
+	runner.Start(ctx, jobs.Job{Name: "reaper", Interval: reaperInterval, After: rpr.Reconciled(), Run: rpr.ReapExpired})
+	if cfg.Workspace.Enabled && cfg.Workspace.RetentionDays > 0 {
+		if cfg.Workspace.RetentionDryRun {
+			logger.Info("workspace retention in dry-run mode; see GET /v1/workspaces/retention", "retention_days", cfg.Workspace.RetentionDays)
+		} else {
+			logger.Info("workspace retention enabled", "retention_days", cfg.Workspace.RetentionDays)
+		}
+	}
+	// The janitor also empties the trash, which may still hold workspaces
+	// after trash_days was set to 0.
+	if cfg.Workspace.Enabled {
+		runner.Start(ctx, jobs.Job{Name: "workspace-janitor", Interval: time.Hour, Immediate: true, Retry: jobs.DefaultRetry, Run: mgr.WorkspaceJanitor})
+	}
+	if cfg.Stats.HistoryIntervalSeconds > 0 {
+		runner.Start(ctx, jobs.Job{Name: "stats-sampler", Interval: time.Duration(cfg.Stats.HistoryIntervalSeconds) * time.Second, Run: mgr.SampleStats})
+	}
+	if cfg.SessionExpiryWarning > 0 {
+		runner.Start(ctx, jobs.Job{
+			Name:     "expiry-warnings",
+			Interval: 10 * time.Second,
+			Run:      func(context.Context) error { return mgr.WarnExpiring() },
+		})
+	}
 
 	srv := api.NewServer(cfg, mgr, st, path, logger)
+	srv.SetJobs(runner)
+	if cfg.Health.Enabled {
+		mon := newHealthMonitor(cfg, st, notifier, logger)
+		runner.Start(ctx, jobs.Job{
+			Name:      "health",
+			Interval:  time.Duration(cfg.Health.IntervalSeconds) * time.Second,
+			Immediate: true,
+			Run:       mon.Run,
+		})
+		srv.SetHealth(mon)
+		logger.Info("host health checks enabled", "interval_seconds", cfg.Health.IntervalSeconds, "webhook", cfg.Health.WebhookURL != "")
+	}
+	if cfg.Dashboard.Enabled && cfg.Dashboard.OIDC.Issuer != "" {
+		prov, err := oidc.New(cfg.Dashboard.OIDC, nil)
+		if err != nil {
+			logger.Error("dashboard sso", "error", err)
+			return 1
+		}
+		srv.SetOIDCProvider(prov)
+		logger.Info("dashboard sso enabled", "issuer", cfg.Dashboard.OIDC.Issuer, "role_mappings", len(cfg.Dashboard.OIDC.Roles))
+	}
 
 	httpServer := &http.Server{
-		Addr:         cfg.Listen,
-		Handler:      srv.Handler(),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 5 * time.Minute,
-		IdleTimeout:  60 * time.Second,
+		Addr:           cfg.Listen,
+		Handler:        srv.Handler(),
+		ReadTimeout:    time.Duration(cfg.HTTP.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:   time.Duration(cfg.HTTP.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:    time.Duration(cfg.HTTP.IdleTimeoutSeconds) * time.Second,
+		MaxHeaderBytes: cfg.HTTP.MaxHeaderBytes,
 	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 
+	shutdownDone := make(chan struct{})
 	go func() {
 		<-sigCh
-		logger.Info("shutting down...")
-		cancel()
+		logger.Info("shutting down, draining in-flight requests", "timeout_s", cfg.DrainTimeoutSeconds)
+		go func() {
+			<-sigCh
+			logger.Warn("second signal, exiting without waiting for drain")
+			os.Exit(1)
+		}()
 
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer shutdownCancel()
-		httpServer.Shutdown(shutdownCtx)
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Duration(cfg.DrainTimeoutSeconds)*time.Second)
+		defer drainCancel()
+
+		// Refuse new sessions right away, then let open requests (long execs
+		// included) finish before background loops and the store go away.
+		drainErr := make(chan error, 1)
+		go func() { drainErr <- mgr.Drain(drainCtx) }()
+		if err := httpServer.Shutdown(drainCtx); err != nil {
+			logger.Warn("http shutdown", "error", err)
+		}
+		if err := <-drainErr; err != nil {
+			logger.Warn("drain incomplete", "error", err)
+		}
+		cancel()
+		close(shutdownDone)
 	}()
 
 	logger.Info("listening", "addr", cfg.Listen)
@@ -249,6 +639,10 @@ func runDaemon(args []string) int {
 		logger.Error("server error", "error", err)
 		return 1
 	}
+	<-shutdownDone
+	runner.Wait()
+	notifier.Wait()
+	logger.Info("shutdown complete")
 
 	return 0
 }
@@ -268,3 +662,38 @@ func isListenNonLoopback(listen string) bool {
 	}
 	return !ip.IsLoopback()
 }
+
+// newHealthMonitor returns the host checks for the configured runtime. Changes
+// are recorded as audit events, posted to health.webhook_url and sent to the
+// notification rules of host events.
+func newHealthMonitor(cfg *config.Config, st *store.Store, notifier *notify.Notifier, logger *slog.Logger) *health.Monitor {
+	checks := []health.Check{health.DiskSpace(cfg.DataDir, cfg.Health.MinFreeDiskMB)}
+	if cfg.Health.MaxClockErrorMs > 0 {
+		checks = append(checks, health.Clock(cfg.Health.MaxClockErrorMs))
+	}
+	if cfg.Runtime == "linux" {
+		checks = append(checks,
+			health.Overlay(),
+			health.Check{Name: "cgroup_delegation", Run: func(context.Context) error { return linux.CheckCgroupDelegation() }},
+		)
+	}
+
+	notifiers := []health.Notifier{func(_ context.Context, ev health.Event) error {
+		action := "host_degraded"
+		if ev.Event == health.EventRecovered {
+			action = "host_recovered"
+		}
+		detail := ev.Check
+		if ev.Detail != "" {
+			detail += ": " + ev.Detail
+		}
+		return st.AppendAuditEvent(&store.AuditEvent{Action: action, Detail: detail})
+	}}
+	if cfg.Health.WebhookURL != "" {
+		notifiers = append(notifiers, health.Webhook(cfg.Health.WebhookURL, 10*time.Second))
+	}
+	if notifier != nil {
+		notifiers = append(notifiers, notifier.HealthNotifier())
+	}
+	return health.New(logger, checks, notifiers...)
+}
@@ -0,0 +1,17 @@
+//go:build linux && !containerd
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
+)
+
+// The containerd runtime pulls in the containerd client with its gRPC and
+// OpenTelemetry dependencies, so it is only built with -tags containerd.
+func newContainerdRuntime(cfg *config.Config, logger *slog.Logger) (wasm.Runtime, error) {
+	return nil, errors.New("runtime containerd is not built into this daemon (build with -tags containerd)")
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+// spikeDiagnostics records failed creates in the wrapped store and raises a
+// create.failure_spike notification when
+// notifications.create_failure_spike.threshold of them happen within its
+// window.
+type spikeDiagnostics struct {
+	session.DiagnosticsStore
+	notifier *notify.Notifier
+	spike    *notify.Spike
+	window   time.Duration
+}
+
+// withFailureSpikes returns d, wrapped to notify about failure spikes if n
+// is enabled.
+func withFailureSpikes(d session.DiagnosticsStore, n *notify.Notifier, cfg config.CreateFailureSpikeConfig) session.DiagnosticsStore {
+	if n == nil {
+		return d
+	}
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	return &spikeDiagnostics{DiagnosticsStore: d, notifier: n, spike: notify.NewSpike(cfg.Threshold, window), window: window}
+}
+
+func (s *spikeDiagnostics) AppendCreateFailure(f *store.CreateFailure) error {
+	if count, spiking := s.spike.Add(time.Now()); spiking {
+		s.notifier.Notify(notify.Event{
+			Type:    notify.EventCreateFailureSpike,
+			Summary: fmt.Sprintf("%d session creates failed within %s", count, s.window),
+			Fields: map[string]string{
+				"failures":     strconv.Itoa(count),
+				"window":       s.window.String(),
+				"last_image":   f.Image,
+				"last_class":   f.Class,
+				"last_source":  f.Source,
+				"last_error":   f.Error,
+				"last_session": f.SessionID,
+			},
+		})
+	}
+	return s.DiagnosticsStore.AppendCreateFailure(f)
+}
@@ -0,0 +1,195 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+func runPool(args []string) int {
+	if len(args) == 0 {
+		printPoolUsage()
+		return 1
+	}
+	switch args[0] {
+	case "status":
+		return runPoolStatus(args[1:])
+	case "drain":
+		return runPoolDrain(args[1:])
+	case "refill":
+		return runPoolRefill(args[1:])
+	default:
+		printPoolUsage()
+		return 1
+	}
+}
+
+func printPoolUsage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  sandkasten pool status [--json] [--config <path>] [--host <url>]
+  sandkasten pool drain [<image>] [--refill] [--config <path>] [--host <url>]
+  sandkasten pool refill [<image>] [--config <path>] [--host <url>]
+
+drain destroys the idle pooled sessions of <image> (every image if omitted);
+--refill builds fresh ones afterwards. refill fills the pool up to its target.
+`)
+}
+
+// poolFlags parses the flags shared by the pool commands. It returns the
+// daemon endpoint and the optional image argument.
+func poolFlags(name string, args []string, extra func(fs *flag.FlagSet)) (baseURL, apiKey, image string, ok bool) {
+	fs := flag.NewFlagSet("pool "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	cfgPath := fs.String("config", "", "path to sandkasten.yaml (used to get listen and api_key)")
+	host := fs.String("host", "", "daemon URL (e.g. http://127.0.0.1:8080); overrides config listen")
+	if extra != nil {
+		extra(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", "", "", false
+	}
+	image = fs.Arg(0)
+	// Flags may follow the image.
+	if fs.NArg() > 0 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", "", "", false
+		}
+		if fs.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "pool %s: at most one image\n", name)
+			return "", "", "", false
+		}
+	}
+	baseURL, apiKey, err := daemonEndpoint(*cfgPath, *host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pool %s: %v\n", name, err)
+		return "", "", "", false
+	}
+	return baseURL, apiKey, image, true
+}
+
+// poolCall sends a pool API request and decodes a 200 or 202 response into
+// out.
+func poolCall(method, url, apiKey string, body any, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	// Draining destroys sandboxes one by one.
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func runPoolStatus(args []string) int {
+	var asJSON bool
+	baseURL, apiKey, image, ok := poolFlags("status", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&asJSON, "json", false, "print the raw API response")
+	})
+	if !ok {
+		return 1
+	}
+	if image != "" {
+		fmt.Fprintf(os.Stderr, "pool status: unexpected argument %q\n", image)
+		return 1
+	}
+	var st session.PoolStatus
+	if err := poolCall(http.MethodGet, baseURL+"/v1/pool", apiKey, nil, &st); err != nil {
+		fmt.Fprintf(os.Stderr, "pool status: %v\n", err)
+		return 1
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(st)
+		return 0
+	}
+
+	fmt.Printf("%-20s %-14s %6s %6s %7s %10s %-9s %s\n", "IMAGE", "WORKSPACE", "TARGET", "IDLE", "HEALTHY", "OLDEST", "REFILLING", "LAST ERROR")
+	for _, k := range st.Keys {
+		oldest := "-"
+		if len(k.Sessions) > 0 {
+			oldest = (time.Duration(k.Sessions[0].AgeSeconds) * time.Second).String()
+		}
+		ws := k.WorkspaceID
+		if ws == "" {
+			ws = "-"
+		}
+		refilling := "no"
+		if k.Refilling {
+			refilling = "yes"
+		}
+		fmt.Printf("%-20s %-14s %6d %6d %7d %10s %-9s %s\n", k.Image, ws, k.Target, k.Idle, k.Healthy, oldest, refilling, k.LastError)
+	}
+	return 0
+}
+
+func runPoolDrain(args []string) int {
+	var refill bool
+	baseURL, apiKey, image, ok := poolFlags("drain", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&refill, "refill", false, "build fresh idle sessions after draining")
+	})
+	if !ok {
+		return 1
+	}
+	var res session.PoolDrainResult
+	body := map[string]any{"image": image, "refill": refill}
+	if err := poolCall(http.MethodPost, baseURL+"/v1/pool/drain", apiKey, body, &res); err != nil {
+		fmt.Fprintf(os.Stderr, "pool drain: %v\n", err)
+		return 1
+	}
+	target := res.Image
+	if target == "" {
+		target = "all images"
+	}
+	fmt.Printf("%s: %d idle session(s) destroyed", target, res.Discarded)
+	if res.Refilling {
+		fmt.Print(", refilling")
+	}
+	fmt.Println()
+	return 0
+}
+
+func runPoolRefill(args []string) int {
+	baseURL, apiKey, image, ok := poolFlags("refill", args, nil)
+	if !ok {
+		return 1
+	}
+	var res session.PoolRefillResult
+	if err := poolCall(http.MethodPost, baseURL+"/v1/pool/refill", apiKey, map[string]string{"image": image}, &res); err != nil {
+		fmt.Fprintf(os.Stderr, "pool refill: %v\n", err)
+		return 1
+	}
+	target := res.Image
+	if target == "" {
+		target = "all images"
+	}
+	fmt.Printf("%s: refilling %d idle session(s)\n", target, res.Missing)
+	return 0
+}
@@ -0,0 +1,177 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/jobs"
+)
+
+// Refresh policies for image_refresh.
+const (
+	refreshNever   = "never"
+	refreshDaily   = "daily"
+	refreshOnStart = "on-start"
+)
+
+const refreshInterval = 24 * time.Hour
+
+// imageRecycler replaces pooled sessions of an image after it was updated.
+type imageRecycler interface {
+	Recycle(ctx context.Context, image string) int
+}
+
+// validateImageRefresh rejects unknown policies so a typo fails startup.
+func validateImageRefresh(policies map[string]string) error {
+	for image, policy := range policies {
+		switch policy {
+		case refreshNever, refreshDaily, refreshOnStart:
+		default:
+			return fmt.Errorf("image_refresh[%s]: unknown policy %q (want never, daily or on-start)", image, policy)
+		}
+	}
+	return nil
+}
+
+// refreshImage re-resolves the reference an image was pulled from. When the
+// upstream digest changed, the new layers are pulled and the image is
+// repointed by replacing meta.json; old layers stay in place for sessions
+// still running on them. Returns whether the image changed.
+func refreshImage(ctx context.Context, dataDir, nameValue string, logger *slog.Logger) (bool, error) {
+	metaPath := filepath.Join(dataDir, "images", nameValue, "meta.json")
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return false, fmt.Errorf("read image metadata: %w", err)
+	}
+	var meta ImageMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return false, fmt.Errorf("parse image metadata: %w", err)
+	}
+	if meta.Source == "" {
+		return false, fmt.Errorf("image %s has no source reference; re-pull it to enable refresh", nameValue)
+	}
+
+	ref, err := name.ParseReference(meta.Source, name.WeakValidation)
+	if err != nil {
+		return false, fmt.Errorf("parse reference: %w", err)
+	}
+	head, err := remote.Head(ref, remote.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("resolve %s: %w", meta.Source, err)
+	}
+	if head.Digest.String() == meta.SourceDigest {
+		return false, nil
+	}
+
+	desc, img, arch, err := fetchImage(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+	layerIDs, err := pullLayers(dataDir, nameValue, img, logger)
+	if err != nil {
+		return false, err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return false, fmt.Errorf("compute digest: %w", err)
+	}
+
+	meta.Hash = digest.String()
+	meta.SourceDigest = desc.Digest.String()
+	meta.Layers = layerIDs
+	meta.Arch = arch
+	meta.CreatedAt = time.Now().UTC()
+	if err := writeMeta(metaPath, meta); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// refreshImages refreshes every image whose policy is policy and returns the
+// ones that changed and the failures, joined. An image that failed to
+// refresh stays on its current version.
+func refreshImages(ctx context.Context, cfg *config.Config, policy string, logger *slog.Logger) ([]string, error) {
+	var images []string
+	for image, p := range cfg.ImageRefresh {
+		if p == policy {
+			images = append(images, image)
+		}
+	}
+	sort.Strings(images)
+
+	var changed []string
+	var errs []error
+	for _, image := range images {
+		updated, err := refreshImage(ctx, cfg.DataDir, image, logger)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", image, err))
+			continue
+		}
+		if updated {
+			logger.Info("image updated", "image", image)
+			scanPulledImage(ctx, cfg, image, logger)
+			changed = append(changed, image)
+		} else {
+			logger.Debug("image up to date", "image", image)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// imageRefreshJob refreshes images with the daily policy once per
+// refreshInterval and recycles their pooled sessions when they change.
+func imageRefreshJob(cfg *config.Config, pl imageRecycler, logger *slog.Logger) jobs.Job {
+	return jobs.Job{
+		Name:     "image-refresh",
+		Interval: refreshInterval,
+		Run: func(ctx context.Context) error {
+			changed, err := refreshImages(ctx, cfg, refreshDaily, logger)
+			for _, image := range changed {
+				if pl != nil {
+					logger.Info("pool recycled after image update", "image", image, "discarded", pl.Recycle(ctx, image))
+				}
+			}
+			return err
+		},
+	}
+}
+
+func runImageRefresh(args []string) int {
+	fs := flag.NewFlagSet("image refresh", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image refresh [--data-dir <dir>] <image>")
+		return 1
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	updated, err := refreshImage(context.Background(), *dataDir, fs.Arg(0), logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if updated {
+		fmt.Printf("Image %s updated\n", fs.Arg(0))
+	} else {
+		fmt.Printf("Image %s is up to date\n", fs.Arg(0))
+	}
+	return 0
+}
@@ -0,0 +1,363 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/elfcheck"
+	"github.com/p-arndt/sandkasten/internal/runnerbin"
+	runtimepkg "github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/runtime/linux"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// selfTestImage is the name of the throwaway busybox image.
+const selfTestImage = "selftest"
+
+// runSelfTest creates throwaway sessions with the daemon's config from a
+// busybox rootfs in a temporary data dir, and checks what the static doctor
+// checks cannot: that a session starts, runs a command, is confined to its
+// cgroup with the configured limits, and sees the network of each mode. The
+// configured network mode is tested along with none and host; bridge only
+// when configured, since it sets up the host bridge.
+func runSelfTest(cfg *config.Config, busybox string) []doctorCheck {
+	fail := func(details string) []doctorCheck {
+		return []doctorCheck{{Name: "Self-test", Status: "FAIL", Details: details}}
+	}
+
+	busybox, err := findSelfTestBusybox(busybox)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	tmp, err := os.MkdirTemp("", "sandkasten-selftest-")
+	if err != nil {
+		return fail(fmt.Sprintf("create temp dir: %v", err))
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := writeSelfTestImage(tmp, busybox); err != nil {
+		return fail(fmt.Sprintf("write busybox image: %v", err))
+	}
+
+	st := *cfg
+	st.DataDir = tmp
+	if st.Runner.Injection == config.RunnerInjectionLayer {
+		// The temp data dir has no runner layer; bind the daemon's runner.
+		runner, err := selfTestRunner(cfg.DataDir)
+		if err != nil {
+			return fail(err.Error())
+		}
+		st.Runner = config.RunnerConfig{Injection: config.RunnerInjectionBind, Path: runner}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	d, err := linux.NewDriver(&st, logger)
+	if err != nil {
+		return fail(fmt.Sprintf("init runtime: %v", err))
+	}
+	defer d.Close()
+	if st.Defaults.NetworkMode == "bridge" {
+		// Sessions of a running daemon share the bridge; keep their addresses.
+		reserveLiveIPs(cfg.DataDir)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	modes := []string{st.Defaults.NetworkMode}
+	for _, m := range []string{"none", "host"} {
+		if !slices.Contains(modes, m) {
+			modes = append(modes, m)
+		}
+	}
+
+	var checks []doctorCheck
+	for i, mode := range modes {
+		// The driver reads the network mode per create, so one driver
+		// serves all modes.
+		st.Defaults.NetworkMode = mode
+		checks = append(checks, selfTestSession(ctx, d, &st, mode, i == 0)...)
+	}
+	return checks
+}
+
+// selfTestSession creates one session in network mode and checks it. full
+// adds the create, exec and cgroup checks; otherwise only the network check
+// is reported.
+func selfTestSession(ctx context.Context, d *linux.Driver, cfg *config.Config, mode string, full bool) []doctorCheck {
+	var checks []doctorCheck
+	netName := "Network " + mode
+
+	id := selfTestSessionID()
+	start := time.Now()
+	info, err := d.Create(ctx, runtimepkg.CreateOpts{SessionID: id, Image: selfTestImage})
+	createDur := time.Since(start)
+	if err != nil {
+		name := netName
+		if full {
+			name = "Self-test create"
+		}
+		return append(checks, doctorCheck{Name: name, Status: "FAIL", Details: err.Error()})
+	}
+	defer func() {
+		_ = d.Destroy(context.Background(), id)
+	}()
+
+	start = time.Now()
+	out, err := selfTestExec(ctx, d, id, "echo selftest-ok")
+	execDur := time.Since(start)
+	if full {
+		checks = append(checks, doctorCheck{Name: "Self-test create", Status: "OK", Details: fmt.Sprintf("%s (%s network)", createDur.Round(time.Millisecond), mode)})
+		switch {
+		case err != nil:
+			checks = append(checks, doctorCheck{Name: "Self-test exec", Status: "FAIL", Details: err.Error()})
+		case !strings.Contains(out, "selftest-ok"):
+			checks = append(checks, doctorCheck{Name: "Self-test exec", Status: "FAIL", Details: fmt.Sprintf("unexpected output %q", out)})
+		default:
+			checks = append(checks, doctorCheck{Name: "Self-test exec", Status: "OK", Details: execDur.Round(time.Millisecond).String()})
+		}
+		checks = append(checks, selfTestCgroup(info, cfg))
+	}
+
+	if err != nil {
+		return append(checks, doctorCheck{Name: netName, Status: "FAIL", Details: err.Error()})
+	}
+	return append(checks, selfTestNetwork(ctx, d, id, mode))
+}
+
+func selfTestExec(ctx context.Context, d *linux.Driver, id, cmd string) (string, error) {
+	resp, err := d.Exec(ctx, id, protocol.Request{ID: "selftest", Type: protocol.RequestExec, Cmd: cmd, TimeoutMs: 10000})
+	if err != nil {
+		return "", err
+	}
+	if resp.Type == protocol.ResponseError {
+		return "", fmt.Errorf("%s", resp.Error)
+	}
+	if resp.ExitCode != 0 {
+		return "", fmt.Errorf("%q exited with %d: %s", cmd, resp.ExitCode, strings.TrimSpace(resp.Output))
+	}
+	return resp.Output, nil
+}
+
+// selfTestCgroup checks that the session's init process sits in the session
+// cgroup and that the configured memory and PID limits were applied; writing
+// them fails silently when the cgroup is not delegated.
+func selfTestCgroup(info *runtimepkg.SessionInfo, cfg *config.Config) doctorCheck {
+	check := doctorCheck{Name: "Self-test cgroup"}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", info.InitPID))
+	if err != nil {
+		check.Status, check.Details = "FAIL", fmt.Sprintf("read cgroup of init process: %v", err)
+		return check
+	}
+	rel := strings.TrimPrefix(info.CgroupPath, "/sys/fs/cgroup")
+	if !strings.Contains(string(data), "0::"+rel+"\n") {
+		check.Status, check.Details = "FAIL", fmt.Sprintf("init process is in %s, want %s", strings.TrimSpace(string(data)), rel)
+		return check
+	}
+
+	var problems, applied []string
+	expect := func(file, want string) {
+		got, err := os.ReadFile(filepath.Join(info.CgroupPath, file))
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+		case strings.TrimSpace(string(got)) != want:
+			problems = append(problems, fmt.Sprintf("%s = %s, want %s", file, strings.TrimSpace(string(got)), want))
+		default:
+			applied = append(applied, file+"="+want)
+		}
+	}
+	if cfg.Defaults.MemLimitMB > 0 {
+		expect("memory.max", strconv.FormatInt(int64(cfg.Defaults.MemLimitMB)*1024*1024, 10))
+	}
+	if cfg.Defaults.PidsLimit > 0 {
+		expect("pids.max", strconv.Itoa(cfg.Defaults.PidsLimit))
+	}
+	if cfg.Defaults.CPUWeight > 0 {
+		expect("cpu.weight", strconv.Itoa(cfg.Defaults.CPUWeight))
+	}
+	if cfg.Defaults.CPUBurstMs > 0 {
+		expect("cpu.max.burst", strconv.Itoa(cfg.Defaults.CPUBurstMs*1000))
+	}
+	if len(problems) > 0 {
+		check.Status, check.Details = "FAIL", strings.Join(problems, "; ")+" (cgroup not delegated?)"
+		return check
+	}
+	check.Status, check.Details = "OK", strings.Join(append([]string{rel}, applied...), " ")
+	return check
+}
+
+// selfTestNetwork checks the interfaces the session sees: only lo for none,
+// the host's for host and eth0 for bridge.
+func selfTestNetwork(ctx context.Context, d *linux.Driver, id, mode string) doctorCheck {
+	check := doctorCheck{Name: "Network " + mode}
+	out, err := selfTestExec(ctx, d, id, "cat /proc/net/dev")
+	if err != nil {
+		check.Status, check.Details = "FAIL", err.Error()
+		return check
+	}
+	got := netDevNames(out)
+
+	var ok bool
+	switch mode {
+	case "none":
+		ok = slices.Equal(got, []string{"lo"})
+	case "host":
+		hostDev, err := os.ReadFile("/proc/net/dev")
+		ok = err == nil && slices.Equal(got, netDevNames(string(hostDev)))
+	case "bridge":
+		ok = slices.Contains(got, "eth0") && slices.Contains(got, "lo")
+	}
+	check.Details = "interfaces: " + strings.Join(got, ", ")
+	if ok {
+		check.Status = "OK"
+	} else {
+		check.Status = "FAIL"
+		check.Details = "unexpected " + check.Details
+	}
+	return check
+}
+
+// netDevNames returns the sorted interface names in /proc/net/dev output.
+func netDevNames(out string) []string {
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		name, _, found := strings.Cut(line, ":")
+		if found && !strings.Contains(name, "|") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// findSelfTestBusybox returns the static busybox to build the rootfs from:
+// path, else SANDKASTEN_BUSYBOX, else busybox on PATH.
+func findSelfTestBusybox(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv("SANDKASTEN_BUSYBOX")
+	}
+	if path == "" {
+		p, err := exec.LookPath("busybox")
+		if err != nil {
+			return "", fmt.Errorf("no busybox found; pass --busybox or set SANDKASTEN_BUSYBOX to a static busybox")
+		}
+		path = p
+	}
+	info, err := elfcheck.Inspect(path)
+	if err != nil {
+		return "", fmt.Errorf("busybox %s: %w", path, err)
+	}
+	if !info.Static() {
+		return "", fmt.Errorf("busybox %s is dynamically linked; the self-test needs a static busybox", path)
+	}
+	if !elfcheck.HostCanRun(info.Arch) {
+		return "", fmt.Errorf("busybox %s is built for %s", path, info.Arch)
+	}
+	return path, nil
+}
+
+// selfTestRunner returns the runner for layer injection: the one in the
+// runner layer, else the one next to this binary.
+func selfTestRunner(dataDir string) (string, error) {
+	runner := filepath.Join(dataDir, "layers", "runner", "rootfs", "usr", "local", "bin", "runner")
+	if _, err := os.Stat(runner); err != nil {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", fmt.Errorf("get executable path: %w", err)
+		}
+		if runner, err = runnerbin.Find(filepath.Dir(exe)); err != nil {
+			return "", err
+		}
+	}
+	if err := elfcheck.CheckRunner(runner); err != nil {
+		return "", err
+	}
+	return runner, nil
+}
+
+// writeSelfTestImage lays out images/selftest/rootfs under dataDir: busybox
+// with a symlink per applet and a /bin/bash shim for the runner's shell.
+func writeSelfTestImage(dataDir, busybox string) error {
+	rootfs := filepath.Join(dataDir, "images", selfTestImage, "rootfs")
+	for _, dir := range []string{"bin", "dev", "etc", "proc", "sys", "tmp", "workspace", "usr/local/bin"} {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(busybox)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "bin", "busybox"), data, 0755); err != nil {
+		return err
+	}
+
+	out, err := exec.Command(busybox, "--list").Output()
+	if err != nil {
+		return fmt.Errorf("busybox --list: %w", err)
+	}
+	for _, applet := range strings.Fields(string(out)) {
+		if applet == "busybox" || applet == "bash" {
+			continue
+		}
+		if err := os.Symlink("busybox", filepath.Join(rootfs, "bin", applet)); err != nil {
+			return err
+		}
+	}
+	files := map[string]string{
+		"bin/bash":   "#!/bin/sh\nexec /bin/sh \"$@\"\n",
+		"etc/passwd": "root:x:0:0:root:/root:/bin/sh\nsandbox:x:1000:1000:sandbox:/home/sandbox:/bin/sh\n",
+		"etc/group":  "root:x:0:\nsandbox:x:1000:\n",
+	}
+	for name, content := range files {
+		mode := os.FileMode(0644)
+		if name == "bin/bash" {
+			mode = 0755
+		}
+		if err := os.WriteFile(filepath.Join(rootfs, name), []byte(content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveLiveIPs marks the bridge addresses of the sessions in dataDir as
+// used so self-test sessions do not take them.
+func reserveLiveIPs(dataDir string) {
+	dirs, _ := os.ReadDir(filepath.Join(dataDir, "sessions"))
+	for _, e := range dirs {
+		data, err := os.ReadFile(filepath.Join(dataDir, "sessions", e.Name(), "state.json"))
+		if err != nil {
+			continue
+		}
+		var state protocol.SessionState
+		if json.Unmarshal(data, &state) == nil && state.IP != "" {
+			_ = linux.ReserveIP(e.Name(), state.IP)
+		}
+	}
+}
+
+// selfTestSessionID returns a session ID that cannot clash with daemon
+// sessions, whose IDs are hex.
+func selfTestSessionID() string {
+	b := make([]byte, 5)
+	_, _ = rand.Read(b)
+	return "st" + hex.EncodeToString(b)
+}
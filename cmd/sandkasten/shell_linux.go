@@ -0,0 +1,493 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// maxShellHistory caps the in-memory and persisted shell history.
+const maxShellHistory = 1000
+
+// runShell opens a line-based REPL on a session (sandkasten shell <id>). Each
+// command goes through the exec stream API, so cwd and environment persist as
+// they do for API clients. It reads plain lines from stdin and therefore
+// works under rlwrap and with piped scripts.
+func runShell(args []string) int {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	cfgPath := fs.String("config", "", "path to sandkasten.yaml")
+	host := fs.String("host", "", "daemon URL (e.g. http://127.0.0.1:8080)")
+	timeoutMs := fs.Int("timeout", 0, "per-command timeout in ms (0 = daemon maximum)")
+	histFile := fs.String("history", defaultShellHistoryFile(), "history file (empty disables saving)")
+
+	// Accept the session ID before or after the flags.
+	var id string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		id, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if id == "" && fs.NArg() > 0 {
+		id = fs.Arg(0)
+	}
+	if id == "" {
+		fmt.Fprintf(os.Stderr, "shell: missing session ID\n")
+		fmt.Fprintf(os.Stderr, "Usage: sandkasten shell <session-id> [--config <path>] [--host <url>] [--timeout <ms>]\n")
+		return 1
+	}
+
+	baseURL, apiKey, err := daemonEndpoint(*cfgPath, *host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shell: %v\n", err)
+		return 1
+	}
+
+	sh := &replShell{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    apiKey,
+		sessionID: id,
+		timeoutMs: *timeoutMs,
+		histFile:  *histFile,
+		in:        bufio.NewReader(os.Stdin),
+	}
+	_, termErr := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TCGETS)
+	sh.interactive = termErr == nil
+	return sh.run()
+}
+
+func defaultShellHistoryFile() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "sandkasten", "shell_history")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".sandkasten_history")
+	}
+	return ""
+}
+
+type replShell struct {
+	baseURL   string
+	apiKey    string
+	sessionID string
+	timeoutMs int
+	histFile  string
+
+	in          *bufio.Reader
+	interactive bool // stdin is a terminal: print prompts, detect pastes
+
+	cwd      string
+	exitCode int
+	history  []string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // set while a command runs
+}
+
+func (s *replShell) run() int {
+	var info session.SessionInfo
+	if err := s.call(context.Background(), http.MethodGet, "/v1/sessions/"+s.sessionID, nil, &info); err != nil {
+		fmt.Fprintf(os.Stderr, "shell: %v\n", err)
+		return 1
+	}
+	s.cwd = info.Cwd
+	s.loadHistory()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+	defer signal.Stop(sigs)
+	go s.handleInterrupts(sigs)
+
+	if s.interactive {
+		fmt.Fprintf(os.Stderr, "Connected to session %s (image %s). Type exit or press Ctrl-D to leave.\n", info.ID, info.Image)
+	}
+	for {
+		cmd, err := s.readCommand()
+		if err != nil {
+			if s.interactive {
+				fmt.Fprintln(os.Stderr)
+			}
+			return 0
+		}
+		cmd, ok := s.expandHistory(cmd)
+		if !ok || strings.TrimSpace(cmd) == "" {
+			continue
+		}
+		s.addHistory(cmd)
+
+		switch strings.TrimSpace(cmd) {
+		case "exit", "quit", "logout":
+			// Running exit would end the session's shell, not this loop.
+			return 0
+		case "history":
+			for i, h := range s.history {
+				fmt.Printf("%5d  %s\n", i+1, h)
+			}
+			continue
+		}
+
+		if err := s.exec(cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "shell: %v\n", err)
+			var gone *sessionGoneError
+			if errors.As(err, &gone) {
+				return 1
+			}
+		}
+	}
+}
+
+// handleInterrupts cancels the running command on Ctrl-C, or redraws the
+// prompt when idle (the terminal has already discarded the typed line).
+func (s *replShell) handleInterrupts(sigs <-chan os.Signal) {
+	for range sigs {
+		s.mu.Lock()
+		cancel := s.cancel
+		s.mu.Unlock()
+		if cancel != nil {
+			cancel()
+			continue
+		}
+		if s.interactive {
+			fmt.Fprint(os.Stderr, "\n"+s.prompt())
+		}
+	}
+}
+
+func (s *replShell) prompt() string {
+	status := ""
+	if s.exitCode != 0 {
+		status = fmt.Sprintf("[%d] ", s.exitCode)
+	}
+	short := s.sessionID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return fmt.Sprintf("%ssk-%s:%s$ ", status, short, s.cwd)
+}
+
+// readCommand reads one command, which spans several lines when a line ends
+// in a backslash, a quote is still open, or more pasted lines are waiting.
+func (s *replShell) readCommand() (string, error) {
+	if s.interactive {
+		fmt.Fprint(os.Stderr, s.prompt())
+	}
+	line, err := s.readLine()
+	if err != nil {
+		return "", err
+	}
+	cmd := line
+	for {
+		cont := needsContinuation(cmd)
+		if !cont && !s.pasting() {
+			return cmd, nil
+		}
+		if cont && s.interactive && s.in.Buffered() == 0 {
+			fmt.Fprint(os.Stderr, "> ")
+		}
+		line, err := s.readLine()
+		if err != nil {
+			return cmd, nil // run what we have, then exit on the next read
+		}
+		// The session's shell handles backslash-newline itself.
+		cmd += "\n" + line
+	}
+}
+
+func (s *replShell) readLine() (string, error) {
+	line, err := s.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// pasting reports whether more input is already waiting, i.e. the user
+// pasted several lines that belong to one command (a loop, a heredoc).
+func (s *replShell) pasting() bool {
+	if !s.interactive {
+		return false
+	}
+	if s.in.Buffered() > 0 {
+		return true
+	}
+	fds := []unix.PollFd{{Fd: int32(os.Stdin.Fd()), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, 20)
+	return err == nil && n > 0
+}
+
+// needsContinuation reports whether cmd ends inside quotes or with a line
+// continuation backslash. Quotes in comments do not count.
+func needsContinuation(cmd string) bool {
+	var quote rune
+	escaped, comment := false, false
+	prev := ' '
+	for _, r := range cmd {
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+			}
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '#' && (prev == ' ' || prev == '\t' || prev == '\n' || prev == ';'):
+			comment = true
+		}
+		prev = r
+	}
+	return quote != 0 || escaped
+}
+
+// expandHistory replaces a command of "!!" or "!N" with that history entry
+// and echoes it. ok is false when the entry does not exist.
+func (s *replShell) expandHistory(cmd string) (string, bool) {
+	t := strings.TrimSpace(cmd)
+	if !strings.HasPrefix(t, "!") || len(t) < 2 {
+		return cmd, true
+	}
+	var n int
+	if t == "!!" {
+		n = len(s.history)
+	} else {
+		var err error
+		if n, err = strconv.Atoi(t[1:]); err != nil {
+			return cmd, true // e.g. "! true": negation, not history
+		}
+	}
+	if n < 1 || n > len(s.history) {
+		fmt.Fprintf(os.Stderr, "shell: %s: event not found\n", t)
+		return "", false
+	}
+	cmd = s.history[n-1]
+	fmt.Fprintln(os.Stderr, cmd)
+	return cmd, true
+}
+
+func (s *replShell) loadHistory() {
+	if s.histFile == "" {
+		return
+	}
+	data, err := os.ReadFile(s.histFile)
+	if err != nil {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxShellHistory {
+		lines = lines[len(lines)-maxShellHistory:]
+	}
+	for _, l := range lines {
+		if l != "" {
+			s.history = append(s.history, l)
+		}
+	}
+}
+
+// addHistory records cmd and appends it to the history file. Multi-line
+// commands are saved line by line, as bash does.
+func (s *replShell) addHistory(cmd string) {
+	if n := len(s.history); n > 0 && s.history[n-1] == cmd {
+		return
+	}
+	s.history = append(s.history, cmd)
+	if len(s.history) > maxShellHistory {
+		s.history = s.history[1:]
+	}
+	if s.histFile == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.histFile), 0700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(s.histFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, cmd)
+}
+
+// exec runs cmd through the exec stream API, copying output to stdout as it
+// arrives, and records the resulting cwd and exit code.
+func (s *replShell) exec(cmd string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	body, _ := json.Marshal(map[string]any{"cmd": cmd, "timeout_ms": s.timeoutMs})
+	req, err := s.newRequest(ctx, http.MethodPost, "/v1/sessions/"+s.sessionID+"/exec/stream", body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		return fmt.Errorf("cannot reach daemon at %s: %w", s.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	out := &trailingNewline{w: os.Stdout}
+	defer out.finish()
+	var event string
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := []byte(strings.TrimPrefix(line, "data: "))
+			switch event {
+			case "chunk":
+				var c struct {
+					Chunk string `json:"chunk"`
+				}
+				if json.Unmarshal(data, &c) == nil {
+					out.Write([]byte(c.Chunk))
+				}
+			case "done":
+				var d struct {
+					ExitCode int    `json:"exit_code"`
+					Cwd      string `json:"cwd"`
+				}
+				if err := json.Unmarshal(data, &d); err != nil {
+					return fmt.Errorf("decode done event: %w", err)
+				}
+				s.exitCode = d.ExitCode
+				if d.Cwd != "" {
+					s.cwd = d.Cwd
+				}
+				return nil
+			case "error":
+				var e struct {
+					Error string `json:"error"`
+				}
+				json.Unmarshal(data, &e)
+				return errors.New(e.Error)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return fmt.Errorf("stream ended without a result")
+}
+
+var errInterrupted = errors.New("interrupted; the command may still be running in the session")
+
+// sessionGoneError ends the shell: the session was destroyed or expired.
+type sessionGoneError struct{ msg string }
+
+func (e *sessionGoneError) Error() string { return e.msg }
+
+// responseError turns a non-200 API response into an error.
+func responseError(resp *http.Response) error {
+	var body struct {
+		Code       string `json:"error_code"`
+		Message    string `json:"message"`
+		ApprovalID string `json:"approval_id"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	json.Unmarshal(data, &body)
+	switch {
+	case resp.StatusCode == http.StatusAccepted && body.ApprovalID != "":
+		return fmt.Errorf("command held for approval %s", body.ApprovalID)
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return &sessionGoneError{msg: body.Message}
+	case body.Message != "":
+		return fmt.Errorf("%s (%s)", body.Message, body.Code)
+	}
+	return fmt.Errorf("daemon returned %s", resp.Status)
+}
+
+func (s *replShell) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	return req, nil
+}
+
+func (s *replShell) call(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := s.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach daemon at %s: %w", s.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// trailingNewline passes output through and, on finish, ends it with a
+// newline if the command did not, so the prompt starts on its own line.
+type trailingNewline struct {
+	w    io.Writer
+	last byte
+}
+
+func (t *trailingNewline) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		t.last = p[len(p)-1]
+	}
+	return t.w.Write(p)
+}
+
+func (t *trailingNewline) finish() {
+	if t.last != 0 && t.last != '\n' {
+		t.w.Write([]byte("\n"))
+	}
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime/wasm"
+)
+
+var wasmMagic = []byte("\x00asm")
+
+func runImageImportWasm(args []string) int {
+	fs := flag.NewFlagSet("image import-wasm", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dataDir := fs.String("data-dir", envOrDefault("SANDKASTEN_DATA_DIR", defaultDataDir), "sandkasten data directory")
+	imageName := fs.String("name", "", "sandkasten image name (required)")
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	if fs.NArg() < 1 || *imageName == "" {
+		fmt.Fprintln(os.Stderr, "Usage: sandkasten image import-wasm --name <image> [--data-dir <dir>] <module.wasm>")
+		return 1
+	}
+	if !imageNamePattern.MatchString(*imageName) {
+		fmt.Fprintf(os.Stderr, "Error: invalid image name %q\n", *imageName)
+		return 1
+	}
+
+	hash, err := importWasmImage(*dataDir, *imageName, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Imported wasm image: %s (%s)\n", *imageName, hash)
+	return 0
+}
+
+// importWasmImage stores the WASI module at file as image nameValue. An
+// existing wasm image of that name is replaced; the daemon recompiles on the
+// next session create.
+func importWasmImage(dataDir, nameValue, file string) (string, error) {
+	code, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(code, wasmMagic) {
+		return "", fmt.Errorf("%s is not a wasm module", file)
+	}
+
+	imageDir := filepath.Join(dataDir, "images", nameValue)
+	metaPath := filepath.Join(imageDir, "meta.json")
+	if data, err := os.ReadFile(metaPath); err == nil {
+		var meta ImageMeta
+		if json.Unmarshal(data, &meta) != nil || meta.Type != wasm.ImageType {
+			return "", fmt.Errorf("image %s already exists and is not a wasm image", nameValue)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("read meta: %w", err)
+	}
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		return "", fmt.Errorf("create image dir: %w", err)
+	}
+
+	modulePath := filepath.Join(imageDir, wasm.ModuleFile)
+	tmp := modulePath + ".tmp"
+	if err := os.WriteFile(tmp, code, 0644); err != nil {
+		return "", fmt.Errorf("write module: %w", err)
+	}
+	if err := os.Rename(tmp, modulePath); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("write module: %w", err)
+	}
+
+	sum := sha256.Sum256(code)
+	hash := "sha256:" + hex.EncodeToString(sum[:])
+	meta := ImageMeta{
+		Name:      nameValue,
+		Hash:      hash,
+		CreatedAt: time.Now().UTC(),
+		Type:      wasm.ImageType,
+	}
+	if err := writeMeta(metaPath, meta); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// validateWasmImage checks that the module of a wasm image is present.
+// Compilation is left to the daemon's startup validation.
+func validateWasmImage(imageDir string) error {
+	f, err := os.Open(filepath.Join(imageDir, wasm.ModuleFile))
+	if err != nil {
+		return fmt.Errorf("module missing: %w", err)
+	}
+	defer f.Close()
+	magic := make([]byte, len(wasmMagic))
+	if _, err := f.Read(magic); err != nil || !bytes.Equal(magic, wasmMagic) {
+		return fmt.Errorf("%s is not a wasm module", wasm.ModuleFile)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+// Command langchaingo shows Sandkasten's create/exec/read/write operations as
+// tools for langchaingo agents. Each tool implements langchaingo's tools.Tool
+// interface (Name, Description, Call) with the standard library only, so each
+// can be handed to agents.NewOneShotAgent or agents.NewConversationalAgent:
+//
+//	sb := newSandbox(baseURL, apiKey, "python")
+//	defer sb.Close(ctx)
+//	var ts []tools.Tool
+//	for _, t := range sb.Tools() {
+//		ts = append(ts, t)
+//	}
+//	agent := agents.NewOneShotAgent(llm, ts)
+//
+// Run against a local daemon, main calls each tool directly:
+//
+//	SANDKASTEN_API_KEY=sk-sandbox-quickstart go run ./examples/langchaingo
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// tool matches langchaingo's tools.Tool.
+type tool interface {
+	Name() string
+	Description() string
+	Call(ctx context.Context, input string) (string, error)
+}
+
+// sandbox holds one session, created on first use and shared by all tools so
+// the shell keeps its cwd and environment between calls.
+type sandbox struct {
+	baseURL   string
+	apiKey    string
+	image     string
+	sessionID string
+}
+
+func newSandbox(baseURL, apiKey, image string) *sandbox {
+	return &sandbox{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, image: image}
+}
+
+// Tools returns sandbox_create_session, sandbox_exec, sandbox_read_file and
+// sandbox_write_file.
+func (s *sandbox) Tools() []tool {
+	return []tool{
+		funcTool{"sandbox_create_session", "Start a fresh sandbox, destroying the current one. Input: image name (e.g. python, node) or empty for the default.", s.create},
+		funcTool{"sandbox_exec", "Run a shell command in the sandbox. The shell is persistent: cd and environment variables carry over. Input: the command.", s.exec},
+		funcTool{"sandbox_read_file", "Read a text file from the sandbox. Input: the path, relative to /workspace or absolute.", s.readFile},
+		funcTool{"sandbox_write_file", `Write a text file in the sandbox. Input: JSON {"path": "...", "content": "..."}.`, s.writeFile},
+	}
+}
+
+type funcTool struct {
+	name, description string
+	call              func(ctx context.Context, input string) (string, error)
+}
+
+func (t funcTool) Name() string        { return t.name }
+func (t funcTool) Description() string { return t.description }
+func (t funcTool) Call(ctx context.Context, input string) (string, error) {
+	return t.call(ctx, input)
+}
+
+func (s *sandbox) create(ctx context.Context, image string) (string, error) {
+	if err := s.Close(ctx); err != nil {
+		return "", err
+	}
+	if image = strings.TrimSpace(image); image == "" {
+		image = s.image
+	}
+	var info struct {
+		ID string `json:"id"`
+	}
+	if err := s.do(ctx, "POST", "/v1/sessions", map[string]any{"image": image}, &info); err != nil {
+		return "", err
+	}
+	s.sessionID = info.ID
+	return "session_id=" + info.ID, nil
+}
+
+func (s *sandbox) session(ctx context.Context) (string, error) {
+	if s.sessionID == "" {
+		if _, err := s.create(ctx, ""); err != nil {
+			return "", err
+		}
+	}
+	return s.sessionID, nil
+}
+
+func (s *sandbox) exec(ctx context.Context, cmd string) (string, error) {
+	id, err := s.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		ExitCode int    `json:"exit_code"`
+		Cwd      string `json:"cwd"`
+		Output   string `json:"output"`
+	}
+	if err := s.do(ctx, "POST", "/v1/sessions/"+id+"/exec", map[string]any{"cmd": cmd}, &res); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("exit_code=%d\ncwd=%s\n---\n%s", res.ExitCode, res.Cwd, res.Output), nil
+}
+
+func (s *sandbox) readFile(ctx context.Context, path string) (string, error) {
+	id, err := s.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		ContentBase64 string `json:"content_base64"`
+		Truncated     bool   `json:"truncated"`
+	}
+	q := url.Values{"path": {strings.TrimSpace(path)}}
+	if err := s.do(ctx, "GET", "/v1/sessions/"+id+"/fs/read?"+q.Encode(), nil, &res); err != nil {
+		return "", err
+	}
+	content, err := base64.StdEncoding.DecodeString(res.ContentBase64)
+	if err != nil {
+		return "", err
+	}
+	if res.Truncated {
+		content = append(content, "\n(truncated)"...)
+	}
+	return string(content), nil
+}
+
+func (s *sandbox) writeFile(ctx context.Context, input string) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(input), &args); err != nil || args.Path == "" {
+		return "", fmt.Errorf(`input must be JSON {"path": "...", "content": "..."}`)
+	}
+	id, err := s.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := s.do(ctx, "POST", "/v1/sessions/"+id+"/fs/write", map[string]any{"path": args.Path, "text": args.Content}, nil); err != nil {
+		return "", err
+	}
+	return "wrote " + args.Path, nil
+}
+
+// Close destroys the current session, if any.
+func (s *sandbox) Close(ctx context.Context) error {
+	if s.sessionID == "" {
+		return nil
+	}
+	id := s.sessionID
+	s.sessionID = ""
+	return s.do(ctx, "DELETE", "/v1/sessions/"+id, nil, nil)
+}
+
+func (s *sandbox) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func main() {
+	baseURL := os.Getenv("SANDKASTEN_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	ctx := context.Background()
+	sb := newSandbox(baseURL, os.Getenv("SANDKASTEN_API_KEY"), "python")
+	defer func() {
+		if err := sb.Close(ctx); err != nil {
+			log.Printf("close: %v", err)
+		}
+	}()
+
+	tools := map[string]tool{}
+	for _, t := range sb.Tools() {
+		tools[t.Name()] = t
+	}
+	for _, step := range []struct{ tool, input string }{
+		{"sandbox_write_file", `{"path": "hello.py", "content": "print('hello from the sandbox')"}`},
+		{"sandbox_exec", "python3 hello.py"},
+		{"sandbox_read_file", "hello.py"},
+	} {
+		out, err := tools[step.tool].Call(ctx, step.input)
+		if err != nil {
+			log.Fatalf("%s: %v", step.tool, err)
+		}
+		fmt.Printf("> %s %s\n%s\n\n", step.tool, step.input, out)
+	}
+}
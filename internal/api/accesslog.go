@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounterVec("sandkasten_http_requests_total",
+		"API requests seen by the access log, by method and status code.", "method", "code")
+	httpDuration = metrics.Default.NewHistogramVec("sandkasten_http_request_duration_seconds",
+		"Latency of API requests seen by the access log.", nil, "method")
+	accessLogEntries = metrics.Default.NewCounterVec("sandkasten_access_log_entries_total",
+		"Requests written to the access log; the others were sampled out.")
+)
+
+// redactedValue replaces the values of redacted body fields.
+const redactedValue = "[REDACTED]"
+
+// accessLogMiddleware logs requests per http.access_log: method, path,
+// status, latency, bytes, key ID and session ID, and with bodies on their
+// redacted JSON bodies. It runs outside of auth so rejected requests are
+// logged too, and therefore derives the key ID from the bearer token itself.
+func (s *Server) accessLogMiddleware(next http.Handler) http.Handler {
+	cfg := s.cfg.HTTP.AccessLog
+	if !cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		in := &countingBody{ReadCloser: r.Body}
+		if cfg.Bodies && isJSON(r.Header.Get("Content-Type")) {
+			in.capture = cfg.MaxBodyBytes + 1
+		}
+		r.Body = in
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+		if cfg.Bodies {
+			rec.capture = cfg.MaxBodyBytes + 1
+		}
+		next.ServeHTTP(rec, r)
+
+		elapsed := time.Since(start)
+		method := metricMethod(r.Method)
+		httpRequests.Inc(method, strconv.Itoa(rec.status))
+		httpDuration.Observe(elapsed.Seconds(), method)
+		if rec.status < 400 && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+		accessLogEntries.Inc()
+
+		reqID, _ := r.Context().Value(requestIDKey).(string)
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", elapsed.Milliseconds(),
+			"bytes_in", in.n,
+			"bytes_out", rec.n,
+			"request_id", reqID,
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			attrs = append(attrs, "key_id", session.KeyID(token))
+		}
+		if id := sessionIDFromPath(r.URL.Path); id != "" {
+			attrs = append(attrs, "session_id", id)
+		}
+		if cfg.Bodies {
+			if in.capture > 0 && in.n > 0 {
+				attrs = append(attrs, "request_body", redactBody(in.buf.Bytes(), in.n, cfg.MaxBodyBytes, cfg.Redact))
+			}
+			if isJSON(rec.Header().Get("Content-Type")) && rec.n > 0 {
+				attrs = append(attrs, "response_body", redactBody(rec.buf.Bytes(), rec.n, cfg.MaxBodyBytes, cfg.Redact))
+			}
+		}
+		s.logger.Info("access", attrs...)
+	})
+}
+
+// countingBody counts the request body bytes the handler reads and keeps the
+// first capture of them.
+type countingBody struct {
+	io.ReadCloser
+	n       int64
+	capture int
+	buf     bytes.Buffer
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := b.capture - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// accessRecorder records the status and size of a response and keeps its
+// first capture bytes. Flush and Unwrap keep streaming exec and the port
+// proxy working through it.
+type accessRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	n           int64
+	capture     int
+	buf         bytes.Buffer
+}
+
+func (r *accessRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *accessRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.n += int64(n)
+	if room := r.capture - r.buf.Len(); room > 0 {
+		r.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (r *accessRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *accessRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// redactBody renders a captured JSON body for the log with the values of the
+// redact fields replaced. Bodies over limit are not logged at all, since a
+// cut-off body cannot be parsed and so not be redacted.
+func redactBody(data []byte, size int64, limit int, redact []string) string {
+	if size > int64(limit) {
+		return "[" + strconv.FormatInt(size, 10) + " bytes, over access_log.max_body_bytes]"
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "[invalid JSON]"
+	}
+	out, err := json.Marshal(redactValue(v, redact))
+	if err != nil {
+		return "[invalid JSON]"
+	}
+	return string(out)
+}
+
+func redactValue(v any, redact []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if containsFold(redact, k) {
+				v[k] = redactedValue
+			} else {
+				v[k] = redactValue(val, redact)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redactValue(val, redact)
+		}
+	}
+	return v
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSON(contentType string) bool {
+	return strings.Contains(contentType, "json")
+}
+
+// metricMethod bounds the method label to the methods the API serves.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// sessionIDFromPath returns the {id} of a /v{1,2}/sessions/{id}/... path, or "".
+func sessionIDFromPath(path string) string {
+	for _, prefix := range []string{"/v1/sessions/", "/v2/sessions/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			id, _, _ := strings.Cut(rest, "/")
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func accessLogServer(cfg config.AccessLogConfig) (*Server, *bytes.Buffer) {
+	var logs bytes.Buffer
+	c := &config.Config{}
+	c.HTTP.AccessLog = cfg
+	return &Server{cfg: c, logger: slog.New(slog.NewJSONHandler(&logs, nil))}, &logs
+}
+
+func accessEntries(t *testing.T, logs *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestAccessLog_Disabled(t *testing.T) {
+	s, logs := accessLogServer(config.AccessLogConfig{})
+	h := s.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/sessions", nil))
+	assert.Empty(t, logs.String())
+}
+
+func TestAccessLog_Entry(t *testing.T) {
+	s, logs := accessLogServer(config.AccessLogConfig{Enabled: true, SampleRate: 1})
+	h := s.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	before := accessLogEntries.Value()
+	req := httptest.NewRequest("POST", "/v1/sessions/abc123/exec?token=secret", strings.NewReader(`{"cmd":"ls"}`))
+	req.Header.Set("Authorization", "Bearer sk-test-key")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := accessEntries(t, logs)
+	require.Len(t, entries, 1)
+	e := entries[0]
+	assert.Equal(t, "access", e["msg"])
+	assert.Equal(t, "POST", e["method"])
+	assert.Equal(t, "/v1/sessions/abc123/exec", e["path"])
+	assert.EqualValues(t, 201, e["status"])
+	assert.EqualValues(t, 12, e["bytes_in"])
+	assert.EqualValues(t, 5, e["bytes_out"])
+	assert.Equal(t, session.KeyID("sk-test-key"), e["key_id"])
+	assert.Equal(t, "abc123", e["session_id"])
+	assert.NotContains(t, e, "request_body")
+	assert.Equal(t, before+1, accessLogEntries.Value())
+}
+
+func TestAccessLog_SamplingKeepsErrors(t *testing.T) {
+	s, logs := accessLogServer(config.AccessLogConfig{Enabled: true, SampleRate: 0})
+	status := http.StatusOK
+	h := s.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	before := httpRequests.Value("GET", "200")
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/sessions", nil))
+	assert.Empty(t, logs.String())
+	assert.Equal(t, before+1, httpRequests.Value("GET", "200"))
+
+	status = http.StatusNotFound
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/sessions/nope", nil))
+	entries := accessEntries(t, logs)
+	require.Len(t, entries, 1)
+	assert.EqualValues(t, 404, entries[0]["status"])
+}
+
+func TestAccessLog_RedactsBodies(t *testing.T) {
+	s, logs := accessLogServer(config.AccessLogConfig{
+		Enabled: true, SampleRate: 1, Bodies: true, MaxBodyBytes: 1024,
+		Redact: config.DefaultAccessLogRedact,
+	})
+	h := s.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"exit_code":0,"output":"top secret"}`))
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/sessions/abc/exec", strings.NewReader(`{"cmd":"ls","env":{"TOKEN":"x"},"files":[{"Password":"p"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := accessEntries(t, logs)
+	require.Len(t, entries, 1)
+	assert.JSONEq(t, `{"cmd":"ls","env":"[REDACTED]","files":[{"Password":"[REDACTED]"}]}`, entries[0]["request_body"].(string))
+	assert.JSONEq(t, `{"exit_code":0,"output":"[REDACTED]"}`, entries[0]["response_body"].(string))
+}
+
+func TestAccessLog_BodyOverLimit(t *testing.T) {
+	assert.Equal(t, "[20 bytes, over access_log.max_body_bytes]", redactBody([]byte(`{"a":`), 20, 4, nil))
+	assert.Equal(t, "[invalid JSON]", redactBody([]byte(`{"a":`), 5, 10, nil))
+}
+
+func TestAccessLog_KeepsFlusher(t *testing.T) {
+	s, _ := accessLogServer(config.AccessLogConfig{Enabled: true, SampleRate: 1})
+	h := s.accessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		rc := http.NewResponseController(w)
+		assert.NoError(t, rc.Flush())
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/sessions/abc/exec/stream", nil))
+}
+
+func TestSessionIDFromPath(t *testing.T) {
+	assert.Equal(t, "abc", sessionIDFromPath("/v1/sessions/abc"))
+	assert.Equal(t, "abc", sessionIDFromPath("/v2/sessions/abc/fs/read"))
+	assert.Equal(t, "", sessionIDFromPath("/v1/sessions"))
+	assert.Equal(t, "", sessionIDFromPath("/v1/pool/status"))
+}
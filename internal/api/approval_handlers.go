@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+func (s *Server) handleListApprovals(w http.ResponseWriter, r *http.Request) {
+	approvals, err := s.manager.ListApprovals(r.Context())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"approvals": approvals})
+}
+
+func (s *Server) handleGetApproval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := validateApprovalID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	a, err := s.manager.GetApproval(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	s.decideApproval(w, r, true)
+}
+
+func (s *Server) handleDeny(w http.ResponseWriter, r *http.Request) {
+	s.decideApproval(w, r, false)
+}
+
+// decideApproval requires the approver key so that the agent holding the
+// regular API key cannot approve its own requests.
+func (s *Server) decideApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !s.isApproverToken(token) {
+		writeUnauthorizedError(w, "approver key required")
+		return
+	}
+	id := r.PathValue("id")
+	if err := validateApprovalID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	a, err := s.manager.DecideApproval(r.Context(), id, approve)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	s.logger.Info("approval decided", "approval_id", id, "approved", approve, "kind", a.Kind, "session_id", a.SessionID)
+	writeJSON(w, http.StatusOK, a)
+}
+
+func validateApprovalID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return &validationError{message: "invalid approval id"}
+	}
+	return nil
+}
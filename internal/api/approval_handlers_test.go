@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testApprovalID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+func TestHandleApprove_RequiresApproverKey(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.Approval.ApproverKey = "approver"
+
+	req := httptest.NewRequest("POST", "/v1/approvals/"+testApprovalID+"/approve", nil)
+	req.SetPathValue("id", testApprovalID)
+	req.Header.Set("Authorization", "Bearer not-the-approver")
+	rec := httptest.NewRecorder()
+
+	s.handleApprove(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	mockMgr.AssertNotCalled(t, "DecideApproval", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleApprove_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.Approval.ApproverKey = "approver"
+
+	mockMgr.On("DecideApproval", mock.Anything, testApprovalID, true).Return(&session.Approval{
+		ID: testApprovalID, Kind: session.ApprovalKindExec, Status: session.ApprovalRunning,
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/approvals/"+testApprovalID+"/approve", nil)
+	req.SetPathValue("id", testApprovalID)
+	req.Header.Set("Authorization", "Bearer approver")
+	rec := httptest.NewRecorder()
+
+	s.handleApprove(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleDeny_AlreadyDecided(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.Approval.ApproverKey = "approver"
+
+	mockMgr.On("DecideApproval", mock.Anything, testApprovalID, false).
+		Return(nil, fmt.Errorf("%w: %s", session.ErrApprovalDecided, testApprovalID))
+
+	req := httptest.NewRequest("POST", "/v1/approvals/"+testApprovalID+"/deny", nil)
+	req.SetPathValue("id", testApprovalID)
+	req.Header.Set("Authorization", "Bearer approver")
+	rec := httptest.NewRecorder()
+
+	s.handleDeny(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestHandleExec_PendingApproval(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Exec", mock.Anything, "abcdef12-345", "pip install x", session.ExecOpts{}).
+		Return(nil, &session.PendingApprovalError{Approval: session.Approval{ID: testApprovalID, Status: session.ApprovalPending}})
+
+	req := httptest.NewRequest("POST", "/v1/sessions/abcdef12-345/exec", strings.NewReader(`{"cmd":"pip install x"}`))
+	req.SetPathValue("id", "abcdef12-345")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), testApprovalID)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+	"golang.org/x/net/websocket"
+)
+
+// maxAttachMessageBytes bounds a WebSocket message from an attached client;
+// keystrokes and pastes are far smaller.
+const maxAttachMessageBytes = 1 << 20
+
+// attachControl is a text message of an attach WebSocket: a resize from the
+// client, or the exit of the shell from the daemon.
+type attachControl struct {
+	Type     string `json:"type"` // resize | exit
+	Rows     int    `json:"rows,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// handleAttach upgrades to a WebSocket relaying an interactive shell started
+// in the session on a terminal of its own. Binary messages carry the
+// terminal's bytes both ways; text messages are JSON controls (see
+// attachControl). The daemon closes the WebSocket after the exit message;
+// a client closing it hangs up the shell.
+func (s *Server) handleAttach(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	q := r.URL.Query()
+	opts := runtime.AttachOpts{Shell: q.Get("shell")}
+	if _, ok := protocol.Shells[opts.Shell]; opts.Shell != "" && !ok {
+		writeValidationError(w, "unknown shell", map[string]interface{}{"shell": opts.Shell})
+		return
+	}
+	for name, dst := range map[string]*int{"rows": &opts.Rows, "cols": &opts.Cols} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				writeValidationError(w, name+" must be a number", nil)
+				return
+			}
+			*dst = n
+		}
+	}
+	if err := validateTerminalSize(opts.Rows, opts.Cols); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		writeValidationError(w, "attach needs a WebSocket upgrade", nil)
+		return
+	}
+	// Browsers send the dashboard cookie with WebSockets from any site, so
+	// only the daemon's own pages and listed CORS origins may attach.
+	if !s.attachOriginAllowed(r) {
+		writeForbiddenError(w, "origin not allowed")
+		return
+	}
+
+	term, err := s.manager.Attach(r.Context(), id, opts)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer term.Close()
+	s.logger.Debug("attach", "session_id", id, "shell", opts.Shell)
+
+	// Handshake nil accepts every origin; it was checked above.
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = maxAttachMessageBytes
+		relayTerminal(ws, term)
+	}}.ServeHTTP(hijacker{w}, r)
+}
+
+// attachOriginAllowed reports whether r comes from a non-browser client, the
+// daemon's own origin or an origin listed in cors.allowed_origins ("*"
+// does not count).
+func (s *Server) attachOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range s.cfg.CORS.AllowedOrigins {
+		if o != "*" && strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayTerminal copies between ws and term until the shell exits or the
+// client goes away.
+func relayTerminal(ws *websocket.Conn, term runtime.Terminal) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg attachMessage
+			if err := attachCodec.Receive(ws, &msg); err != nil {
+				// Unblocks the copy below if the shell is still running.
+				term.Close()
+				return
+			}
+			if !msg.text {
+				if _, err := term.Write(msg.data); err != nil {
+					return
+				}
+				continue
+			}
+			var ctl attachControl
+			if json.Unmarshal(msg.data, &ctl) == nil && ctl.Type == "resize" &&
+				validateTerminalSize(ctl.Rows, ctl.Cols) == nil {
+				term.Resize(ctl.Rows, ctl.Cols)
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := term.Read(buf)
+		if n > 0 {
+			if websocket.Message.Send(ws, buf[:n]) != nil {
+				break
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			websocket.JSON.Send(ws, attachControl{Type: "exit", ExitCode: term.ExitCode()})
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	ws.Close()
+	<-done
+}
+
+// attachMessage is a WebSocket message and whether it was sent as text.
+type attachMessage struct {
+	data []byte
+	text bool
+}
+
+// attachCodec receives messages keeping their frame type, which
+// websocket.Message does not report.
+var attachCodec = websocket.Codec{
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		*v.(*attachMessage) = attachMessage{data: data, text: payloadType == websocket.TextFrame}
+		return nil
+	},
+}
+
+// hijacker gives the WebSocket server, which type-asserts http.Hijacker, the
+// connection under the middlewares' response writers. The server's read and
+// write timeouts would otherwise end long terminal sessions.
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(h.ResponseWriter).Hijack()
+	if err == nil {
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, rw, err
+}
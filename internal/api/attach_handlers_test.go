@@ -0,0 +1,116 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// echoTerminal echoes input as output and exits with the number of rows of
+// the first resize.
+type echoTerminal struct {
+	r    *io.PipeReader
+	w    *io.PipeWriter
+	code int
+}
+
+func newEchoTerminal() *echoTerminal {
+	r, w := io.Pipe()
+	return &echoTerminal{r: r, w: w}
+}
+
+func (t *echoTerminal) Read(p []byte) (int, error)  { return t.r.Read(p) }
+func (t *echoTerminal) Write(p []byte) (int, error) { return t.w.Write(p) }
+func (t *echoTerminal) ExitCode() int               { return t.code }
+func (t *echoTerminal) Close() error                { return t.r.Close() }
+func (t *echoTerminal) Resize(rows, cols int) error {
+	t.code = rows
+	return t.w.Close()
+}
+
+func attachTestServer(mgr SessionService) *httptest.Server {
+	s := testAPIServer(mgr)
+	s.cfg.HTTP.AccessLog.Enabled = true
+	s.cfg.HTTP.Compression.Enabled = true
+	s.mux.HandleFunc("GET /v1/sessions/{id}/attach", s.handleAttach)
+	return httptest.NewServer(s.accessLogMiddleware(s.compressMiddleware(s.mux)))
+}
+
+func dialAttach(t *testing.T, srv *httptest.Server, query, origin string) (*websocket.Conn, error) {
+	t.Helper()
+	cfg, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/sessions/a1b2c3d4-e5f/attach"+query, origin)
+	require.NoError(t, err)
+	cfg.Header.Set("Accept-Encoding", "gzip")
+	return websocket.DialConfig(cfg)
+}
+
+func TestHandleAttach(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	srv := attachTestServer(mockMgr)
+	defer srv.Close()
+	term := newEchoTerminal()
+	mockMgr.On("Attach", mock.Anything, "a1b2c3d4-e5f", runtime.AttachOpts{Shell: "python", Rows: 30, Cols: 100}).Return(term, nil)
+
+	ws, err := dialAttach(t, srv, "?shell=python&rows=30&cols=100", srv.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	require.NoError(t, websocket.Message.Send(ws, []byte("print(1)\r")))
+	var out []byte
+	require.NoError(t, websocket.Message.Receive(ws, &out))
+	assert.Equal(t, "print(1)\r", string(out))
+
+	require.NoError(t, websocket.JSON.Send(ws, attachControl{Type: "resize", Rows: 3, Cols: 80}))
+	var exit attachControl
+	require.NoError(t, websocket.JSON.Receive(ws, &exit))
+	assert.Equal(t, attachControl{Type: "exit", ExitCode: 3}, exit)
+	assert.ErrorIs(t, websocket.Message.Receive(ws, &out), io.EOF, "closed after the exit")
+}
+
+func TestHandleAttach_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		origin     string
+		err        error
+		wantStatus int
+	}{
+		{name: "unknown shell", query: "?shell=zsh", wantStatus: http.StatusBadRequest},
+		{name: "rows too large", query: "?rows=2000", wantStatus: http.StatusBadRequest},
+		{name: "foreign origin", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "unsupported", err: session.ErrAttachUnsupported, wantStatus: http.StatusNotImplemented},
+		{name: "policy", err: session.ErrPolicyDenied, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMgr := &MockSessionService{}
+			srv := attachTestServer(mockMgr)
+			defer srv.Close()
+			if tt.err != nil {
+				mockMgr.On("Attach", mock.Anything, "a1b2c3d4-e5f", mock.Anything).Return(nil, tt.err)
+			}
+			origin := tt.origin
+			if origin == "" {
+				origin = srv.URL
+			}
+
+			req, _ := http.NewRequest("GET", srv.URL+"/v1/sessions/a1b2c3d4-e5f/attach"+tt.query, nil)
+			req.Header.Set("Upgrade", "websocket")
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Origin", origin)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
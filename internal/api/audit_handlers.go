@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const maxAuditListLimit = 1000
+
+func (s *Server) handleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID != "" {
+		if err := ValidateSessionID(sessionID); err != nil {
+			writeValidationError(w, err.Error(), nil)
+			return
+		}
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditListLimit {
+			writeValidationError(w, "limit must be between 1 and 1000", map[string]interface{}{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+
+	events, err := s.manager.ListAuditEvents(r.Context(), sessionID, limit)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
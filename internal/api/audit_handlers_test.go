@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleListAuditEvents_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ListAuditEvents", mock.Anything, "abcdef12-345", 5).Return([]*store.AuditEvent{
+		{ID: 1, SessionID: "abcdef12-345", Action: "exec_denied"},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/audit?session_id=abcdef12-345&limit=5", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleListAuditEvents(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Len(t, result["events"].([]any), 1)
+}
+
+func TestHandleListAuditEvents_InvalidLimit(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	req := httptest.NewRequest("GET", "/v1/audit?limit=0", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleListAuditEvents(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockMgr.AssertNotCalled(t, "ListAuditEvents", mock.Anything, mock.Anything, mock.Anything)
+}
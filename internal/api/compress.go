@@ -0,0 +1,216 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings the API compresses responses with, in order of preference.
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+// compressMiddleware compresses responses per http.compression with the
+// coding the client prefers in Accept-Encoding. It runs inside the access
+// log, which therefore sees and redacts the uncompressed bodies.
+func (s *Server) compressMiddleware(next http.Handler) http.Handler {
+	cfg := s.cfg.HTTP.Compression
+	if !cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Upgraded connections, e.g. an attached terminal, are not HTTP
+		// responses.
+		if r.Method == http.MethodHead || isProxyPath(r.URL.Path) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: cfg.MinBytes, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks zstd or gzip from an Accept-Encoding header, by
+// q-value and then by preference; "" = send the response as is.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	wildcard := -1.0
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			weight = f
+		}
+		if name == "*" {
+			wildcard = weight
+			continue
+		}
+		q[name] = weight
+	}
+	for _, name := range []string{encodingZstd, encodingGzip} {
+		weight, ok := q[name]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = name, weight
+		}
+	}
+	return best
+}
+
+// isCompressible reports whether responses of contentType are worth
+// compressing. SSE streams are excluded so every event reaches the client
+// when it is flushed.
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript",
+		mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// encoder is a compressing writer that can push out what it buffered.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter holds back the first minBytes of a response to decide
+// whether to compress it: small bodies, bodies already encoded and types
+// that do not compress are written through unchanged. Flush decides early,
+// so streamed responses are never held back.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+
+	status  int
+	decided bool
+	buf     []byte
+	enc     encoder // nil = uncompressed
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minBytes {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the header and the held-back bytes, compressing when large
+// is set and the response qualifies.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+	if large && h.Get("Content-Encoding") == "" && w.status != http.StatusPartialContent &&
+		isCompressible(h.Get("Content-Type")) {
+		w.enc = newEncoder(w.encoding, w.ResponseWriter)
+	}
+	if w.enc != nil {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.minBytes)
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the response: a body still held back is under minBytes and
+// goes out uncompressed.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
+
+// newEncoder returns an encoder for encoding writing to w, or nil if it
+// cannot be set up.
+func newEncoder(encoding string, w io.Writer) encoder {
+	if encoding == encodingZstd {
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil
+		}
+		return zw
+	}
+	return gzip.NewWriter(w)
+}
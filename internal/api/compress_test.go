@@ -0,0 +1,125 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressServer() *Server {
+	c := &config.Config{}
+	c.HTTP.Compression = config.CompressionConfig{Enabled: true, MinBytes: 64}
+	return &Server{cfg: c}
+}
+
+func serveCompressed(t *testing.T, h http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "zstd", negotiateEncoding("gzip, zstd"))
+	assert.Equal(t, "gzip", negotiateEncoding("zstd;q=0.5, gzip"))
+	assert.Equal(t, "gzip", negotiateEncoding("zstd;q=0, *"))
+	assert.Equal(t, "", negotiateEncoding("identity, gzip;q=0"))
+	assert.Equal(t, "zstd", negotiateEncoding("*"))
+}
+
+func TestCompressMiddleware_JSON(t *testing.T) {
+	body := `{"output":"` + strings.Repeat("line of build output\n", 100) + `"}`
+	h := compressServer().compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	}))
+
+	rec := serveCompressed(t, h, "/v1/sessions/abc/exec", "gzip")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Less(t, rec.Body.Len(), len(body))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	got, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+
+	rec = serveCompressed(t, h, "/v1/sessions/abc/exec", "zstd")
+	assert.Equal(t, "zstd", rec.Header().Get("Content-Encoding"))
+	zd, err := zstd.NewReader(rec.Body)
+	require.NoError(t, err)
+	defer zd.Close()
+	got, err = io.ReadAll(zd)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(got))
+
+	rec = serveCompressed(t, h, "/v1/sessions/abc/exec", "")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, rec.Body.String())
+}
+
+func TestCompressMiddleware_SentAsIs(t *testing.T) {
+	large := strings.Repeat("a", 1024)
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{"small body", "/v1/sessions/abc", "application/json", `{"id":"abc"}`},
+		{"binary download", "/v1/sessions/abc/fs/download", "application/octet-stream", large},
+		{"port proxy", "/v1/sessions/abc/proxy/8080/", "text/html", large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := compressServer().compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			rec := serveCompressed(t, h, tt.path, "gzip")
+			assert.Empty(t, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.body, rec.Body.String())
+		})
+	}
+}
+
+func TestCompressMiddleware_StreamNotHeldBack(t *testing.T) {
+	h := compressServer().compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: "+strings.Repeat("x", 1024)+"\n\n")
+	}))
+	rec := serveCompressed(t, h, "/v1/sessions/abc/exec/stream", "gzip")
+	assert.True(t, rec.Flushed)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "data: 1\n\n"))
+}
+
+func TestCompressMiddleware_Disabled(t *testing.T) {
+	s := compressServer()
+	s.cfg.HTTP.Compression.Enabled = false
+	h := s.compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, strings.Repeat(" ", 1024))
+	}))
+	rec := serveCompressed(t, h, "/v1/sessions", "gzip")
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("Vary"))
+}
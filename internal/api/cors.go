@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCORSHeaders are the request headers browsers may send when
+// cors.allowed_headers is empty.
+var defaultCORSHeaders = []string{"Authorization", "Content-Type", "Accept", "X-Request-ID"}
+
+// corsMethods are the methods the API routes use.
+const corsMethods = "GET, POST, PUT, PATCH, DELETE"
+
+// corsMiddleware answers preflight requests and adds CORS headers to API
+// responses for allowed origins. It runs before auth: preflights carry no
+// credentials. Other origins get no CORS headers, so browsers keep them to
+// same-origin access.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || pathAPIVersion(r.URL.Path) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowOrigin, ok := s.corsAllowOrigin(origin)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", allowOrigin)
+		if s.cfg.CORS.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			headers := s.cfg.CORS.AllowedHeaders
+			if len(headers) == 0 {
+				headers = defaultCORSHeaders
+			}
+			maxAge := s.cfg.CORS.MaxAgeSeconds
+			if maxAge <= 0 {
+				maxAge = 600
+			}
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", corsMethods)
+			h.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", "X-Request-ID, "+APIVersionHeader+", "+ExpiresInHeader)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowOrigin returns the Access-Control-Allow-Origin value for origin,
+// or false if origin is not allowed.
+func (s *Server) corsAllowOrigin(origin string) (string, bool) {
+	for _, o := range s.cfg.CORS.AllowedOrigins {
+		if o == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func corsTestServer(mgr SessionService, cors config.CORSConfig) http.Handler {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewServer(&config.Config{APIKey: "sk-test", CORS: cors}, mgr, nil, "", logger).Handler()
+}
+
+func preflight(h http.Handler, path, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("OPTIONS", path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORS_SameOriginOnlyByDefault(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	mockMgr.On("List", mock.Anything).Return([]session.SessionInfo{}, nil)
+	h := corsTestServer(mockMgr, config.CORSConfig{})
+
+	rec := preflight(h, "/v1/sessions", "https://app.example.com")
+	assert.NotEqual(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	req := httptest.NewRequest("GET", "/v1/sessions", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Authorization", "Bearer sk-test")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	mockMgr.On("List", mock.Anything).Return([]session.SessionInfo{}, nil)
+	h := corsTestServer(mockMgr, config.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+	})
+
+	rec := preflight(h, "/v1/sessions", "https://app.example.com")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Methods"), "POST")
+	assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	req := httptest.NewRequest("GET", "/v2/sessions", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Authorization", "Bearer sk-test")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), APIVersionHeader)
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	// Other origins and non-API paths are left alone.
+	rec = preflight(h, "/v1/sessions", "https://evil.example.com")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	rec = preflight(h, "/metrics", "https://app.example.com")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORS_Wildcard(t *testing.T) {
+	h := corsTestServer(&MockSessionService{}, config.CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"Authorization"},
+		MaxAgeSeconds:  60,
+	})
+
+	rec := preflight(h, "/v1/sessions", "https://anywhere.example")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "60", rec.Header().Get("Access-Control-Max-Age"))
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/subtle"
 	"embed"
 	"encoding/json"
 	"html/template"
@@ -23,13 +24,23 @@ type dashboardPage struct {
 	DefaultImg string
 	Flash      string
 	FlashErr   string
+	SSO        bool   // single sign-on is configured
+	User       string // signed-in dashboard user
+	Role       string
+	CSRFToken  string
 }
 
 type playgroundPage struct {
-	Title    string
-	Session  session.SessionInfo
-	Flash    string
-	FlashErr string
+	Title     string
+	Session   session.SessionInfo
+	Flash     string
+	FlashErr  string
+	CSRFToken string
+}
+
+type recordingPage struct {
+	Title     string
+	Recording session.Recording
 }
 
 func (s *Server) parseDashboardTemplates() (*template.Template, error) {
@@ -73,6 +84,11 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		DefaultImg: s.cfg.DefaultImage,
 		Flash:      r.URL.Query().Get("flash"),
 		FlashErr:   r.URL.Query().Get("flash_err"),
+		SSO:        s.oidc != nil,
+		CSRFToken:  s.csrfTokenFor(r),
+	}
+	if u, _ := s.dashboardUserFromRequest(r); u != nil {
+		page.User, page.Role = u.Name, u.Role
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -103,10 +119,11 @@ func (s *Server) handlePlayground(w http.ResponseWriter, r *http.Request) {
 	}
 
 	page := playgroundPage{
-		Title:   "Playground · " + id[:8],
-		Session: *info,
-		Flash:   r.URL.Query().Get("flash"),
-		FlashErr: r.URL.Query().Get("flash_err"),
+		Title:     "Playground · " + id[:8],
+		Session:   *info,
+		Flash:     r.URL.Query().Get("flash"),
+		FlashErr:  r.URL.Query().Get("flash_err"),
+		CSRFToken: s.csrfTokenFor(r),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -115,6 +132,38 @@ func (s *Server) handlePlayground(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) handleDashboardRecording(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec, err := s.manager.GetRecording(r.Context(), id)
+	if err != nil {
+		s.logger.Error("get recording for dashboard", "session_id", id, "error", err)
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl, err := s.parseDashboardTemplates()
+	if err != nil {
+		s.logger.Error("parse dashboard templates", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page := recordingPage{
+		Title:     "Recording · " + id[:8],
+		Recording: *rec,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "recording.html", page); err != nil {
+		s.logger.Error("execute recording template", "error", err)
+	}
+}
+
 func (s *Server) handleDashboardCreateSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -236,17 +285,22 @@ func (s *Server) handleDashboardLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	apiKey := r.FormValue("api_key")
-	if apiKey != s.cfg.APIKey {
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(s.cfg.APIKey)) != 1 {
 		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Invalid API key"), http.StatusSeeOther)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     dashboardCookieName,
-		Value:    s.cfg.APIKey,
-		Path:     "/",
-		MaxAge:   86400 * 7,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.signIn(w, r, s.apiKeyUser())
 	http.Redirect(w, r, "/dashboard?flash=Logged in", http.StatusSeeOther)
 }
+
+func (s *Server) handleDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	if _, id := s.dashboardUserFromRequest(r); id != "" {
+		if !s.hasValidCSRF(r, id) {
+			http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		s.dash.remove(id)
+	}
+	s.setDashboardCookie(w, r, "", -1)
+	http.Redirect(w, r, "/dashboard?flash=Signed out", http.StatusSeeOther)
+}
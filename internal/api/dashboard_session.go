@@ -0,0 +1,212 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/oidc"
+)
+
+// CSRF tokens travel in a hidden form field or, for fetch calls, a header.
+const (
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// defaultDashboardSessionHours is the lifetime of an API key login.
+const defaultDashboardSessionHours = 24 * 7
+
+// dashboardUser is a signed-in dashboard session, from the API key or OIDC.
+type dashboardUser struct {
+	Subject   string
+	Name      string
+	Role      string
+	ExpiresAt time.Time
+}
+
+// ssoLogin is an authorization request waiting for the provider's callback.
+type ssoLogin struct {
+	Nonce     string
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// dashboardSessions keeps dashboard logins in memory; the cookie only holds
+// a random session ID, and a daemon restart signs everyone out. CSRF tokens
+// are an HMAC of the session ID under a per-process secret.
+type dashboardSessions struct {
+	secret []byte
+
+	mu     sync.Mutex
+	users  map[string]*dashboardUser // session ID -> user
+	logins map[string]*ssoLogin      // OIDC state -> pending login
+}
+
+func newDashboardSessions() *dashboardSessions {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return &dashboardSessions{
+		secret: secret,
+		users:  map[string]*dashboardUser{},
+		logins: map[string]*ssoLogin{},
+	}
+}
+
+func (st *dashboardSessions) pruneLocked(now time.Time) {
+	for k, u := range st.users {
+		if now.After(u.ExpiresAt) {
+			delete(st.users, k)
+		}
+	}
+	for k, l := range st.logins {
+		if now.After(l.ExpiresAt) {
+			delete(st.logins, k)
+		}
+	}
+}
+
+func (st *dashboardSessions) startLogin(state string, l *ssoLogin) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(time.Now())
+	st.logins[state] = l
+}
+
+// finishLogin returns and forgets the pending login for state.
+func (st *dashboardSessions) finishLogin(state string) *ssoLogin {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(time.Now())
+	l := st.logins[state]
+	delete(st.logins, state)
+	return l
+}
+
+// create stores u under a new session ID and returns the ID.
+func (st *dashboardSessions) create(u *dashboardUser) string {
+	id := oidc.RandomString()
+	st.add(id, u)
+	return id
+}
+
+func (st *dashboardSessions) add(id string, u *dashboardUser) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(time.Now())
+	st.users[id] = u
+}
+
+func (st *dashboardSessions) user(id string) *dashboardUser {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	u := st.users[id]
+	if u == nil || time.Now().After(u.ExpiresAt) {
+		delete(st.users, id)
+		return nil
+	}
+	return u
+}
+
+func (st *dashboardSessions) remove(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.users, id)
+}
+
+// csrfToken returns the CSRF token bound to session id.
+func (st *dashboardSessions) csrfToken(id string) string {
+	mac := hmac.New(sha256.New, st.secret)
+	mac.Write([]byte("csrf:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (st *dashboardSessions) validCSRF(id, token string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(st.csrfToken(id)))
+}
+
+// dashboardUserFromRequest returns the dashboard login the request's cookie
+// belongs to, and its session ID.
+func (s *Server) dashboardUserFromRequest(r *http.Request) (*dashboardUser, string) {
+	if s.dash == nil {
+		return nil, ""
+	}
+	c, err := r.Cookie(dashboardCookieName)
+	if err != nil || c.Value == "" {
+		return nil, ""
+	}
+	u := s.dash.user(c.Value)
+	if u == nil {
+		return nil, ""
+	}
+	return u, c.Value
+}
+
+// csrfTokenFor returns the CSRF token for the request's dashboard login, or
+// "" when there is none.
+func (s *Server) csrfTokenFor(r *http.Request) string {
+	if _, id := s.dashboardUserFromRequest(r); id != "" {
+		return s.dash.csrfToken(id)
+	}
+	return ""
+}
+
+// hasValidCSRF reports whether r carries the CSRF token of session id. Only
+// url-encoded form bodies are parsed, so multipart and JSON bodies are left
+// for the handler.
+func (s *Server) hasValidCSRF(r *http.Request, id string) bool {
+	token := r.Header.Get(csrfHeaderName)
+	if token == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		token = r.PostFormValue(csrfFieldName)
+	}
+	return s.dash.validCSRF(id, token)
+}
+
+// signIn starts a dashboard session for u and sets its cookie.
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request, u *dashboardUser) {
+	id := s.dash.create(u)
+	s.setDashboardCookie(w, r, id, int(time.Until(u.ExpiresAt).Seconds()))
+}
+
+// setDashboardCookie writes the login cookie; maxAge < 0 deletes it.
+func (s *Server) setDashboardCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     dashboardCookieName,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.cfg.Dashboard.CookieDomain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.cfg.Dashboard.CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// apiKeyLoginHours is the lifetime of a dashboard login made with the API key.
+func (s *Server) apiKeyLoginHours() int {
+	if h := s.cfg.Dashboard.SessionHours; h > 0 {
+		return h
+	}
+	return defaultDashboardSessionHours
+}
+
+// apiKeyUser is the dashboard user for a login with the main API key.
+func (s *Server) apiKeyUser() *dashboardUser {
+	return &dashboardUser{
+		Subject:   "api-key",
+		Name:      "API key",
+		Role:      RoleAdmin,
+		ExpiresAt: time.Now().Add(time.Duration(s.apiKeyLoginHours()) * time.Hour),
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
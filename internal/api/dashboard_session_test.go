@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dashboardTestServer() *Server {
+	s := testAPIServer(&MockSessionService{})
+	s.cfg.APIKey = "sk-test-key"
+	s.dash = newDashboardSessions()
+	return s
+}
+
+// loginCookie logs in with the API key and returns the session cookie.
+func loginCookie(t *testing.T, s *Server) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/dashboard/login", strings.NewReader("api_key=sk-test-key"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.handleDashboardLogin(rec, req)
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == dashboardCookieName {
+			return c
+		}
+	}
+	t.Fatal("no dashboard cookie set")
+	return nil
+}
+
+func TestDashboardLogin_CookieHoldsSessionID(t *testing.T) {
+	s := dashboardTestServer()
+	c := loginCookie(t, s)
+
+	assert.NotEqual(t, "sk-test-key", c.Value)
+	assert.True(t, c.HttpOnly)
+	u, id := s.dashboardUserFromRequest(withCookie(httptest.NewRequest("GET", "/dashboard", nil), c))
+	require.NotNil(t, u)
+	assert.Equal(t, RoleAdmin, u.Role)
+	assert.Equal(t, c.Value, id)
+}
+
+func TestDashboardLogin_CookieSettingsFromConfig(t *testing.T) {
+	s := dashboardTestServer()
+	s.cfg.Dashboard.CookieSecure = true
+	s.cfg.Dashboard.CookieDomain = "sandkasten.example"
+	c := loginCookie(t, s)
+
+	assert.True(t, c.Secure)
+	assert.Equal(t, "sandkasten.example", c.Domain)
+}
+
+func TestAuthMiddleware_DashboardCSRF(t *testing.T) {
+	s := dashboardTestServer()
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	c := loginCookie(t, s)
+	token := s.dash.csrfToken(c.Value)
+
+	post := func(form url.Values, header string) int {
+		req := httptest.NewRequest("POST", "/dashboard/sessions", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set(csrfHeaderName, header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, withCookie(req, c))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, post(url.Values{"image": {"python"}}, ""))
+	assert.Equal(t, http.StatusForbidden, post(url.Values{csrfFieldName: {"forged"}}, ""))
+	assert.Equal(t, http.StatusForbidden, post(url.Values{csrfFieldName: {s.dash.csrfToken("other-session")}}, ""))
+	assert.Equal(t, http.StatusOK, post(url.Values{csrfFieldName: {token}}, ""))
+	assert.Equal(t, http.StatusOK, post(nil, token))
+
+	// Reads need no token.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, withCookie(httptest.NewRequest("GET", "/dashboard", nil), c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The port proxy serves sandbox content on this origin and never
+	// accepts the cookie, even with a valid token.
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/v1/sessions/a1b2c3d4-e5f/proxy/5173/api", nil)
+		req.Header.Set(csrfHeaderName, token)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, withCookie(req, c))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, method)
+	}
+
+	// Bearer clients are not subject to CSRF checks.
+	req := httptest.NewRequest("POST", "/v1/sessions", nil)
+	req.Header.Set("Authorization", "Bearer sk-test-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuthMiddleware_RawAPIKeyCookieRejected(t *testing.T) {
+	s := dashboardTestServer()
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: dashboardCookieName, Value: "sk-test-key"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthMiddleware_QueryLoginStartsSession(t *testing.T) {
+	s := dashboardTestServer()
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/dashboard?api_key=sk-test-key&x=1", nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/dashboard?x=1", rec.Header().Get("Location"))
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.NotEqual(t, "sk-test-key", cookies[0].Value)
+	u, _ := s.dashboardUserFromRequest(withCookie(httptest.NewRequest("GET", "/dashboard", nil), cookies[0]))
+	assert.NotNil(t, u)
+}
+
+func TestDashboardLogout(t *testing.T) {
+	s := dashboardTestServer()
+	c := loginCookie(t, s)
+
+	// A cross-site logout without the token is refused.
+	rec := httptest.NewRecorder()
+	s.handleDashboardLogout(rec, withCookie(httptest.NewRequest("POST", "/dashboard/logout", nil), c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest("POST", "/dashboard/logout", strings.NewReader(csrfFieldName+"="+s.dash.csrfToken(c.Value)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.handleDashboardLogout(rec, withCookie(req, c))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+
+	u, _ := s.dashboardUserFromRequest(withCookie(httptest.NewRequest("GET", "/dashboard", nil), c))
+	assert.Nil(t, u)
+}
+
+func withCookie(r *http.Request, c *http.Cookie) *http.Request {
+	r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	return r
+}
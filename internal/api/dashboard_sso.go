@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/oidc"
+)
+
+// ssoLoginTimeout bounds how long a user may take at the identity provider.
+const ssoLoginTimeout = 10 * time.Minute
+
+// Dashboard roles granted through OIDC group mapping.
+const (
+	RoleViewer   = "viewer"   // read-only
+	RoleOperator = "operator" // viewer + create, exec in and destroy sessions
+	RoleAdmin    = "admin"    // everything the API key can do
+)
+
+// SetOIDCProvider enables dashboard single sign-on.
+func (s *Server) SetOIDCProvider(p *oidc.Provider) {
+	s.oidc = p
+}
+
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	state, login := oidc.RandomString(), &ssoLogin{
+		Nonce:     oidc.RandomString(),
+		Verifier:  oidc.RandomString(),
+		ExpiresAt: time.Now().Add(ssoLoginTimeout),
+	}
+	authURL, err := s.oidc.AuthCodeURL(r.Context(), state, login.Nonce, login.Verifier)
+	if err != nil {
+		s.logger.Error("oidc login", "error", err)
+		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Single sign-on is unavailable"), http.StatusSeeOther)
+		return
+	}
+	s.dash.startLogin(state, login)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Sign-in failed: "+e), http.StatusSeeOther)
+		return
+	}
+	login := s.dash.finishLogin(q.Get("state"))
+	if login == nil {
+		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Sign-in expired, please try again"), http.StatusSeeOther)
+		return
+	}
+	claims, err := s.oidc.Exchange(r.Context(), q.Get("code"), login.Nonce, login.Verifier)
+	if err != nil {
+		s.logger.Error("oidc callback", "error", err)
+		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Sign-in failed"), http.StatusSeeOther)
+		return
+	}
+	role := s.oidc.Role(claims.Groups)
+	if role == "" {
+		s.logger.Warn("oidc login without dashboard role", "subject", claims.Subject, "groups", claims.Groups)
+		http.Redirect(w, r, "/dashboard?flash_err="+encodeQuery("Your account has no dashboard role"), http.StatusSeeOther)
+		return
+	}
+
+	name := claims.Email
+	if name == "" {
+		name = claims.Subject
+	}
+	hours := s.cfg.Dashboard.OIDC.SessionHours
+	if hours <= 0 {
+		hours = 8
+	}
+	s.signIn(w, r, &dashboardUser{
+		Subject:   claims.Subject,
+		Name:      name,
+		Role:      role,
+		ExpiresAt: time.Now().Add(time.Duration(hours) * time.Hour),
+	})
+	s.logger.Info("oidc login", "subject", claims.Subject, "role", role)
+	http.Redirect(w, r, "/dashboard?flash="+encodeQuery("Signed in as "+name), http.StatusSeeOther)
+}
+
+// roleAllows reports whether a dashboard user with role may make the request.
+// Viewers only read; operators may also change sessions and attach
+// terminals, which is a GET; admins may do anything.
+func roleAllows(role, method, path string) bool {
+	if role == RoleAdmin || path == "/dashboard/logout" {
+		return true
+	}
+	if isAdminPath(path) {
+		return false
+	}
+	if (method == http.MethodGet || method == http.MethodHead) && !isAttachPath(path) {
+		return true
+	}
+	return role == RoleOperator && isSessionPath(path)
+}
+
+func isSessionPath(path string) bool {
+	for _, prefix := range []string{"/dashboard/sessions", "/v1/sessions", "/v2/sessions", "/v1/groups", "/v2/groups"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isAttachPath reports whether path is /v{1,2}/sessions/{id}/attach.
+func isAttachPath(path string) bool {
+	for _, prefix := range []string{"/v1/sessions/", "/v2/sessions/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			_, sub, _ := strings.Cut(rest, "/")
+			return sub == "attach"
+		}
+	}
+	return false
+}
+
+func isAdminPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/admin/") || strings.HasPrefix(path, "/v2/admin/")
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOIDCProvider returns a provider that is never contacted.
+func testOIDCProvider(t *testing.T) *oidc.Provider {
+	t.Helper()
+	p, err := oidc.New(config.OIDCConfig{
+		Issuer:      "https://idp.invalid",
+		ClientID:    "sandkasten",
+		RedirectURL: "https://sandkasten.example/dashboard/oidc/callback",
+		Roles:       map[string]string{"devs": RoleOperator},
+	}, nil)
+	require.NoError(t, err)
+	return p
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, method, path string
+		want               bool
+	}{
+		{RoleViewer, "GET", "/dashboard", true},
+		{RoleViewer, "GET", "/v1/sessions", true},
+		{RoleViewer, "POST", "/v1/sessions", false},
+		{RoleViewer, "POST", "/dashboard/sessions/abc/destroy", false},
+		{RoleViewer, "POST", "/dashboard/logout", true},
+		{RoleViewer, "GET", "/v1/admin/pool", false},
+		{RoleOperator, "POST", "/v1/sessions", true},
+		{RoleOperator, "POST", "/v2/sessions/abc/exec", true},
+		{RoleOperator, "DELETE", "/v1/sessions/abc", true},
+		{RoleOperator, "POST", "/v1/groups/abc/exec", true},
+		{RoleViewer, "GET", "/v1/sessions/abc/attach", false},
+		{RoleOperator, "GET", "/v1/sessions/abc/attach", true},
+		{RoleViewer, "DELETE", "/v1/groups/abc", false},
+		{RoleOperator, "DELETE", "/v1/workspaces/ws1", false},
+		{RoleOperator, "GET", "/v1/admin/pool", false},
+		{RoleAdmin, "DELETE", "/v1/workspaces/ws1", true},
+		{RoleAdmin, "POST", "/v1/admin/pool", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, roleAllows(tt.role, tt.method, tt.path), "%s %s %s", tt.role, tt.method, tt.path)
+	}
+}
+
+func TestAuthMiddleware_DashboardRoles(t *testing.T) {
+	s := testServer("sk-test-key")
+	s.dash = newDashboardSessions()
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	expires := time.Now().Add(time.Hour)
+	s.dash.add("viewer-id", &dashboardUser{Subject: "v", Role: RoleViewer, ExpiresAt: expires})
+	s.dash.add("operator-id", &dashboardUser{Subject: "o", Role: RoleOperator, ExpiresAt: expires})
+	s.dash.add("expired-id", &dashboardUser{Subject: "e", Role: RoleAdmin, ExpiresAt: time.Now().Add(-time.Minute)})
+
+	do := func(method, path, id string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: dashboardCookieName, Value: id})
+		req.Header.Set(csrfHeaderName, s.dash.csrfToken(id))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/sessions", "viewer-id"))
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/sessions", "viewer-id"))
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/sessions", "operator-id"))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/v1/sessions", "expired-id"))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/v1/sessions", "unknown"))
+}
+
+func TestDashboardSessionsLoginIsSingleUse(t *testing.T) {
+	st := newDashboardSessions()
+	st.startLogin("state1", &ssoLogin{Nonce: "n", ExpiresAt: time.Now().Add(time.Minute)})
+
+	assert.NotNil(t, st.finishLogin("state1"))
+	assert.Nil(t, st.finishLogin("state1"))
+
+	st.startLogin("state2", &ssoLogin{Nonce: "n", ExpiresAt: time.Now().Add(-time.Minute)})
+	assert.Nil(t, st.finishLogin("state2"))
+}
+
+func TestHandleOIDCCallback_UnknownState(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+	s.dash = newDashboardSessions()
+	s.SetOIDCProvider(testOIDCProvider(t))
+
+	req := httptest.NewRequest("GET", "/dashboard/oidc/callback?state=nope&code=c", nil)
+	rec := httptest.NewRecorder()
+	s.handleOIDCCallback(rec, req)
+
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "flash_err=")
+	assert.Empty(t, rec.Result().Cookies())
+}
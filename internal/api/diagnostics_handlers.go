@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+// handleDiagnostics lists the most recent failed creates with the sandbox
+// launch config, init log tail and errno, newest first.
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	limit := store.MaxCreateFailures
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > store.MaxCreateFailures {
+			writeValidationError(w, "limit must be between 1 and "+strconv.Itoa(store.MaxCreateFailures), map[string]interface{}{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+
+	failures, err := s.manager.ListCreateFailures(r.Context(), limit)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"create_failures": failures})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleDiagnostics_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ListCreateFailures", mock.Anything, 5).Return([]*store.CreateFailure{
+		{ID: 2, SessionID: "abcdef12-345", Image: "python", Stage: "start", Errno: "EPERM", Error: "start nsinit: operation not permitted"},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/system/diagnostics?limit=5", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleDiagnostics(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result struct {
+		CreateFailures []*store.CreateFailure `json:"create_failures"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.Len(t, result.CreateFailures, 1)
+	assert.Equal(t, "EPERM", result.CreateFailures[0].Errno)
+}
+
+func TestHandleDiagnostics_InvalidLimit(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	req := httptest.NewRequest("GET", "/v1/system/diagnostics?limit=500", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleDiagnostics(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockMgr.AssertNotCalled(t, "ListCreateFailures", mock.Anything, mock.Anything)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/p-arndt/sandkasten/internal/store"
 )
@@ -19,7 +20,37 @@ const (
 	ErrCodeInvalidRequest    = "INVALID_REQUEST"
 	ErrCodeInternalError     = "INTERNAL_ERROR"
 	ErrCodeUnauthorized      = "UNAUTHORIZED"
+	ErrCodeForbidden         = "FORBIDDEN"
 	ErrCodeWorkspaceNotFound = "WORKSPACE_NOT_FOUND"
+	ErrCodeWorkspaceExists   = "WORKSPACE_EXISTS"
+	ErrCodeGroupNotFound     = "GROUP_NOT_FOUND"
+	ErrCodePolicyDenied      = "POLICY_DENIED"
+	ErrCodeApprovalNotFound  = "APPROVAL_NOT_FOUND"
+	ErrCodeApprovalDecided   = "APPROVAL_ALREADY_DECIDED"
+	ErrCodeOperationNotFound = "OPERATION_NOT_FOUND"
+	ErrCodeContentRejected   = "CONTENT_REJECTED"
+	ErrCodeFileNotFound      = "FILE_NOT_FOUND"
+	ErrCodeFileExists        = "FILE_EXISTS"
+	ErrCodeDraining          = "SERVER_DRAINING"
+	ErrCodeImageUnavailable  = "IMAGE_UNAVAILABLE"
+	ErrCodePoolDisabled      = "POOL_DISABLED"
+	ErrCodePortUnreachable   = "PORT_UNREACHABLE"
+	ErrCodeProxyUnsupported  = "PROXY_UNSUPPORTED"
+	ErrCodeAttachUnsupported = "ATTACH_UNSUPPORTED"
+	ErrCodeNoDownload        = "DOWNLOAD_UNSUPPORTED"
+	ErrCodeNoDeterminism     = "DETERMINISM_UNSUPPORTED"
+	ErrCodeTraceUnavailable  = "TRACE_UNAVAILABLE"
+	ErrCodeShellUnavailable  = "SHELL_UNAVAILABLE"
+	ErrCodeUsageDisabled     = "USAGE_DISABLED"
+	ErrCodeChannelsDisabled  = "SHARED_CHANNELS_DISABLED"
+	ErrCodeHostExhausted     = "HOST_RESOURCES_EXHAUSTED"
+	ErrCodeCreateFailed      = "CREATE_FAILED"
+	ErrCodeStreamGone        = "STREAM_GONE"
+	ErrCodeOutputNotFound    = "OUTPUT_NOT_FOUND"
+	ErrCodeNoRebase          = "REBASE_UNSUPPORTED"
+	ErrCodeNoCPUTuning       = "CPU_TUNING_UNSUPPORTED"
+	ErrCodeImageVulnerable   = "IMAGE_VULNERABLE"
+	ErrCodeNotFound          = "NOT_FOUND"
 )
 
 // APIError represents a structured API error response
@@ -31,7 +62,28 @@ type APIError struct {
 
 // writeAPIError writes a structured error response with appropriate HTTP status
 func writeAPIError(w http.ResponseWriter, err error) {
+	// Parked operations are not failures: report them as accepted.
+	var pending *session.PendingApprovalError
+	if errors.As(err, &pending) {
+		writeJSON(w, http.StatusAccepted, map[string]any{
+			"approval_id": pending.Approval.ID,
+			"status":      pending.Approval.Status,
+			"expires_at":  pending.Approval.ExpiresAt,
+		})
+		return
+	}
+	var queued *session.QueuedCreateError
+	if errors.As(err, &queued) {
+		writeJSON(w, http.StatusAccepted, map[string]any{
+			"operation_id": queued.Operation.ID,
+			"status":       queued.Operation.Status,
+			"expires_at":   queued.Operation.ExpiresAt,
+		})
+		return
+	}
+
 	var apiErr APIError
+	var createErr *runtime.CreateError
 	statusCode := http.StatusInternalServerError
 
 	// Map known errors to structured responses
@@ -43,6 +95,27 @@ func writeAPIError(w http.ResponseWriter, err error) {
 		}
 		statusCode = http.StatusNotFound
 
+	case errors.Is(err, session.ErrGroupNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeGroupNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrWorkspaceNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeWorkspaceNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrWorkspaceExists):
+		apiErr = APIError{
+			Code:    ErrCodeWorkspaceExists,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
 	case errors.Is(err, session.ErrExpired):
 		apiErr = APIError{
 			Code:    ErrCodeSessionExpired,
@@ -57,13 +130,224 @@ func writeAPIError(w http.ResponseWriter, err error) {
 		}
 		statusCode = http.StatusBadRequest
 
+	case errors.Is(err, session.ErrImageUnavailable):
+		apiErr = APIError{
+			Code:    ErrCodeImageUnavailable,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusServiceUnavailable
+
+	case errors.Is(err, session.ErrImageVulnerable):
+		apiErr = APIError{
+			Code:    ErrCodeImageVulnerable,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusForbidden
+
 	case errors.Is(err, session.ErrTimeout):
 		apiErr = APIError{
 			Code:    ErrCodeCommandTimeout,
 			Message: err.Error(),
 		}
+		var timeoutErr *session.TimeoutError
+		if errors.As(err, &timeoutErr) && (len(timeoutErr.Killed) > 0 || timeoutErr.ShellReset) {
+			apiErr.Details = map[string]interface{}{"killed": timeoutErr.Killed, "shell_reset": timeoutErr.ShellReset}
+		}
 		statusCode = http.StatusGatewayTimeout
 
+	case errors.Is(err, session.ErrPolicyDenied):
+		apiErr = APIError{
+			Code:    ErrCodePolicyDenied,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusForbidden
+
+	case errors.Is(err, session.ErrScanRejected):
+		apiErr = APIError{
+			Code:    ErrCodeContentRejected,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusUnprocessableEntity
+
+	case errors.Is(err, session.ErrFileNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeFileNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrFileExists):
+		apiErr = APIError{
+			Code:    ErrCodeFileExists,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
+	case errors.Is(err, session.ErrHostExhausted):
+		apiErr = APIError{
+			Code:    ErrCodeHostExhausted,
+			Message: err.Error(),
+		}
+		var limitErr *runtime.HostLimitError
+		if errors.As(err, &limitErr) {
+			apiErr.Details = map[string]interface{}{"limit": limitErr.Limit}
+			if limitErr.Value >= 0 {
+				apiErr.Details["value"] = limitErr.Value
+			}
+		}
+		statusCode = http.StatusServiceUnavailable
+
+	case errors.Is(err, session.ErrDraining):
+		apiErr = APIError{
+			Code:    ErrCodeDraining,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusServiceUnavailable
+
+	case errors.Is(err, session.ErrInvalidUpdate), errors.Is(err, session.ErrInvalidWorkspace), errors.Is(err, session.ErrInvalidCPU):
+		apiErr = APIError{
+			Code:    ErrCodeInvalidRequest,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusBadRequest
+
+	case errors.Is(err, session.ErrPoolDisabled):
+		apiErr = APIError{
+			Code:    ErrCodePoolDisabled,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
+	case errors.Is(err, session.ErrDefaultTenant):
+		apiErr = APIError{
+			Code:    ErrCodeNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrUsageDisabled):
+		apiErr = APIError{
+			Code:    ErrCodeUsageDisabled,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
+	case errors.Is(err, session.ErrSharedChannelsDisabled):
+		apiErr = APIError{
+			Code:    ErrCodeChannelsDisabled,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
+	case errors.Is(err, session.ErrShellUnavailable):
+		apiErr = APIError{
+			Code:    ErrCodeShellUnavailable,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusBadRequest
+
+	case errors.Is(err, session.ErrPortUnreachable):
+		apiErr = APIError{
+			Code:    ErrCodePortUnreachable,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusBadGateway
+
+	case errors.Is(err, session.ErrProxyUnsupported):
+		apiErr = APIError{
+			Code:    ErrCodeProxyUnsupported,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrAttachUnsupported):
+		apiErr = APIError{
+			Code:    ErrCodeAttachUnsupported,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrDownloadUnsupported):
+		apiErr = APIError{
+			Code:    ErrCodeNoDownload,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrNoDeterminism):
+		apiErr = APIError{
+			Code:    ErrCodeNoDeterminism,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrNoCPUTuning):
+		apiErr = APIError{
+			Code:    ErrCodeNoCPUTuning,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrRebaseUnsupported):
+		apiErr = APIError{
+			Code:    ErrCodeNoRebase,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrTraceUnavailable):
+		apiErr = APIError{
+			Code:    ErrCodeTraceUnavailable,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotImplemented
+
+	case errors.Is(err, session.ErrOutputNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeOutputNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrInvalidOutputRange):
+		apiErr = APIError{
+			Code:    ErrCodeInvalidRequest,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusBadRequest
+
+	case errors.Is(err, session.ErrApprovalNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeApprovalNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrOperationNotFound):
+		apiErr = APIError{
+			Code:    ErrCodeOperationNotFound,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusNotFound
+
+	case errors.Is(err, session.ErrApprovalDecided):
+		apiErr = APIError{
+			Code:    ErrCodeApprovalDecided,
+			Message: err.Error(),
+		}
+		statusCode = http.StatusConflict
+
+	case errors.As(err, &createErr):
+		apiErr = APIError{
+			Code:    ErrCodeCreateFailed,
+			Message: err.Error(),
+			Details: map[string]interface{}{"class": runtime.CreateFailureClass(err), "stage": createErr.Stage},
+		}
+		if createErr.Errno != "" {
+			apiErr.Details["errno"] = createErr.Errno
+		}
+		statusCode = http.StatusInternalServerError
+
 	default:
 		// Generic internal error
 		apiErr = APIError{
@@ -73,16 +357,12 @@ func writeAPIError(w http.ResponseWriter, err error) {
 		statusCode = http.StatusInternalServerError
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(apiErr)
+	writeError(w, statusCode, apiErr)
 }
 
 // writeValidationError writes a 400 Bad Request with validation details
 func writeValidationError(w http.ResponseWriter, message string, details map[string]interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
-	json.NewEncoder(w).Encode(APIError{
+	writeError(w, http.StatusBadRequest, APIError{
 		Code:    ErrCodeInvalidRequest,
 		Message: message,
 		Details: details,
@@ -91,10 +371,44 @@ func writeValidationError(w http.ResponseWriter, message string, details map[str
 
 // writeUnauthorizedError writes a 401 Unauthorized error
 func writeUnauthorizedError(w http.ResponseWriter, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
-	json.NewEncoder(w).Encode(APIError{
+	writeError(w, http.StatusUnauthorized, APIError{
 		Code:    ErrCodeUnauthorized,
 		Message: message,
 	})
 }
+
+func writeForbiddenError(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusForbidden, APIError{
+		Code:    ErrCodeForbidden,
+		Message: message,
+	})
+}
+
+// v2Error is the v2 error body: the error is nested so success and error
+// responses never share top-level fields, and it carries the request ID.
+type v2Error struct {
+	Error v2ErrorBody `json:"error"`
+}
+
+type v2ErrorBody struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// writeError writes apiErr in the format of the API version serving the request.
+func writeError(w http.ResponseWriter, status int, apiErr APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if responseAPIVersion(w) >= apiV2 {
+		json.NewEncoder(w).Encode(v2Error{Error: v2ErrorBody{
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: w.Header().Get("X-Request-ID"),
+		}})
+		return
+	}
+	json.NewEncoder(w).Encode(apiErr)
+}
@@ -2,13 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,6 +35,12 @@ func TestWriteAPIError(t *testing.T) {
 			wantStatus: http.StatusNotFound,
 			wantCode:   ErrCodeSessionNotFound,
 		},
+		{
+			name:       "workspace not found",
+			err:        fmt.Errorf("%w: data", session.ErrWorkspaceNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   ErrCodeWorkspaceNotFound,
+		},
 		{
 			name:       "session expired",
 			err:        fmt.Errorf("%w: abc123", session.ErrExpired),
@@ -50,6 +59,66 @@ func TestWriteAPIError(t *testing.T) {
 			wantStatus: http.StatusGatewayTimeout,
 			wantCode:   ErrCodeCommandTimeout,
 		},
+		{
+			name:       "policy denied",
+			err:        fmt.Errorf("%w: matches deny rule", session.ErrPolicyDenied),
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodePolicyDenied,
+		},
+		{
+			name:       "image unavailable",
+			err:        fmt.Errorf("%w: python: runner not found", session.ErrImageUnavailable),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeImageUnavailable,
+		},
+		{
+			name:       "attach unsupported",
+			err:        session.ErrAttachUnsupported,
+			wantStatus: http.StatusNotImplemented,
+			wantCode:   ErrCodeAttachUnsupported,
+		},
+		{
+			name:       "download unsupported",
+			err:        session.ErrDownloadUnsupported,
+			wantStatus: http.StatusNotImplemented,
+			wantCode:   ErrCodeNoDownload,
+		},
+		{
+			name:       "image vulnerable",
+			err:        fmt.Errorf("%w: python has 2 critical or worse findings", session.ErrImageVulnerable),
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeImageVulnerable,
+		},
+		{
+			name:       "determinism unsupported",
+			err:        fmt.Errorf("%w: libfaketime: no such file", session.ErrNoDeterminism),
+			wantStatus: http.StatusNotImplemented,
+			wantCode:   ErrCodeNoDeterminism,
+		},
+		{
+			name:       "trace unavailable",
+			err:        fmt.Errorf("%w: trace.enabled is off", session.ErrTraceUnavailable),
+			wantStatus: http.StatusNotImplemented,
+			wantCode:   ErrCodeTraceUnavailable,
+		},
+		{
+			name:       "draining",
+			err:        session.ErrDraining,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeDraining,
+		},
+		{
+			name:       "host resources exhausted",
+			err:        fmt.Errorf("create sandbox: %w", &runtime.HostLimitError{Limit: "user.max_user_namespaces", Value: 15, Err: errors.New("no space left on device")}),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   ErrCodeHostExhausted,
+		},
+		{
+			name:       "content rejected by scan",
+			err:        fmt.Errorf("%w: EICAR", session.ErrScanRejected),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   ErrCodeContentRejected,
+		},
 		{
 			name:       "generic error",
 			err:        fmt.Errorf("something went wrong"),
@@ -103,3 +172,57 @@ func TestWriteUnauthorizedError(t *testing.T) {
 func decodeBody(rec *httptest.ResponseRecorder, v any) error {
 	return json.NewDecoder(rec.Body).Decode(v)
 }
+
+func TestWriteAPIError_TimeoutDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeAPIError(rec, &session.TimeoutError{
+		Output: "timeout: command exceeded 1s",
+		Killed: []protocol.KilledProcess{{PID: 42, Command: "sleep 999", Signal: "SIGKILL"}},
+	})
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	var apiErr APIError
+	require.NoError(t, decodeBody(rec, &apiErr))
+	assert.Equal(t, ErrCodeCommandTimeout, apiErr.Code)
+	killed, ok := apiErr.Details["killed"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, killed, 1)
+	assert.Equal(t, "SIGKILL", killed[0].(map[string]interface{})["signal"])
+	assert.Equal(t, false, apiErr.Details["shell_reset"])
+
+	rec = httptest.NewRecorder()
+	writeAPIError(rec, &session.TimeoutError{Output: "timeout: command exceeded 1s"})
+	var plain APIError
+	require.NoError(t, decodeBody(rec, &plain))
+	assert.Nil(t, plain.Details, "nothing killed, no details")
+}
+
+func TestWriteAPIError_HostLimitDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeAPIError(rec, fmt.Errorf("create sandbox: %w", &runtime.HostLimitError{Limit: "kernel.pid_max", Value: 32768, Err: errors.New("resource temporarily unavailable")}))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var apiErr APIError
+	require.NoError(t, decodeBody(rec, &apiErr))
+	assert.Equal(t, ErrCodeHostExhausted, apiErr.Code)
+	assert.Equal(t, "kernel.pid_max", apiErr.Details["limit"])
+	assert.EqualValues(t, 32768, apiErr.Details["value"])
+}
+
+func TestWriteAPIError_CreateFailureDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeAPIError(rec, fmt.Errorf("create sandbox: %w", &runtime.CreateError{
+		Stage: "cgroup",
+		Class: runtime.CreateFailureCgroupPermission,
+		Errno: "EACCES",
+		Err:   errors.New("create cgroup: permission denied"),
+	}))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	var apiErr APIError
+	require.NoError(t, decodeBody(rec, &apiErr))
+	assert.Equal(t, ErrCodeCreateFailed, apiErr.Code)
+	assert.Equal(t, "cgroup_permission", apiErr.Details["class"])
+	assert.Equal(t, "cgroup", apiErr.Details["stage"])
+	assert.Equal(t, "EACCES", apiErr.Details["errno"])
+}
@@ -4,14 +4,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/p-arndt/sandkasten/internal/session"
 )
 
+// ExpiresInHeader is set on exec responses of a session within
+// session_expiry_warning_seconds of its expiry, to the seconds it has left.
+const ExpiresInHeader = "X-Sandkasten-Expires-In"
+
+// maxOutputPageBytes caps the limit of an exec output page.
+const maxOutputPageBytes = 8 * 1024 * 1024
+
+// execIDPattern matches the IDs of execs, the first 8 hex digits of a UUID.
+var execIDPattern = regexp.MustCompile(`^[a-f0-9]{8}$`)
+
 type execRequest struct {
-	Cmd       string `json:"cmd"`
-	TimeoutMs int    `json:"timeout_ms"`
-	RawOutput bool   `json:"raw_output,omitempty"`
+	Cmd          string `json:"cmd"`
+	TimeoutMs    int    `json:"timeout_ms"`
+	RawOutput    bool   `json:"raw_output,omitempty"`
+	OutputBase64 bool   `json:"output_base64,omitempty"`
+	Shell        string `json:"shell,omitempty"`
+	// LineTimestamps streams one chunk per line, stamped with the time the
+	// line was output (exec/stream only).
+	LineTimestamps bool `json:"line_timestamps,omitempty"`
+	// Trace reports the programs, files and network addresses the command
+	// touched with the result (see trace in the config).
+	Trace bool `json:"trace,omitempty"`
+	// Coverage and Profile collect line coverage and cProfile statistics of
+	// a python command as artifacts of the result (shell python only).
+	Coverage bool `json:"coverage,omitempty"`
+	Profile  bool `json:"profile,omitempty"`
 }
 
 func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
@@ -21,7 +46,7 @@ func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req execRequest
-	if err := decodeJSONBody(w, r, &req); err != nil {
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
 		writeValidationError(w, "invalid json: "+err.Error(), nil)
 		return
 	}
@@ -30,13 +55,14 @@ func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.logger.Debug("exec", "session_id", id, "cmd", req.Cmd, "timeout_ms", req.TimeoutMs)
-	result, err := s.manager.Exec(r.Context(), id, req.Cmd, req.TimeoutMs, req.RawOutput)
+	result, err := s.manager.Exec(r.Context(), id, req.Cmd, req.execOpts())
 	if err != nil {
 		s.logger.Error("exec", "session_id", id, "error", err)
 		writeAPIError(w, err)
 		return
 	}
 
+	s.setExpiresIn(w, r, id)
 	writeJSON(w, http.StatusOK, result)
 }
 
@@ -46,8 +72,12 @@ func (s *Server) handleExecStream(w http.ResponseWriter, r *http.Request) {
 		writeValidationError(w, err.Error(), nil)
 		return
 	}
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		s.handleResumeExecStream(w, r, id, last)
+		return
+	}
 	var req execRequest
-	if err := decodeJSONBody(w, r, &req); err != nil {
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
 		writeValidationError(w, "invalid json: "+err.Error(), nil)
 		return
 	}
@@ -57,25 +87,122 @@ func (s *Server) handleExecStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := setupSSE(w); err != nil {
+	// Headers go out with the first event, so this is the time left as the
+	// exec starts; a long exec may outlive it.
+	s.setExpiresIn(w, r, id)
+	events, err := newExecEventWriter(w, r)
+	if err != nil {
 		writeValidationError(w, err.Error(), nil)
 		return
 	}
 	s.logger.Debug("exec stream", "session_id", id, "cmd", req.Cmd, "timeout_ms", req.TimeoutMs)
-	flusher := w.(http.Flusher)
-	chunkChan := make(chan session.ExecChunk, 10)
-	errChan := make(chan error, 1)
-
-	go func() {
-		err := s.manager.ExecStream(r.Context(), id, req.Cmd, req.TimeoutMs, req.RawOutput, chunkChan)
-		if err != nil {
-			errChan <- err
+	st := s.startExecStream(r, id, req)
+	w.Header().Set(StreamIDHeader, st.id)
+	st.follow(r.Context(), events, 0, s.streamKeepAlive())
+}
+
+// handleExecOutput pages through the full output of an exec whose result
+// was cut at defaults.max_output_bytes (output_overflow in the result).
+func (s *Server) handleExecOutput(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	execID := r.PathValue("exec_id")
+	if !execIDPattern.MatchString(execID) {
+		writeValidationError(w, "invalid exec id", map[string]interface{}{"field": "exec_id"})
+		return
+	}
+	var offset, limit int
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeValidationError(w, "offset must be a non-negative integer", map[string]interface{}{"field": "offset"})
+			return
 		}
-		close(chunkChan)
-		close(errChan)
-	}()
+		offset = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxOutputPageBytes {
+			writeValidationError(w, fmt.Sprintf("limit must be between 1 and %d", maxOutputPageBytes), map[string]interface{}{"field": "limit"})
+			return
+		}
+		limit = n
+	}
+	page, err := s.manager.ExecOutput(r.Context(), id, execID, offset, limit)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// execOpts returns the options to run the exec req with.
+func (req execRequest) execOpts() session.ExecOpts {
+	return session.ExecOpts{
+		TimeoutMs:      req.TimeoutMs,
+		RawOutput:      req.RawOutput,
+		OutputBase64:   req.OutputBase64,
+		Shell:          req.Shell,
+		LineTimestamps: req.LineTimestamps,
+		Trace:          req.Trace,
+		Artifacts:      session.ArtifactOpts{Coverage: req.Coverage, Profile: req.Profile},
+	}
+}
+
+// setExpiresIn sets ExpiresInHeader if session id is close to expiry.
+func (s *Server) setExpiresIn(w http.ResponseWriter, r *http.Request, id string) {
+	if s.cfg.SessionExpiryWarning <= 0 {
+		return
+	}
+	if left, ok := s.manager.ExpiresIn(r.Context(), id); ok {
+		w.Header().Set(ExpiresInHeader, strconv.Itoa(int(left.Seconds())))
+	}
+}
+
+// execEventWriter writes exec stream events in the wire format the client
+// asked for: Server-Sent Events by default, NDJSON with
+// Accept: application/x-ndjson.
+// Events carry the ID of their place in the stream (see StreamIDHeader).
+type execEventWriter interface {
+	open(id string) // sends the headers; id is where the stream starts
+	chunk(id, output string, timestamp int64)
+	done(id string, chunk session.ExecChunk)
+	fail(id string, err error)
+	keepAlive()
+}
+
+// newExecEventWriter sets the response headers for the format r accepts.
+func newExecEventWriter(w http.ResponseWriter, r *http.Request) (execEventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported")
+	}
+	if acceptsNDJSON(r) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		return &ndjsonEvents{w: w, flusher: flusher}, nil
+	}
+	if err := setupSSE(w); err != nil {
+		return nil, err
+	}
+	return &sseEvents{w: w, flusher: flusher}, nil
+}
 
-	streamSSEChunks(w, flusher, chunkChan, errChan, r)
+// acceptsNDJSON reports whether the Accept header lists application/x-ndjson.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(v, ",") {
+			mediaType, _, _ := strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/x-ndjson") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // setupSSE configures headers for Server-Sent Events streaming.
@@ -92,69 +219,116 @@ func setupSSE(w http.ResponseWriter) error {
 	return nil
 }
 
-// streamSSEChunks sends exec chunks as Server-Sent Events.
-func streamSSEChunks(w http.ResponseWriter, flusher http.Flusher, chunkChan <-chan session.ExecChunk, errChan <-chan error, r *http.Request) {
-	for {
-		select {
-		case chunk, ok := <-chunkChan:
-			if !ok {
-				return
-			}
+// doneEvent is the data of the done event that ends a stream.
+func doneEvent(chunk session.ExecChunk) map[string]interface{} {
+	done := map[string]interface{}{
+		"exit_code":   chunk.ExitCode,
+		"cwd":         chunk.Cwd,
+		"duration_ms": chunk.DurationMs,
+	}
+	if chunk.ShellRestarted {
+		done["shell_restarted"] = true
+	}
+	if chunk.OutputBase64 {
+		done["output_base64"] = true
+	}
+	if chunk.OutputOverflow {
+		done["exec_id"] = chunk.ExecID
+		done["output_overflow"] = true
+	}
+	if chunk.Trace != nil {
+		done["trace"] = chunk.Trace
+	}
+	if chunk.Artifacts != nil {
+		done["artifacts"] = chunk.Artifacts
+	}
+	return done
+}
 
-			if chunk.Done {
-				sendDoneChunk(w, flusher, chunk)
-				return
-			}
+// sseEvents writes Server-Sent Events: chunk, done and error. Keep-alives
+// are comments, which clients ignore but proxies count as traffic.
+type sseEvents struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
 
-			if chunk.Output != "" {
-				sendOutputChunk(w, flusher, chunk)
-			}
+func (e *sseEvents) send(id, event string, data any) {
+	dataJSON, _ := json.Marshal(data)
+	if id != "" {
+		fmt.Fprintf(e.w, "id: %s\n", id)
+	}
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, dataJSON)
+	e.flusher.Flush()
+}
 
-		case err := <-errChan:
-			if err != nil {
-				sendErrorEvent(w, flusher, err)
-				return
-			}
+// open sends an event with just the ID, so that a client that loses the
+// connection before the first chunk can resume too.
+func (e *sseEvents) open(id string) {
+	fmt.Fprintf(e.w, "id: %s\n\n", id)
+	e.flusher.Flush()
+}
 
-		case <-r.Context().Done():
-			return
-		}
-	}
+func (e *sseEvents) chunk(id, output string, timestamp int64) {
+	e.send(id, "chunk", map[string]interface{}{
+		"chunk":     output,
+		"timestamp": timestamp,
+	})
+}
+
+func (e *sseEvents) done(id string, chunk session.ExecChunk) {
+	e.send(id, "done", doneEvent(chunk))
 }
 
-// sendDoneChunk sends the final chunk with execution metadata.
-func sendDoneChunk(w http.ResponseWriter, flusher http.Flusher, chunk session.ExecChunk) {
-	if chunk.Output != "" {
-		chunkJSON, _ := json.Marshal(map[string]interface{}{
-			"chunk":     chunk.Output,
-			"timestamp": chunk.Timestamp,
-		})
-		fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", chunkJSON)
-		flusher.Flush()
+func (e *sseEvents) fail(id string, err error) {
+	e.send(id, "error", map[string]string{"error": err.Error()})
+}
+
+func (e *sseEvents) keepAlive() {
+	fmt.Fprint(e.w, ": keep-alive\n\n")
+	e.flusher.Flush()
+}
+
+// ndjsonEvents writes one JSON object per line. Each carries the event name
+// in "type" and its ID in "id" next to the same fields as the SSE event data.
+// There are no keep-alives: a line would break clients that expect only
+// events.
+type ndjsonEvents struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (e *ndjsonEvents) send(id string, v map[string]interface{}) {
+	if id != "" {
+		v["id"] = id
 	}
+	line, _ := json.Marshal(v)
+	e.w.Write(append(line, '\n'))
+	e.flusher.Flush()
+}
 
-	doneJSON, _ := json.Marshal(map[string]interface{}{
-		"exit_code":   chunk.ExitCode,
-		"cwd":         chunk.Cwd,
-		"duration_ms": chunk.DurationMs,
-	})
-	fmt.Fprintf(w, "event: done\ndata: %s\n\n", doneJSON)
-	flusher.Flush()
+func (e *ndjsonEvents) open(string) {
+	e.flusher.Flush()
 }
 
-// sendOutputChunk sends an output chunk event.
-func sendOutputChunk(w http.ResponseWriter, flusher http.Flusher, chunk session.ExecChunk) {
-	chunkJSON, _ := json.Marshal(map[string]interface{}{
-		"chunk":     chunk.Output,
-		"timestamp": chunk.Timestamp,
+func (e *ndjsonEvents) chunk(id, output string, timestamp int64) {
+	e.send(id, map[string]interface{}{
+		"type":      "chunk",
+		"chunk":     output,
+		"timestamp": timestamp,
 	})
-	fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", chunkJSON)
-	flusher.Flush()
 }
 
-// sendErrorEvent sends an error event.
-func sendErrorEvent(w http.ResponseWriter, flusher http.Flusher, err error) {
-	errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-	fmt.Fprintf(w, "event: error\ndata: %s\n\n", errJSON)
-	flusher.Flush()
+func (e *ndjsonEvents) done(id string, chunk session.ExecChunk) {
+	done := doneEvent(chunk)
+	done["type"] = "done"
+	e.send(id, done)
 }
+
+func (e *ndjsonEvents) fail(id string, err error) {
+	e.send(id, map[string]interface{}{
+		"type":  "error",
+		"error": err.Error(),
+	})
+}
+
+func (e *ndjsonEvents) keepAlive() {}
@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,7 +20,7 @@ func TestHandleExec_Success(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
 
-	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "echo hello", 5000, false).Return(&session.ExecResult{
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "echo hello", session.ExecOpts{TimeoutMs: 5000}).Return(&session.ExecResult{
 		ExitCode:   0,
 		Cwd:        "/workspace",
 		Output:     "hello\n",
@@ -41,6 +43,26 @@ func TestHandleExec_Success(t *testing.T) {
 	assert.Equal(t, "hello\n", result.Output)
 }
 
+func TestHandleExec_ExpiresInHeader(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.SessionExpiryWarning = 120
+
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "echo hello", session.ExecOpts{}).Return(&session.ExecResult{}, nil)
+	mockMgr.On("ExpiresIn", mock.Anything, "a1b2c3d4-e5f").Return(90*time.Second, true).Once()
+	mockMgr.On("ExpiresIn", mock.Anything, "a1b2c3d4-e5f").Return(time.Duration(0), false).Once()
+
+	for _, want := range []string{"90", ""} {
+		req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(`{"cmd":"echo hello"}`))
+		req.SetPathValue("id", "a1b2c3d4-e5f")
+		rec := httptest.NewRecorder()
+		s.handleExec(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, want, rec.Header().Get(ExpiresInHeader))
+	}
+	mockMgr.AssertExpectations(t)
+}
+
 func TestHandleExec_EmptyCmd(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
@@ -60,7 +82,7 @@ func TestHandleExec_NotFound(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
 
-	mockMgr.On("Exec", mock.Anything, "00000000-001", "ls", 0, false).Return(nil, fmt.Errorf("%w: 00000000-001", session.ErrNotFound))
+	mockMgr.On("Exec", mock.Anything, "00000000-001", "ls", session.ExecOpts{}).Return(nil, fmt.Errorf("%w: 00000000-001", session.ErrNotFound))
 
 	body := `{"cmd":"ls"}`
 	req := httptest.NewRequest("POST", "/v1/sessions/00000000-001/exec", strings.NewReader(body))
@@ -87,6 +109,24 @@ func TestHandleExec_InvalidJSON(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
+func TestHandleExec_BodyOverConfiguredLimit(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.HTTP.MaxJSONBodyBytes = 64
+
+	body := fmt.Sprintf(`{"cmd":"%s"}`, strings.Repeat("x", 128))
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "request body too large")
+	mockMgr.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestHandleExecStream_InvalidJSON(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
@@ -138,11 +178,66 @@ func TestHandleExec_CmdTooLargeIncludesDetails(t *testing.T) {
 	assert.Contains(t, apiErr.Details["recommendation"], "fs/write")
 }
 
+func TestHandleExec_Trace(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "ls", session.ExecOpts{TimeoutMs: 5000, Trace: true}).Return(&session.ExecResult{
+		Cwd:   "/workspace",
+		Trace: &runtime.TraceReport{Processes: 1, Execs: []string{"/bin/ls"}},
+	}, nil)
+
+	body := `{"cmd":"ls","timeout_ms":5000,"trace":true}`
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result session.ExecResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.NotNil(t, result.Trace)
+	assert.Equal(t, []string{"/bin/ls"}, result.Trace.Execs)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleExec_Artifacts(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	opts := session.ExecOpts{TimeoutMs: 5000, Shell: "python", Artifacts: session.ArtifactOpts{Coverage: true}}
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "print(1)", opts).Return(&session.ExecResult{
+		Cwd: "/workspace",
+		Artifacts: &session.ExecArtifacts{Coverage: &session.CoverageReport{
+			Files: []session.FileCoverage{{Path: "<cmd>", Lines: 1, Covered: 1, Percent: 100}},
+			Lines: 1, Covered: 1, Percent: 100,
+		}},
+	}, nil)
+
+	body := `{"cmd":"print(1)","timeout_ms":5000,"shell":"python","coverage":true}`
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result session.ExecResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.NotNil(t, result.Artifacts)
+	require.NotNil(t, result.Artifacts.Coverage)
+	assert.Equal(t, 100.0, result.Artifacts.Coverage.Percent)
+	mockMgr.AssertExpectations(t)
+}
+
 func TestHandleExec_RawOutputFlagPassThrough(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
 
-	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "echo hello", 5000, true).Return(&session.ExecResult{
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "echo hello", session.ExecOpts{TimeoutMs: 5000, RawOutput: true}).Return(&session.ExecResult{
 		ExitCode:   0,
 		Cwd:        "/workspace",
 		Output:     "hello\r\n",
@@ -159,3 +254,253 @@ func TestHandleExec_RawOutputFlagPassThrough(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestHandleExec_OutputBase64(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "cat image.png", session.ExecOpts{TimeoutMs: 5000, OutputBase64: true}).Return(&session.ExecResult{
+		Cwd:          "/workspace",
+		Output:       "iVBORw0KGgo=",
+		OutputBase64: true,
+	}, nil)
+
+	body := `{"cmd":"cat image.png","timeout_ms":5000,"output_base64":true}`
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result session.ExecResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Equal(t, "iVBORw0KGgo=", result.Output)
+	assert.True(t, result.OutputBase64)
+}
+
+func TestHandleExec_Shell(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "print(1)", session.ExecOpts{Shell: "python"}).Return(&session.ExecResult{
+		Cwd:    "/workspace",
+		Output: "1",
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(`{"cmd":"print(1)","shell":"python"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleExec_UnknownShell(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(`{"cmd":"1+1","shell":"ruby"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "shell must be one of bash, node, python, sh")
+}
+
+func TestHandleExec_ShellUnavailable(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Exec", mock.Anything, "a1b2c3d4-e5f", "print(1)", session.ExecOpts{Shell: "python"}).
+		Return(nil, fmt.Errorf("%w: python is not installed in this image", session.ErrShellUnavailable))
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec", strings.NewReader(`{"cmd":"print(1)","shell":"python"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleExec(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeShellUnavailable)
+}
+
+// streamTwoChunks makes the mocked ExecStream emit one output chunk and a
+// final chunk.
+func streamTwoChunks(mockMgr *MockSessionService) {
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "echo hi", session.ExecOpts{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			ch := args.Get(4).(chan<- session.ExecChunk)
+			ch <- session.ExecChunk{Output: "hi\n", Timestamp: 1707390000000}
+			ch <- session.ExecChunk{Done: true, ExitCode: 0, Cwd: "/workspace", DurationMs: 12}
+		}).Return(nil)
+}
+
+func TestHandleExecStream_SSE(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	streamTwoChunks(mockMgr)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"echo hi"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	sid := rec.Header().Get(StreamIDHeader)
+	require.NotEmpty(t, sid)
+	assert.Equal(t, "id: "+sid+"-0\n\n"+
+		"id: "+sid+"-1\nevent: chunk\ndata: {\"chunk\":\"hi\\n\",\"timestamp\":1707390000000}\n\n"+
+		"id: "+sid+"-2\nevent: done\ndata: {\"cwd\":\"/workspace\",\"duration_ms\":12,\"exit_code\":0}\n\n", rec.Body.String())
+}
+
+func TestHandleExecStream_ExpiresInHeader(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.SessionExpiryWarning = 120
+	streamTwoChunks(mockMgr)
+	mockMgr.On("ExpiresIn", mock.Anything, "a1b2c3d4-e5f").Return(30*time.Second, true)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"echo hi"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	assert.Equal(t, "30", rec.Header().Get(ExpiresInHeader))
+}
+
+func TestHandleExecStream_LineTimestamps(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "make", session.ExecOpts{LineTimestamps: true}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			ch := args.Get(4).(chan<- session.ExecChunk)
+			ch <- session.ExecChunk{Output: "compiling\n", Timestamp: 1707390000000}
+			ch <- session.ExecChunk{Output: "done\n", Timestamp: 1707390004500}
+			ch <- session.ExecChunk{Done: true, Cwd: "/workspace", DurationMs: 4600}
+		}).Return(nil)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"make","line_timestamps":true}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	sid := rec.Header().Get(StreamIDHeader)
+	assert.JSONEq(t, `{"id":"`+sid+`-1","type":"chunk","chunk":"compiling\n","timestamp":1707390000000}`, lines[0])
+	assert.JSONEq(t, `{"id":"`+sid+`-2","type":"chunk","chunk":"done\n","timestamp":1707390004500}`, lines[1])
+}
+
+func TestHandleExecStream_NDJSON(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	streamTwoChunks(mockMgr)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"echo hi"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Accept", "application/json, application/x-ndjson;q=0.9")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	sid := rec.Header().Get(StreamIDHeader)
+	assert.JSONEq(t, `{"id":"`+sid+`-1","type":"chunk","chunk":"hi\n","timestamp":1707390000000}`, lines[0])
+	assert.JSONEq(t, `{"id":"`+sid+`-2","type":"done","exit_code":0,"cwd":"/workspace","duration_ms":12}`, lines[1])
+}
+
+func TestHandleExecStream_ShellRestarted(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "echo hi", session.ExecOpts{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			ch := args.Get(4).(chan<- session.ExecChunk)
+			ch <- session.ExecChunk{Done: true, Cwd: "/workspace", DurationMs: 12, ShellRestarted: true}
+		}).Return(nil)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"echo hi"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	sid := rec.Header().Get(StreamIDHeader)
+	assert.JSONEq(t, `{"id":"`+sid+`-1","type":"done","exit_code":0,"cwd":"/workspace","duration_ms":12,"shell_restarted":true}`, strings.TrimSpace(rec.Body.String()))
+}
+
+func TestHandleExecStream_NDJSONError(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "echo hi", session.ExecOpts{}, mock.Anything).
+		Return(fmt.Errorf("%w: a1b2c3d4-e5f", session.ErrNotFound))
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"echo hi"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+
+	s.handleExecStream(rec, req)
+
+	sid := rec.Header().Get(StreamIDHeader)
+	assert.JSONEq(t, `{"id":"`+sid+`-1","type":"error","error":"session not found: a1b2c3d4-e5f"}`, strings.TrimSpace(rec.Body.String()))
+}
+
+func TestHandleExecOutput(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ExecOutput", mock.Anything, "a1b2c3d4-e5f", "0a1b2c3d", 1024, 512).Return(&session.OutputPage{
+		ExecID:     "0a1b2c3d",
+		Offset:     1024,
+		NextOffset: 1536,
+		TotalBytes: 4096,
+		Output:     strings.Repeat("x", 512),
+		Complete:   true,
+	}, nil)
+	mockMgr.On("ExecOutput", mock.Anything, "a1b2c3d4-e5f", "ffffffff", 0, 0).Return(nil, session.ErrOutputNotFound)
+
+	get := func(execID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/execs/"+execID+"/output"+query, nil)
+		req.SetPathValue("id", "a1b2c3d4-e5f")
+		req.SetPathValue("exec_id", execID)
+		rec := httptest.NewRecorder()
+		s.handleExecOutput(rec, req)
+		return rec
+	}
+
+	rec := get("0a1b2c3d", "?offset=1024&limit=512")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var page session.OutputPage
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Equal(t, 1536, page.NextOffset)
+	assert.Equal(t, 4096, page.TotalBytes)
+
+	rec = get("ffffffff", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeOutputNotFound)
+
+	for _, tt := range []struct{ execID, query string }{
+		{"0a1b2c3d", "?offset=-1"},
+		{"0a1b2c3d", "?limit=0"},
+		{"0a1b2c3d", "?limit=abc"},
+		{"../etc", ""},
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(tt.execID, tt.query).Code, tt.execID+tt.query)
+	}
+	mockMgr.AssertExpectations(t)
+}
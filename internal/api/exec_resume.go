@@ -0,0 +1,332 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// StreamIDHeader is set on exec/stream responses to the ID of the stream.
+// Events carry the ID "<stream id>-<seq>", seq counting from 1; a client
+// that lost the connection sends the last ID it saw (or "<stream id>-0")
+// as Last-Event-ID to resume the stream.
+const StreamIDHeader = "X-Sandkasten-Stream-Id"
+
+// defaultStreamResumeBufferBytes applies when
+// http.stream_resume_buffer_bytes is unset.
+const defaultStreamResumeBufferBytes = 1 << 20
+
+// errStreamOverrun fails a client that is further behind than the resume
+// buffer reaches.
+var errStreamOverrun = errors.New("missed events were dropped from the resume buffer")
+
+// execStreams holds the running and recently finished exec streams, so that
+// clients can reconnect to them. The zero value is ready to use.
+type execStreams struct {
+	mu      sync.Mutex
+	streams map[string]*execStream
+}
+
+func (s *execStreams) add(st *execStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[string]*execStream)
+	}
+	s.streams[st.id] = st
+}
+
+func (s *execStreams) get(id string) *execStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+func (s *execStreams) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, id)
+}
+
+// execStream is one exec/stream command. Its events are buffered so that a
+// client can catch up after reconnecting; the oldest are dropped once they
+// exceed maxBytes. The command runs on while no client is attached, for up
+// to resume, and is cancelled then.
+type execStream struct {
+	id        string
+	sessionID string
+	tenant    string // of the key that started it
+	cancel    context.CancelFunc
+	resume    time.Duration
+	maxBytes  int
+	onEnd     func() // called resume after the command ended
+
+	mu       sync.Mutex
+	events   []streamEvent // oldest first
+	size     int
+	seq      int64 // of the last event
+	ended    bool
+	watchers int
+	idle     *time.Timer   // cancels the command when no client returns
+	changed  chan struct{} // closed and replaced on each new event
+}
+
+// streamEvent is a chunk, done or error event of an exec stream.
+type streamEvent struct {
+	seq   int64
+	name  string
+	chunk session.ExecChunk
+	err   error
+}
+
+func newExecStream(sessionID string, cancel context.CancelFunc, resume time.Duration, maxBytes int) *execStream {
+	if maxBytes <= 0 {
+		maxBytes = defaultStreamResumeBufferBytes
+	}
+	return &execStream{
+		id:        uuid.NewString(),
+		sessionID: sessionID,
+		cancel:    cancel,
+		resume:    resume,
+		maxBytes:  maxBytes,
+		changed:   make(chan struct{}),
+	}
+}
+
+// eventID returns the event ID of event seq.
+func (st *execStream) eventID(seq int64) string {
+	return st.id + "-" + strconv.FormatInt(seq, 10)
+}
+
+// parseEventID splits a Last-Event-ID into stream ID and seq.
+func parseEventID(id string) (string, int64, error) {
+	i := strings.LastIndex(id, "-")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid Last-Event-ID %q", id)
+	}
+	seq, err := strconv.ParseInt(id[i+1:], 10, 64)
+	if err != nil || seq < 0 {
+		return "", 0, fmt.Errorf("invalid Last-Event-ID %q", id)
+	}
+	return id[:i], seq, nil
+}
+
+// run feeds the chunks of exec into the stream until the command finishes
+// or fails.
+func (st *execStream) run(exec func(chan<- session.ExecChunk) error) {
+	chunkChan := make(chan session.ExecChunk, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- exec(chunkChan)
+		close(chunkChan)
+	}()
+
+	finished := false
+	for chunk := range chunkChan {
+		if finished {
+			continue
+		}
+		if chunk.Output != "" {
+			st.push(streamEvent{name: "chunk", chunk: chunk})
+		}
+		if chunk.Done {
+			st.push(streamEvent{name: "done", chunk: chunk})
+			finished = true
+		}
+	}
+	if err := <-errChan; err != nil && !finished {
+		st.push(streamEvent{name: "error", err: err})
+	}
+	st.end()
+}
+
+func (st *execStream) push(ev streamEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.seq++
+	ev.seq = st.seq
+	st.events = append(st.events, ev)
+	st.size += ev.size()
+	for st.size > st.maxBytes && len(st.events) > 1 {
+		st.size -= st.events[0].size()
+		st.events = st.events[1:]
+	}
+	close(st.changed)
+	st.changed = make(chan struct{})
+}
+
+// size approximates the memory an event takes in the buffer.
+func (ev streamEvent) size() int {
+	n := 64 + len(ev.chunk.Output)
+	if ev.err != nil {
+		n += len(ev.err.Error())
+	}
+	return n
+}
+
+func (st *execStream) end() {
+	st.mu.Lock()
+	st.ended = true
+	if st.idle != nil {
+		st.idle.Stop()
+	}
+	close(st.changed)
+	st.changed = make(chan struct{})
+	st.mu.Unlock()
+
+	st.cancel()
+	if st.resume > 0 {
+		time.AfterFunc(st.resume, st.onEnd)
+	} else {
+		st.onEnd()
+	}
+}
+
+// since returns the events after seq, whether the stream has ended and a
+// channel that is closed on the next change. It fails with errStreamOverrun
+// when events after seq were already dropped.
+func (st *execStream) since(seq int64) ([]streamEvent, bool, <-chan struct{}, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq > st.seq {
+		return nil, false, nil, fmt.Errorf("event %d not sent yet", seq)
+	}
+	if len(st.events) > 0 && st.events[0].seq > seq+1 {
+		return nil, false, nil, errStreamOverrun
+	}
+	if len(st.events) == 0 {
+		return nil, st.ended, st.changed, nil
+	}
+	return st.events[seq+1-st.events[0].seq:], st.ended, st.changed, nil
+}
+
+func (st *execStream) attach() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.watchers++
+	if st.idle != nil {
+		st.idle.Stop()
+		st.idle = nil
+	}
+}
+
+// detach lets go of a client. Without clients a running command is
+// cancelled unless one reconnects within resume.
+func (st *execStream) detach() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.watchers--
+	if st.watchers > 0 || st.ended {
+		return
+	}
+	if st.resume <= 0 {
+		st.cancel()
+		return
+	}
+	st.idle = time.AfterFunc(st.resume, st.cancel)
+}
+
+// follow opens the response at event seq, writes the events after it and
+// then new ones as they arrive, until the stream ends or ctx is done. Every
+// keepAlive without events it writes a keep-alive; 0 disables them.
+func (st *execStream) follow(ctx context.Context, events execEventWriter, seq int64, keepAlive time.Duration) {
+	st.attach()
+	defer st.detach()
+	events.open(st.eventID(seq))
+
+	var tick <-chan time.Time
+	if keepAlive > 0 {
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		pending, ended, changed, err := st.since(seq)
+		if err != nil {
+			events.fail("", err)
+			return
+		}
+		for _, ev := range pending {
+			id := st.eventID(ev.seq)
+			switch ev.name {
+			case "chunk":
+				events.chunk(id, ev.chunk.Output, ev.chunk.Timestamp)
+			case "done":
+				events.done(id, ev.chunk)
+			case "error":
+				events.fail(id, ev.err)
+			}
+			seq = ev.seq
+		}
+		if ended {
+			return
+		}
+		select {
+		case <-changed:
+		case <-tick:
+			events.keepAlive()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// streamKeepAlive returns the interval of stream keep-alives.
+func (s *Server) streamKeepAlive() time.Duration {
+	return time.Duration(s.cfg.HTTP.StreamKeepAliveSeconds) * time.Second
+}
+
+// startExecStream runs the exec req in the background and registers its
+// stream. The command is not tied to the request, so that it survives a
+// dropped connection.
+func (s *Server) startExecStream(r *http.Request, id string, req execRequest) *execStream {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	st := newExecStream(id, cancel, time.Duration(s.cfg.HTTP.StreamResumeSeconds)*time.Second, s.cfg.HTTP.StreamResumeBufferBytes)
+	st.tenant = session.TenantFrom(r.Context())
+	st.onEnd = func() { s.streams.remove(st.id) }
+	s.streams.add(st)
+	go st.run(func(chunkChan chan<- session.ExecChunk) error {
+		return s.manager.ExecStream(ctx, id, req.Cmd, req.execOpts(), chunkChan)
+	})
+	return st
+}
+
+// handleResumeExecStream reattaches a client that sent Last-Event-ID to its
+// exec stream, replaying the events it missed. The request body is ignored.
+func (s *Server) handleResumeExecStream(w http.ResponseWriter, r *http.Request, id, lastEventID string) {
+	streamID, seq, err := parseEventID(lastEventID)
+	if err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	// Another tenant's stream is gone as far as this key can tell.
+	st := s.streams.get(streamID)
+	if st == nil || st.sessionID != id || st.tenant != session.TenantFrom(r.Context()) {
+		writeError(w, http.StatusGone, APIError{
+			Code:    ErrCodeStreamGone,
+			Message: fmt.Sprintf("exec stream %s is gone; it ended more than %ds ago or never existed", streamID, s.cfg.HTTP.StreamResumeSeconds),
+		})
+		return
+	}
+	if _, _, _, err := st.since(seq); err != nil {
+		writeError(w, http.StatusGone, APIError{Code: ErrCodeStreamGone, Message: err.Error()})
+		return
+	}
+
+	events, err := newExecEventWriter(w, r)
+	if err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	s.logger.Debug("exec stream resume", "session_id", id, "stream_id", streamID, "after", seq)
+	w.Header().Set(StreamIDHeader, st.id)
+	st.follow(r.Context(), events, seq, s.streamKeepAlive())
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func execStreamRequest(ctx context.Context, lastEventID string) *http.Request {
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/exec/stream", strings.NewReader(`{"cmd":"make"}`)).WithContext(ctx)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Accept", "application/x-ndjson")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return req
+}
+
+func TestHandleExecStream_Resume(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.HTTP.StreamResumeSeconds = 60
+	release := make(chan struct{})
+	var execErr error
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "make", session.ExecOpts{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			ch := args.Get(4).(chan<- session.ExecChunk)
+			<-release
+			execErr = args.Get(0).(context.Context).Err()
+			ch <- session.ExecChunk{Output: "compiling\n", Timestamp: 1707390000000}
+			ch <- session.ExecChunk{Output: "linking\n", Timestamp: 1707390004500}
+			ch <- session.ExecChunk{Done: true, Cwd: "/workspace", DurationMs: 4600}
+		}).Return(nil)
+
+	// The client goes away while the build is quiet.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(ctx, ""))
+	assert.Empty(t, rec.Body.String())
+	sid := rec.Header().Get(StreamIDHeader)
+	require.NotEmpty(t, sid)
+	close(release)
+
+	rec = httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(context.Background(), sid+"-0"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, execErr, "the exec outlives the first connection")
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"id":"`+sid+`-1","type":"chunk","chunk":"compiling\n","timestamp":1707390000000}`, lines[0])
+	assert.JSONEq(t, `{"id":"`+sid+`-3","type":"done","exit_code":0,"cwd":"/workspace","duration_ms":4600}`, lines[2])
+
+	// Finished streams can still be resumed.
+	rec = httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(context.Background(), sid+"-2"))
+	assert.JSONEq(t, `{"id":"`+sid+`-3","type":"done","exit_code":0,"cwd":"/workspace","duration_ms":4600}`, strings.TrimSpace(rec.Body.String()))
+	mockMgr.AssertNumberOfCalls(t, "ExecStream", 1)
+}
+
+func TestHandleExecStream_ResumeGone(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	rec := httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(context.Background(), "0b7c51f6-5d57-4f43-8f2c-6f0e0b1a2c3d-4"))
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeStreamGone)
+
+	rec = httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(context.Background(), "nonsense"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestHandleExecStream_ResumeOtherTenant checks that a stream ID alone does
+// not let another tenant's key replay the output.
+func TestHandleExecStream_ResumeOtherTenant(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.HTTP.StreamResumeSeconds = 60
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "make", session.ExecOpts{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			args.Get(4).(chan<- session.ExecChunk) <- session.ExecChunk{Done: true, Output: "secret\n", Cwd: "/workspace"}
+		}).Return(nil)
+
+	rec := httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(session.WithTenant(context.Background(), "acme"), ""))
+	sid := rec.Header().Get(StreamIDHeader)
+	require.NotEmpty(t, sid)
+
+	for _, tenant := range []string{"other", ""} {
+		rec = httptest.NewRecorder()
+		s.handleExecStream(rec, execStreamRequest(session.WithTenant(context.Background(), tenant), sid+"-0"))
+		assert.Equal(t, http.StatusGone, rec.Code, "tenant %q", tenant)
+		assert.Contains(t, rec.Body.String(), ErrCodeStreamGone)
+		assert.NotContains(t, rec.Body.String(), "secret")
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleExecStream(rec, execStreamRequest(session.WithTenant(context.Background(), "acme"), sid+"-0"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "secret")
+}
+
+func TestHandleExecStream_CancelWithoutResume(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	cancelled := make(chan struct{})
+	mockMgr.On("ExecStream", mock.Anything, "a1b2c3d4-e5f", "make", session.ExecOpts{}, mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+			close(cancelled)
+		}).Return(context.Canceled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.handleExecStream(httptest.NewRecorder(), execStreamRequest(ctx, ""))
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exec not cancelled after the client left")
+	}
+}
+
+func TestExecStream_KeepAlive(t *testing.T) {
+	st := newExecStream("a1b2c3d4-e5f", func() {}, time.Minute, 0)
+	rec := httptest.NewRecorder()
+	events, err := newExecEventWriter(rec, httptest.NewRequest("POST", "/", nil))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	st.follow(ctx, events, 0, 10*time.Millisecond)
+
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "id: "+st.id+"-0\n\n: keep-alive\n\n"), rec.Body.String())
+}
+
+func TestExecStream_Overrun(t *testing.T) {
+	st := newExecStream("a1b2c3d4-e5f", func() {}, time.Minute, 250)
+	for i := 0; i < 3; i++ {
+		st.push(streamEvent{name: "chunk", chunk: session.ExecChunk{Output: strings.Repeat("x", 50)}})
+	}
+
+	_, _, _, err := st.since(0)
+	assert.ErrorIs(t, err, errStreamOverrun)
+	events, _, _, err := st.since(1)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/failpoint"
+)
+
+// The failpoint routes exist only when failpoints are enabled (build tag
+// failpoints or SANDKASTEN_FAILPOINTS); they are for chaos tests, not production.
+
+type setFailpointRequest struct {
+	Action string `json:"action"`
+}
+
+func (s *Server) handleListFailpoints(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, failpoint.List())
+}
+
+func (s *Server) handleSetFailpoint(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req setFailpointRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if err := failpoint.Set(name, req.Action); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	s.logger.Warn("failpoint set", "name", name, "action", req.Action)
+	writeJSON(w, http.StatusOK, failpoint.List())
+}
+
+func (s *Server) handleClearFailpoint(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "all" {
+		failpoint.Reset()
+	} else {
+		failpoint.Clear(name)
+	}
+	s.logger.Warn("failpoint cleared", "name", name)
+	writeJSON(w, http.StatusOK, failpoint.List())
+}
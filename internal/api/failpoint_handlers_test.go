@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/failpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSetAndClearFailpoint(t *testing.T) {
+	failpoint.Enable()
+	t.Cleanup(failpoint.Reset)
+	s := testAPIServer(&MockSessionService{})
+	s.mux.HandleFunc("PUT /v1/admin/failpoints/{name}", s.handleSetFailpoint)
+	s.mux.HandleFunc("DELETE /v1/admin/failpoints/{name}", s.handleClearFailpoint)
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("PUT", "/v1/admin/failpoints/runner_connect", strings.NewReader(`{"action":"3*error"}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []failpoint.Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	assert.Contains(t, list, failpoint.Status{Name: "runner_connect", Action: "3*error", Remaining: 3})
+	assert.ErrorIs(t, failpoint.Inject(failpoint.RunnerConnect), failpoint.ErrInjected)
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("DELETE", "/v1/admin/failpoints/runner_connect", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, failpoint.Inject(failpoint.RunnerConnect))
+}
+
+func TestHandleSetFailpointInvalid(t *testing.T) {
+	failpoint.Enable()
+	t.Cleanup(failpoint.Reset)
+	s := testAPIServer(&MockSessionService{})
+	s.mux.HandleFunc("PUT /v1/admin/failpoints/{name}", s.handleSetFailpoint)
+
+	for path, body := range map[string]string{
+		"/v1/admin/failpoints/store_write": `{"action":"explode"}`,
+		"/v1/admin/failpoints/nope":        `{"action":"error"}`,
+	} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+	}
+}
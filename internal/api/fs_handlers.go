@@ -2,6 +2,7 @@ package api
 
 import (
 	"io"
+	"mime"
 	"net/http"
 	"path/filepath"
 	"strconv"
@@ -21,7 +22,7 @@ func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req writeRequest
-	if err := decodeJSONBody(w, r, &req); err != nil {
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
 		writeValidationError(w, "invalid json: "+err.Error(), nil)
 		return
 	}
@@ -160,6 +161,40 @@ func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleDownload streams a file from the session's /workspace as raw bytes.
+// Unlike fs/read it is not limited by max_bytes and supports Range requests.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if err := validateReadRequest(path, 0); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("fs download", "session_id", id, "path", path)
+	f, err := s.manager.OpenFile(r.Context(), id, path)
+	if err != nil {
+		s.logger.Error("download", "session_id", id, "error", err)
+		writeAPIError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	name := filepath.Base(path)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
 // extractContent returns content and whether it's base64 encoded.
 func extractContent(req writeRequest) ([]byte, bool) {
 	if req.ContentBase64 != "" {
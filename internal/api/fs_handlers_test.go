@@ -7,6 +7,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -248,3 +250,41 @@ func TestValidateWorkspaceFilePath(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleDownload_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	tmp := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(tmp, []byte("a,b\n1,2\n"), 0644))
+	f, err := os.Open(tmp)
+	require.NoError(t, err)
+	mockMgr.On("OpenFile", mock.Anything, "a1b2c3d4-e5f", "/workspace/out/report.csv").Return(f, nil)
+
+	req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/fs/download?path=/workspace/out/report.csv", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleDownload(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "a,b\n1,2\n", rec.Body.String())
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=report.csv`, rec.Header().Get("Content-Disposition"))
+}
+
+func TestHandleDownload_NotFound(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("OpenFile", mock.Anything, "a1b2c3d4-e5f", "/workspace/nope").Return(nil, fmt.Errorf("%w: /workspace/nope", session.ErrFileNotFound))
+
+	req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/fs/download?path=/workspace/nope", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleDownload(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeFileNotFound)
+}
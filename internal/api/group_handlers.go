@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// maxGroupSize caps how many sessions one group create may start.
+const maxGroupSize = 64
+
+type createGroupRequest struct {
+	createSessionRequest
+	Count int `json:"count"`
+}
+
+func validateCreateGroupRequest(req createGroupRequest) error {
+	if req.Count < 1 || req.Count > maxGroupSize {
+		return fmt.Errorf("count must be between 1 and %d", maxGroupSize)
+	}
+	return validateCreateSessionRequest(req.createSessionRequest)
+}
+
+func (s *Server) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req createGroupRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if err := validateCreateGroupRequest(req); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("create session group", "image", req.Image, "count", req.Count)
+	group, err := s.manager.CreateGroup(r.Context(), session.GroupCreateOpts{
+		CreateOpts: session.CreateOpts{
+			Image:         req.Image,
+			TTLSeconds:    req.TTLSeconds,
+			WorkspaceID:   req.WorkspaceID,
+			Rows:          req.Rows,
+			Cols:          req.Cols,
+			Hostname:      req.Hostname,
+			SharedChannel: req.SharedChannel,
+			Priority:      req.Priority,
+			Determinism:   req.Determinism,
+			CPU:           req.CPU,
+		},
+		Count: req.Count,
+	})
+	if err != nil {
+		s.logger.Error("create session group", "error", err)
+		writeAPIError(w, err)
+		return
+	}
+	s.logger.Debug("session group created", "group_id", group.ID, "count", len(group.Sessions))
+	writeJSON(w, http.StatusCreated, group)
+}
+
+func (s *Server) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := validateGroupID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	group, err := s.manager.GetGroup(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+func (s *Server) handleExecGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := validateGroupID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req execRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if err := validateExecRequest(req); err != nil {
+		writeValidationError(w, err.Error(), validationDetails(err))
+		return
+	}
+	s.logger.Debug("group exec", "group_id", id, "cmd", req.Cmd, "timeout_ms", req.TimeoutMs)
+	results, err := s.manager.ExecGroup(r.Context(), id, req.Cmd, session.ExecOpts{
+		TimeoutMs:    req.TimeoutMs,
+		RawOutput:    req.RawOutput,
+		OutputBase64: req.OutputBase64,
+		Shell:        req.Shell,
+	})
+	if err != nil {
+		s.logger.Error("group exec", "group_id", id, "error", err)
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+func (s *Server) handleDestroyGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := validateGroupID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	s.logger.Debug("destroy session group", "group_id", id)
+	if err := s.manager.DestroyGroup(r.Context(), id); err != nil {
+		s.logger.Error("destroy session group", "group_id", id, "error", err)
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
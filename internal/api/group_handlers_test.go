@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleCreateGroup(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("CreateGroup", mock.Anything, session.GroupCreateOpts{
+		CreateOpts: session.CreateOpts{Image: "python", WorkspaceID: "seed"},
+		Count:      2,
+	}).Return(&session.GroupInfo{
+		ID: "a1b2c3d4-e5f",
+		Sessions: []session.SessionInfo{
+			{ID: "s1", Image: "python", GroupID: "a1b2c3d4-e5f"},
+			{ID: "s2", Image: "python", GroupID: "a1b2c3d4-e5f"},
+		},
+	}, nil)
+
+	body := `{"image":"python","workspace_id":"seed","count":2}`
+	req := httptest.NewRequest("POST", "/v1/groups", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleCreateGroup(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"group_id":"a1b2c3d4-e5f"`)
+}
+
+func TestHandleCreateGroup_InvalidCount(t *testing.T) {
+	for _, body := range []string{`{"image":"python"}`, `{"count":65}`} {
+		s := testAPIServer(&MockSessionService{})
+		req := httptest.NewRequest("POST", "/v1/groups", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		s.handleCreateGroup(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestHandleExecGroup(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ExecGroup", mock.Anything, "a1b2c3d4-e5f", "hostname", session.ExecOpts{}).Return([]session.GroupExecResult{
+		{SessionID: "s1", Result: &session.ExecResult{Output: "sk-s1\n"}},
+		{SessionID: "s2", Error: "session not running"},
+	}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/groups/a1b2c3d4-e5f/exec", strings.NewReader(`{"cmd":"hostname"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleExecGroup(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"session_id":"s2"`)
+	assert.Contains(t, rec.Body.String(), `"error":"session not running"`)
+}
+
+func TestHandleDestroyGroup_NotFound(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("DestroyGroup", mock.Anything, "a1b2c3d4-e5f").Return(fmt.Errorf("%w: a1b2c3d4-e5f", session.ErrGroupNotFound))
+
+	req := httptest.NewRequest("DELETE", "/v1/groups/a1b2c3d4-e5f", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleDestroyGroup(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeGroupNotFound)
+}
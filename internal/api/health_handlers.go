@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/health"
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// HealthProvider reports the daemon's host checks.
+type HealthProvider interface {
+	Status() health.Status
+}
+
+// SetHealth makes /readyz follow the host checks of h and enables
+// GET /v1/system/health.
+func (s *Server) SetHealth(h HealthProvider) {
+	s.health = h
+}
+
+// handleReadyz answers 503 while a host check fails, so load balancers and
+// orchestrators stop sending new sessions to a degraded host. It names the
+// failing checks but, being public, not their details.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.health == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready"})
+		return
+	}
+	st := s.health.Status()
+	if st.Degraded {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "degraded", "failing": st.Failing()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ready"})
+}
+
+// handleHealth lists the host checks with their last result. The details
+// describe the whole host, so tenant keys get 404.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := session.RequireDefaultTenant(r.Context()); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	st := health.Status{Checks: []health.Result{}}
+	if s.health != nil {
+		st = s.health.Status()
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/health"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeHealth health.Status
+
+func (f fakeHealth) Status() health.Status { return health.Status(f) }
+
+func TestHandleReadyz(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	rec := httptest.NewRecorder()
+	s.handleReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ready"}`, rec.Body.String(), "no checks configured")
+
+	s.SetHealth(fakeHealth{Degraded: true, Checks: []health.Result{
+		{Name: "disk_space", OK: false, Detail: "/var/lib/sandkasten has 12 MB free"},
+		{Name: "clock", OK: true},
+	}})
+	rec = httptest.NewRecorder()
+	s.handleReadyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"status":"degraded","failing":["disk_space"]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.handleHealth(rec, httptest.NewRequest("GET", "/v1/system/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "12 MB free")
+}
+
+func TestHandleHealth_TenantKey(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+	s.SetHealth(fakeHealth{Degraded: true, Checks: []health.Result{
+		{Name: "disk_space", OK: false, Detail: "/var/lib/sandkasten has 12 MB free"},
+	}})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/system/health", nil)
+	s.handleHealth(rec, req.WithContext(session.WithTenant(req.Context(), "acme")))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeNotFound)
+	assert.NotContains(t, rec.Body.String(), "12 MB free")
+
+	// The public readiness probe stays open and names only the checks.
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/readyz", nil)
+	s.handleReadyz(rec, req.WithContext(session.WithTenant(req.Context(), "acme")))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
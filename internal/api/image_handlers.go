@@ -0,0 +1,12 @@
+package api
+
+import "net/http"
+
+func (s *Server) handleListImages(w http.ResponseWriter, r *http.Request) {
+	images, err := s.manager.ListImages(r.Context())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"images": images})
+}
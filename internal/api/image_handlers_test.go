@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleListImages(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ListImages", mock.Anything).Return([]session.ImageStatus{
+		{Name: "base", Available: true},
+		{Name: "python", Available: false, Error: "runner not found"},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/images", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleListImages(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result struct {
+		Images []session.ImageStatus `json:"images"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.Len(t, result.Images, 2)
+	assert.False(t, result.Images[1].Available)
+	assert.Equal(t, "runner not found", result.Images[1].Error)
+}
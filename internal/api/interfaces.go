@@ -2,8 +2,13 @@ package api
 
 import (
 	"context"
+	"net"
+	"os"
+	"time"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/p-arndt/sandkasten/internal/store"
 	"github.com/p-arndt/sandkasten/protocol"
 )
 
@@ -11,15 +16,48 @@ type SessionService interface {
 	Create(ctx context.Context, opts session.CreateOpts) (*session.SessionInfo, error)
 	Get(ctx context.Context, id string) (*session.SessionInfo, error)
 	GetStats(ctx context.Context, id string) (*protocol.SessionStats, error)
+	GetStatsHistory(ctx context.Context, id string) (*session.StatsHistory, error)
+	GetRecording(ctx context.Context, sessionID string) (*session.Recording, error)
 	List(ctx context.Context) ([]session.SessionInfo, error)
+	Update(ctx context.Context, sessionID string, opts session.UpdateOpts) (*session.SessionInfo, error)
+	Rebase(ctx context.Context, sessionID, image string) (*session.SessionInfo, error)
 	Destroy(ctx context.Context, sessionID string) error
-	Exec(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool) (*session.ExecResult, error)
-	ExecStream(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool, chunkChan chan<- session.ExecChunk) error
+	CreateGroup(ctx context.Context, opts session.GroupCreateOpts) (*session.GroupInfo, error)
+	GetGroup(ctx context.Context, groupID string) (*session.GroupInfo, error)
+	ExecGroup(ctx context.Context, groupID, cmd string, opts session.ExecOpts) ([]session.GroupExecResult, error)
+	DestroyGroup(ctx context.Context, groupID string) error
+	Resize(ctx context.Context, sessionID string, rows, cols int) error
+	Exec(ctx context.Context, sessionID, cmd string, opts session.ExecOpts) (*session.ExecResult, error)
+	ExecStream(ctx context.Context, sessionID, cmd string, opts session.ExecOpts, chunkChan chan<- session.ExecChunk) error
+	ExecOutput(ctx context.Context, sessionID, execID string, offset, limit int) (*session.OutputPage, error)
+	RunTests(ctx context.Context, sessionID string, opts session.TestOpts) (*session.TestReport, error)
+	ExpiresIn(ctx context.Context, sessionID string) (time.Duration, bool)
 	Write(ctx context.Context, sessionID, path string, content []byte, isBase64 bool) error
 	Read(ctx context.Context, sessionID, path string, maxBytes int) (string, bool, error)
+	OpenFile(ctx context.Context, sessionID, path string) (*os.File, error)
 	ListWorkspaces(ctx context.Context) ([]*session.WorkspaceInfo, error)
+	WorkspaceRetention(ctx context.Context) (*session.WorkspaceRetentionReport, error)
+	GetWorkspace(ctx context.Context, workspaceID string) (*session.WorkspaceInfo, error)
+	UpdateWorkspace(ctx context.Context, workspaceID string, opts session.WorkspaceUpdate) (*session.WorkspaceInfo, error)
 	DeleteWorkspace(ctx context.Context, workspaceID string) error
+	ListDeletedWorkspaces(ctx context.Context) ([]*session.WorkspaceInfo, error)
+	RestoreWorkspace(ctx context.Context, workspaceID string) (*session.WorkspaceInfo, error)
 	ListWorkspaceFiles(ctx context.Context, workspaceID, path string) ([]session.WorkspaceFileEntry, error)
 	ReadWorkspaceFile(ctx context.Context, workspaceID, path string, maxBytes int) (contentBase64 string, truncated bool, err error)
 	WriteWorkspaceFile(ctx context.Context, workspaceID, path string, content []byte, isBase64 bool) error
+	CopyWorkspaceFiles(ctx context.Context, workspaceID string, opts session.CopyOpts) (*session.CopyResult, error)
+	ListImages(ctx context.Context) ([]session.ImageStatus, error)
+	WarmPool(ctx context.Context, image string, size int) (*session.PoolWarmResult, error)
+	PoolStatus(ctx context.Context) (*session.PoolStatus, error)
+	DrainPool(ctx context.Context, image string, refill bool) (*session.PoolDrainResult, error)
+	RefillPool(ctx context.Context, image string) (*session.PoolRefillResult, error)
+	ListAuditEvents(ctx context.Context, sessionID string, limit int) ([]*store.AuditEvent, error)
+	SummarizeUsage(ctx context.Context, groupBy string, since, until time.Time) ([]*store.UsageSummary, error)
+	ListCreateFailures(ctx context.Context, limit int) ([]*store.CreateFailure, error)
+	ListApprovals(ctx context.Context) ([]session.Approval, error)
+	GetApproval(ctx context.Context, id string) (*session.Approval, error)
+	DecideApproval(ctx context.Context, id string, approve bool) (*session.Approval, error)
+	GetOperation(ctx context.Context, id string) (*session.Operation, error)
+	DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error)
+	Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error)
 }
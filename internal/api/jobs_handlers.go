@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/jobs"
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// JobStatusProvider reports the daemon's background jobs.
+type JobStatusProvider interface {
+	Status() []jobs.Status
+}
+
+// SetJobs enables GET /v1/system/jobs.
+func (s *Server) SetJobs(j JobStatusProvider) {
+	s.jobs = j
+}
+
+// handleJobs lists the background jobs with their state and last run. The
+// jobs work on every tenant's sessions, so tenant keys get 404.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if err := session.RequireDefaultTenant(r.Context()); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	list := []jobs.Status{}
+	if s.jobs != nil {
+		list = s.jobs.Status()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": list})
+}
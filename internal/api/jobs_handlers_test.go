@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/jobs"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJobs []jobs.Status
+
+func (f fakeJobs) Status() []jobs.Status { return f }
+
+func TestHandleJobs(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	rec := httptest.NewRecorder()
+	s.handleJobs(rec, httptest.NewRequest("GET", "/v1/system/jobs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"jobs":[]}`, rec.Body.String(), "no runner set")
+
+	s.SetJobs(fakeJobs{{Name: "reaper", State: jobs.StateIdle, Runs: 3, Failures: 1, LastError: "list expired: busy"}})
+	rec = httptest.NewRecorder()
+	s.handleJobs(rec, httptest.NewRequest("GET", "/v1/system/jobs", nil))
+	var result struct {
+		Jobs []jobs.Status `json:"jobs"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.Len(t, result.Jobs, 1)
+	assert.Equal(t, "reaper", result.Jobs[0].Name)
+	assert.Equal(t, "list expired: busy", result.Jobs[0].LastError)
+}
+
+func TestHandleJobs_TenantKey(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+	s.SetJobs(fakeJobs{{Name: "reaper", State: jobs.StateIdle}})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/system/jobs", nil)
+	s.handleJobs(rec, req.WithContext(session.WithTenant(req.Context(), "acme")))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeNotFound)
+	assert.NotContains(t, rec.Body.String(), "reaper")
+}
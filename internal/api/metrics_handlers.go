@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+// handleMetrics serves the process metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Default.WritePrometheus(w)
+}
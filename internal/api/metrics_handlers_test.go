@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleMetrics(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "# TYPE sandkasten_store_query_duration_seconds histogram")
+	assert.Contains(t, rec.Body.String(), "# TYPE sandkasten_store_busy_retries_total counter")
+}
@@ -2,16 +2,19 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/session"
 )
 
 type contextKey string
 
 const requestIDKey contextKey = "request_id"
 
+// dashboardCookieName holds a dashboard session ID, never the API key.
 const dashboardCookieName = "sandkasten_dashboard"
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
@@ -34,26 +37,49 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 		auth := r.Header.Get("Authorization")
 		token := strings.TrimPrefix(auth, "Bearer ")
 		if token != auth && token == s.cfg.APIKey {
+			next.ServeHTTP(w, r.WithContext(session.WithAPIKey(r.Context(), s.cfg.APIKey)))
+			return
+		}
+		if tenant, ok := s.tenantForToken(token); token != auth && ok {
+			ctx := session.WithTenant(session.WithAPIKey(r.Context(), token), tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		if token != auth && s.isApproverToken(token) && isApprovalPath(path) {
 			next.ServeHTTP(w, r)
 			return
 		}
+		if tok, ok := s.verifyWorkspaceToken(token); token != auth && ok {
+			if !tok.allows(r.Method, path) {
+				writeForbiddenError(w, "workspace token does not grant "+r.Method+" "+path)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(session.WithTenant(r.Context(), tok.Tenant)))
+			return
+		}
 
-		// Accept dashboard cookie (for browser form posts and dashboard pages)
-		if c, _ := r.Cookie(dashboardCookieName); c != nil && c.Value == s.cfg.APIKey {
-			next.ServeHTTP(w, r)
+		// Accept a dashboard login (API key or SSO), limited by the user's
+		// role. Cookie-authenticated writes must carry the login's CSRF token.
+		// The port proxy serves sandbox content on the daemon's origin, so it
+		// never accepts the cookie: scripts of the proxied app would otherwise
+		// act as the logged-in user.
+		if u, id := s.dashboardUserFromRequest(r); u != nil && !isProxyPath(path) {
+			if !isSafeMethod(r.Method) && !s.hasValidCSRF(r, id) {
+				writeForbiddenError(w, "missing or invalid CSRF token")
+				return
+			}
+			if !roleAllows(u.Role, r.Method, path) {
+				writeForbiddenError(w, "role "+u.Role+" may not "+r.Method+" "+path)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(session.WithAPIKey(r.Context(), s.cfg.APIKey)))
 			return
 		}
 
-		// Login flow: ?api_key=xxx sets cookie and redirects
-		if r.Method == http.MethodGet && r.URL.Query().Get("api_key") == s.cfg.APIKey {
-			http.SetCookie(w, &http.Cookie{
-				Name:     dashboardCookieName,
-				Value:    s.cfg.APIKey,
-				Path:     "/",
-				MaxAge:   86400 * 7, // 7 days
-				HttpOnly: true,
-				SameSite: http.SameSiteLaxMode,
-			})
+		// Login flow: ?api_key=xxx starts a dashboard session and redirects
+		if r.Method == http.MethodGet && s.dash != nil && !isProxyPath(path) &&
+			subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("api_key")), []byte(s.cfg.APIKey)) == 1 {
+			s.signIn(w, r, s.apiKeyUser())
 			q := r.URL.Query()
 			q.Del("api_key")
 			redirectURL := r.URL.Path
@@ -68,14 +94,68 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// isApproverToken reports whether token is the configured approver key.
+func (s *Server) isApproverToken(token string) bool {
+	key := s.cfg.Approval.ApproverKey
+	return key != "" && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
+
+// tenantForToken returns the tenant whose API key is token.
+func (s *Server) tenantForToken(token string) (string, bool) {
+	for _, t := range s.cfg.Tenants {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.APIKey)) == 1 {
+			return t.Name, true
+		}
+	}
+	return "", false
+}
+
+func isApprovalPath(path string) bool {
+	for _, prefix := range []string{"/v1/approvals", "/v2/approvals"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isProxyPath reports whether path is under /v{1,2}/sessions/{id}/proxy/.
+func isProxyPath(path string) bool {
+	for _, prefix := range []string{"/v1/sessions/", "/v2/sessions/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			_, sub, _ := strings.Cut(rest, "/")
+			return sub == "proxy" || strings.HasPrefix(sub, "proxy/")
+		}
+	}
+	return false
+}
+
+// isAPIPath reports whether path is under /v1/ or /v2/.
+func isAPIPath(path string) bool {
+	for _, prefix := range []string{"/v1", "/v2"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func isPublicPath(path, method string) bool {
-	if path == "/healthz" || path == "/" || strings.HasPrefix(path, "/_app/") {
+	if path == "/healthz" || path == "/readyz" || path == "/" || strings.HasPrefix(path, "/_app/") {
 		return true
 	}
-	if path == "/dashboard/login" && method == http.MethodPost {
+	if (path == "/dashboard/login" || path == "/dashboard/logout") && method == http.MethodPost {
+		return true
+	}
+	if (path == "/dashboard/oidc/login" || path == "/dashboard/oidc/callback") && method == http.MethodGet {
 		return true
 	}
 
+	// Static dashboard assets by suffix; the API, including proxied session
+	// ports whose paths end in anything, always needs a key.
+	if isAPIPath(path) || isProxyPath(path) {
+		return false
+	}
 	if strings.HasSuffix(path, ".js") ||
 		strings.HasSuffix(path, ".css") ||
 		strings.HasSuffix(path, ".svg") ||
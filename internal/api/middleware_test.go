@@ -205,3 +205,72 @@ func TestRequestIDMiddleware_PreservesID(t *testing.T) {
 	assert.Equal(t, "my-custom-id", gotID)
 	assert.Equal(t, "my-custom-id", rec.Header().Get("X-Request-ID"))
 }
+
+func TestAuthMiddleware_ApproverKeyOnlyForApprovals(t *testing.T) {
+	s := testServer("sk-test-key")
+	s.cfg.Approval.ApproverKey = "sk-approver"
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/approvals", nil)
+	req.Header.Set("Authorization", "Bearer sk-approver")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest("GET", "/v1/sessions", nil)
+	req.Header.Set("Authorization", "Bearer sk-approver")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthMiddleware_TenantKey(t *testing.T) {
+	s := testServer("sk-test-key")
+	s.cfg.Tenants = []config.TenantConfig{{Name: "acme", APIKey: "sk-acme"}}
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/v1/sessions", nil)
+	req.Header.Set("Authorization", "Bearer sk-acme")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Tenant keys are not accepted as dashboard cookies.
+	req = httptest.NewRequest("GET", "/v1/sessions", nil)
+	req.AddCookie(&http.Cookie{Name: dashboardCookieName, Value: "sk-acme"})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthMiddleware_StaticSuffixNotPublicOnAPI(t *testing.T) {
+	s := testServer("sk-test-key")
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/v1/sessions/a1b2c3d4-e5f/proxy/5173/app.js"},
+		{"POST", "/v1/sessions/a1b2c3d4-e5f/proxy/5173/app.js"},
+		{"GET", "/v2/sessions/a1b2c3d4-e5f/proxy/5173/assets/index.css"},
+		{"GET", "/v1/sessions/a1b2c3d4-e5f/proxy/8080/favicon.ico"},
+		{"GET", "/v1/sessions/a1b2c3d4-e5f/fs/read/logo.png"},
+		{"GET", "/v1/workspaces/ws1/files/font.woff2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "%s %s must require auth", tt.method, tt.path)
+		})
+	}
+}
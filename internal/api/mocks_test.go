@@ -2,8 +2,13 @@ package api
 
 import (
 	"context"
+	"net"
+	"os"
+	"time"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/p-arndt/sandkasten/internal/store"
 	"github.com/p-arndt/sandkasten/protocol"
 	"github.com/stretchr/testify/mock"
 )
@@ -36,6 +41,14 @@ func (m *MockSessionService) GetStats(ctx context.Context, id string) (*protocol
 	return nil, args.Error(1)
 }
 
+func (m *MockSessionService) GetStatsHistory(ctx context.Context, id string) (*session.StatsHistory, error) {
+	args := m.Called(ctx, id)
+	if history := args.Get(0); history != nil {
+		return history.(*session.StatsHistory), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockSessionService) List(ctx context.Context) ([]session.SessionInfo, error) {
 	args := m.Called(ctx)
 	if sessions := args.Get(0); sessions != nil {
@@ -44,24 +57,82 @@ func (m *MockSessionService) List(ctx context.Context) ([]session.SessionInfo, e
 	return nil, args.Error(1)
 }
 
+func (m *MockSessionService) Update(ctx context.Context, sessionID string, opts session.UpdateOpts) (*session.SessionInfo, error) {
+	args := m.Called(ctx, sessionID, opts)
+	if info := args.Get(0); info != nil {
+		return info.(*session.SessionInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) Rebase(ctx context.Context, sessionID, image string) (*session.SessionInfo, error) {
+	args := m.Called(ctx, sessionID, image)
+	if info := args.Get(0); info != nil {
+		return info.(*session.SessionInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) Resize(ctx context.Context, sessionID string, rows, cols int) error {
+	args := m.Called(ctx, sessionID, rows, cols)
+	return args.Error(0)
+}
+
 func (m *MockSessionService) Destroy(ctx context.Context, sessionID string) error {
 	args := m.Called(ctx, sessionID)
 	return args.Error(0)
 }
 
-func (m *MockSessionService) Exec(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool) (*session.ExecResult, error) {
-	args := m.Called(ctx, sessionID, cmd, timeoutMs, rawOutput)
+func (m *MockSessionService) CreateGroup(ctx context.Context, opts session.GroupCreateOpts) (*session.GroupInfo, error) {
+	args := m.Called(ctx, opts)
+	if group := args.Get(0); group != nil {
+		return group.(*session.GroupInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) GetGroup(ctx context.Context, groupID string) (*session.GroupInfo, error) {
+	args := m.Called(ctx, groupID)
+	if group := args.Get(0); group != nil {
+		return group.(*session.GroupInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) ExecGroup(ctx context.Context, groupID, cmd string, opts session.ExecOpts) ([]session.GroupExecResult, error) {
+	args := m.Called(ctx, groupID, cmd, opts)
+	if results := args.Get(0); results != nil {
+		return results.([]session.GroupExecResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) DestroyGroup(ctx context.Context, groupID string) error {
+	args := m.Called(ctx, groupID)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) Exec(ctx context.Context, sessionID, cmd string, opts session.ExecOpts) (*session.ExecResult, error) {
+	args := m.Called(ctx, sessionID, cmd, opts)
 	if result := args.Get(0); result != nil {
 		return result.(*session.ExecResult), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *MockSessionService) ExecStream(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool, chunkChan chan<- session.ExecChunk) error {
-	args := m.Called(ctx, sessionID, cmd, timeoutMs, rawOutput, chunkChan)
+func (m *MockSessionService) ExecStream(ctx context.Context, sessionID, cmd string, opts session.ExecOpts, chunkChan chan<- session.ExecChunk) error {
+	args := m.Called(ctx, sessionID, cmd, opts, chunkChan)
 	return args.Error(0)
 }
 
+func (m *MockSessionService) ExecOutput(ctx context.Context, sessionID, execID string, offset, limit int) (*session.OutputPage, error) {
+	args := m.Called(ctx, sessionID, execID, offset, limit)
+	if page := args.Get(0); page != nil {
+		return page.(*session.OutputPage), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockSessionService) Write(ctx context.Context, sessionID, path string, content []byte, isBase64 bool) error {
 	args := m.Called(ctx, sessionID, path, content, isBase64)
 	return args.Error(0)
@@ -72,6 +143,22 @@ func (m *MockSessionService) Read(ctx context.Context, sessionID, path string, m
 	return args.String(0), args.Bool(1), args.Error(2)
 }
 
+func (m *MockSessionService) OpenFile(ctx context.Context, sessionID, path string) (*os.File, error) {
+	args := m.Called(ctx, sessionID, path)
+	if f := args.Get(0); f != nil {
+		return f.(*os.File), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) WorkspaceRetention(ctx context.Context) (*session.WorkspaceRetentionReport, error) {
+	args := m.Called(ctx)
+	if rep := args.Get(0); rep != nil {
+		return rep.(*session.WorkspaceRetentionReport), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockSessionService) ListWorkspaces(ctx context.Context) ([]*session.WorkspaceInfo, error) {
 	args := m.Called(ctx)
 	if ws := args.Get(0); ws != nil {
@@ -80,6 +167,30 @@ func (m *MockSessionService) ListWorkspaces(ctx context.Context) ([]*session.Wor
 	return nil, args.Error(1)
 }
 
+func (m *MockSessionService) GetWorkspace(ctx context.Context, workspaceID string) (*session.WorkspaceInfo, error) {
+	args := m.Called(ctx, workspaceID)
+	if ws := args.Get(0); ws != nil {
+		return ws.(*session.WorkspaceInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) UpdateWorkspace(ctx context.Context, workspaceID string, opts session.WorkspaceUpdate) (*session.WorkspaceInfo, error) {
+	args := m.Called(ctx, workspaceID, opts)
+	if ws := args.Get(0); ws != nil {
+		return ws.(*session.WorkspaceInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) CopyWorkspaceFiles(ctx context.Context, workspaceID string, opts session.CopyOpts) (*session.CopyResult, error) {
+	args := m.Called(ctx, workspaceID, opts)
+	if res := args.Get(0); res != nil {
+		return res.(*session.CopyResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockSessionService) DeleteWorkspace(ctx context.Context, workspaceID string) error {
 	args := m.Called(ctx, workspaceID)
 	return args.Error(0)
@@ -102,3 +213,152 @@ func (m *MockSessionService) WriteWorkspaceFile(ctx context.Context, workspaceID
 	args := m.Called(ctx, workspaceID, path, content, isBase64)
 	return args.Error(0)
 }
+
+func (m *MockSessionService) ListAuditEvents(ctx context.Context, sessionID string, limit int) ([]*store.AuditEvent, error) {
+	args := m.Called(ctx, sessionID, limit)
+	if events := args.Get(0); events != nil {
+		return events.([]*store.AuditEvent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) ListCreateFailures(ctx context.Context, limit int) ([]*store.CreateFailure, error) {
+	args := m.Called(ctx, limit)
+	if failures := args.Get(0); failures != nil {
+		return failures.([]*store.CreateFailure), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) PoolStatus(ctx context.Context) (*session.PoolStatus, error) {
+	args := m.Called(ctx)
+	if res := args.Get(0); res != nil {
+		return res.(*session.PoolStatus), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) DrainPool(ctx context.Context, image string, refill bool) (*session.PoolDrainResult, error) {
+	args := m.Called(ctx, image, refill)
+	if res := args.Get(0); res != nil {
+		return res.(*session.PoolDrainResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) RefillPool(ctx context.Context, image string) (*session.PoolRefillResult, error) {
+	args := m.Called(ctx, image)
+	if res := args.Get(0); res != nil {
+		return res.(*session.PoolRefillResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) WarmPool(ctx context.Context, image string, size int) (*session.PoolWarmResult, error) {
+	args := m.Called(ctx, image, size)
+	if res := args.Get(0); res != nil {
+		return res.(*session.PoolWarmResult), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) ListImages(ctx context.Context) ([]session.ImageStatus, error) {
+	args := m.Called(ctx)
+	if images := args.Get(0); images != nil {
+		return images.([]session.ImageStatus), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) ListApprovals(ctx context.Context) ([]session.Approval, error) {
+	args := m.Called(ctx)
+	if approvals := args.Get(0); approvals != nil {
+		return approvals.([]session.Approval), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) RunTests(ctx context.Context, sessionID string, opts session.TestOpts) (*session.TestReport, error) {
+	args := m.Called(ctx, sessionID, opts)
+	if res := args.Get(0); res != nil {
+		return res.(*session.TestReport), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) ExpiresIn(ctx context.Context, sessionID string) (time.Duration, bool) {
+	args := m.Called(ctx, sessionID)
+	return args.Get(0).(time.Duration), args.Bool(1)
+}
+
+func (m *MockSessionService) ListDeletedWorkspaces(ctx context.Context) ([]*session.WorkspaceInfo, error) {
+	args := m.Called(ctx)
+	if ws := args.Get(0); ws != nil {
+		return ws.([]*session.WorkspaceInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) RestoreWorkspace(ctx context.Context, workspaceID string) (*session.WorkspaceInfo, error) {
+	args := m.Called(ctx, workspaceID)
+	if ws := args.Get(0); ws != nil {
+		return ws.(*session.WorkspaceInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) GetOperation(ctx context.Context, id string) (*session.Operation, error) {
+	args := m.Called(ctx, id)
+	if op := args.Get(0); op != nil {
+		return op.(*session.Operation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) GetApproval(ctx context.Context, id string) (*session.Approval, error) {
+	args := m.Called(ctx, id)
+	if a := args.Get(0); a != nil {
+		return a.(*session.Approval), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) DecideApproval(ctx context.Context, id string, approve bool) (*session.Approval, error) {
+	args := m.Called(ctx, id, approve)
+	if a := args.Get(0); a != nil {
+		return a.(*session.Approval), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) GetRecording(ctx context.Context, sessionID string) (*session.Recording, error) {
+	args := m.Called(ctx, sessionID)
+	if rec := args.Get(0); rec != nil {
+		return rec.(*session.Recording), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	args := m.Called(ctx, sessionID, opts)
+	if term := args.Get(0); term != nil {
+		return term.(runtime.Terminal), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	args := m.Called(ctx, sessionID, port)
+	if conn := args.Get(0); conn != nil {
+		return conn.(net.Conn), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionService) SummarizeUsage(ctx context.Context, groupBy string, since, until time.Time) ([]*store.UsageSummary, error) {
+	args := m.Called(ctx, groupBy, since, until)
+	if usage := args.Get(0); usage != nil {
+		return usage.([]*store.UsageSummary), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// TestOpenAPISpecMatchesRoutes keeps docs/openapi.yaml, from which the SDK
+// clients are generated, in step with the routes the server mounts.
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	data, err := os.ReadFile("../../docs/openapi.yaml")
+	require.NoError(t, err)
+	var spec struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	require.NoError(t, yaml.Unmarshal(data, &spec))
+
+	var documented []string
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	s := NewServer(&config.Config{APIKey: "sk-test"}, &MockSessionService{}, nil, "", logger)
+	var mounted []string
+	for _, r := range s.apiRoutes {
+		if !strings.Contains(r, " /admin/") { // test-only, not in the spec
+			// OpenAPI has no multi-segment wildcard: {path...} is written {path}.
+			mounted = append(mounted, strings.ReplaceAll(r, "...}", "}"))
+		}
+	}
+
+	sort.Strings(documented)
+	sort.Strings(mounted)
+	assert.Equal(t, mounted, documented)
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+func (s *Server) handleGetOperation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeValidationError(w, "invalid operation id", nil)
+		return
+	}
+	op, err := s.manager.GetOperation(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, op)
+}
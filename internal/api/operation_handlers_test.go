@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testOperationID = "6f1c2a3b-4d5e-4f60-8a7b-9c0d1e2f3a4b"
+
+func TestHandleCreateSession_QueuedReturnsAccepted(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Create", mock.Anything, session.CreateOpts{Image: "python"}).
+		Return(nil, &session.QueuedCreateError{Operation: session.Operation{ID: testOperationID, Status: session.OperationQueued}})
+
+	req := httptest.NewRequest("POST", "/v1/sessions", strings.NewReader(`{"image":"python"}`))
+	rec := httptest.NewRecorder()
+
+	s.handleCreateSession(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"operation_id":"`+testOperationID+`"`)
+	assert.Contains(t, rec.Body.String(), `"status":"queued"`)
+}
+
+func TestHandleGetOperation(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetOperation", mock.Anything, testOperationID).Return(&session.Operation{
+		ID: testOperationID, Kind: session.OperationKindCreate, Status: session.OperationCompleted,
+		Result: &session.SessionInfo{ID: "abcdef12-345"},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/operations/"+testOperationID, nil)
+	req.SetPathValue("id", testOperationID)
+	rec := httptest.NewRecorder()
+
+	s.handleGetOperation(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"completed"`)
+	assert.Contains(t, rec.Body.String(), `"abcdef12-345"`)
+}
+
+func TestHandleGetOperation_NotFound(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetOperation", mock.Anything, testOperationID).
+		Return(nil, fmt.Errorf("%w: %s", session.ErrOperationNotFound, testOperationID))
+
+	req := httptest.NewRequest("GET", "/v1/operations/"+testOperationID, nil)
+	req.SetPathValue("id", testOperationID)
+	rec := httptest.NewRecorder()
+
+	s.handleGetOperation(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeOperationNotFound)
+}
+
+func TestHandleGetOperation_InvalidID(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	req := httptest.NewRequest("GET", "/v1/operations/nope", nil)
+	req.SetPathValue("id", "nope")
+	rec := httptest.NewRecorder()
+
+	s.handleGetOperation(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
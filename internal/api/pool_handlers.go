@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxPoolWarmSize caps the idle sessions a single warm request can ask for.
+const maxPoolWarmSize = 256
+
+type warmPoolRequest struct {
+	Image string `json:"image"`
+	Size  *int   `json:"size"`
+}
+
+func (s *Server) handleWarmPool(w http.ResponseWriter, r *http.Request) {
+	var req warmPoolRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if req.Size == nil {
+		writeValidationError(w, "size is required", nil)
+		return
+	}
+	if *req.Size < 0 || *req.Size > maxPoolWarmSize {
+		writeValidationError(w, fmt.Sprintf("size must be between 0 and %d", maxPoolWarmSize), nil)
+		return
+	}
+
+	s.logger.Debug("warm pool", "image", req.Image, "size", *req.Size)
+	res, err := s.manager.WarmPool(r.Context(), req.Image, *req.Size)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, res)
+}
+
+func (s *Server) handlePoolStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := s.manager.PoolStatus(r.Context())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+type drainPoolRequest struct {
+	Image  string `json:"image"`
+	Refill bool   `json:"refill"`
+}
+
+// handleDrainPool destroys idle pooled sessions. An empty body drains every
+// image.
+func (s *Server) handleDrainPool(w http.ResponseWriter, r *http.Request) {
+	var req drainPoolRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil && err != io.EOF {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("drain pool", "image", req.Image, "refill", req.Refill)
+	res, err := s.manager.DrainPool(r.Context(), req.Image, req.Refill)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type refillPoolRequest struct {
+	Image string `json:"image"`
+}
+
+// handleRefillPool starts filling the pool up to its targets. An empty body
+// refills every image.
+func (s *Server) handleRefillPool(w http.ResponseWriter, r *http.Request) {
+	var req refillPoolRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil && err != io.EOF {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("refill pool", "image", req.Image)
+	res, err := s.manager.RefillPool(r.Context(), req.Image)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, res)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/pool"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleWarmPool(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("WarmPool", mock.Anything, "python", 4).Return(&session.PoolWarmResult{Image: "python", Size: 4, Previous: 1}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/pool/warm", strings.NewReader(`{"image":"python","size":4}`))
+	rec := httptest.NewRecorder()
+	s.handleWarmPool(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var res session.PoolWarmResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, 1, res.Previous)
+}
+
+func TestHandleWarmPoolValidation(t *testing.T) {
+	for name, body := range map[string]string{
+		"missing size": `{"image":"python"}`,
+		"negative":     `{"image":"python","size":-1}`,
+		"too large":    `{"image":"python","size":100000}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockMgr := &MockSessionService{}
+			s := testAPIServer(mockMgr)
+
+			req := httptest.NewRequest("POST", "/v1/pool/warm", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			s.handleWarmPool(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			mockMgr.AssertNotCalled(t, "WarmPool", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandleWarmPoolDisabled(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("WarmPool", mock.Anything, "", 2).Return(nil, session.ErrPoolDisabled)
+
+	req := httptest.NewRequest("POST", "/v1/pool/warm", strings.NewReader(`{"size":2}`))
+	rec := httptest.NewRecorder()
+	s.handleWarmPool(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodePoolDisabled)
+}
+
+func TestHandlePoolStatus(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("PoolStatus", mock.Anything).Return(&session.PoolStatus{Keys: []pool.KeyStatus{
+		{Image: "python", Target: 2, Idle: 1, Healthy: 1, Sessions: []pool.IdleSession{{ID: "p1", AgeSeconds: 30, Healthy: true}}},
+	}}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/pool", nil)
+	rec := httptest.NewRecorder()
+	s.handlePoolStatus(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var res session.PoolStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	require.Len(t, res.Keys, 1)
+	assert.Equal(t, "p1", res.Keys[0].Sessions[0].ID)
+}
+
+func TestHandleDrainPool(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("DrainPool", mock.Anything, "python", true).Return(&session.PoolDrainResult{Image: "python", Discarded: 2, Refilling: true}, nil)
+	mockMgr.On("DrainPool", mock.Anything, "", false).Return(&session.PoolDrainResult{Discarded: 5}, nil)
+
+	req := httptest.NewRequest("POST", "/v1/pool/drain", strings.NewReader(`{"image":"python","refill":true}`))
+	rec := httptest.NewRecorder()
+	s.handleDrainPool(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"image":"python","discarded":2,"refilling":true}`, rec.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/pool/drain", nil)
+	rec = httptest.NewRecorder()
+	s.handleDrainPool(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "an empty body drains every image")
+	assert.JSONEq(t, `{"discarded":5,"refilling":false}`, rec.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/pool/drain", strings.NewReader(`{"image":`))
+	rec = httptest.NewRecorder()
+	s.handleDrainPool(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandleRefillPool(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	mockMgr.On("RefillPool", mock.Anything, "python").Return(&session.PoolRefillResult{Image: "python", Missing: 3}, nil)
+	mockMgr.On("RefillPool", mock.Anything, "").Return(nil, session.ErrPoolDisabled)
+
+	req := httptest.NewRequest("POST", "/v1/pool/refill", strings.NewReader(`{"image":"python"}`))
+	rec := httptest.NewRecorder()
+	s.handleRefillPool(rec, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"image":"python","missing":3}`, rec.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/pool/refill", nil)
+	rec = httptest.NewRecorder()
+	s.handleRefillPool(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodePoolDisabled)
+}
+
+func TestPoolRoutes_TenantKey(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+	s.cfg.APIKey = "sk-test-key"
+	s.cfg.Tenants = []config.TenantConfig{{Name: "acme", APIKey: "sk-acme"}}
+	s.routes()
+	acme := mock.MatchedBy(func(ctx context.Context) bool { return session.TenantFrom(ctx) == "acme" })
+	denied := fmt.Errorf("%w: acme", session.ErrDefaultTenant)
+	mockMgr.On("WarmPool", acme, "", 256).Return(nil, denied)
+	mockMgr.On("PoolStatus", acme).Return(nil, denied)
+	mockMgr.On("DrainPool", acme, "", false).Return(nil, denied)
+	mockMgr.On("RefillPool", acme, "").Return(nil, denied)
+
+	for route, body := range map[string]string{"POST /v1/pool/warm": `{"size":256}`, "GET /v1/pool": "", "POST /v1/pool/drain": "", "POST /v1/pool/refill": ""} {
+		method, path, _ := strings.Cut(route, " ")
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer sk-acme")
+		rec := httptest.NewRecorder()
+		s.authMiddleware(s.mux).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code, route)
+		assert.Contains(t, rec.Body.String(), ErrCodeNotFound, route)
+	}
+	mockMgr.AssertExpectations(t)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+)
+
+// proxyCSP is set on every proxied response. It allows scripts, forms and
+// popups, but not allow-same-origin.
+const proxyCSP = "sandbox allow-scripts allow-forms allow-popups allow-modals allow-downloads"
+
+// handleProxy reverse-proxies a request to an HTTP service listening on
+// {port} inside the session, e.g. a dev server. The runner relays each
+// connection, so this works in every network mode. WebSocket upgrades pass
+// through.
+func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	port, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil || port < 1 || port > 65535 {
+		writeValidationError(w, "port must be between 1 and 65535", map[string]interface{}{"port": r.PathValue("port")})
+		return
+	}
+	path := "/" + r.PathValue("path")
+	prefix := strings.TrimSuffix(r.URL.Path, path)
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = "localhost:" + strconv.Itoa(port)
+			pr.Out.URL.Path = path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = pr.Out.URL.Host
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			stripCredentials(pr.Out)
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return s.manager.DialPort(ctx, id, port)
+			},
+			// Each request gets its own relayed connection, so idle
+			// connections never pin a session's runner.
+			DisableKeepAlives: true,
+		},
+		FlushInterval: -1, // stream server-sent events and chunked output as they arrive
+		ModifyResponse: func(resp *http.Response) error {
+			// Proxied pages share the daemon's origin. The sandbox policy
+			// gives them an opaque origin, so their scripts cannot read
+			// dashboard pages or send requests with the daemon's cookies.
+			resp.Header.Set("Content-Security-Policy", proxyCSP)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.logger.Debug("proxy", "session_id", id, "port", port, "error", err)
+			writeAPIError(w, err)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// stripCredentials keeps the daemon's API key out of the sandbox: it drops
+// the Authorization header and the dashboard cookie, keeping other cookies
+// for the proxied service.
+func stripCredentials(r *http.Request) {
+	r.Header.Del("Authorization")
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != dashboardCookieName {
+			r.AddCookie(c)
+		}
+	}
+}
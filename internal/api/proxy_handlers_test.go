@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyTestServer(mgr SessionService) *Server {
+	s := testAPIServer(mgr)
+	s.mux.HandleFunc("GET /v1/sessions/{id}/proxy/{port}/{path...}", s.handleProxy)
+	s.mux.HandleFunc("POST /v1/sessions/{id}/proxy/{port}/{path...}", s.handleProxy)
+	return s
+}
+
+func TestHandleProxy_Success(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	devServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("X-Dev", "1")
+		fmt.Fprint(w, "hello from the sandbox")
+	}))
+	defer devServer.Close()
+
+	mockMgr := &MockSessionService{}
+	s := proxyTestServer(mockMgr)
+	conn, err := net.Dial("tcp", devServer.Listener.Addr().String())
+	require.NoError(t, err)
+	mockMgr.On("DialPort", mock.Anything, "a1b2c3d4-e5f", 5173).Return(conn, nil).Once()
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/proxy/5173/api/items?page=2", strings.NewReader("name=x"))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	req.AddCookie(&http.Cookie{Name: dashboardCookieName, Value: "sk-secret"})
+	req.AddCookie(&http.Cookie{Name: "app", Value: "1"})
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "hello from the sandbox", rec.Body.String())
+	assert.Equal(t, "1", rec.Header().Get("X-Dev"))
+	assert.Equal(t, proxyCSP, rec.Header().Get("Content-Security-Policy"))
+
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/api/items", got.URL.Path)
+	assert.Equal(t, "page=2", got.URL.RawQuery)
+	assert.Equal(t, "localhost:5173", got.Host)
+	assert.Equal(t, "name=x", gotBody)
+	assert.Equal(t, "/v1/sessions/a1b2c3d4-e5f/proxy/5173", got.Header.Get("X-Forwarded-Prefix"))
+	assert.Empty(t, got.Header.Get("Authorization"))
+	assert.Equal(t, "app=1", got.Header.Get("Cookie"))
+}
+
+func TestHandleProxy_Root(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := proxyTestServer(mockMgr)
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/proxy/3000", nil))
+
+	assert.Equal(t, 3, rec.Code/100, "want a redirect, got %d", rec.Code)
+	assert.Equal(t, "/v1/sessions/a1b2c3d4-e5f/proxy/3000/", rec.Header().Get("Location"))
+}
+
+func TestHandleProxy_InvalidPort(t *testing.T) {
+	s := proxyTestServer(&MockSessionService{})
+
+	for _, port := range []string{"0", "70000", "http"} {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/proxy/"+port+"/", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, port)
+	}
+}
+
+func TestHandleProxy_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("proxy to port 3000: %w: connection refused", session.ErrPortUnreachable), http.StatusBadGateway, ErrCodePortUnreachable},
+		{session.ErrProxyUnsupported, http.StatusNotImplemented, ErrCodeProxyUnsupported},
+		{fmt.Errorf("%w: a1b2c3d4-e5f", session.ErrNotFound), http.StatusNotFound, ErrCodeSessionNotFound},
+	}
+	for _, tt := range tests {
+		mockMgr := &MockSessionService{}
+		s := proxyTestServer(mockMgr)
+		mockMgr.On("DialPort", mock.Anything, "a1b2c3d4-e5f", 3000).Return(nil, tt.err)
+
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/proxy/3000/", nil))
+
+		assert.Equal(t, tt.status, rec.Code, tt.code)
+		assert.Contains(t, rec.Body.String(), tt.code)
+	}
+}
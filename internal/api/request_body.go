@@ -5,10 +5,15 @@ import (
 	"net/http"
 )
 
-const maxJSONBodyBytes int64 = 2 * 1024 * 1024
+// defaultMaxJSONBodyBytes applies when http.max_json_body_bytes is unset.
+const defaultMaxJSONBodyBytes int64 = 2 * 1024 * 1024
 
-func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
-	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodyBytes)
+func (s *Server) decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	limit := defaultMaxJSONBodyBytes
+	if s.cfg.HTTP.MaxJSONBodyBytes > 0 {
+		limit = int64(s.cfg.HTTP.MaxJSONBodyBytes)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
 	dec := json.NewDecoder(r.Body)
 	return dec.Decode(dst)
 }
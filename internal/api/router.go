@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/failpoint"
+	"github.com/p-arndt/sandkasten/internal/oidc"
 	"github.com/p-arndt/sandkasten/internal/store"
 )
 
@@ -14,6 +16,14 @@ type Server struct {
 	manager SessionService
 	logger  *slog.Logger
 	mux     *http.ServeMux
+	oidc    *oidc.Provider     // dashboard SSO; nil = off
+	dash    *dashboardSessions // dashboard logins
+	jobs    JobStatusProvider  // background jobs; nil = none reported
+	health  HealthProvider     // host checks; nil = always ready
+
+	apiRoutes []string // "METHOD /path" mounted by handleAPI, for the OpenAPI sync test
+
+	streams execStreams // exec/stream commands clients can reconnect to
 }
 
 func NewServer(cfg *config.Config, mgr SessionService, st *store.Store, configPath string, logger *slog.Logger) *Server {
@@ -22,51 +32,124 @@ func NewServer(cfg *config.Config, mgr SessionService, st *store.Store, configPa
 		manager: mgr,
 		logger:  logger,
 		mux:     http.NewServeMux(),
+		dash:    newDashboardSessions(),
 	}
 	s.routes()
 	return s
 }
 
 func (s *Server) Handler() http.Handler {
-	return s.authMiddleware(s.requestIDMiddleware(s.debugLogMiddleware(s.mux)))
+	return s.corsMiddleware(s.versionMiddleware(s.requestIDMiddleware(s.accessLogMiddleware(s.compressMiddleware(s.authMiddleware(s.debugLogMiddleware(s.mux)))))))
 }
 
 func (s *Server) routes() {
-	// API routes (with auth)
-	s.mux.HandleFunc("POST /v1/sessions", s.handleCreateSession)
-	s.mux.HandleFunc("GET /v1/sessions", s.handleListSessions)
-	s.mux.HandleFunc("GET /v1/sessions/{id}", s.handleGetSession)
-	s.mux.HandleFunc("GET /v1/sessions/{id}/stats", s.handleGetSessionStats)
-	s.mux.HandleFunc("POST /v1/sessions/{id}/exec", s.handleExec)
-	s.mux.HandleFunc("POST /v1/sessions/{id}/exec/stream", s.handleExecStream)
-	s.mux.HandleFunc("POST /v1/sessions/{id}/fs/write", s.handleWrite)
-	s.mux.HandleFunc("POST /v1/sessions/{id}/fs/upload", s.handleUpload)
-	s.mux.HandleFunc("GET /v1/sessions/{id}/fs/read", s.handleRead)
-	s.mux.HandleFunc("DELETE /v1/sessions/{id}", s.handleDestroy)
+	// API routes (with auth), served under /v1 and /v2; see version.go
+	s.handleAPI("POST", "/sessions", s.handleCreateSession)
+	s.handleAPI("GET", "/sessions", s.handleListSessions)
+	s.handleAPI("GET", "/sessions/{id}", s.handleGetSession)
+	s.handleAPI("GET", "/sessions/{id}/stats", s.handleGetSessionStats)
+	s.handleAPI("GET", "/sessions/{id}/stats/history", s.handleGetSessionStatsHistory)
+	s.handleAPI("GET", "/sessions/{id}/recording", s.handleGetRecording)
+	s.handleAPI("POST", "/sessions/{id}/exec", s.handleExec)
+	s.handleAPI("POST", "/sessions/{id}/exec/stream", s.handleExecStream)
+	s.handleAPI("GET", "/sessions/{id}/execs/{exec_id}/output", s.handleExecOutput)
+	s.handleAPI("POST", "/sessions/{id}/test", s.handleRunTests)
+	s.handleAPI("POST", "/sessions/{id}/fs/write", s.handleWrite)
+	s.handleAPI("POST", "/sessions/{id}/fs/upload", s.handleUpload)
+	s.handleAPI("GET", "/sessions/{id}/fs/read", s.handleRead)
+	s.handleAPI("GET", "/sessions/{id}/fs/download", s.handleDownload)
+	s.handleAPI("PATCH", "/sessions/{id}", s.handleUpdateSession)
+	s.handleAPI("POST", "/sessions/{id}/resize", s.handleResizeSession)
+	s.handleAPI("POST", "/sessions/{id}/rebase", s.handleRebaseSession)
+	s.handleAPI("DELETE", "/sessions/{id}", s.handleDestroy)
+	s.handleAPI("GET", "/sessions/{id}/proxy/{port}/{path...}", s.handleProxy)
+	s.handleAPI("POST", "/sessions/{id}/proxy/{port}/{path...}", s.handleProxy)
+	s.handleAPI("GET", "/sessions/{id}/attach", s.handleAttach)
+
+	// Session groups
+	s.handleAPI("POST", "/groups", s.handleCreateGroup)
+	s.handleAPI("GET", "/groups/{id}", s.handleGetGroup)
+	s.handleAPI("POST", "/groups/{id}/exec", s.handleExecGroup)
+	s.handleAPI("DELETE", "/groups/{id}", s.handleDestroyGroup)
 
 	// Workspace routes (with auth)
-	s.mux.HandleFunc("GET /v1/workspaces", s.handleListWorkspaces)
-	s.mux.HandleFunc("DELETE /v1/workspaces/{id}", s.handleDeleteWorkspace)
-	s.mux.HandleFunc("POST /v1/workspaces/{id}/fs/write", s.handleWriteWorkspaceFile)
-	s.mux.HandleFunc("POST /v1/workspaces/{id}/fs/upload", s.handleUploadWorkspaceFile)
-	s.mux.HandleFunc("GET /v1/workspaces/{id}/fs", s.handleListWorkspaceFiles)
-	s.mux.HandleFunc("GET /v1/workspaces/{id}/fs/read", s.handleReadWorkspaceFile)
+	s.handleAPI("GET", "/workspaces", s.handleListWorkspaces)
+	s.handleAPI("GET", "/workspaces/retention", s.handleWorkspaceRetention)
+	s.handleAPI("GET", "/workspaces/{id}", s.handleGetWorkspace)
+	s.handleAPI("PATCH", "/workspaces/{id}", s.handleUpdateWorkspace)
+	s.handleAPI("DELETE", "/workspaces/{id}", s.handleDeleteWorkspace)
+	s.handleAPI("POST", "/workspaces/{id}/restore", s.handleRestoreWorkspace)
+	s.handleAPI("POST", "/workspaces/{id}/fs/write", s.handleWriteWorkspaceFile)
+	s.handleAPI("POST", "/workspaces/{id}/fs/upload", s.handleUploadWorkspaceFile)
+	s.handleAPI("POST", "/workspaces/{id}/copy-from", s.handleCopyWorkspaceFiles)
+	s.handleAPI("GET", "/workspaces/{id}/fs", s.handleListWorkspaceFiles)
+	s.handleAPI("GET", "/workspaces/{id}/fs/read", s.handleReadWorkspaceFile)
+	s.handleAPI("POST", "/workspaces/{id}/tokens", s.handleCreateWorkspaceToken)
+
+	// Image status (with auth)
+	s.handleAPI("GET", "/images", s.handleListImages)
+	s.handleAPI("GET", "/pool", s.handlePoolStatus)
+	s.handleAPI("POST", "/pool/warm", s.handleWarmPool)
+	s.handleAPI("POST", "/pool/drain", s.handleDrainPool)
+	s.handleAPI("POST", "/pool/refill", s.handleRefillPool)
+
+	// Audit log (with auth)
+	s.handleAPI("GET", "/audit", s.handleListAuditEvents)
+
+	// Usage accounting (with auth)
+	s.handleAPI("GET", "/usage", s.handleUsage)
+
+	// Recent create failures for debugging without host access (with auth)
+	s.handleAPI("GET", "/system/diagnostics", s.handleDiagnostics)
+
+	// Background job status (with auth)
+	s.handleAPI("GET", "/system/jobs", s.handleJobs)
+
+	// Host check results (with auth); /readyz below is the public summary
+	s.handleAPI("GET", "/system/health", s.handleHealth)
+
+	// LLM tool definitions generated from docs/openapi.yaml (with auth)
+	s.handleAPI("GET", "/tools/schema", s.handleToolSchema)
+
+	// Approvals (list/get with API or approver key; decisions need approver key)
+	s.handleAPI("GET", "/approvals", s.handleListApprovals)
+	s.handleAPI("GET", "/approvals/{id}", s.handleGetApproval)
+	s.handleAPI("POST", "/approvals/{id}/approve", s.handleApprove)
+	s.handleAPI("POST", "/approvals/{id}/deny", s.handleDeny)
+
+	// Creates queued at admission.max_sessions (with auth)
+	s.handleAPI("GET", "/operations/{id}", s.handleGetOperation)
+
+	// Prometheus metrics (with auth)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+
+	// Fault injection for chaos tests (with auth) — only when failpoints are enabled
+	if failpoint.Enabled() {
+		s.handleAPI("GET", "/admin/failpoints", s.handleListFailpoints)
+		s.handleAPI("PUT", "/admin/failpoints/{name}", s.handleSetFailpoint)
+		s.handleAPI("DELETE", "/admin/failpoints/{name}", s.handleClearFailpoint)
+	}
 
 	// Dashboard (HTML, same auth as API) — only when enabled
 	if s.cfg.Dashboard.Enabled {
 		s.mux.HandleFunc("GET /", s.handleDashboard)
 		s.mux.HandleFunc("GET /dashboard", s.handleDashboard)
 		s.mux.HandleFunc("POST /dashboard/login", s.handleDashboardLogin)
+		s.mux.HandleFunc("POST /dashboard/logout", s.handleDashboardLogout)
+		s.mux.HandleFunc("GET /dashboard/oidc/login", s.handleOIDCLogin)
+		s.mux.HandleFunc("GET /dashboard/oidc/callback", s.handleOIDCCallback)
 		s.mux.HandleFunc("POST /dashboard/sessions", s.handleDashboardCreateSession)
 		s.mux.HandleFunc("POST /dashboard/sessions/bulk-destroy", s.handleDashboardBulkDestroy)
 		s.mux.HandleFunc("GET /dashboard/playground/{id}", s.handlePlayground)
+		s.mux.HandleFunc("GET /dashboard/sessions/{id}/recording", s.handleDashboardRecording)
 		s.mux.HandleFunc("POST /dashboard/sessions/{id}/destroy", s.handleDashboardDestroy)
 	}
 
 	// Health check (no auth)
 	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "api_versions": apiVersions})
 	})
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -1,20 +1,31 @@
 package api
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
 )
 
 type createSessionRequest struct {
-	Image       string `json:"image"`
-	TTLSeconds  int    `json:"ttl_seconds"`
-	WorkspaceID string `json:"workspace_id"`
+	Image         string `json:"image"`
+	TTLSeconds    int    `json:"ttl_seconds"`
+	WorkspaceID   string `json:"workspace_id"`
+	Rows          int    `json:"rows,omitempty"`
+	Cols          int    `json:"cols,omitempty"`
+	Hostname      string `json:"hostname,omitempty"`
+	SharedChannel string `json:"shared_channel,omitempty"`
+	Priority      string `json:"priority,omitempty"`
+
+	Determinism *runtime.Determinism `json:"determinism,omitempty"`
+	CPU         *runtime.CPUTuning   `json:"cpu,omitempty"`
 }
 
 func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 	var req createSessionRequest
-	if err := decodeJSONBody(w, r, &req); err != nil {
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
 		writeValidationError(w, "invalid json: "+err.Error(), nil)
 		return
 	}
@@ -26,9 +37,16 @@ func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 
 	s.logger.Debug("create session request", "image", req.Image, "ttl_seconds", req.TTLSeconds, "workspace_id", req.WorkspaceID)
 	info, err := s.manager.Create(r.Context(), session.CreateOpts{
-		Image:       req.Image,
-		TTLSeconds:  req.TTLSeconds,
-		WorkspaceID: req.WorkspaceID,
+		Image:         req.Image,
+		TTLSeconds:    req.TTLSeconds,
+		WorkspaceID:   req.WorkspaceID,
+		Rows:          req.Rows,
+		Cols:          req.Cols,
+		Hostname:      req.Hostname,
+		SharedChannel: req.SharedChannel,
+		Priority:      req.Priority,
+		Determinism:   req.Determinism,
+		CPU:           req.CPU,
 	})
 	if err != nil {
 		s.logger.Error("create session", "error", err)
@@ -65,6 +83,100 @@ func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, sessions)
 }
 
+// updateSessionRequest is the PATCH body. ttl_seconds is a number (remaining
+// lifetime from now) or a signed string such as "+600" or "-300" (moves the
+// current expiry). A null label value removes the label.
+type updateSessionRequest struct {
+	TTLSeconds json.RawMessage    `json:"ttl_seconds"`
+	Labels     map[string]*string `json:"labels"`
+}
+
+func (s *Server) handleUpdateSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req updateSessionRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	opts, err := parseUpdateSessionRequest(req)
+	if err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("update session", "session_id", id, "ttl_seconds", string(req.TTLSeconds), "labels", len(req.Labels))
+	info, err := s.manager.Update(r.Context(), id, opts)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+type rebaseSessionRequest struct {
+	Image string `json:"image"`
+}
+
+func (s *Server) handleRebaseSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	// The body is optional: without an image the session is rebased on the
+	// current version of its own image.
+	var req rebaseSessionRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil && err != io.EOF {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("rebase session", "session_id", id, "image", req.Image)
+	info, err := s.manager.Rebase(r.Context(), id, req.Image)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+type resizeSessionRequest struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+func (s *Server) handleResizeSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req resizeSessionRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if req.Rows == 0 && req.Cols == 0 {
+		writeValidationError(w, "rows or cols is required", nil)
+		return
+	}
+	if err := validateTerminalSize(req.Rows, req.Cols); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("resize session", "session_id", id, "rows", req.Rows, "cols", req.Cols)
+	if err := s.manager.Resize(r.Context(), id, req.Rows, req.Cols); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
 func (s *Server) handleDestroy(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if err := ValidateSessionID(id); err != nil {
@@ -95,3 +207,31 @@ func (s *Server) handleGetSessionStats(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, stats)
 }
+
+func (s *Server) handleGetSessionStatsHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	history, err := s.manager.GetStatsHistory(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (s *Server) handleGetRecording(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	rec, err := s.manager.GetRecording(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
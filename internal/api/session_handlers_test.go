@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -102,6 +103,59 @@ func TestHandleCreateSession_ManagerError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
+func TestHandleCreateSession_SharedChannelsDisabled(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Create", mock.Anything, session.CreateOpts{SharedChannel: "results"}).Return(nil, session.ErrSharedChannelsDisabled)
+
+	body := `{"shared_channel":"results"}`
+	req := httptest.NewRequest("POST", "/v1/sessions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleCreateSession(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeChannelsDisabled)
+}
+
+func TestHandleCreateSession_BatchPriority(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Create", mock.Anything, session.CreateOpts{Priority: session.PriorityBatch}).Return(&session.SessionInfo{ID: "s1"}, nil)
+
+	body := `{"priority":"batch"}`
+	req := httptest.NewRequest("POST", "/v1/sessions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleCreateSession(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleCreateSession_Determinism(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	det := &runtime.Determinism{Seed: 42, Clock: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), TZ: "Europe/Berlin"}
+	mockMgr.On("Create", mock.Anything, session.CreateOpts{Determinism: det}).Return(&session.SessionInfo{ID: "s1", Determinism: det}, nil)
+
+	body := `{"determinism":{"seed":42,"clock":"2024-01-02T03:04:05Z","tz":"Europe/Berlin"}}`
+	req := httptest.NewRequest("POST", "/v1/sessions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleCreateSession(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"clock":"2024-01-02T03:04:05Z"`)
+	mockMgr.AssertExpectations(t)
+}
+
 func TestHandleGetSession_Success(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
@@ -142,6 +196,37 @@ func TestHandleGetSession_NotFound(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
 
+func TestHandleGetSessionStatsHistory(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetStatsHistory", mock.Anything, "a1b2c3d4-e5f").Return(&session.StatsHistory{
+		SessionID:       "a1b2c3d4-e5f",
+		IntervalSeconds: 15,
+		Thrashing:       true,
+		Samples:         []session.StatsSample{},
+	}, nil)
+	mockMgr.On("GetStatsHistory", mock.Anything, "00000000-001").Return(nil, fmt.Errorf("%w: 00000000-001", session.ErrNotFound))
+
+	req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/stats/history", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+	s.handleGetSessionStatsHistory(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var history session.StatsHistory
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	assert.True(t, history.Thrashing)
+	assert.Equal(t, 15, history.IntervalSeconds)
+
+	req = httptest.NewRequest("GET", "/v1/sessions/00000000-001/stats/history", nil)
+	req.SetPathValue("id", "00000000-001")
+	rec = httptest.NewRecorder()
+	s.handleGetSessionStatsHistory(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
 func TestHandleListSessions(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
@@ -192,3 +277,163 @@ func TestHandleDestroy_NotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 }
+
+func TestHandleUpdateSession_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	ttl := 600
+	owner := "alice"
+	now := time.Now().UTC()
+	mockMgr.On("Update", mock.Anything, "a1b2c3d4-e5f", session.UpdateOpts{
+		TTLSeconds: &ttl,
+		TTLDelta:   true,
+		Labels:     map[string]*string{"owner": &owner, "stale": nil},
+	}).Return(&session.SessionInfo{
+		ID:        "a1b2c3d4-e5f",
+		Status:    "running",
+		Labels:    map[string]string{"owner": "alice"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(20 * time.Minute),
+	}, nil)
+
+	body := `{"ttl_seconds":"+600","labels":{"owner":"alice","stale":null}}`
+	req := httptest.NewRequest("PATCH", "/v1/sessions/a1b2c3d4-e5f", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleUpdateSession(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var info session.SessionInfo
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&info))
+	assert.Equal(t, map[string]string{"owner": "alice"}, info.Labels)
+}
+
+func TestHandleRebaseSession(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Rebase", mock.Anything, "a1b2c3d4-e5f", "python-patched").Return(&session.SessionInfo{
+		ID: "a1b2c3d4-e5f", Image: "python-patched", Status: "running", ImageDigest: "sha256:new",
+	}, nil)
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/rebase", strings.NewReader(`{"image":"python-patched"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleRebaseSession(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"image_digest":"sha256:new"`)
+
+	// Without a body the session stays on its image.
+	mockMgr.On("Rebase", mock.Anything, "a1b2c3d4-e5f", "").Return(nil, session.ErrRebaseUnsupported)
+	req = httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/rebase", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec = httptest.NewRecorder()
+
+	s.handleRebaseSession(rec, req)
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeNoRebase)
+}
+
+func TestHandleUpdateSession_ValidationError(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	req := httptest.NewRequest("PATCH", "/v1/sessions/a1b2c3d4-e5f", strings.NewReader(`{"ttl_seconds":"600"}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleUpdateSession(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockMgr.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleResizeSession_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Resize", mock.Anything, "a1b2c3d4-e5f", 50, 200).Return(nil)
+
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/resize", strings.NewReader(`{"rows":50,"cols":200}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleResizeSession(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ok":true}`, rec.Body.String())
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleResizeSession_ValidationError(t *testing.T) {
+	for _, body := range []string{`{}`, `{"rows":0,"cols":0}`, `{"cols":1001}`, `{"rows":-1}`} {
+		mockMgr := &MockSessionService{}
+		s := testAPIServer(mockMgr)
+
+		req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/resize", strings.NewReader(body))
+		req.SetPathValue("id", "a1b2c3d4-e5f")
+		rec := httptest.NewRecorder()
+
+		s.handleResizeSession(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		mockMgr.AssertNotCalled(t, "Resize", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestHandleUpdateSession_Expired(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("Update", mock.Anything, "a1b2c3d4-e5f", mock.Anything).
+		Return(nil, fmt.Errorf("%w: a1b2c3d4-e5f", session.ErrExpired))
+
+	req := httptest.NewRequest("PATCH", "/v1/sessions/a1b2c3d4-e5f", strings.NewReader(`{"ttl_seconds":600}`))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleUpdateSession(rec, req)
+
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
+func TestHandleGetRecording_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetRecording", mock.Anything, "a1b2c3d4-e5f").Return(&session.Recording{
+		SessionID: "a1b2c3d4-e5f",
+		Entries:   []session.RecordingEntry{{Seq: 1, Type: "exec", Cmd: "ls"}},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/recording", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleGetRecording(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result session.Recording
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, "ls", result.Entries[0].Cmd)
+}
+
+func TestHandleGetRecording_NotFound(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetRecording", mock.Anything, "a1b2c3d4-e5f").Return(nil, session.ErrNotFound)
+
+	req := httptest.NewRequest("GET", "/v1/sessions/a1b2c3d4-e5f/recording", nil)
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	rec := httptest.NewRecorder()
+
+	s.handleGetRecording(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
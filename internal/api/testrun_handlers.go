@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+type testRequest struct {
+	Framework string   `json:"framework"`
+	Path      string   `json:"path,omitempty"`
+	Args      []string `json:"args,omitempty"`
+	TimeoutMs int      `json:"timeout_ms"`
+}
+
+func (s *Server) handleRunTests(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateSessionID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req testRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if err := validateTestRequest(req); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	s.logger.Debug("run tests", "session_id", id, "framework", req.Framework, "path", req.Path)
+	report, err := s.manager.RunTests(r.Context(), id, session.TestOpts{
+		Framework: req.Framework,
+		Path:      req.Path,
+		Args:      req.Args,
+		TimeoutMs: req.TimeoutMs,
+	})
+	if err != nil {
+		s.logger.Error("run tests", "session_id", id, "error", err)
+		writeAPIError(w, err)
+		return
+	}
+
+	s.setExpiresIn(w, r, id)
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleRunTests(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	opts := session.TestOpts{Framework: "pytest", Path: "tests", Args: []string{"-x"}, TimeoutMs: 60000}
+	mockMgr.On("RunTests", mock.Anything, "a1b2c3d4-e5f", opts).Return(&session.TestReport{
+		Framework: "pytest",
+		Passed:    1,
+		Failed:    1,
+		Cases: []session.TestCase{
+			{Name: "test_a", Suite: "tests.test_m", Status: session.TestPassed},
+			{Name: "test_b", Suite: "tests.test_m", Status: session.TestFailed, Message: "assert False"},
+		},
+		ExitCode: 1,
+	}, nil)
+
+	body := `{"framework":"pytest","path":"tests","args":["-x"],"timeout_ms":60000}`
+	req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/test", strings.NewReader(body))
+	req.SetPathValue("id", "a1b2c3d4-e5f")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	s.handleRunTests(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report session.TestReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	assert.Equal(t, 1, report.Failed)
+	require.Len(t, report.Cases, 2)
+	assert.Equal(t, "assert False", report.Cases[1].Message)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleRunTests_Invalid(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	for _, body := range []string{`{}`, `{"framework":"mocha"}`, `{"framework":"go","timeout_ms":-1}`, `{"framework":"go","args":["a\u0000b"]}`} {
+		req := httptest.NewRequest("POST", "/v1/sessions/a1b2c3d4-e5f/test", strings.NewReader(body))
+		req.SetPathValue("id", "a1b2c3d4-e5f")
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		s.handleRunTests(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockMgr.AssertNotCalled(t, "RunTests", mock.Anything, mock.Anything, mock.Anything)
+}
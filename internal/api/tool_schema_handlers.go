@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/p-arndt/sandkasten/internal/toolschema"
+)
+
+// handleToolSchema returns the sandbox operations as function definitions for
+// LLM tool calling (?format=openai, the default, or anthropic).
+func (s *Server) handleToolSchema(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = toolschema.FormatOpenAI
+	}
+	tools, routes, err := toolschema.Render(format)
+	if err != nil {
+		writeValidationError(w, err.Error(), map[string]interface{}{"field": "format"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"format": format, "tools": tools, "routes": routes})
+}
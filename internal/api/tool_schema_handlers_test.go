@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleToolSchema(t *testing.T) {
+	s := testAPIServer(&MockSessionService{})
+
+	rec := httptest.NewRecorder()
+	s.handleToolSchema(rec, httptest.NewRequest("GET", "/v1/tools/schema", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var openai struct {
+		Format string `json:"format"`
+		Tools  []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name       string         `json:"name"`
+				Parameters map[string]any `json:"parameters"`
+			} `json:"function"`
+		} `json:"tools"`
+		Routes map[string]string `json:"routes"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&openai))
+	assert.Equal(t, "openai", openai.Format)
+	require.Len(t, openai.Tools, 5)
+	assert.Equal(t, "function", openai.Tools[0].Type)
+	assert.Equal(t, "run_code", openai.Tools[0].Function.Name)
+	assert.Equal(t, "object", openai.Tools[0].Function.Parameters["type"])
+	assert.Equal(t, "GET /v1/sessions/{id}/fs/read", openai.Routes["read_file"])
+
+	rec = httptest.NewRecorder()
+	s.handleToolSchema(rec, httptest.NewRequest("GET", "/v1/tools/schema?format=anthropic", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var anthropic struct {
+		Tools []map[string]any `json:"tools"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&anthropic))
+	require.Len(t, anthropic.Tools, 5)
+	assert.Equal(t, "write_file", anthropic.Tools[2]["name"])
+	assert.Contains(t, anthropic.Tools[2], "input_schema")
+
+	rec = httptest.NewRecorder()
+	s.handleToolSchema(rec, httptest.NewRequest("GET", "/v1/tools/schema?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
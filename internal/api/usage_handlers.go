@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	groupBy := q.Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = "day"
+	case "key", "image", "day":
+	default:
+		writeValidationError(w, "group_by must be one of key, image, day", map[string]interface{}{"field": "group_by"})
+		return
+	}
+
+	since, err := parseUsageTime(q.Get("since"))
+	if err != nil {
+		writeValidationError(w, err.Error(), map[string]interface{}{"field": "since"})
+		return
+	}
+	until, err := parseUsageTime(q.Get("until"))
+	if err != nil {
+		writeValidationError(w, err.Error(), map[string]interface{}{"field": "until"})
+		return
+	}
+
+	usage, err := s.manager.SummarizeUsage(r.Context(), groupBy, since, until)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"group_by": groupBy, "usage": usage})
+}
+
+// parseUsageTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date (UTC
+// midnight). An empty value is the zero time.
+func parseUsageTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or YYYY-MM-DD", v)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUsage_Success(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC)
+	mockMgr.On("SummarizeUsage", mock.Anything, "image", since, until).Return([]*store.UsageSummary{
+		{Group: "python", Sessions: 2, Execs: 5, CPUUsec: 1200},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/usage?group_by=image&since=2026-10-01&until=2026-10-02T12:00:00Z", nil)
+	rec := httptest.NewRecorder()
+
+	s.handleUsage(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result struct {
+		GroupBy string                `json:"group_by"`
+		Usage   []*store.UsageSummary `json:"usage"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Equal(t, "image", result.GroupBy)
+	require.Len(t, result.Usage, 1)
+	assert.Equal(t, "python", result.Usage[0].Group)
+	assert.Equal(t, int64(1200), result.Usage[0].CPUUsec)
+}
+
+func TestHandleUsage_DefaultsToDay(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("SummarizeUsage", mock.Anything, "day", time.Time{}, time.Time{}).Return([]*store.UsageSummary{}, nil)
+
+	rec := httptest.NewRecorder()
+	s.handleUsage(rec, httptest.NewRequest("GET", "/v1/usage", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleUsage_InvalidParams(t *testing.T) {
+	for _, query := range []string{"group_by=session", "since=yesterday", "until=2026-13-01"} {
+		mockMgr := &MockSessionService{}
+		s := testAPIServer(mockMgr)
+
+		rec := httptest.NewRecorder()
+		s.handleUsage(rec, httptest.NewRequest("GET", "/v1/usage?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		mockMgr.AssertNotCalled(t, "SummarizeUsage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestHandleUsage_Disabled(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("SummarizeUsage", mock.Anything, "key", time.Time{}, time.Time{}).Return(nil, session.ErrUsageDisabled)
+
+	rec := httptest.NewRecorder()
+	s.handleUsage(rec, httptest.NewRequest("GET", "/v1/usage?group_by=key", nil))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeUsageDisabled)
+}
+
+func TestHandleUsage_TenantKey(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("SummarizeUsage", mock.Anything, "key", time.Time{}, time.Time{}).Return(nil, fmt.Errorf("%w: acme", session.ErrDefaultTenant))
+
+	rec := httptest.NewRecorder()
+	s.handleUsage(rec, httptest.NewRequest("GET", "/v1/usage?group_by=key", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeNotFound)
+}
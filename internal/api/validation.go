@@ -1,11 +1,17 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/session"
 	"github.com/p-arndt/sandkasten/protocol"
 )
 
@@ -37,6 +43,14 @@ var (
 	// workspaceIDPattern matches valid workspace IDs: lowercase letters, numbers, hyphens
 	// Prevents path traversal when id is used in filepath.Join(dataDir, "workspaces", id).
 	workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*[a-z0-9]$`)
+
+	// hostnamePattern matches a hostname label (RFC 1123): lowercase letters,
+	// numbers and inner hyphens, at most 63 characters.
+	hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+	// zoneLocalePattern matches time zone names (Europe/Berlin) and locale
+	// names (de_DE.UTF-8, sr_RS@latin). Paths are not allowed.
+	zoneLocalePattern = regexp.MustCompile(`^[A-Za-z0-9_+-][A-Za-z0-9_+./@-]{0,63}$`)
 )
 
 // ValidateSessionID returns an error if id is not a valid session ID format.
@@ -81,6 +95,17 @@ func ValidateWorkspaceID(id string) error {
 	return nil
 }
 
+// validateGroupID checks a session group ID; groups use session-style IDs.
+func validateGroupID(id string) error {
+	if id == "" {
+		return fmt.Errorf("group id is required")
+	}
+	if !sessionIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid group id format")
+	}
+	return nil
+}
+
 // validateCreateSessionRequest validates session creation parameters
 func validateCreateSessionRequest(req createSessionRequest) error {
 	// Validate TTL
@@ -91,6 +116,38 @@ func validateCreateSessionRequest(req createSessionRequest) error {
 		return fmt.Errorf("ttl_seconds must not exceed 86400 (24 hours)")
 	}
 
+	if err := validateTerminalSize(req.Rows, req.Cols); err != nil {
+		return err
+	}
+
+	if req.Hostname != "" && !hostnamePattern.MatchString(req.Hostname) {
+		return fmt.Errorf("hostname must be 1-63 lowercase letters, numbers, and hyphens, and cannot start or end with a hyphen")
+	}
+	if req.SharedChannel != "" && !hostnamePattern.MatchString(req.SharedChannel) {
+		return fmt.Errorf("shared_channel must be 1-63 lowercase letters, numbers, and hyphens, and cannot start or end with a hyphen")
+	}
+	switch req.Priority {
+	case "", session.PriorityHigh, session.PriorityNormal, session.PriorityBatch:
+	default:
+		return fmt.Errorf("priority must be one of high, normal, batch")
+	}
+	if c := req.CPU; c != nil {
+		if c.Weight < 0 || c.Weight > config.MaxCPUWeight {
+			return fmt.Errorf("cpu.weight must be between 1 and %d", config.MaxCPUWeight)
+		}
+		if c.BurstMs < 0 {
+			return fmt.Errorf("cpu.burst_ms must be non-negative")
+		}
+	}
+	if det := req.Determinism; det != nil {
+		if det.TZ != "" && (!zoneLocalePattern.MatchString(det.TZ) || strings.Contains(det.TZ, "..")) {
+			return fmt.Errorf("determinism.tz must be a time zone name such as UTC or Europe/Berlin")
+		}
+		if det.Locale != "" && (!zoneLocalePattern.MatchString(det.Locale) || strings.Contains(det.Locale, "..")) {
+			return fmt.Errorf("determinism.locale must be a locale name such as C.UTF-8")
+		}
+	}
+
 	// Validate workspace ID format if provided
 	if req.WorkspaceID != "" {
 		if len(req.WorkspaceID) < 2 {
@@ -107,6 +164,103 @@ func validateCreateSessionRequest(req createSessionRequest) error {
 	return nil
 }
 
+// maxTerminalSize bounds the rows and cols of a session terminal.
+const maxTerminalSize = 1000
+
+// validateTerminalSize checks rows and cols of a terminal; 0 = unchanged.
+func validateTerminalSize(rows, cols int) error {
+	if rows < 0 || rows > maxTerminalSize {
+		return fmt.Errorf("rows must be between 0 and %d", maxTerminalSize)
+	}
+	if cols < 0 || cols > maxTerminalSize {
+		return fmt.Errorf("cols must be between 0 and %d", maxTerminalSize)
+	}
+	return nil
+}
+
+// labelKeyPattern allows label keys like "team", "app.kubernetes.io/name" or "run-id".
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]{0,62}$`)
+
+const (
+	maxSessionLabels   = 64
+	maxLabelValueBytes = 256
+
+	maxWorkspaceDescriptionBytes = 1024
+)
+
+// parseUpdateSessionRequest validates a session PATCH body and converts it to
+// update options.
+func parseUpdateSessionRequest(req updateSessionRequest) (session.UpdateOpts, error) {
+	var opts session.UpdateOpts
+	if len(req.TTLSeconds) > 0 && string(req.TTLSeconds) != "null" {
+		var n int
+		if err := json.Unmarshal(req.TTLSeconds, &n); err == nil {
+			if n < 0 || n > 86400 {
+				return opts, fmt.Errorf("ttl_seconds must be between 0 and 86400 (24 hours)")
+			}
+		} else {
+			var delta string
+			if err := json.Unmarshal(req.TTLSeconds, &delta); err != nil {
+				return opts, fmt.Errorf("ttl_seconds must be a number or a signed string like \"+600\"")
+			}
+			if !strings.HasPrefix(delta, "+") && !strings.HasPrefix(delta, "-") {
+				return opts, fmt.Errorf("ttl_seconds delta must start with + or -")
+			}
+			if n, err = strconv.Atoi(delta); err != nil || n < -86400 || n > 86400 {
+				return opts, fmt.Errorf("ttl_seconds delta must be between -86400 and +86400")
+			}
+			opts.TTLDelta = true
+		}
+		opts.TTLSeconds = &n
+	}
+
+	if err := validateLabelUpdate(req.Labels); err != nil {
+		return opts, err
+	}
+	opts.Labels = req.Labels
+
+	if opts.TTLSeconds == nil && len(opts.Labels) == 0 {
+		return opts, fmt.Errorf("ttl_seconds or labels is required")
+	}
+	return opts, nil
+}
+
+// parseUpdateWorkspaceRequest validates a workspace PATCH body and converts
+// it to update options.
+func parseUpdateWorkspaceRequest(req updateWorkspaceRequest) (session.WorkspaceUpdate, error) {
+	var opts session.WorkspaceUpdate
+	if req.Description != nil && len(*req.Description) > maxWorkspaceDescriptionBytes {
+		return opts, fmt.Errorf("description must not exceed %d bytes", maxWorkspaceDescriptionBytes)
+	}
+	if err := validateLabelUpdate(req.Labels); err != nil {
+		return opts, err
+	}
+	opts.Description = req.Description
+	opts.Labels = req.Labels
+
+	if opts.Description == nil && len(opts.Labels) == 0 {
+		return opts, fmt.Errorf("description or labels is required")
+	}
+	return opts, nil
+}
+
+// validateLabelUpdate checks the labels of a PATCH body, where a null value
+// removes the label.
+func validateLabelUpdate(labels map[string]*string) error {
+	if len(labels) > maxSessionLabels {
+		return fmt.Errorf("at most %d labels may be set per request", maxSessionLabels)
+	}
+	for k, v := range labels {
+		if !labelKeyPattern.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if v != nil && len(*v) > maxLabelValueBytes {
+			return fmt.Errorf("label %q value must not exceed %d bytes", k, maxLabelValueBytes)
+		}
+	}
+	return nil
+}
+
 // validateExecRequest validates command execution parameters
 func validateExecRequest(req execRequest) error {
 	if req.Cmd == "" {
@@ -132,6 +286,36 @@ func validateExecRequest(req execRequest) error {
 		return fmt.Errorf("timeout_ms must not exceed 600000 (10 minutes)")
 	}
 
+	if _, ok := protocol.Shells[req.Shell]; req.Shell != "" && !ok {
+		return fmt.Errorf("shell must be one of %s", strings.Join(slices.Sorted(maps.Keys(protocol.Shells)), ", "))
+	}
+	if (req.Coverage || req.Profile) && req.Shell != "python" {
+		return fmt.Errorf("coverage and profile need shell python")
+	}
+
+	return nil
+}
+
+func validateTestRequest(req testRequest) error {
+	switch req.Framework {
+	case session.TestFrameworkPytest, session.TestFrameworkGo, session.TestFrameworkJest:
+	case "":
+		return fmt.Errorf("framework is required")
+	default:
+		return fmt.Errorf("framework must be one of pytest, go, jest")
+	}
+	// The shell cannot pass NUL bytes on to the framework.
+	for _, arg := range append([]string{req.Path}, req.Args...) {
+		if strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("path and args must not contain NUL bytes")
+		}
+	}
+	if req.TimeoutMs < 0 {
+		return fmt.Errorf("timeout_ms must be non-negative")
+	}
+	if req.TimeoutMs > 600000 {
+		return fmt.Errorf("timeout_ms must not exceed 600000 (10 minutes)")
+	}
 	return nil
 }
 
@@ -173,6 +357,31 @@ func validateWriteWorkspaceRequest(req writeWorkspaceRequest) error {
 	return nil
 }
 
+// maxCopyPaths limits the paths in a single workspace copy request.
+const maxCopyPaths = 100
+
+// validateCopyWorkspaceRequest validates a copy into workspace dst.
+func validateCopyWorkspaceRequest(dst string, req copyWorkspaceRequest) error {
+	if req.Src == "" {
+		return fmt.Errorf("src is required")
+	}
+	if err := ValidateWorkspaceID(req.Src); err != nil {
+		return fmt.Errorf("src: %w", err)
+	}
+	if req.Src == dst {
+		return fmt.Errorf("src must differ from the destination workspace")
+	}
+	if len(req.Paths) > maxCopyPaths {
+		return fmt.Errorf("at most %d paths may be copied per request", maxCopyPaths)
+	}
+	for _, p := range req.Paths {
+		if p == "" || strings.Contains(p, "..") {
+			return fmt.Errorf("invalid path %q", p)
+		}
+	}
+	return nil
+}
+
 // MaxUploadBytes is the maximum size for multipart file uploads (10 MB).
 const MaxUploadBytes = 10 * 1024 * 1024
 
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -64,6 +65,85 @@ func TestValidateCreateSessionRequest(t *testing.T) {
 			name: "valid workspace with hyphens",
 			req:  createSessionRequest{WorkspaceID: "my-cool-workspace-123"},
 		},
+		{
+			name: "valid hostname",
+			req:  createSessionRequest{Hostname: "build-box-1"},
+		},
+		{
+			name:    "hostname with uppercase",
+			req:     createSessionRequest{Hostname: "BuildBox"},
+			wantErr: "hostname must be 1-63 lowercase letters",
+		},
+		{
+			name:    "hostname with dot",
+			req:     createSessionRequest{Hostname: "build.box"},
+			wantErr: "hostname must be 1-63 lowercase letters",
+		},
+		{
+			name:    "hostname too long",
+			req:     createSessionRequest{Hostname: strings.Repeat("a", 64)},
+			wantErr: "hostname must be 1-63 lowercase letters",
+		},
+		{
+			name: "valid shared channel",
+			req:  createSessionRequest{SharedChannel: "results"},
+		},
+		{
+			name:    "shared channel with path",
+			req:     createSessionRequest{SharedChannel: "../results"},
+			wantErr: "shared_channel must be 1-63 lowercase letters",
+		},
+		{
+			name: "valid priority",
+			req:  createSessionRequest{Priority: "batch"},
+		},
+		{
+			name:    "unknown priority",
+			req:     createSessionRequest{Priority: "urgent"},
+			wantErr: "priority must be one of high, normal, batch",
+		},
+		{
+			name: "valid determinism",
+			req:  createSessionRequest{Determinism: &runtime.Determinism{Seed: 7, TZ: "America/Argentina/Buenos_Aires", Locale: "sr_RS.UTF-8@latin"}},
+		},
+		{
+			name:    "determinism tz path",
+			req:     createSessionRequest{Determinism: &runtime.Determinism{TZ: "../../etc/passwd"}},
+			wantErr: "determinism.tz must be a time zone name",
+		},
+		{
+			name:    "determinism locale with space",
+			req:     createSessionRequest{Determinism: &runtime.Determinism{Locale: "C UTF-8"}},
+			wantErr: "determinism.locale must be a locale name",
+		},
+		{
+			name: "valid cpu tuning",
+			req:  createSessionRequest{CPU: &runtime.CPUTuning{Weight: 500, BurstMs: 20}},
+		},
+		{
+			name:    "cpu weight too large",
+			req:     createSessionRequest{CPU: &runtime.CPUTuning{Weight: 20000}},
+			wantErr: "cpu.weight must be between 1 and 10000",
+		},
+		{
+			name:    "negative cpu burst",
+			req:     createSessionRequest{CPU: &runtime.CPUTuning{BurstMs: -1}},
+			wantErr: "cpu.burst_ms must be non-negative",
+		},
+		{
+			name: "valid terminal size",
+			req:  createSessionRequest{Rows: 50, Cols: 200},
+		},
+		{
+			name:    "cols too large",
+			req:     createSessionRequest{Cols: 1001},
+			wantErr: "cols must be between 0 and 1000",
+		},
+		{
+			name:    "negative rows",
+			req:     createSessionRequest{Rows: -1},
+			wantErr: "rows must be between 0 and 1000",
+		},
 	}
 
 	for _, tt := range tests {
@@ -78,6 +158,54 @@ func TestValidateCreateSessionRequest(t *testing.T) {
 	}
 }
 
+func TestParseUpdateSessionRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       string
+		labels    map[string]*string
+		wantTTL   int
+		wantDelta bool
+		wantErr   string
+	}{
+		{name: "absolute", ttl: `600`, wantTTL: 600},
+		{name: "expire now", ttl: `0`, wantTTL: 0},
+		{name: "extend", ttl: `"+300"`, wantTTL: 300, wantDelta: true},
+		{name: "shorten", ttl: `"-300"`, wantTTL: -300, wantDelta: true},
+		{name: "negative absolute", ttl: `-1`, wantErr: "between 0 and 86400"},
+		{name: "absolute too large", ttl: `86401`, wantErr: "between 0 and 86400"},
+		{name: "unsigned string", ttl: `"600"`, wantErr: "must start with + or -"},
+		{name: "bad delta", ttl: `"+ten"`, wantErr: "delta must be between"},
+		{name: "wrong type", ttl: `true`, wantErr: "must be a number or a signed string"},
+		{name: "empty", wantErr: "ttl_seconds or labels is required"},
+		{name: "labels only", labels: map[string]*string{"app.example.com/run": nil}},
+		{name: "bad label key", labels: map[string]*string{"-bad": nil}, wantErr: "invalid label key"},
+		{
+			name:    "label value too long",
+			labels:  map[string]*string{"k": func() *string { v := strings.Repeat("x", 257); return &v }()},
+			wantErr: "must not exceed 256 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseUpdateSessionRequest(updateSessionRequest{TTLSeconds: []byte(tt.ttl), Labels: tt.labels})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.ttl == "" {
+				assert.Nil(t, opts.TTLSeconds)
+				return
+			}
+			if assert.NotNil(t, opts.TTLSeconds) {
+				assert.Equal(t, tt.wantTTL, *opts.TTLSeconds)
+			}
+			assert.Equal(t, tt.wantDelta, opts.TTLDelta)
+		})
+	}
+}
+
 func TestValidateExecRequest(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -112,6 +240,15 @@ func TestValidateExecRequest(t *testing.T) {
 			req:     execRequest{Cmd: strings.Repeat("x", 1024*1024+1)},
 			wantErr: "cmd is too large",
 		},
+		{
+			name: "coverage with python",
+			req:  execRequest{Cmd: "print(1)", Shell: "python", Coverage: true, Profile: true},
+		},
+		{
+			name:    "profile without python",
+			req:     execRequest{Cmd: "ls", Profile: true},
+			wantErr: "coverage and profile need shell python",
+		},
 	}
 
 	for _, tt := range tests {
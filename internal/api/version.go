@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIVersionHeader is set on every response under /v1 and /v2 to the API
+// version that served it.
+const APIVersionHeader = "X-Sandkasten-API-Version"
+
+// API versions. v1 is frozen: fields and routes are only added, never removed
+// or changed in meaning (see docs/api.md). Breaking changes land in v2, which
+// serves the v1 handlers until a route is given a v2 replacement.
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+// apiVersions lists the versions this daemon serves, for /healthz.
+var apiVersions = []string{"v1", "v2"}
+
+// pathAPIVersion returns the version prefix of path, or 0 for unversioned
+// routes (health check, metrics, dashboard).
+func pathAPIVersion(path string) int {
+	switch {
+	case path == "/v1" || strings.HasPrefix(path, "/v1/"):
+		return apiV1
+	case path == "/v2" || strings.HasPrefix(path, "/v2/"):
+		return apiV2
+	}
+	return 0
+}
+
+// responseAPIVersion returns the version versionMiddleware recorded for this
+// response; the header doubles as the version handlers see.
+func responseAPIVersion(w http.ResponseWriter) int {
+	v, _ := strconv.Atoi(w.Header().Get(APIVersionHeader))
+	return v
+}
+
+// versionMiddleware stamps versioned responses with APIVersionHeader. It runs
+// before auth so 401s are also in the caller's version.
+func (s *Server) versionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := pathAPIVersion(r.URL.Path); v != 0 {
+			w.Header().Set(APIVersionHeader, strconv.Itoa(v))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAPI mounts h at path under every API version.
+func (s *Server) handleAPI(method, path string, h http.HandlerFunc) {
+	s.apiRoutes = append(s.apiRoutes, method+" "+path)
+	s.handleVersion(apiV1, method, path, h)
+	s.handleVersion(apiV2, method, path, h)
+}
+
+// handleVersion mounts h at path under one API version. A route that changes
+// incompatibly keeps its old handler under v1 and gets the new one under v2.
+func (s *Server) handleVersion(version int, method, path string, h http.HandlerFunc) {
+	s.mux.HandleFunc(method+" /v"+strconv.Itoa(version)+path, h)
+}
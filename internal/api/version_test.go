@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func versionTestServer(mgr SessionService) http.Handler {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewServer(&config.Config{APIKey: "sk-test"}, mgr, nil, "", logger).Handler()
+}
+
+func TestAPIVersionHeader(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	mockMgr.On("List", mock.Anything).Return([]session.SessionInfo{}, nil)
+	h := versionTestServer(mockMgr)
+
+	for path, want := range map[string]string{
+		"/v1/sessions": "1",
+		"/v2/sessions": "2",
+		"/healthz":     "",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer sk-test")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, want, rec.Header().Get(APIVersionHeader), path)
+	}
+}
+
+func TestAPIErrorFormatPerVersion(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	mockMgr.On("Get", mock.Anything, "abcdef12-345").Return(nil, fmt.Errorf("%w: abcdef12-345", session.ErrNotFound))
+	h := versionTestServer(mockMgr)
+
+	req := httptest.NewRequest("GET", "/v1/sessions/abcdef12-345", nil)
+	req.Header.Set("Authorization", "Bearer sk-test")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	var v1 APIError
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v1))
+	assert.Equal(t, ErrCodeSessionNotFound, v1.Code)
+
+	req = httptest.NewRequest("GET", "/v2/sessions/abcdef12-345", nil)
+	req.Header.Set("Authorization", "Bearer sk-test")
+	req.Header.Set("X-Request-ID", "req-1")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	var v2 v2Error
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v2))
+	assert.Equal(t, ErrCodeSessionNotFound, v2.Error.Code)
+	assert.Equal(t, "req-1", v2.Error.RequestID)
+}
+
+func TestAPIUnauthorizedPerVersion(t *testing.T) {
+	h := versionTestServer(&MockSessionService{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/v2/sessions", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	var v2 v2Error
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v2))
+	assert.Equal(t, ErrCodeUnauthorized, v2.Error.Code)
+	assert.NotEmpty(t, v2.Error.RequestID)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/sessions", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	var v1 map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v1))
+	assert.Equal(t, ErrCodeUnauthorized, v1["error_code"])
+}
+
+func TestPathAPIVersion(t *testing.T) {
+	assert.Equal(t, apiV1, pathAPIVersion("/v1/sessions"))
+	assert.Equal(t, apiV2, pathAPIVersion("/v2/approvals/x"))
+	assert.Equal(t, 0, pathAPIVersion("/v10/sessions"))
+	assert.Equal(t, 0, pathAPIVersion("/metrics"))
+}
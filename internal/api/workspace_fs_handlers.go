@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/session"
 )
 
 type writeWorkspaceRequest struct {
@@ -29,7 +31,7 @@ func (s *Server) handleWriteWorkspaceFile(w http.ResponseWriter, r *http.Request
 	}
 
 	var req writeWorkspaceRequest
-	if err := decodeJSONBody(w, r, &req); err != nil {
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
 		writeValidationError(w, "invalid json: "+err.Error(), nil)
 		return
 	}
@@ -189,3 +191,40 @@ func (s *Server) handleReadWorkspaceFile(w http.ResponseWriter, r *http.Request)
 		"truncated":      truncated,
 	})
 }
+
+// copyWorkspaceRequest copies paths (default: everything) from workspace Src
+// into the workspace in the URL.
+type copyWorkspaceRequest struct {
+	Src       string   `json:"src"`
+	Paths     []string `json:"paths"`
+	Overwrite bool     `json:"overwrite"`
+}
+
+func (s *Server) handleCopyWorkspaceFiles(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateWorkspaceID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req copyWorkspaceRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if err := validateCopyWorkspaceRequest(id, req); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("copy workspace files", "workspace_id", id, "src", req.Src, "paths", len(req.Paths), "overwrite", req.Overwrite)
+	res, err := s.manager.CopyWorkspaceFiles(r.Context(), id, session.CopyOpts{
+		Src:       req.Src,
+		Paths:     req.Paths,
+		Overwrite: req.Overwrite,
+	})
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
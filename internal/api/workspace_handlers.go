@@ -2,10 +2,22 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 )
 
 func (s *Server) handleListWorkspaces(w http.ResponseWriter, r *http.Request) {
-	workspaces, err := s.manager.ListWorkspaces(r.Context())
+	list := s.manager.ListWorkspaces
+	if v := r.URL.Query().Get("deleted"); v != "" {
+		deleted, err := strconv.ParseBool(v)
+		if err != nil {
+			writeValidationError(w, "deleted must be true or false", nil)
+			return
+		}
+		if deleted {
+			list = s.manager.ListDeletedWorkspaces
+		}
+	}
+	workspaces, err := list(r.Context())
 	if err != nil {
 		writeAPIError(w, err)
 		return
@@ -27,3 +39,76 @@ func (s *Server) handleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
 }
+
+// handleRestoreWorkspace moves a deleted workspace back out of the trash.
+func (s *Server) handleGetWorkspace(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateWorkspaceID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	ws, err := s.manager.GetWorkspace(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// updateWorkspaceRequest is the PATCH body for a workspace. A null label
+// value removes the label.
+type updateWorkspaceRequest struct {
+	Description *string            `json:"description"`
+	Labels      map[string]*string `json:"labels"`
+}
+
+func (s *Server) handleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateWorkspaceID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	var req updateWorkspaceRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	opts, err := parseUpdateWorkspaceRequest(req)
+	if err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+
+	s.logger.Debug("update workspace", "workspace_id", id, "labels", len(req.Labels))
+	ws, err := s.manager.UpdateWorkspace(r.Context(), id, opts)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+func (s *Server) handleRestoreWorkspace(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateWorkspaceID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	ws, err := s.manager.RestoreWorkspace(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// handleWorkspaceRetention reports the workspaces past workspace.retention_days
+// without deleting them.
+func (s *Server) handleWorkspaceRetention(w http.ResponseWriter, r *http.Request) {
+	report, err := s.manager.WorkspaceRetention(r.Context())
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
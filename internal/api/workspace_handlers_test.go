@@ -52,6 +52,158 @@ func TestHandleListWorkspaces_Error(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 }
 
+func TestHandleListWorkspaces_Deleted(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("ListDeletedWorkspaces", mock.Anything).Return([]*session.WorkspaceInfo{{ID: "ws-1"}}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/workspaces?deleted=true", nil)
+	rec := httptest.NewRecorder()
+	s.handleListWorkspaces(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "ws-1")
+
+	req = httptest.NewRequest("GET", "/v1/workspaces?deleted=maybe", nil)
+	rec = httptest.NewRecorder()
+	s.handleListWorkspaces(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	mockMgr.AssertExpectations(t)
+}
+
+func TestHandleRestoreWorkspace(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("RestoreWorkspace", mock.Anything, "ws-1").Return(&session.WorkspaceInfo{ID: "ws-1"}, nil)
+	mockMgr.On("RestoreWorkspace", mock.Anything, "ws-2").Return(nil, fmt.Errorf("%w: ws-2", session.ErrWorkspaceExists))
+
+	req := httptest.NewRequest("POST", "/v1/workspaces/ws-1/restore", nil)
+	req.SetPathValue("id", "ws-1")
+	rec := httptest.NewRecorder()
+	s.handleRestoreWorkspace(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"ws-1"}`, rec.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/workspaces/ws-2/restore", nil)
+	req.SetPathValue("id", "ws-2")
+	rec = httptest.NewRecorder()
+	s.handleRestoreWorkspace(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeWorkspaceExists)
+}
+
+func TestHandleGetWorkspace(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("GetWorkspace", mock.Anything, "ws-1").Return(&session.WorkspaceInfo{
+		ID:          "ws-1",
+		Description: "scratch",
+		Labels:      map[string]string{"team": "data"},
+		SizeBytes:   4096,
+	}, nil)
+	mockMgr.On("GetWorkspace", mock.Anything, "ws-2").Return(nil, fmt.Errorf("%w: ws-2", session.ErrWorkspaceNotFound))
+
+	req := httptest.NewRequest("GET", "/v1/workspaces/ws-1", nil)
+	req.SetPathValue("id", "ws-1")
+	rec := httptest.NewRecorder()
+	s.handleGetWorkspace(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"ws-1","description":"scratch","labels":{"team":"data"},"size_bytes":4096}`, rec.Body.String())
+
+	req = httptest.NewRequest("GET", "/v1/workspaces/ws-2", nil)
+	req.SetPathValue("id", "ws-2")
+	rec = httptest.NewRecorder()
+	s.handleGetWorkspace(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleUpdateWorkspace(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	desc := "scratch"
+	mockMgr.On("UpdateWorkspace", mock.Anything, "ws-1", mock.MatchedBy(func(opts session.WorkspaceUpdate) bool {
+		_, removed := opts.Labels["old"]
+		return opts.Description != nil && *opts.Description == desc && removed && opts.Labels["old"] == nil
+	})).Return(&session.WorkspaceInfo{ID: "ws-1", Description: desc}, nil)
+
+	req := httptest.NewRequest("PATCH", "/v1/workspaces/ws-1", strings.NewReader(`{"description":"scratch","labels":{"old":null}}`))
+	req.SetPathValue("id", "ws-1")
+	rec := httptest.NewRecorder()
+	s.handleUpdateWorkspace(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"ws-1","description":"scratch"}`, rec.Body.String())
+
+	for _, body := range []string{`{}`, `{"labels":{"-bad":"x"}}`, `{"description":"` + strings.Repeat("x", 1025) + `"}`} {
+		req = httptest.NewRequest("PATCH", "/v1/workspaces/ws-1", strings.NewReader(body))
+		req.SetPathValue("id", "ws-1")
+		rec = httptest.NewRecorder()
+		s.handleUpdateWorkspace(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockMgr.AssertNumberOfCalls(t, "UpdateWorkspace", 1)
+}
+
+func TestHandleCopyWorkspaceFiles(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("CopyWorkspaceFiles", mock.Anything, "ws-new", session.CopyOpts{Src: "tmpl", Paths: []string{"src"}}).
+		Return(&session.CopyResult{Files: 3, Bytes: 120, Cloned: 3}, nil)
+	mockMgr.On("CopyWorkspaceFiles", mock.Anything, "ws-old", session.CopyOpts{Src: "tmpl"}).
+		Return(nil, fmt.Errorf("%w: README.md", session.ErrFileExists))
+
+	req := httptest.NewRequest("POST", "/v1/workspaces/ws-new/copy-from", strings.NewReader(`{"src":"tmpl","paths":["src"]}`))
+	req.SetPathValue("id", "ws-new")
+	rec := httptest.NewRecorder()
+	s.handleCopyWorkspaceFiles(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"files":3,"bytes":120,"cloned":3}`, rec.Body.String())
+
+	req = httptest.NewRequest("POST", "/v1/workspaces/ws-old/copy-from", strings.NewReader(`{"src":"tmpl"}`))
+	req.SetPathValue("id", "ws-old")
+	rec = httptest.NewRecorder()
+	s.handleCopyWorkspaceFiles(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrCodeFileExists)
+
+	for _, body := range []string{`{}`, `{"src":"ws-new"}`, `{"src":"tmpl","paths":["../etc"]}`, `{"src":"tmpl","paths":[""]}`} {
+		req = httptest.NewRequest("POST", "/v1/workspaces/ws-new/copy-from", strings.NewReader(body))
+		req.SetPathValue("id", "ws-new")
+		rec = httptest.NewRecorder()
+		s.handleCopyWorkspaceFiles(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockMgr.AssertNumberOfCalls(t, "CopyWorkspaceFiles", 2)
+}
+
+func TestHandleWorkspaceRetention(t *testing.T) {
+	mockMgr := &MockSessionService{}
+	s := testAPIServer(mockMgr)
+
+	mockMgr.On("WorkspaceRetention", mock.Anything).Return(&session.WorkspaceRetentionReport{
+		RetentionDays: 30,
+		DryRun:        true,
+		Workspaces:    []*session.IdleWorkspace{{ID: "ws-old", IdleDays: 41}},
+	}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/workspaces/retention", nil)
+	rec := httptest.NewRecorder()
+	s.handleWorkspaceRetention(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result session.WorkspaceRetentionReport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	assert.Equal(t, 30, result.RetentionDays)
+	assert.True(t, result.DryRun)
+	require.Len(t, result.Workspaces, 1)
+	assert.Equal(t, "ws-old", result.Workspaces[0].ID)
+	assert.Equal(t, 41, result.Workspaces[0].IdleDays)
+}
+
 func TestHandleDeleteWorkspace_Success(t *testing.T) {
 	mockMgr := &MockSessionService{}
 	s := testAPIServer(mockMgr)
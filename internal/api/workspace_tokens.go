@@ -0,0 +1,171 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+)
+
+// workspaceTokenPrefix marks workspace access tokens so the auth middleware
+// only tries to verify bearer tokens that can be one.
+const workspaceTokenPrefix = "swt_"
+
+// Workspace token scopes.
+const (
+	WorkspaceScopeUpload   = "upload"   // fs/write and fs/upload
+	WorkspaceScopeDownload = "download" // fs listing and fs/read
+)
+
+const (
+	defaultWorkspaceTokenTTL = time.Hour
+	defaultWorkspaceTokenMax = 24 * time.Hour
+)
+
+// workspaceToken is the signed payload of a workspace access token.
+type workspaceToken struct {
+	Workspace string   `json:"w"`
+	Tenant    string   `json:"t,omitempty"`
+	Scopes    []string `json:"s"`
+	Expires   int64    `json:"e"`
+}
+
+type createWorkspaceTokenRequest struct {
+	Scopes     []string `json:"scopes"`
+	TTLSeconds int      `json:"ttl_seconds"`
+}
+
+type workspaceTokenResponse struct {
+	Token       string    `json:"token"`
+	WorkspaceID string    `json:"workspace_id"`
+	Scopes      []string  `json:"scopes"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (s *Server) handleCreateWorkspaceToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := ValidateWorkspaceID(id); err != nil {
+		writeValidationError(w, err.Error(), nil)
+		return
+	}
+	if !s.cfg.Workspace.Enabled {
+		writeValidationError(w, "workspaces not enabled", nil)
+		return
+	}
+	if s.cfg.APIKey == "" {
+		writeValidationError(w, "workspace tokens require api_key to be configured", nil)
+		return
+	}
+
+	var req createWorkspaceTokenRequest
+	if err := s.decodeJSONBody(w, r, &req); err != nil {
+		writeValidationError(w, "invalid json: "+err.Error(), nil)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		writeValidationError(w, "scopes is required", nil)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if scope != WorkspaceScopeUpload && scope != WorkspaceScopeDownload {
+			writeValidationError(w, "scope must be upload or download", map[string]interface{}{"scope": scope})
+			return
+		}
+	}
+	maxTTL := defaultWorkspaceTokenMax
+	if n := s.cfg.Workspace.TokenMaxTTLSeconds; n > 0 {
+		maxTTL = time.Duration(n) * time.Second
+	}
+	ttl := defaultWorkspaceTokenTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxTTL {
+		writeValidationError(w, "ttl_seconds exceeds the maximum", map[string]interface{}{"max_ttl_seconds": int(maxTTL.Seconds())})
+		return
+	}
+
+	tok := workspaceToken{
+		Workspace: id,
+		Tenant:    session.TenantFrom(r.Context()),
+		Scopes:    req.Scopes,
+		Expires:   time.Now().Add(ttl).Unix(),
+	}
+	s.logger.Info("workspace token minted", "workspace_id", id, "tenant", tok.Tenant, "scopes", tok.Scopes, "ttl", ttl)
+	writeJSON(w, http.StatusCreated, workspaceTokenResponse{
+		Token:       s.signWorkspaceToken(tok),
+		WorkspaceID: id,
+		Scopes:      tok.Scopes,
+		ExpiresAt:   time.Unix(tok.Expires, 0).UTC(),
+	})
+}
+
+// workspaceTokenKey derives the signing key from the main API key, so
+// rotating api_key revokes every outstanding token.
+func (s *Server) workspaceTokenKey() []byte {
+	sum := sha256.Sum256([]byte("sandkasten workspace token\x00" + s.cfg.APIKey))
+	return sum[:]
+}
+
+func (s *Server) signWorkspaceToken(tok workspaceToken) string {
+	payload, _ := json.Marshal(tok)
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, s.workspaceTokenKey())
+	mac.Write([]byte(body))
+	return workspaceTokenPrefix + body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWorkspaceToken returns the payload of a valid, unexpired token.
+func (s *Server) verifyWorkspaceToken(raw string) (*workspaceToken, bool) {
+	rest, ok := strings.CutPrefix(raw, workspaceTokenPrefix)
+	if !ok || s.cfg.APIKey == "" {
+		return nil, false
+	}
+	body, sig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, s.workspaceTokenKey())
+	mac.Write([]byte(body))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, false
+	}
+	var tok workspaceToken
+	if err := json.Unmarshal(payload, &tok); err != nil || time.Now().Unix() >= tok.Expires {
+		return nil, false
+	}
+	return &tok, true
+}
+
+// allows reports whether the token grants method on path: only the file
+// routes of its own workspace, and only those its scopes cover.
+func (t *workspaceToken) allows(method, path string) bool {
+	if pathAPIVersion(path) == 0 {
+		return false
+	}
+	rest, ok := strings.CutPrefix(path[3:], "/workspaces/"+t.Workspace+"/")
+	if !ok {
+		return false
+	}
+	switch {
+	case method == http.MethodPost && (rest == "fs/write" || rest == "fs/upload"):
+		return slices.Contains(t.Scopes, WorkspaceScopeUpload)
+	case method == http.MethodGet && (rest == "fs" || rest == "fs/read"):
+		return slices.Contains(t.Scopes, WorkspaceScopeDownload)
+	}
+	return false
+}
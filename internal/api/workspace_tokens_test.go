@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func workspaceTokenTestServer() *Server {
+	s := testAPIServer(&MockSessionService{})
+	s.cfg.APIKey = "sk-test-key"
+	s.cfg.Workspace.Enabled = true
+	return s
+}
+
+func mintWorkspaceToken(t *testing.T, s *Server, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	r.SetPathValue("id", "ws1")
+	rec := httptest.NewRecorder()
+	s.handleCreateWorkspaceToken(rec, r)
+	return rec
+}
+
+func TestHandleCreateWorkspaceToken(t *testing.T) {
+	s := workspaceTokenTestServer()
+	req := httptest.NewRequest("POST", "/v1/workspaces/ws1/tokens", strings.NewReader(`{"scopes":["upload"],"ttl_seconds":600}`))
+	req = req.WithContext(session.WithTenant(req.Context(), "acme"))
+	rec := mintWorkspaceToken(t, s, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp workspaceTokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "ws1", resp.WorkspaceID)
+	assert.Equal(t, []string{"upload"}, resp.Scopes)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), resp.ExpiresAt, 5*time.Second)
+
+	tok, ok := s.verifyWorkspaceToken(resp.Token)
+	require.True(t, ok)
+	assert.Equal(t, "ws1", tok.Workspace)
+	assert.Equal(t, "acme", tok.Tenant)
+}
+
+func TestHandleCreateWorkspaceToken_Validation(t *testing.T) {
+	s := workspaceTokenTestServer()
+	s.cfg.Workspace.TokenMaxTTLSeconds = 3600
+
+	for _, body := range []string{
+		`{}`,
+		`{"scopes":["delete"]}`,
+		`{"scopes":["download"],"ttl_seconds":7200}`,
+	} {
+		rec := mintWorkspaceToken(t, s, httptest.NewRequest("POST", "/v1/workspaces/ws1/tokens", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	s.cfg.Workspace.Enabled = false
+	rec := mintWorkspaceToken(t, s, httptest.NewRequest("POST", "/v1/workspaces/ws1/tokens", strings.NewReader(`{"scopes":["upload"]}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestWorkspaceTokenAllows(t *testing.T) {
+	upload := &workspaceToken{Workspace: "ws1", Scopes: []string{WorkspaceScopeUpload}}
+	download := &workspaceToken{Workspace: "ws1", Scopes: []string{WorkspaceScopeDownload}}
+
+	assert.True(t, upload.allows("POST", "/v1/workspaces/ws1/fs/upload"))
+	assert.True(t, upload.allows("POST", "/v2/workspaces/ws1/fs/write"))
+	assert.False(t, upload.allows("GET", "/v1/workspaces/ws1/fs/read"))
+	assert.False(t, upload.allows("POST", "/v1/workspaces/ws2/fs/upload"))
+	assert.False(t, upload.allows("POST", "/v1/workspaces/ws1/tokens"))
+	assert.False(t, upload.allows("DELETE", "/v1/workspaces/ws1"))
+	assert.False(t, upload.allows("POST", "/v1/sessions"))
+
+	assert.True(t, download.allows("GET", "/v1/workspaces/ws1/fs"))
+	assert.True(t, download.allows("GET", "/v1/workspaces/ws1/fs/read"))
+	assert.False(t, download.allows("POST", "/v1/workspaces/ws1/fs/upload"))
+}
+
+func TestAuthMiddleware_WorkspaceToken(t *testing.T) {
+	s := workspaceTokenTestServer()
+	var gotTenant string
+	handler := s.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = session.TenantFrom(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	valid := s.signWorkspaceToken(workspaceToken{
+		Workspace: "ws1",
+		Tenant:    "acme",
+		Scopes:    []string{WorkspaceScopeUpload},
+		Expires:   time.Now().Add(time.Hour).Unix(),
+	})
+	expired := s.signWorkspaceToken(workspaceToken{
+		Workspace: "ws1",
+		Scopes:    []string{WorkspaceScopeUpload},
+		Expires:   time.Now().Add(-time.Minute).Unix(),
+	})
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/workspaces/ws1/fs/upload", valid))
+	assert.Equal(t, "acme", gotTenant)
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/workspaces/ws1/fs/read", valid))
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/workspaces/ws2/fs/upload", valid))
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/sessions", valid))
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/v1/workspaces/ws1/fs/upload", expired))
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/v1/workspaces/ws1/fs/upload", valid+"x"))
+
+	// Rotating the API key revokes outstanding tokens.
+	s.cfg.APIKey = "sk-rotated"
+	assert.Equal(t, http.StatusUnauthorized, do("POST", "/v1/workspaces/ws1/fs/upload", valid))
+}
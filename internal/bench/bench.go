@@ -0,0 +1,183 @@
+// Package bench measures session startup latency, CPU and memory of a
+// Sandkasten daemon (and optionally Docker for comparison). sandbench is a thin
+// CLI around it; integration tests and CI jobs can call it directly and assert
+// on the summaries, e.g. RunSandkasten(...).WarmSummary.StartupAvgMs.
+package bench
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the full result of a benchmark campaign. Its JSON form is what
+// sandbench --json prints.
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Hardware    Hardware          `json:"hardware"`
+	Sandkasten  *SandkastenReport `json:"sandkasten,omitempty"`
+	Sweep       *SweepReport      `json:"sweep,omitempty"`
+	Docker      *DockerReport     `json:"docker,omitempty"`
+}
+
+// Hardware describes the machine the benchmark ran on.
+type Hardware struct {
+	Hostname      string `json:"hostname"`
+	Kernel        string `json:"kernel"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	GoVersion     string `json:"go_version"`
+	CPUModel      string `json:"cpu_model"`
+	LogicalCPUs   int    `json:"logical_cpus"`
+	MemoryTotalMB int64  `json:"memory_total_mb"`
+}
+
+// WorkspaceOptions selects whether sessions are created with a workspace.
+// Mode is none, shared (every run uses ID, generated from Prefix when empty)
+// or per-run (a fresh workspace per run).
+type WorkspaceOptions struct {
+	Mode    string `json:"mode"`
+	ID      string `json:"id,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Cleanup bool   `json:"cleanup"`
+}
+
+func (o *WorkspaceOptions) normalize() error {
+	o.Mode = strings.ToLower(strings.TrimSpace(o.Mode))
+	o.ID = strings.TrimSpace(o.ID)
+	o.Prefix = strings.TrimSpace(o.Prefix)
+	if o.Mode == "" {
+		o.Mode = "none"
+	}
+	if o.Mode != "none" && o.Mode != "shared" && o.Mode != "per-run" {
+		return fmt.Errorf("workspace mode must be none, shared, or per-run")
+	}
+	if o.Mode == "shared" && o.ID == "" {
+		o.ID = newWorkspaceID(o.Prefix)
+	}
+	return nil
+}
+
+// CollectHardware reads host details from /proc and the Go runtime.
+func CollectHardware() Hardware {
+	host, _ := os.Hostname()
+	return Hardware{
+		Hostname:      host,
+		Kernel:        readOneLine("/proc/sys/kernel/osrelease"),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		GoVersion:     runtime.Version(),
+		CPUModel:      readCPUModel(),
+		LogicalCPUs:   runtime.NumCPU(),
+		MemoryTotalMB: readMemTotalMiB(),
+	}
+}
+
+func readCPUModel() string {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return "unknown"
+	}
+	for _, ln := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(ln, "model name") {
+			parts := strings.SplitN(ln, ":", 2)
+			if len(parts) == 2 {
+				return strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return "unknown"
+}
+
+func readMemTotalMiB() int64 {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, ln := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(ln, "MemTotal:") {
+			f := strings.Fields(ln)
+			if len(f) >= 2 {
+				kb, _ := strconv.ParseInt(f[1], 10, 64)
+				return kb / 1024
+			}
+		}
+	}
+	return 0
+}
+
+func readOneLine(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func newWorkspaceID(prefix string) string {
+	p := strings.TrimSpace(prefix)
+	if p == "" {
+		p = "sandbench"
+	}
+	return fmt.Sprintf("%s-%d", p, time.Now().UnixNano())
+}
+
+func avg(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	var s float64
+	for _, x := range v {
+		s += x
+	}
+	return s / float64(len(v))
+}
+
+func minOf(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	m := math.MaxFloat64
+	for _, x := range v {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
+
+func maxOf(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	m := -math.MaxFloat64
+	for _, x := range v {
+		if x > m {
+			m = x
+		}
+	}
+	return m
+}
+
+// percentile returns the p-th percentile (nearest rank) of v.
+func percentile(v []float64, p float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), v...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func bytesToMiB(v int64) float64 {
+	return float64(v) / (1024.0 * 1024.0)
+}
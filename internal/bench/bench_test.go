@@ -0,0 +1,167 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDaemon serves the endpoints the benchmarks use. Creates are served from
+// a pool of poolSize sessions, refilled when a session is destroyed.
+type fakeDaemon struct {
+	mu       sync.Mutex
+	next     int
+	poolSize int
+	idle     int
+	live     map[string]bool
+	warmed   []int
+}
+
+func newFakeDaemon(t *testing.T, poolSize int) (*fakeDaemon, *Client) {
+	d := &fakeDaemon{poolSize: poolSize, idle: poolSize, live: map[string]bool{}}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	return d, NewClient(srv.URL, "key")
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/sessions":
+		d.next++
+		id := "s" + strings.Repeat("x", d.next)
+		d.live[id] = true
+		source := "cold"
+		if d.idle > 0 {
+			d.idle--
+			source = "pool"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "image": "python", "status": "running", "acquire_source": source})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/sessions":
+		sessions := []map[string]any{}
+		for i := 0; i < d.idle; i++ {
+			sessions = append(sessions, map[string]any{"id": "idle", "image": "python", "status": "pool_idle"})
+		}
+		json.NewEncoder(w).Encode(sessions)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/stats"):
+		json.NewEncoder(w).Encode(map[string]any{"memory_bytes": 8 << 20, "cpu_usage_usec": 2000})
+	case r.Method == http.MethodDelete:
+		delete(d.live, strings.TrimPrefix(r.URL.Path, "/v1/sessions/"))
+		d.idle = d.poolSize
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/pool/warm":
+		var req struct {
+			Size int `json:"size"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prev := d.poolSize
+		d.poolSize, d.idle = req.Size, req.Size
+		d.warmed = append(d.warmed, req.Size)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"image": "python", "size": req.Size, "previous": prev})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRunSandkasten(t *testing.T) {
+	d, client := newFakeDaemon(t, 1)
+
+	rep, err := RunSandkasten(context.Background(), client, SandkastenConfig{
+		Image:             "python",
+		ColdRuns:          2,
+		WarmRuns:          1,
+		WarmWait:          time.Second,
+		WorkloadTimeoutMs: 1000,
+		PollInterval:      10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "none", rep.Workspace.Mode)
+	assert.Equal(t, 2, rep.ColdSummary.Count)
+	assert.Equal(t, 0, rep.ColdSummary.PooledHits, "cold runs drain the pool first")
+	assert.Equal(t, 1, rep.WarmSummary.PooledHits)
+	assert.InDelta(t, 8.0, rep.WarmSummary.StartupMemAvgMiB, 0.001)
+	assert.Empty(t, d.live, "measured sessions are destroyed")
+}
+
+func TestRunSandkastenInvalidWorkspaceMode(t *testing.T) {
+	_, client := newFakeDaemon(t, 0)
+
+	_, err := RunSandkasten(context.Background(), client, SandkastenConfig{
+		WorkloadTimeoutMs: 1000,
+		PollInterval:      time.Millisecond,
+		Workspace:         WorkspaceOptions{Mode: "sometimes"},
+	})
+	assert.Error(t, err)
+}
+
+func TestRunSweep(t *testing.T) {
+	d, client := newFakeDaemon(t, 3)
+
+	rep, err := RunSweep(context.Background(), client, SweepConfig{
+		Sizes:    []int{0, 2, 4},
+		Burst:    4,
+		Rounds:   1,
+		WarmWait: time.Second,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, rep.Rows, 3)
+	assert.Equal(t, "python", rep.Image)
+	for i, want := range []int{0, 2, 4} {
+		assert.Equal(t, want, rep.Rows[i].PoolHits)
+		assert.Equal(t, 4, rep.Rows[i].Creates)
+	}
+	assert.InDelta(t, 8.0, rep.IdleSessionMB, 0.001)
+	assert.InDelta(t, 32.0, rep.Rows[2].IdleMemMiB, 0.001)
+	assert.Equal(t, []int{0, 2, 4, 3}, d.warmed, "original size restored")
+}
+
+func TestParseSweepSizes(t *testing.T) {
+	sizes, err := ParseSweepSizes("8, 0,2,2 ,")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 2, 8}, sizes)
+
+	_, err = ParseSweepSizes("1,-2")
+	assert.Error(t, err)
+	_, err = ParseSweepSizes(" , ")
+	assert.Error(t, err)
+}
+
+func TestSummarizeSand(t *testing.T) {
+	s := summarizeSand([]Run{
+		{StartupMs: 10, ClassifiedPooled: true, StartupMemoryB: 1 << 20},
+		{StartupMs: 30, StartupMemoryB: 3 << 20, Workload: &Workload{DurationMs: 5, ExitCode: 1}},
+	})
+	assert.Equal(t, 2, s.Count)
+	assert.Equal(t, 20.0, s.StartupAvgMs)
+	assert.Equal(t, 10.0, s.StartupMinMs)
+	assert.Equal(t, 30.0, s.StartupMaxMs)
+	assert.Equal(t, 2.0, s.StartupMemAvgMiB)
+	assert.Equal(t, 1, s.PooledHits)
+	assert.Equal(t, 1, s.WorkloadCount)
+	assert.Equal(t, 1, s.WorkloadExitNonZero)
+}
+
+func TestPercentile(t *testing.T) {
+	v := []float64{5, 1, 4, 2, 3}
+	assert.Equal(t, 3.0, percentile(v, 50))
+	assert.Equal(t, 5.0, percentile(v, 95))
+	assert.Equal(t, 1.0, percentile(v, 0))
+	assert.Equal(t, 0.0, percentile(nil, 50))
+}
+
+func TestParseHumanBytes(t *testing.T) {
+	n, err := parseHumanBytes("12.5MiB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12.5*1024*1024), n)
+}
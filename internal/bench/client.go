@@ -0,0 +1,148 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to the Sandkasten HTTP API.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// NewClient returns a client for the daemon at baseURL; apiKey may be empty.
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), apiKey: strings.TrimSpace(apiKey), http: &http.Client{}}
+}
+
+type sandCreateSessionRequest struct {
+	Image       string `json:"image,omitempty"`
+	TTLSeconds  int    `json:"ttl_seconds,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+}
+
+type sandSessionInfo struct {
+	ID            string    `json:"id"`
+	Image         string    `json:"image"`
+	Status        string    `json:"status"`
+	WorkspaceID   string    `json:"workspace_id,omitempty"`
+	AcquireSource string    `json:"acquire_source,omitempty"`
+	AcquireDetail string    `json:"acquire_detail,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type sandSessionStats struct {
+	MemoryBytes  int64 `json:"memory_bytes"`
+	CPUUsageUsec int64 `json:"cpu_usage_usec"`
+}
+
+type sandExecResponse struct {
+	ExitCode   int   `json:"exit_code"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+type sandWarmPoolResponse struct {
+	Image    string `json:"image"`
+	Size     int    `json:"size"`
+	Previous int    `json:"previous"`
+}
+
+func (c *Client) createSession(ctx context.Context, image string, ttl int, workspaceID string) (*sandSessionInfo, time.Duration, error) {
+	start := time.Now()
+	req := sandCreateSessionRequest{Image: image, TTLSeconds: ttl, WorkspaceID: workspaceID}
+	var out sandSessionInfo
+	err := c.doJSON(ctx, http.MethodPost, "/v1/sessions", req, &out)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &out, time.Since(start), nil
+}
+
+func (c *Client) listSessions(ctx context.Context) ([]sandSessionInfo, error) {
+	var out []sandSessionInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/v1/sessions", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) getStats(ctx context.Context, id string) (*sandSessionStats, error) {
+	var out sandSessionStats
+	if err := c.doJSON(ctx, http.MethodGet, "/v1/sessions/"+id+"/stats", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) exec(ctx context.Context, id, cmd string, timeoutMs int) (*sandExecResponse, error) {
+	var out sandExecResponse
+	body := map[string]any{"cmd": cmd, "timeout_ms": timeoutMs}
+	if err := c.doJSON(ctx, http.MethodPost, "/v1/sessions/"+id+"/exec", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) destroySession(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/v1/sessions/"+id, nil, nil)
+}
+
+func (c *Client) ensureWorkspace(ctx context.Context, id string) error {
+	body := map[string]any{"path": ".sandbench/created.txt", "text": time.Now().UTC().Format(time.RFC3339Nano)}
+	return c.doJSON(ctx, http.MethodPost, "/v1/workspaces/"+id+"/fs/write", body, nil)
+}
+
+func (c *Client) deleteWorkspace(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/v1/workspaces/"+id, nil, nil)
+}
+
+func (c *Client) warmPool(ctx context.Context, image string, size int) (*sandWarmPoolResponse, error) {
+	var out sandWarmPoolResponse
+	body := map[string]any{"image": image, "size": size}
+	if err := c.doJSON(ctx, http.MethodPost, "/v1/pool/warm", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
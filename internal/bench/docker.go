@@ -0,0 +1,385 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DockerConfig describes a Docker comparison run.
+type DockerConfig struct {
+	Image             string
+	Runs              int
+	Workload          string
+	WorkloadTimeoutMs int
+	PollInterval      time.Duration
+	ExistingIDs       []string // containers to measure without creating them
+	KeepaliveCmd      string   // keeps created containers running for exec
+}
+
+// DockerReport holds the Docker runs and their summaries.
+type DockerReport struct {
+	Image         string                `json:"image"`
+	Runs          []DockerRun           `json:"runs"`
+	ExistingRuns  []DockerExistingRun   `json:"existing_runs"`
+	Summary       DockerSummary         `json:"summary"`
+	ExistingStats DockerExistingSummary `json:"existing_summary"`
+}
+
+// DockerRun is one measured docker run.
+type DockerRun struct {
+	ContainerID    string          `json:"container_id"`
+	StartupMs      float64         `json:"startup_ms"`
+	StartupMemoryB int64           `json:"startup_memory_bytes"`
+	StartupCPUPct  float64         `json:"startup_cpu_percent"`
+	Workload       *DockerWorkload `json:"workload,omitempty"`
+}
+
+// DockerExistingRun measures a container that already existed.
+type DockerExistingRun struct {
+	ContainerID string          `json:"container_id"`
+	MemoryB     int64           `json:"memory_bytes"`
+	CPUPct      float64         `json:"cpu_percent"`
+	Workload    *DockerWorkload `json:"workload,omitempty"`
+}
+
+// DockerWorkload is the resource usage of a command run with docker exec.
+type DockerWorkload struct {
+	Command       string  `json:"command"`
+	ExitCode      int     `json:"exit_code"`
+	DurationMs    int64   `json:"duration_ms"`
+	MemStartBytes int64   `json:"mem_start_bytes"`
+	MemEndBytes   int64   `json:"mem_end_bytes"`
+	MemPeakBytes  int64   `json:"mem_peak_bytes"`
+	CPUStartPct   float64 `json:"cpu_start_percent"`
+	CPUEndPct     float64 `json:"cpu_end_percent"`
+	CPUPeakPct    float64 `json:"cpu_peak_percent"`
+}
+
+// DockerSummary aggregates Docker runs.
+type DockerSummary struct {
+	Count               int     `json:"count"`
+	StartupAvgMs        float64 `json:"startup_avg_ms"`
+	StartupMinMs        float64 `json:"startup_min_ms"`
+	StartupMaxMs        float64 `json:"startup_max_ms"`
+	StartupMemAvgMiB    float64 `json:"startup_mem_avg_mib"`
+	StartupCPUAvgPct    float64 `json:"startup_cpu_avg_percent"`
+	WorkloadCount       int     `json:"workload_count"`
+	WorkloadAvgMs       float64 `json:"workload_avg_ms"`
+	WorkloadMemPeakMiB  float64 `json:"workload_mem_peak_avg_mib"`
+	WorkloadCPUPeakAvg  float64 `json:"workload_cpu_peak_avg_percent"`
+	WorkloadExitNonZero int     `json:"workload_exit_non_zero"`
+}
+
+// DockerExistingSummary aggregates existing-container runs.
+type DockerExistingSummary struct {
+	Count               int     `json:"count"`
+	MemoryAvgMiB        float64 `json:"memory_avg_mib"`
+	CPUAvgPct           float64 `json:"cpu_avg_percent"`
+	WorkloadCount       int     `json:"workload_count"`
+	WorkloadAvgMs       float64 `json:"workload_avg_ms"`
+	WorkloadMemPeakMiB  float64 `json:"workload_mem_peak_avg_mib"`
+	WorkloadCPUPeakAvg  float64 `json:"workload_cpu_peak_avg_percent"`
+	WorkloadExitNonZero int     `json:"workload_exit_non_zero"`
+}
+
+// RunDocker starts containers with docker run and measures them like RunSandkasten.
+func RunDocker(ctx context.Context, client *DockerClient, cfg DockerConfig) (*DockerReport, error) {
+	out := &DockerReport{
+		Image:        cfg.Image,
+		Runs:         make([]DockerRun, 0, cfg.Runs),
+		ExistingRuns: make([]DockerExistingRun, 0, len(cfg.ExistingIDs)),
+	}
+	for i := 0; i < cfg.Runs; i++ {
+		id, latency, err := client.runContainer(ctx, cfg.Image, cfg.KeepaliveCmd)
+		if err != nil {
+			return nil, err
+		}
+		stat, err := client.stats(ctx, id)
+		if err != nil {
+			_ = client.remove(context.Background(), id)
+			return nil, err
+		}
+		r := DockerRun{ContainerID: id, StartupMs: float64(latency.Microseconds()) / 1000.0, StartupMemoryB: stat.MemBytes, StartupCPUPct: stat.CPUPct}
+		if cfg.Workload != "" {
+			w, err := client.workload(ctx, id, cfg.Workload, cfg.WorkloadTimeoutMs, cfg.PollInterval)
+			if err != nil {
+				_ = client.remove(context.Background(), id)
+				return nil, err
+			}
+			r.Workload = w
+		}
+		out.Runs = append(out.Runs, r)
+		_ = client.remove(context.Background(), id)
+	}
+	for _, id := range cfg.ExistingIDs {
+		stat, err := client.stats(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		r := DockerExistingRun{ContainerID: id, MemoryB: stat.MemBytes, CPUPct: stat.CPUPct}
+		if cfg.Workload != "" {
+			w, err := client.workload(ctx, id, cfg.Workload, cfg.WorkloadTimeoutMs, cfg.PollInterval)
+			if err != nil {
+				return nil, err
+			}
+			r.Workload = w
+		}
+		out.ExistingRuns = append(out.ExistingRuns, r)
+	}
+	out.Summary = summarizeDocker(out.Runs)
+	out.ExistingStats = summarizeDockerExisting(out.ExistingRuns)
+	return out, nil
+}
+
+// DockerClient drives the docker CLI.
+type DockerClient struct {
+	binary string
+	shell  string
+}
+
+type dockerStats struct {
+	MemBytes int64
+	CPUPct   float64
+}
+
+// NewDockerClient finds the docker binary; shell is used for docker exec.
+func NewDockerClient(shell string) (*DockerClient, error) {
+	b, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(shell)
+	if s == "" {
+		s = "sh"
+	}
+	return &DockerClient{binary: b, shell: s}, nil
+}
+
+func (d *DockerClient) runContainer(ctx context.Context, image, keepalive string) (string, time.Duration, error) {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, d.binary, "run", "-d", "--rm", image, d.shell, "-lc", keepalive)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", 0, err
+	}
+	id := strings.TrimSpace(string(out))
+	if id == "" {
+		return "", 0, errors.New("docker returned empty container id")
+	}
+	return id, time.Since(start), nil
+}
+
+func (d *DockerClient) remove(ctx context.Context, id string) error {
+	cmd := exec.CommandContext(ctx, d.binary, "rm", "-f", id)
+	_ = cmd.Run()
+	return nil
+}
+
+func (d *DockerClient) stats(ctx context.Context, id string) (*dockerStats, error) {
+	cmd := exec.CommandContext(ctx, d.binary, "stats", "--no-stream", "--format", "{{json .}}", id)
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	line := strings.TrimSpace(string(raw))
+	if line == "" {
+		return nil, fmt.Errorf("empty docker stats output for %s", id)
+	}
+	var obj map[string]string
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return nil, err
+	}
+	memRaw := firstPart(obj["MemUsage"], "/")
+	memBytes, _ := parseHumanBytes(memRaw)
+	cpuPct, _ := parsePercent(obj["CPUPerc"])
+	return &dockerStats{MemBytes: memBytes, CPUPct: cpuPct}, nil
+}
+
+func (d *DockerClient) workload(ctx context.Context, id, cmdText string, timeoutMs int, poll time.Duration) (*DockerWorkload, error) {
+	before, err := d.stats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	peakMem := before.MemBytes
+	peakCPU := before.CPUPct
+	type result struct {
+		exit int
+		dur  int64
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		execCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		cmd := exec.CommandContext(execCtx, d.binary, "exec", id, d.shell, "-lc", cmdText)
+		err := cmd.Run()
+		exit := 0
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				exit = ee.ExitCode()
+			} else {
+				exit = -1
+			}
+		}
+		ch <- result{exit: exit, dur: time.Since(start).Milliseconds(), err: nil}
+	}()
+	tk := time.NewTicker(poll)
+	defer tk.Stop()
+	var r result
+	for {
+		select {
+		case r = <-ch:
+			goto done
+		case <-tk.C:
+			s, e := d.stats(ctx, id)
+			if e == nil {
+				if s.MemBytes > peakMem {
+					peakMem = s.MemBytes
+				}
+				if s.CPUPct > peakCPU {
+					peakCPU = s.CPUPct
+				}
+			}
+		}
+	}
+done:
+	if r.err != nil {
+		return nil, r.err
+	}
+	after, err := d.stats(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if after.MemBytes > peakMem {
+		peakMem = after.MemBytes
+	}
+	if after.CPUPct > peakCPU {
+		peakCPU = after.CPUPct
+	}
+	return &DockerWorkload{
+		Command:       cmdText,
+		ExitCode:      r.exit,
+		DurationMs:    r.dur,
+		MemStartBytes: before.MemBytes,
+		MemEndBytes:   after.MemBytes,
+		MemPeakBytes:  peakMem,
+		CPUStartPct:   before.CPUPct,
+		CPUEndPct:     after.CPUPct,
+		CPUPeakPct:    peakCPU,
+	}, nil
+}
+
+func summarizeDocker(runs []DockerRun) DockerSummary {
+	if len(runs) == 0 {
+		return DockerSummary{}
+	}
+	startup := make([]float64, 0, len(runs))
+	mem := make([]float64, 0, len(runs))
+	cpu := make([]float64, 0, len(runs))
+	workDur := make([]float64, 0, len(runs))
+	workMem := make([]float64, 0, len(runs))
+	workCPU := make([]float64, 0, len(runs))
+	nonZero := 0
+	for _, r := range runs {
+		startup = append(startup, r.StartupMs)
+		mem = append(mem, bytesToMiB(r.StartupMemoryB))
+		cpu = append(cpu, r.StartupCPUPct)
+		if r.Workload != nil {
+			workDur = append(workDur, float64(r.Workload.DurationMs))
+			workMem = append(workMem, bytesToMiB(r.Workload.MemPeakBytes))
+			workCPU = append(workCPU, r.Workload.CPUPeakPct)
+			if r.Workload.ExitCode != 0 {
+				nonZero++
+			}
+		}
+	}
+	return DockerSummary{
+		Count:               len(runs),
+		StartupAvgMs:        avg(startup),
+		StartupMinMs:        minOf(startup),
+		StartupMaxMs:        maxOf(startup),
+		StartupMemAvgMiB:    avg(mem),
+		StartupCPUAvgPct:    avg(cpu),
+		WorkloadCount:       len(workDur),
+		WorkloadAvgMs:       avg(workDur),
+		WorkloadMemPeakMiB:  avg(workMem),
+		WorkloadCPUPeakAvg:  avg(workCPU),
+		WorkloadExitNonZero: nonZero,
+	}
+}
+
+func summarizeDockerExisting(runs []DockerExistingRun) DockerExistingSummary {
+	if len(runs) == 0 {
+		return DockerExistingSummary{}
+	}
+	mem := make([]float64, 0, len(runs))
+	cpu := make([]float64, 0, len(runs))
+	workDur := make([]float64, 0, len(runs))
+	workMem := make([]float64, 0, len(runs))
+	workCPU := make([]float64, 0, len(runs))
+	nonZero := 0
+	for _, r := range runs {
+		mem = append(mem, bytesToMiB(r.MemoryB))
+		cpu = append(cpu, r.CPUPct)
+		if r.Workload != nil {
+			workDur = append(workDur, float64(r.Workload.DurationMs))
+			workMem = append(workMem, bytesToMiB(r.Workload.MemPeakBytes))
+			workCPU = append(workCPU, r.Workload.CPUPeakPct)
+			if r.Workload.ExitCode != 0 {
+				nonZero++
+			}
+		}
+	}
+	return DockerExistingSummary{
+		Count:               len(runs),
+		MemoryAvgMiB:        avg(mem),
+		CPUAvgPct:           avg(cpu),
+		WorkloadCount:       len(workDur),
+		WorkloadAvgMs:       avg(workDur),
+		WorkloadMemPeakMiB:  avg(workMem),
+		WorkloadCPUPeakAvg:  avg(workCPU),
+		WorkloadExitNonZero: nonZero,
+	}
+}
+
+func firstPart(v, sep string) string {
+	parts := strings.SplitN(strings.TrimSpace(v), sep, 2)
+	return strings.TrimSpace(parts[0])
+}
+
+func parsePercent(v string) (float64, error) {
+	v = strings.TrimSuffix(strings.TrimSpace(v), "%")
+	return strconv.ParseFloat(v, 64)
+}
+
+func parseHumanBytes(v string) (int64, error) {
+	v = strings.TrimSpace(strings.ReplaceAll(v, " ", ""))
+	if v == "" {
+		return 0, nil
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB", "KB", "MB", "GB", "TB", "B"}
+	mults := map[string]float64{"B": 1, "KB": 1000, "MB": 1000 * 1000, "GB": 1000 * 1000 * 1000, "TB": 1000 * 1000 * 1000 * 1000, "KiB": 1024, "MiB": 1024 * 1024, "GiB": 1024 * 1024 * 1024, "TiB": 1024 * 1024 * 1024 * 1024}
+	for _, u := range units {
+		if strings.HasSuffix(v, u) {
+			n := strings.TrimSuffix(v, u)
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(f * mults[u]), nil
+		}
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(f), nil
+}
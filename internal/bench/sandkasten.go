@@ -0,0 +1,448 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SandkastenConfig describes a Sandkasten benchmark run.
+type SandkastenConfig struct {
+	Image             string // empty = daemon default
+	TTLSeconds        int
+	ColdRuns          int // creates with the pool drained first
+	WarmRuns          int // creates served from the pool
+	WarmWait          time.Duration
+	Workload          string // optional command run in each measured session
+	WorkloadTimeoutMs int
+	PollInterval      time.Duration // stats polling while the workload runs
+	ExistingIDs       []string      // sessions to measure without creating them
+	ExistingCmd       string        // command for ExistingIDs when Workload is empty
+	Workspace         WorkspaceOptions
+}
+
+// SandkastenReport holds the individual runs and their summaries.
+type SandkastenReport struct {
+	Host          string           `json:"host"`
+	Image         string           `json:"image"`
+	Workspace     WorkspaceOptions `json:"workspace"`
+	ColdRuns      []Run            `json:"cold_runs"`
+	WarmRuns      []Run            `json:"warm_runs"`
+	ExistingRuns  []ExistingRun    `json:"existing_runs"`
+	ColdSummary   Summary          `json:"cold_summary"`
+	WarmSummary   Summary          `json:"warm_summary"`
+	ExistingStats ExistingSummary  `json:"existing_summary"`
+}
+
+// Run is one measured session create.
+type Run struct {
+	Mode             string    `json:"mode"`
+	SessionID        string    `json:"session_id"`
+	WorkspaceID      string    `json:"workspace_id,omitempty"`
+	StartupMs        float64   `json:"startup_ms"`
+	ClassifiedPooled bool      `json:"classified_pooled"`
+	AcquireDetail    string    `json:"acquire_detail,omitempty"`
+	StartupMemoryB   int64     `json:"startup_memory_bytes"`
+	StartupCPUUsec   int64     `json:"startup_cpu_usec"`
+	Workload         *Workload `json:"workload,omitempty"`
+}
+
+// ExistingRun measures a session that already existed.
+type ExistingRun struct {
+	SessionID string    `json:"session_id"`
+	MemoryB   int64     `json:"memory_bytes"`
+	CPUUsec   int64     `json:"cpu_usage_usec"`
+	Workload  *Workload `json:"workload,omitempty"`
+}
+
+// Workload is the resource usage of a command run in a session.
+type Workload struct {
+	Command          string `json:"command"`
+	ExitCode         int    `json:"exit_code"`
+	DurationMs       int64  `json:"duration_ms"`
+	CPUStartUsec     int64  `json:"cpu_start_usec"`
+	CPUEndUsec       int64  `json:"cpu_end_usec"`
+	CPUDeltaUsec     int64  `json:"cpu_delta_usec"`
+	MemoryStartBytes int64  `json:"memory_start_bytes"`
+	MemoryEndBytes   int64  `json:"memory_end_bytes"`
+	MemoryPeakBytes  int64  `json:"memory_peak_bytes"`
+}
+
+// Summary aggregates a set of runs.
+type Summary struct {
+	Count               int     `json:"count"`
+	StartupAvgMs        float64 `json:"startup_avg_ms"`
+	StartupMinMs        float64 `json:"startup_min_ms"`
+	StartupMaxMs        float64 `json:"startup_max_ms"`
+	StartupMemAvgMiB    float64 `json:"startup_mem_avg_mib"`
+	StartupCPUAvgMs     float64 `json:"startup_cpu_avg_ms"`
+	PooledHits          int     `json:"pooled_hits"`
+	WorkloadCount       int     `json:"workload_count"`
+	WorkloadAvgMs       float64 `json:"workload_avg_ms"`
+	WorkloadCPUAvgMs    float64 `json:"workload_cpu_avg_ms"`
+	WorkloadMemPeakMiB  float64 `json:"workload_mem_peak_avg_mib"`
+	WorkloadExitNonZero int     `json:"workload_exit_non_zero"`
+}
+
+// ExistingSummary aggregates existing-session runs.
+type ExistingSummary struct {
+	Count               int     `json:"count"`
+	MemoryAvgMiB        float64 `json:"memory_avg_mib"`
+	CPUAvgMs            float64 `json:"cpu_avg_ms"`
+	WorkloadCount       int     `json:"workload_count"`
+	WorkloadAvgMs       float64 `json:"workload_avg_ms"`
+	WorkloadCPUAvgMs    float64 `json:"workload_cpu_avg_ms"`
+	WorkloadMemPeakMiB  float64 `json:"workload_mem_peak_avg_mib"`
+	WorkloadExitNonZero int     `json:"workload_exit_non_zero"`
+}
+
+// RunSandkasten runs the cold, warm and existing-session benchmarks against the
+// daemon behind client.
+func RunSandkasten(ctx context.Context, client *Client, cfg SandkastenConfig) (*SandkastenReport, error) {
+	if cfg.PollInterval <= 0 || cfg.WorkloadTimeoutMs <= 0 || cfg.ColdRuns < 0 || cfg.WarmRuns < 0 {
+		return nil, fmt.Errorf("invalid run counts, poll interval or workload timeout")
+	}
+	if err := cfg.Workspace.normalize(); err != nil {
+		return nil, err
+	}
+	out := &SandkastenReport{
+		Host:         client.baseURL,
+		Image:        cfg.Image,
+		Workspace:    cfg.Workspace,
+		ColdRuns:     make([]Run, 0, cfg.ColdRuns),
+		WarmRuns:     make([]Run, 0, cfg.WarmRuns),
+		ExistingRuns: make([]ExistingRun, 0, len(cfg.ExistingIDs)),
+	}
+
+	if cfg.Workspace.Mode == "shared" {
+		if err := client.ensureWorkspace(ctx, cfg.Workspace.ID); err != nil {
+			return nil, fmt.Errorf("ensure shared workspace: %w", err)
+		}
+		if cfg.Workspace.Cleanup {
+			defer client.deleteWorkspace(context.Background(), cfg.Workspace.ID)
+		}
+	}
+
+	for i := 0; i < cfg.ColdRuns; i++ {
+		wsID, wsCleanup, err := prepareWorkspace(ctx, client, cfg.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		run, err := runSandCold(ctx, client, cfg, wsID)
+		if wsCleanup != nil {
+			wsCleanup()
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.ColdRuns = append(out.ColdRuns, *run)
+	}
+
+	for i := 0; i < cfg.WarmRuns; i++ {
+		wsID, wsCleanup, err := prepareWorkspace(ctx, client, cfg.Workspace)
+		if err != nil {
+			return nil, err
+		}
+		run, err := runSandWarm(ctx, client, cfg, wsID)
+		if wsCleanup != nil {
+			wsCleanup()
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.WarmRuns = append(out.WarmRuns, *run)
+	}
+
+	for _, id := range cfg.ExistingIDs {
+		cmd := cfg.Workload
+		if cmd == "" {
+			cmd = cfg.ExistingCmd
+		}
+		run, err := runSandExisting(ctx, client, id, cmd, cfg.WorkloadTimeoutMs, cfg.PollInterval)
+		if err != nil {
+			return nil, err
+		}
+		out.ExistingRuns = append(out.ExistingRuns, *run)
+	}
+
+	out.ColdSummary = summarizeSand(out.ColdRuns)
+	out.WarmSummary = summarizeSand(out.WarmRuns)
+	out.ExistingStats = summarizeSandExisting(out.ExistingRuns)
+	return out, nil
+}
+
+func prepareWorkspace(ctx context.Context, client *Client, ws WorkspaceOptions) (string, func(), error) {
+	if ws.Mode == "none" {
+		return "", nil, nil
+	}
+	if ws.Mode == "shared" {
+		return ws.ID, nil, nil
+	}
+	id := newWorkspaceID(ws.Prefix)
+	if err := client.ensureWorkspace(ctx, id); err != nil {
+		return "", nil, fmt.Errorf("ensure per-run workspace: %w", err)
+	}
+	cleanup := func() {
+		if ws.Cleanup {
+			_ = client.deleteWorkspace(context.Background(), id)
+		}
+	}
+	return id, cleanup, nil
+}
+
+func runSandCold(ctx context.Context, client *Client, cfg SandkastenConfig, workspaceID string) (*Run, error) {
+	sessions, err := client.listSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idle := 0
+	for _, s := range sessions {
+		if s.Status == "pool_idle" && (cfg.Image == "" || s.Image == cfg.Image) {
+			idle++
+		}
+	}
+
+	created := make([]string, 0, idle+1)
+	defer func() {
+		for _, id := range created {
+			_ = client.destroySession(context.Background(), id)
+		}
+	}()
+
+	for i := 0; i < idle; i++ {
+		probe, err := runSandOne(ctx, client, "cold-drain", cfg.Image, cfg.TTLSeconds, "", cfg.WorkloadTimeoutMs, cfg.PollInterval, "")
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, probe.SessionID)
+	}
+	measured, err := runSandOne(ctx, client, "cold", cfg.Image, cfg.TTLSeconds, cfg.Workload, cfg.WorkloadTimeoutMs, cfg.PollInterval, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	created = append(created, measured.SessionID)
+	return measured, nil
+}
+
+func runSandWarm(ctx context.Context, client *Client, cfg SandkastenConfig, workspaceID string) (*Run, error) {
+	if err := waitPoolIdle(ctx, client, cfg.Image, workspaceID, cfg.WarmWait); err != nil {
+		if workspaceID == "" {
+			return nil, err
+		}
+		// Workspace-aware pools are built on demand. Prime once, then wait again.
+		primer, _, createErr := client.createSession(ctx, cfg.Image, cfg.TTLSeconds, workspaceID)
+		if createErr != nil {
+			return nil, fmt.Errorf("wait pool idle failed (%v), and workspace prime create failed: %w", err, createErr)
+		}
+		_ = client.destroySession(context.Background(), primer.ID)
+		if err2 := waitPoolIdle(ctx, client, cfg.Image, workspaceID, cfg.WarmWait); err2 != nil {
+			return nil, fmt.Errorf("workspace pool not ready after priming: %w", err2)
+		}
+	}
+	run, err := runSandOne(ctx, client, "warm", cfg.Image, cfg.TTLSeconds, cfg.Workload, cfg.WorkloadTimeoutMs, cfg.PollInterval, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.destroySession(context.Background(), run.SessionID)
+	return run, nil
+}
+
+func waitPoolIdle(ctx context.Context, client *Client, image string, workspaceID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		sessions, err := client.listSessions(ctx)
+		if err == nil {
+			for _, s := range sessions {
+				if s.Status == "pool_idle" &&
+					(image == "" || s.Image == image) &&
+					(workspaceID == "" || s.WorkspaceID == workspaceID) {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for pool_idle (image=%q workspace_id=%q)", image, workspaceID)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func runSandOne(ctx context.Context, client *Client, mode, image string, ttl int, workload string, timeoutMs int, poll time.Duration, workspaceID string) (*Run, error) {
+	created, latency, err := client.createSession(ctx, image, ttl, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := client.getStats(ctx, created.ID)
+	if err != nil {
+		_ = client.destroySession(ctx, created.ID)
+		return nil, err
+	}
+	pooled := strings.EqualFold(created.AcquireSource, "pool")
+	out := &Run{
+		Mode:             mode,
+		SessionID:        created.ID,
+		WorkspaceID:      workspaceID,
+		StartupMs:        float64(latency.Microseconds()) / 1000.0,
+		ClassifiedPooled: pooled,
+		AcquireDetail:    created.AcquireDetail,
+		StartupMemoryB:   stats.MemoryBytes,
+		StartupCPUUsec:   stats.CPUUsageUsec,
+	}
+	if strings.TrimSpace(workload) != "" {
+		work, err := runSandWorkload(ctx, client, created.ID, workload, timeoutMs, poll)
+		if err != nil {
+			_ = client.destroySession(ctx, created.ID)
+			return nil, err
+		}
+		out.Workload = work
+	}
+	return out, nil
+}
+
+func runSandExisting(ctx context.Context, client *Client, sessionID, cmd string, timeoutMs int, poll time.Duration) (*ExistingRun, error) {
+	stats, err := client.getStats(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	out := &ExistingRun{SessionID: sessionID, MemoryB: stats.MemoryBytes, CPUUsec: stats.CPUUsageUsec}
+	if strings.TrimSpace(cmd) != "" {
+		w, err := runSandWorkload(ctx, client, sessionID, cmd, timeoutMs, poll)
+		if err != nil {
+			return nil, err
+		}
+		out.Workload = w
+	}
+	return out, nil
+}
+
+func runSandWorkload(ctx context.Context, client *Client, sessionID, cmd string, timeoutMs int, poll time.Duration) (*Workload, error) {
+	before, err := client.getStats(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	type execResult struct {
+		resp *sandExecResponse
+		err  error
+	}
+	resultCh := make(chan execResult, 1)
+	go func() {
+		resp, e := client.exec(ctx, sessionID, cmd, timeoutMs)
+		resultCh <- execResult{resp: resp, err: e}
+	}()
+	peak := before.MemoryBytes
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	var result execResult
+	for {
+		select {
+		case result = <-resultCh:
+			goto done
+		case <-t.C:
+			s, err := client.getStats(ctx, sessionID)
+			if err == nil && s.MemoryBytes > peak {
+				peak = s.MemoryBytes
+			}
+		}
+	}
+done:
+	if result.err != nil {
+		return nil, result.err
+	}
+	after, err := client.getStats(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if after.MemoryBytes > peak {
+		peak = after.MemoryBytes
+	}
+	return &Workload{
+		Command:          cmd,
+		ExitCode:         result.resp.ExitCode,
+		DurationMs:       result.resp.DurationMs,
+		CPUStartUsec:     before.CPUUsageUsec,
+		CPUEndUsec:       after.CPUUsageUsec,
+		CPUDeltaUsec:     max(0, after.CPUUsageUsec-before.CPUUsageUsec),
+		MemoryStartBytes: before.MemoryBytes,
+		MemoryEndBytes:   after.MemoryBytes,
+		MemoryPeakBytes:  peak,
+	}, nil
+}
+
+func summarizeSand(runs []Run) Summary {
+	if len(runs) == 0 {
+		return Summary{}
+	}
+	startup := make([]float64, 0, len(runs))
+	mem := make([]float64, 0, len(runs))
+	cpu := make([]float64, 0, len(runs))
+	workDur := make([]float64, 0, len(runs))
+	workCPU := make([]float64, 0, len(runs))
+	workMemPeak := make([]float64, 0, len(runs))
+	pooled := 0
+	nonZero := 0
+	for _, r := range runs {
+		startup = append(startup, r.StartupMs)
+		mem = append(mem, bytesToMiB(r.StartupMemoryB))
+		cpu = append(cpu, float64(r.StartupCPUUsec)/1000.0)
+		if r.ClassifiedPooled {
+			pooled++
+		}
+		if r.Workload != nil {
+			workDur = append(workDur, float64(r.Workload.DurationMs))
+			workCPU = append(workCPU, float64(r.Workload.CPUDeltaUsec)/1000.0)
+			workMemPeak = append(workMemPeak, bytesToMiB(r.Workload.MemoryPeakBytes))
+			if r.Workload.ExitCode != 0 {
+				nonZero++
+			}
+		}
+	}
+	return Summary{
+		Count:               len(runs),
+		StartupAvgMs:        avg(startup),
+		StartupMinMs:        minOf(startup),
+		StartupMaxMs:        maxOf(startup),
+		StartupMemAvgMiB:    avg(mem),
+		StartupCPUAvgMs:     avg(cpu),
+		PooledHits:          pooled,
+		WorkloadCount:       len(workDur),
+		WorkloadAvgMs:       avg(workDur),
+		WorkloadCPUAvgMs:    avg(workCPU),
+		WorkloadMemPeakMiB:  avg(workMemPeak),
+		WorkloadExitNonZero: nonZero,
+	}
+}
+
+func summarizeSandExisting(runs []ExistingRun) ExistingSummary {
+	if len(runs) == 0 {
+		return ExistingSummary{}
+	}
+	mem := make([]float64, 0, len(runs))
+	cpu := make([]float64, 0, len(runs))
+	workDur := make([]float64, 0, len(runs))
+	workCPU := make([]float64, 0, len(runs))
+	workMemPeak := make([]float64, 0, len(runs))
+	nonZero := 0
+	for _, r := range runs {
+		mem = append(mem, bytesToMiB(r.MemoryB))
+		cpu = append(cpu, float64(r.CPUUsec)/1000.0)
+		if r.Workload != nil {
+			workDur = append(workDur, float64(r.Workload.DurationMs))
+			workCPU = append(workCPU, float64(r.Workload.CPUDeltaUsec)/1000.0)
+			workMemPeak = append(workMemPeak, bytesToMiB(r.Workload.MemoryPeakBytes))
+			if r.Workload.ExitCode != 0 {
+				nonZero++
+			}
+		}
+	}
+	return ExistingSummary{
+		Count:               len(runs),
+		MemoryAvgMiB:        avg(mem),
+		CPUAvgMs:            avg(cpu),
+		WorkloadCount:       len(workDur),
+		WorkloadAvgMs:       avg(workDur),
+		WorkloadCPUAvgMs:    avg(workCPU),
+		WorkloadMemPeakMiB:  avg(workMemPeak),
+		WorkloadExitNonZero: nonZero,
+	}
+}
@@ -0,0 +1,214 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SweepConfig describes a pool sizing sweep.
+type SweepConfig struct {
+	Image      string // empty = daemon default
+	TTLSeconds int
+	Sizes      []int // pool sizes, ascending
+	Burst      int   // concurrent creates per round
+	Rounds     int   // bursts per size
+	WarmWait   time.Duration
+}
+
+// SweepReport compares create latency and idle memory across pool sizes.
+type SweepReport struct {
+	Host          string     `json:"host"`
+	Image         string     `json:"image"`
+	Burst         int        `json:"burst"`
+	Rounds        int        `json:"rounds"`
+	IdleSessionMB float64    `json:"idle_session_mib"`
+	Rows          []SweepRow `json:"rows"`
+}
+
+// SweepRow is the result for one pool size: Burst concurrent creates per
+// round, and what keeping Size sessions idle costs in memory.
+type SweepRow struct {
+	Size       int     `json:"size"`
+	Creates    int     `json:"creates"`
+	PoolHits   int     `json:"pool_hits"`
+	HitRate    float64 `json:"hit_rate"`
+	AvgMs      float64 `json:"avg_ms"`
+	P50Ms      float64 `json:"p50_ms"`
+	P95Ms      float64 `json:"p95_ms"`
+	MaxMs      float64 `json:"max_ms"`
+	IdleMemMiB float64 `json:"idle_memory_mib"`
+	Runs       []Run   `json:"runs"`
+}
+
+// ParseSweepSizes parses "0,2,4,8" into sorted, distinct pool sizes.
+func ParseSweepSizes(v string) ([]int, error) {
+	seen := map[int]bool{}
+	var sizes []int
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid pool size %q", part)
+		}
+		if !seen[n] {
+			seen[n] = true
+			sizes = append(sizes, n)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no pool sizes given")
+	}
+	sort.Ints(sizes)
+	return sizes, nil
+}
+
+// RunSweep resizes the daemon's pool for cfg.Image to each size, waits for it
+// to fill and fires cfg.Burst concurrent creates, cfg.Rounds times per size.
+// The original pool size is restored at the end.
+func RunSweep(ctx context.Context, client *Client, cfg SweepConfig) (_ *SweepReport, err error) {
+	if len(cfg.Sizes) == 0 || cfg.Burst <= 0 || cfg.Rounds <= 0 {
+		return nil, fmt.Errorf("sweep needs pool sizes and a positive burst and round count")
+	}
+	out := &SweepReport{Host: client.baseURL, Burst: cfg.Burst, Rounds: cfg.Rounds}
+	original := -1
+	defer func() {
+		if original < 0 {
+			return
+		}
+		if _, rerr := client.warmPool(context.Background(), out.Image, original); rerr != nil && err == nil {
+			err = fmt.Errorf("restore pool size %d: %w", original, rerr)
+		}
+	}()
+
+	var idleMem []float64
+	for _, size := range cfg.Sizes {
+		res, err := client.warmPool(ctx, cfg.Image, size)
+		if err != nil {
+			return nil, fmt.Errorf("warm pool to %d: %w", size, err)
+		}
+		if original < 0 {
+			original = res.Previous
+			out.Image = res.Image
+		}
+
+		row := SweepRow{Size: size}
+		for round := 0; round < cfg.Rounds; round++ {
+			if err := waitPoolSize(ctx, client, out.Image, size, cfg.WarmWait); err != nil {
+				return nil, err
+			}
+			runs, err := runBurst(ctx, client, out.Image, cfg.TTLSeconds, cfg.Burst)
+			if err != nil {
+				return nil, err
+			}
+			row.Runs = append(row.Runs, runs...)
+		}
+		for _, r := range row.Runs {
+			if r.ClassifiedPooled && r.StartupMemoryB > 0 {
+				idleMem = append(idleMem, bytesToMiB(r.StartupMemoryB))
+			}
+		}
+		summarizeSweepRow(&row)
+		out.Rows = append(out.Rows, row)
+	}
+
+	// A freshly acquired pooled session has not run anything yet, so its
+	// memory is what it used while idle in the pool.
+	out.IdleSessionMB = avg(idleMem)
+	for i := range out.Rows {
+		out.Rows[i].IdleMemMiB = float64(out.Rows[i].Size) * out.IdleSessionMB
+	}
+	return out, nil
+}
+
+// waitPoolSize waits until image has at least size pool_idle sessions.
+func waitPoolSize(ctx context.Context, client *Client, image string, size int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		idle := 0
+		sessions, err := client.listSessions(ctx)
+		if err == nil {
+			for _, s := range sessions {
+				if s.Status == "pool_idle" && s.Image == image && s.WorkspaceID == "" {
+					idle++
+				}
+			}
+			if idle >= size {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %d pool_idle sessions of %q (have %d); raise --warm-wait-seconds", size, image, idle)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// runBurst creates n sessions concurrently, records their latency and source,
+// then destroys them.
+func runBurst(ctx context.Context, client *Client, image string, ttl, n int) ([]Run, error) {
+	runs := make([]Run, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created, latency, err := client.createSession(ctx, image, ttl, "")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			runs[i] = Run{
+				Mode:             "sweep",
+				SessionID:        created.ID,
+				StartupMs:        float64(latency.Microseconds()) / 1000.0,
+				ClassifiedPooled: strings.EqualFold(created.AcquireSource, "pool"),
+				AcquireDetail:    created.AcquireDetail,
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range runs {
+		if runs[i].SessionID == "" {
+			continue
+		}
+		if stats, err := client.getStats(ctx, runs[i].SessionID); err == nil {
+			runs[i].StartupMemoryB = stats.MemoryBytes
+			runs[i].StartupCPUUsec = stats.CPUUsageUsec
+		}
+		_ = client.destroySession(context.Background(), runs[i].SessionID)
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func summarizeSweepRow(row *SweepRow) {
+	lat := make([]float64, 0, len(row.Runs))
+	for _, r := range row.Runs {
+		lat = append(lat, r.StartupMs)
+		if r.ClassifiedPooled {
+			row.PoolHits++
+		}
+	}
+	row.Creates = len(row.Runs)
+	if row.Creates > 0 {
+		row.HitRate = float64(row.PoolHits) / float64(row.Creates)
+	}
+	row.AvgMs = avg(lat)
+	row.P50Ms = percentile(lat, 50)
+	row.P95Ms = percentile(lat, 95)
+	row.MaxMs = maxOf(lat)
+}
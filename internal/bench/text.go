@@ -0,0 +1,111 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteText writes rep as the human-readable sandbench report.
+func WriteText(w io.Writer, rep *Report) {
+	fmt.Fprintf(w, "Sandbench report (%s)\n", rep.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Host: %s | Kernel: %s | CPU: %s (%d cores) | RAM: %d MiB\n\n",
+		rep.Hardware.Hostname,
+		rep.Hardware.Kernel,
+		rep.Hardware.CPUModel,
+		rep.Hardware.LogicalCPUs,
+		rep.Hardware.MemoryTotalMB,
+	)
+
+	if rep.Sandkasten != nil {
+		fmt.Fprintf(w, "Sandkasten (%s, image=%s, workspace=%s)\n", rep.Sandkasten.Host, valueOrDefault(rep.Sandkasten.Image, "<default>"), rep.Sandkasten.Workspace.Mode)
+		printSandRuns(w, "Cold", rep.Sandkasten.ColdRuns, rep.Sandkasten.ColdSummary)
+		printSandRuns(w, "Warm", rep.Sandkasten.WarmRuns, rep.Sandkasten.WarmSummary)
+		printSandExisting(w, rep.Sandkasten.ExistingRuns, rep.Sandkasten.ExistingStats)
+		fmt.Fprintln(w)
+	}
+
+	if rep.Sweep != nil {
+		printSweep(w, rep.Sweep)
+		fmt.Fprintln(w)
+	}
+
+	if rep.Docker != nil {
+		fmt.Fprintf(w, "Docker (image=%s)\n", rep.Docker.Image)
+		printDockerRuns(w, rep.Docker.Runs, rep.Docker.Summary)
+		printDockerExisting(w, rep.Docker.ExistingRuns, rep.Docker.ExistingStats)
+	}
+}
+
+func printSandRuns(w io.Writer, label string, runs []Run, s Summary) {
+	fmt.Fprintf(w, "  %s: runs=%d avg=%.2fms min=%.2fms max=%.2fms pooled=%d mem=%.2fMiB cpu=%.2fms\n",
+		label, s.Count, s.StartupAvgMs, s.StartupMinMs, s.StartupMaxMs, s.PooledHits, s.StartupMemAvgMiB, s.StartupCPUAvgMs)
+	if s.WorkloadCount > 0 {
+		fmt.Fprintf(w, "    workload: avg=%.2fms cpu=%.2fms mem_peak=%.2fMiB non_zero=%d\n",
+			s.WorkloadAvgMs, s.WorkloadCPUAvgMs, s.WorkloadMemPeakMiB, s.WorkloadExitNonZero)
+	}
+	ordered := append([]Run(nil), runs...)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].StartupMs < ordered[j].StartupMs })
+	for _, r := range ordered {
+		fmt.Fprintf(w, "    - id=%s startup=%.2fms pooled=%t mem=%.2fMiB cpu=%.2fms\n",
+			r.SessionID,
+			r.StartupMs,
+			r.ClassifiedPooled,
+			bytesToMiB(r.StartupMemoryB),
+			float64(r.StartupCPUUsec)/1000.0,
+		)
+	}
+}
+
+func printSandExisting(w io.Writer, runs []ExistingRun, s ExistingSummary) {
+	if len(runs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  Existing sessions: count=%d mem_avg=%.2fMiB cpu_avg=%.2fms\n", s.Count, s.MemoryAvgMiB, s.CPUAvgMs)
+	if s.WorkloadCount > 0 {
+		fmt.Fprintf(w, "    workload: avg=%.2fms cpu=%.2fms mem_peak=%.2fMiB non_zero=%d\n",
+			s.WorkloadAvgMs, s.WorkloadCPUAvgMs, s.WorkloadMemPeakMiB, s.WorkloadExitNonZero)
+	}
+}
+
+func printDockerRuns(w io.Writer, runs []DockerRun, s DockerSummary) {
+	fmt.Fprintf(w, "  Runs: count=%d avg=%.2fms min=%.2fms max=%.2fms mem=%.2fMiB cpu=%.2f%%\n",
+		s.Count, s.StartupAvgMs, s.StartupMinMs, s.StartupMaxMs, s.StartupMemAvgMiB, s.StartupCPUAvgPct)
+	if s.WorkloadCount > 0 {
+		fmt.Fprintf(w, "    workload: avg=%.2fms mem_peak=%.2fMiB cpu_peak=%.2f%% non_zero=%d\n",
+			s.WorkloadAvgMs, s.WorkloadMemPeakMiB, s.WorkloadCPUPeakAvg, s.WorkloadExitNonZero)
+	}
+	for _, r := range runs {
+		fmt.Fprintf(w, "    - id=%s startup=%.2fms mem=%.2fMiB cpu=%.2f%%\n", r.ContainerID, r.StartupMs, bytesToMiB(r.StartupMemoryB), r.StartupCPUPct)
+	}
+}
+
+func printDockerExisting(w io.Writer, runs []DockerExistingRun, s DockerExistingSummary) {
+	if len(runs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  Existing containers: count=%d mem_avg=%.2fMiB cpu_avg=%.2f%%\n", s.Count, s.MemoryAvgMiB, s.CPUAvgPct)
+	if s.WorkloadCount > 0 {
+		fmt.Fprintf(w, "    workload: avg=%.2fms mem_peak=%.2fMiB cpu_peak=%.2f%% non_zero=%d\n",
+			s.WorkloadAvgMs, s.WorkloadMemPeakMiB, s.WorkloadCPUPeakAvg, s.WorkloadExitNonZero)
+	}
+}
+
+func printSweep(w io.Writer, rep *SweepReport) {
+	fmt.Fprintf(w, "Pool sizing sweep (%s, image=%s, burst=%d, rounds=%d, idle session=%.2fMiB)\n",
+		rep.Host, rep.Image, rep.Burst, rep.Rounds, rep.IdleSessionMB)
+	fmt.Fprintf(w, "  %5s  %9s  %5s  %8s  %8s  %8s  %8s  %9s\n", "size", "hits", "hit%", "avg ms", "p50 ms", "p95 ms", "max ms", "idle MiB")
+	for _, r := range rep.Rows {
+		fmt.Fprintf(w, "  %5d  %9s  %4.0f%%  %8.2f  %8.2f  %8.2f  %8.2f  %9.1f\n",
+			r.Size, fmt.Sprintf("%d/%d", r.PoolHits, r.Creates), r.HitRate*100, r.AvgMs, r.P50Ms, r.P95Ms, r.MaxMs, r.IdleMemMiB)
+	}
+}
+
+func valueOrDefault(v, d string) string {
+	if strings.TrimSpace(v) == "" {
+		return d
+	}
+	return v
+}
@@ -1,11 +1,19 @@
 package config
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/p-arndt/sandkasten/protocol"
 )
 
 type Defaults struct {
@@ -15,61 +23,915 @@ type Defaults struct {
 	MaxExecTimeoutMs int     `yaml:"max_exec_timeout_ms"`
 	NetworkMode      string  `yaml:"network_mode"`
 	ReadonlyRootfs   bool    `yaml:"readonly_rootfs"`
+	// CPUWeight is the cgroup cpu.weight of sessions, 1-10000 (0 = the
+	// kernel default, 100). Sessions competing for the same cores get CPU
+	// time in proportion to their weight; cpu_limit still caps each one.
+	CPUWeight int `yaml:"cpu_weight"`
+	// CPUWeightByPriority replaces cpu_weight for sessions created with a
+	// priority (high, normal, batch), e.g. to favour interactive sessions
+	// over batch jobs on a shared host.
+	CPUWeightByPriority map[string]int `yaml:"cpu_weight_by_priority"`
+	// CPUBurstMs lets sessions save up unused cpu_limit quota and spend up
+	// to this much CPU time above it per 100ms period (cpu.max.burst,
+	// kernel 5.14+). At most cpu_limit * 100; 0 = no burst.
+	CPUBurstMs int `yaml:"cpu_burst_ms"`
 	// ExecMode: "stateful" (default) = persistent shell with cwd/env; "stateless" = direct exec, no shell
 	ExecMode string `yaml:"exec_mode"`
 	// ShellPrefer: "bash" (default) or "sh" - prefer lighter sh when available (e.g. busybox)
 	ShellPrefer string `yaml:"shell_prefer"`
+	// ExecKillGraceMs is how long the processes of a timed-out exec get
+	// between SIGTERM and SIGKILL; 0 = SIGKILL right away.
+	ExecKillGraceMs int `yaml:"exec_kill_grace_ms"`
+	// ResetShellOnTimeout returns the persistent shell to /workspace with
+	// sane terminal settings after a timed-out exec was killed.
+	ResetShellOnTimeout bool `yaml:"reset_shell_on_timeout"`
+	// ShellRestartKeepCwd starts the shell that replaces one that exited in
+	// the cwd it had; otherwise in /workspace.
+	ShellRestartKeepCwd bool `yaml:"shell_restart_keep_cwd"`
+	// OutputTruncation is how exec output over the output limit is cut:
+	// "head" keeps the start, "head_tail" the start and the end.
+	OutputTruncation string `yaml:"output_truncation"`
+	// MaxOutputBytes is the output limit of an exec response.
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+	// OutputOverflowBytes keeps up to this much of the output of an exec
+	// over the limit for OutputOverflowSeconds, for clients to page through;
+	// 0 = cut output is lost.
+	OutputOverflowBytes   int `yaml:"output_overflow_bytes"`
+	OutputOverflowSeconds int `yaml:"output_overflow_seconds"`
 }
 
 type PoolConfig struct {
 	Enabled bool           `yaml:"enabled"`
 	Images  map[string]int `yaml:"images"` // image -> pool size
+	// ReclaimAfterSeconds reclaims the memory (mostly page cache) of sessions
+	// idle in the pool for this long; 0 = off.
+	ReclaimAfterSeconds int `yaml:"reclaim_after_seconds"`
 }
 
 type WorkspaceConfig struct {
-	Enabled          bool `yaml:"enabled"`
-	PersistByDefault bool `yaml:"persist_by_default"`
+	Enabled            bool                      `yaml:"enabled"`
+	PersistByDefault   bool                      `yaml:"persist_by_default"`
+	TokenMaxTTLSeconds int                       `yaml:"token_max_ttl_seconds"` // longest workspace access token; 0 = 86400
+	Encryption         WorkspaceEncryptionConfig `yaml:"encryption"`
+	// RetentionDays deletes workspaces no session has used for this many
+	// days; 0 keeps them forever. RetentionDryRun only reports them.
+	RetentionDays   int  `yaml:"retention_days"`
+	RetentionDryRun bool `yaml:"retention_dry_run"`
+	// TrashDays keeps deleted workspaces restorable for this many days;
+	// 0 deletes them right away.
+	TrashDays int `yaml:"trash_days"`
+}
+
+// WorkspaceEncryptionConfig encrypts new workspaces at rest with fscrypt.
+// Each workspace's key is derived from the master key in KeyFile, which
+// should live outside data_dir (a secret mount or tmpfs).
+type WorkspaceEncryptionConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	KeyFile string `yaml:"key_file"` // at least 32 bytes of secret
 }
 
 type SecurityConfig struct {
-	Seccomp string `yaml:"seccomp"` // off | mvp | strict
+	Seccomp   string          `yaml:"seccomp"` // off | mvp | strict
+	HostPorts HostPortsConfig `yaml:"host_ports"`
+	// NestedContainers lists images whose sessions may run rootless
+	// podman/buildah (relaxed seccomp and capabilities, delegated cgroup).
+	NestedContainers []string `yaml:"nested_containers"`
+}
+
+// HostPortsConfig restricts which ports sessions may bind when network_mode is
+// "host". Entries are ports ("8080") or inclusive ranges ("8000-8099").
+type HostPortsConfig struct {
+	Enabled bool                `yaml:"enabled"`
+	Allow   []string            `yaml:"allow"`  // global allow list; empty = no ports
+	Images  map[string][]string `yaml:"images"` // per-image lists replace Allow
 }
 
 type DashboardConfig struct {
+	Enabled      bool       `yaml:"enabled"`
+	SessionHours int        `yaml:"session_hours"` // API key login lifetime; 0 = 168 (7 days)
+	CookieSecure bool       `yaml:"cookie_secure"` // always mark the login cookie Secure (TLS at a proxy)
+	CookieDomain string     `yaml:"cookie_domain"` // "" = host-only cookie
+	OIDC         OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig enables single sign-on for the dashboard. Users get the most
+// privileged role any of their groups maps to; users without one are refused.
+// API clients keep authenticating with API keys.
+type OIDCConfig struct {
+	Issuer       string            `yaml:"issuer"` // "" = SSO off
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	RedirectURL  string            `yaml:"redirect_url"`  // https://<host>/dashboard/oidc/callback
+	Scopes       []string          `yaml:"scopes"`        // "" = openid profile email groups
+	GroupsClaim  string            `yaml:"groups_claim"`  // ID token claim with the user's groups; "" = groups
+	Roles        map[string]string `yaml:"roles"`         // group -> viewer | operator | admin
+	SessionHours int               `yaml:"session_hours"` // dashboard login lifetime; 0 = 8
+}
+
+// PolicyConfig controls the optional exec command policy. Rules are a guardrail
+// on top of isolation, not a replacement for it: shell tricks can evade them.
+type PolicyConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	DenyPatterns  []string `yaml:"deny_patterns"`  // regexes; any match rejects the command
+	DenyPrefixes  []string `yaml:"deny_prefixes"`  // matched against each pipeline/list segment
+	AllowPatterns []string `yaml:"allow_patterns"` // if set, every command must match at least one
+	// BlockNetworkCommands rejects curl, wget, ssh, ... when network_mode is "none".
+	BlockNetworkCommands bool `yaml:"block_network_commands"`
+}
+
+// ApprovalConfig parks selected operations until a second call made with the
+// approver key approves or denies them.
+type ApprovalConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	ApproverKey    string   `yaml:"approver_key"`
+	TimeoutSeconds int      `yaml:"timeout_seconds"` // pending requests expire after this
+	ExecPatterns   []string `yaml:"exec_patterns"`   // regexes; matching exec commands need approval
+	// NetworkedSessions holds session create when network_mode is not "none".
+	NetworkedSessions bool `yaml:"networked_sessions"`
+}
+
+// ScanConfig configures the content scan hook run on fs/write and uploads.
+// Exactly one of Command or URL should be set.
+type ScanConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Command        []string `yaml:"command"` // argv; content on stdin, exit 0 = clean, 1 = reject
+	URL            string   `yaml:"url"`     // HTTP callback receiving the content as POST body
+	TimeoutSeconds int      `yaml:"timeout_seconds"`
+	FailOpen       bool     `yaml:"fail_open"`  // allow the write if the scanner itself fails
+	Quarantine     bool     `yaml:"quarantine"` // keep rejected content under data_dir/quarantine
+	// Workspaces overrides Enabled per workspace ID (e.g. disable for trusted workspaces).
+	Workspaces map[string]bool `yaml:"workspaces"`
+}
+
+// RecordingConfig enables per-session exec transcripts under data_dir/recordings.
+type RecordingConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	MaxOutputBytes int  `yaml:"max_output_bytes"` // output kept per entry; 0 = 64 KiB
+}
+
+// UsageConfig enables usage records (CPU, wall time, bytes, peak memory) per
+// exec and per session, summarized by GET /v1/usage.
+type UsageConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+// TenantConfig is an additional API key whose sessions and workspaces are
+// isolated from those of every other key. The main api_key is the default
+// tenant.
+type TenantConfig struct {
+	Name   string `yaml:"name"`
+	APIKey string `yaml:"api_key"`
+}
+
+// tenantNamePattern keeps tenant names usable as workspace directory prefixes.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+// ValidateTenants checks that tenant names and keys are well-formed and unique.
+func (c *Config) ValidateTenants() error {
+	if len(c.Tenants) > 0 && c.APIKey == "" {
+		return fmt.Errorf("tenants require api_key to be set")
+	}
+	names := make(map[string]bool, len(c.Tenants))
+	keys := map[string]bool{c.APIKey: true}
+	for _, t := range c.Tenants {
+		if !tenantNamePattern.MatchString(t.Name) {
+			return fmt.Errorf("tenant %q: name must be 1-32 lowercase letters, digits or hyphens", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tenant %q: duplicate name", t.Name)
+		}
+		if t.APIKey == "" || keys[t.APIKey] {
+			return fmt.Errorf("tenant %q: api_key must be set and differ from every other key", t.Name)
+		}
+		names[t.Name] = true
+		keys[t.APIKey] = true
+	}
+	return nil
+}
+
+// CORSConfig lets browser frontends on other origins call the API. With no
+// allowed origins only same-origin pages can, which is the browser default.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`   // exact origins (https://app.example.com) or "*"
+	AllowedHeaders   []string `yaml:"allowed_headers"`   // request headers; empty = Authorization, Content-Type, Accept, X-Request-ID
+	AllowCredentials bool     `yaml:"allow_credentials"` // let browsers send cookies; not allowed with "*"
+	MaxAgeSeconds    int      `yaml:"max_age_seconds"`   // preflight cache lifetime; 0 = 600
+}
+
+// ValidateCORS checks that allowed origins are bare scheme://host[:port]
+// values and that credentials are not combined with a wildcard.
+func (c *Config) ValidateCORS() error {
+	for _, o := range c.CORS.AllowedOrigins {
+		if o == "*" {
+			if c.CORS.AllowCredentials {
+				return fmt.Errorf("cors: allow_credentials cannot be used with origin \"*\"")
+			}
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("cors: origin %q must look like https://host[:port]", o)
+		}
+	}
+	return nil
+}
+
+// Runner injection strategies for the linux runtime.
+const (
+	RunnerInjectionLayer    = "layer"    // copied into a shared layer at pull time
+	RunnerInjectionBind     = "bind"     // host binary bind-mounted read-only at session create
+	RunnerInjectionEmbedded = "embedded" // embedded in the daemon, extracted to data_dir at startup
+)
+
+// RunnerConfig selects how the runner binary gets into linux sessions.
+type RunnerConfig struct {
+	Injection string `yaml:"injection"` // layer | bind | embedded
+	Path      string `yaml:"path"`      // host runner for bind; "" = next to the daemon binary
+	// CompressMinBytes is the size from which the runner gzips exec output
+	// and file reads on the socket; 0 = never.
+	CompressMinBytes int `yaml:"compress_min_bytes"`
+}
+
+// ValidateRunner checks the runner injection strategy and compression.
+func (c *Config) ValidateRunner() error {
+	if c.Runner.CompressMinBytes < 0 {
+		return fmt.Errorf("runner.compress_min_bytes must not be negative, got %d", c.Runner.CompressMinBytes)
+	}
+	switch c.Runner.Injection {
+	case RunnerInjectionLayer, RunnerInjectionBind, RunnerInjectionEmbedded:
+		return nil
+	}
+	return fmt.Errorf("runner.injection must be layer, bind or embedded, got %q", c.Runner.Injection)
+}
+
+// MaxExecKillGraceMs bounds defaults.exec_kill_grace_ms so a timed-out exec
+// still finishes within the slack runtimes add to the exec timeout.
+const MaxExecKillGraceMs = 10000
+
+// ValidateExec checks the settings for timed-out execs and exec output, and
+// the image_setup commands.
+func (c *Config) ValidateExec() error {
+	if g := c.Defaults.ExecKillGraceMs; g < 0 || g > MaxExecKillGraceMs {
+		return fmt.Errorf("defaults.exec_kill_grace_ms must be between 0 and %d, got %d", MaxExecKillGraceMs, g)
+	}
+	switch c.Defaults.OutputTruncation {
+	case protocol.TruncateHead, protocol.TruncateHeadTail:
+	default:
+		return fmt.Errorf("defaults.output_truncation must be %q or %q, got %q", protocol.TruncateHead, protocol.TruncateHeadTail, c.Defaults.OutputTruncation)
+	}
+	if n := c.Defaults.MaxOutputBytes; n < 1024 || n > protocol.MaxOutputBytesLimit {
+		return fmt.Errorf("defaults.max_output_bytes must be between 1024 and %d, got %d", protocol.MaxOutputBytesLimit, n)
+	}
+	if n := c.Defaults.OutputOverflowBytes; n != 0 && (n <= c.Defaults.MaxOutputBytes || n > protocol.MaxOutputBytesLimit) {
+		return fmt.Errorf("defaults.output_overflow_bytes must be 0 or between defaults.max_output_bytes and %d, got %d", protocol.MaxOutputBytesLimit, n)
+	}
+	if c.Defaults.OutputOverflowBytes > 0 && c.Defaults.OutputOverflowSeconds <= 0 {
+		return fmt.Errorf("defaults.output_overflow_seconds must be positive, got %d", c.Defaults.OutputOverflowSeconds)
+	}
+	for image, cmds := range c.ImageSetup {
+		for _, cmd := range cmds {
+			if strings.TrimSpace(cmd) == "" {
+				return fmt.Errorf("image_setup.%s: empty command", image)
+			}
+			if len(cmd) > protocol.MaxExecInlineCmdBytes {
+				return fmt.Errorf("image_setup.%s: command longer than %d bytes", image, protocol.MaxExecInlineCmdBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// MaxCPUWeight is the largest cgroup cpu.weight.
+const MaxCPUWeight = 10000
+
+// ValidateCPU checks the CPU weights and burst of sessions.
+func (c *Config) ValidateCPU() error {
+	d := c.Defaults
+	if d.CPUWeight < 0 || d.CPUWeight > MaxCPUWeight {
+		return fmt.Errorf("defaults.cpu_weight must be between 1 and %d (0 = kernel default), got %d", MaxCPUWeight, d.CPUWeight)
+	}
+	for priority, w := range d.CPUWeightByPriority {
+		switch priority {
+		case "high", "normal", "batch":
+		default:
+			return fmt.Errorf("defaults.cpu_weight_by_priority: unknown priority %q (want high, normal or batch)", priority)
+		}
+		if w < 1 || w > MaxCPUWeight {
+			return fmt.Errorf("defaults.cpu_weight_by_priority.%s must be between 1 and %d, got %d", priority, MaxCPUWeight, w)
+		}
+	}
+	if d.CPUBurstMs < 0 {
+		return fmt.Errorf("defaults.cpu_burst_ms must not be negative, got %d", d.CPUBurstMs)
+	}
+	if d.CPUBurstMs > 0 && d.CPULimit <= 0 {
+		return fmt.Errorf("defaults.cpu_burst_ms needs defaults.cpu_limit")
+	}
+	if maxBurst := c.MaxCPUBurstMs(); d.CPUBurstMs > maxBurst {
+		return fmt.Errorf("defaults.cpu_burst_ms must not exceed the cpu_limit quota of %dms per period, got %d", maxBurst, d.CPUBurstMs)
+	}
+	return nil
+}
+
+// MaxCPUBurstMs is the largest CPU burst the kernel accepts with the
+// configured cpu_limit: one period's quota. 0 without a cpu_limit.
+func (c *Config) MaxCPUBurstMs() int {
+	return int(c.Defaults.CPULimit * 100)
+}
+
+// DestroyHooksConfig runs operator hooks when a session is destroyed or
+// expires, e.g. to collect artifacts, sync the workspace or notify a service.
+type DestroyHooksConfig struct {
+	Commands       []string `yaml:"commands"`        // run inside the session, before teardown
+	HostCommand    []string `yaml:"host_command"`    // argv run on the host after teardown
+	WebhookURL     string   `yaml:"webhook_url"`     // receives a JSON event after teardown
+	TimeoutSeconds int      `yaml:"timeout_seconds"` // per hook; 0 = 30
+}
+
+// ValidateCleanup checks the destroy hooks and the workspace retention.
+func (c *Config) ValidateCleanup() error {
+	h := c.DestroyHooks
+	for _, cmd := range h.Commands {
+		if strings.TrimSpace(cmd) == "" {
+			return fmt.Errorf("destroy_hooks.commands: empty command")
+		}
+		if len(cmd) > protocol.MaxExecInlineCmdBytes {
+			return fmt.Errorf("destroy_hooks.commands: command longer than %d bytes", protocol.MaxExecInlineCmdBytes)
+		}
+	}
+	if len(h.HostCommand) > 0 && h.HostCommand[0] == "" {
+		return fmt.Errorf("destroy_hooks.host_command: empty program")
+	}
+	if h.WebhookURL != "" {
+		u, err := url.Parse(h.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("destroy_hooks.webhook_url must be an http(s) URL, got %q", h.WebhookURL)
+		}
+	}
+	if h.TimeoutSeconds < 0 {
+		return fmt.Errorf("destroy_hooks.timeout_seconds must not be negative, got %d", h.TimeoutSeconds)
+	}
+	if c.Workspace.RetentionDays < 0 {
+		return fmt.Errorf("workspace.retention_days must not be negative, got %d", c.Workspace.RetentionDays)
+	}
+	if c.Workspace.TrashDays < 0 {
+		return fmt.Errorf("workspace.trash_days must not be negative, got %d", c.Workspace.TrashDays)
+	}
+	return nil
+}
+
+// AdmissionConfig orders creates by priority (create request field priority:
+// high, normal or batch) while the host is under pressure.
+type AdmissionConfig struct {
+	// BatchMemoryPressure is the host memory pressure (percent, like
+	// host_protection.memory_pressure) from which batch creates are held
+	// back. Keep it below memory_pressure so batch work yields first.
+	// 0 = use memory_pressure.
+	BatchMemoryPressure float64 `yaml:"batch_memory_pressure"`
+	// BatchQueueSeconds is how long a held-back batch create waits for the
+	// pressure to drop before it is rejected. 0 = reject at once.
+	BatchQueueSeconds int `yaml:"batch_queue_seconds"`
+	// BatchQueueMax caps the batch creates waiting at a time; further ones
+	// are rejected at once. 0 = unlimited.
+	BatchQueueMax int `yaml:"batch_queue_max"`
+	// PoolReserveHigh is the number of idle pooled sessions per image that
+	// only high-priority creates may take. 0 = no reserve.
+	PoolReserveHigh int `yaml:"pool_reserve_high"`
+	// MaxSessions caps the sessions handed out at a time across the host;
+	// idle pooled sessions do not count. 0 = unlimited.
+	MaxSessions int `yaml:"max_sessions"`
+	// CreateQueueSize is how many creates may wait for a free slot once
+	// max_sessions is reached. They are answered with 202 and an operation
+	// ID. 0 = reject at once.
+	CreateQueueSize int `yaml:"create_queue_size"`
+	// CreateQueueSeconds is how long a queued create waits for a slot
+	// before its operation expires.
+	CreateQueueSeconds int `yaml:"create_queue_seconds"`
+}
+
+// ValidateAdmission checks the admission thresholds and limits.
+func (c *Config) ValidateAdmission() error {
+	a := c.Admission
+	if a.BatchMemoryPressure < 0 || a.BatchMemoryPressure > 100 {
+		return fmt.Errorf("admission.batch_memory_pressure must be between 0 and 100, got %g", a.BatchMemoryPressure)
+	}
+	if p := c.HostProtection.MemoryPressure; p > 0 && a.BatchMemoryPressure > p {
+		return fmt.Errorf("admission.batch_memory_pressure (%g) must not exceed host_protection.memory_pressure (%g)", a.BatchMemoryPressure, p)
+	}
+	if a.BatchQueueSeconds < 0 {
+		return fmt.Errorf("admission.batch_queue_seconds must not be negative, got %d", a.BatchQueueSeconds)
+	}
+	if a.BatchQueueMax < 0 {
+		return fmt.Errorf("admission.batch_queue_max must not be negative, got %d", a.BatchQueueMax)
+	}
+	if a.PoolReserveHigh < 0 {
+		return fmt.Errorf("admission.pool_reserve_high must not be negative, got %d", a.PoolReserveHigh)
+	}
+	if a.MaxSessions < 0 {
+		return fmt.Errorf("admission.max_sessions must not be negative, got %d", a.MaxSessions)
+	}
+	if a.CreateQueueSize < 0 {
+		return fmt.Errorf("admission.create_queue_size must not be negative, got %d", a.CreateQueueSize)
+	}
+	if a.CreateQueueSize > 0 && a.CreateQueueSeconds <= 0 {
+		return fmt.Errorf("admission.create_queue_seconds must be positive when create_queue_size is set, got %d", a.CreateQueueSeconds)
+	}
+	return nil
+}
+
+// HealthConfig runs host checks in the daemon: cgroup delegation and
+// overlayfs (linux runtime), free space in data_dir and the clock. While one
+// fails /readyz answers 503, and every check that starts or stops failing is
+// recorded as an audit event and posted to WebhookURL.
+type HealthConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	IntervalSeconds int    `yaml:"interval_seconds"`
+	MinFreeDiskMB   int    `yaml:"min_free_disk_mb"`
+	MaxClockErrorMs int    `yaml:"max_clock_error_ms"` // 0 = no clock check
+	WebhookURL      string `yaml:"webhook_url"`
+}
+
+// ImageScanConfig scans images for known vulnerabilities with Trivy or Grype
+// (sandkasten image scan, or on pull with OnPull) and can refuse sessions on
+// images whose report has findings of BlockSeverity or worse.
+type ImageScanConfig struct {
+	Scanner        string `yaml:"scanner"`         // trivy | grype
+	OnPull         bool   `yaml:"on_pull"`         // scan images the daemon pulls or refreshes
+	BlockSeverity  string `yaml:"block_severity"`  // critical | high | medium | low; "" = never block
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // per scan
+}
+
+// ValidateImageScan checks the image scan settings.
+func (c *Config) ValidateImageScan() error {
+	s := c.ImageScan
+	switch s.Scanner {
+	case "", "trivy", "grype":
+	default:
+		return fmt.Errorf("image_scan.scanner must be trivy or grype, got %q", s.Scanner)
+	}
+	if s.OnPull && s.Scanner == "" {
+		return fmt.Errorf("image_scan.on_pull needs image_scan.scanner")
+	}
+	switch s.BlockSeverity {
+	case "", "critical", "high", "medium", "low":
+	default:
+		return fmt.Errorf("image_scan.block_severity must be one of critical, high, medium, low, got %q", s.BlockSeverity)
+	}
+	if s.TimeoutSeconds <= 0 {
+		return fmt.Errorf("image_scan.timeout_seconds must be positive, got %d", s.TimeoutSeconds)
+	}
+	return nil
+}
+
+// ValidateHealth checks the health check settings.
+func (c *Config) ValidateHealth() error {
+	h := c.Health
+	if !h.Enabled {
+		return nil
+	}
+	if h.IntervalSeconds <= 0 {
+		return fmt.Errorf("health.interval_seconds must be positive, got %d", h.IntervalSeconds)
+	}
+	if h.MinFreeDiskMB < 0 {
+		return fmt.Errorf("health.min_free_disk_mb must not be negative, got %d", h.MinFreeDiskMB)
+	}
+	if h.MaxClockErrorMs < 0 {
+		return fmt.Errorf("health.max_clock_error_ms must not be negative, got %d", h.MaxClockErrorMs)
+	}
+	if h.WebhookURL != "" {
+		u, err := url.Parse(h.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("health.webhook_url must be an http(s) URL, got %q", h.WebhookURL)
+		}
+	}
+	return nil
+}
+
+// NotificationsConfig sends selected daemon events to Slack or email, so
+// small teams get alerts without running a webhook consumer.
+type NotificationsConfig struct {
+	Channels []NotificationChannel `yaml:"channels"`
+	Rules    []NotificationRule    `yaml:"rules"`
+	// CreateFailureSpike defines when failed creates raise a
+	// create.failure_spike event.
+	CreateFailureSpike CreateFailureSpikeConfig `yaml:"create_failure_spike"`
+}
+
+// NotificationChannel is a named destination of notifications.
+type NotificationChannel struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` // slack | email
+
+	WebhookURL string `yaml:"webhook_url"` // slack: incoming webhook
+
+	SMTPAddr string   `yaml:"smtp_addr"` // email: host:port
+	Username string   `yaml:"username"`  // email: SMTP auth; "" = none
+	Password string   `yaml:"password"`  // email; SANDKASTEN_SMTP_PASSWORD if empty
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// NotificationRule sends events of the listed types to channels.
+// Subject and Template are Go text/templates of the event; "" = the
+// built-in ones.
+type NotificationRule struct {
+	Events     []string `yaml:"events"`
+	Channels   []string `yaml:"channels"`
+	Subject    string   `yaml:"subject"`
+	Template   string   `yaml:"template"`
+	MaxPerHour int      `yaml:"max_per_hour"` // events sent per hour; 0 = unlimited
+}
+
+// CreateFailureSpikeConfig raises a create.failure_spike event when
+// Threshold creates failed within WindowSeconds.
+type CreateFailureSpikeConfig struct {
+	Threshold     int `yaml:"threshold"`
+	WindowSeconds int `yaml:"window_seconds"`
+}
+
+// NotificationEvents are the event types notification rules may select.
+var NotificationEvents = []string{"session.oom", "reaper.orphans_cleaned", "create.failure_spike", "host.degraded", "host.recovered"}
+
+// ValidateNotifications checks that channels are complete and that rules
+// name known events and channels.
+func (c *Config) ValidateNotifications() error {
+	n := c.Notifications
+	names := map[string]bool{}
+	for i, ch := range n.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("notifications.channels[%d].name is required", i)
+		}
+		if names[ch.Name] {
+			return fmt.Errorf("notifications.channels: duplicate name %q", ch.Name)
+		}
+		names[ch.Name] = true
+		switch ch.Type {
+		case "slack":
+			u, err := url.Parse(ch.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("notifications channel %q: webhook_url must be an http(s) URL", ch.Name)
+			}
+		case "email":
+			if _, _, err := net.SplitHostPort(ch.SMTPAddr); err != nil {
+				return fmt.Errorf("notifications channel %q: smtp_addr must be host:port, got %q", ch.Name, ch.SMTPAddr)
+			}
+			if ch.From == "" || len(ch.To) == 0 {
+				return fmt.Errorf("notifications channel %q: from and to are required", ch.Name)
+			}
+		default:
+			return fmt.Errorf("notifications channel %q: type must be slack or email, got %q", ch.Name, ch.Type)
+		}
+	}
+	for i, r := range n.Rules {
+		if len(r.Events) == 0 || len(r.Channels) == 0 {
+			return fmt.Errorf("notifications.rules[%d]: events and channels are required", i)
+		}
+		for _, ev := range r.Events {
+			if !slices.Contains(NotificationEvents, ev) {
+				return fmt.Errorf("notifications.rules[%d]: unknown event %q (one of %s)", i, ev, strings.Join(NotificationEvents, ", "))
+			}
+		}
+		for _, ch := range r.Channels {
+			if !names[ch] {
+				return fmt.Errorf("notifications.rules[%d]: unknown channel %q", i, ch)
+			}
+		}
+		if r.MaxPerHour < 0 {
+			return fmt.Errorf("notifications.rules[%d].max_per_hour must not be negative, got %d", i, r.MaxPerHour)
+		}
+	}
+	if s := n.CreateFailureSpike; s.Threshold < 1 || s.WindowSeconds < 1 {
+		return fmt.Errorf("notifications.create_failure_spike threshold and window_seconds must be positive")
+	}
+	return nil
+}
+
+// SharedChannelsConfig lets sessions of one tenant share a size-limited tmpfs
+// at /shared for fast data exchange (create request field shared_channel).
+type SharedChannelsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	SizeMB  int  `yaml:"size_mb"` // per channel
+}
+
+// ValidateSharedChannels checks the shared channel size.
+func (c *Config) ValidateSharedChannels() error {
+	if c.SharedChannels.Enabled && c.SharedChannels.SizeMB <= 0 {
+		return fmt.Errorf("shared_channels.size_mb must be positive, got %d", c.SharedChannels.SizeMB)
+	}
+	return nil
+}
+
+// DeterminismConfig supports deterministic sessions (create request field
+// determinism). Pinning their clock needs libfaketime on the host.
+type DeterminismConfig struct {
+	FakeTimeLib string `yaml:"faketime_lib"` // host path of libfaketime.so.1; "" = clocks cannot be pinned
+}
+
+// TraceConfig enables exec tracing (exec request field trace): the daemon
+// attaches strace on the host to the session's processes while the exec runs.
+type TraceConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Strace  string `yaml:"strace"` // strace binary on the host; "" = strace on PATH
+}
+
+// StatsConfig controls the periodic sampling of session stats that backs the
+// stats history and the thrashing flag.
+type StatsConfig struct {
+	HistoryIntervalSeconds int `yaml:"history_interval_seconds"` // sampling interval; 0 = no sampling
+	HistorySamples         int `yaml:"history_samples"`          // samples kept per session
+	// ThrashingPressure flags a session as thrashing while its memory
+	// pressure ("some avg10", in percent) is at or above it. 0 = off.
+	ThrashingPressure float64 `yaml:"thrashing_pressure"`
+}
+
+// HostProtectionConfig keeps a busy sandbox fleet from taking down the host
+// and the daemon with it.
+type HostProtectionConfig struct {
+	// SessionOOMScoreAdj is the oom_score_adj of session processes, so the
+	// kernel OOM killer picks sandboxes before the daemon. 0 = inherit.
+	SessionOOMScoreAdj int `yaml:"session_oom_score_adj"`
+	// MemoryPressure is the host memory pressure (PSI "some avg10" of
+	// /proc/pressure/memory, in percent) at which new sessions are rejected
+	// and pool refills pause. 0 = off.
+	MemoryPressure float64 `yaml:"memory_pressure"`
+	// CgroupParent places session cgroups under a systemd slice (e.g.
+	// "sandbox.slice") or an absolute cgroup path below /sys/fs/cgroup
+	// instead of the daemon's own cgroup, so the slice's limits apply to all
+	// sandboxes together. "" = the daemon's cgroup. Linux runtime only.
+	CgroupParent string `yaml:"cgroup_parent"`
+}
+
+// slicePattern matches systemd slice unit names: dash-separated parts, each
+// naming a nested slice.
+var slicePattern = regexp.MustCompile(`^[A-Za-z0-9_.:]+(-[A-Za-z0-9_.:]+)*\.slice$`)
+
+// ValidateHostProtection checks the OOM score and pressure watermark ranges
+// and the form of the cgroup parent.
+func (c *Config) ValidateHostProtection() error {
+	if adj := c.HostProtection.SessionOOMScoreAdj; adj < -1000 || adj > 1000 {
+		return fmt.Errorf("host_protection.session_oom_score_adj must be between -1000 and 1000, got %d", adj)
+	}
+	if p := c.HostProtection.MemoryPressure; p < 0 || p > 100 {
+		return fmt.Errorf("host_protection.memory_pressure must be between 0 and 100, got %g", p)
+	}
+	if p := c.HostProtection.CgroupParent; p != "" {
+		if strings.HasPrefix(p, "/") {
+			if clean := filepath.Clean(p); clean != p || !strings.HasPrefix(p, "/sys/fs/cgroup/") {
+				return fmt.Errorf("host_protection.cgroup_parent must be a clean path below /sys/fs/cgroup, got %q", p)
+			}
+		} else if !slicePattern.MatchString(p) {
+			return fmt.Errorf("host_protection.cgroup_parent must be a systemd slice name (e.g. sandbox.slice) or a path below /sys/fs/cgroup, got %q", p)
+		}
+	}
+	return nil
+}
+
+// HAConfig runs the daemon active/passive. Every daemon pointed at the same
+// data_dir competes for a lease in the store; the holder serves, the others
+// wait as warm standbys and take over (re-adopting the sessions) when the
+// holder stops renewing.
+type HAConfig struct {
+	Enabled      bool `yaml:"enabled"`
+	LeaseSeconds int  `yaml:"lease_seconds"` // takeover delay after the primary dies
+}
+
+// ValidateHA checks the lease duration.
+func (c *Config) ValidateHA() error {
+	if c.HA.Enabled && c.HA.LeaseSeconds < 3 {
+		return fmt.Errorf("ha.lease_seconds must be at least 3, got %d", c.HA.LeaseSeconds)
+	}
+	return nil
+}
+
+// HTTPConfig tunes the API server. Long execs hold the response open, so the
+// write timeout must outlast the longest allowed exec.
+type HTTPConfig struct {
+	ReadTimeoutSeconds  int `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"` // 0 = max exec timeout + 30s, at least 5 minutes
+	IdleTimeoutSeconds  int `yaml:"idle_timeout_seconds"`
+	MaxHeaderBytes      int `yaml:"max_header_bytes"`
+	MaxJSONBodyBytes    int `yaml:"max_json_body_bytes"` // limit for JSON request bodies (not uploads)
+
+	AccessLog   AccessLogConfig   `yaml:"access_log"`
+	Compression CompressionConfig `yaml:"compression"`
+
+	// exec/stream: SSE comment keep-alives for quiet commands, and how long
+	// a stream waits for a client to reconnect with Last-Event-ID, replaying
+	// up to StreamResumeBufferBytes of events it missed.
+	StreamKeepAliveSeconds  int `yaml:"stream_keepalive_seconds"`
+	StreamResumeSeconds     int `yaml:"stream_resume_seconds"`
+	StreamResumeBufferBytes int `yaml:"stream_resume_buffer_bytes"`
+}
+
+// CompressionConfig compresses API responses with gzip or zstd when the
+// client's Accept-Encoding allows it. Bodies under MinBytes, SSE streams,
+// the port proxy and binary downloads are sent as is.
+type CompressionConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	MinBytes int  `yaml:"min_bytes"`
+}
+
+// AccessLogConfig logs API requests for debugging misbehaving clients.
+// Successful requests are sampled; failed ones (status >= 400) are always
+// logged. Query strings are never logged.
+type AccessLogConfig struct {
+	Enabled    bool    `yaml:"enabled"`
+	SampleRate float64 `yaml:"sample_rate"` // share of successful requests logged, 0-1
+	// Bodies adds JSON request and response bodies of up to MaxBodyBytes to
+	// each entry, with the values of the Redact fields replaced.
+	Bodies       bool     `yaml:"bodies"`
+	MaxBodyBytes int      `yaml:"max_body_bytes"`
+	Redact       []string `yaml:"redact"` // JSON field names, matched case-insensitively at any depth
+}
+
+// DefaultAccessLogRedact are the body fields access_log.redact starts with:
+// credentials, file contents and command output.
+var DefaultAccessLogRedact = []string{"api_key", "token", "password", "secret", "client_secret", "text", "content", "content_base64", "output", "env"}
+
+// ValidateHTTP checks the API server settings.
+func (c *Config) ValidateHTTP() error {
+	a := c.HTTP.AccessLog
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return fmt.Errorf("http.access_log.sample_rate must be between 0 and 1, got %g", a.SampleRate)
+	}
+	if a.MaxBodyBytes < 0 {
+		return fmt.Errorf("http.access_log.max_body_bytes must not be negative, got %d", a.MaxBodyBytes)
+	}
+	if n := c.HTTP.Compression.MinBytes; n < 0 {
+		return fmt.Errorf("http.compression.min_bytes must not be negative, got %d", n)
+	}
+	return nil
+}
+
+// NetworkConfig sets the addressing of the bridge used when network_mode is
+// "bridge". Change the subnet if the default collides with a VPN or LAN range.
+type NetworkConfig struct {
+	Subnet     string `yaml:"subnet"`      // IPv4 CIDR for sessions
+	Gateway    string `yaml:"gateway"`     // bridge address; "" = first host of subnet
+	MTU        int    `yaml:"mtu"`         // 0 = kernel default
+	IPv6Subnet string `yaml:"ipv6_subnet"` // ULA CIDR, e.g. fd55::/64; "" = IPv4 only
+}
+
+// ContainerdConfig configures runtime "containerd", which creates sessions as
+// containerd containers and tasks so ctr and nerdctl can inspect them.
+type ContainerdConfig struct {
+	Address     string            `yaml:"address"`     // containerd socket
+	Namespace   string            `yaml:"namespace"`   // containerd namespace holding session containers and images
+	Snapshotter string            `yaml:"snapshotter"` // "" = containerd default (overlayfs)
+	Runtime     string            `yaml:"runtime"`     // e.g. io.containerd.runsc.v1; "" = io.containerd.runc.v2
+	RunnerPath  string            `yaml:"runner_path"` // host runner binary; "" = the runner layer in data_dir
+	Images      map[string]string `yaml:"images"`      // sandkasten image name -> image reference
+}
+
+// KubernetesConfig configures runtime "kubernetes", which runs every session
+// as a pod with the runner as entrypoint instead of a local namespace sandbox.
+// Empty connection settings mean in-cluster (service account) credentials.
+type KubernetesConfig struct {
+	APIServer           string            `yaml:"api_server"`    // "" = https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT
+	TokenFile           string            `yaml:"token_file"`    // "" = service account token
+	CAFile              string            `yaml:"ca_file"`       // "" = service account CA
+	Namespace           string            `yaml:"namespace"`     // "" = the daemon's own namespace, else "default"
+	RunnerImage         string            `yaml:"runner_image"`  // image with the runner binary at /runner
+	RunnerPort          int               `yaml:"runner_port"`   // TCP port the runner listens on in the pod
+	Images              map[string]string `yaml:"images"`        // sandkasten image name -> container image
+	RuntimeClass        string            `yaml:"runtime_class"` // e.g. gvisor or kata; "" = cluster default
+	NodeSelector        map[string]string `yaml:"node_selector"`
+	StartTimeoutSeconds int               `yaml:"start_timeout_seconds"` // pod scheduling + image pull + runner start
+}
+
+// WSLConfig registers WSL distros as execution targets for a daemon running
+// in WSL2 (see sandkasten-wsl). Sessions of a target run every exec through
+// wsl.exe in the target distro as an unprivileged user, so .NET or PowerShell
+// workloads need no Linux rootfs image.
+type WSLConfig struct {
+	Exe       string               `yaml:"exe"`        // wsl.exe as seen from the daemon's distro
+	SharedDir string               `yaml:"shared_dir"` // workspace root visible in every distro; below /mnt/wsl
+	Targets   map[string]WSLTarget `yaml:"targets"`    // sandkasten image name -> target
+}
+
+// WSLTarget is one distro sessions can run in.
+type WSLTarget struct {
+	Distro string `yaml:"distro"`
+	User   string `yaml:"user"`  // unprivileged user execs run as; never root
+	UID    int    `yaml:"uid"`   // uid of user in the distro; 0 = 1000
+	Shell  string `yaml:"shell"` // bash | sh | pwsh; "" = bash
+}
+
+// WSLShells are the shells a WSL target may run commands with.
+var WSLShells = []string{"bash", "sh", "pwsh"}
+
+// ValidateWSL checks the WSL targets.
+func (c *Config) ValidateWSL() error {
+	if len(c.WSL.Targets) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(c.WSL.SharedDir) {
+		return fmt.Errorf("wsl.shared_dir must be an absolute path, got %q", c.WSL.SharedDir)
+	}
+	if c.WSL.Exe == "" {
+		return fmt.Errorf("wsl.exe must be set")
+	}
+	for name, t := range c.WSL.Targets {
+		switch {
+		case t.Distro == "":
+			return fmt.Errorf("wsl target %q: distro must be set", name)
+		case t.User == "" || t.User == "root":
+			return fmt.Errorf("wsl target %q: user must be set to an unprivileged user", name)
+		case t.UID < 0:
+			return fmt.Errorf("wsl target %q: uid must not be negative, got %d", name, t.UID)
+		case t.Shell != "" && !slices.Contains(WSLShells, t.Shell):
+			return fmt.Errorf("wsl target %q: shell must be one of %s, got %q", name, strings.Join(WSLShells, ", "), t.Shell)
+		}
+	}
+	return nil
+}
+
 type Config struct {
-	Listen               string          `yaml:"listen"`
-	APIKey               string          `yaml:"api_key"`
-	DataDir              string          `yaml:"data_dir"`
-	DefaultImage         string          `yaml:"default_image"`
-	AllowedImages        []string        `yaml:"allowed_images"`
-	DBPath               string          `yaml:"db_path"`
-	DBMaxOpenConns       int             `yaml:"db_max_open_conns"` // 0 = default 4
-	SessionTTLSeconds    int             `yaml:"session_ttl_seconds"`
-	PlaygroundConfigPath string          `yaml:"playground_config_path"`
-	Defaults             Defaults        `yaml:"defaults"`
-	Pool                 PoolConfig      `yaml:"pool"`
-	Workspace            WorkspaceConfig `yaml:"workspace"`
-	Security             SecurityConfig  `yaml:"security"`
-	Dashboard            DashboardConfig `yaml:"dashboard"`
+	Listen               string               `yaml:"listen"`
+	APIKey               string               `yaml:"api_key"`
+	DataDir              string               `yaml:"data_dir"`
+	DefaultImage         string               `yaml:"default_image"`
+	AllowedImages        []string             `yaml:"allowed_images"`
+	DBPath               string               `yaml:"db_path"`
+	DBMaxOpenConns       int                  `yaml:"db_max_open_conns"`               // 0 = default 4
+	DBMaintenanceSeconds int                  `yaml:"db_maintenance_interval_seconds"` // WAL checkpoint/vacuum interval; 0 = disabled
+	DBSlowQueryMs        int                  `yaml:"db_slow_query_ms"`                // log store operations slower than this; 0 = off
+	DBActivityFlushMs    int                  `yaml:"db_activity_flush_ms"`            // session cache write-back interval; 0 = no cache
+	DBAutoMigrate        bool                 `yaml:"db_auto_migrate"`                 // apply pending schema migrations at startup
+	SessionTTLSeconds    int                  `yaml:"session_ttl_seconds"`
+	SessionExpiryWarning int                  `yaml:"session_expiry_warning_seconds"`
+	DrainTimeoutSeconds  int                  `yaml:"drain_timeout_seconds"` // shutdown waits this long for in-flight execs
+	ImageValidation      string               `yaml:"image_validation"`      // warn | fail | off; checked at startup
+	BootstrapImage       string               `yaml:"bootstrap_image"`       // OCI ref pulled as default_image if it is missing
+	ImageRefresh         map[string]string    `yaml:"image_refresh"`         // image -> never | daily | on-start
+	ImageSetup           map[string][]string  `yaml:"image_setup"`           // image -> commands run in each new session before use
+	PlaygroundConfigPath string               `yaml:"playground_config_path"`
+	Defaults             Defaults             `yaml:"defaults"`
+	Pool                 PoolConfig           `yaml:"pool"`
+	Workspace            WorkspaceConfig      `yaml:"workspace"`
+	Security             SecurityConfig       `yaml:"security"`
+	Dashboard            DashboardConfig      `yaml:"dashboard"`
+	Policy               PolicyConfig         `yaml:"policy"`
+	Approval             ApprovalConfig       `yaml:"approval"`
+	Scan                 ScanConfig           `yaml:"scan"`
+	Recording            RecordingConfig      `yaml:"recording"`
+	Usage                UsageConfig          `yaml:"usage"`
+	Tenants              []TenantConfig       `yaml:"tenants"`
+	CORS                 CORSConfig           `yaml:"cors"`
+	HTTP                 HTTPConfig           `yaml:"http"`
+	Network              NetworkConfig        `yaml:"network"`
+	Runner               RunnerConfig         `yaml:"runner"`
+	HostProtection       HostProtectionConfig `yaml:"host_protection"`
+	Stats                StatsConfig          `yaml:"stats"`
+	HA                   HAConfig             `yaml:"ha"`
+	DestroyHooks         DestroyHooksConfig   `yaml:"destroy_hooks"`
+	SharedChannels       SharedChannelsConfig `yaml:"shared_channels"`
+	Admission            AdmissionConfig      `yaml:"admission"`
+	Determinism          DeterminismConfig    `yaml:"determinism"`
+	Trace                TraceConfig          `yaml:"trace"`
+	Health               HealthConfig         `yaml:"health"`
+	ImageScan            ImageScanConfig      `yaml:"image_scan"`
+	Notifications        NotificationsConfig  `yaml:"notifications"`
+	Runtime              string               `yaml:"runtime"` // linux | containerd | kubernetes
+	Containerd           ContainerdConfig     `yaml:"containerd"`
+	Kubernetes           KubernetesConfig     `yaml:"kubernetes"`
+	WSL                  WSLConfig            `yaml:"wsl"`
 }
 
 func Load(yamlPath string) (*Config, error) {
 	cfg := &Config{
-		Listen:            "127.0.0.1:8080",
-		DataDir:           "/var/lib/sandkasten",
-		DefaultImage:      "base",
-		DBPath:            "/var/lib/sandkasten/sandkasten.db",
-		SessionTTLSeconds: 1800,
+		Listen:               "127.0.0.1:8080",
+		DataDir:              "/var/lib/sandkasten",
+		DefaultImage:         "base",
+		DBPath:               "/var/lib/sandkasten/sandkasten.db",
+		SessionTTLSeconds:    1800,
+		DBMaintenanceSeconds: 3600,
+		DBSlowQueryMs:        250,
+		DBActivityFlushMs:    1000,
+		DBAutoMigrate:        true,
+		DrainTimeoutSeconds:  60,
+		ImageValidation:      "warn",
+		Runner:               RunnerConfig{Injection: RunnerInjectionLayer, CompressMinBytes: 64 << 10},
+		HostProtection:       HostProtectionConfig{SessionOOMScoreAdj: 500},
+		Stats:                StatsConfig{HistoryIntervalSeconds: 15, HistorySamples: 40},
+		HA:                   HAConfig{LeaseSeconds: 15},
+		SharedChannels:       SharedChannelsConfig{SizeMB: 64},
+		Admission:            AdmissionConfig{BatchQueueSeconds: 30, BatchQueueMax: 64, CreateQueueSize: 32, CreateQueueSeconds: 300},
+		Health:               HealthConfig{IntervalSeconds: 60, MinFreeDiskMB: 1024, MaxClockErrorMs: 1000},
+		ImageScan:            ImageScanConfig{TimeoutSeconds: 600},
+		Notifications:        NotificationsConfig{CreateFailureSpike: CreateFailureSpikeConfig{Threshold: 5, WindowSeconds: 300}},
 		Defaults: Defaults{
-			CPULimit:         1.0,
-			MemLimitMB:       512,
-			PidsLimit:        256,
-			MaxExecTimeoutMs: 120000,
-			NetworkMode:      "none",
-			ReadonlyRootfs:   true,
+			CPULimit:              1.0,
+			MemLimitMB:            512,
+			PidsLimit:             256,
+			MaxExecTimeoutMs:      120000,
+			ExecKillGraceMs:       2000,
+			ShellRestartKeepCwd:   true,
+			OutputTruncation:      protocol.TruncateHead,
+			MaxOutputBytes:        protocol.MaxOutputBytes,
+			OutputOverflowSeconds: 600,
+			NetworkMode:           "none",
+			ReadonlyRootfs:        true,
 		},
 		Pool: PoolConfig{
 			Enabled: false,
@@ -78,6 +940,7 @@ func Load(yamlPath string) (*Config, error) {
 		Workspace: WorkspaceConfig{
 			Enabled:          false,
 			PersistByDefault: false,
+			TrashDays:        7,
 		},
 		Security: SecurityConfig{
 			Seccomp: "off",
@@ -85,6 +948,43 @@ func Load(yamlPath string) (*Config, error) {
 		Dashboard: DashboardConfig{
 			Enabled: false,
 		},
+		Approval: ApprovalConfig{
+			TimeoutSeconds: 300,
+		},
+		Scan: ScanConfig{
+			TimeoutSeconds: 30,
+		},
+		HTTP: HTTPConfig{
+			ReadTimeoutSeconds: 30,
+			IdleTimeoutSeconds: 60,
+			MaxHeaderBytes:     1 << 20,
+			MaxJSONBodyBytes:   2 << 20,
+			AccessLog: AccessLogConfig{
+				SampleRate:   1,
+				MaxBodyBytes: 4096,
+				Redact:       DefaultAccessLogRedact,
+			},
+			Compression:             CompressionConfig{Enabled: true, MinBytes: 1024},
+			StreamKeepAliveSeconds:  15,
+			StreamResumeSeconds:     60,
+			StreamResumeBufferBytes: 1 << 20,
+		},
+		Network: NetworkConfig{
+			Subnet: "10.55.0.0/16",
+		},
+		Runtime: "linux",
+		Containerd: ContainerdConfig{
+			Address:   "/run/containerd/containerd.sock",
+			Namespace: "sandkasten",
+		},
+		Kubernetes: KubernetesConfig{
+			RunnerPort:          7070,
+			StartTimeoutSeconds: 120,
+		},
+		WSL: WSLConfig{
+			Exe:       "/mnt/c/Windows/System32/wsl.exe",
+			SharedDir: "/mnt/wsl/sandkasten",
+		},
 	}
 
 	if yamlPath != "" {
@@ -100,6 +1000,10 @@ func Load(yamlPath string) (*Config, error) {
 
 	applyEnvOverrides(cfg)
 
+	if cfg.HTTP.WriteTimeoutSeconds <= 0 {
+		cfg.HTTP.WriteTimeoutSeconds = max(300, cfg.Defaults.MaxExecTimeoutMs/1000+30)
+	}
+
 	return cfg, nil
 }
 
@@ -124,11 +1028,47 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.DBMaxOpenConns = n
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_DB_MAINTENANCE_INTERVAL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.DBMaintenanceSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_DB_SLOW_QUERY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.DBSlowQueryMs = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_DB_ACTIVITY_FLUSH_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.DBActivityFlushMs = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_DB_AUTO_MIGRATE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.DBAutoMigrate = b
+		}
+	}
 	if v := os.Getenv("SANDKASTEN_SESSION_TTL_SECONDS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.SessionTTLSeconds = n
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_SESSION_EXPIRY_WARNING_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.SessionExpiryWarning = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_DRAIN_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.DrainTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_BOOTSTRAP_IMAGE"); v != "" {
+		cfg.BootstrapImage = v
+	}
+	if v := os.Getenv("SANDKASTEN_IMAGE_VALIDATION"); v != "" {
+		cfg.ImageValidation = v
+	}
 	if v := os.Getenv("SANDKASTEN_CPU_LIMIT"); v != "" {
 		if f, err := strconv.ParseFloat(v, 64); err == nil {
 			cfg.Defaults.CPULimit = f
@@ -139,6 +1079,16 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.Defaults.MemLimitMB = n
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_CPU_WEIGHT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Defaults.CPUWeight = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_CPU_BURST_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Defaults.CPUBurstMs = n
+		}
+	}
 	if v := os.Getenv("SANDKASTEN_PIDS_LIMIT"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.Defaults.PidsLimit = n
@@ -149,9 +1099,56 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.Defaults.MaxExecTimeoutMs = n
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_EXEC_KILL_GRACE_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Defaults.ExecKillGraceMs = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_OUTPUT_TRUNCATION"); v != "" {
+		cfg.Defaults.OutputTruncation = v
+	}
+	if v := os.Getenv("SANDKASTEN_MAX_OUTPUT_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Defaults.MaxOutputBytes = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_OUTPUT_OVERFLOW_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Defaults.OutputOverflowBytes = n
+		}
+	}
 	if v := os.Getenv("SANDKASTEN_NETWORK_MODE"); v != "" {
 		cfg.Defaults.NetworkMode = v
 	}
+	if v := os.Getenv("SANDKASTEN_NETWORK_SUBNET"); v != "" {
+		cfg.Network.Subnet = v
+	}
+	if v := os.Getenv("SANDKASTEN_NETWORK_GATEWAY"); v != "" {
+		cfg.Network.Gateway = v
+	}
+	if v := os.Getenv("SANDKASTEN_NETWORK_MTU"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Network.MTU = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_NETWORK_IPV6_SUBNET"); v != "" {
+		cfg.Network.IPv6Subnet = v
+	}
+	if v := os.Getenv("SANDKASTEN_RUNTIME"); v != "" {
+		cfg.Runtime = v
+	}
+	if v := os.Getenv("SANDKASTEN_CONTAINERD_ADDRESS"); v != "" {
+		cfg.Containerd.Address = v
+	}
+	if v := os.Getenv("SANDKASTEN_CONTAINERD_NAMESPACE"); v != "" {
+		cfg.Containerd.Namespace = v
+	}
+	if v := os.Getenv("SANDKASTEN_KUBERNETES_NAMESPACE"); v != "" {
+		cfg.Kubernetes.Namespace = v
+	}
+	if v := os.Getenv("SANDKASTEN_KUBERNETES_RUNNER_IMAGE"); v != "" {
+		cfg.Kubernetes.RunnerImage = v
+	}
 	if v := os.Getenv("SANDKASTEN_READONLY_ROOTFS"); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
 			cfg.Defaults.ReadonlyRootfs = b
@@ -177,9 +1174,190 @@ func applyEnvOverrides(cfg *Config) {
 			cfg.Pool.Enabled = b
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_MEMORY_PRESSURE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.HostProtection.MemoryPressure = f
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_CGROUP_PARENT"); v != "" {
+		cfg.HostProtection.CgroupParent = v
+	}
+	if v := os.Getenv("SANDKASTEN_DESTROY_WEBHOOK_URL"); v != "" {
+		cfg.DestroyHooks.WebhookURL = v
+	}
+	if v := os.Getenv("SANDKASTEN_WORKSPACE_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Workspace.RetentionDays = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_WORKSPACE_TRASH_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Workspace.TrashDays = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HEALTH_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Health.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HEALTH_WEBHOOK_URL"); v != "" {
+		cfg.Health.WebhookURL = v
+	}
+	if v := os.Getenv("SANDKASTEN_SMTP_PASSWORD"); v != "" {
+		for i := range cfg.Notifications.Channels {
+			if ch := &cfg.Notifications.Channels[i]; ch.Type == "email" && ch.Password == "" {
+				ch.Password = v
+			}
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_IMAGE_SCANNER"); v != "" {
+		cfg.ImageScan.Scanner = v
+	}
+	if v := os.Getenv("SANDKASTEN_IMAGE_SCAN_BLOCK_SEVERITY"); v != "" {
+		cfg.ImageScan.BlockSeverity = v
+	}
+	if v := os.Getenv("SANDKASTEN_SHARED_CHANNELS_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.SharedChannels.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_BATCH_MEMORY_PRESSURE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Admission.BatchMemoryPressure = f
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_POOL_RESERVE_HIGH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Admission.PoolReserveHigh = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_MAX_SESSIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Admission.MaxSessions = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_FAKETIME_LIB"); v != "" {
+		cfg.Determinism.FakeTimeLib = v
+	}
+	if v := os.Getenv("SANDKASTEN_TRACE_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Trace.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HA_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.HA.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_STATS_HISTORY_INTERVAL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Stats.HistoryIntervalSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_THRASHING_PRESSURE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.Stats.ThrashingPressure = f
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_POOL_RECLAIM_AFTER_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Pool.ReclaimAfterSeconds = n
+		}
+	}
 	if v := os.Getenv("SANDKASTEN_DASHBOARD_ENABLED"); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
 			cfg.Dashboard.Enabled = b
 		}
 	}
+	if v := os.Getenv("SANDKASTEN_DASHBOARD_COOKIE_SECURE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Dashboard.CookieSecure = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_DASHBOARD_COOKIE_DOMAIN"); v != "" {
+		cfg.Dashboard.CookieDomain = v
+	}
+	if v := os.Getenv("SANDKASTEN_WORKSPACE_KEY_FILE"); v != "" {
+		cfg.Workspace.Encryption.KeyFile = v
+	}
+	if v := os.Getenv("SANDKASTEN_RUNNER_INJECTION"); v != "" {
+		cfg.Runner.Injection = v
+	}
+	if v := os.Getenv("SANDKASTEN_CORS_ALLOWED_ORIGINS"); v != "" {
+		cfg.CORS.AllowedOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SANDKASTEN_APPROVER_KEY"); v != "" {
+		cfg.Approval.ApproverKey = v
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_READ_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.ReadTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_WRITE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.WriteTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_IDLE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.IdleTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_MAX_HEADER_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.MaxHeaderBytes = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_MAX_JSON_BODY_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.MaxJSONBodyBytes = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_STREAM_KEEPALIVE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.StreamKeepAliveSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_STREAM_RESUME_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.HTTP.StreamResumeSeconds = n
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_COMPRESSION_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.HTTP.Compression.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_ACCESS_LOG_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.HTTP.AccessLog.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_HTTP_ACCESS_LOG_SAMPLE_RATE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.HTTP.AccessLog.SampleRate = f
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_SCAN_URL"); v != "" {
+		cfg.Scan.URL = v
+	}
+	if v := os.Getenv("SANDKASTEN_RECORDING_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Recording.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_OIDC_CLIENT_SECRET"); v != "" {
+		cfg.Dashboard.OIDC.ClientSecret = v
+	}
+	if v := os.Getenv("SANDKASTEN_USAGE_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Usage.Enabled = b
+		}
+	}
+	if v := os.Getenv("SANDKASTEN_POLICY_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Policy.Enabled = b
+		}
+	}
 }
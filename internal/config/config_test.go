@@ -3,8 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/p-arndt/sandkasten/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,6 +19,11 @@ func TestLoadDefaults(t *testing.T) {
 	assert.Equal(t, "base", cfg.DefaultImage)
 	assert.Equal(t, "/var/lib/sandkasten/sandkasten.db", cfg.DBPath)
 	assert.Equal(t, 1800, cfg.SessionTTLSeconds)
+	assert.Equal(t, 3600, cfg.DBMaintenanceSeconds)
+	assert.Equal(t, 250, cfg.DBSlowQueryMs)
+	assert.Equal(t, 1000, cfg.DBActivityFlushMs)
+	assert.Equal(t, 60, cfg.DrainTimeoutSeconds)
+	assert.Equal(t, "warn", cfg.ImageValidation)
 	assert.Equal(t, 1.0, cfg.Defaults.CPULimit)
 	assert.Equal(t, 512, cfg.Defaults.MemLimitMB)
 	assert.Equal(t, 256, cfg.Defaults.PidsLimit)
@@ -25,6 +32,36 @@ func TestLoadDefaults(t *testing.T) {
 	assert.True(t, cfg.Defaults.ReadonlyRootfs)
 	assert.False(t, cfg.Pool.Enabled)
 	assert.False(t, cfg.Workspace.Enabled)
+	assert.Equal(t, 30, cfg.HTTP.ReadTimeoutSeconds)
+	assert.Equal(t, 300, cfg.HTTP.WriteTimeoutSeconds)
+	assert.Equal(t, 60, cfg.HTTP.IdleTimeoutSeconds)
+	assert.Equal(t, 1<<20, cfg.HTTP.MaxHeaderBytes)
+	assert.Equal(t, 2<<20, cfg.HTTP.MaxJSONBodyBytes)
+	assert.Equal(t, "10.55.0.0/16", cfg.Network.Subnet)
+	assert.Equal(t, "linux", cfg.Runtime)
+	assert.Equal(t, "/run/containerd/containerd.sock", cfg.Containerd.Address)
+	assert.Equal(t, "sandkasten", cfg.Containerd.Namespace)
+	assert.Equal(t, 7070, cfg.Kubernetes.RunnerPort)
+	assert.Equal(t, 120, cfg.Kubernetes.StartTimeoutSeconds)
+	assert.Empty(t, cfg.Network.IPv6Subnet)
+}
+
+func TestWriteTimeoutFollowsMaxExecTimeout(t *testing.T) {
+	yamlContent := `
+defaults:
+  max_exec_timeout_ms: 1800000
+`
+	yamlPath := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(yamlContent), 0644))
+
+	cfg, err := Load(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, 1830, cfg.HTTP.WriteTimeoutSeconds)
+
+	t.Setenv("SANDKASTEN_HTTP_WRITE_TIMEOUT_SECONDS", "90")
+	cfg, err = Load(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, 90, cfg.HTTP.WriteTimeoutSeconds)
 }
 
 func TestLoadYAML(t *testing.T) {
@@ -33,11 +70,20 @@ listen: "0.0.0.0:9090"
 api_key: "sk-test"
 default_image: "sandbox-runtime:python"
 session_ttl_seconds: 3600
+image_refresh:
+  python: daily
 defaults:
   cpu_limit: 2.0
   mem_limit_mb: 1024
 workspace:
   enabled: true
+security:
+  host_ports:
+    enabled: true
+    allow: ["8000-8099"]
+    images:
+      node: ["3000"]
+  nested_containers: ["builder"]
 `
 	tmpDir := t.TempDir()
 	yamlPath := filepath.Join(tmpDir, "test.yaml")
@@ -53,6 +99,11 @@ workspace:
 	assert.Equal(t, 2.0, cfg.Defaults.CPULimit)
 	assert.Equal(t, 1024, cfg.Defaults.MemLimitMB)
 	assert.True(t, cfg.Workspace.Enabled)
+	assert.True(t, cfg.Security.HostPorts.Enabled)
+	assert.Equal(t, []string{"8000-8099"}, cfg.Security.HostPorts.Allow)
+	assert.Equal(t, []string{"3000"}, cfg.Security.HostPorts.Images["node"])
+	assert.Equal(t, []string{"builder"}, cfg.Security.NestedContainers)
+	assert.Equal(t, map[string]string{"python": "daily"}, cfg.ImageRefresh)
 }
 
 func TestLoadYAMLMissingFile(t *testing.T) {
@@ -78,12 +129,26 @@ func TestEnvOverrides(t *testing.T) {
 	t.Setenv("SANDKASTEN_ALLOWED_IMAGES", "img1,img2,img3")
 	t.Setenv("SANDKASTEN_DB_PATH", "/tmp/test.db")
 	t.Setenv("SANDKASTEN_SESSION_TTL_SECONDS", "600")
+	t.Setenv("SANDKASTEN_SESSION_EXPIRY_WARNING_SECONDS", "120")
+	t.Setenv("SANDKASTEN_DB_MAINTENANCE_INTERVAL_SECONDS", "0")
+	t.Setenv("SANDKASTEN_DB_SLOW_QUERY_MS", "50")
+	t.Setenv("SANDKASTEN_DB_ACTIVITY_FLUSH_MS", "0")
+	t.Setenv("SANDKASTEN_DRAIN_TIMEOUT_SECONDS", "5")
+	t.Setenv("SANDKASTEN_IMAGE_VALIDATION", "fail")
+	t.Setenv("SANDKASTEN_BOOTSTRAP_IMAGE", "alpine:3.20")
 	t.Setenv("SANDKASTEN_CPU_LIMIT", "0.5")
 	t.Setenv("SANDKASTEN_MEM_LIMIT_MB", "256")
 	t.Setenv("SANDKASTEN_PIDS_LIMIT", "128")
 	t.Setenv("SANDKASTEN_MAX_EXEC_TIMEOUT_MS", "30000")
 	t.Setenv("SANDKASTEN_NETWORK_MODE", "bridge")
 	t.Setenv("SANDKASTEN_READONLY_ROOTFS", "false")
+	t.Setenv("SANDKASTEN_HTTP_READ_TIMEOUT_SECONDS", "10")
+	t.Setenv("SANDKASTEN_HTTP_IDLE_TIMEOUT_SECONDS", "5")
+	t.Setenv("SANDKASTEN_HTTP_MAX_HEADER_BYTES", "4096")
+	t.Setenv("SANDKASTEN_HTTP_MAX_JSON_BODY_BYTES", "1024")
+	t.Setenv("SANDKASTEN_NETWORK_SUBNET", "172.31.200.0/22")
+	t.Setenv("SANDKASTEN_NETWORK_MTU", "1400")
+	t.Setenv("SANDKASTEN_NETWORK_IPV6_SUBNET", "fd55::/64")
 
 	cfg, err := Load("")
 	require.NoError(t, err)
@@ -94,12 +159,26 @@ func TestEnvOverrides(t *testing.T) {
 	assert.Equal(t, []string{"img1", "img2", "img3"}, cfg.AllowedImages)
 	assert.Equal(t, "/tmp/test.db", cfg.DBPath)
 	assert.Equal(t, 600, cfg.SessionTTLSeconds)
+	assert.Equal(t, 120, cfg.SessionExpiryWarning)
+	assert.Equal(t, 0, cfg.DBMaintenanceSeconds)
+	assert.Equal(t, 50, cfg.DBSlowQueryMs)
+	assert.Equal(t, 0, cfg.DBActivityFlushMs)
+	assert.Equal(t, 5, cfg.DrainTimeoutSeconds)
+	assert.Equal(t, "fail", cfg.ImageValidation)
+	assert.Equal(t, "alpine:3.20", cfg.BootstrapImage)
 	assert.Equal(t, 0.5, cfg.Defaults.CPULimit)
 	assert.Equal(t, 256, cfg.Defaults.MemLimitMB)
 	assert.Equal(t, 128, cfg.Defaults.PidsLimit)
 	assert.Equal(t, 30000, cfg.Defaults.MaxExecTimeoutMs)
 	assert.Equal(t, "bridge", cfg.Defaults.NetworkMode)
 	assert.False(t, cfg.Defaults.ReadonlyRootfs)
+	assert.Equal(t, 10, cfg.HTTP.ReadTimeoutSeconds)
+	assert.Equal(t, 5, cfg.HTTP.IdleTimeoutSeconds)
+	assert.Equal(t, 4096, cfg.HTTP.MaxHeaderBytes)
+	assert.Equal(t, 1024, cfg.HTTP.MaxJSONBodyBytes)
+	assert.Equal(t, "172.31.200.0/22", cfg.Network.Subnet)
+	assert.Equal(t, 1400, cfg.Network.MTU)
+	assert.Equal(t, "fd55::/64", cfg.Network.IPv6Subnet)
 }
 
 func TestEnvOverridesYAML(t *testing.T) {
@@ -133,3 +212,429 @@ func TestEnvOverrideInvalidValues(t *testing.T) {
 	assert.Equal(t, 1800, cfg.SessionTTLSeconds)
 	assert.Equal(t, 1.0, cfg.Defaults.CPULimit)
 }
+
+func TestValidateTenants(t *testing.T) {
+	valid := &Config{APIKey: "main", Tenants: []TenantConfig{{Name: "acme", APIKey: "k1"}, {Name: "team-2", APIKey: "k2"}}}
+	require.NoError(t, valid.ValidateTenants())
+
+	tests := []*Config{
+		{Tenants: []TenantConfig{{Name: "acme", APIKey: "k1"}}},
+		{APIKey: "main", Tenants: []TenantConfig{{Name: "Acme_1", APIKey: "k1"}}},
+		{APIKey: "main", Tenants: []TenantConfig{{Name: "acme", APIKey: "k1"}, {Name: "acme", APIKey: "k2"}}},
+		{APIKey: "main", Tenants: []TenantConfig{{Name: "acme", APIKey: "main"}}},
+		{APIKey: "main", Tenants: []TenantConfig{{Name: "acme", APIKey: ""}}},
+	}
+	for i, cfg := range tests {
+		assert.Error(t, cfg.ValidateTenants(), "case %d", i)
+	}
+}
+
+func TestValidateCORS(t *testing.T) {
+	valid := []CORSConfig{
+		{},
+		{AllowedOrigins: []string{"*"}},
+		{AllowedOrigins: []string{"https://app.example.com", "http://localhost:5173"}, AllowCredentials: true},
+	}
+	for i, c := range valid {
+		assert.NoError(t, (&Config{CORS: c}).ValidateCORS(), "case %d", i)
+	}
+
+	invalid := []CORSConfig{
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"app.example.com"}},
+		{AllowedOrigins: []string{"https://app.example.com/path"}},
+		{AllowedOrigins: []string{"ftp://app.example.com"}},
+	}
+	for i, c := range invalid {
+		assert.Error(t, (&Config{CORS: c}).ValidateCORS(), "case %d", i)
+	}
+}
+
+func TestValidateRunner(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, RunnerInjectionLayer, cfg.Runner.Injection)
+	assert.NoError(t, cfg.ValidateRunner())
+
+	t.Setenv("SANDKASTEN_RUNNER_INJECTION", "bind")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, RunnerInjectionBind, cfg.Runner.Injection)
+
+	cfg.Runner.Injection = "copy"
+	assert.Error(t, cfg.ValidateRunner())
+
+	cfg.Runner.Injection = RunnerInjectionLayer
+	cfg.Runner.CompressMinBytes = -1
+	assert.Error(t, cfg.ValidateRunner())
+}
+
+func TestValidateExec(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 2000, cfg.Defaults.ExecKillGraceMs)
+	assert.False(t, cfg.Defaults.ResetShellOnTimeout)
+	assert.NoError(t, cfg.ValidateExec())
+
+	cfg.Defaults.ExecKillGraceMs = 0
+	assert.NoError(t, cfg.ValidateExec(), "0 = SIGKILL right away")
+	cfg.Defaults.ExecKillGraceMs = MaxExecKillGraceMs + 1
+	assert.Error(t, cfg.ValidateExec())
+	cfg.Defaults.ExecKillGraceMs = 0
+
+	assert.Equal(t, "head", cfg.Defaults.OutputTruncation)
+	cfg.Defaults.OutputTruncation = "head_tail"
+	assert.NoError(t, cfg.ValidateExec())
+	cfg.Defaults.OutputTruncation = "tail"
+	assert.Error(t, cfg.ValidateExec())
+	cfg.Defaults.OutputTruncation = "head"
+
+	assert.Equal(t, protocol.MaxOutputBytes, cfg.Defaults.MaxOutputBytes)
+	cfg.Defaults.MaxOutputBytes = 512
+	assert.Error(t, cfg.ValidateExec())
+	cfg.Defaults.MaxOutputBytes = 1 << 20
+	cfg.Defaults.OutputOverflowBytes = 16 << 20
+	assert.NoError(t, cfg.ValidateExec())
+	cfg.Defaults.OutputOverflowBytes = 1 << 20
+	assert.Error(t, cfg.ValidateExec(), "overflow must exceed the limit")
+	cfg.Defaults.OutputOverflowBytes = protocol.MaxOutputBytesLimit + 1
+	assert.Error(t, cfg.ValidateExec())
+	cfg.Defaults.OutputOverflowBytes = 16 << 20
+	cfg.Defaults.OutputOverflowSeconds = 0
+	assert.Error(t, cfg.ValidateExec())
+	cfg.Defaults.OutputOverflowBytes = 0
+	assert.NoError(t, cfg.ValidateExec())
+
+	cfg.ImageSetup = map[string][]string{"python": {`python -c "import numpy"`}}
+	assert.NoError(t, cfg.ValidateExec())
+	cfg.ImageSetup["python"] = append(cfg.ImageSetup["python"], " ")
+	assert.Error(t, cfg.ValidateExec())
+	cfg.ImageSetup["python"] = []string{strings.Repeat("x", protocol.MaxExecInlineCmdBytes+1)}
+	assert.Error(t, cfg.ValidateExec())
+}
+
+func TestValidateCPU(t *testing.T) {
+	t.Setenv("SANDKASTEN_CPU_WEIGHT", "200")
+	t.Setenv("SANDKASTEN_CPU_BURST_MS", "50")
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 200, cfg.Defaults.CPUWeight)
+	assert.Equal(t, 50, cfg.Defaults.CPUBurstMs)
+	assert.NoError(t, cfg.ValidateCPU())
+
+	cfg.Defaults.CPUBurstMs = 150
+	assert.Error(t, cfg.ValidateCPU(), "burst over one period of cpu_limit 1.0")
+	cfg.Defaults.CPULimit = 2
+	assert.NoError(t, cfg.ValidateCPU())
+	cfg.Defaults.CPULimit = 0
+	assert.Error(t, cfg.ValidateCPU(), "burst without a limit")
+	cfg.Defaults.CPUBurstMs = 0
+	assert.NoError(t, cfg.ValidateCPU())
+
+	cfg.Defaults.CPUWeight = MaxCPUWeight + 1
+	assert.Error(t, cfg.ValidateCPU())
+	cfg.Defaults.CPUWeight = 0
+	cfg.Defaults.CPUWeightByPriority = map[string]int{"high": 1000, "batch": 10}
+	assert.NoError(t, cfg.ValidateCPU())
+	cfg.Defaults.CPUWeightByPriority["interactive"] = 500
+	assert.Error(t, cfg.ValidateCPU())
+	delete(cfg.Defaults.CPUWeightByPriority, "interactive")
+	cfg.Defaults.CPUWeightByPriority["batch"] = 0
+	assert.Error(t, cfg.ValidateCPU())
+}
+
+func TestValidateHealth(t *testing.T) {
+	t.Setenv("SANDKASTEN_HEALTH_ENABLED", "true")
+	t.Setenv("SANDKASTEN_HEALTH_WEBHOOK_URL", "https://alerts.example.com/hook")
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.True(t, cfg.Health.Enabled)
+	assert.Equal(t, 60, cfg.Health.IntervalSeconds)
+	assert.NoError(t, cfg.ValidateHealth())
+
+	cfg.Health.WebhookURL = "alerts.example.com/hook"
+	assert.Error(t, cfg.ValidateHealth())
+	cfg.Health.WebhookURL = ""
+	cfg.Health.IntervalSeconds = 0
+	assert.Error(t, cfg.ValidateHealth())
+	cfg.Health.Enabled = false
+	assert.NoError(t, cfg.ValidateHealth(), "ignored while disabled")
+}
+
+func TestValidateNotifications(t *testing.T) {
+	t.Setenv("SANDKASTEN_SMTP_PASSWORD", "secret")
+	path := filepath.Join(t.TempDir(), "sandkasten.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+notifications:
+  channels:
+    - name: ops-slack
+      type: slack
+      webhook_url: https://hooks.slack.com/services/T0/B0/x
+    - name: ops-mail
+      type: email
+      smtp_addr: smtp.example.com:587
+      username: sandkasten
+      from: sandkasten@example.com
+      to: [ops@example.com]
+  rules:
+    - events: [session.oom, create.failure_spike]
+      channels: [ops-slack, ops-mail]
+      max_per_hour: 10
+`), 0o644))
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", cfg.Notifications.Channels[1].Password)
+	assert.Equal(t, CreateFailureSpikeConfig{Threshold: 5, WindowSeconds: 300}, cfg.Notifications.CreateFailureSpike)
+	assert.NoError(t, cfg.ValidateNotifications())
+
+	n := &cfg.Notifications
+	n.Rules[0].Events = append(n.Rules[0].Events, "session.created")
+	assert.ErrorContains(t, cfg.ValidateNotifications(), "unknown event")
+	n.Rules[0].Events = []string{"host.degraded"}
+	n.Rules[0].Channels = []string{"pager"}
+	assert.ErrorContains(t, cfg.ValidateNotifications(), "unknown channel")
+	n.Rules[0].Channels = []string{"ops-mail"}
+	n.Channels[1].SMTPAddr = "smtp.example.com"
+	assert.ErrorContains(t, cfg.ValidateNotifications(), "host:port")
+	n.Channels[1].SMTPAddr = "smtp.example.com:25"
+	n.Channels[0].WebhookURL = "hooks.slack.com/services/x"
+	assert.ErrorContains(t, cfg.ValidateNotifications(), "webhook_url")
+	n.Channels[0].WebhookURL = "https://hooks.slack.com/services/x"
+	n.Channels[0].Name = "ops-mail"
+	assert.ErrorContains(t, cfg.ValidateNotifications(), "duplicate")
+	n.Channels[0].Name = "ops-slack"
+	n.CreateFailureSpike.Threshold = 0
+	assert.Error(t, cfg.ValidateNotifications())
+}
+
+func TestValidateImageScan(t *testing.T) {
+	t.Setenv("SANDKASTEN_IMAGE_SCANNER", "grype")
+	t.Setenv("SANDKASTEN_IMAGE_SCAN_BLOCK_SEVERITY", "critical")
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "grype", cfg.ImageScan.Scanner)
+	assert.Equal(t, 600, cfg.ImageScan.TimeoutSeconds)
+	assert.NoError(t, cfg.ValidateImageScan())
+
+	cfg.ImageScan.BlockSeverity = "CRITICAL"
+	assert.Error(t, cfg.ValidateImageScan())
+	cfg.ImageScan.BlockSeverity = "high"
+	cfg.ImageScan.Scanner = "clair"
+	assert.Error(t, cfg.ValidateImageScan())
+	cfg.ImageScan.Scanner = ""
+	cfg.ImageScan.OnPull = true
+	assert.Error(t, cfg.ValidateImageScan(), "on_pull without a scanner")
+	cfg.ImageScan.OnPull = false
+	assert.NoError(t, cfg.ValidateImageScan(), "blocking works on reports from image scan")
+}
+
+func TestValidateHostProtection(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 500, cfg.HostProtection.SessionOOMScoreAdj)
+	assert.Zero(t, cfg.HostProtection.MemoryPressure)
+	assert.NoError(t, cfg.ValidateHostProtection())
+
+	t.Setenv("SANDKASTEN_MEMORY_PRESSURE", "40")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 40.0, cfg.HostProtection.MemoryPressure)
+
+	cfg.HostProtection.MemoryPressure = 120
+	assert.Error(t, cfg.ValidateHostProtection())
+	cfg.HostProtection.MemoryPressure = 40
+	cfg.HostProtection.SessionOOMScoreAdj = 1001
+	assert.Error(t, cfg.ValidateHostProtection())
+	cfg.HostProtection.SessionOOMScoreAdj = 500
+
+	t.Setenv("SANDKASTEN_CGROUP_PARENT", "sandbox-agents.slice")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "sandbox-agents.slice", cfg.HostProtection.CgroupParent)
+	assert.NoError(t, cfg.ValidateHostProtection())
+
+	for _, parent := range []string{"/sys/fs/cgroup/sandbox.slice", "/sys/fs/cgroup/a/b"} {
+		cfg.HostProtection.CgroupParent = parent
+		assert.NoError(t, cfg.ValidateHostProtection(), parent)
+	}
+	for _, parent := range []string{"sandbox", "-.slice", "a--b.slice", "a/b.slice", "/sys/fs/cgroup", "/sys/fs/cgroup/../x", "/tmp/cg"} {
+		cfg.HostProtection.CgroupParent = parent
+		assert.Error(t, cfg.ValidateHostProtection(), parent)
+	}
+}
+
+func TestValidateHA(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.False(t, cfg.HA.Enabled)
+	assert.Equal(t, 15, cfg.HA.LeaseSeconds)
+	assert.NoError(t, cfg.ValidateHA())
+
+	t.Setenv("SANDKASTEN_HA_ENABLED", "true")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.True(t, cfg.HA.Enabled)
+
+	cfg.HA.LeaseSeconds = 1
+	assert.Error(t, cfg.ValidateHA())
+}
+
+func TestValidateCleanup(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Workspace.RetentionDays)
+	assert.Equal(t, 7, cfg.Workspace.TrashDays)
+	assert.NoError(t, cfg.ValidateCleanup())
+
+	t.Setenv("SANDKASTEN_DESTROY_WEBHOOK_URL", "https://hooks.example.com/sandkasten")
+	t.Setenv("SANDKASTEN_WORKSPACE_RETENTION_DAYS", "30")
+	t.Setenv("SANDKASTEN_WORKSPACE_TRASH_DAYS", "0")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Workspace.TrashDays)
+	assert.Equal(t, "https://hooks.example.com/sandkasten", cfg.DestroyHooks.WebhookURL)
+	assert.Equal(t, 30, cfg.Workspace.RetentionDays)
+	cfg.DestroyHooks.Commands = []string{"tar czf /workspace/out.tgz /tmp/out"}
+	cfg.DestroyHooks.HostCommand = []string{"/usr/local/bin/sync-workspace"}
+	assert.NoError(t, cfg.ValidateCleanup())
+
+	cfg.DestroyHooks.WebhookURL = "ftp://example.com"
+	assert.Error(t, cfg.ValidateCleanup())
+	cfg.DestroyHooks.WebhookURL = ""
+	cfg.DestroyHooks.Commands = []string{""}
+	assert.Error(t, cfg.ValidateCleanup())
+	cfg.DestroyHooks.Commands = nil
+	cfg.DestroyHooks.HostCommand = []string{""}
+	assert.Error(t, cfg.ValidateCleanup())
+	cfg.DestroyHooks.HostCommand = nil
+	cfg.Workspace.RetentionDays = -1
+	assert.Error(t, cfg.ValidateCleanup())
+	cfg.Workspace.RetentionDays = 0
+	cfg.Workspace.TrashDays = -1
+	assert.Error(t, cfg.ValidateCleanup())
+}
+
+func TestValidateSharedChannels(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.False(t, cfg.SharedChannels.Enabled)
+	assert.Equal(t, 64, cfg.SharedChannels.SizeMB)
+	assert.NoError(t, cfg.ValidateSharedChannels())
+
+	t.Setenv("SANDKASTEN_SHARED_CHANNELS_ENABLED", "true")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.True(t, cfg.SharedChannels.Enabled)
+
+	cfg.SharedChannels.SizeMB = 0
+	assert.Error(t, cfg.ValidateSharedChannels())
+}
+
+func TestDeterminismConfig(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Determinism.FakeTimeLib)
+
+	t.Setenv("SANDKASTEN_FAKETIME_LIB", "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1", cfg.Determinism.FakeTimeLib)
+}
+
+func TestTraceConfig(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.False(t, cfg.Trace.Enabled)
+
+	path := filepath.Join(t.TempDir(), "sandkasten.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("trace:\n  strace: /usr/local/bin/strace\n"), 0644))
+	t.Setenv("SANDKASTEN_TRACE_ENABLED", "true")
+	cfg, err = Load(path)
+	require.NoError(t, err)
+	assert.True(t, cfg.Trace.Enabled)
+	assert.Equal(t, "/usr/local/bin/strace", cfg.Trace.Strace)
+}
+
+func TestValidateHTTP(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.False(t, cfg.HTTP.AccessLog.Enabled)
+	assert.Equal(t, 1.0, cfg.HTTP.AccessLog.SampleRate)
+	assert.Contains(t, cfg.HTTP.AccessLog.Redact, "api_key")
+	assert.NoError(t, cfg.ValidateHTTP())
+
+	t.Setenv("SANDKASTEN_HTTP_ACCESS_LOG_ENABLED", "true")
+	t.Setenv("SANDKASTEN_HTTP_ACCESS_LOG_SAMPLE_RATE", "0.1")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.True(t, cfg.HTTP.AccessLog.Enabled)
+	assert.Equal(t, 0.1, cfg.HTTP.AccessLog.SampleRate)
+
+	cfg.HTTP.AccessLog.SampleRate = 1.5
+	assert.Error(t, cfg.ValidateHTTP())
+	cfg.HTTP.AccessLog.SampleRate = 0
+	cfg.HTTP.AccessLog.MaxBodyBytes = -1
+	assert.Error(t, cfg.ValidateHTTP())
+	cfg.HTTP.AccessLog.MaxBodyBytes = 0
+
+	assert.True(t, cfg.HTTP.Compression.Enabled)
+	cfg.HTTP.Compression.MinBytes = -1
+	assert.Error(t, cfg.ValidateHTTP())
+}
+
+func TestValidateWSL(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/wsl/sandkasten", cfg.WSL.SharedDir)
+	assert.NoError(t, cfg.ValidateWSL())
+
+	cfg.WSL.Targets = map[string]WSLTarget{"dotnet": {Distro: "Ubuntu-22.04", User: "sandbox", Shell: "pwsh"}}
+	assert.NoError(t, cfg.ValidateWSL())
+
+	for _, target := range []WSLTarget{
+		{User: "sandbox"},
+		{Distro: "Ubuntu-22.04"},
+		{Distro: "Ubuntu-22.04", User: "root"},
+		{Distro: "Ubuntu-22.04", User: "sandbox", UID: -1},
+		{Distro: "Ubuntu-22.04", User: "sandbox", Shell: "cmd"},
+	} {
+		cfg.WSL.Targets = map[string]WSLTarget{"dotnet": target}
+		assert.Error(t, cfg.ValidateWSL(), "%+v", target)
+	}
+
+	cfg.WSL.Targets = map[string]WSLTarget{"dotnet": {Distro: "Ubuntu-22.04", User: "sandbox"}}
+	cfg.WSL.SharedDir = "sandkasten"
+	assert.Error(t, cfg.ValidateWSL())
+}
+
+func TestValidateAdmission(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 30, cfg.Admission.BatchQueueSeconds)
+	assert.Equal(t, 64, cfg.Admission.BatchQueueMax)
+	assert.NoError(t, cfg.ValidateAdmission())
+
+	t.Setenv("SANDKASTEN_BATCH_MEMORY_PRESSURE", "20")
+	t.Setenv("SANDKASTEN_POOL_RESERVE_HIGH", "2")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, cfg.Admission.BatchMemoryPressure)
+	assert.Equal(t, 2, cfg.Admission.PoolReserveHigh)
+	assert.NoError(t, cfg.ValidateAdmission())
+
+	cfg.HostProtection.MemoryPressure = 10
+	assert.Error(t, cfg.ValidateAdmission(), "batch threshold above memory_pressure")
+	cfg.HostProtection.MemoryPressure = 0
+
+	cfg.Admission.PoolReserveHigh = -1
+	assert.Error(t, cfg.ValidateAdmission())
+	cfg.Admission.PoolReserveHigh = 0
+
+	t.Setenv("SANDKASTEN_MAX_SESSIONS", "50")
+	cfg, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.Admission.MaxSessions)
+	assert.Equal(t, 32, cfg.Admission.CreateQueueSize)
+	cfg.Admission.CreateQueueSeconds = 0
+	assert.Error(t, cfg.ValidateAdmission(), "queue without timeout")
+}
@@ -0,0 +1,202 @@
+// Package elfcheck inspects executables inside image rootfs layers so image
+// validation can tell, before a session is created, whether the host kernel
+// can run them: the ELF architecture must match the host (or have a
+// binfmt_misc handler such as qemu-user) and a dynamically linked binary needs
+// its loader (e.g. /lib/ld-musl-x86_64.so.1 on alpine) inside the rootfs.
+package elfcheck
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+)
+
+// ErrNotELF is returned by Inspect for files that are not ELF executables,
+// e.g. shell scripts.
+var ErrNotELF = errors.New("not an ELF file")
+
+// binfmtDir is where binfmt_misc handlers are registered.
+var binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// Info describes an ELF executable.
+type Info struct {
+	Arch   string // GOARCH name, e.g. "amd64"; "" if unknown
+	Interp string // PT_INTERP loader path; "" for static binaries
+}
+
+// Static reports whether the binary needs no loader.
+func (i Info) Static() bool { return i.Interp == "" }
+
+var machineArch = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_386:     "386",
+	elf.EM_ARM:     "arm",
+	elf.EM_RISCV:   "riscv64",
+	elf.EM_PPC64:   "ppc64le",
+	elf.EM_S390:    "s390x",
+}
+
+// qemuNames maps GOARCH names to the qemu-user binfmt handler names.
+var qemuNames = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"386":     "i386",
+	"arm":     "arm",
+	"riscv64": "riscv64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// Inspect reads the architecture and loader of the ELF file at p.
+func Inspect(p string) (Info, error) {
+	f, err := elf.Open(p)
+	if err != nil {
+		var fmtErr *elf.FormatError
+		if errors.As(err, &fmtErr) {
+			return Info{}, ErrNotELF
+		}
+		return Info{}, err
+	}
+	defer f.Close()
+
+	info := Info{Arch: machineArch[f.Machine]}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		buf := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(buf, 0); err != nil {
+			return Info{}, fmt.Errorf("read interpreter of %s: %w", p, err)
+		}
+		info.Interp = strings.TrimRight(string(buf), "\x00")
+	}
+	return info, nil
+}
+
+// HostCanRun reports whether the host kernel can execute binaries of arch,
+// natively or through an enabled qemu-user binfmt_misc handler.
+func HostCanRun(arch string) bool {
+	if arch == goruntime.GOARCH || (goruntime.GOARCH == "amd64" && arch == "386") {
+		return true
+	}
+	name, ok := qemuNames[arch]
+	if !ok {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(binfmtDir, "qemu-"+name))
+	return err == nil && strings.HasPrefix(string(data), "enabled")
+}
+
+// CheckRunner verifies that the runner binary at p is a static executable for
+// the host architecture, so it starts in any rootfs regardless of its libc.
+func CheckRunner(p string) error {
+	info, err := Inspect(p)
+	if err != nil {
+		return fmt.Errorf("runner %s: %w", p, err)
+	}
+	if info.Arch != goruntime.GOARCH {
+		return fmt.Errorf("runner %s is built for %s, host is %s", p, archName(info.Arch), goruntime.GOARCH)
+	}
+	if !info.Static() {
+		return fmt.Errorf("runner %s is dynamically linked (loader %s); build it with CGO_ENABLED=0", p, info.Interp)
+	}
+	return nil
+}
+
+// CheckExecutable verifies that the executable at abs path p inside the
+// layered rootfs (topmost layer first) can run on the host: symlinks are
+// followed within the rootfs, the architecture must be runnable and the
+// loader of a dynamic binary must be present. Non-ELF files pass.
+func CheckExecutable(layers []string, p string) error {
+	host, err := Resolve(layers, p)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p, err)
+	}
+	info, err := Inspect(host)
+	if errors.Is(err, ErrNotELF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !HostCanRun(info.Arch) {
+		return fmt.Errorf("%s is built for %s, host is %s and has no binfmt_misc handler for it", p, archName(info.Arch), goruntime.GOARCH)
+	}
+	if info.Interp != "" {
+		if _, err := Resolve(layers, info.Interp); err != nil {
+			return fmt.Errorf("%s needs loader %s, which the image does not contain (libc mismatch?)", p, info.Interp)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the host path of abs path p in the layered rootfs,
+// following symlinks in every component relative to the rootfs root rather
+// than the host's (e.g. /lib -> usr/lib on merged-/usr images).
+func Resolve(layers []string, p string) (string, error) {
+	parts := splitPath(p)
+	cur, host := "/", ""
+	links := 0
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(cur, parts[i])
+		h, fi, err := lookup(layers, next)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			cur, host = next, h
+			continue
+		}
+		if links++; links > 40 {
+			return "", fmt.Errorf("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(h)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(cur, target)
+		}
+		parts = append(splitPath(target), parts[i+1:]...)
+		cur, i = "/", -1
+	}
+	if host == "" {
+		return "", os.ErrNotExist
+	}
+	return host, nil
+}
+
+// lookup finds p in the topmost layer that has it, without following a
+// symlink in its last component.
+func lookup(layers []string, p string) (string, os.FileInfo, error) {
+	for _, dir := range layers {
+		host := filepath.Join(dir, filepath.FromSlash(p))
+		if fi, err := os.Lstat(host); err == nil {
+			return host, fi, nil
+		}
+	}
+	return "", nil, os.ErrNotExist
+}
+
+func splitPath(p string) []string {
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+p), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func archName(arch string) string {
+	if arch == "" {
+		return "an unknown architecture"
+	}
+	return arch
+}
@@ -0,0 +1,131 @@
+package elfcheck
+
+import (
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rootfs creates a layer directory with files (path -> content; content
+// "->target" makes a symlink).
+func rootfs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for p, content := range files {
+		full := filepath.Join(dir, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		if len(content) > 2 && content[:2] == "->" {
+			require.NoError(t, os.Symlink(content[2:], full))
+			continue
+		}
+		require.NoError(t, os.WriteFile(full, []byte(content), 0755))
+	}
+	return dir
+}
+
+func copyExe(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+	require.NoError(t, os.WriteFile(dst, data, 0755))
+}
+
+func TestResolve(t *testing.T) {
+	upper := rootfs(t, map[string]string{
+		"bin/sh":  "->busybox",
+		"lib":     "->usr/lib",
+		"etc/abs": "->/bin/busybox",
+	})
+	lower := rootfs(t, map[string]string{
+		"bin/busybox":        "bb",
+		"usr/lib/ld-musl.so": "ld",
+		"usr/lib/libc.so":    "->ld-musl.so",
+		"bin/shadowed":       "lower",
+		"etc/loop":           "->loop",
+	})
+	layers := []string{upper, lower}
+
+	got, err := Resolve(layers, "/bin/sh")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(lower, "bin/busybox"), got)
+
+	got, err = Resolve(layers, "/lib/libc.so")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(lower, "usr/lib/ld-musl.so"), got)
+
+	got, err = Resolve(layers, "/etc/abs")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(lower, "bin/busybox"), got)
+
+	_, err = Resolve(layers, "/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = Resolve(layers, "/etc/loop")
+	assert.Error(t, err)
+}
+
+func TestInspect(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	info, err := Inspect(exe)
+	require.NoError(t, err)
+	assert.Equal(t, goruntime.GOARCH, info.Arch)
+
+	script := filepath.Join(rootfs(t, map[string]string{"run.sh": "#!/bin/sh\n"}), "run.sh")
+	_, err = Inspect(script)
+	assert.ErrorIs(t, err, ErrNotELF)
+}
+
+func TestCheckExecutable(t *testing.T) {
+	layer := rootfs(t, map[string]string{"bin/sh": "#!/bin/busybox\n"})
+	assert.NoError(t, CheckExecutable([]string{layer}, "/bin/sh"), "scripts pass")
+	assert.Error(t, CheckExecutable([]string{layer}, "/bin/bash"))
+
+	// A dynamic host binary without its loader in the image fails.
+	info, err := Inspect("/bin/sh")
+	if err != nil || info.Static() {
+		t.Skip("host /bin/sh is not a dynamic ELF binary")
+	}
+	img := t.TempDir()
+	copyExe(t, "/bin/sh", filepath.Join(img, "bin/sh"))
+	err = CheckExecutable([]string{img}, "/bin/sh")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), info.Interp)
+
+	copyExe(t, info.Interp, filepath.Join(img, info.Interp))
+	assert.NoError(t, CheckExecutable([]string{img}, "/bin/sh"))
+}
+
+func TestHostCanRun(t *testing.T) {
+	old := binfmtDir
+	t.Cleanup(func() { binfmtDir = old })
+	binfmtDir = t.TempDir()
+
+	assert.True(t, HostCanRun(goruntime.GOARCH))
+	foreign := "arm64"
+	if goruntime.GOARCH == "arm64" {
+		foreign = "amd64"
+	}
+	assert.False(t, HostCanRun(foreign))
+	require.NoError(t, os.WriteFile(filepath.Join(binfmtDir, "qemu-"+qemuNames[foreign]), []byte("enabled\ninterpreter /usr/bin/qemu\n"), 0644))
+	assert.True(t, HostCanRun(foreign))
+	assert.False(t, HostCanRun(""))
+}
+
+func TestCheckRunner(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	info, err := Inspect(exe)
+	require.NoError(t, err)
+	if info.Static() {
+		assert.NoError(t, CheckRunner(exe))
+	} else {
+		assert.ErrorContains(t, CheckRunner(exe), "dynamically linked")
+	}
+	script := filepath.Join(rootfs(t, map[string]string{"runner": "#!/bin/sh\n"}), "runner")
+	assert.Error(t, CheckRunner(script))
+}
@@ -0,0 +1,248 @@
+// Package failpoint injects errors and delays at named points in the daemon so
+// chaos tests can exercise recovery paths (store write failures, sandboxes that
+// fail to launch, unreachable runners, pool refills that stall).
+//
+// Failpoints are compiled in everywhere but stay inert unless the daemon is
+// built with the failpoints tag or SANDKASTEN_FAILPOINTS is set. The variable
+// either enables the mechanism ("on") or lists initial actions:
+//
+//	SANDKASTEN_FAILPOINTS="store_write=2*error;pool_refill=delay(3s)"
+//
+// An action is error, error(message), delay(duration) or off, optionally
+// prefixed with N* (fire N times, then turn off) or P% (fire with probability P).
+package failpoint
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Injection points used by the daemon.
+const (
+	StoreWrite    = "store_write"    // every store write, before it reaches SQLite
+	NsinitLaunch  = "nsinit_launch"  // before the sandbox init process is spawned
+	RunnerConnect = "runner_connect" // before dialing a runner socket
+	PoolRefill    = "pool_refill"    // before each pool refill create
+)
+
+// Names lists the injection points the daemon knows about.
+var Names = []string{StoreWrite, NsinitLaunch, RunnerConnect, PoolRefill}
+
+// EnvFailpoints enables failpoints and optionally sets their initial actions.
+const EnvFailpoints = "SANDKASTEN_FAILPOINTS"
+
+// ErrInjected is wrapped by every error returned from Inject.
+var ErrInjected = errors.New("failpoint")
+
+type action struct {
+	spec    string
+	err     string        // non-empty: fail with this message
+	delay   time.Duration // sleep before returning
+	remain  int           // fires left; -1 = unlimited
+	percent float64       // 0 = always
+}
+
+var (
+	enabled = buildEnabled
+	active  atomic.Bool // fast path: any failpoint set
+	mu      sync.Mutex
+	points  = map[string]*action{}
+)
+
+func init() {
+	v := strings.TrimSpace(os.Getenv(EnvFailpoints))
+	if v == "" {
+		return
+	}
+	enabled = true
+	if v == "on" || v == "1" {
+		return
+	}
+	for _, entry := range strings.Split(v, ";") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if err := Set(strings.TrimSpace(name), spec); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", EnvFailpoints, err)
+		}
+	}
+}
+
+// Enabled reports whether failpoints can be set in this process.
+func Enabled() bool {
+	return enabled
+}
+
+// Enable turns failpoints on, as the build tag or SANDKASTEN_FAILPOINTS would.
+// Tests in other packages use it.
+func Enable() {
+	enabled = true
+}
+
+// Inject runs the action set for name: it sleeps for a delay and returns an
+// error wrapping ErrInjected for an error action. Without an action it returns
+// nil immediately.
+func Inject(name string) error {
+	if !active.Load() {
+		return nil
+	}
+	mu.Lock()
+	a := points[name]
+	if a == nil || (a.percent > 0 && rand.Float64()*100 >= a.percent) {
+		mu.Unlock()
+		return nil
+	}
+	if a.remain > 0 {
+		a.remain--
+		if a.remain == 0 {
+			delete(points, name)
+			active.Store(len(points) > 0)
+		}
+	}
+	delay, msg := a.delay, a.err
+	mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if msg != "" {
+		return fmt.Errorf("%w %s: %s", ErrInjected, name, msg)
+	}
+	return nil
+}
+
+// Set installs the action described by spec at name. "off" clears it.
+func Set(name, spec string) error {
+	if !enabled {
+		return fmt.Errorf("failpoints are disabled (build with -tags failpoints or set %s)", EnvFailpoints)
+	}
+	if !known(name) {
+		return fmt.Errorf("unknown failpoint %q", name)
+	}
+	a, err := parse(spec)
+	if err != nil {
+		return fmt.Errorf("failpoint %s: %w", name, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if a == nil {
+		delete(points, name)
+	} else {
+		points[name] = a
+	}
+	active.Store(len(points) > 0)
+	return nil
+}
+
+// Clear removes the action at name.
+func Clear(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(points, name)
+	active.Store(len(points) > 0)
+}
+
+// Reset removes all actions.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	points = map[string]*action{}
+	active.Store(false)
+}
+
+// Status describes one injection point.
+type Status struct {
+	Name      string `json:"name"`
+	Action    string `json:"action"` // "off" when nothing is set
+	Remaining int    `json:"remaining,omitempty"`
+}
+
+// List returns every known injection point with its current action.
+func List() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]Status, 0, len(Names))
+	for _, name := range Names {
+		st := Status{Name: name, Action: "off"}
+		if a := points[name]; a != nil {
+			st.Action = a.spec
+			if a.remain > 0 {
+				st.Remaining = a.remain
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func known(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parse turns an action spec into an action; nil means off.
+func parse(spec string) (*action, error) {
+	spec = strings.TrimSpace(spec)
+	a := &action{spec: spec, remain: -1}
+	rest := spec
+	// Modifiers come before the action; a message may contain '*' or '%'.
+	head := rest
+	if open := strings.IndexByte(rest, '('); open >= 0 {
+		head = rest[:open]
+	}
+	if n, _, ok := strings.Cut(head, "*"); ok {
+		count, err := strconv.Atoi(n)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid count %q", n)
+		}
+		a.remain, rest, head = count, rest[len(n)+1:], head[len(n)+1:]
+	}
+	if p, _, ok := strings.Cut(head, "%"); ok {
+		pct, err := strconv.ParseFloat(p, 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("invalid percentage %q", p)
+		}
+		a.percent, rest = pct, rest[len(p)+1:]
+	}
+
+	kind, arg := rest, ""
+	if open := strings.IndexByte(rest, '('); open >= 0 {
+		if !strings.HasSuffix(rest, ")") {
+			return nil, fmt.Errorf("invalid action %q", rest)
+		}
+		kind, arg = rest[:open], rest[open+1:len(rest)-1]
+	}
+	switch kind {
+	case "off", "":
+		if rest != kind || a.remain != -1 || a.percent != 0 {
+			return nil, fmt.Errorf("invalid action %q", spec)
+		}
+		return nil, nil
+	case "error":
+		a.err = arg
+		if a.err == "" {
+			a.err = "injected error"
+		}
+	case "delay":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid delay %q", arg)
+		}
+		a.delay = d
+	default:
+		return nil, fmt.Errorf("unknown action %q (want error, delay or off)", kind)
+	}
+	return a, nil
+}
@@ -0,0 +1,98 @@
+package failpoint
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func enableForTest(t *testing.T) {
+	t.Helper()
+	prev := enabled
+	enabled = true
+	t.Cleanup(func() {
+		Reset()
+		enabled = prev
+	})
+}
+
+func TestInjectInactive(t *testing.T) {
+	enableForTest(t)
+	assert.NoError(t, Inject(StoreWrite))
+}
+
+func TestInjectError(t *testing.T) {
+	enableForTest(t)
+	require.NoError(t, Set(StoreWrite, "error(disk full)"))
+
+	err := Inject(StoreWrite)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.Contains(t, err.Error(), "store_write: disk full")
+	assert.NoError(t, Inject(PoolRefill), "other points are unaffected")
+}
+
+func TestInjectCount(t *testing.T) {
+	enableForTest(t)
+	require.NoError(t, Set(RunnerConnect, "2*error"))
+
+	assert.Error(t, Inject(RunnerConnect))
+	assert.Equal(t, 1, List()[2].Remaining)
+	assert.Error(t, Inject(RunnerConnect))
+	assert.NoError(t, Inject(RunnerConnect))
+	assert.Equal(t, "off", List()[2].Action)
+}
+
+func TestInjectDelay(t *testing.T) {
+	enableForTest(t)
+	require.NoError(t, Set(PoolRefill, "delay(20ms)"))
+
+	start := time.Now()
+	assert.NoError(t, Inject(PoolRefill))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestSetOffClears(t *testing.T) {
+	enableForTest(t)
+	require.NoError(t, Set(NsinitLaunch, "error"))
+	require.NoError(t, Set(NsinitLaunch, "off"))
+	assert.NoError(t, Inject(NsinitLaunch))
+}
+
+func TestSetRejects(t *testing.T) {
+	enableForTest(t)
+	for name, spec := range map[string]string{
+		"unknown action":   "explode",
+		"bad count":        "0*error",
+		"bad percent":      "150%error",
+		"bad delay":        "delay(soon)",
+		"unclosed":         "error(oops",
+		"modifier on off":  "3*off",
+		"negative delay":   "delay(-1s)",
+		"missing duration": "delay",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, Set(StoreWrite, spec))
+		})
+	}
+	assert.Error(t, Set("no_such_point", "error"))
+}
+
+func TestSetDisabled(t *testing.T) {
+	prev := enabled
+	enabled = false
+	t.Cleanup(func() { enabled = prev })
+
+	assert.Error(t, Set(StoreWrite, "error"))
+}
+
+func TestParseModifiers(t *testing.T) {
+	a, err := parse("3*25%error(50% * done)")
+	require.NoError(t, err)
+	assert.Equal(t, 3, a.remain)
+	assert.Equal(t, 25.0, a.percent)
+	assert.Equal(t, "50% * done", a.err)
+}
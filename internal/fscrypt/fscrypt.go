@@ -0,0 +1,192 @@
+// Package fscrypt encrypts workspace directories at rest with the kernel's
+// native filesystem encryption (fscrypt, v2 policies). Every workspace gets
+// its own key, derived from a master key file, so file contents and names are
+// ciphertext on disk and in block-level backups until the daemon loads the
+// key. Keys stay in the filesystem keyring until the workspace is deleted or
+// the filesystem is unmounted (reboot).
+package fscrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// keySize is the raw key length for AES-256-XTS contents encryption.
+const keySize = 64
+
+// minMasterKeySize is the shortest master key file accepted.
+const minMasterKeySize = 32
+
+// ErrUnsupported is returned when the platform or filesystem has no fscrypt.
+var ErrUnsupported = errors.New("fscrypt not supported")
+
+// keyID is the kernel's identifier for an added key.
+type keyID [16]byte
+
+// Workspaces creates, unlocks and deletes encrypted workspace directories
+// under root. It implements session.WorkspaceManager.
+type Workspaces struct {
+	root   string
+	master []byte
+
+	mu       sync.Mutex
+	unlocked map[string]keyID // workspace dir name -> key loaded by this process
+}
+
+// New returns a workspace manager for root keyed from the master key in
+// keyFile.
+func New(root, keyFile string) (*Workspaces, error) {
+	master, err := LoadMasterKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("fscrypt: create %s: %w", root, err)
+	}
+	return &Workspaces{root: root, master: master, unlocked: map[string]keyID{}}, nil
+}
+
+// LoadMasterKey reads the master key. The file is used as-is (trailing
+// newlines trimmed), so any secret of at least 32 bytes works, e.g. the
+// output of `head -c 64 /dev/urandom`.
+func LoadMasterKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("fscrypt: key_file is required")
+	}
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("fscrypt: read key file: %w", err)
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) < minMasterKeySize {
+		return nil, fmt.Errorf("fscrypt: key file %s holds %d bytes, need at least %d", keyFile, len(b), minMasterKeySize)
+	}
+	return b, nil
+}
+
+// deriveKey returns the raw fscrypt key of workspace dir name.
+func deriveKey(master []byte, name string) ([]byte, error) {
+	return hkdf.Key(sha256.New, master, nil, "sandkasten workspace "+name, keySize)
+}
+
+// Check verifies that the filesystem under root supports fscrypt by
+// encrypting a scratch directory.
+func (w *Workspaces) Check() error {
+	dir, err := os.MkdirTemp(w.root, ".fscrypt-check-")
+	if err != nil {
+		return fmt.Errorf("fscrypt: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := deriveKey(w.master, filepath.Base(dir))
+	if err != nil {
+		return err
+	}
+	id, err := addKey(w.root, key)
+	if err != nil {
+		return fmt.Errorf("fscrypt: add key on %s: %w", w.root, err)
+	}
+	defer removeKey(w.root, id)
+	if err := setPolicy(dir, id); err != nil {
+		return fmt.Errorf("fscrypt: encrypt %s: %w (ext4 needs `tune2fs -O encrypt`)", dir, err)
+	}
+	return nil
+}
+
+// Create creates workspace dir name as an empty encrypted directory and
+// loads its key. An existing directory is only unlocked.
+func (w *Workspaces) Create(ctx context.Context, name string, labels map[string]string) error {
+	dir := filepath.Join(w.root, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if os.IsExist(err) {
+			_, err = w.Exists(ctx, name)
+		}
+		return err
+	}
+	id, err := w.load(name)
+	if err != nil {
+		os.Remove(dir)
+		return err
+	}
+	if err := setPolicy(dir, id); err != nil {
+		os.Remove(dir)
+		return fmt.Errorf("fscrypt: encrypt workspace %s: %w", name, err)
+	}
+	return nil
+}
+
+// Exists reports whether workspace dir name exists, and loads its key if it
+// is encrypted so the daemon and sessions can read it. Directories created
+// before encryption was enabled stay readable and unencrypted.
+func (w *Workspaces) Exists(ctx context.Context, name string) (bool, error) {
+	dir := filepath.Join(w.root, name)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	policyID, encrypted, err := getPolicy(dir)
+	if err != nil {
+		return true, fmt.Errorf("fscrypt: workspace %s: %w", name, err)
+	}
+	if !encrypted {
+		return true, nil
+	}
+	id, err := w.load(name)
+	if err != nil {
+		return true, err
+	}
+	if id != policyID {
+		return true, fmt.Errorf("fscrypt: workspace %s was encrypted with a different master key", name)
+	}
+	return true, nil
+}
+
+// Delete removes workspace dir name and evicts its key from the keyring.
+func (w *Workspaces) Delete(ctx context.Context, name string) error {
+	dir := filepath.Join(w.root, name)
+	policyID, encrypted, err := getPolicy(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("fscrypt: workspace %s: %w", name, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	delete(w.unlocked, name)
+	w.mu.Unlock()
+	if encrypted {
+		if err := removeKey(w.root, policyID); err != nil {
+			return fmt.Errorf("fscrypt: remove key of workspace %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// load adds the key of workspace name to the filesystem keyring once per
+// process and returns its identifier.
+func (w *Workspaces) load(name string) (keyID, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if id, ok := w.unlocked[name]; ok {
+		return id, nil
+	}
+	key, err := deriveKey(w.master, name)
+	if err != nil {
+		return keyID{}, err
+	}
+	id, err := addKey(w.root, key)
+	clear(key)
+	if err != nil {
+		return keyID{}, fmt.Errorf("fscrypt: add key of workspace %s: %w", name, err)
+	}
+	w.unlocked[name] = id
+	return id, nil
+}
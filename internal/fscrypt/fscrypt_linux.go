@@ -0,0 +1,111 @@
+//go:build linux
+
+package fscrypt
+
+import (
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// addKey adds raw key to the keyring of the filesystem containing path.
+func addKey(path string, key []byte) (keyID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return keyID{}, err
+	}
+	defer f.Close()
+
+	// struct fscrypt_add_key_arg is followed by the raw key bytes.
+	var arg unix.FscryptAddKeyArg
+	hdr := int(unsafe.Sizeof(arg))
+	buf := make([]byte, hdr+len(key))
+	defer clear(buf)
+	a := (*unix.FscryptAddKeyArg)(unsafe.Pointer(&buf[0]))
+	a.Key_spec.Type = unix.FSCRYPT_KEY_SPEC_TYPE_IDENTIFIER
+	a.Raw_size = uint32(len(key))
+	copy(buf[hdr:], key)
+	if err := ioctl(f, unix.FS_IOC_ADD_ENCRYPTION_KEY, unsafe.Pointer(&buf[0])); err != nil {
+		return keyID{}, mapErr(err)
+	}
+	var id keyID
+	copy(id[:], a.Key_spec.U[:len(id)])
+	return id, nil
+}
+
+// removeKey removes key id from the keyring of the filesystem containing
+// path. A key that is not loaded is not an error.
+func removeKey(path string, id keyID) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var arg unix.FscryptRemoveKeyArg
+	arg.Key_spec.Type = unix.FSCRYPT_KEY_SPEC_TYPE_IDENTIFIER
+	copy(arg.Key_spec.U[:], id[:])
+	if err := ioctl(f, unix.FS_IOC_REMOVE_ENCRYPTION_KEY, unsafe.Pointer(&arg)); err != nil && !errors.Is(err, unix.ENOKEY) {
+		return mapErr(err)
+	}
+	return nil
+}
+
+// setPolicy encrypts the empty directory dir with key id.
+func setPolicy(dir string, id keyID) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	policy := unix.FscryptPolicyV2{
+		Version:                   unix.FSCRYPT_POLICY_V2,
+		Contents_encryption_mode:  unix.FSCRYPT_MODE_AES_256_XTS,
+		Filenames_encryption_mode: unix.FSCRYPT_MODE_AES_256_CTS,
+		Flags:                     unix.FSCRYPT_POLICY_FLAGS_PAD_32,
+		Master_key_identifier:     id,
+	}
+	return mapErr(ioctl(f, unix.FS_IOC_SET_ENCRYPTION_POLICY, unsafe.Pointer(&policy)))
+}
+
+// getPolicy returns the key identifier dir is encrypted with, or false if it
+// is not encrypted.
+func getPolicy(dir string) (keyID, bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return keyID{}, false, err
+	}
+	defer f.Close()
+
+	var arg unix.FscryptGetPolicyExArg
+	arg.Size = uint64(len(arg.Policy))
+	if err := ioctl(f, unix.FS_IOC_GET_ENCRYPTION_POLICY_EX, unsafe.Pointer(&arg)); err != nil {
+		if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) {
+			return keyID{}, false, nil
+		}
+		return keyID{}, false, err
+	}
+	policy := (*unix.FscryptPolicyV2)(unsafe.Pointer(&arg.Policy[0]))
+	if policy.Version != unix.FSCRYPT_POLICY_V2 {
+		return keyID{}, true, errors.New("encrypted with an unsupported v1 policy")
+	}
+	return policy.Master_key_identifier, true, nil
+}
+
+func mapErr(err error) error {
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOTTY) {
+		return ErrUnsupported
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fscrypt
+
+func addKey(path string, key []byte) (keyID, error) { return keyID{}, ErrUnsupported }
+
+func removeKey(path string, id keyID) error { return ErrUnsupported }
+
+func setPolicy(dir string, id keyID) error { return ErrUnsupported }
+
+func getPolicy(dir string) (keyID, bool, error) { return keyID{}, false, nil }
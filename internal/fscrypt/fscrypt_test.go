@@ -0,0 +1,90 @@
+package fscrypt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyFile(t *testing.T, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "workspace.key")
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+
+	got, err := LoadMasterKey(writeKeyFile(t, append(key, '\n')))
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	_, err = LoadMasterKey(writeKeyFile(t, key[:31]))
+	assert.Error(t, err)
+
+	_, err = LoadMasterKey(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	_, err = LoadMasterKey("")
+	assert.Error(t, err)
+}
+
+func TestDeriveKey(t *testing.T) {
+	master := bytes.Repeat([]byte("m"), 32)
+
+	a1, err := deriveKey(master, "ws-a")
+	require.NoError(t, err)
+	a2, err := deriveKey(master, "ws-a")
+	require.NoError(t, err)
+	b, err := deriveKey(master, "ws-b")
+	require.NoError(t, err)
+	other, err := deriveKey(bytes.Repeat([]byte("n"), 32), "ws-a")
+	require.NoError(t, err)
+
+	assert.Len(t, a1, keySize)
+	assert.Equal(t, a1, a2)
+	assert.NotEqual(t, a1, b)
+	assert.NotEqual(t, a1, other)
+}
+
+// TestWorkspacesRoundTrip needs root and a filesystem with encryption
+// enabled; it is skipped elsewhere.
+func TestWorkspacesRoundTrip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "workspaces")
+	w, err := New(root, writeKeyFile(t, bytes.Repeat([]byte("m"), 32)))
+	require.NoError(t, err)
+	if err := w.Check(); err != nil {
+		t.Skipf("fscrypt unavailable: %v", err)
+	}
+	ctx := context.Background()
+
+	require.NoError(t, w.Create(ctx, "ws1", nil))
+	_, encrypted, err := getPolicy(filepath.Join(root, "ws1"))
+	require.NoError(t, err)
+	assert.True(t, encrypted)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ws1", "secret.txt"), []byte("hello"), 0644))
+	exists, err := w.Exists(ctx, "ws1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	data, err := os.ReadFile(filepath.Join(root, "ws1", "secret.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// A manager with another master key cannot open the workspace.
+	other, err := New(root, writeKeyFile(t, bytes.Repeat([]byte("x"), 32)))
+	require.NoError(t, err)
+	_, err = other.Exists(ctx, "ws1")
+	assert.Error(t, err)
+
+	require.NoError(t, w.Delete(ctx, "ws1"))
+	exists, err = w.Exists(ctx, "ws1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// minFreeInodesPercent fails the disk check when this few inodes are left,
+// which breaks writes just like a full disk.
+const minFreeInodesPercent = 1
+
+// DiskSpace fails while the filesystem of dir has less than minFreeMB
+// available or is almost out of inodes.
+func DiskSpace(dir string, minFreeMB int) Check {
+	return Check{Name: "disk_space", Run: func(context.Context) error {
+		var st unix.Statfs_t
+		if err := unix.Statfs(dir, &st); err != nil {
+			return fmt.Errorf("statfs %s: %w", dir, err)
+		}
+		freeMB := int64(st.Bavail) * int64(st.Bsize) >> 20
+		if freeMB < int64(minFreeMB) {
+			return fmt.Errorf("%s has %d MB free, below %d MB", dir, freeMB, minFreeMB)
+		}
+		if st.Files > 0 && st.Ffree*100 < st.Files*minFreeInodesPercent {
+			return fmt.Errorf("%s has %d of %d inodes free", dir, st.Ffree, st.Files)
+		}
+		return nil
+	}}
+}
+
+// Overlay fails when the kernel no longer lists overlayfs, e.g. after the
+// module was unloaded.
+func Overlay() Check {
+	return Check{Name: "overlayfs", Run: func(context.Context) error {
+		data, err := os.ReadFile("/proc/filesystems")
+		if err != nil {
+			return fmt.Errorf("read /proc/filesystems: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if f := strings.Fields(line); len(f) > 0 && f[len(f)-1] == "overlay" {
+				return nil
+			}
+		}
+		return errors.New("overlay filesystem not available (modprobe overlay)")
+	}}
+}
+
+// Clock fails while the kernel reports the system clock as unsynchronized
+// or its estimated error above maxErrorMs, which breaks TLS, token expiry
+// and session TTLs.
+func Clock(maxErrorMs int) Check {
+	return Check{Name: "clock", Run: func(context.Context) error {
+		var tx unix.Timex // Modes 0: read only
+		state, err := unix.Adjtimex(&tx)
+		if err != nil {
+			return fmt.Errorf("adjtimex: %w", err)
+		}
+		if state == unix.TIME_ERROR || tx.Status&unix.STA_UNSYNC != 0 {
+			return errors.New("system clock is not synchronized (is NTP running?)")
+		}
+		if errMs := int64(tx.Maxerror) / 1000; errMs > int64(maxErrorMs) {
+			return fmt.Errorf("estimated clock error %dms above %dms", errMs, maxErrorMs)
+		}
+		return nil
+	}}
+}
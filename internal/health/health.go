@@ -0,0 +1,204 @@
+// Package health runs host checks in the daemon (cgroup delegation,
+// overlayfs, disk space, clock) so a degraded host shows up in /readyz and
+// alerts before session creates start failing.
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+var (
+	checkFailing = metrics.Default.NewGaugeVec("sandkasten_health_check_failing",
+		"1 while the host check fails, else 0.", "check")
+	notifyFailures = metrics.Default.NewCounterVec("sandkasten_health_notify_failures_total",
+		"Health events that could not be delivered.")
+)
+
+// Events sent when a check changes.
+const (
+	EventDegraded  = "host.degraded"
+	EventRecovered = "host.recovered"
+)
+
+// checkTimeout bounds a single check, so a hung filesystem cannot stall the
+// others.
+const checkTimeout = 10 * time.Second
+
+// Check is one host check; Run returns why the host is degraded, or nil.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the last outcome of a check.
+type Result struct {
+	Name      string    `json:"name"`
+	OK        bool      `json:"ok"`
+	Detail    string    `json:"detail,omitempty"` // why it fails
+	Since     time.Time `json:"since"`            // when OK last changed
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Status is the state of all checks. The host is degraded while one fails.
+type Status struct {
+	Degraded bool     `json:"degraded"`
+	Checks   []Result `json:"checks"`
+}
+
+// Failing returns the names of the failing checks.
+func (s Status) Failing() []string {
+	var names []string
+	for _, r := range s.Checks {
+		if !r.OK {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// Event reports a check that started or stopped failing. It is the webhook
+// body.
+type Event struct {
+	Event  string    `json:"event"` // host.degraded | host.recovered
+	Host   string    `json:"host"`
+	Check  string    `json:"check"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Notifier delivers an event.
+type Notifier func(ctx context.Context, ev Event) error
+
+// Monitor runs checks and notifies about changes.
+type Monitor struct {
+	logger *slog.Logger
+	checks []Check
+	notify []Notifier
+	host   string
+
+	mu      sync.Mutex
+	results map[string]*Result
+}
+
+// New returns a monitor of checks that tells notify about every check that
+// starts or stops failing.
+func New(logger *slog.Logger, checks []Check, notify ...Notifier) *Monitor {
+	host, _ := os.Hostname()
+	return &Monitor{logger: logger, checks: checks, notify: notify, host: host, results: make(map[string]*Result)}
+}
+
+// Run runs every check once. A check failing on its first run is reported
+// as degraded; one passing on its first run is not reported.
+func (m *Monitor) Run(ctx context.Context) error {
+	for _, c := range m.checks {
+		err := runCheck(ctx, c)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		now := time.Now().UTC()
+		ok := err == nil
+
+		m.mu.Lock()
+		r := m.results[c.Name]
+		wasOK := r == nil || r.OK
+		if r == nil || r.OK != ok {
+			r = &Result{Name: c.Name, Since: now}
+			m.results[c.Name] = r
+		}
+		r.OK, r.Detail, r.CheckedAt = ok, "", now
+		if err != nil {
+			r.Detail = err.Error()
+		}
+		m.mu.Unlock()
+
+		if ok {
+			checkFailing.Set(0, c.Name)
+		} else {
+			checkFailing.Set(1, c.Name)
+		}
+		switch {
+		case !ok && wasOK:
+			m.logger.Warn("host degraded", "check", c.Name, "error", err)
+			m.send(ctx, Event{Event: EventDegraded, Host: m.host, Check: c.Name, Detail: err.Error(), At: now})
+		case ok && !wasOK:
+			m.logger.Info("host recovered", "check", c.Name)
+			m.send(ctx, Event{Event: EventRecovered, Host: m.host, Check: c.Name, At: now})
+		}
+	}
+	return nil
+}
+
+func runCheck(ctx context.Context, c Check) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("check panicked: %v", p)
+		}
+	}()
+	return c.Run(ctx)
+}
+
+func (m *Monitor) send(ctx context.Context, ev Event) {
+	for _, n := range m.notify {
+		if err := n(ctx, ev); err != nil {
+			notifyFailures.Inc()
+			m.logger.Warn("health notification failed", "event", ev.Event, "check", ev.Check, "error", err)
+		}
+	}
+}
+
+// Status returns the last result of every check that ran, in check order.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := Status{Checks: []Result{}}
+	for _, c := range m.checks {
+		r := m.results[c.Name]
+		if r == nil {
+			continue
+		}
+		st.Checks = append(st.Checks, *r)
+		st.Degraded = st.Degraded || !r.OK
+	}
+	return st
+}
+
+// Webhook returns a notifier that posts events as JSON to url. Any 2xx
+// status is success.
+func Webhook(url string, timeout time.Duration) Notifier {
+	client := &http.Client{Timeout: timeout}
+	return func(ctx context.Context, ev Event) error {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("health webhook: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("health webhook: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("health webhook: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("health webhook: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor_NotifiesChanges(t *testing.T) {
+	var diskErr error
+	checks := []Check{
+		{Name: "disk_space", Run: func(context.Context) error { return diskErr }},
+		{Name: "broken", Run: func(context.Context) error { panic("boom") }},
+	}
+	var events []Event
+	m := New(slog.New(slog.NewTextHandler(io.Discard, nil)), checks, func(_ context.Context, ev Event) error {
+		events = append(events, ev)
+		return nil
+	})
+
+	assert.Empty(t, m.Status().Checks, "nothing ran yet")
+
+	require.NoError(t, m.Run(context.Background()))
+	st := m.Status()
+	assert.True(t, st.Degraded)
+	assert.Equal(t, []string{"broken"}, st.Failing())
+	require.Len(t, events, 1, "a passing first run is not reported")
+	assert.Equal(t, EventDegraded, events[0].Event)
+	assert.Contains(t, events[0].Detail, "panicked")
+
+	diskErr = errors.New("12 MB free")
+	require.NoError(t, m.Run(context.Background()))
+	require.NoError(t, m.Run(context.Background()))
+	require.Len(t, events, 2, "a check still failing is reported once")
+	assert.Equal(t, Event{Event: EventDegraded, Host: m.host, Check: "disk_space", Detail: "12 MB free", At: events[1].At}, events[1])
+	since := m.Status().Checks[0].Since
+
+	diskErr = nil
+	require.NoError(t, m.Run(context.Background()))
+	require.Len(t, events, 3)
+	assert.Equal(t, EventRecovered, events[2].Event)
+	assert.Equal(t, "disk_space", events[2].Check)
+	r := m.Status().Checks[0]
+	assert.True(t, r.OK)
+	assert.Empty(t, r.Detail)
+	assert.True(t, r.Since.After(since) || r.Since.Equal(since))
+}
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	send := Webhook(srv.URL, time.Second)
+	ev := Event{Event: EventDegraded, Host: "node-1", Check: "clock", Detail: "not synchronized", At: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, send(context.Background(), ev))
+	assert.Equal(t, ev, got)
+
+	status = http.StatusBadGateway
+	assert.ErrorContains(t, send(context.Background(), ev), "status 502")
+}
@@ -0,0 +1,159 @@
+// Package hooks runs operator-provided hooks after a session is destroyed: a
+// host command (e.g. to sync the workspace elsewhere) and a webhook.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+// Hook names, used as the "hook" label of the failure counter.
+const (
+	HookCommands    = "commands"
+	HookHostCommand = "host_command"
+	HookWebhook     = "webhook"
+)
+
+var failures = metrics.Default.NewCounterVec("sandkasten_destroy_hook_failures_total",
+	"Destroy hooks that failed, by hook.", "hook")
+
+// Failed counts a failed hook.
+func Failed(hook string) {
+	failures.Inc(hook)
+}
+
+// DestroyEvent describes a session that was torn down. It is the webhook
+// body.
+type DestroyEvent struct {
+	Event       string    `json:"event"` // always "session.destroyed"
+	SessionID   string    `json:"session_id"`
+	Image       string    `json:"image"`
+	WorkspaceID string    `json:"workspace_id,omitempty"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Reason      string    `json:"reason"` // destroyed | expired | crashed
+	DestroyedAt time.Time `json:"destroyed_at"`
+}
+
+// Timeout returns the per-hook timeout of cfg.
+func Timeout(cfg config.DestroyHooksConfig) time.Duration {
+	if cfg.TimeoutSeconds <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(cfg.TimeoutSeconds) * time.Second
+}
+
+// Notifier runs the host-side destroy hooks.
+type Notifier struct {
+	argv         []string
+	url          string
+	workspaceDir string
+	timeout      time.Duration
+	client       *http.Client
+}
+
+// New returns the notifier for cfg, or nil if it has no host command and no
+// webhook.
+func New(cfg config.DestroyHooksConfig, dataDir string) *Notifier {
+	if len(cfg.HostCommand) == 0 && cfg.WebhookURL == "" {
+		return nil
+	}
+	timeout := Timeout(cfg)
+	return &Notifier{
+		argv:         cfg.HostCommand,
+		url:          cfg.WebhookURL,
+		workspaceDir: filepath.Join(dataDir, "workspaces"),
+		timeout:      timeout,
+		client:       &http.Client{Timeout: timeout},
+	}
+}
+
+// AfterDestroy runs the host command, then sends the webhook. Each hook runs
+// even if the other failed; failures are counted and returned joined.
+func (n *Notifier) AfterDestroy(ctx context.Context, ev DestroyEvent) error {
+	ev.Event = "session.destroyed"
+	var errs []error
+	if len(n.argv) > 0 {
+		if err := n.runCommand(ctx, ev); err != nil {
+			Failed(HookHostCommand)
+			errs = append(errs, err)
+		}
+	}
+	if n.url != "" {
+		if err := n.post(ctx, ev); err != nil {
+			Failed(HookWebhook)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runCommand runs the host command with the session in its environment.
+// SANDKASTEN_WORKSPACE_DIR is empty for sessions without a workspace.
+func (n *Notifier) runCommand(ctx context.Context, ev DestroyEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	workspaceDir := ""
+	if ev.WorkspaceID != "" {
+		workspaceDir = filepath.Join(n.workspaceDir, ev.WorkspaceID)
+	}
+	cmd := exec.CommandContext(ctx, n.argv[0], n.argv[1:]...)
+	cmd.Env = append(cmd.Environ(),
+		"SANDKASTEN_SESSION_ID="+ev.SessionID,
+		"SANDKASTEN_IMAGE="+ev.Image,
+		"SANDKASTEN_WORKSPACE_ID="+ev.WorkspaceID,
+		"SANDKASTEN_WORKSPACE_DIR="+workspaceDir,
+		"SANDKASTEN_DESTROY_REASON="+ev.Reason,
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("destroy host command: %w: %s", err, firstLine(string(out)))
+	}
+	return nil
+}
+
+// post sends ev as JSON; any 2xx status is success.
+func (n *Notifier) post(ctx context.Context, ev DestroyEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("destroy webhook: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("destroy webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("destroy webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("destroy webhook: status %d: %s", resp.StatusCode, firstLine(string(msg)))
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 200 {
+		s = s[:200]
+	}
+	return s
+}
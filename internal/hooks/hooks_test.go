@@ -0,0 +1,78 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDisabled(t *testing.T) {
+	assert.Nil(t, New(config.DestroyHooksConfig{Commands: []string{"sync"}}, t.TempDir()))
+}
+
+func TestHostCommand(t *testing.T) {
+	dataDir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "env")
+	n := New(config.DestroyHooksConfig{
+		HostCommand: []string{"sh", "-c", `echo "$SANDKASTEN_SESSION_ID $SANDKASTEN_DESTROY_REASON $SANDKASTEN_WORKSPACE_DIR" > ` + out},
+	}, dataDir)
+	require.NotNil(t, n)
+
+	err := n.AfterDestroy(context.Background(), DestroyEvent{SessionID: "s1", WorkspaceID: "ws1", Reason: "expired"})
+	require.NoError(t, err)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "s1 expired "+filepath.Join(dataDir, "workspaces", "ws1")+"\n", string(data))
+}
+
+func TestHostCommandFailure(t *testing.T) {
+	n := New(config.DestroyHooksConfig{HostCommand: []string{"sh", "-c", "echo boom; exit 3"}}, t.TempDir())
+	before := failures.Value(HookHostCommand)
+
+	err := n.AfterDestroy(context.Background(), DestroyEvent{SessionID: "s1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+	assert.Equal(t, before+1, failures.Value(HookHostCommand))
+}
+
+func TestWebhook(t *testing.T) {
+	var got DestroyEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n := New(config.DestroyHooksConfig{WebhookURL: srv.URL}, t.TempDir())
+	err := n.AfterDestroy(context.Background(), DestroyEvent{SessionID: "s1", Image: "python", Reason: "destroyed"})
+	require.NoError(t, err)
+	assert.Equal(t, "session.destroyed", got.Event)
+	assert.Equal(t, "s1", got.SessionID)
+	assert.Equal(t, "python", got.Image)
+	assert.Equal(t, "destroyed", got.Reason)
+}
+
+func TestWebhookFailureStillRunsCommand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "ran")
+	n := New(config.DestroyHooksConfig{HostCommand: []string{"touch", out}, WebhookURL: srv.URL}, t.TempDir())
+	before := failures.Value(HookWebhook)
+
+	err := n.AfterDestroy(context.Background(), DestroyEvent{SessionID: "s1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 503")
+	assert.FileExists(t, out)
+	assert.Equal(t, before+1, failures.Value(HookWebhook))
+}
@@ -0,0 +1,273 @@
+// Package imagescan runs a vulnerability scanner (Trivy or Grype) against the
+// root filesystem of an image and keeps the report next to the image's
+// meta.json, where the daemon checks it before creating sessions.
+package imagescan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scanners.
+const (
+	ScannerTrivy = "trivy"
+	ScannerGrype = "grype"
+)
+
+// ReportFile is the report inside an image directory.
+const ReportFile = "scan.json"
+
+// Severities from lowest to highest. Grype's "negligible" counts as low.
+var Severities = []string{"unknown", "low", "medium", "high", "critical"}
+
+// SeverityRank orders severities: higher is worse, -1 for none of Severities.
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeSeverity maps a scanner's severity to one of Severities.
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(s)
+	if s == "negligible" {
+		return "low"
+	}
+	if SeverityRank(s) < 0 {
+		return "unknown"
+	}
+	return s
+}
+
+// Finding is one vulnerable package.
+type Finding struct {
+	ID           string `json:"id"` // CVE or advisory ID
+	Package      string `json:"package"`
+	Version      string `json:"version,omitempty"`
+	FixedVersion string `json:"fixed_version,omitempty"` // "" = no fix yet
+	Severity     string `json:"severity"`
+	Title        string `json:"title,omitempty"`
+}
+
+// Report is the result of scanning one version of an image.
+type Report struct {
+	Scanner     string         `json:"scanner"`
+	ImageDigest string         `json:"image_digest,omitempty"` // meta.json hash the report is for
+	ScannedAt   time.Time      `json:"scanned_at"`
+	Counts      map[string]int `json:"counts"` // findings by severity
+	Findings    []Finding      `json:"findings"`
+}
+
+// AtLeast returns the number of findings of severity or worse.
+func (r *Report) AtLeast(severity string) int {
+	floor := SeverityRank(severity)
+	n := 0
+	for sev, count := range r.Counts {
+		if SeverityRank(sev) >= floor {
+			n += count
+		}
+	}
+	return n
+}
+
+// Summary lists the non-zero counts, worst first, e.g. "2 critical, 5 high".
+func (r *Report) Summary() string {
+	var parts []string
+	for i := len(Severities) - 1; i >= 0; i-- {
+		if n := r.Counts[Severities[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, Severities[i]))
+		}
+	}
+	if len(parts) == 0 {
+		return "no vulnerabilities"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Scan runs scanner against the root filesystem at rootfs. The scanner binary
+// must be on PATH and keep its own vulnerability database up to date.
+func Scan(ctx context.Context, scanner, rootfs string, timeout time.Duration) (*Report, error) {
+	var args []string
+	switch scanner {
+	case ScannerTrivy:
+		args = []string{"rootfs", "--quiet", "--scanners", "vuln", "--format", "json", rootfs}
+	case ScannerGrype:
+		args = []string{"dir:" + rootfs, "--quiet", "--output", "json"}
+	default:
+		return nil, fmt.Errorf("unknown scanner %q (want trivy or grype)", scanner)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, scanner, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", scanner, err, lastLine(msg))
+		}
+		return nil, fmt.Errorf("%s: %w", scanner, err)
+	}
+
+	var findings []Finding
+	var err error
+	if scanner == ScannerTrivy {
+		findings, err = parseTrivy(stdout.Bytes())
+	} else {
+		findings, err = parseGrype(stdout.Bytes())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: parse report: %w", scanner, err)
+	}
+	return newReport(scanner, findings), nil
+}
+
+// newReport dedupes findings (a package can show up in several targets),
+// sorts them worst first and counts them.
+func newReport(scanner string, findings []Finding) *Report {
+	r := &Report{Scanner: scanner, ScannedAt: time.Now().UTC(), Counts: make(map[string]int), Findings: []Finding{}}
+	seen := make(map[Finding]bool)
+	for _, f := range findings {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		r.Findings = append(r.Findings, f)
+		r.Counts[f.Severity]++
+	}
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if ra, rb := SeverityRank(a.Severity), SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Package < b.Package
+	})
+	return r
+}
+
+func parseTrivy(data []byte) ([]Finding, error) {
+	var out struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, res := range out.Results {
+		for _, v := range res.Vulnerabilities {
+			findings = append(findings, Finding{
+				ID:           v.VulnerabilityID,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+				Severity:     normalizeSeverity(v.Severity),
+				Title:        v.Title,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func parseGrype(data []byte) ([]Finding, error) {
+	var out struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, m := range out.Matches {
+		findings = append(findings, Finding{
+			ID:           m.Vulnerability.ID,
+			Package:      m.Artifact.Name,
+			Version:      m.Artifact.Version,
+			FixedVersion: strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:     normalizeSeverity(m.Vulnerability.Severity),
+			Title:        m.Vulnerability.Description,
+		})
+	}
+	return findings, nil
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+// Read returns the report in imageDir, or nil if the image was never scanned.
+func Read(imageDir string) (*Report, error) {
+	data, err := os.ReadFile(filepath.Join(imageDir, ReportFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read scan report: %w", err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse scan report: %w", err)
+	}
+	return &r, nil
+}
+
+// Write replaces the report in imageDir atomically.
+func Write(imageDir string, r *Report) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encode scan report: %w", err)
+	}
+	path := filepath.Join(imageDir, ReportFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write scan report: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write scan report: %w", err)
+	}
+	return nil
+}
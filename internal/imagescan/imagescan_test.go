@@ -0,0 +1,88 @@
+package imagescan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const trivyOutput = `{
+  "Results": [
+    {"Target": "rootfs (alpine 3.19.0)", "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2024-0001", "PkgName": "openssl", "InstalledVersion": "3.1.4-r1", "FixedVersion": "3.1.4-r3", "Severity": "CRITICAL", "Title": "openssl: buffer overflow"},
+      {"VulnerabilityID": "CVE-2024-0002", "PkgName": "busybox", "InstalledVersion": "1.36.1-r15", "Severity": "MEDIUM"}
+    ]},
+    {"Target": "usr/lib/python3.11", "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2024-0001", "PkgName": "openssl", "InstalledVersion": "3.1.4-r1", "FixedVersion": "3.1.4-r3", "Severity": "CRITICAL", "Title": "openssl: buffer overflow"}
+    ]},
+    {"Target": "etc/passwd"}
+  ]
+}`
+
+const grypeOutput = `{
+  "matches": [
+    {"vulnerability": {"id": "CVE-2024-0003", "severity": "High", "fix": {"versions": ["2.0.1"]}}, "artifact": {"name": "zlib", "version": "2.0.0"}},
+    {"vulnerability": {"id": "CVE-2024-0004", "severity": "Negligible", "fix": {"versions": []}}, "artifact": {"name": "tar", "version": "1.35"}}
+  ]
+}`
+
+func TestParseTrivy(t *testing.T) {
+	findings, err := parseTrivy([]byte(trivyOutput))
+	require.NoError(t, err)
+	r := newReport(ScannerTrivy, findings)
+
+	assert.Equal(t, map[string]int{"critical": 1, "medium": 1}, r.Counts, "duplicate finding counted once")
+	require.Len(t, r.Findings, 2)
+	assert.Equal(t, Finding{ID: "CVE-2024-0001", Package: "openssl", Version: "3.1.4-r1", FixedVersion: "3.1.4-r3", Severity: "critical", Title: "openssl: buffer overflow"}, r.Findings[0])
+	assert.Equal(t, 1, r.AtLeast("critical"))
+	assert.Equal(t, 2, r.AtLeast("medium"))
+	assert.Equal(t, "1 critical, 1 medium", r.Summary())
+}
+
+func TestParseGrype(t *testing.T) {
+	findings, err := parseGrype([]byte(grypeOutput))
+	require.NoError(t, err)
+	r := newReport(ScannerGrype, findings)
+
+	assert.Equal(t, map[string]int{"high": 1, "low": 1}, r.Counts)
+	assert.Equal(t, "2.0.1", r.Findings[0].FixedVersion)
+	assert.Equal(t, 0, r.AtLeast("critical"))
+	assert.Equal(t, 1, r.AtLeast("high"))
+}
+
+func TestScan(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = rootfs ] || { echo \"bad args: $*\" >&2; exit 2; }\ncat <<'JSON'\n" + trivyOutput + "\nJSON\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "trivy"), []byte(script), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "grype"), []byte("#!/bin/sh\necho 'db update failed' >&2\nexit 1\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	r, err := Scan(context.Background(), ScannerTrivy, t.TempDir(), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, ScannerTrivy, r.Scanner)
+	assert.Equal(t, 1, r.Counts["critical"])
+
+	_, err = Scan(context.Background(), ScannerGrype, t.TempDir(), time.Minute)
+	assert.ErrorContains(t, err, "db update failed")
+
+	_, err = Scan(context.Background(), "clair", t.TempDir(), time.Minute)
+	assert.ErrorContains(t, err, "unknown scanner")
+}
+
+func TestReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Read(dir)
+	require.NoError(t, err)
+	assert.Nil(t, r, "never scanned")
+
+	want := &Report{Scanner: ScannerGrype, ImageDigest: "sha256:abc", ScannedAt: time.Now().UTC().Truncate(time.Second), Counts: map[string]int{"high": 1}, Findings: []Finding{{ID: "CVE-1", Package: "zlib", Severity: "high"}}}
+	require.NoError(t, Write(dir, want))
+	r, err = Read(dir)
+	require.NoError(t, err)
+	assert.Equal(t, want, r)
+}
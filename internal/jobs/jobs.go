@@ -0,0 +1,245 @@
+// Package jobs runs the daemon's background work (reaping, pool refills,
+// pruning, image refreshes, ...) as named, supervised jobs: a failed run is
+// retried per the job's retry policy, panics are recovered into errors, and
+// the last run of every job is kept for GET /v1/system/jobs.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+var (
+	jobRuns = metrics.Default.NewCounterVec("sandkasten_job_runs_total",
+		"Runs of background jobs, including retries, by result.", "job", "result")
+)
+
+// Job states reported in Status.
+const (
+	StateWaiting = "waiting" // before the first run, see Job.After
+	StateIdle    = "idle"    // between runs
+	StateRunning = "running"
+	StateDone    = "done"    // a one-shot job finished
+	StateStopped = "stopped" // the runner's context was cancelled
+)
+
+// Job is a unit of background work.
+type Job struct {
+	Name string
+	// Interval is the time between the start of runs; 0 runs the job once.
+	Interval time.Duration
+	// Immediate runs the job right away instead of after the first Interval.
+	Immediate bool
+	// After delays the first run until it is closed.
+	After <-chan struct{}
+	Retry RetryPolicy
+	Run   func(ctx context.Context) error
+}
+
+// RetryPolicy retries a failed run before the job waits for its next
+// interval. The zero value does not retry.
+type RetryPolicy struct {
+	Attempts int           // retries after a failed run
+	Backoff  time.Duration // before the first retry, doubled for each one after
+}
+
+// DefaultRetry retries twice, after 5s and 10s.
+var DefaultRetry = RetryPolicy{Attempts: 2, Backoff: 5 * time.Second}
+
+// Status is the state and last run of a job.
+type Status struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	IntervalSeconds     float64    `json:"interval_seconds,omitempty"`
+	Runs                int64      `json:"runs"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastStart           *time.Time `json:"last_start,omitempty"`
+	LastDurationMs      int64      `json:"last_duration_ms"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	NextRun             *time.Time `json:"next_run,omitempty"`
+}
+
+// Runner supervises jobs. The zero value is not usable; see New.
+type Runner struct {
+	logger *slog.Logger
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs []*Status
+}
+
+// New returns a runner that logs failed runs to logger.
+func New(logger *slog.Logger) *Runner {
+	return &Runner{logger: logger}
+}
+
+// Start runs job in its own goroutine until ctx is cancelled or, for a
+// one-shot job, until it succeeded or used up its retries.
+func (r *Runner) Start(ctx context.Context, job Job) {
+	st := &Status{Name: job.Name, State: StateIdle, IntervalSeconds: job.Interval.Seconds()}
+	if job.After != nil {
+		st.State = StateWaiting
+	}
+	r.mu.Lock()
+	r.jobs = append(r.jobs, st)
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.loop(ctx, job, st)
+	}()
+}
+
+// Wait blocks until all jobs returned after their context was cancelled.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Status returns the status of all jobs by name.
+func (r *Runner) Status() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Status, 0, len(r.jobs))
+	for _, st := range r.jobs {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *Runner) loop(ctx context.Context, job Job, st *Status) {
+	defer r.update(func() {
+		if st.State != StateDone {
+			st.State = StateStopped
+		}
+		st.NextRun = nil
+	})
+	if job.After != nil {
+		select {
+		case <-job.After:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	wait := job.Interval
+	if job.Immediate || job.Interval <= 0 {
+		wait = 0
+	}
+	for {
+		if !sleep(ctx, wait, r.scheduled(st)) {
+			return
+		}
+		start := time.Now()
+		r.runWithRetry(ctx, job, st)
+		if ctx.Err() != nil {
+			return
+		}
+		if job.Interval <= 0 {
+			r.update(func() { st.State = StateDone })
+			return
+		}
+		wait = job.Interval - time.Since(start)
+	}
+}
+
+// runWithRetry runs job once plus up to Retry.Attempts retries while it
+// fails.
+func (r *Runner) runWithRetry(ctx context.Context, job Job, st *Status) {
+	backoff := job.Retry.Backoff
+	for attempt := 0; ; attempt++ {
+		err := r.runOnce(ctx, job, st)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if attempt >= job.Retry.Attempts {
+			r.logger.Error("background job failed", "job", job.Name, "error", err, "attempts", attempt+1)
+			return
+		}
+		r.logger.Warn("background job failed, retrying", "job", job.Name, "error", err, "retry_in", backoff)
+		if !sleep(ctx, backoff, r.scheduled(st)) {
+			return
+		}
+		backoff *= 2
+	}
+}
+
+func (r *Runner) runOnce(ctx context.Context, job Job, st *Status) (err error) {
+	start := time.Now()
+	r.update(func() {
+		st.State = StateRunning
+		st.LastStart = &start
+		st.NextRun = nil
+	})
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+			r.logger.Error("background job panicked", "job", job.Name, "panic", p, "stack", string(debug.Stack()))
+		}
+		if err != nil && errors.Is(err, context.Canceled) && ctx.Err() != nil {
+			err = nil // shutting down
+		}
+		end := time.Now()
+		r.update(func() {
+			st.State = StateIdle
+			st.Runs++
+			st.LastDurationMs = end.Sub(start).Milliseconds()
+			if err != nil {
+				st.Failures++
+				st.ConsecutiveFailures++
+				st.LastError = err.Error()
+				return
+			}
+			st.ConsecutiveFailures = 0
+			st.LastError = ""
+			st.LastSuccess = &end
+		})
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		jobRuns.Inc(job.Name, result)
+	}()
+	return job.Run(ctx)
+}
+
+// scheduled returns a callback that records the next run of st.
+func (r *Runner) scheduled(st *Status) func(time.Time) {
+	return func(next time.Time) {
+		r.update(func() { st.NextRun = &next })
+	}
+}
+
+func (r *Runner) update(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn()
+}
+
+// sleep waits d, reporting when it will be done to scheduled. It returns
+// false if ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration, scheduled func(time.Time)) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	scheduled(time.Now().Add(d))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
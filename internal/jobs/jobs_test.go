@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRunner() *Runner {
+	return New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func waitState(t *testing.T, r *Runner, state string) Status {
+	t.Helper()
+	var st Status
+	require.Eventually(t, func() bool {
+		st = r.Status()[0]
+		return st.State == state
+	}, 2*time.Second, 5*time.Millisecond)
+	return st
+}
+
+func TestRunner_OneShotRetries(t *testing.T) {
+	r := testRunner()
+	var calls atomic.Int32
+	r.Start(context.Background(), Job{
+		Name:  "flaky",
+		Retry: RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+		Run: func(context.Context) error {
+			if calls.Add(1) < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		},
+	})
+
+	st := waitState(t, r, StateDone)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, int64(3), st.Runs)
+	assert.Equal(t, int64(2), st.Failures)
+	assert.Zero(t, st.ConsecutiveFailures)
+	assert.Empty(t, st.LastError)
+	assert.NotNil(t, st.LastSuccess)
+	r.Wait()
+}
+
+func TestRunner_GivesUpAfterRetries(t *testing.T) {
+	r := testRunner()
+	r.Start(context.Background(), Job{
+		Name:  "broken",
+		Retry: RetryPolicy{Attempts: 1, Backoff: time.Millisecond},
+		Run:   func(context.Context) error { return errors.New("boom") },
+	})
+
+	st := waitState(t, r, StateDone)
+	assert.Equal(t, int64(2), st.Runs)
+	assert.Equal(t, 2, st.ConsecutiveFailures)
+	assert.Equal(t, "boom", st.LastError)
+	assert.Nil(t, st.LastSuccess)
+}
+
+func TestRunner_RecoversPanics(t *testing.T) {
+	r := testRunner()
+	r.Start(context.Background(), Job{
+		Name: "panics",
+		Run:  func(context.Context) error { panic("oops") },
+	})
+
+	st := waitState(t, r, StateDone)
+	assert.Equal(t, "panic: oops", st.LastError)
+	assert.Equal(t, int64(1), st.Failures)
+}
+
+func TestRunner_IntervalAndAfter(t *testing.T) {
+	r := testRunner()
+	ctx, cancel := context.WithCancel(context.Background())
+	gate := make(chan struct{})
+	var calls atomic.Int32
+	r.Start(ctx, Job{
+		Name:      "ticker",
+		Interval:  5 * time.Millisecond,
+		Immediate: true,
+		After:     gate,
+		Run: func(context.Context) error {
+			calls.Add(1)
+			return nil
+		},
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, StateWaiting, r.Status()[0].State)
+	assert.Zero(t, calls.Load(), "no run before After is closed")
+
+	close(gate)
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 5*time.Millisecond.Seconds(), r.Status()[0].IntervalSeconds)
+
+	cancel()
+	r.Wait()
+	st := r.Status()[0]
+	assert.Equal(t, StateStopped, st.State)
+	assert.Nil(t, st.NextRun)
+}
+
+func TestRunner_StatusSortedByName(t *testing.T) {
+	r := testRunner()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, name := range []string{"reaper", "db-maintenance", "pool-reclaim"} {
+		r.Start(ctx, Job{Name: name, Interval: time.Hour, Run: func(context.Context) error { return nil }})
+	}
+
+	var names []string
+	for _, st := range r.Status() {
+		names = append(names, st.Name)
+	}
+	assert.Equal(t, []string{"db-maintenance", "pool-reclaim", "reaper"}, names)
+}
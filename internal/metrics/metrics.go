@@ -0,0 +1,294 @@
+// Package metrics is a small Prometheus-compatible metrics registry. It covers
+// the counters, gauges and histograms sandkasten needs without pulling in the full
+// client library, and renders them in the text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are histogram buckets in seconds suited to SQLite
+// and runtime calls: sub-millisecond reads up to multi-second lock waits.
+var DefaultDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 15}
+
+// Default is the process-wide registry served on /metrics.
+var Default = NewRegistry()
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WritePrometheus renders all metrics in the Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	cs := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the counter identified by labelValues.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must be >= 0) to the counter identified by labelValues.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := labelKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value for labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := labelKey(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, braced(key), formatFloat(c.values[key]))
+	}
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels. A gauge
+// without labels starts at 0 so it is exported before its first change.
+type GaugeVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		g.values[""] = 0
+	}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the gauge identified by labelValues to v.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := labelKey(g.labels, labelValues)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to the gauge identified by labelValues.
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	key := labelKey(g.labels, labelValues)
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Value returns the current value for labelValues.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	key := labelKey(g.labels, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, braced(key), formatFloat(g.values[key]))
+	}
+}
+
+// HistogramVec tracks value distributions partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram. buckets must be sorted ascending;
+// nil means DefaultDurationBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultDurationBuckets
+	}
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v for labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations for labelValues.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := labelKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braced(joinLabels(key, `le="`+formatFloat(le)+`"`)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, braced(joinLabels(key, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braced(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braced(key), s.count)
+	}
+}
+
+// labelKey renders label pairs as `a="x",b="y"`, which doubles as the map key.
+func labelKey(names, values []string) string {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(names), len(values)))
+	}
+	var b strings.Builder
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(v)
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
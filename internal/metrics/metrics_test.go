@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "A test counter.", "op")
+	c.Inc("read")
+	c.Add(2, "read")
+	c.Inc(`we"ird`)
+
+	assert.Equal(t, 3.0, c.Value("read"))
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	assert.Equal(t, `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{op="read"} 3
+test_total{op="we\"ird"} 1
+`, buf.String())
+}
+
+func TestGaugeVec(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_depth", "A test gauge.")
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	assert.Equal(t, "# HELP test_depth A test gauge.\n# TYPE test_depth gauge\ntest_depth 0\n", buf.String())
+
+	g.Add(3)
+	g.Add(-1)
+	assert.Equal(t, 2.0, g.Value())
+	g.Set(7)
+	assert.Equal(t, 7.0, g.Value())
+
+	labeled := r.NewGaugeVec("test_labeled", "A labeled gauge.", "pool")
+	labeled.Set(1, "python")
+	buf.Reset()
+	r.WritePrometheus(&buf)
+	assert.Contains(t, buf.String(), `test_labeled{pool="python"} 1`)
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("test_seconds", "A test histogram.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "get")
+	h.Observe(0.1, "get")
+	h.Observe(0.5, "get")
+	h.Observe(3, "get")
+
+	assert.Equal(t, uint64(4), h.Count("get"))
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	assert.Equal(t, `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="get",le="0.1"} 2
+test_seconds_bucket{op="get",le="1"} 3
+test_seconds_bucket{op="get",le="+Inf"} 4
+test_seconds_sum{op="get"} 3.65
+test_seconds_count{op="get"} 4
+`, buf.String())
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "x")
+	assert.Panics(t, func() { r.NewCounterVec("dup_total", "x") })
+}
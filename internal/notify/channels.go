@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ChannelFunc adapts a function to a Channel.
+type ChannelFunc func(ctx context.Context, msg Message) error
+
+// Send calls f.
+func (f ChannelFunc) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Slack returns a channel that posts messages to a Slack incoming webhook.
+func Slack(webhookURL string, timeout time.Duration) Channel {
+	client := &http.Client{Timeout: timeout}
+	return ChannelFunc(func(ctx context.Context, msg Message) error {
+		body, err := json.Marshal(map[string]string{"text": "*" + msg.Subject + "*\n" + msg.Text})
+		if err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("slack: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	})
+}
+
+// Email returns a channel that mails messages through the SMTP server at
+// addr (host:port). Port 465 uses implicit TLS; otherwise STARTTLS is used
+// when the server offers it. Without a username no authentication is done.
+func Email(addr, username, password, from string, to []string) Channel {
+	host, port, _ := net.SplitHostPort(addr)
+	return ChannelFunc(func(ctx context.Context, msg Message) error {
+		if err := sendMail(ctx, addr, host, port == "465", username, password, from, to, msg); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		return nil
+	})
+}
+
+func sendMail(ctx context.Context, addr, host string, implicitTLS bool, username, password, from string, to []string, msg Message) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if implicitTLS {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && !implicitTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if username != "" {
+		if err := c.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatMail(from, to, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// formatMail returns msg as a plain text mail with CRLF line endings.
+func formatMail(from string, to []string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	text := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return b.Bytes()
+}
@@ -0,0 +1,277 @@
+// Package notify sends selected daemon events (session OOM kills, reaper
+// cleanups, create failure spikes, host health) to Slack or email, with
+// templated messages and per-rule rate limits.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/health"
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+// Event types, as listed in config.NotificationEvents.
+const (
+	EventSessionOOM         = "session.oom"
+	EventOrphansCleaned     = "reaper.orphans_cleaned"
+	EventCreateFailureSpike = "create.failure_spike"
+	EventHostDegraded       = health.EventDegraded
+	EventHostRecovered      = health.EventRecovered
+)
+
+// sendTimeout bounds the delivery of one message to one channel.
+const sendTimeout = 30 * time.Second
+
+var (
+	sent = metrics.Default.NewCounterVec("sandkasten_notifications_total",
+		"Notification messages sent, by channel and result (ok | error).", "channel", "result")
+	dropped = metrics.Default.NewCounterVec("sandkasten_notifications_dropped_total",
+		"Events not sent because a rule reached max_per_hour, by event.", "event")
+)
+
+const (
+	defaultSubject = `[sandkasten] {{.Summary}}`
+	defaultBody    = `{{.Summary}}
+
+Event: {{.Type}}
+Host: {{.Host}}
+{{if .SessionID}}Session: {{.SessionID}}
+{{end}}{{range $k, $v := .Fields}}{{$k}}: {{$v}}
+{{end}}Time: {{.At.Format "2006-01-02T15:04:05Z07:00"}}
+`
+)
+
+// Event is something the daemon reports. It is the data of the subject and
+// body templates.
+type Event struct {
+	Type      string            // one of the Event* constants
+	Host      string            // set by Notify
+	SessionID string            // "" for events not about one session
+	Summary   string            // one line, e.g. "session abc was OOM killed"
+	Fields    map[string]string // details, listed by the default body
+	At        time.Time         // set by Notify if zero
+}
+
+// Message is a rendered event.
+type Message struct {
+	Subject string
+	Text    string
+}
+
+// Channel delivers messages.
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type rule struct {
+	events   []string
+	channels []string
+	subject  *template.Template
+	body     *template.Template
+	max      int
+
+	mu   sync.Mutex
+	sent []time.Time // within the last hour, oldest first
+}
+
+// allow reports whether one more event may be sent at now under the rule's
+// max_per_hour, and records it if so.
+func (r *rule) allow(now time.Time) bool {
+	if r.max <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cutoff := now.Add(-time.Hour)
+	i := 0
+	for i < len(r.sent) && !r.sent[i].After(cutoff) {
+		i++
+	}
+	r.sent = r.sent[i:]
+	if len(r.sent) >= r.max {
+		return false
+	}
+	r.sent = append(r.sent, now)
+	return true
+}
+
+// Notifier sends events to the channels of the rules that select them. A
+// nil Notifier drops every event.
+type Notifier struct {
+	logger   *slog.Logger
+	host     string
+	channels map[string]Channel
+	rules    []*rule
+	wg       sync.WaitGroup
+}
+
+// New builds the channels and rules of cfg, which must have passed
+// config.ValidateNotifications. It returns nil if no rule is configured.
+func New(cfg config.NotificationsConfig, logger *slog.Logger) (*Notifier, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+	host, _ := os.Hostname()
+	n := &Notifier{logger: logger, host: host, channels: make(map[string]Channel, len(cfg.Channels))}
+	for _, ch := range cfg.Channels {
+		switch ch.Type {
+		case "slack":
+			n.channels[ch.Name] = Slack(ch.WebhookURL, sendTimeout)
+		case "email":
+			n.channels[ch.Name] = Email(ch.SMTPAddr, ch.Username, ch.Password, ch.From, ch.To)
+		default:
+			return nil, fmt.Errorf("notifications channel %q: unknown type %q", ch.Name, ch.Type)
+		}
+	}
+	for i, rc := range cfg.Rules {
+		r := &rule{events: rc.Events, channels: rc.Channels, max: rc.MaxPerHour}
+		var err error
+		if r.subject, err = parseTemplate(fmt.Sprintf("rules[%d].subject", i), rc.Subject, defaultSubject); err != nil {
+			return nil, err
+		}
+		if r.body, err = parseTemplate(fmt.Sprintf("rules[%d].template", i), rc.Template, defaultBody); err != nil {
+			return nil, err
+		}
+		n.rules = append(n.rules, r)
+	}
+	return n, nil
+}
+
+func parseTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notifications.%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Notify sends ev to the channels of every rule that selects its type and
+// has not reached its max_per_hour. Delivery runs in the background;
+// failures are logged.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+	if ev.Host == "" {
+		ev.Host = n.host
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	for _, r := range n.rules {
+		if !slices.Contains(r.events, ev.Type) {
+			continue
+		}
+		if !r.allow(time.Now()) {
+			dropped.Inc(ev.Type)
+			n.logger.Debug("notification rate limited", "event", ev.Type)
+			continue
+		}
+		msg, err := render(r, ev)
+		if err != nil {
+			n.logger.Warn("notification template failed", "event", ev.Type, "error", err)
+			continue
+		}
+		for _, name := range r.channels {
+			ch := n.channels[name]
+			if ch == nil {
+				continue
+			}
+			n.wg.Add(1)
+			go func() {
+				defer n.wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+				defer cancel()
+				if err := ch.Send(ctx, msg); err != nil {
+					sent.Inc(name, "error")
+					n.logger.Warn("notification failed", "channel", name, "event", ev.Type, "error", err)
+					return
+				}
+				sent.Inc(name, "ok")
+			}()
+		}
+	}
+}
+
+func render(r *rule, ev Event) (Message, error) {
+	var subject, body strings.Builder
+	if err := r.subject.Execute(&subject, ev); err != nil {
+		return Message{}, err
+	}
+	if err := r.body.Execute(&body, ev); err != nil {
+		return Message{}, err
+	}
+	// Mail headers and Slack titles are one line.
+	return Message{Subject: strings.Join(strings.Fields(subject.String()), " "), Text: body.String()}, nil
+}
+
+// Wait blocks until every message sent so far was delivered or failed.
+func (n *Notifier) Wait() {
+	if n != nil {
+		n.wg.Wait()
+	}
+}
+
+// HealthNotifier forwards host health events to n.
+func (n *Notifier) HealthNotifier() health.Notifier {
+	return func(_ context.Context, ev health.Event) error {
+		summary := fmt.Sprintf("host %s degraded: %s", ev.Host, ev.Check)
+		if ev.Event == health.EventRecovered {
+			summary = fmt.Sprintf("host %s recovered: %s", ev.Host, ev.Check)
+		}
+		fields := map[string]string{"check": ev.Check}
+		if ev.Detail != "" {
+			fields["detail"] = ev.Detail
+		}
+		n.Notify(Event{Type: ev.Event, Host: ev.Host, Summary: summary, Fields: fields, At: ev.At})
+		return nil
+	}
+}
+
+// Spike detects bursts: it reports once per window when threshold events
+// happened within the last window.
+type Spike struct {
+	threshold int
+	window    time.Duration
+
+	mu      sync.Mutex
+	times   []time.Time // within the last window, oldest first
+	alerted time.Time
+}
+
+// NewSpike returns a detector of threshold events within window.
+func NewSpike(threshold int, window time.Duration) *Spike {
+	return &Spike{threshold: threshold, window: window}
+}
+
+// Add records an event at now. It returns the number of events within the
+// window and whether this one starts a spike, which is true at most once
+// per window.
+func (s *Spike) Add(now time.Time) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := now.Add(-s.window)
+	i := 0
+	for i < len(s.times) && !s.times[i].After(cutoff) {
+		i++
+	}
+	s.times = append(s.times[i:], now)
+	count := len(s.times)
+	if count < s.threshold || (!s.alerted.IsZero() && now.Sub(s.alerted) < s.window) {
+		return count, false
+	}
+	s.alerted = now
+	return count, true
+}
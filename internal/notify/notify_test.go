@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestNewDisabled(t *testing.T) {
+	n, err := New(config.NotificationsConfig{Channels: []config.NotificationChannel{{Name: "ops", Type: "slack", WebhookURL: "https://hooks.example.com/x"}}}, discard())
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	n.Notify(Event{Type: EventSessionOOM}) // nil-safe
+	n.Wait()
+}
+
+func TestNew_BadTemplate(t *testing.T) {
+	_, err := New(config.NotificationsConfig{
+		Channels: []config.NotificationChannel{{Name: "ops", Type: "slack", WebhookURL: "https://hooks.example.com/x"}},
+		Rules:    []config.NotificationRule{{Events: []string{EventSessionOOM}, Channels: []string{"ops"}, Template: "{{.Summary"}},
+	}, discard())
+	assert.ErrorContains(t, err, "rules[0].template")
+}
+
+func TestSlack(t *testing.T) {
+	var got map[string]string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+		io.WriteString(w, "invalid_payload")
+	}))
+	defer srv.Close()
+
+	ch := Slack(srv.URL, time.Second)
+	require.NoError(t, ch.Send(context.Background(), Message{Subject: "OOM", Text: "session s1"}))
+	assert.Equal(t, "*OOM*\nsession s1", got["text"])
+
+	status = http.StatusBadRequest
+	assert.ErrorContains(t, ch.Send(context.Background(), Message{}), "status 400: invalid_payload")
+}
+
+// fakeSMTP accepts one mail per connection and records it.
+type fakeSMTP struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	rcpts []string
+	data  string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTP{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, line)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	srv := newFakeSMTP(t)
+	ch := Email(srv.ln.Addr().String(), "", "", "sandkasten@example.com", []string{"ops@example.com", "dev@example.com"})
+	require.NoError(t, ch.Send(context.Background(), Message{Subject: "Host degraded", Text: "disk_space\nfailing"}))
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, []string{"RCPT TO:<ops@example.com>", "RCPT TO:<dev@example.com>"}, srv.rcpts)
+	assert.Contains(t, srv.data, "Subject: Host degraded\n")
+	assert.Contains(t, srv.data, "To: ops@example.com, dev@example.com\n")
+	assert.True(t, strings.HasSuffix(srv.data, "\n\ndisk_space\nfailing\n"), srv.data)
+}
+
+func TestEmail_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	err = Email(addr, "", "", "a@example.com", []string{"b@example.com"}).Send(context.Background(), Message{})
+	assert.ErrorContains(t, err, "email:")
+}
+
+// testNotifier returns a notifier of rules sending to a recording channel.
+func testNotifier(t *testing.T, rules ...config.NotificationRule) (*Notifier, func() []Message) {
+	n, err := New(config.NotificationsConfig{Rules: rules}, discard())
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var msgs []Message
+	n.channels["rec"] = ChannelFunc(func(_ context.Context, msg Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, msg)
+		return nil
+	})
+	return n, func() []Message {
+		n.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Message(nil), msgs...)
+	}
+}
+
+func TestNotify_Templates(t *testing.T) {
+	n, msgs := testNotifier(t,
+		config.NotificationRule{Events: []string{EventSessionOOM}, Channels: []string{"rec"}},
+		config.NotificationRule{
+			Events:   []string{EventOrphansCleaned},
+			Channels: []string{"rec"},
+			Subject:  "cleanup on {{.Host}}",
+			Template: "{{.Fields.sessions}} sessions{{.Fields.missing}}",
+		},
+	)
+	at := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	n.Notify(Event{Type: EventSessionOOM, Host: "h1", SessionID: "s1", Summary: "session s1 was OOM killed", Fields: map[string]string{"oom_kills": "2", "image": "python"}, At: at})
+	n.Notify(Event{Type: EventHostDegraded, Summary: "not selected"})
+
+	got := msgs()
+	require.Len(t, got, 1)
+	assert.Equal(t, "[sandkasten] session s1 was OOM killed", got[0].Subject)
+	assert.Equal(t, "session s1 was OOM killed\n\nEvent: session.oom\nHost: h1\nSession: s1\nimage: python\noom_kills: 2\nTime: 2026-10-16T09:00:00Z\n", got[0].Text)
+
+	n.Notify(Event{Type: EventOrphansCleaned, Host: "h1\nx", Fields: map[string]string{"sessions": "3"}})
+	got = msgs()
+	require.Len(t, got, 2)
+	assert.Equal(t, "cleanup on h1 x", got[1].Subject, "subjects are one line")
+	assert.Equal(t, "3 sessions", got[1].Text, "missing fields are empty")
+}
+
+func TestNotify_RateLimit(t *testing.T) {
+	n, msgs := testNotifier(t,
+		config.NotificationRule{Events: []string{EventCreateFailureSpike}, Channels: []string{"rec"}, MaxPerHour: 2},
+	)
+	before := dropped.Value(EventCreateFailureSpike)
+	for range 4 {
+		n.Notify(Event{Type: EventCreateFailureSpike, Summary: "spike"})
+	}
+	assert.Len(t, msgs(), 2)
+	assert.Equal(t, before+2, dropped.Value(EventCreateFailureSpike))
+
+	// Pretend the first two went out more than an hour ago.
+	r := n.rules[0]
+	r.sent = []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-61 * time.Minute)}
+	n.Notify(Event{Type: EventCreateFailureSpike, Summary: "spike"})
+	assert.Len(t, msgs(), 3)
+}
+
+func TestHealthNotifier(t *testing.T) {
+	n, msgs := testNotifier(t,
+		config.NotificationRule{Events: []string{EventHostDegraded, EventHostRecovered}, Channels: []string{"rec"}, Subject: "{{.Summary}}", Template: "{{.Fields.detail}}"},
+	)
+	notify := n.HealthNotifier()
+	require.NoError(t, notify(context.Background(), health.Event{Event: health.EventDegraded, Host: "h1", Check: "disk_space", Detail: "12 MB free"}))
+	got := msgs()
+	require.Len(t, got, 1)
+	assert.Equal(t, Message{Subject: "host h1 degraded: disk_space", Text: "12 MB free"}, got[0])
+
+	require.NoError(t, notify(context.Background(), health.Event{Event: health.EventRecovered, Host: "h1", Check: "disk_space"}))
+	got = msgs()
+	require.Len(t, got, 2)
+	assert.Equal(t, "host h1 recovered: disk_space", got[1].Subject)
+}
+
+func TestSpike(t *testing.T) {
+	s := NewSpike(3, time.Minute)
+	start := time.Now()
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	for i, want := range []bool{false, false, true, false} {
+		count, spiking := s.Add(at(i))
+		assert.Equal(t, i+1, count)
+		assert.Equal(t, want, spiking, "failure %d", i+1)
+	}
+
+	count, spiking := s.Add(at(70))
+	assert.Equal(t, 1, count, "older failures left the window")
+	assert.False(t, spiking)
+	s.Add(at(71))
+	_, spiking = s.Add(at(72))
+	assert.True(t, spiking, "a new spike one window after the last alert")
+}
+
+func TestFormatMail(t *testing.T) {
+	mail := string(formatMail("a@example.com", []string{"b@example.com"}, Message{Subject: "Größe", Text: "one\ntwo"}))
+	assert.Contains(t, mail, "Subject: =?utf-8?q?Gr=C3=B6=C3=9Fe?=\r\n")
+	assert.True(t, strings.HasSuffix(mail, "\r\n\r\none\r\ntwo"))
+}
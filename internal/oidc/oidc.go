@@ -0,0 +1,441 @@
+// Package oidc implements the OpenID Connect authorization code flow (with
+// PKCE) used for dashboard single sign-on. Only what sandkasten needs is
+// supported: discovery, the token endpoint and RS256/ES256 ID tokens.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+// clockSkew is the leeway allowed when checking token expiry.
+const clockSkew = time.Minute
+
+// ErrInvalidToken is returned when an ID token fails verification.
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Claims is the verified identity from an ID token.
+type Claims struct {
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// Provider talks to one OIDC issuer. Discovery metadata and signing keys are
+// fetched on first use and cached; keys are refetched when a token names an
+// unknown key ID.
+type Provider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]crypto.PublicKey
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New returns a provider for cfg. client nil means a client with a 10s timeout.
+func New(cfg config.OIDCConfig, client *http.Client) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc: issuer, client_id and redirect_url are required")
+	}
+	if _, err := url.Parse(cfg.RedirectURL); err != nil {
+		return nil, fmt.Errorf("oidc: redirect_url: %w", err)
+	}
+	if len(cfg.Roles) == 0 {
+		return nil, fmt.Errorf("oidc: roles must map at least one group to a role")
+	}
+	for group, role := range cfg.Roles {
+		switch role {
+		case "viewer", "operator", "admin":
+		default:
+			return nil, fmt.Errorf("oidc: group %q: role must be viewer, operator or admin", group)
+		}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}, nil
+}
+
+// RandomString returns a URL-safe random string for state, nonce and PKCE
+// verifier values.
+func RandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// AuthCodeURL returns the URL that starts a login at the issuer.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token it yields.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (*Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("oidc: decode token response: %w", err)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("oidc: token response has no id_token")
+	}
+	return p.Verify(ctx, tok.IDToken, nonce)
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+	var std struct {
+		Iss   string          `json:"iss"`
+		Sub   string          `json:"sub"`
+		Aud   json.RawMessage `json:"aud"`
+		Exp   int64           `json:"exp"`
+		Nonce string          `json:"nonce"`
+		Email string          `json:"email"`
+		Name  string          `json:"name"`
+	}
+	if err := decodeSegment(parts[1], &std); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+	if std.Iss != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, std.Iss)
+	}
+	if !stringOrList(std.Aud, p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: audience", ErrInvalidToken)
+	}
+	if time.Now().Add(-clockSkew).Unix() >= std.Exp {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if std.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if std.Sub == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	claims := &Claims{Subject: std.Sub, Email: std.Email, Name: std.Name}
+	if g, ok := raw[p.groupsClaim()]; ok {
+		claims.Groups = stringList(g)
+	}
+	return claims, nil
+}
+
+// Role returns the most privileged dashboard role mapped from groups, or ""
+// if none of them has one.
+func (p *Provider) Role(groups []string) string {
+	rank := map[string]int{"viewer": 1, "operator": 2, "admin": 3}
+	best := ""
+	for _, g := range groups {
+		if role := p.cfg.Roles[g]; rank[role] > rank[best] {
+			best = role
+		}
+	}
+	return best
+}
+
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	if len(p.cfg.Scopes) == 0 {
+		return append(scopes, "profile", "email", "groups")
+	}
+	for _, s := range p.cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+func (p *Provider) groupsClaim() string {
+	if p.cfg.GroupsClaim != "" {
+		return p.cfg.GroupsClaim
+	}
+	return "groups"
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery: issuer %q does not match configured %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery: missing endpoints")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key returns the signing key kid, refetching the key set once if it is unknown.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookupKeyLocked(kid); ok {
+		return k, nil
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc: fetch keys: %w", err)
+	}
+	p.keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if pub, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = pub
+		}
+	}
+	if k, ok := p.lookupKeyLocked(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+// lookupKeyLocked finds kid; an empty kid matches a key set with one key.
+func (p *Provider) lookupKeyLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("key %q is not a signing key", k.Kid)
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("RS256 token signed with a non-RSA key")
+		}
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return fmt.Errorf("bad ES256 signature")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// stringOrList reports whether raw (a JSON string or string array) contains want.
+func stringOrList(raw json.RawMessage, want string) bool {
+	for _, s := range stringList(raw) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+func stringList(raw json.RawMessage) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil && s != "" {
+		return []string{s}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIssuer is a minimal OIDC provider that hands out the configured claims
+// as a signed ID token for any code.
+type fakeIssuer struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+	form   url.Values
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.srv.URL,
+			"authorization_endpoint": f.srv.URL + "/authorize",
+			"token_endpoint":         f.srv.URL + "/token",
+			"jwks_uri":               f.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.form = r.PostForm
+		json.NewEncoder(w).Encode(map[string]string{"id_token": f.sign(t, f.claims)})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeIssuer) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (f *fakeIssuer) provider(t *testing.T) *Provider {
+	t.Helper()
+	p, err := New(config.OIDCConfig{
+		Issuer:      f.srv.URL,
+		ClientID:    "sandkasten",
+		RedirectURL: "https://sandkasten.example/dashboard/oidc/callback",
+		Roles:       map[string]string{"devs": "operator", "ops": "admin", "all": "viewer"},
+	}, f.srv.Client())
+	require.NoError(t, err)
+	return p
+}
+
+func (f *fakeIssuer) validClaims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":    f.srv.URL,
+		"sub":    "user-1",
+		"aud":    "sandkasten",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  nonce,
+		"email":  "ada@example.com",
+		"groups": []string{"all", "devs"},
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	base := config.OIDCConfig{
+		Issuer:      "https://idp.example",
+		ClientID:    "sandkasten",
+		RedirectURL: "https://sandkasten.example/dashboard/oidc/callback",
+		Roles:       map[string]string{"devs": "operator"},
+	}
+	_, err := New(base, nil)
+	assert.NoError(t, err)
+
+	missing := base
+	missing.ClientID = ""
+	_, err = New(missing, nil)
+	assert.Error(t, err)
+
+	noRoles := base
+	noRoles.Roles = nil
+	_, err = New(noRoles, nil)
+	assert.Error(t, err)
+
+	badRole := base
+	badRole.Roles = map[string]string{"devs": "root"}
+	_, err = New(badRole, nil)
+	assert.Error(t, err)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	u, err := p.AuthCodeURL(context.Background(), "state1", "nonce1", "verifier1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, f.srv.URL+"/authorize?"))
+
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+	q := parsed.Query()
+	challenge := sha256.Sum256([]byte("verifier1"))
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "state1", q.Get("state"))
+	assert.Equal(t, "nonce1", q.Get("nonce"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(challenge[:]), q.Get("code_challenge"))
+	assert.Contains(t, q.Get("scope"), "openid")
+}
+
+func TestExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+	f.claims = f.validClaims("n1")
+
+	claims, err := p.Exchange(context.Background(), "code1", "n1", "v1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "ada@example.com", claims.Email)
+	assert.Equal(t, []string{"all", "devs"}, claims.Groups)
+	assert.Equal(t, "code1", f.form.Get("code"))
+	assert.Equal(t, "v1", f.form.Get("code_verifier"))
+}
+
+func TestExchangeRejectsBadTokens(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	tests := []struct {
+		name   string
+		mutate func(c map[string]any)
+	}{
+		{"nonce", func(c map[string]any) { c["nonce"] = "other" }},
+		{"audience", func(c map[string]any) { c["aud"] = []string{"someone-else"} }},
+		{"issuer", func(c map[string]any) { c["iss"] = "https://evil.example" }},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"subject", func(c map[string]any) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.claims = f.validClaims("n1")
+			tt.mutate(f.claims)
+			_, err := p.Exchange(context.Background(), "code1", "n1", "v1")
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestVerifyRejectsForgedSignature(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	token := f.sign(t, f.validClaims("n1"))
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(map[string]any{
+		"iss": f.srv.URL, "sub": "admin", "aud": "sandkasten",
+		"exp": time.Now().Add(time.Hour).Unix(), "nonce": "n1",
+	})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+
+	_, err := p.Verify(context.Background(), strings.Join(parts, "."), "n1")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRole(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := f.provider(t)
+
+	assert.Equal(t, "", p.Role(nil))
+	assert.Equal(t, "", p.Role([]string{"unknown"}))
+	assert.Equal(t, "viewer", p.Role([]string{"all"}))
+	assert.Equal(t, "operator", p.Role([]string{"all", "devs"}))
+	assert.Equal(t, "admin", p.Role([]string{"ops", "devs"}))
+}
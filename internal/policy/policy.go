@@ -0,0 +1,166 @@
+// Package policy evaluates exec commands against operator-defined rules before
+// they are sent to the sandbox runner.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+// networkCommands are rejected when BlockNetworkCommands is set and the
+// sandbox has no network, so agents get a clear error instead of a hang.
+var networkCommands = []string{
+	"curl", "wget", "nc", "ncat", "netcat", "ssh", "scp", "sftp",
+	"rsync", "telnet", "ftp", "ping", "dig", "nslookup",
+}
+
+// segmentSeparators splits a command into list/pipeline segments.
+var segmentSeparators = regexp.MustCompile(`\|\||&&|[;|&\n]`)
+
+// Violation describes why a command was rejected.
+type Violation struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Reason)
+}
+
+type patternRule struct {
+	source string
+	re     *regexp.Regexp
+}
+
+// Engine holds compiled rules. A nil *Engine allows everything.
+type Engine struct {
+	deny         []patternRule
+	allow        []patternRule
+	prefixes     []string
+	blockNetwork bool
+}
+
+// New compiles the policy. It returns nil when the policy is disabled.
+func New(cfg config.PolicyConfig, networkMode string) (*Engine, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	e := &Engine{
+		blockNetwork: cfg.BlockNetworkCommands && (networkMode == "" || networkMode == "none"),
+	}
+	for _, p := range cfg.DenyPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("policy deny_patterns %q: %w", p, err)
+		}
+		e.deny = append(e.deny, patternRule{source: p, re: re})
+	}
+	for _, p := range cfg.AllowPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("policy allow_patterns %q: %w", p, err)
+		}
+		e.allow = append(e.allow, patternRule{source: p, re: re})
+	}
+	for _, p := range cfg.DenyPrefixes {
+		if p = strings.TrimSpace(p); p != "" {
+			e.prefixes = append(e.prefixes, p)
+		}
+	}
+	return e, nil
+}
+
+// Check returns a Violation if cmd is not permitted, or nil.
+func (e *Engine) Check(cmd string) *Violation {
+	if e == nil {
+		return nil
+	}
+
+	for _, r := range e.deny {
+		if r.re.MatchString(cmd) {
+			return &Violation{Rule: "deny_pattern", Reason: fmt.Sprintf("command matches %q", r.source)}
+		}
+	}
+
+	segments := splitSegments(cmd)
+	for _, seg := range segments {
+		for _, p := range e.prefixes {
+			if hasWordPrefix(seg, p) {
+				return &Violation{Rule: "deny_prefix", Reason: fmt.Sprintf("command starts with %q", p)}
+			}
+		}
+		if e.blockNetwork {
+			if name := commandName(seg); isNetworkCommand(name) {
+				return &Violation{Rule: "network_disabled", Reason: fmt.Sprintf("%s requires network access (network_mode is none)", name)}
+			}
+		}
+	}
+
+	if len(e.allow) > 0 {
+		for _, r := range e.allow {
+			if r.re.MatchString(cmd) {
+				return nil
+			}
+		}
+		return &Violation{Rule: "allow_pattern", Reason: "command does not match any allowed pattern"}
+	}
+	return nil
+}
+
+func splitSegments(cmd string) []string {
+	parts := segmentSeparators.Split(cmd, -1)
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// hasWordPrefix reports whether seg starts with prefix followed by a word
+// boundary, so "rm" does not match "rmdir".
+func hasWordPrefix(seg, prefix string) bool {
+	if !strings.HasPrefix(seg, prefix) {
+		return false
+	}
+	if len(seg) == len(prefix) {
+		return true
+	}
+	next := seg[len(prefix)]
+	return next == ' ' || next == '\t' || !isWordByte(prefix[len(prefix)-1])
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '-' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// commandName returns the program name of a segment, skipping env assignments
+// and common wrappers like sudo/env/exec.
+func commandName(seg string) string {
+	for _, f := range strings.Fields(seg) {
+		if strings.Contains(f, "=") && !strings.HasPrefix(f, "=") {
+			continue
+		}
+		switch f {
+		case "sudo", "env", "exec", "command", "nohup", "time":
+			continue
+		}
+		return path.Base(f)
+	}
+	return ""
+}
+
+func isNetworkCommand(name string) bool {
+	for _, c := range networkCommands {
+		if name == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDisabled(t *testing.T) {
+	e, err := New(config.PolicyConfig{Enabled: false, DenyPatterns: []string{"("}}, "none")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+	assert.Nil(t, e.Check("rm -rf /"))
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	_, err := New(config.PolicyConfig{Enabled: true, DenyPatterns: []string{"("}}, "none")
+	assert.Error(t, err)
+}
+
+func TestCheckDenyPattern(t *testing.T) {
+	e, err := New(config.PolicyConfig{
+		Enabled:      true,
+		DenyPatterns: []string{`rm\s+-rf\s+/(\s|$)`},
+	}, "full")
+	require.NoError(t, err)
+
+	v := e.Check("cd /tmp && rm -rf /")
+	require.NotNil(t, v)
+	assert.Equal(t, "deny_pattern", v.Rule)
+	assert.Nil(t, e.Check("rm -rf /workspace/build"))
+}
+
+func TestCheckDenyPrefix(t *testing.T) {
+	e, err := New(config.PolicyConfig{
+		Enabled:      true,
+		DenyPrefixes: []string{"shutdown", "rm"},
+	}, "full")
+	require.NoError(t, err)
+
+	assert.NotNil(t, e.Check("shutdown -h now"))
+	assert.NotNil(t, e.Check("echo ok; rm file"))
+	assert.NotNil(t, e.Check("ls | rm"))
+	assert.Nil(t, e.Check("rmdir build"))
+	assert.Nil(t, e.Check("echo shutdown"))
+}
+
+func TestCheckNetworkCommands(t *testing.T) {
+	cfg := config.PolicyConfig{Enabled: true, BlockNetworkCommands: true}
+
+	e, err := New(cfg, "none")
+	require.NoError(t, err)
+	v := e.Check("FOO=1 /usr/bin/curl https://example.com")
+	require.NotNil(t, v)
+	assert.Equal(t, "network_disabled", v.Rule)
+	assert.NotNil(t, e.Check("sudo wget x"))
+	assert.Nil(t, e.Check("echo curl"))
+
+	e, err = New(cfg, "bridge")
+	require.NoError(t, err)
+	assert.Nil(t, e.Check("curl https://example.com"))
+}
+
+func TestCheckAllowPatterns(t *testing.T) {
+	e, err := New(config.PolicyConfig{
+		Enabled:       true,
+		AllowPatterns: []string{`^python3? `, `^pip install `},
+	}, "full")
+	require.NoError(t, err)
+
+	assert.Nil(t, e.Check("python3 main.py"))
+	v := e.Check("bash -c 'id'")
+	require.NotNil(t, v)
+	assert.Equal(t, "allow_pattern", v.Rule)
+}
@@ -22,4 +22,33 @@ type Pool interface {
 
 	// RefillAll pre-warms the pool for all configured images (daemon startup).
 	RefillAll(ctx context.Context)
+
+	// Reconcile adopts healthy pool_idle sessions left by a previous run and
+	// destroys broken or surplus ones (daemon startup, before RefillAll).
+	Reconcile(ctx context.Context) (ReconcileReport, error)
+
+	// Recycle destroys idle sessions of image and refills them, e.g. after the
+	// image was updated in place. Returns the number of sessions discarded.
+	Recycle(ctx context.Context, image string) int
+
+	// Flush destroys the idle sessions of image ("" = every image) without
+	// refilling them and returns how many it discarded.
+	Flush(ctx context.Context, image string) int
+
+	// Status returns the targets, idle sessions and refill state of every
+	// pool key.
+	Status(ctx context.Context) []KeyStatus
+
+	// Resize changes the number of idle sessions kept for image and returns
+	// the previous target. Surplus idle sessions are destroyed; call Refill to
+	// grow the pool.
+	Resize(ctx context.Context, image string, size int) int
+
+	// ReclaimIdle reclaims the memory of sessions that have been idle for
+	// longer than PoolConfig.ReclaimAfter and returns how many it reclaimed.
+	ReclaimIdle(ctx context.Context) int
+
+	// Drain stops new refills and waits for sandboxes already being created to
+	// be recorded in the store, so none are left half-registered at shutdown.
+	Drain(ctx context.Context) error
 }
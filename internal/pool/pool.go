@@ -3,12 +3,16 @@ package pool
 import (
 	"context"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/failpoint"
+	"github.com/p-arndt/sandkasten/internal/metrics"
 	storemod "github.com/p-arndt/sandkasten/internal/store"
 )
 
@@ -19,6 +23,23 @@ type PoolConfig struct {
 	Logger     *slog.Logger
 	SessionTTL int
 	PoolExpiry time.Duration // far future for pool_idle sessions
+
+	// IsRunning and DestroyFunc are used by Reconcile to check and discard
+	// sessions left over from a previous run. A nil IsRunning adopts unchecked.
+	// DestroyFunc also removes sandboxes a refill created but could not record.
+	IsRunning   func(ctx context.Context, sessionID string) (bool, error)
+	DestroyFunc func(ctx context.Context, sessionID string) error
+
+	// ReclaimFunc reclaims the memory of a session idle for ReclaimAfter
+	// (see ReclaimIdle). Nil or a zero ReclaimAfter disables reclaim.
+	ReclaimFunc  func(ctx context.Context, sessionID string) (int64, error)
+	ReclaimAfter time.Duration
+
+	// HostCheck returns an error while the host cannot take more sandboxes,
+	// e.g. under memory pressure. Refills wait for it to pass, re-checking
+	// every HostCheckRetry (0 = 2s). Nil never waits.
+	HostCheck      func() error
+	HostCheckRetry time.Duration
 }
 
 type Store interface {
@@ -26,6 +47,7 @@ type Store interface {
 	GetSession(id string) (*storemod.Session, error)
 	UpdateSessionStatus(id string, status string) error
 	UpdateSessionActivity(id string, cwd string, expiresAt time.Time) error
+	ListPoolIdleSessions() ([]*storemod.Session, error)
 }
 
 // CreateFunc creates a new sandbox and returns (sessionID, initPID, cgroupPath, error).
@@ -33,17 +55,47 @@ type Store interface {
 type CreateFunc func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error)
 
 type CreateResult struct {
-	InitPID    int
-	CgroupPath string
+	InitPID     int
+	CgroupPath  string
+	ImageDigest string
 }
 
 type poolImpl struct {
 	cfg    *config.Config
 	config PoolConfig
 
-	mu     sync.Mutex
-	idle   map[string][]string // key(image|workspace) -> []sessionID (idle sessions)
-	target map[string]int      // key(image|"") -> static target count
+	mu        sync.Mutex
+	idle      map[string][]string  // key(image|workspace) -> []sessionID (idle sessions)
+	idleSince map[string]time.Time // idle sessions whose memory was not reclaimed yet
+	pooledAt  map[string]time.Time // idle session -> when its sandbox was created
+	target    map[string]int       // key(image|"") -> static target count, changed by Resize
+	refilling map[string]int       // key -> in-flight Refill calls
+	lastError map[string]string    // key -> error of the last failed refill create
+	closing   bool                 // set by Drain; no new sandboxes are created
+	refills   sync.WaitGroup       // in-flight Refill calls
+}
+
+var (
+	reclaimedSessions = metrics.Default.NewCounterVec("sandkasten_pool_reclaimed_sessions_total",
+		"Idle pooled sessions whose memory was reclaimed.")
+	reclaimedBytes = metrics.Default.NewCounterVec("sandkasten_pool_reclaimed_bytes_total",
+		"Memory reclaimed from idle pooled sessions.")
+	refillsPaused = metrics.Default.NewCounterVec("sandkasten_pool_refills_paused_total",
+		"Pool refills that waited because the host could not take more sandboxes.")
+)
+
+type highPriorityKey struct{}
+
+// WithHighPriority marks an acquire as high priority: it may take the idle
+// sessions held back for such callers by admission.pool_reserve_high.
+func WithHighPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, highPriorityKey{}, true)
+}
+
+// HighPriority reports whether ctx was marked WithHighPriority.
+func HighPriority(ctx context.Context) bool {
+	high, _ := ctx.Value(highPriorityKey{}).(bool)
+	return high
 }
 
 func poolKey(image, workspaceID string) string {
@@ -69,18 +121,28 @@ func New(cfg *config.Config, poolConfig PoolConfig) *poolImpl {
 		return nil
 	}
 	return &poolImpl{
-		cfg:    cfg,
-		config: poolConfig,
-		idle:   make(map[string][]string),
-		target: target,
+		cfg:       cfg,
+		config:    poolConfig,
+		idle:      make(map[string][]string),
+		idleSince: make(map[string]time.Time),
+		pooledAt:  make(map[string]time.Time),
+		target:    target,
+		refilling: make(map[string]int),
+		lastError: make(map[string]string),
 	}
 }
 
 // Get acquires an idle session for the given image.
 // workspaceID is ignored for pool lookup; sessions are keyed by image only.
 // When workspaceID is non-empty, the caller must bind-mount the workspace into the session before use.
+// Unless ctx is marked WithHighPriority, the last admission.pool_reserve_high
+// idle sessions of an image pool are left for high-priority callers.
 func (p *poolImpl) Get(ctx context.Context, image string, workspaceID string) (string, bool) {
 	key := poolKey(image, workspaceID)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	target, ok := p.target[key]
 	if workspaceID != "" && !ok {
 		// Dynamic workspace pools may not have static targets; still allow acquire.
@@ -91,16 +153,19 @@ func (p *poolImpl) Get(ctx context.Context, image string, workspaceID string) (s
 		return "", false
 	}
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
 	ids := p.idle[key]
-	if len(ids) == 0 {
+	reserve := 0
+	if workspaceID == "" && !HighPriority(ctx) {
+		reserve = p.cfg.Admission.PoolReserveHigh
+	}
+	if len(ids) <= reserve {
 		return "", false
 	}
 
 	sessionID := ids[len(ids)-1]
 	p.idle[key] = ids[:len(ids)-1]
+	delete(p.idleSince, sessionID)
+	delete(p.pooledAt, sessionID)
 	return sessionID, true
 }
 
@@ -112,7 +177,7 @@ func (p *poolImpl) Put(ctx context.Context, sessionID string) error {
 // Refill creates sandboxes in background until pool reaches target for image.
 func (p *poolImpl) Refill(ctx context.Context, image string, workspaceID string, count int) error {
 	key := poolKey(image, workspaceID)
-	target, ok := p.target[key]
+	target, ok := p.targetFor(key)
 	if workspaceID == "" {
 		if !ok || target <= 0 {
 			return nil
@@ -130,9 +195,23 @@ func (p *poolImpl) Refill(ctx context.Context, image string, workspaceID string,
 	}
 
 	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return nil
+	}
 	current := len(p.idle[key])
 	needed := count - current
+	p.refills.Add(1)
+	p.refilling[key]++
 	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		if p.refilling[key]--; p.refilling[key] <= 0 {
+			delete(p.refilling, key)
+		}
+		p.mu.Unlock()
+		p.refills.Done()
+	}()
 
 	if needed <= 0 {
 		return nil
@@ -144,12 +223,34 @@ func (p *poolImpl) Refill(ctx context.Context, image string, workspaceID string,
 			return ctx.Err()
 		default:
 		}
+		if p.isClosing() {
+			return nil
+		}
+		if workspaceID == "" {
+			// Resize may have lowered the target since this refill started.
+			if target, _ := p.targetFor(key); p.idleCount(key) >= target {
+				return nil
+			}
+		}
+		if err := p.waitForHost(ctx, image); err != nil {
+			return err
+		}
+		if p.isClosing() {
+			return nil
+		}
 		sessionID := uuid.New().String()[:12]
-		result, err := p.config.CreateFunc(ctx, sessionID, image, workspaceID)
+		err := failpoint.Inject(failpoint.PoolRefill)
+		var result *CreateResult
+		if err == nil {
+			result, err = p.config.CreateFunc(ctx, sessionID, image, workspaceID)
+		}
 		if err != nil {
 			if p.config.Logger != nil {
 				p.config.Logger.Warn("pool refill: create failed", "image", image, "workspace_id", workspaceID, "error", err)
 			}
+			p.mu.Lock()
+			p.lastError[key] = err.Error()
+			p.mu.Unlock()
 			continue
 		}
 
@@ -163,6 +264,7 @@ func (p *poolImpl) Refill(ctx context.Context, image string, workspaceID string,
 			Status:       storemod.StatusPoolIdle,
 			Cwd:          "/workspace",
 			WorkspaceID:  workspaceID,
+			ImageDigest:  result.ImageDigest,
 			CreatedAt:    now,
 			ExpiresAt:    expiresAt,
 			LastActivity: now,
@@ -171,22 +273,383 @@ func (p *poolImpl) Refill(ctx context.Context, image string, workspaceID string,
 			if p.config.Logger != nil {
 				p.config.Logger.Warn("pool refill: store failed", "session_id", sessionID, "workspace_id", workspaceID, "error", err)
 			}
+			// Untracked, the sandbox would only be found by doctor --fix.
+			if p.config.DestroyFunc != nil {
+				_ = p.config.DestroyFunc(ctx, sessionID)
+			}
 			continue
 		}
 
 		p.mu.Lock()
 		p.idle[key] = append(p.idle[key], sessionID)
+		p.idleSince[sessionID] = time.Now()
+		p.pooledAt[sessionID] = now
+		delete(p.lastError, key)
 		p.mu.Unlock()
 	}
 	return nil
 }
 
+// waitForHost blocks while HostCheck fails, e.g. while the host is under
+// memory pressure. It returns early when ctx is done or the pool drains.
+func (p *poolImpl) waitForHost(ctx context.Context, image string) error {
+	if p.config.HostCheck == nil {
+		return nil
+	}
+	err := p.config.HostCheck()
+	if err == nil {
+		return nil
+	}
+	if p.config.Logger != nil {
+		p.config.Logger.Warn("pool refill: paused", "image", image, "reason", err)
+	}
+	refillsPaused.Inc()
+	retry := p.config.HostCheckRetry
+	if retry <= 0 {
+		retry = 2 * time.Second
+	}
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+	for err != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if p.isClosing() {
+			return nil
+		}
+		err = p.config.HostCheck()
+	}
+	if p.config.Logger != nil {
+		p.config.Logger.Info("pool refill: resumed", "image", image)
+	}
+	return nil
+}
+
 // RefillAll pre-warms the pool for all configured images (daemon startup).
 func (p *poolImpl) RefillAll(ctx context.Context) {
-	for key, count := range p.target {
+	for key, count := range p.targets() {
 		image := strings.SplitN(key, "|", 2)[0]
 		if err := p.Refill(ctx, image, "", count); err != nil && ctx.Err() == nil && p.config.Logger != nil {
 			p.config.Logger.Warn("pool refill all: failed", "image", image, "error", err)
 		}
 	}
 }
+
+// ReconcileReport summarizes what Reconcile did with the pool_idle sessions
+// found in the store.
+type ReconcileReport struct {
+	Adopted int // healthy sessions put back into the idle lists
+	Broken  int // sessions whose sandbox is gone; marked crashed
+	Surplus int // sessions over target or for images no longer pooled; destroyed
+	Missing int // sessions still needed to reach the static targets
+}
+
+// Reconcile adopts pool_idle sessions persisted by a previous daemon run so
+// they are handed out instead of orphaned. Call it once at startup, before
+// RefillAll fills whatever is still Missing.
+func (p *poolImpl) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	var rep ReconcileReport
+	sessions, err := p.config.Store.ListPoolIdleSessions()
+	if err != nil {
+		return rep, err
+	}
+
+	for _, sess := range sessions {
+		key := poolKey(sess.Image, sess.WorkspaceID)
+		limit, ok := p.targetFor(key)
+		if sess.WorkspaceID != "" && !ok {
+			// Dynamic workspace pools are refilled one at a time.
+			limit = 1
+		}
+
+		switch {
+		case !p.sandboxHealthy(ctx, sess.ID):
+			rep.Broken++
+			p.discard(ctx, sess.ID, "crashed")
+		case p.idleCount(key) >= limit:
+			rep.Surplus++
+			p.discard(ctx, sess.ID, "destroyed")
+		default:
+			rep.Adopted++
+			p.mu.Lock()
+			p.idle[key] = append(p.idle[key], sess.ID)
+			p.idleSince[sess.ID] = time.Now()
+			p.pooledAt[sess.ID] = sess.CreatedAt
+			p.mu.Unlock()
+		}
+	}
+
+	for key, n := range p.targets() {
+		if c := p.idleCount(key); c < n {
+			rep.Missing += n - c
+		}
+	}
+
+	if p.config.Logger != nil {
+		p.config.Logger.Info("pool reconciled",
+			"adopted", rep.Adopted, "broken", rep.Broken, "surplus", rep.Surplus, "missing", rep.Missing)
+	}
+	return rep, nil
+}
+
+func (p *poolImpl) sandboxHealthy(ctx context.Context, sessionID string) bool {
+	if p.config.IsRunning == nil {
+		return true
+	}
+	running, err := p.config.IsRunning(ctx, sessionID)
+	if err != nil {
+		if p.config.Logger != nil {
+			p.config.Logger.Warn("pool reconcile: check session", "session_id", sessionID, "error", err)
+		}
+		return false
+	}
+	return running
+}
+
+// discard destroys a pool sandbox that will not be handed out and records its
+// final status.
+func (p *poolImpl) discard(ctx context.Context, sessionID, status string) {
+	if p.config.DestroyFunc != nil {
+		if err := p.config.DestroyFunc(ctx, sessionID); err != nil && p.config.Logger != nil {
+			p.config.Logger.Warn("pool discard: destroy session", "session_id", sessionID, "error", err)
+		}
+	}
+	if err := p.config.Store.UpdateSessionStatus(sessionID, status); err != nil && p.config.Logger != nil {
+		p.config.Logger.Warn("pool discard: update status", "session_id", sessionID, "error", err)
+	}
+}
+
+// Recycle destroys the idle sessions of image (every workspace key) and refills
+// the static target, so sessions built from a replaced image version are not
+// handed out. Sessions already acquired are left alone. Returns how many idle
+// sessions were discarded.
+func (p *poolImpl) Recycle(ctx context.Context, image string) int {
+	n := p.Flush(ctx, image)
+	if err := p.Refill(ctx, image, "", 0); err != nil && ctx.Err() == nil && p.config.Logger != nil {
+		p.config.Logger.Warn("pool recycle: refill failed", "image", image, "error", err)
+	}
+	return n
+}
+
+// Flush destroys the idle sessions of image (every workspace key; "" = every
+// image) without refilling, and returns how many it discarded. Targets are
+// kept, so the next Refill builds fresh sessions.
+func (p *poolImpl) Flush(ctx context.Context, image string) int {
+	var stale []string
+	p.mu.Lock()
+	for key, ids := range p.idle {
+		if image == "" || strings.SplitN(key, "|", 2)[0] == image {
+			stale = append(stale, ids...)
+			delete(p.idle, key)
+		}
+	}
+	for _, id := range stale {
+		delete(p.idleSince, id)
+		delete(p.pooledAt, id)
+	}
+	p.mu.Unlock()
+
+	for _, id := range stale {
+		p.discard(ctx, id, "destroyed")
+	}
+	return len(stale)
+}
+
+// Resize sets the number of idle sessions kept for image (workspace_id="")
+// and returns the previous target. Idle sessions over the new size are
+// destroyed; the caller refills when the pool grew. The change lasts until the
+// daemon restarts.
+func (p *poolImpl) Resize(ctx context.Context, image string, size int) int {
+	key := poolKey(image, "")
+	var surplus []string
+	p.mu.Lock()
+	previous := p.target[key]
+	p.target[key] = size
+	if ids := p.idle[key]; len(ids) > size {
+		surplus = append(surplus, ids[size:]...)
+		p.idle[key] = ids[:size]
+		for _, id := range surplus {
+			delete(p.idleSince, id)
+			delete(p.pooledAt, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, id := range surplus {
+		p.discard(ctx, id, "destroyed")
+	}
+	if p.config.Logger != nil {
+		p.config.Logger.Info("pool resized", "image", image, "size", size, "previous", previous, "discarded", len(surplus))
+	}
+	return previous
+}
+
+// ReclaimIdle reclaims the memory of sessions idle in the pool for longer
+// than ReclaimAfter and returns the number of sessions reclaimed. Each
+// session is reclaimed once; a large warm pool otherwise keeps the page cache
+// every session filled while booting. No-op when reclaim is disabled.
+func (p *poolImpl) ReclaimIdle(ctx context.Context) int {
+	if p.config.ReclaimFunc == nil || p.config.ReclaimAfter <= 0 {
+		return 0
+	}
+	cutoff := time.Now().Add(-p.config.ReclaimAfter)
+	var due []string
+	p.mu.Lock()
+	for id, since := range p.idleSince {
+		if since.Before(cutoff) {
+			due = append(due, id)
+			delete(p.idleSince, id)
+		}
+	}
+	p.mu.Unlock()
+
+	n := 0
+	for _, id := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		freed, err := p.config.ReclaimFunc(ctx, id)
+		if err != nil {
+			if p.config.Logger != nil {
+				p.config.Logger.Warn("pool reclaim: session memory", "session_id", id, "error", err)
+			}
+			continue
+		}
+		n++
+		reclaimedSessions.Inc()
+		reclaimedBytes.Add(float64(freed))
+		if p.config.Logger != nil {
+			p.config.Logger.Debug("pool reclaim: session memory", "session_id", id, "freed_bytes", freed)
+		}
+	}
+	return n
+}
+
+// IdleSession is a pooled session waiting to be handed out.
+type IdleSession struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	Reclaimed  bool      `json:"reclaimed"` // memory reclaimed (pool.reclaim_after_seconds)
+	Healthy    bool      `json:"healthy"`   // sandbox still running
+}
+
+// KeyStatus describes the pool of one image, or image and workspace.
+type KeyStatus struct {
+	Image       string        `json:"image"`
+	WorkspaceID string        `json:"workspace_id,omitempty"`
+	Target      int           `json:"target"` // workspace pools keep 1
+	Idle        int           `json:"idle"`
+	Healthy     int           `json:"healthy"`
+	Refilling   bool          `json:"refilling"`
+	LastError   string        `json:"last_error,omitempty"` // of the last failed refill since one succeeded
+	Sessions    []IdleSession `json:"sessions"`             // oldest first
+}
+
+// Status returns every pool key with a target or idle sessions, sorted by
+// image and workspace. Idle sessions are checked with IsRunning.
+func (p *poolImpl) Status(ctx context.Context) []KeyStatus {
+	now := time.Now()
+	p.mu.Lock()
+	byKey := make(map[string]*KeyStatus)
+	entry := func(key string) *KeyStatus {
+		ks := byKey[key]
+		if ks == nil {
+			image, ws, _ := strings.Cut(key, "|")
+			ks = &KeyStatus{Image: image, WorkspaceID: ws, Sessions: []IdleSession{}}
+			if ws != "" {
+				ks.Target = 1
+			}
+			byKey[key] = ks
+		}
+		return ks
+	}
+	for key, n := range p.target {
+		entry(key).Target = n
+	}
+	for key, ids := range p.idle {
+		ks := entry(key)
+		for _, id := range ids {
+			_, fresh := p.idleSince[id]
+			created := p.pooledAt[id]
+			ks.Sessions = append(ks.Sessions, IdleSession{
+				ID:         id,
+				CreatedAt:  created,
+				AgeSeconds: int64(now.Sub(created).Seconds()),
+				Reclaimed:  !fresh,
+			})
+		}
+	}
+	for key := range p.refilling {
+		entry(key).Refilling = true
+	}
+	for key, msg := range p.lastError {
+		entry(key).LastError = msg
+	}
+	p.mu.Unlock()
+
+	keys := make([]KeyStatus, 0, len(byKey))
+	for _, ks := range byKey {
+		slices.SortFunc(ks.Sessions, func(a, b IdleSession) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		for i := range ks.Sessions {
+			ks.Sessions[i].Healthy = p.sandboxHealthy(ctx, ks.Sessions[i].ID)
+			if ks.Sessions[i].Healthy {
+				ks.Healthy++
+			}
+		}
+		ks.Idle = len(ks.Sessions)
+		keys = append(keys, *ks)
+	}
+	slices.SortFunc(keys, func(a, b KeyStatus) int {
+		return strings.Compare(a.Image+"|"+a.WorkspaceID, b.Image+"|"+b.WorkspaceID)
+	})
+	return keys
+}
+
+func (p *poolImpl) targetFor(key string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.target[key]
+	return n, ok
+}
+
+func (p *poolImpl) targets() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.target)
+}
+
+func (p *poolImpl) idleCount(key string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle[key])
+}
+
+// Drain stops further refills and waits for in-flight ones to finish the
+// sandbox they are creating. Idle sessions are already persisted as pool_idle
+// rows, so nothing else needs saving.
+func (p *poolImpl) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.closing = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.refills.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *poolImpl) isClosing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closing
+}
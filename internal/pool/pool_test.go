@@ -2,10 +2,13 @@ package pool
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/failpoint"
 	storemod "github.com/p-arndt/sandkasten/internal/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -86,6 +89,31 @@ func TestRefillAndGet(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestGet_HighPriorityReserve(t *testing.T) {
+	cfg := &config.Config{
+		Pool:      config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2}},
+		Admission: config.AdmissionConfig{PoolReserveHigh: 1},
+	}
+	st := testPoolStore(t)
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+	})
+	require.NotNil(t, pl)
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 2))
+
+	_, ok := pl.Get(context.Background(), "python", "")
+	require.True(t, ok)
+	_, ok = pl.Get(context.Background(), "python", "")
+	assert.False(t, ok, "last idle session is reserved")
+
+	_, ok = pl.Get(WithHighPriority(context.Background()), "python", "")
+	assert.True(t, ok)
+}
+
 func TestGet_WithWorkspaceID(t *testing.T) {
 	cfg := &config.Config{
 		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 1}},
@@ -132,6 +160,45 @@ func TestRefill_RespectsTarget(t *testing.T) {
 	assert.Equal(t, 3, createCount)
 }
 
+func TestRefill_SurvivesInjectedFailures(t *testing.T) {
+	failpoint.Enable()
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 3}},
+	}
+	st := testPoolStore(t)
+	createCount := 0
+	var destroyed []string
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			createCount++
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		DestroyFunc: func(ctx context.Context, sessionID string) error {
+			destroyed = append(destroyed, sessionID)
+			return nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	require.NoError(t, failpoint.Set(failpoint.PoolRefill, "2*error"))
+	t.Cleanup(failpoint.Reset)
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 3))
+	assert.Equal(t, 1, createCount)
+	assert.Equal(t, 1, pl.idleCount(poolKey("python", "")))
+
+	// A sandbox whose store write fails is destroyed, not leaked.
+	require.NoError(t, failpoint.Set(failpoint.StoreWrite, "1*error"))
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 3))
+	assert.Equal(t, 3, createCount)
+	assert.Equal(t, 2, pl.idleCount(poolKey("python", "")))
+	assert.Len(t, destroyed, 1)
+
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 3))
+	assert.Equal(t, 3, pl.idleCount(poolKey("python", "")))
+}
+
 func TestRefill_FiltersAllowedImages(t *testing.T) {
 	cfg := &config.Config{
 		Pool:          config.PoolConfig{Enabled: true, Images: map[string]int{"python": 1, "node": 1}},
@@ -155,3 +222,336 @@ func TestRefill_FiltersAllowedImages(t *testing.T) {
 	_, ok = pl.Get(context.Background(), "node", "")
 	assert.False(t, ok, "node not in allowed list, should not be pooled")
 }
+
+func TestDrainWaitsForRefillAndStopsNewOnes(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 3}},
+	}
+	st := testPoolStore(t)
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			started <- struct{}{}
+			<-release
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	refillDone := make(chan error, 1)
+	go func() { refillDone <- pl.Refill(context.Background(), "python", "", 3) }()
+	<-started
+
+	drainDone := make(chan error, 1)
+	go func() { drainDone <- pl.Drain(context.Background()) }()
+	require.Eventually(t, pl.isClosing, time.Second, time.Millisecond)
+
+	select {
+	case <-drainDone:
+		t.Fatal("Drain returned while a sandbox was still being created")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-drainDone)
+	require.NoError(t, <-refillDone)
+
+	// The sandbox in flight was recorded; no further ones were started.
+	sid, ok := pl.Get(context.Background(), "python", "")
+	require.True(t, ok)
+	sess, err := st.GetSession(sid)
+	require.NoError(t, err)
+	assert.Equal(t, storemod.StatusPoolIdle, sess.Status)
+	assert.Len(t, started, 0)
+
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 1))
+	assert.Len(t, started, 0)
+}
+
+func TestRefill_WaitsWhileHostUnderPressure(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2}},
+	}
+	var checks atomic.Int32
+	created := 0
+	pl := New(cfg, PoolConfig{
+		Store:      testPoolStore(t),
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			created++
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		HostCheck: func() error {
+			// Under pressure for the first three checks.
+			if checks.Add(1) <= 3 {
+				return errors.New("memory pressure")
+			}
+			return nil
+		},
+		HostCheckRetry: time.Millisecond,
+	})
+	require.NotNil(t, pl)
+
+	require.NoError(t, pl.Refill(context.Background(), "python", "", 2))
+	assert.Equal(t, 2, created)
+	assert.GreaterOrEqual(t, checks.Load(), int32(4))
+}
+
+func TestRefill_PausedUnderPressureStopsOnDrainAndCancel(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 1}},
+	}
+	created := 0
+	pl := New(cfg, PoolConfig{
+		Store:      testPoolStore(t),
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			created++
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		HostCheck:      func() error { return errors.New("memory pressure") },
+		HostCheckRetry: time.Millisecond,
+	})
+	require.NotNil(t, pl)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pl.Refill(ctx, "python", "", 1), context.DeadlineExceeded)
+
+	refillDone := make(chan error, 1)
+	go func() { refillDone <- pl.Refill(context.Background(), "python", "", 1) }()
+	require.NoError(t, pl.Drain(context.Background()))
+	require.NoError(t, <-refillDone)
+	assert.Zero(t, created)
+}
+
+func TestReconcileAdoptsHealthyAndDiscardsRest(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2, "node": 2}},
+	}
+	st := testPoolStore(t)
+	now := time.Now().UTC()
+	leftover := func(id, image string) {
+		require.NoError(t, st.CreateSession(&storemod.Session{
+			ID: id, Image: image, Status: storemod.StatusPoolIdle, Cwd: "/workspace",
+			CreatedAt: now, ExpiresAt: now.Add(time.Hour), LastActivity: now,
+		}))
+	}
+	leftover("py-ok-1", "python")
+	leftover("py-ok-2", "python")
+	leftover("py-extra", "python")
+	leftover("py-dead", "python")
+	leftover("node-ok", "node")
+	leftover("ruby-old", "ruby")
+
+	var destroyed []string
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		IsRunning: func(ctx context.Context, sessionID string) (bool, error) {
+			return sessionID != "py-dead", nil
+		},
+		DestroyFunc: func(ctx context.Context, sessionID string) error {
+			destroyed = append(destroyed, sessionID)
+			return nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	rep, err := pl.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ReconcileReport{Adopted: 3, Broken: 1, Surplus: 2, Missing: 1}, rep)
+	assert.ElementsMatch(t, []string{"py-extra", "py-dead", "ruby-old"}, destroyed)
+
+	dead, err := st.GetSession("py-dead")
+	require.NoError(t, err)
+	assert.Equal(t, "crashed", dead.Status)
+	extra, err := st.GetSession("ruby-old")
+	require.NoError(t, err)
+	assert.Equal(t, "destroyed", extra.Status)
+
+	sid, ok := pl.Get(context.Background(), "node", "")
+	require.True(t, ok)
+	assert.Equal(t, "node-ok", sid)
+	assert.Equal(t, 2, pl.idleCount(poolKey("python", "")))
+}
+
+func TestRecycleReplacesIdleSessions(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2, "node": 1}},
+	}
+	st := testPoolStore(t)
+	var destroyed []string
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		DestroyFunc: func(ctx context.Context, sessionID string) error {
+			destroyed = append(destroyed, sessionID)
+			return nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	ctx := context.Background()
+	require.NoError(t, pl.Refill(ctx, "python", "", 2))
+	require.NoError(t, pl.Refill(ctx, "python", "ws1", 1))
+	require.NoError(t, pl.Refill(ctx, "node", "", 1))
+	old := append([]string(nil), pl.idle[poolKey("python", "")]...)
+	old = append(old, pl.idle[poolKey("python", "ws1")]...)
+
+	assert.Equal(t, 3, pl.Recycle(ctx, "python"))
+	assert.ElementsMatch(t, old, destroyed)
+
+	fresh := pl.idle[poolKey("python", "")]
+	assert.Len(t, fresh, 2)
+	for _, id := range fresh {
+		assert.NotContains(t, old, id)
+	}
+	assert.Empty(t, pl.idle[poolKey("python", "ws1")])
+	assert.Len(t, pl.idle[poolKey("node", "")], 1)
+
+	sess, err := st.GetSession(old[0])
+	require.NoError(t, err)
+	assert.Equal(t, "destroyed", sess.Status)
+}
+
+func TestReclaimIdle(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 3}},
+	}
+	var reclaimed []string
+	pl := New(cfg, PoolConfig{
+		Store:        testPoolStore(t),
+		PoolExpiry:   time.Hour,
+		ReclaimAfter: time.Minute,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		ReclaimFunc: func(ctx context.Context, sessionID string) (int64, error) {
+			reclaimed = append(reclaimed, sessionID)
+			return 4096, nil
+		},
+	})
+	require.NotNil(t, pl)
+	ctx := context.Background()
+
+	require.NoError(t, pl.Refill(ctx, "python", "", 3))
+	assert.Equal(t, 0, pl.ReclaimIdle(ctx), "sessions idle for less than ReclaimAfter are left alone")
+
+	// Age the idle sessions past ReclaimAfter; the one handed out is skipped.
+	pl.mu.Lock()
+	for id := range pl.idleSince {
+		pl.idleSince[id] = time.Now().Add(-2 * time.Minute)
+	}
+	pl.mu.Unlock()
+	taken, ok := pl.Get(ctx, "python", "")
+	require.True(t, ok)
+
+	assert.Equal(t, 2, pl.ReclaimIdle(ctx))
+	assert.Len(t, reclaimed, 2)
+	assert.NotContains(t, reclaimed, taken)
+
+	assert.Equal(t, 0, pl.ReclaimIdle(ctx), "sessions are reclaimed once")
+	assert.Equal(t, 2, pl.idleCount("python|"))
+}
+
+func TestFlushKeepsTargets(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2, "node": 1}},
+	}
+	st := testPoolStore(t)
+	var destroyed []string
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		DestroyFunc: func(ctx context.Context, sessionID string) error {
+			destroyed = append(destroyed, sessionID)
+			return nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	ctx := context.Background()
+	require.NoError(t, pl.Refill(ctx, "python", "", 2))
+	require.NoError(t, pl.Refill(ctx, "python", "ws1", 1))
+	require.NoError(t, pl.Refill(ctx, "node", "", 1))
+
+	assert.Equal(t, 3, pl.Flush(ctx, "python"))
+	assert.Len(t, destroyed, 3)
+	assert.Empty(t, pl.idle[poolKey("python", "")], "not refilled")
+	assert.Len(t, pl.idle[poolKey("node", "")], 1)
+	target, _ := pl.targetFor(poolKey("python", ""))
+	assert.Equal(t, 2, target)
+
+	assert.Equal(t, 1, pl.Flush(ctx, ""))
+	assert.Empty(t, pl.pooledAt)
+	assert.Empty(t, pl.idleSince)
+}
+
+func TestStatus(t *testing.T) {
+	cfg := &config.Config{
+		Pool: config.PoolConfig{Enabled: true, Images: map[string]int{"python": 2, "node": 1}},
+	}
+	st := testPoolStore(t)
+	dead := ""
+	failNode := true
+	pl := New(cfg, PoolConfig{
+		Store:      st,
+		PoolExpiry: 24 * time.Hour,
+		CreateFunc: func(ctx context.Context, sessionID string, image string, workspaceID string) (*CreateResult, error) {
+			if image == "node" && failNode {
+				return nil, errors.New("image node not found")
+			}
+			return &CreateResult{InitPID: 1, CgroupPath: "/cgroup/" + sessionID}, nil
+		},
+		IsRunning: func(ctx context.Context, sessionID string) (bool, error) {
+			return sessionID != dead, nil
+		},
+	})
+	require.NotNil(t, pl)
+
+	ctx := context.Background()
+	require.NoError(t, pl.Refill(ctx, "python", "", 2))
+	require.NoError(t, pl.Refill(ctx, "python", "ws1", 1))
+	require.NoError(t, pl.Refill(ctx, "node", "", 1))
+	ids := pl.idle[poolKey("python", "")]
+	dead = ids[0]
+	delete(pl.idleSince, ids[1]) // reclaimed
+
+	status := pl.Status(ctx)
+	require.Len(t, status, 3)
+
+	node := status[0]
+	assert.Equal(t, "node", node.Image)
+	assert.Equal(t, 1, node.Target)
+	assert.Equal(t, 0, node.Idle)
+	assert.Equal(t, "image node not found", node.LastError)
+	assert.Empty(t, node.Sessions)
+
+	python := status[1]
+	assert.Equal(t, KeyStatus{Image: "python", Target: 2, Idle: 2, Healthy: 1, Sessions: python.Sessions}, python)
+	require.Len(t, python.Sessions, 2)
+	for _, s := range python.Sessions {
+		assert.Equal(t, s.ID != ids[0], s.Healthy)
+		assert.Equal(t, s.ID == ids[1], s.Reclaimed)
+		assert.False(t, s.CreatedAt.IsZero())
+	}
+
+	ws := status[2]
+	assert.Equal(t, "ws1", ws.WorkspaceID)
+	assert.Equal(t, 1, ws.Target)
+	assert.Equal(t, 1, ws.Healthy)
+
+	failNode = false
+	require.NoError(t, pl.Refill(ctx, "node", "", 1))
+	assert.Empty(t, pl.Status(ctx)[0].LastError, "cleared by a successful refill")
+}
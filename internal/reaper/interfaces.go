@@ -3,12 +3,14 @@ package reaper
 import (
 	"context"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/store"
 )
 
 type ReaperStore interface {
 	ListExpiredSessions() ([]*store.Session, error)
 	ListRunningSessions() ([]*store.Session, error)
+	ListPoolIdleSessions() ([]*store.Session, error)
 	GetSession(id string) (*store.Session, error)
 	UpdateSessionStatus(id string, status string) error
 }
@@ -17,4 +19,6 @@ type ReaperRuntime interface {
 	Destroy(ctx context.Context, sessionID string) error
 	IsRunning(ctx context.Context, sessionID string) (bool, error)
 	ListSessionDirIDs(ctx context.Context) ([]string, error)
+	ListHostResources(ctx context.Context) ([]runtime.HostResource, error)
+	RemoveHostResource(ctx context.Context, r runtime.HostResource) error
 }
@@ -3,6 +3,7 @@ package reaper
 import (
 	"context"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/store"
 	"github.com/stretchr/testify/mock"
 )
@@ -27,6 +28,14 @@ func (m *MockReaperStore) ListRunningSessions() ([]*store.Session, error) {
 	return nil, args.Error(1)
 }
 
+func (m *MockReaperStore) ListPoolIdleSessions() ([]*store.Session, error) {
+	args := m.Called()
+	if sessions := args.Get(0); sessions != nil {
+		return sessions.([]*store.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockReaperStore) GetSession(id string) (*store.Session, error) {
 	args := m.Called(id)
 	if sess := args.Get(0); sess != nil {
@@ -62,6 +71,19 @@ func (m *MockReaperRuntime) ListSessionDirIDs(ctx context.Context) ([]string, er
 	return nil, args.Error(1)
 }
 
+func (m *MockReaperRuntime) ListHostResources(ctx context.Context) ([]runtime.HostResource, error) {
+	args := m.Called(ctx)
+	if res := args.Get(0); res != nil {
+		return res.([]runtime.HostResource), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockReaperRuntime) RemoveHostResource(ctx context.Context, r runtime.HostResource) error {
+	args := m.Called(ctx, r)
+	return args.Error(0)
+}
+
 type MockSessionManager struct {
 	mock.Mock
 }
@@ -69,3 +91,15 @@ type MockSessionManager struct {
 func (m *MockSessionManager) CleanupSessionLock(id string) {
 	m.Called(id)
 }
+
+func (m *MockSessionManager) RecordSessionUsage(ctx context.Context, sess *store.Session) {
+	m.Called(ctx, sess)
+}
+
+func (m *MockSessionManager) BeforeDestroy(ctx context.Context, sess *store.Session) {
+	m.Called(ctx, sess)
+}
+
+func (m *MockSessionManager) AfterDestroy(sess *store.Session, reason string) {
+	m.Called(sess, reason)
+}
@@ -2,30 +2,49 @@ package reaper
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/store"
 )
 
 type SessionManager interface {
 	CleanupSessionLock(id string)
+	// RecordSessionUsage is called before a session's sandbox is destroyed.
+	RecordSessionUsage(ctx context.Context, sess *store.Session)
+	// BeforeDestroy and AfterDestroy run the destroy hooks around teardown.
+	BeforeDestroy(ctx context.Context, sess *store.Session)
+	AfterDestroy(sess *store.Session, reason string)
+}
+
+// Notifier sends operator notifications (see notify.Notifier).
+type Notifier interface {
+	Notify(ev notify.Event)
 }
 
 type Reaper struct {
 	store          ReaperStore
 	runtime        ReaperRuntime
 	sessionManager SessionManager
+	notifier       Notifier
 	interval       time.Duration
 	logger         *slog.Logger
+	reconciled     chan struct{}
+	reconcileOnce  sync.Once
 }
 
 func New(st ReaperStore, rt ReaperRuntime, interval time.Duration, logger *slog.Logger) *Reaper {
 	return &Reaper{
-		store:    st,
-		runtime:  rt,
-		interval: interval,
-		logger:   logger,
+		store:      st,
+		runtime:    rt,
+		interval:   interval,
+		logger:     logger,
+		reconciled: make(chan struct{}),
 	}
 }
 
@@ -33,10 +52,27 @@ func (r *Reaper) SetSessionManager(sm SessionManager) {
 	r.sessionManager = sm
 }
 
+// SetNotifier installs the operator notifications (nil = none), sent when
+// reconciliation cleaned up crashed sessions or orphans.
+func (r *Reaper) SetNotifier(n Notifier) {
+	r.notifier = n
+}
+
+// Reconciled is closed once the startup reconciliation has run.
+// Anything that creates sandboxes in the background (pool refill) should wait
+// for it, since reconciliation treats sandboxes missing from the store as orphans.
+func (r *Reaper) Reconciled() <-chan struct{} {
+	return r.reconciled
+}
+
+// Run reconciles and then reaps expired sessions every interval until ctx is
+// cancelled. The daemon runs Reconcile and ReapExpired as jobs instead.
 func (r *Reaper) Run(ctx context.Context) {
 	r.logger.Info("reaper started", "interval", r.interval)
 
-	r.reconcile(ctx)
+	if err := r.Reconcile(ctx); err != nil {
+		r.logger.Error("reconcile", "error", err)
+	}
 
 	ticker := time.NewTicker(r.interval)
 	defer ticker.Stop()
@@ -47,21 +83,27 @@ func (r *Reaper) Run(ctx context.Context) {
 			r.logger.Info("reaper stopped")
 			return
 		case <-ticker.C:
-			r.reapExpired(ctx)
+			if err := r.ReapExpired(ctx); err != nil {
+				r.logger.Error("reap expired sessions", "error", err)
+			}
 		}
 	}
 }
 
-func (r *Reaper) reapExpired(ctx context.Context) {
+// ReapExpired destroys the sessions whose lease has expired.
+func (r *Reaper) ReapExpired(ctx context.Context) error {
 	expired, err := r.store.ListExpiredSessions()
 	if err != nil {
-		r.logger.Error("reaper: list expired", "error", err)
-		return
+		return fmt.Errorf("reaper: list expired: %w", err)
 	}
 
 	for _, sess := range expired {
 		r.logger.Info("reaping expired session", "session_id", sess.ID, "expired_at", sess.ExpiresAt)
 
+		if r.sessionManager != nil {
+			r.sessionManager.RecordSessionUsage(ctx, sess)
+			r.sessionManager.BeforeDestroy(ctx, sess)
+		}
 		if err := r.runtime.Destroy(ctx, sess.ID); err != nil {
 			r.logger.Error("reaper: destroy session", "session_id", sess.ID, "error", err)
 		}
@@ -72,23 +114,33 @@ func (r *Reaper) reapExpired(ctx context.Context) {
 
 		if r.sessionManager != nil {
 			r.sessionManager.CleanupSessionLock(sess.ID)
+			r.sessionManager.AfterDestroy(sess, "expired")
 		}
 	}
 
 	if len(expired) > 0 {
 		r.logger.Info("reaper: reaped sessions", "count", len(expired))
 	}
+	return nil
+}
+
+// Reconcile marks sessions whose sandbox is gone as crashed and removes
+// sandboxes and host resources the store does not know, then closes
+// Reconciled, also if it failed.
+func (r *Reaper) Reconcile(ctx context.Context) error {
+	defer r.reconcileOnce.Do(func() { close(r.reconciled) })
+	return r.reconcile(ctx)
 }
 
-func (r *Reaper) reconcile(ctx context.Context) {
+func (r *Reaper) reconcile(ctx context.Context) error {
 	r.logger.Info("reconciliation starting")
 
 	running, err := r.store.ListRunningSessions()
 	if err != nil {
-		r.logger.Error("reconcile: list running sessions", "error", err)
-		return
+		return fmt.Errorf("reconcile: list running sessions: %w", err)
 	}
 
+	crashed := 0
 	for _, sess := range running {
 		isRunning, err := r.runtime.IsRunning(ctx, sess.ID)
 		if err != nil {
@@ -100,6 +152,10 @@ func (r *Reaper) reconcile(ctx context.Context) {
 		if !isRunning {
 			r.logger.Warn("reconcile: session process not running, marking crashed and cleaning up",
 				"session_id", sess.ID)
+			crashed++
+			if r.sessionManager != nil {
+				r.sessionManager.RecordSessionUsage(ctx, sess)
+			}
 			if err := r.runtime.Destroy(ctx, sess.ID); err != nil {
 				r.logger.Error("reconcile: destroy crashed session", "session_id", sess.ID, "error", err)
 			}
@@ -108,22 +164,46 @@ func (r *Reaper) reconcile(ctx context.Context) {
 			}
 			if r.sessionManager != nil {
 				r.sessionManager.CleanupSessionLock(sess.ID)
+				// Nothing runs in a crashed session, so only the host-side
+				// hooks run.
+				r.sessionManager.AfterDestroy(sess, "crashed")
 			}
 		}
 	}
 
-	r.reconcileOrphans(ctx)
+	dirs := r.reconcileOrphans(ctx)
+	resources := r.reconcileHostResources(ctx)
 	r.logger.Info("reconciliation complete")
+	r.notifyCleanup(crashed, dirs, resources)
+	return nil
+}
+
+// notifyCleanup reports what reconciliation cleaned up, if anything.
+func (r *Reaper) notifyCleanup(crashed, dirs, resources int) {
+	if r.notifier == nil || crashed+dirs+resources == 0 {
+		return
+	}
+	r.notifier.Notify(notify.Event{
+		Type:    notify.EventOrphansCleaned,
+		Summary: fmt.Sprintf("reconciliation cleaned up %d crashed session(s), %d orphan session dir(s) and %d orphan host resource(s)", crashed, dirs, resources),
+		Fields: map[string]string{
+			"crashed_sessions":      strconv.Itoa(crashed),
+			"orphan_session_dirs":   strconv.Itoa(dirs),
+			"orphan_host_resources": strconv.Itoa(resources),
+		},
+	})
 }
 
 // reconcileOrphans scans session dirs on disk and destroys any that are not in the store
-// or not in status "running" (e.g. orphan dirs left after daemon crash).
-func (r *Reaper) reconcileOrphans(ctx context.Context) {
+// or not in status "running" (e.g. orphan dirs left after daemon crash). It
+// returns the number of dirs cleaned.
+func (r *Reaper) reconcileOrphans(ctx context.Context) int {
 	ids, err := r.runtime.ListSessionDirIDs(ctx)
 	if err != nil {
 		r.logger.Error("reconcile: list session dirs", "error", err)
-		return
+		return 0
 	}
+	cleaned := 0
 	for _, id := range ids {
 		sess, err := r.store.GetSession(id)
 		if err != nil {
@@ -132,6 +212,7 @@ func (r *Reaper) reconcileOrphans(ctx context.Context) {
 		}
 		if sess == nil || (sess.Status != "running" && sess.Status != store.StatusPoolIdle) {
 			r.logger.Info("reconcile: cleaning orphan session dir", "session_id", id)
+			cleaned++
 			if err := r.runtime.Destroy(ctx, id); err != nil {
 				r.logger.Error("reconcile: destroy orphan session", "session_id", id, "error", err)
 			}
@@ -140,4 +221,46 @@ func (r *Reaper) reconcileOrphans(ctx context.Context) {
 			}
 		}
 	}
+	return cleaned
+}
+
+// reconcileHostResources removes cgroups, veths, IP allocations and mounts whose
+// session is not running or pooled according to the store. It returns the
+// number of orphans found.
+func (r *Reaper) reconcileHostResources(ctx context.Context) int {
+	resources, err := r.runtime.ListHostResources(ctx)
+	if err != nil {
+		r.logger.Error("reconcile: list host resources", "error", err)
+		return 0
+	}
+	if len(resources) == 0 {
+		return 0
+	}
+
+	running, err := r.store.ListRunningSessions()
+	if err != nil {
+		r.logger.Error("reconcile: list running sessions", "error", err)
+		return 0
+	}
+	pooled, err := r.store.ListPoolIdleSessions()
+	if err != nil {
+		r.logger.Error("reconcile: list pool idle sessions", "error", err)
+		return 0
+	}
+	var live []string
+	for _, sess := range append(running, pooled...) {
+		live = append(live, sess.ID)
+	}
+
+	orphans := runtime.Orphaned(resources, live)
+	for _, res := range orphans {
+		r.logger.Info("reconcile: removing orphan host resource", "kind", res.Kind, "session_id", res.SessionID, "name", res.Name)
+		if err := r.runtime.RemoveHostResource(ctx, res); err != nil {
+			r.logger.Error("reconcile: remove orphan host resource", "kind", res.Kind, "name", res.Name, "error", err)
+		}
+	}
+	if len(orphans) > 0 {
+		r.logger.Info("reconcile: orphan host resources removed", "count", len(orphans))
+	}
+	return len(orphans)
 }
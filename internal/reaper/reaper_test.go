@@ -7,7 +7,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -23,7 +26,7 @@ func TestReapExpired_NoExpired(t *testing.T) {
 
 	st.On("ListExpiredSessions").Return([]*store.Session{}, nil)
 
-	r.reapExpired(context.Background())
+	r.ReapExpired(context.Background())
 
 	st.AssertExpectations(t)
 	rt.AssertNotCalled(t, "Destroy")
@@ -48,8 +51,14 @@ func TestReapExpired_WithExpired(t *testing.T) {
 	st.On("UpdateSessionStatus", "s2", "expired").Return(nil)
 	sm.On("CleanupSessionLock", "s1").Return()
 	sm.On("CleanupSessionLock", "s2").Return()
+	sm.On("RecordSessionUsage", mock.Anything, expired[0]).Return()
+	sm.On("RecordSessionUsage", mock.Anything, expired[1]).Return()
+	sm.On("BeforeDestroy", mock.Anything, expired[0]).Return()
+	sm.On("BeforeDestroy", mock.Anything, expired[1]).Return()
+	sm.On("AfterDestroy", expired[0], "expired").Return()
+	sm.On("AfterDestroy", expired[1], "expired").Return()
 
-	r.reapExpired(context.Background())
+	r.ReapExpired(context.Background())
 
 	st.AssertExpectations(t)
 	rt.AssertExpectations(t)
@@ -70,7 +79,7 @@ func TestReapExpired_NoSessionManager(t *testing.T) {
 	st.On("UpdateSessionStatus", "s1", "expired").Return(nil)
 
 	require.NotPanics(t, func() {
-		r.reapExpired(context.Background())
+		r.ReapExpired(context.Background())
 	})
 }
 
@@ -88,13 +97,18 @@ func TestReconcile_SessionNotRunning(t *testing.T) {
 	rt.On("Destroy", mock.Anything, "orphan-session").Return(nil)
 	st.On("UpdateSessionStatus", "orphan-session", "crashed").Return(nil)
 	sm.On("CleanupSessionLock", "orphan-session").Return()
+	sm.On("RecordSessionUsage", mock.Anything, mock.Anything).Return()
+	sm.On("AfterDestroy", mock.Anything, "crashed").Return()
 	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{}, nil)
+	rt.On("ListHostResources", mock.Anything).Return(nil, nil)
 
-	r.reconcile(context.Background())
+	r.Reconcile(context.Background())
 
 	st.AssertCalled(t, "UpdateSessionStatus", "orphan-session", "crashed")
 	rt.AssertCalled(t, "Destroy", mock.Anything, "orphan-session")
 	sm.AssertCalled(t, "CleanupSessionLock", "orphan-session")
+	sm.AssertCalled(t, "AfterDestroy", mock.Anything, "crashed")
+	sm.AssertNotCalled(t, "BeforeDestroy", mock.Anything, mock.Anything)
 }
 
 func TestReconcile_SessionStillRunning(t *testing.T) {
@@ -107,8 +121,9 @@ func TestReconcile_SessionStillRunning(t *testing.T) {
 	}, nil)
 	rt.On("IsRunning", mock.Anything, "running-session").Return(true, nil)
 	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{}, nil)
+	rt.On("ListHostResources", mock.Anything).Return(nil, nil)
 
-	r.reconcile(context.Background())
+	r.Reconcile(context.Background())
 
 	st.AssertNotCalled(t, "UpdateSessionStatus")
 }
@@ -121,11 +136,12 @@ func TestReconcileOrphans_SkipsPoolIdle(t *testing.T) {
 	// Session dir exists for pool_idle session - should NOT be destroyed
 	st.On("ListRunningSessions").Return([]*store.Session{}, nil)
 	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{"pool-session-1"}, nil)
+	rt.On("ListHostResources", mock.Anything).Return(nil, nil)
 	st.On("GetSession", "pool-session-1").Return(&store.Session{
 		ID: "pool-session-1", Status: store.StatusPoolIdle,
 	}, nil)
 
-	r.reconcile(context.Background())
+	r.Reconcile(context.Background())
 
 	rt.AssertNotCalled(t, "Destroy")
 }
@@ -139,13 +155,85 @@ func TestReconcileOrphans_DestroysNonRunningNonPoolIdle(t *testing.T) {
 
 	st.On("ListRunningSessions").Return([]*store.Session{}, nil)
 	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{"orphan-dir"}, nil)
+	rt.On("ListHostResources", mock.Anything).Return(nil, nil)
 	st.On("GetSession", "orphan-dir").Return(&store.Session{
 		ID: "orphan-dir", Status: "destroyed",
 	}, nil)
 	rt.On("Destroy", mock.Anything, "orphan-dir").Return(nil)
 	sm.On("CleanupSessionLock", "orphan-dir").Return()
 
-	r.reconcile(context.Background())
+	r.Reconcile(context.Background())
 
 	rt.AssertCalled(t, "Destroy", mock.Anything, "orphan-dir")
 }
+
+func TestReconcileHostResources_RemovesOnlyOrphans(t *testing.T) {
+	st := &MockReaperStore{}
+	rt := &MockReaperRuntime{}
+	r := New(st, rt, time.Minute, testLogger())
+
+	resources := []runtime.HostResource{
+		{Kind: "cgroup", SessionID: "a1b2c3d4-e5f", Name: "/sys/fs/cgroup/sandkasten/a1b2c3d4-e5f"},
+		{Kind: "veth", SessionID: "a1b2c3d4", Name: "skv_a1b2c3d4"},
+		{Kind: "cgroup", SessionID: "abcdef12-345", Name: "/sys/fs/cgroup/sandkasten/abcdef12-345"},
+		{Kind: "veth", SessionID: "deadbeef", Name: "skv_deadbeef"},
+		{Kind: "mount", SessionID: "gone-0001", Name: "/var/lib/sandkasten/sessions/gone-0001/mnt"},
+	}
+	rt.On("ListHostResources", mock.Anything).Return(resources, nil)
+	st.On("ListRunningSessions").Return([]*store.Session{{ID: "a1b2c3d4-e5f"}}, nil)
+	st.On("ListPoolIdleSessions").Return([]*store.Session{{ID: "abcdef12-345"}}, nil)
+	rt.On("RemoveHostResource", mock.Anything, resources[3]).Return(nil)
+	rt.On("RemoveHostResource", mock.Anything, resources[4]).Return(nil)
+
+	assert.Equal(t, 2, r.reconcileHostResources(context.Background()))
+
+	rt.AssertExpectations(t)
+	rt.AssertNumberOfCalls(t, "RemoveHostResource", 2)
+}
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (n *recordingNotifier) Notify(ev notify.Event) {
+	n.events = append(n.events, ev)
+}
+
+func TestReconcile_NotifiesCleanup(t *testing.T) {
+	st := &MockReaperStore{}
+	rt := &MockReaperRuntime{}
+	r := New(st, rt, time.Minute, testLogger())
+	n := &recordingNotifier{}
+	r.SetNotifier(n)
+
+	st.On("ListRunningSessions").Return([]*store.Session{{ID: "crashed"}}, nil)
+	st.On("ListPoolIdleSessions").Return([]*store.Session{}, nil)
+	rt.On("IsRunning", mock.Anything, "crashed").Return(false, nil)
+	rt.On("Destroy", mock.Anything, mock.Anything).Return(nil)
+	st.On("UpdateSessionStatus", "crashed", "crashed").Return(nil)
+	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{"orphan-dir"}, nil)
+	st.On("GetSession", "orphan-dir").Return(nil, nil)
+	rt.On("ListHostResources", mock.Anything).Return([]runtime.HostResource{{Kind: "veth", SessionID: "deadbeef", Name: "skv_deadbeef"}}, nil)
+	rt.On("RemoveHostResource", mock.Anything, mock.Anything).Return(nil)
+
+	require.NoError(t, r.Reconcile(context.Background()))
+
+	require.Len(t, n.events, 1)
+	assert.Equal(t, notify.EventOrphansCleaned, n.events[0].Type)
+	assert.Equal(t, map[string]string{"crashed_sessions": "1", "orphan_session_dirs": "1", "orphan_host_resources": "1"}, n.events[0].Fields)
+}
+
+func TestReconcile_NothingCleanedNotifiesNothing(t *testing.T) {
+	st := &MockReaperStore{}
+	rt := &MockReaperRuntime{}
+	r := New(st, rt, time.Minute, testLogger())
+	n := &recordingNotifier{}
+	r.SetNotifier(n)
+
+	st.On("ListRunningSessions").Return([]*store.Session{}, nil)
+	rt.On("ListSessionDirIDs", mock.Anything).Return([]string{}, nil)
+	rt.On("ListHostResources", mock.Anything).Return(nil, nil)
+
+	require.NoError(t, r.Reconcile(context.Background()))
+	assert.Empty(t, n.events)
+}
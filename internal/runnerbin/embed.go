@@ -0,0 +1,21 @@
+//go:build embedrunner
+
+package runnerbin
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:embed runner-linux-*
+var embedded embed.FS
+
+func init() {
+	entries, _ := embedded.ReadDir(".")
+	for _, e := range entries {
+		data, err := embedded.ReadFile(e.Name())
+		if err == nil {
+			Binaries[strings.TrimPrefix(e.Name(), "runner-linux-")] = data
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package runnerbin locates the runner binary on the host and carries it
+// inside the daemon for runner.injection "embedded". Runners are static Go
+// binaries named runner-linux-<arch> (`task runner` builds amd64 and arm64);
+// the one matching the host architecture is used, since the runner executes
+// on the host kernel whatever libc or architecture the image has. They are
+// only embedded when the daemon is built with -tags embedrunner after copying
+// them to this directory (`task daemon-embedded`).
+package runnerbin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"strings"
+)
+
+// Binaries holds the embedded runners by architecture (GOARCH name). It is
+// empty if the daemon was built without them.
+var Binaries = map[string][]byte{}
+
+// ErrNotEmbedded is returned by Extract when the daemon has no runner embedded.
+var ErrNotEmbedded = errors.New("runner not embedded (build the daemon with -tags embedrunner)")
+
+// HostName is the file name of the runner built for the host architecture.
+var HostName = "runner-linux-" + goruntime.GOARCH
+
+// Find returns the runner for the host architecture in dir: runner-linux-<arch>,
+// or the plain "runner" of single-architecture builds.
+func Find(dir string) (string, error) {
+	for _, name := range []string{HostName, "runner"} {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("runner binary not found in %s (want %s or runner) - run 'task build' first", dir, HostName)
+}
+
+// Extract writes the embedded runner for the host architecture to dir and
+// returns its path. The file name carries the content hash, so an upgraded
+// daemon never reuses a stale runner and an unchanged one is not rewritten.
+func Extract(dir string) (string, error) {
+	bin := Binaries[goruntime.GOARCH]
+	if len(bin) == 0 {
+		if len(Binaries) == 0 {
+			return "", ErrNotEmbedded
+		}
+		var have []string
+		for arch := range Binaries {
+			have = append(have, arch)
+		}
+		slices.Sort(have)
+		return "", fmt.Errorf("no runner for %s embedded (have %s)", goruntime.GOARCH, strings.Join(have, ", "))
+	}
+	sum := sha256.Sum256(bin)
+	dst := filepath.Join(dir, "runner-"+hex.EncodeToString(sum[:6]))
+	if info, err := os.Stat(dst); err == nil && info.Size() == int64(len(bin)) {
+		return dst, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".runner-*")
+	if err != nil {
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", fmt.Errorf("extract runner: %w", err)
+	}
+	return dst, nil
+}
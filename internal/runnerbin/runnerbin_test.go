@@ -0,0 +1,60 @@
+package runnerbin
+
+import (
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	old := Binaries
+	t.Cleanup(func() { Binaries = old })
+
+	Binaries = map[string][]byte{}
+	_, err := Extract(t.TempDir())
+	assert.ErrorIs(t, err, ErrNotEmbedded)
+
+	Binaries = map[string][]byte{"foreign": []byte("x")}
+	_, err = Extract(t.TempDir())
+	assert.ErrorContains(t, err, "have foreign")
+
+	Binaries = map[string][]byte{goruntime.GOARCH: []byte("#!/bin/sh\necho runner\n")}
+	dir := filepath.Join(t.TempDir(), "runner")
+	path, err := Extract(dir)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, Binaries[goruntime.GOARCH], data)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	again, err := Extract(dir)
+	require.NoError(t, err)
+	assert.Equal(t, path, again)
+
+	Binaries[goruntime.GOARCH] = []byte("#!/bin/sh\necho upgraded\n")
+	upgraded, err := Extract(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, path, upgraded)
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Find(dir)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "runner"), nil, 0755))
+	got, err := Find(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "runner"), got)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, HostName), nil, 0755))
+	got, err = Find(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, HostName), got)
+}
@@ -0,0 +1,607 @@
+//go:build linux && containerd
+
+// Package containerd implements runtime.Driver on top of containerd.
+//
+// Each session is a container plus task in the configured containerd
+// namespace, so standard tooling sees them (ctr -n sandkasten tasks ls,
+// nerdctl -n sandkasten ps). containerd pulls and unpacks images through its
+// snapshotter and runs the task with its shim (runc unless configured
+// otherwise). The runner is bind-mounted from the host and started as the
+// task's process; it speaks the usual JSON protocol on a socket in a host
+// directory that is bind-mounted at /run/sandkasten.
+//
+// Session layout on disk:
+//
+//	/var/lib/sandkasten/sessions/<id>/
+//	  run/             bind-mounted at /run/sandkasten (runner.sock)
+//	  mnt/workspace/   shared mount bound at /workspace; workspaces are mounted onto it
+//	  runner.log       stdout/stderr of the task
+//
+//	Daemon → Driver.Create() → containerd container + task → Runner (PID 1)
+//	Daemon → Driver.Exec() → sessions/<id>/run/runner.sock → Runner → bash
+package containerd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cgroupstats "github.com/containerd/cgroups/v3/cgroup2/stats"
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/contrib/seccomp"
+	"github.com/containerd/containerd/v2/defaults"
+	"github.com/containerd/containerd/v2/pkg/cio"
+	"github.com/containerd/containerd/v2/pkg/oci"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/typeurl/v2"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// Labels on every session container.
+const (
+	labelSessionID = "sandkasten.io/session-id"
+	labelImage     = "sandkasten.io/image"
+)
+
+const (
+	runnerUID = 1000
+	runnerGID = 1000
+	// runnerPath is where the runner sits in images built for the linux
+	// runtime; the host binary is mounted over it.
+	runnerPath = "/usr/local/bin/runner"
+)
+
+// Driver is the containerd implementation of runtime.Driver.
+type Driver struct {
+	cfg         *config.Config
+	client      *client.Client
+	dataDir     string
+	snapshotter string
+	runner      string
+	logger      *slog.Logger
+
+	pullMu sync.Mutex // serializes pulls so concurrent creates fetch an image once
+}
+
+// NewDriver connects to containerd at cfg.Containerd.Address.
+func NewDriver(cfg *config.Config, logger *slog.Logger) (*Driver, error) {
+	c := cfg.Containerd
+	if cfg.Defaults.NetworkMode == "bridge" {
+		return nil, fmt.Errorf("network_mode bridge is not supported by the containerd runtime (use none or host)")
+	}
+	if c.Namespace == "" {
+		return nil, fmt.Errorf("containerd.namespace is required")
+	}
+
+	runner := c.RunnerPath
+	if runner == "" {
+		runner = filepath.Join(cfg.DataDir, "layers", "runner", "rootfs", "usr", "local", "bin", "runner")
+	}
+	info, err := os.Stat(runner)
+	if err != nil {
+		return nil, fmt.Errorf("runner binary: %w", err)
+	}
+	if info.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("runner binary %s is not executable", runner)
+	}
+
+	for _, dir := range []string{filepath.Join(cfg.DataDir, "sessions"), filepath.Join(cfg.DataDir, "workspaces")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+	}
+
+	cl, err := client.New(c.Address, client.WithDefaultNamespace(c.Namespace), client.WithTimeout(10*time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("connect to containerd at %s: %w", c.Address, err)
+	}
+
+	snapshotter := c.Snapshotter
+	if snapshotter == "" {
+		snapshotter = defaults.DefaultSnapshotter
+	}
+	return &Driver{
+		cfg:         cfg,
+		client:      cl,
+		dataDir:     cfg.DataDir,
+		snapshotter: snapshotter,
+		runner:      runner,
+		logger:      logger,
+	}, nil
+}
+
+func (d *Driver) Close() error {
+	return d.client.Close()
+}
+
+func (d *Driver) Ping(ctx context.Context) error {
+	_, err := d.client.Version(ctx)
+	return err
+}
+
+// imageRef maps a sandkasten image name to the containerd image reference.
+func (d *Driver) imageRef(image string) (string, error) {
+	ref, ok := d.cfg.Containerd.Images[image]
+	if !ok || ref == "" {
+		return "", fmt.Errorf("no image reference configured for %s in containerd.images", image)
+	}
+	return ref, nil
+}
+
+// image returns the unpacked image for ref, pulling it on first use.
+func (d *Driver) image(ctx context.Context, ref string) (client.Image, error) {
+	img, err := d.client.GetImage(ctx, ref)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("get image %s: %w", ref, err)
+	}
+	if err != nil {
+		d.pullMu.Lock()
+		defer d.pullMu.Unlock()
+		if img, err = d.client.GetImage(ctx, ref); err != nil {
+			d.logger.Info("pulling image", "ref", ref)
+			img, err = d.client.Pull(ctx, ref, client.WithPullUnpack, client.WithPullSnapshotter(d.snapshotter))
+			if err != nil {
+				return nil, fmt.Errorf("pull image %s: %w", ref, err)
+			}
+			return img, nil
+		}
+	}
+	unpacked, err := img.IsUnpacked(ctx, d.snapshotter)
+	if err != nil {
+		return nil, fmt.Errorf("check image %s: %w", ref, err)
+	}
+	if !unpacked {
+		if err := img.Unpack(ctx, d.snapshotter); err != nil {
+			return nil, fmt.Errorf("unpack image %s: %w", ref, err)
+		}
+	}
+	return img, nil
+}
+
+// Create starts a session:
+//
+// 1. Resolve (and pull/unpack if needed) the image in containerd's store
+// 2. Prepare the session directory: run/ for the socket, the shared workspace slot
+// 3. Create the container with a new snapshot and an OCI spec carrying limits and mounts
+// 4. Start the task with the runner as process and wait for its socket
+func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	d.logger.Debug("runtime create session", "session_id", opts.SessionID, "image", opts.Image, "workspace_id", opts.WorkspaceID)
+
+	ref, err := d.imageRef(opts.Image)
+	if err != nil {
+		return nil, &runtime.CreateError{Stage: "image", Class: runtime.CreateFailureImageMissing, Err: err}
+	}
+	img, err := d.image(ctx, ref)
+	if err != nil {
+		return nil, &runtime.CreateError{Stage: "image", Class: runtime.CreateFailureImageMissing, Err: err}
+	}
+
+	sessionDir := d.sessionDir(opts.SessionID)
+	runDir := filepath.Join(sessionDir, "run")
+	slot := d.workspaceSlot(opts.SessionID)
+	for _, dir := range []string{runDir, slot} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			d.cleanup(ctx, opts.SessionID)
+			return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+		if err := os.Chown(dir, runnerUID, runnerGID); err != nil {
+			d.cleanup(ctx, opts.SessionID)
+			return nil, fmt.Errorf("chown %s: %w", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sessionDir, "machine-id"), []byte(runtime.MachineID(opts.SessionID)+"\n"), 0444); err != nil {
+		d.cleanup(ctx, opts.SessionID)
+		return nil, fmt.Errorf("write machine-id: %w", err)
+	}
+	if err := makeSharedMount(slot); err != nil {
+		d.cleanup(ctx, opts.SessionID)
+		return nil, fmt.Errorf("prepare workspace mount: %w", err)
+	}
+	if opts.WorkspaceID != "" {
+		if err := d.bindWorkspace(opts.SessionID, opts.WorkspaceID, true); err != nil {
+			d.cleanup(ctx, opts.SessionID)
+			return nil, err
+		}
+	}
+
+	containerOpts := []client.NewContainerOpts{
+		client.WithImage(img),
+		client.WithSnapshotter(d.snapshotter),
+		client.WithNewSnapshot(opts.SessionID, img),
+		client.WithContainerLabels(map[string]string{
+			labelSessionID: opts.SessionID,
+			labelImage:     opts.Image,
+		}),
+		client.WithNewSpec(d.specOpts(img, opts.SessionID, runtime.Hostname(opts.SessionID, opts.Hostname), runDir, slot)...),
+	}
+	if d.cfg.Containerd.Runtime != "" {
+		containerOpts = append(containerOpts, client.WithRuntime(d.cfg.Containerd.Runtime, nil))
+	}
+	container, err := d.client.NewContainer(ctx, opts.SessionID, containerOpts...)
+	if err != nil {
+		d.cleanup(ctx, opts.SessionID)
+		return nil, fmt.Errorf("create container: %w", err)
+	}
+
+	logPath := filepath.Join(sessionDir, "runner.log")
+	task, err := container.NewTask(ctx, cio.LogFile(logPath))
+	if err != nil {
+		d.cleanup(ctx, opts.SessionID)
+		return nil, fmt.Errorf("create task: %w", err)
+	}
+	if err := task.Start(ctx); err != nil {
+		d.cleanup(ctx, opts.SessionID)
+		return nil, fmt.Errorf("start task: %w", err)
+	}
+
+	sock := filepath.Join(runDir, "runner.sock")
+	if err := waitForSocket(ctx, sock, 10*time.Second); err != nil {
+		logContent, _ := os.ReadFile(logPath)
+		d.cleanup(ctx, opts.SessionID)
+		return nil, &runtime.CreateError{
+			Stage: "runner_socket",
+			Class: runtime.CreateFailureRunnerTimeout,
+			Err:   fmt.Errorf("wait for runner socket: %w (runner log: %s)", err, strings.TrimSpace(string(logContent))),
+		}
+	}
+
+	return &runtime.SessionInfo{
+		SessionID:   opts.SessionID,
+		InitPID:     int(task.Pid()),
+		Mnt:         filepath.Join(sessionDir, "mnt"),
+		RunnerSock:  sock,
+		ImageDigest: img.Target().Digest.String(),
+	}, nil
+}
+
+// specOpts builds the OCI spec: image config, the runner as process, limits
+// from defaults and the session mounts.
+func (d *Driver) specOpts(img client.Image, sessionID, hostname, runDir, slot string) []oci.SpecOpts {
+	return append([]oci.SpecOpts{oci.WithImageConfig(img)}, d.sessionSpecOpts(sessionID, hostname, runDir, slot)...)
+}
+
+// sessionSpecOpts is the part of the spec that does not come from the image.
+func (d *Driver) sessionSpecOpts(sessionID, hostname, runDir, slot string) []oci.SpecOpts {
+	defs := d.cfg.Defaults
+	env := []string{"HOME=/home/sandbox"}
+	if defs.ExecMode != "" {
+		env = append(env, "SANDKASTEN_EXEC_MODE="+defs.ExecMode)
+	}
+	if defs.ShellPrefer != "" {
+		env = append(env, "SANDKASTEN_SHELL_PREFER="+defs.ShellPrefer)
+	}
+
+	opts := []oci.SpecOpts{
+		oci.WithProcessArgs(runnerPath),
+		oci.WithProcessCwd("/workspace"),
+		oci.WithEnv(env),
+		oci.WithUIDGID(runnerUID, runnerGID),
+		oci.WithHostname(hostname),
+		oci.WithNoNewPrivileges,
+		oci.WithCapabilities(nil),
+		oci.WithMounts(d.sessionMounts(sessionID, runDir, slot)),
+	}
+	if defs.MemLimitMB > 0 {
+		opts = append(opts, oci.WithMemoryLimit(uint64(defs.MemLimitMB)*1024*1024))
+	}
+	if defs.CPULimit > 0 {
+		const period = 100000
+		opts = append(opts, oci.WithCPUCFS(int64(defs.CPULimit*period), period))
+		if defs.CPUBurstMs > 0 {
+			opts = append(opts, oci.WithCPUBurst(uint64(defs.CPUBurstMs)*1000))
+		}
+	}
+	if defs.CPUWeight > 0 {
+		// runc converts shares to cpu.weight on cgroup v2, rounding down:
+		// round up here so the weight comes out as configured.
+		opts = append(opts, oci.WithCPUShares(2+(uint64(defs.CPUWeight-1)*262142+9998)/9999))
+	}
+	if defs.PidsLimit > 0 {
+		opts = append(opts, oci.WithPidsLimit(int64(defs.PidsLimit)))
+	}
+	if defs.ReadonlyRootfs {
+		opts = append(opts, oci.WithRootFSReadonly())
+	}
+	if defs.NetworkMode == "host" {
+		opts = append(opts,
+			oci.WithHostNamespace(specs.NetworkNamespace),
+			oci.WithHostResolvconf,
+			oci.WithHostHostsFile,
+		)
+	}
+	if d.cfg.Security.Seccomp != "" && d.cfg.Security.Seccomp != "off" {
+		opts = append(opts, seccomp.WithDefaultProfile())
+	}
+	return opts
+}
+
+// sessionMounts are the mounts every session container gets on top of its
+// snapshot: the runner and its socket directory, identity, workspace and
+// scratch space.
+func (d *Driver) sessionMounts(sessionID, runDir, slot string) []specs.Mount {
+	return []specs.Mount{
+		{Destination: "/run/sandkasten", Type: "bind", Source: runDir, Options: []string{"rbind", "rw"}},
+		{Destination: runnerPath, Type: "bind", Source: d.runner, Options: []string{"bind", "ro"}},
+		{Destination: "/etc/machine-id", Type: "bind", Source: filepath.Join(d.sessionDir(sessionID), "machine-id"), Options: []string{"bind", "ro"}},
+		{Destination: "/workspace", Type: "bind", Source: slot, Options: []string{"rbind", "rw", "rslave"}},
+		{Destination: "/home/sandbox", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev", "size=128m", "mode=0755", "uid=1000", "gid=1000"}},
+		{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "nodev", "mode=1777"}},
+	}
+}
+
+func (d *Driver) Exec(ctx context.Context, sessionID string, req protocol.Request) (*protocol.Response, error) {
+	d.logger.Debug("runtime exec", "session_id", sessionID, "request_id", req.ID)
+	return d.roundTrip(ctx, filepath.Join(d.sessionDir(sessionID), "run", "runner.sock"), req)
+}
+
+// DialPort connects to port inside the session through its runner.
+func (d *Driver) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", filepath.Join(d.sessionDir(sessionID), "run", "runner.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	return runtime.OpenProxy(conn, port)
+}
+
+// Attach starts an interactive shell in the session through its runner.
+func (d *Driver) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", filepath.Join(d.sessionDir(sessionID), "run", "runner.sock"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	return runtime.OpenTerminal(conn, opts)
+}
+
+// Destroy kills the task and deletes the container with its snapshot, then
+// removes the workspace mount and the session directory. Missing pieces are
+// skipped so it also cleans up after a partial Create.
+func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
+	d.logger.Debug("runtime destroy session", "session_id", sessionID)
+	container, err := d.client.LoadContainer(ctx, sessionID)
+	switch {
+	case errdefs.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("load container: %w", err)
+	default:
+		if task, err := container.Task(ctx, nil); err == nil {
+			if _, err := task.Delete(ctx, client.WithProcessKill); err != nil && !errdefs.IsNotFound(err) {
+				return fmt.Errorf("delete task: %w", err)
+			}
+		} else if !errdefs.IsNotFound(err) {
+			return fmt.Errorf("load task: %w", err)
+		}
+		if err := container.Delete(ctx, client.WithSnapshotCleanup); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("delete container: %w", err)
+		}
+	}
+
+	unmountAll(d.workspaceSlot(sessionID))
+	if err := os.RemoveAll(d.sessionDir(sessionID)); err != nil {
+		return fmt.Errorf("remove session dir: %w", err)
+	}
+	return nil
+}
+
+// cleanup undoes a failed Create.
+func (d *Driver) cleanup(ctx context.Context, sessionID string) {
+	if err := d.Destroy(context.WithoutCancel(ctx), sessionID); err != nil {
+		d.logger.Warn("cleanup after failed create", "session_id", sessionID, "error", err)
+	}
+}
+
+func (d *Driver) IsRunning(ctx context.Context, sessionID string) (bool, error) {
+	container, err := d.client.LoadContainer(ctx, sessionID)
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	task, err := container.Task(ctx, nil)
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		return false, err
+	}
+	return status.Status == client.Running || status.Status == client.Paused, nil
+}
+
+// Stats reads the task's cgroup v2 metrics through containerd.
+func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.SessionStats, error) {
+	container, err := d.client.LoadContainer(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("load container: %w", err)
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("load task: %w", err)
+	}
+	metric, err := task.Metrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("task metrics: %w", err)
+	}
+	data, err := typeurl.UnmarshalAny(metric.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode metrics: %w", err)
+	}
+	m, ok := data.(*cgroupstats.Metrics)
+	if !ok {
+		return nil, fmt.Errorf("unsupported metrics type %T (cgroup v2 required)", data)
+	}
+
+	stats := &protocol.SessionStats{}
+	if mem := m.GetMemory(); mem != nil {
+		stats.MemoryBytes = int64(mem.GetUsage())
+		stats.MemoryPeak = int64(mem.GetMaxUsage())
+		if limit := mem.GetUsageLimit(); limit > 0 && limit < 1<<62 {
+			stats.MemoryLimit = int64(limit)
+		}
+	}
+	if cpu := m.GetCPU(); cpu != nil {
+		stats.CPUUsageUsec = int64(cpu.GetUsageUsec())
+		stats.CPUPressure = pressure(cpu.GetPSI())
+	}
+	stats.MemoryPressure = pressure(m.GetMemory().GetPSI())
+	stats.IOPressure = pressure(m.GetIo().GetPSI())
+	return stats, nil
+}
+
+// pressure converts the PSI of a cgroup controller; nil without PSI.
+func pressure(psi *cgroupstats.PSIStats) *protocol.Pressure {
+	if psi == nil {
+		return nil
+	}
+	some, full := psi.GetSome(), psi.GetFull()
+	return &protocol.Pressure{
+		SomeAvg10: some.GetAvg10(), SomeAvg60: some.GetAvg60(), SomeAvg300: some.GetAvg300(),
+		FullAvg10: full.GetAvg10(), FullAvg60: full.GetAvg60(), FullAvg300: full.GetAvg300(),
+	}
+}
+
+// HostWorkspace returns the attached workspace directory, or else the
+// session's slot.
+func (d *Driver) HostWorkspace(sessionID, workspaceID string) string {
+	if workspaceID != "" {
+		return filepath.Join(d.dataDir, "workspaces", workspaceID)
+	}
+	return d.workspaceSlot(sessionID)
+}
+
+// MountWorkspace mounts the workspace onto the session's shared slot; the
+// mount propagates to /workspace inside the container.
+func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error {
+	if _, err := os.Stat(d.sessionDir(sessionID)); err != nil {
+		return fmt.Errorf("session directory: %w", err)
+	}
+	return d.bindWorkspace(sessionID, workspaceID, false)
+}
+
+// ValidateImage checks the image mapping and pulls the image if containerd
+// does not have it yet.
+func (d *Driver) ValidateImage(ctx context.Context, image string) error {
+	ref, err := d.imageRef(image)
+	if err != nil {
+		return err
+	}
+	_, err = d.image(ctx, ref)
+	return err
+}
+
+// ImageDigest returns the digest of the image in containerd's store, or ""
+// when it has not been pulled yet.
+func (d *Driver) ImageDigest(ctx context.Context, image string) (string, error) {
+	ref, err := d.imageRef(image)
+	if err != nil {
+		return "", err
+	}
+	img, err := d.client.GetImage(ctx, ref)
+	if errdefs.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return img.Target().Digest.String(), nil
+}
+
+// ResolveImage returns ref unchanged; tags are part of the containerd
+// reference in containerd.images.
+func (d *Driver) ResolveImage(ctx context.Context, ref string) (string, error) {
+	return ref, nil
+}
+
+// ListSessionDirIDs returns the IDs of session containers and of session
+// directories without a container (left behind by a crash).
+func (d *Driver) ListSessionDirIDs(ctx context.Context) ([]string, error) {
+	containers, err := d.client.Containers(ctx, fmt.Sprintf("labels.%q", labelSessionID))
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, c := range containers {
+		seen[c.ID()] = true
+		ids = append(ids, c.ID())
+	}
+	entries, err := os.ReadDir(filepath.Join(d.dataDir, "sessions"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read sessions dir: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() && !seen[e.Name()] {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// ListHostResources reports nothing: cgroups, mounts and snapshots belong to
+// containerd and go away with the container.
+func (d *Driver) ListHostResources(ctx context.Context) ([]runtime.HostResource, error) {
+	return nil, nil
+}
+
+func (d *Driver) RemoveHostResource(ctx context.Context, r runtime.HostResource) error {
+	return nil
+}
+
+func (d *Driver) sessionDir(sessionID string) string {
+	return filepath.Join(d.dataDir, "sessions", sessionID)
+}
+
+// workspaceSlot is the host side of /workspace. It lives at mnt/workspace so
+// file downloads find it where the linux runtime keeps it.
+func (d *Driver) workspaceSlot(sessionID string) string {
+	return filepath.Join(d.sessionDir(sessionID), "mnt", "workspace")
+}
+
+func (d *Driver) bindWorkspace(sessionID, workspaceID string, create bool) error {
+	src := filepath.Join(d.dataDir, "workspaces", workspaceID)
+	if create {
+		if err := os.MkdirAll(src, 0755); err != nil {
+			return fmt.Errorf("mkdir workspace %s: %w", src, err)
+		}
+	} else if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("workspace directory %s: %w", workspaceID, err)
+	}
+	if err := os.Chown(src, runnerUID, runnerGID); err != nil {
+		return fmt.Errorf("chown workspace: %w", err)
+	}
+	if err := bindMount(src, d.workspaceSlot(sessionID)); err != nil {
+		return fmt.Errorf("mount workspace: %w", err)
+	}
+	return nil
+}
+
+func waitForSocket(ctx context.Context, path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("timeout waiting for socket %s", path)
+}
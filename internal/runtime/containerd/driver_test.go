@@ -0,0 +1,191 @@
+//go:build linux && containerd
+
+package containerd
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/containers"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/containerd/containerd/v2/pkg/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+func testSpec(t *testing.T, cfg *config.Config) *oci.Spec {
+	t.Helper()
+	d := &Driver{cfg: cfg, dataDir: "/data", runner: "/opt/runner"}
+	ctx := namespaces.WithNamespace(context.Background(), "sandkasten-test")
+	spec, err := oci.GenerateSpec(ctx, nil, &containers.Container{ID: "s1"},
+		d.sessionSpecOpts("s1", "host-1", "/data/sessions/s1/run", d.workspaceSlot("s1"))...)
+	require.NoError(t, err)
+	return spec
+}
+
+func hasNamespace(spec *oci.Spec, typ specs.LinuxNamespaceType) bool {
+	return slices.ContainsFunc(spec.Linux.Namespaces, func(ns specs.LinuxNamespace) bool { return ns.Type == typ })
+}
+
+// runcWeight is how runc turns cpu shares into cgroup v2 cpu.weight.
+func runcWeight(shares uint64) uint64 {
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func TestSessionSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults config.Defaults
+		security config.SecurityConfig
+		check    func(t *testing.T, spec *oci.Spec)
+	}{
+		{
+			name: "runner process",
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.Equal(t, []string{runnerPath}, spec.Process.Args)
+				assert.Equal(t, "/workspace", spec.Process.Cwd)
+				assert.Equal(t, uint32(runnerUID), spec.Process.User.UID)
+				assert.Equal(t, uint32(runnerGID), spec.Process.User.GID)
+				assert.Contains(t, spec.Process.Env, "HOME=/home/sandbox")
+				assert.Equal(t, "host-1", spec.Hostname)
+			},
+		},
+		{
+			name: "no privileges",
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.True(t, spec.Process.NoNewPrivileges)
+				caps := spec.Process.Capabilities
+				assert.Empty(t, caps.Bounding)
+				assert.Empty(t, caps.Effective)
+				assert.Empty(t, caps.Permitted)
+			},
+		},
+		{
+			name:     "exec mode and shell",
+			defaults: config.Defaults{ExecMode: "direct", ShellPrefer: "sh"},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.Contains(t, spec.Process.Env, "SANDKASTEN_EXEC_MODE=direct")
+				assert.Contains(t, spec.Process.Env, "SANDKASTEN_SHELL_PREFER=sh")
+			},
+		},
+		{
+			name:     "limits",
+			defaults: config.Defaults{MemLimitMB: 512, CPULimit: 1.5, CPUBurstMs: 20, PidsLimit: 64},
+			check: func(t *testing.T, spec *oci.Spec) {
+				res := spec.Linux.Resources
+				assert.Equal(t, int64(512<<20), *res.Memory.Limit)
+				assert.Equal(t, int64(150000), *res.CPU.Quota)
+				assert.Equal(t, uint64(100000), *res.CPU.Period)
+				assert.Equal(t, uint64(20000), *res.CPU.Burst)
+				assert.Equal(t, int64(64), res.Pids.Limit)
+			},
+		},
+		{
+			name: "no limits by default",
+			check: func(t *testing.T, spec *oci.Spec) {
+				res := spec.Linux.Resources
+				assert.True(t, res.Memory == nil || res.Memory.Limit == nil)
+				assert.True(t, res.CPU == nil || res.CPU.Quota == nil)
+				assert.True(t, res.Pids == nil || res.Pids.Limit == 0)
+			},
+		},
+		{
+			name:     "burst needs a cpu limit",
+			defaults: config.Defaults{CPUBurstMs: 20},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.True(t, spec.Linux.Resources.CPU == nil || spec.Linux.Resources.CPU.Burst == nil)
+			},
+		},
+		{
+			name:     "cpu weight survives runc conversion",
+			defaults: config.Defaults{CPUWeight: 100},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.Equal(t, uint64(100), runcWeight(*spec.Linux.Resources.CPU.Shares))
+			},
+		},
+		{
+			name:     "readonly rootfs",
+			defaults: config.Defaults{ReadonlyRootfs: true},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.True(t, spec.Root.Readonly)
+			},
+		},
+		{
+			name:     "network none keeps a private namespace",
+			defaults: config.Defaults{NetworkMode: "none"},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.True(t, hasNamespace(spec, specs.NetworkNamespace))
+			},
+		},
+		{
+			name:     "host network",
+			defaults: config.Defaults{NetworkMode: "host"},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.False(t, hasNamespace(spec, specs.NetworkNamespace))
+				var dsts []string
+				for _, m := range spec.Mounts {
+					dsts = append(dsts, m.Destination)
+				}
+				assert.Contains(t, dsts, "/etc/resolv.conf")
+				assert.Contains(t, dsts, "/etc/hosts")
+			},
+		},
+		{
+			name:     "seccomp",
+			security: config.SecurityConfig{Seccomp: "mvp"},
+			check: func(t *testing.T, spec *oci.Spec) {
+				require.NotNil(t, spec.Linux.Seccomp)
+				assert.Equal(t, specs.ActErrno, spec.Linux.Seccomp.DefaultAction)
+			},
+		},
+		{
+			name:     "seccomp off",
+			security: config.SecurityConfig{Seccomp: "off"},
+			check: func(t *testing.T, spec *oci.Spec) {
+				assert.Nil(t, spec.Linux.Seccomp)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, testSpec(t, &config.Config{Defaults: tt.defaults, Security: tt.security}))
+		})
+	}
+}
+
+func TestSessionMounts(t *testing.T) {
+	d := &Driver{dataDir: "/data", runner: "/opt/runner"}
+	mounts := d.sessionMounts("s1", "/data/sessions/s1/run", d.workspaceSlot("s1"))
+
+	byDst := make(map[string]specs.Mount, len(mounts))
+	for _, m := range mounts {
+		byDst[m.Destination] = m
+	}
+	tests := []struct {
+		dst     string
+		typ     string
+		src     string
+		options []string
+	}{
+		{dst: "/run/sandkasten", typ: "bind", src: "/data/sessions/s1/run", options: []string{"rbind", "rw"}},
+		{dst: runnerPath, typ: "bind", src: "/opt/runner", options: []string{"bind", "ro"}},
+		{dst: "/etc/machine-id", typ: "bind", src: "/data/sessions/s1/machine-id", options: []string{"bind", "ro"}},
+		{dst: "/workspace", typ: "bind", src: "/data/sessions/s1/mnt/workspace", options: []string{"rbind", "rw", "rslave"}},
+		{dst: "/home/sandbox", typ: "tmpfs", src: "tmpfs", options: []string{"nosuid", "nodev", "size=128m", "mode=0755", "uid=1000", "gid=1000"}},
+		{dst: "/tmp", typ: "tmpfs", src: "tmpfs", options: []string{"nosuid", "nodev", "mode=1777"}},
+	}
+	require.Len(t, mounts, len(tests))
+	for _, tt := range tests {
+		t.Run(tt.dst, func(t *testing.T) {
+			m, ok := byDst[tt.dst]
+			require.True(t, ok)
+			assert.Equal(t, tt.typ, m.Type)
+			assert.Equal(t, tt.src, m.Source)
+			assert.Equal(t, tt.options, m.Options)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux && containerd
+
+package containerd
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeSharedMount turns dir into a shared mount point. The container binds
+// it rslave, so mounts made on dir later (a workspace for a pooled session)
+// show up inside the container.
+func makeSharedMount(dir string) error {
+	if err := unix.Mount(dir, dir, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", dir, err)
+	}
+	if err := unix.Mount("", dir, "", unix.MS_SHARED, ""); err != nil {
+		_ = unix.Unmount(dir, unix.MNT_DETACH)
+		return fmt.Errorf("make %s shared: %w", dir, err)
+	}
+	return nil
+}
+
+func bindMount(src, dst string) error {
+	return unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, "")
+}
+
+// unmountAll removes every mount stacked on dir (workspace, then the shared bind).
+func unmountAll(dir string) {
+	for range 8 {
+		if unix.Unmount(dir, unix.MNT_DETACH) != nil {
+			return
+		}
+	}
+}
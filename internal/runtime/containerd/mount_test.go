@@ -0,0 +1,89 @@
+//go:build linux && containerd
+
+package containerd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// mountFields returns the optional fields (shared:N, master:N) of the
+// topmost mount on dir, and whether dir is a mount point at all.
+func mountFields(t *testing.T, dir string) (string, bool) {
+	t.Helper()
+	f, err := os.Open("/proc/thread-self/mountinfo")
+	require.NoError(t, err)
+	defer f.Close()
+	var opt string
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 || fields[4] != dir {
+			continue
+		}
+		var optional []string
+		for _, field := range fields[6:] {
+			if field == "-" {
+				break
+			}
+			optional = append(optional, field)
+		}
+		opt, found = strings.Join(optional, " "), true
+	}
+	require.NoError(t, scanner.Err())
+	return opt, found
+}
+
+func TestWorkspaceSlotMounts(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting needs root")
+	}
+	// Keep the test's mounts out of the host's mount table. The namespace
+	// belongs to this thread only, which is discarded when the test ends.
+	goruntime.LockOSThread()
+	require.NoError(t, unix.Unshare(unix.CLONE_NEWNS))
+	require.NoError(t, unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""))
+
+	dir := t.TempDir()
+	slot := filepath.Join(dir, "slot")
+	workspace := filepath.Join(dir, "workspace")
+	for _, d := range []string{slot, workspace} {
+		require.NoError(t, os.Mkdir(d, 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "file"), []byte("data"), 0644))
+
+	require.NoError(t, makeSharedMount(slot))
+	opt, mounted := mountFields(t, slot)
+	require.True(t, mounted)
+	assert.Contains(t, opt, "shared:")
+
+	// A workspace mounted later stacks on the shared slot.
+	require.NoError(t, bindMount(workspace, slot))
+	data, err := os.ReadFile(filepath.Join(slot, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	unmountAll(slot)
+	_, mounted = mountFields(t, slot)
+	assert.False(t, mounted)
+	_, err = os.Stat(filepath.Join(slot, "file"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMakeSharedMountMissingDir(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mounting needs root")
+	}
+	err := makeSharedMount(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bind ")
+}
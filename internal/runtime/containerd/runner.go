@@ -0,0 +1,55 @@
+//go:build linux && containerd
+
+package containerd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// roundTrip sends one request to the runner socket and reads its response line.
+func (d *Driver) roundTrip(ctx context.Context, sockPath string, req protocol.Request) (*protocol.Response, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "unix", sockPath)
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	defer conn.Close()
+
+	// The runner enforces the exec timeout; the deadline only catches a
+	// runner that stopped answering.
+	timeout := time.Duration(req.TimeoutMs)*time.Millisecond + 30*time.Second
+	if req.TimeoutMs <= 0 {
+		timeout = time.Duration(d.cfg.Defaults.MaxExecTimeoutMs)*time.Millisecond + 30*time.Second
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(append(reqJSON, '\n')); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), protocol.MaxLineBytes)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+		return nil, fmt.Errorf("no response from runner")
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,21 @@
+package runtime
+
+import "context"
+
+// CPUTuning sets how a session shares CPU with the sessions on the same host
+// cores, on top of the cpu_limit quota. Zero fields leave the cgroup's
+// setting alone.
+type CPUTuning struct {
+	// Weight is the session's cpu.weight, 1-10000 (kernel default 100).
+	// Under contention sessions get CPU time in proportion to their weight.
+	Weight int `json:"weight,omitempty"`
+	// BurstMs is cpu.max.burst: how much quota the session may save up
+	// while idle and spend above cpu_limit, per 100ms period.
+	BurstMs int `json:"burst_ms,omitempty"`
+}
+
+// CPUTuner is implemented by drivers that can change the CPU weight and
+// burst of a running session.
+type CPUTuner interface {
+	TuneCPU(ctx context.Context, sessionID string, t CPUTuning) error
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import "errors"
+
+// CreateError carries what a driver knows about a failed Create beyond the
+// error message, so the failure can be recorded and inspected later without
+// access to the host (see GET /v1/system/diagnostics).
+type CreateError struct {
+	Stage   string // step that failed, e.g. "setup", "start", "runner_socket"
+	Class   string // one of the CreateFailure classes; "" = CreateFailureOther
+	Config  string // JSON of the sandbox launch config; "" if not reached
+	LogTail string // end of the sandbox init log; "" if none
+	Errno   string // errno name such as "EPERM"; "" if unknown
+	// Transient marks failures a retry may get past, such as EAGAIN from
+	// clone while the namespaces of destroyed sessions are still being freed.
+	Transient bool
+	Err       error
+}
+
+func (e *CreateError) Error() string { return e.Err.Error() }
+
+func (e *CreateError) Unwrap() error { return e.Err }
+
+// IsTransientCreateError reports whether err is a CreateError marked Transient.
+func IsTransientCreateError(err error) bool {
+	var ce *CreateError
+	return errors.As(err, &ce) && ce.Transient
+}
+
+// Classes of create failures. They separate configuration problems (a missing
+// image, an undelegated cgroup) from kernel and sandbox startup problems.
+const (
+	CreateFailureImageMissing     = "image_missing"     // image not imported, pulled or configured
+	CreateFailureCgroupPermission = "cgroup_permission" // cgroup not writable, e.g. not delegated
+	CreateFailureOverlay          = "overlay_failed"    // overlay rootfs or its mounts could not be set up
+	CreateFailureRunnerTimeout    = "runner_timeout"    // sandbox started but the runner never came up
+	CreateFailurePool             = "pool_error"        // pooled session could not be handed out
+	CreateFailureOther            = "other"
+)
+
+// CreateFailureClass returns the class of a failed Create: the one its
+// CreateError carries, or CreateFailureOther.
+func CreateFailureClass(err error) string {
+	var ce *CreateError
+	if errors.As(err, &ce) && ce.Class != "" {
+		return ce.Class
+	}
+	return CreateFailureOther
+}
@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"strconv"
+	"time"
+)
+
+// Determinism pins what a session sees of the clock, time zone, locale and
+// randomness, so evaluation harnesses can reproduce agent runs.
+type Determinism struct {
+	// Seed seeds /dev/urandom and /dev/random, which replace the kernel's
+	// devices, and PYTHONHASHSEED.
+	Seed int64 `json:"seed"`
+	// Clock is the wall-clock time every process starts at; the clock then
+	// advances in real time. Zero leaves the clock alone.
+	Clock  time.Time `json:"clock,omitzero"`
+	TZ     string    `json:"tz"`
+	Locale string    `json:"locale"`
+}
+
+// FakeTimeLibPath is where deterministic sessions with a pinned clock find
+// libfaketime, inside the runner's tmpfs.
+const FakeTimeLibPath = "/run/sandkasten/libfaketime.so.1"
+
+// DeterministicDriver is implemented by drivers that can create
+// deterministic sessions.
+type DeterministicDriver interface {
+	// CheckDeterminism returns why sessions with d cannot be created, or nil.
+	CheckDeterminism(d *Determinism) error
+}
+
+// Env returns the environment of a deterministic session's processes, which
+// replaces the same variables of the default environment.
+func (d *Determinism) Env() []string {
+	env := []string{
+		"TZ=" + d.TZ,
+		"LANG=" + d.Locale,
+		"LC_ALL=" + d.Locale,
+		"PYTHONHASHSEED=" + strconv.FormatUint(uint64(uint32(d.Seed)), 10),
+	}
+	if !d.Clock.IsZero() {
+		// libfaketime reads absolute times in the process's time zone.
+		clock := d.Clock
+		if loc, err := time.LoadLocation(d.TZ); err == nil {
+			clock = clock.In(loc)
+		}
+		env = append(env,
+			"LD_PRELOAD="+FakeTimeLibPath,
+			"FAKETIME=@"+clock.Format(time.DateTime),
+		)
+	}
+	return env
+}
@@ -0,0 +1,21 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterminismEnv(t *testing.T) {
+	d := &Determinism{Seed: -1, TZ: "UTC", Locale: "C.UTF-8"}
+	assert.Equal(t, []string{"TZ=UTC", "LANG=C.UTF-8", "LC_ALL=C.UTF-8", "PYTHONHASHSEED=4294967295"}, d.Env())
+
+	d = &Determinism{Seed: 42, Clock: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), TZ: "Asia/Tokyo", Locale: "ja_JP.UTF-8"}
+	env := d.Env()
+	assert.Contains(t, env, "PYTHONHASHSEED=42")
+	assert.Contains(t, env, "LD_PRELOAD="+FakeTimeLibPath)
+	if _, err := time.LoadLocation("Asia/Tokyo"); err == nil {
+		assert.Contains(t, env, "FAKETIME=@2024-01-02 12:04:05")
+	}
+}
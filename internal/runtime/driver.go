@@ -13,28 +13,36 @@ package runtime
 
 import (
 	"context"
+	"net"
 
+	"github.com/p-arndt/sandkasten/internal/imagescan"
 	"github.com/p-arndt/sandkasten/protocol"
 )
 
 // CreateOpts holds parameters for creating a new sandbox session.
 // SessionID uniquely identifies the session. Image names the rootfs (e.g. "python").
 // WorkspaceID, if non-empty, causes the workspace directory to be bind-mounted at /workspace.
+// Hostname, if non-empty, replaces the hostname derived from the session ID (see Hostname).
+// Determinism, if set, pins the clock, locale and randomness (see DeterministicDriver).
 type CreateOpts struct {
 	SessionID   string
 	Image       string
 	WorkspaceID string
+	Hostname    string
+	Determinism *Determinism
 }
 
 // SessionInfo is returned after a successful Create and contains all handles needed
 // to communicate with and manage the session. InitPID is the PID of the nsinit/runner
 // process on the host. RunnerSock is the path to the Unix socket (via /proc/<pid>/root).
+// ImageDigest identifies the image version the rootfs was built from ("" if unknown).
 type SessionInfo struct {
-	SessionID  string
-	InitPID    int
-	CgroupPath string
-	Mnt        string
-	RunnerSock string
+	SessionID   string
+	InitPID     int
+	CgroupPath  string
+	Mnt         string
+	RunnerSock  string
+	ImageDigest string
 }
 
 // Driver is the interface that platform-specific runtimes must implement.
@@ -59,4 +67,115 @@ type Driver interface {
 	// Used when acquiring a pooled session for a request with workspace_id. The workspace
 	// is mounted via nsenter into the session's mount namespace.
 	MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error
+
+	// ValidateImage checks that an image is complete enough to boot a session
+	// (layers present, runner executable, /bin/sh) without creating one.
+	ValidateImage(ctx context.Context, image string) error
+
+	// ImageDigest returns the digest of the current version of an image, or ""
+	// when the image records none (e.g. imported from a tarball).
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+// MemoryReclaimer is implemented by drivers that can push a session's
+// reclaimable memory, mostly page cache, out of RAM. Used for sessions that
+// sit idle in the pool.
+type MemoryReclaimer interface {
+	// ReclaimMemory asks the kernel to reclaim the session's memory and
+	// returns how many bytes its usage dropped by.
+	ReclaimMemory(ctx context.Context, sessionID string) (int64, error)
+}
+
+// PortDialer is implemented by drivers that can open a TCP connection to a
+// port on a session's loopback interface. The runner relays the connection, so
+// it works in every network mode, including none.
+type PortDialer interface {
+	DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error)
+}
+
+// TerminalAttacher is implemented by drivers that can start an interactive
+// shell on a terminal of its own in a session, next to the shell serving
+// exec.
+type TerminalAttacher interface {
+	Attach(ctx context.Context, sessionID string, opts AttachOpts) (Terminal, error)
+}
+
+// RunnerUpdater is implemented by drivers that can replace the runner of a
+// running session with the daemon's current build. Pooled sessions created
+// before a daemon upgrade otherwise keep the old runner.
+type RunnerUpdater interface {
+	// EnsureRunner upgrades the session's runner if its binary differs from
+	// the current one and reports whether it did.
+	EnsureRunner(ctx context.Context, sessionID string) (bool, error)
+}
+
+// ImageRebaser is implemented by drivers that can move a session to another
+// image, or a newer version of its image, without losing its files.
+type ImageRebaser interface {
+	// Rebase stops the sandbox of opts.SessionID and starts it again on
+	// opts.Image, keeping the session's upper layer: every file it created or
+	// changed outside the image, /workspace included. Processes, the shell,
+	// /tmp and /home/sandbox start over. If the sandbox cannot start, the upper
+	// layer is kept and the session stays stopped until Rebase succeeds.
+	Rebase(ctx context.Context, opts CreateOpts) (*SessionInfo, error)
+}
+
+// ImageScanReader is implemented by drivers that keep vulnerability scan
+// reports with their images (sandkasten image scan).
+type ImageScanReader interface {
+	// ImageScan returns the report of the current version of image (a name),
+	// or nil if that version was not scanned.
+	ImageScan(ctx context.Context, image string) (*imagescan.Report, error)
+}
+
+// WorkspaceLocator is implemented by drivers that keep a session's
+// /workspace in a directory on the daemon's host, where file downloads read
+// it without going through the runner.
+type WorkspaceLocator interface {
+	// HostWorkspace returns the host directory behind /workspace of the
+	// session; workspaceID is the directory name of its attached workspace,
+	// or empty.
+	HostWorkspace(sessionID, workspaceID string) string
+}
+
+// SharedChannelMounter is implemented by drivers that can attach a shared
+// channel, a size-limited tmpfs several sessions mount at the same time, to a
+// running session.
+type SharedChannelMounter interface {
+	// MountSharedChannel mounts channel at /shared in the session, creating
+	// its tmpfs with the given size limit if no session uses it yet.
+	MountSharedChannel(ctx context.Context, sessionID, channel string, sizeBytes int64) error
+	// ReleaseSharedChannel frees the channel's tmpfs once the last session
+	// using it is gone.
+	ReleaseSharedChannel(ctx context.Context, channel string) error
+}
+
+// SharedChannelPath is where a shared channel is mounted inside a session.
+const SharedChannelPath = "/shared"
+
+// HostResource is a host-side object created for a session outside of its
+// session directory: a cgroup, a veth interface, an IP allocation or a mount.
+// SessionID may be truncated; veth names only carry the first 8 characters.
+type HostResource struct {
+	Kind      string // "cgroup", "veth", "ip" or "mount"
+	SessionID string
+	Name      string // cgroup path, interface name, IP address or mount point
+}
+
+// Orphaned returns the resources that belong to none of the live session IDs.
+func Orphaned(resources []HostResource, live []string) []HostResource {
+	owned := make(map[string]bool, 2*len(live))
+	for _, id := range live {
+		owned[id] = true
+		if len(id) > 8 {
+			owned[id[:8]] = true
+		}
+	}
+	var orphans []HostResource
+	for _, r := range resources {
+		if !owned[r.SessionID] {
+			orphans = append(orphans, r)
+		}
+	}
+	return orphans
 }
@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHostResourcesExhausted is returned when a session cannot start because
+// a kernel limit on the host was hit. Errors carrying it are *HostLimitError.
+var ErrHostResourcesExhausted = errors.New("host resources exhausted")
+
+// HostLimitError names the host limit that stopped a session from starting,
+// e.g. "user.max_user_namespaces", so operators know which knob to raise.
+type HostLimitError struct {
+	Limit string // sysctl or rlimit name
+	Value int64  // configured limit; negative if unknown
+	Err   error  // underlying syscall error
+}
+
+func (e *HostLimitError) Error() string {
+	if e.Value >= 0 {
+		return fmt.Sprintf("%s: %s limit of %d reached: %v", ErrHostResourcesExhausted, e.Limit, e.Value, e.Err)
+	}
+	return fmt.Sprintf("%s: %s limit reached: %v", ErrHostResourcesExhausted, e.Limit, e.Err)
+}
+
+func (e *HostLimitError) Unwrap() error { return e.Err }
+
+// Is reports whether target is ErrHostResourcesExhausted.
+func (e *HostLimitError) Is(target error) bool { return target == ErrHostResourcesExhausted }
+
+// MemoryPressureReporter is implemented by drivers that can read the memory
+// pressure of the host.
+type MemoryPressureReporter interface {
+	// MemoryPressure returns the share of the last 10 seconds, in percent, in
+	// which some task on the host stalled waiting for memory (PSI "some avg10").
+	MemoryPressure() (float64, error)
+}
+
+// CheckMemoryPressure returns a *HostLimitError if the host memory pressure
+// reported by r is at or above threshold percent. A threshold <= 0 or a host
+// without PSI never rejects.
+func CheckMemoryPressure(r MemoryPressureReporter, threshold float64) error {
+	if r == nil || threshold <= 0 {
+		return nil
+	}
+	pressure, err := r.MemoryPressure()
+	if err != nil || pressure < threshold {
+		return nil
+	}
+	return &HostLimitError{
+		Limit: "host_protection.memory_pressure",
+		Value: -1,
+		Err:   fmt.Errorf("memory pressure %.1f%% >= %g%%", pressure, threshold),
+	}
+}
@@ -0,0 +1,46 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimitError(t *testing.T) {
+	err := fmt.Errorf("start nsinit: %w", &HostLimitError{Limit: "user.max_user_namespaces", Value: 15, Err: syscall.ENOSPC})
+
+	assert.ErrorIs(t, err, ErrHostResourcesExhausted)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	assert.Contains(t, err.Error(), "user.max_user_namespaces limit of 15 reached")
+
+	var limitErr *HostLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "user.max_user_namespaces", limitErr.Limit)
+
+	unknown := &HostLimitError{Limit: "kernel.pid_max", Value: -1, Err: syscall.EAGAIN}
+	assert.Contains(t, unknown.Error(), "kernel.pid_max limit reached")
+}
+
+type fixedPressure struct {
+	value float64
+	err   error
+}
+
+func (p fixedPressure) MemoryPressure() (float64, error) { return p.value, p.err }
+
+func TestCheckMemoryPressure(t *testing.T) {
+	assert.NoError(t, CheckMemoryPressure(fixedPressure{value: 10}, 40))
+	assert.NoError(t, CheckMemoryPressure(fixedPressure{value: 90}, 0), "watermark off")
+	assert.NoError(t, CheckMemoryPressure(fixedPressure{err: errors.New("no psi")}, 40), "no PSI on host")
+	assert.NoError(t, CheckMemoryPressure(nil, 40))
+
+	err := CheckMemoryPressure(fixedPressure{value: 63.24}, 40)
+	assert.ErrorIs(t, err, ErrHostResourcesExhausted)
+	var limitErr *HostLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "host_protection.memory_pressure", limitErr.Limit)
+	assert.Contains(t, err.Error(), "memory pressure 63.2% >= 40%")
+}
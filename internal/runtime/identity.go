@@ -0,0 +1,23 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Hostname returns the hostname of a session: custom if set, otherwise one
+// derived from the session ID.
+func Hostname(sessionID, custom string) string {
+	if custom != "" {
+		return custom
+	}
+	return "sk-" + sessionID[:min(8, len(sessionID))]
+}
+
+// MachineID returns the /etc/machine-id of a session: 32 lowercase hex digits
+// derived from the session ID, so it stays the same for the session's life
+// and across runner restarts and upgrades.
+func MachineID(sessionID string) string {
+	sum := sha256.Sum256([]byte("sandkasten-machine-id:" + sessionID))
+	return hex.EncodeToString(sum[:16])
+}
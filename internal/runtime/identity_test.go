@@ -0,0 +1,20 @@
+package runtime
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostname(t *testing.T) {
+	assert.Equal(t, "sk-a1b2c3d4", Hostname("a1b2c3d4-e5f", ""))
+	assert.Equal(t, "build-box", Hostname("a1b2c3d4-e5f", "build-box"))
+}
+
+func TestMachineID(t *testing.T) {
+	id := MachineID("a1b2c3d4-e5f")
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), id)
+	assert.Equal(t, id, MachineID("a1b2c3d4-e5f"))
+	assert.NotEqual(t, id, MachineID("a1b2c3d4-e60"))
+}
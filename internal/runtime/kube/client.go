@@ -0,0 +1,154 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+// In-cluster service account files.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	saTokenFile       = serviceAccountDir + "/token"
+	saCAFile          = serviceAccountDir + "/ca.crt"
+	saNamespaceFile   = serviceAccountDir + "/namespace"
+)
+
+// apiClient is a minimal Kubernetes REST client: JSON in, JSON out, bearer
+// token auth. Only the few pod endpoints the driver needs are used, which keeps
+// client-go out of the dependency tree.
+type apiClient struct {
+	base      string
+	tokenFile string
+	http      *http.Client
+}
+
+// apiError is a non-2xx answer from the API server.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("kubernetes api: %d %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+func newAPIClient(cfg config.KubernetesConfig) (*apiClient, error) {
+	base := cfg.APIServer
+	if base == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes.api_server is empty and not running in a cluster")
+		}
+		base = "https://" + net.JoinHostPort(host, port)
+	}
+	tokenFile := cfg.TokenFile
+	if tokenFile == "" {
+		tokenFile = saTokenFile
+	}
+	caFile := cfg.CAFile
+	if caFile == "" && cfg.APIServer == "" {
+		caFile = saCAFile
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	return &apiClient{
+		base:      strings.TrimRight(base, "/"),
+		tokenFile: tokenFile,
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsCfg, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// do sends body (if non-nil) as JSON and decodes the response into out (if
+// non-nil). PATCH bodies are sent as JSON merge patches.
+func (c *apiClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		contentType := "application/json"
+		if method == http.MethodPatch {
+			contentType = "application/merge-patch+json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	// Re-read on every request: projected service account tokens are rotated.
+	if token, err := os.ReadFile(c.tokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("kubernetes api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(data))
+		}
+		return &apiError{Status: resp.StatusCode, Message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// inClusterNamespace returns the namespace of the daemon's own pod, or "".
+func inClusterNamespace() string {
+	data, err := os.ReadFile(saNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
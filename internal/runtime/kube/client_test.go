@@ -0,0 +1,170 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// recordedRequest is what the fake API server saw.
+type recordedRequest struct {
+	Method      string
+	Path        string
+	ContentType string
+	Accept      string
+	Auth        string
+	Body        string
+}
+
+func newTestClient(t *testing.T, status int, reply string) (*apiClient, *recordedRequest) {
+	t.Helper()
+	got := &recordedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*got = recordedRequest{
+			Method:      r.Method,
+			Path:        r.URL.RequestURI(),
+			ContentType: r.Header.Get("Content-Type"),
+			Accept:      r.Header.Get("Accept"),
+			Auth:        r.Header.Get("Authorization"),
+			Body:        string(body),
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token\n"), 0600))
+	c, err := newAPIClient(config.KubernetesConfig{APIServer: srv.URL + "/", TokenFile: tokenFile})
+	require.NoError(t, err)
+	return c, got
+}
+
+func TestAPIClientRequestEncoding(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		body            any
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "get", method: http.MethodGet, path: "/api/v1/namespaces/ns/pods/sk-a"},
+		{name: "delete", method: http.MethodDelete, path: "/api/v1/namespaces/ns/pods/sk-a?gracePeriodSeconds=0"},
+		{
+			name:            "post",
+			method:          http.MethodPost,
+			path:            "/api/v1/namespaces/ns/secrets",
+			body:            sessionSecret("A", "base", "tok"),
+			wantContentType: "application/json",
+			wantBody:        `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"sk-a","labels":{"app.kubernetes.io/managed-by":"sandkasten","sandkasten.io/image":"base","sandkasten.io/session-id":"A"}},"type":"Opaque","stringData":{"runner-token":"tok"}}`,
+		},
+		{
+			name:            "patch is a merge patch",
+			method:          http.MethodPatch,
+			path:            "/api/v1/namespaces/ns/secrets/sk-a",
+			body:            map[string]any{"metadata": map[string]any{"ownerReferences": []ownerReference{{APIVersion: "v1", Kind: "Pod", Name: "sk-a", UID: "u1"}}}},
+			wantContentType: "application/merge-patch+json",
+			wantBody:        `{"metadata":{"ownerReferences":[{"apiVersion":"v1","kind":"Pod","name":"sk-a","uid":"u1"}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, got := newTestClient(t, http.StatusOK, `{}`)
+			require.NoError(t, c.do(context.Background(), tt.method, tt.path, tt.body, nil))
+			assert.Equal(t, tt.method, got.Method)
+			assert.Equal(t, tt.path, got.Path)
+			assert.Equal(t, "application/json", got.Accept)
+			assert.Equal(t, "Bearer sa-token", got.Auth)
+			assert.Equal(t, tt.wantContentType, got.ContentType)
+			if tt.wantBody == "" {
+				assert.Empty(t, got.Body)
+			} else {
+				assert.JSONEq(t, tt.wantBody, got.Body)
+			}
+		})
+	}
+}
+
+func TestAPIClientResponses(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		reply       string
+		wantErr     string
+		wantMissing bool
+		wantPhase   string
+	}{
+		{name: "decodes body", status: http.StatusOK, reply: `{"metadata":{"name":"sk-a"},"status":{"phase":"Running"}}`, wantPhase: "Running"},
+		{name: "status message", status: http.StatusForbidden, reply: `{"kind":"Status","message":"pods is forbidden"}`, wantErr: "kubernetes api: 403 pods is forbidden"},
+		{name: "plain text error", status: http.StatusInternalServerError, reply: "boom\n", wantErr: "kubernetes api: 500 boom"},
+		{name: "not found", status: http.StatusNotFound, reply: `{"message":"pods \"sk-a\" not found"}`, wantErr: `kubernetes api: 404 pods "sk-a" not found`, wantMissing: true},
+		{name: "bad json", status: http.StatusOK, reply: `{`, wantErr: "decode response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t, tt.status, tt.reply)
+			var p pod
+			err := c.do(context.Background(), http.MethodGet, "/api/v1/namespaces/ns/pods/sk-a", nil, &p)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				assert.Equal(t, tt.wantMissing, isNotFound(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPhase, p.Status.Phase)
+		})
+	}
+}
+
+// TestCreatePodSecretOwner checks the request sequence of createPod: the
+// secret first, then the pod, then the pod becomes the secret's owner.
+func TestCreatePodSecretOwner(t *testing.T) {
+	var calls []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls = append(calls, recordedRequest{Method: r.Method, Path: r.URL.Path, ContentType: r.Header.Get("Content-Type"), Body: string(body)})
+		if r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/ns/pods" {
+			io.WriteString(w, `{"metadata":{"name":"sk-a","uid":"pod-uid"}}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	c, err := newAPIClient(config.KubernetesConfig{APIServer: srv.URL, TokenFile: filepath.Join(t.TempDir(), "missing")})
+	require.NoError(t, err)
+	d := testDriver(config.KubernetesConfig{RunnerImage: "runner:v1", RunnerPort: 7070}, config.Defaults{})
+	d.api, d.namespace = c, "ns"
+
+	require.NoError(t, d.createPod(context.Background(), runtime.CreateOpts{SessionID: "A", Image: "base"}, "alpine:3.20"))
+	require.Len(t, calls, 3)
+
+	assert.Equal(t, http.MethodPost, calls[0].Method)
+	assert.Equal(t, "/api/v1/namespaces/ns/secrets", calls[0].Path)
+	var sec secret
+	require.NoError(t, json.Unmarshal([]byte(calls[0].Body), &sec))
+	assert.Equal(t, d.runnerToken("A"), sec.StringData[secretTokenKey])
+
+	assert.Equal(t, http.MethodPost, calls[1].Method)
+	assert.Equal(t, "/api/v1/namespaces/ns/pods", calls[1].Path)
+	assert.NotContains(t, calls[1].Body, d.runnerToken("A"))
+
+	assert.Equal(t, http.MethodPatch, calls[2].Method)
+	assert.Equal(t, "/api/v1/namespaces/ns/secrets/sk-a", calls[2].Path)
+	assert.Equal(t, "application/merge-patch+json", calls[2].ContentType)
+	assert.JSONEq(t, `{"metadata":{"ownerReferences":[{"apiVersion":"v1","kind":"Pod","name":"sk-a","uid":"pod-uid"}]}}`, calls[2].Body)
+}
@@ -0,0 +1,545 @@
+// Package kube implements runtime.Driver on top of a Kubernetes cluster.
+//
+// Each session is a pod in the configured namespace. An init container copies
+// the runner binary into the pod and the session image runs it as entrypoint,
+// listening on a TCP port. The daemon talks to the runner over the pod network
+// using the same JSON-line protocol as the Unix socket of the linux driver;
+// every connection starts with a per-session token derived from a key in
+// data_dir, so a daemon restart can reattach to existing pods. The runner
+// reads its token from a per-session secret owned by the pod.
+//
+//	Daemon → Driver.Create() → POST secret, pod → init container installs runner → Runner
+//	Daemon → Driver.Exec() → TCP <podIP>:<runner_port> → Runner → bash
+package kube
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// runnerKeyFile holds the key runner tokens are derived from.
+const runnerKeyFile = "kube-runner.key"
+
+// ErrWorkspacesUnsupported is returned for workspace mounts; session pods only
+// have an ephemeral /workspace.
+var ErrWorkspacesUnsupported = errors.New("workspaces are not supported by the kubernetes runtime")
+
+type Driver struct {
+	cfg       *config.Config
+	api       *apiClient
+	namespace string
+	key       []byte
+	logger    *slog.Logger
+
+	mu     sync.Mutex
+	podIPs map[string]string // sessionID -> pod IP
+}
+
+// NewDriver connects to the cluster described by cfg.Kubernetes.
+func NewDriver(cfg *config.Config, logger *slog.Logger) (*Driver, error) {
+	k := cfg.Kubernetes
+	if k.RunnerImage == "" {
+		return nil, fmt.Errorf("kubernetes.runner_image is required")
+	}
+	if cfg.Workspace.Enabled {
+		return nil, ErrWorkspacesUnsupported
+	}
+	if k.RunnerPort <= 0 || k.RunnerPort > 65535 {
+		return nil, fmt.Errorf("kubernetes.runner_port %d is out of range", k.RunnerPort)
+	}
+	api, err := newAPIClient(k)
+	if err != nil {
+		return nil, err
+	}
+	namespace := k.Namespace
+	if namespace == "" {
+		namespace = inClusterNamespace()
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	key, err := loadRunnerKey(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Driver{
+		cfg:       cfg,
+		api:       api,
+		namespace: namespace,
+		key:       key,
+		logger:    logger,
+		podIPs:    make(map[string]string),
+	}, nil
+}
+
+// loadRunnerKey reads the token key from data_dir, creating it on first use.
+func loadRunnerKey(dataDir string) ([]byte, error) {
+	path := filepath.Join(dataDir, runnerKeyFile)
+	if key, err := os.ReadFile(path); err == nil && len(key) >= 32 {
+		return key, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate runner key: %w", err)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("write runner key: %w", err)
+	}
+	return key, nil
+}
+
+func (d *Driver) runnerToken(sessionID string) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(sessionID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Driver) podPath(sessionID string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", d.namespace, podName(sessionID))
+}
+
+func (d *Driver) secretPath(sessionID string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", d.namespace, secretName(sessionID))
+}
+
+// containerImage maps a sandkasten image name to the container image to run.
+func (d *Driver) containerImage(image string) (string, error) {
+	ref, ok := d.cfg.Kubernetes.Images[image]
+	if !ok || ref == "" {
+		return "", fmt.Errorf("no container image configured for %s in kubernetes.images", image)
+	}
+	return ref, nil
+}
+
+func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	if opts.WorkspaceID != "" {
+		return nil, ErrWorkspacesUnsupported
+	}
+	containerImage, err := d.containerImage(opts.Image)
+	if err != nil {
+		return nil, &runtime.CreateError{Stage: "image", Class: runtime.CreateFailureImageMissing, Err: err}
+	}
+	if d.logger != nil {
+		d.logger.Debug("runtime create pod", "session_id", opts.SessionID, "image", opts.Image, "container_image", containerImage)
+	}
+
+	if err := d.createPod(ctx, opts, containerImage); err != nil {
+		return nil, err
+	}
+
+	ip, err := d.waitReady(ctx, opts.SessionID)
+	if err != nil {
+		_ = d.deletePod(context.Background(), opts.SessionID)
+		_ = d.deleteSecret(context.Background(), opts.SessionID)
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.podIPs[opts.SessionID] = ip
+	d.mu.Unlock()
+
+	digest, _ := d.ImageDigest(ctx, opts.Image)
+	return &runtime.SessionInfo{
+		SessionID:   opts.SessionID,
+		RunnerSock:  net.JoinHostPort(ip, strconv.Itoa(d.cfg.Kubernetes.RunnerPort)),
+		ImageDigest: digest,
+	}, nil
+}
+
+// createPod creates the session's token secret and pod, then makes the pod
+// the owner of the secret so the cluster removes both together.
+func (d *Driver) createPod(ctx context.Context, opts runtime.CreateOpts, containerImage string) (err error) {
+	sec := sessionSecret(opts.SessionID, opts.Image, d.runnerToken(opts.SessionID))
+	if err := d.api.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/namespaces/%s/secrets", d.namespace), sec, nil); err != nil {
+		return fmt.Errorf("create secret: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = d.deletePod(context.Background(), opts.SessionID)
+			_ = d.deleteSecret(context.Background(), opts.SessionID)
+		}
+	}()
+
+	spec := d.sessionPod(opts.SessionID, runtime.Hostname(opts.SessionID, opts.Hostname), opts.Image, containerImage)
+	var created pod
+	if err := d.api.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/namespaces/%s/pods", d.namespace), spec, &created); err != nil {
+		return fmt.Errorf("create pod: %w", err)
+	}
+	owner := map[string]any{"metadata": map[string]any{"ownerReferences": []ownerReference{{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       created.Metadata.Name,
+		UID:        created.Metadata.UID,
+	}}}}
+	if err := d.api.do(ctx, http.MethodPatch, d.secretPath(opts.SessionID), owner, nil); err != nil {
+		return fmt.Errorf("set secret owner: %w", err)
+	}
+	return nil
+}
+
+// waitReady polls the pod until the runner passes its readiness probe and
+// returns the pod IP. Image pull and crash loops fail fast.
+func (d *Driver) waitReady(ctx context.Context, sessionID string) (string, error) {
+	timeout := time.Duration(d.cfg.Kubernetes.StartTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var p pod
+		if err := d.api.do(ctx, http.MethodGet, d.podPath(sessionID), nil, &p); err != nil {
+			return "", fmt.Errorf("wait for pod: %w", err)
+		}
+		if reason := p.startFailure(); reason != "" {
+			class := runtime.CreateFailureOther
+			if p.imagePullFailed() {
+				class = runtime.CreateFailureImageMissing
+			}
+			return "", &runtime.CreateError{Stage: "pod_start", Class: class, Err: fmt.Errorf("pod %s failed to start: %s", podName(sessionID), reason)}
+		}
+		if p.Status.Phase == "Running" && p.Status.PodIP != "" && p.ready() {
+			return p.Status.PodIP, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", &runtime.CreateError{
+				Stage: "pod_ready",
+				Class: runtime.CreateFailureRunnerTimeout,
+				Err:   fmt.Errorf("pod %s not ready after %s (phase %q)", podName(sessionID), timeout, p.Status.Phase),
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Driver) Exec(ctx context.Context, sessionID string, req protocol.Request) (*protocol.Response, error) {
+	if d.logger != nil {
+		d.logger.Debug("runtime exec", "session_id", sessionID, "request_id", req.ID)
+	}
+	ip, err := d.podIP(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.roundTrip(ctx, ip, sessionID, req)
+	if err != nil {
+		// The pod may have been rescheduled with a new IP; look it up next time.
+		d.mu.Lock()
+		delete(d.podIPs, sessionID)
+		d.mu.Unlock()
+	}
+	return resp, err
+}
+
+// DialPort connects to port inside the pod through its runner, which
+// reaches services bound to the pod's loopback interface only.
+func (d *Driver) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	ip, err := d.podIP(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(d.cfg.Kubernetes.RunnerPort)))
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	if _, err := conn.Write([]byte(d.runnerToken(sessionID) + "\n")); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write token: %w", err)
+	}
+	return runtime.OpenProxy(conn, port)
+}
+
+// Attach starts an interactive shell in the pod through its runner.
+func (d *Driver) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	ip, err := d.podIP(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(d.cfg.Kubernetes.RunnerPort)))
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	if _, err := conn.Write([]byte(d.runnerToken(sessionID) + "\n")); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write token: %w", err)
+	}
+	return runtime.OpenTerminal(conn, opts)
+}
+
+func (d *Driver) podIP(ctx context.Context, sessionID string) (string, error) {
+	d.mu.Lock()
+	ip, ok := d.podIPs[sessionID]
+	d.mu.Unlock()
+	if ok {
+		return ip, nil
+	}
+
+	var p pod
+	if err := d.api.do(ctx, http.MethodGet, d.podPath(sessionID), nil, &p); err != nil {
+		return "", fmt.Errorf("get pod: %w", err)
+	}
+	if p.Status.PodIP == "" || p.Status.Phase != "Running" {
+		return "", fmt.Errorf("pod %s is not running (phase %q)", podName(sessionID), p.Status.Phase)
+	}
+	d.mu.Lock()
+	d.podIPs[sessionID] = p.Status.PodIP
+	d.mu.Unlock()
+	return p.Status.PodIP, nil
+}
+
+// roundTrip sends one request to the runner in the pod and reads its response.
+func (d *Driver) roundTrip(ctx context.Context, ip, sessionID string, req protocol.Request) (*protocol.Response, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(d.cfg.Kubernetes.RunnerPort)))
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	defer conn.Close()
+
+	// Runner-side timeouts end the command; the deadline only guards against a
+	// runner that stopped answering.
+	timeout := time.Duration(req.TimeoutMs)*time.Millisecond + 30*time.Second
+	if req.TimeoutMs <= 0 {
+		timeout = time.Duration(d.cfg.Defaults.MaxExecTimeoutMs)*time.Millisecond + 30*time.Second
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	msg := append([]byte(d.runnerToken(sessionID)+"\n"), reqJSON...)
+	if _, err := conn.Write(append(msg, '\n')); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), protocol.MaxLineBytes)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+		return nil, fmt.Errorf("no response from runner")
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
+	if d.logger != nil {
+		d.logger.Debug("runtime destroy pod", "session_id", sessionID)
+	}
+	d.mu.Lock()
+	delete(d.podIPs, sessionID)
+	d.mu.Unlock()
+	if err := d.deletePod(ctx, sessionID); err != nil && !isNotFound(err) {
+		return fmt.Errorf("delete pod: %w", err)
+	}
+	// The pod owns the secret, but a secret whose pod was never created has no owner.
+	if err := d.deleteSecret(ctx, sessionID); err != nil && !isNotFound(err) {
+		return fmt.Errorf("delete secret: %w", err)
+	}
+	return nil
+}
+
+func (d *Driver) deletePod(ctx context.Context, sessionID string) error {
+	return d.api.do(ctx, http.MethodDelete, d.podPath(sessionID)+"?gracePeriodSeconds=0", nil, nil)
+}
+
+func (d *Driver) deleteSecret(ctx context.Context, sessionID string) error {
+	return d.api.do(ctx, http.MethodDelete, d.secretPath(sessionID), nil, nil)
+}
+
+func (d *Driver) IsRunning(ctx context.Context, sessionID string) (bool, error) {
+	var p pod
+	if err := d.api.do(ctx, http.MethodGet, d.podPath(sessionID), nil, &p); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return p.Status.Phase == "Running" || p.Status.Phase == "Pending", nil
+}
+
+// Stats reads the pod's memory usage from the metrics API (metrics-server).
+// The metrics API reports CPU as a rate, not cumulative time, so CPUUsageUsec
+// stays 0.
+func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.SessionStats, error) {
+	var metrics struct {
+		Containers []struct {
+			Name  string `json:"name"`
+			Usage struct {
+				Memory string `json:"memory"`
+			} `json:"usage"`
+		} `json:"containers"`
+	}
+	path := fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s", d.namespace, podName(sessionID))
+	if err := d.api.do(ctx, http.MethodGet, path, nil, &metrics); err != nil {
+		return nil, fmt.Errorf("pod metrics: %w", err)
+	}
+	stats := &protocol.SessionStats{MemoryLimit: int64(d.cfg.Defaults.MemLimitMB) << 20}
+	for _, c := range metrics.Containers {
+		if c.Name != "session" {
+			continue
+		}
+		n, err := parseQuantityBytes(c.Usage.Memory)
+		if err != nil {
+			return nil, err
+		}
+		stats.MemoryBytes = n
+	}
+	return stats, nil
+}
+
+// parseQuantityBytes parses a Kubernetes memory quantity such as "12345Ki".
+func parseQuantityBytes(q string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+		{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(q, u.suffix) {
+			q, mult = strings.TrimSuffix(q, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(q, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse quantity %q: %w", q, err)
+	}
+	return n * mult, nil
+}
+
+// Ping checks that the API server is reachable and pods can be listed.
+func (d *Driver) Ping(ctx context.Context) error {
+	_, err := d.listPods(ctx)
+	return err
+}
+
+func (d *Driver) Close() error {
+	d.api.http.CloseIdleConnections()
+	return nil
+}
+
+func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error {
+	return ErrWorkspacesUnsupported
+}
+
+// ValidateImage checks that the image is mapped to a container image. Whether
+// the cluster can pull it only shows when a pod starts.
+func (d *Driver) ValidateImage(ctx context.Context, image string) error {
+	_, err := d.containerImage(image)
+	return err
+}
+
+// ImageDigest returns the digest pinned in the container image reference
+// (name@sha256:...), or "" for tag references.
+func (d *Driver) ImageDigest(ctx context.Context, image string) (string, error) {
+	ref, err := d.containerImage(image)
+	if err != nil {
+		return "", err
+	}
+	if _, digest, ok := strings.Cut(ref, "@"); ok {
+		return digest, nil
+	}
+	return "", nil
+}
+
+// ResolveImage returns ref unchanged: image names map directly to entries in
+// kubernetes.images.
+func (d *Driver) ResolveImage(ctx context.Context, ref string) (string, error) {
+	return ref, nil
+}
+
+func (d *Driver) listPods(ctx context.Context) ([]pod, error) {
+	var list podList
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s", d.namespace, url.QueryEscape(labelManagedBy+"="+managedBy))
+	if err := d.api.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	return list.Items, nil
+}
+
+func (d *Driver) listSecrets(ctx context.Context) ([]secret, error) {
+	var list secretList
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets?labelSelector=%s", d.namespace, url.QueryEscape(labelManagedBy+"="+managedBy))
+	if err := d.api.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, fmt.Errorf("list secrets: %w", err)
+	}
+	return list.Items, nil
+}
+
+// ListSessionDirIDs returns the session IDs of all sandkasten pods and
+// secrets, so the reaper can remove those that have no session in the store.
+func (d *Driver) ListSessionDirIDs(ctx context.Context) ([]string, error) {
+	pods, err := d.listPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := d.listSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(pods)+len(secrets))
+	ids := make([]string, 0, len(pods))
+	add := func(m metadata) {
+		if id := m.Labels[labelSessionID]; id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, p := range pods {
+		add(p.Metadata)
+	}
+	for _, s := range secrets {
+		add(s.Metadata)
+	}
+	return ids, nil
+}
+
+// ListHostResources returns nothing: pods hold no resources on the daemon host.
+func (d *Driver) ListHostResources(ctx context.Context) ([]runtime.HostResource, error) {
+	return nil, nil
+}
+
+func (d *Driver) RemoveHostResource(ctx context.Context, r runtime.HostResource) error {
+	return nil
+}
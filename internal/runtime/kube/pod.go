@@ -0,0 +1,370 @@
+package kube
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// Labels on every session pod; managedBy selects them for listing.
+const (
+	labelManagedBy = "app.kubernetes.io/managed-by"
+	labelSessionID = "sandkasten.io/session-id"
+	labelImage     = "sandkasten.io/image"
+	managedBy      = "sandkasten"
+)
+
+// annotationMachineID holds the content of the session's /etc/machine-id.
+const annotationMachineID = "sandkasten.io/machine-id"
+
+// secretTokenKey is the key of the runner token in the session's secret.
+const secretTokenKey = "runner-token"
+
+// The subset of the core/v1 Pod schema the driver writes and reads.
+type pod struct {
+	APIVersion string    `json:"apiVersion,omitempty"`
+	Kind       string    `json:"kind,omitempty"`
+	Metadata   metadata  `json:"metadata"`
+	Spec       podSpec   `json:"spec"`
+	Status     podStatus `json:"status,omitempty"`
+}
+
+type metadata struct {
+	Name            string            `json:"name"`
+	UID             string            `json:"uid,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []ownerReference  `json:"ownerReferences,omitempty"`
+}
+
+type ownerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// secret is the subset of the core/v1 Secret schema the driver writes.
+type secret struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   metadata          `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	StringData map[string]string `json:"stringData,omitempty"`
+}
+
+type secretList struct {
+	Items []secret `json:"items"`
+}
+
+type podSpec struct {
+	RestartPolicy                 string            `json:"restartPolicy"`
+	Hostname                      string            `json:"hostname,omitempty"`
+	AutomountServiceAccountToken  bool              `json:"automountServiceAccountToken"`
+	EnableServiceLinks            bool              `json:"enableServiceLinks"`
+	TerminationGracePeriodSeconds int               `json:"terminationGracePeriodSeconds"`
+	RuntimeClassName              string            `json:"runtimeClassName,omitempty"`
+	NodeSelector                  map[string]string `json:"nodeSelector,omitempty"`
+	SecurityContext               *podSecurity      `json:"securityContext,omitempty"`
+	InitContainers                []container       `json:"initContainers,omitempty"`
+	Containers                    []container       `json:"containers"`
+	Volumes                       []volume          `json:"volumes,omitempty"`
+}
+
+type podSecurity struct {
+	RunAsUser    int64           `json:"runAsUser"`
+	RunAsGroup   int64           `json:"runAsGroup"`
+	RunAsNonRoot bool            `json:"runAsNonRoot"`
+	FSGroup      int64           `json:"fsGroup"`
+	Seccomp      *seccompProfile `json:"seccompProfile,omitempty"`
+}
+
+type seccompProfile struct {
+	Type string `json:"type"`
+}
+
+type container struct {
+	Name            string             `json:"name"`
+	Image           string             `json:"image"`
+	Command         []string           `json:"command,omitempty"`
+	WorkingDir      string             `json:"workingDir,omitempty"`
+	Env             []envVar           `json:"env,omitempty"`
+	Ports           []containerPort    `json:"ports,omitempty"`
+	Resources       *resources         `json:"resources,omitempty"`
+	VolumeMounts    []volumeMount      `json:"volumeMounts,omitempty"`
+	SecurityContext *containerSecurity `json:"securityContext,omitempty"`
+	ReadinessProbe  *probe             `json:"readinessProbe,omitempty"`
+}
+
+type envVar struct {
+	Name      string        `json:"name"`
+	Value     string        `json:"value,omitempty"`
+	ValueFrom *envVarSource `json:"valueFrom,omitempty"`
+}
+
+type envVarSource struct {
+	SecretKeyRef *secretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+type secretKeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type containerPort struct {
+	ContainerPort int `json:"containerPort"`
+}
+
+type resources struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type volumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+type containerSecurity struct {
+	AllowPrivilegeEscalation bool          `json:"allowPrivilegeEscalation"`
+	ReadOnlyRootFilesystem   bool          `json:"readOnlyRootFilesystem"`
+	Capabilities             *capabilities `json:"capabilities,omitempty"`
+}
+
+type capabilities struct {
+	Drop []string `json:"drop"`
+}
+
+type probe struct {
+	TCPSocket     *tcpSocketAction `json:"tcpSocket,omitempty"`
+	PeriodSeconds int              `json:"periodSeconds,omitempty"`
+}
+
+type tcpSocketAction struct {
+	Port int `json:"port"`
+}
+
+type volume struct {
+	Name        string             `json:"name"`
+	EmptyDir    *emptyDir          `json:"emptyDir,omitempty"`
+	DownwardAPI *downwardAPISource `json:"downwardAPI,omitempty"`
+}
+
+type emptyDir struct {
+	Medium    string `json:"medium,omitempty"`
+	SizeLimit string `json:"sizeLimit,omitempty"`
+}
+
+// downwardAPISource projects pod fields into files of a volume.
+type downwardAPISource struct {
+	Items []downwardAPIFile `json:"items"`
+}
+
+type downwardAPIFile struct {
+	Path     string      `json:"path"`
+	FieldRef fieldSelect `json:"fieldRef"`
+}
+
+type fieldSelect struct {
+	FieldPath string `json:"fieldPath"`
+}
+
+type podStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	Conditions        []podCondition    `json:"conditions,omitempty"`
+	ContainerStatuses []containerStatus `json:"containerStatuses,omitempty"`
+}
+
+type podCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+type containerStatus struct {
+	Name  string `json:"name"`
+	State struct {
+		Waiting *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"waiting,omitempty"`
+	} `json:"state"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+func podName(sessionID string) string {
+	return "sk-" + strings.ToLower(sessionID)
+}
+
+// secretName names the session's secret; it shares the pod's name.
+func secretName(sessionID string) string {
+	return podName(sessionID)
+}
+
+// ready reports whether the runner container passed its readiness probe.
+func (p *pod) ready() bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+// startFailure returns why the pod cannot start (e.g. ErrImagePull), or "".
+func (p *pod) startFailure() string {
+	if p.Status.Phase == "Failed" || p.Status.Phase == "Succeeded" {
+		return "pod " + strings.ToLower(p.Status.Phase)
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil {
+			switch w.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CrashLoopBackOff", "CreateContainerConfigError", "CreateContainerError":
+				return fmt.Sprintf("container %s: %s: %s", cs.Name, w.Reason, w.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// imagePullFailed reports whether a container's image cannot be pulled.
+func (p *pod) imagePullFailed() bool {
+	for _, cs := range p.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil {
+			switch w.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sessionLabels are the labels of a session's pod and secret.
+func sessionLabels(sessionID, image string) map[string]string {
+	return map[string]string{
+		labelManagedBy: managedBy,
+		labelSessionID: sessionID,
+		labelImage:     image,
+	}
+}
+
+// sessionSecret builds the secret holding the session's runner token, so the
+// token does not show up in the pod spec.
+func sessionSecret(sessionID, image, token string) secret {
+	return secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: metadata{
+			Name:   secretName(sessionID),
+			Labels: sessionLabels(sessionID, image),
+		},
+		Type:       "Opaque",
+		StringData: map[string]string{secretTokenKey: token},
+	}
+}
+
+// sessionPod builds the pod for a session. An init container copies the
+// runner from runner_image into a shared volume, and the session image runs
+// it as its entrypoint, reachable on runner_port with the token from the
+// session's secret. The session's machine-id is projected from a pod
+// annotation to /etc/machine-id.
+func (d *Driver) sessionPod(sessionID, hostname, image, containerImage string) pod {
+	k := d.cfg.Kubernetes
+	defaults := d.cfg.Defaults
+	port := k.RunnerPort
+
+	limits := map[string]string{
+		"cpu":    strconv.FormatFloat(defaults.CPULimit, 'f', -1, 64),
+		"memory": fmt.Sprintf("%dMi", defaults.MemLimitMB),
+	}
+	env := []envVar{
+		{Name: "SANDKASTEN_RUNNER_LISTEN", Value: ":" + strconv.Itoa(port)},
+		{Name: "SANDKASTEN_RUNNER_TOKEN", ValueFrom: &envVarSource{
+			SecretKeyRef: &secretKeySelector{Name: secretName(sessionID), Key: secretTokenKey},
+		}},
+		{Name: "HOME", Value: "/home/sandbox"},
+	}
+	if defaults.ExecMode != "" {
+		env = append(env, envVar{Name: "SANDKASTEN_EXEC_MODE", Value: defaults.ExecMode})
+	}
+	if defaults.ShellPrefer != "" {
+		env = append(env, envVar{Name: "SANDKASTEN_SHELL_PREFER", Value: defaults.ShellPrefer})
+	}
+	noEscalation := &containerSecurity{
+		AllowPrivilegeEscalation: false,
+		ReadOnlyRootFilesystem:   defaults.ReadonlyRootfs,
+		Capabilities:             &capabilities{Drop: []string{"ALL"}},
+	}
+
+	return pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: metadata{
+			Name:   podName(sessionID),
+			Labels: sessionLabels(sessionID, image),
+			Annotations: map[string]string{
+				annotationMachineID: runtime.MachineID(sessionID) + "\n",
+			},
+		},
+		Spec: podSpec{
+			RestartPolicy:                "Never",
+			Hostname:                     hostname,
+			AutomountServiceAccountToken: false,
+			EnableServiceLinks:           false,
+			RuntimeClassName:             k.RuntimeClass,
+			NodeSelector:                 k.NodeSelector,
+			SecurityContext: &podSecurity{
+				RunAsUser:    1000,
+				RunAsGroup:   1000,
+				RunAsNonRoot: true,
+				FSGroup:      1000,
+				Seccomp:      &seccompProfile{Type: "RuntimeDefault"},
+			},
+			InitContainers: []container{{
+				Name:            "install-runner",
+				Image:           k.RunnerImage,
+				Command:         []string{"/runner", "--install", "/sandkasten/runner"},
+				VolumeMounts:    []volumeMount{{Name: "runner", MountPath: "/sandkasten"}},
+				SecurityContext: noEscalation,
+			}},
+			Containers: []container{{
+				Name:       "session",
+				Image:      containerImage,
+				Command:    []string{"/sandkasten/runner"},
+				WorkingDir: "/workspace",
+				Env:        env,
+				Ports:      []containerPort{{ContainerPort: port}},
+				Resources:  &resources{Limits: limits, Requests: limits},
+				VolumeMounts: []volumeMount{
+					{Name: "runner", MountPath: "/sandkasten"},
+					{Name: "run", MountPath: "/run/sandkasten"},
+					{Name: "workspace", MountPath: "/workspace"},
+					{Name: "home", MountPath: "/home/sandbox"},
+					{Name: "tmp", MountPath: "/tmp"},
+					{Name: "identity", MountPath: "/etc/machine-id", SubPath: "machine-id", ReadOnly: true},
+				},
+				SecurityContext: noEscalation,
+				ReadinessProbe:  &probe{TCPSocket: &tcpSocketAction{Port: port}, PeriodSeconds: 1},
+			}},
+			Volumes: []volume{
+				{Name: "runner", EmptyDir: &emptyDir{}},
+				{Name: "run", EmptyDir: &emptyDir{Medium: "Memory"}},
+				{Name: "workspace", EmptyDir: &emptyDir{}},
+				{Name: "home", EmptyDir: &emptyDir{}},
+				{Name: "tmp", EmptyDir: &emptyDir{}},
+				{Name: "identity", DownwardAPI: &downwardAPISource{Items: []downwardAPIFile{{
+					Path:     "machine-id",
+					FieldRef: fieldSelect{FieldPath: "metadata.annotations['" + annotationMachineID + "']"},
+				}}}},
+			},
+		},
+	}
+}
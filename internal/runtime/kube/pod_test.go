@@ -0,0 +1,214 @@
+package kube
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+func testDriver(k config.KubernetesConfig, defaults config.Defaults) *Driver {
+	return &Driver{cfg: &config.Config{Kubernetes: k, Defaults: defaults}, key: []byte("0123456789abcdef0123456789abcdef")}
+}
+
+func envValue(env []envVar, name string) (envVar, bool) {
+	for _, e := range env {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return envVar{}, false
+}
+
+func TestSessionPod(t *testing.T) {
+	base := config.KubernetesConfig{RunnerImage: "runner:v1", RunnerPort: 7070}
+	tests := []struct {
+		name     string
+		k        func(*config.KubernetesConfig)
+		defaults config.Defaults
+		check    func(t *testing.T, p pod)
+	}{
+		{
+			name:     "limits and requests",
+			defaults: config.Defaults{CPULimit: 0.5, MemLimitMB: 512},
+			check: func(t *testing.T, p pod) {
+				want := map[string]string{"cpu": "0.5", "memory": "512Mi"}
+				assert.Equal(t, want, p.Spec.Containers[0].Resources.Limits)
+				assert.Equal(t, want, p.Spec.Containers[0].Resources.Requests)
+			},
+		},
+		{
+			name: "runner port",
+			k:    func(k *config.KubernetesConfig) { k.RunnerPort = 9000 },
+			check: func(t *testing.T, p pod) {
+				c := p.Spec.Containers[0]
+				assert.Equal(t, []containerPort{{ContainerPort: 9000}}, c.Ports)
+				assert.Equal(t, 9000, c.ReadinessProbe.TCPSocket.Port)
+				listen, ok := envValue(c.Env, "SANDKASTEN_RUNNER_LISTEN")
+				require.True(t, ok)
+				assert.Equal(t, ":9000", listen.Value)
+			},
+		},
+		{
+			name: "token from secret",
+			check: func(t *testing.T, p pod) {
+				token, ok := envValue(p.Spec.Containers[0].Env, "SANDKASTEN_RUNNER_TOKEN")
+				require.True(t, ok)
+				assert.Empty(t, token.Value)
+				require.NotNil(t, token.ValueFrom)
+				assert.Equal(t, &secretKeySelector{Name: "sk-abc123", Key: secretTokenKey}, token.ValueFrom.SecretKeyRef)
+			},
+		},
+		{
+			name:     "exec mode and shell",
+			defaults: config.Defaults{ExecMode: "direct", ShellPrefer: "sh"},
+			check: func(t *testing.T, p pod) {
+				mode, ok := envValue(p.Spec.Containers[0].Env, "SANDKASTEN_EXEC_MODE")
+				require.True(t, ok)
+				assert.Equal(t, "direct", mode.Value)
+				shell, ok := envValue(p.Spec.Containers[0].Env, "SANDKASTEN_SHELL_PREFER")
+				require.True(t, ok)
+				assert.Equal(t, "sh", shell.Value)
+			},
+		},
+		{
+			name: "no exec mode by default",
+			check: func(t *testing.T, p pod) {
+				_, ok := envValue(p.Spec.Containers[0].Env, "SANDKASTEN_EXEC_MODE")
+				assert.False(t, ok)
+				_, ok = envValue(p.Spec.Containers[0].Env, "SANDKASTEN_SHELL_PREFER")
+				assert.False(t, ok)
+			},
+		},
+		{
+			name:     "readonly rootfs",
+			defaults: config.Defaults{ReadonlyRootfs: true},
+			check: func(t *testing.T, p pod) {
+				assert.True(t, p.Spec.Containers[0].SecurityContext.ReadOnlyRootFilesystem)
+				assert.True(t, p.Spec.InitContainers[0].SecurityContext.ReadOnlyRootFilesystem)
+			},
+		},
+		{
+			name: "runtime class and node selector",
+			k: func(k *config.KubernetesConfig) {
+				k.RuntimeClass = "gvisor"
+				k.NodeSelector = map[string]string{"pool": "sandboxes"}
+			},
+			check: func(t *testing.T, p pod) {
+				assert.Equal(t, "gvisor", p.Spec.RuntimeClassName)
+				assert.Equal(t, map[string]string{"pool": "sandboxes"}, p.Spec.NodeSelector)
+			},
+		},
+		{
+			name: "identity and labels",
+			check: func(t *testing.T, p pod) {
+				assert.Equal(t, "sk-abc123", p.Metadata.Name)
+				assert.Equal(t, "host-1", p.Spec.Hostname)
+				assert.Equal(t, map[string]string{
+					labelManagedBy: managedBy,
+					labelSessionID: "ABC123",
+					labelImage:     "python",
+				}, p.Metadata.Labels)
+				assert.NotEmpty(t, p.Metadata.Annotations[annotationMachineID])
+			},
+		},
+		{
+			name: "locked down",
+			check: func(t *testing.T, p pod) {
+				assert.False(t, p.Spec.AutomountServiceAccountToken)
+				assert.False(t, p.Spec.EnableServiceLinks)
+				assert.Equal(t, "Never", p.Spec.RestartPolicy)
+				sec := p.Spec.SecurityContext
+				assert.Equal(t, int64(1000), sec.RunAsUser)
+				assert.True(t, sec.RunAsNonRoot)
+				assert.Equal(t, "RuntimeDefault", sec.Seccomp.Type)
+				for _, c := range append(p.Spec.InitContainers, p.Spec.Containers...) {
+					assert.False(t, c.SecurityContext.AllowPrivilegeEscalation, c.Name)
+					assert.Equal(t, []string{"ALL"}, c.SecurityContext.Capabilities.Drop, c.Name)
+				}
+			},
+		},
+		{
+			name: "images",
+			check: func(t *testing.T, p pod) {
+				assert.Equal(t, "runner:v1", p.Spec.InitContainers[0].Image)
+				assert.Equal(t, "python:3.12", p.Spec.Containers[0].Image)
+				assert.Equal(t, []string{"/sandkasten/runner"}, p.Spec.Containers[0].Command)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := base
+			if tt.k != nil {
+				tt.k(&k)
+			}
+			d := testDriver(k, tt.defaults)
+			tt.check(t, d.sessionPod("ABC123", "host-1", "python", "python:3.12"))
+		})
+	}
+}
+
+// TestSessionPodOmitsToken guards against the runner token ending up in the
+// pod spec, which anyone allowed to read pods can see.
+func TestSessionPodOmitsToken(t *testing.T) {
+	d := testDriver(config.KubernetesConfig{RunnerImage: "runner:v1", RunnerPort: 7070}, config.Defaults{})
+	data, err := json.Marshal(d.sessionPod("ABC123", "host-1", "python", "python:3.12"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), d.runnerToken("ABC123"))
+	assert.Contains(t, string(data), `{"name":"SANDKASTEN_RUNNER_TOKEN","valueFrom":{"secretKeyRef":{"name":"sk-abc123","key":"runner-token"}}}`)
+}
+
+func TestSessionSecret(t *testing.T) {
+	sec := sessionSecret("ABC123", "python", "tok")
+	data, err := json.Marshal(sec)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"apiVersion": "v1",
+		"kind": "Secret",
+		"metadata": {
+			"name": "sk-abc123",
+			"labels": {
+				"app.kubernetes.io/managed-by": "sandkasten",
+				"sandkasten.io/session-id": "ABC123",
+				"sandkasten.io/image": "python"
+			}
+		},
+		"type": "Opaque",
+		"stringData": {"runner-token": "tok"}
+	}`, string(data))
+}
+
+func TestPodStartFailure(t *testing.T) {
+	waiting := func(reason string) pod {
+		var p pod
+		cs := containerStatus{Name: "session"}
+		cs.State.Waiting = &struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}{Reason: reason, Message: "msg"}
+		p.Status.ContainerStatuses = []containerStatus{cs}
+		return p
+	}
+	tests := []struct {
+		name       string
+		pod        pod
+		wantReason string
+		wantPull   bool
+	}{
+		{name: "pending", pod: pod{Status: podStatus{Phase: "Pending"}}},
+		{name: "failed", pod: pod{Status: podStatus{Phase: "Failed"}}, wantReason: "pod failed"},
+		{name: "image pull", pod: waiting("ImagePullBackOff"), wantReason: "container session: ImagePullBackOff: msg", wantPull: true},
+		{name: "crash loop", pod: waiting("CrashLoopBackOff"), wantReason: "container session: CrashLoopBackOff: msg"},
+		{name: "container creating", pod: waiting("ContainerCreating")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantReason, tt.pod.startFailure())
+			assert.Equal(t, tt.wantPull, tt.pod.imagePullFailed())
+		})
+	}
+}
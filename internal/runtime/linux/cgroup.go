@@ -1,19 +1,25 @@
 //go:build linux
 
 // Cgroup v2 integration for resource limits. Each session gets its own cgroup under
-// /sys/fs/cgroup/sandkasten/<sessionID> with CPU, memory, and PIDs controllers.
+// <parent>/sandkasten/<sessionID> with CPU, memory, and PIDs controllers, where
+// <parent> is the daemon's own cgroup or host_protection.cgroup_parent.
 //
 // Example: With CPULimit=2.0, MemLimitMB=512, PidsLimit=100:
 //   - cpu.max: "200000 100000" (2 cores worth of quota per 100ms period)
 //   - memory.max: 536870912
 //   - memory.swap.max: 0 (no swap, prevents bypassing mem limit)
 //   - pids.max: 100
+//
+// CPUWeight and CPUBurstMs set cpu.weight and cpu.max.burst, the share of
+// contended cores and the quota a session may save up above cpu.max.
 package linux
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -26,12 +32,56 @@ type CgroupConfig struct {
 	CPULimit   float64 // CPU cores (e.g. 2.0 = 2 cores); 0 = unlimited
 	MemLimitMB int     // Memory limit in MiB; 0 = unlimited
 	PidsLimit  int     // Max processes; 0 = unlimited
+	CPUWeight  int     // cpu.weight (1-10000); 0 = kernel default (100)
+	CPUBurstMs int     // cpu.max.burst in ms; 0 = none
+}
+
+// cgroupParent is the configured cgroup session cgroups are nested under
+// (absolute path); "" = the daemon's own cgroup.
+var cgroupParent string
+
+// SetCgroupParent places session cgroups under parent instead of the daemon's
+// own cgroup: a systemd slice name (e.g. "sandbox.slice") or an absolute path
+// below /sys/fs/cgroup. The cgroup must exist; slices are not started here.
+// Returns the resolved path.
+func SetCgroupParent(parent string) (string, error) {
+	if parent == "" {
+		cgroupParent = ""
+		return "", nil
+	}
+	path := parent
+	if !filepath.IsAbs(parent) {
+		path = filepath.Join("/sys/fs/cgroup", sliceCgroupPath(parent))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cgroup parent %s: %w (start the slice first, e.g. systemctl start %s)", parent, err, filepath.Base(path))
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cgroup parent %s is not a directory", path)
+	}
+	cgroupParent = path
+	return path, nil
+}
+
+// sliceCgroupPath returns the cgroup path of a systemd slice relative to the
+// cgroup root: every dash starts a nested slice, so "a-b.slice" lives in
+// "a.slice/a-b.slice".
+func sliceCgroupPath(slice string) string {
+	name := strings.TrimSuffix(slice, ".slice")
+	parts := strings.Split(name, "-")
+	path := make([]string, 0, len(parts))
+	for i := range parts {
+		path = append(path, strings.Join(parts[:i+1], "-")+".slice")
+	}
+	return filepath.Join(path...)
 }
 
 var (
 	warnMemLimitNoDelegationOnce  sync.Once
 	warnPidsLimitNoDelegationOnce sync.Once
 	warnCPULimitNoDelegationOnce  sync.Once
+	warnCPUTuneNoDelegationOnce   sync.Once
 )
 
 // getCgroupPath returns the cgroup v2 root for this process (e.g. /sys/fs/cgroup or
@@ -54,10 +104,46 @@ func getCgroupPath() string {
 	return "/sys/fs/cgroup"
 }
 
+// sessionCgroupsPath returns the directory session cgroups are created in.
+func sessionCgroupsPath() string {
+	if cgroupParent != "" {
+		return filepath.Join(cgroupParent, "sandkasten")
+	}
+	return filepath.Join(getCgroupPath(), "sandkasten")
+}
+
 // CgroupPath returns the full path to a session's cgroup, e.g. /sys/fs/cgroup/sandkasten/<sessionID>.
 func CgroupPath(sessionID string) string {
-	base := getCgroupPath()
-	return filepath.Join(base, "sandkasten", sessionID)
+	return filepath.Join(sessionCgroupsPath(), sessionID)
+}
+
+// CheckCgroupDelegation checks that session cgroups can still be created
+// with limits: the cgroup they go in is writable and passes the cpu, memory
+// and pids controllers down. Before the first session, when that cgroup does
+// not exist yet, its parent must be writable and offer the controllers.
+func CheckCgroupDelegation() error {
+	dir, file := sessionCgroupsPath(), "cgroup.subtree_control"
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		dir, file = filepath.Dir(dir), "cgroup.controllers"
+	}
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		return fmt.Errorf("cgroup %s not writable: %w", dir, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file, err)
+	}
+	have := strings.Fields(string(data))
+	var missing []string
+	for _, c := range []string{"cpu", "memory", "pids"} {
+		if !slices.Contains(have, c) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s controllers missing from %s", strings.Join(missing, ", "), filepath.Join(dir, file))
+	}
+	return nil
 }
 
 // enableControllers propagates cpu, memory, pids controllers down the hierarchy to the session
@@ -91,8 +177,7 @@ func enableControllers(cgPath string) {
 // controllers, and applies limits. Returns the full cgroup path. The cgroup is empty until
 // AttachToCgroup is called.
 func CreateCgroup(sessionID string, cfg CgroupConfig) (string, error) {
-	basePath := getCgroupPath()
-	parentPath := filepath.Join(basePath, "sandkasten")
+	parentPath := sessionCgroupsPath()
 	if err := os.MkdirAll(parentPath, 0755); err != nil {
 		return "", fmt.Errorf("create parent cgroup %s: %w", parentPath, err)
 	}
@@ -155,9 +240,74 @@ func CreateCgroup(sessionID string, cfg CgroupConfig) (string, error) {
 		}
 	}
 
+	if err := SetCgroupCPU(cgPath, cfg.CPUWeight, cfg.CPUBurstMs); err != nil {
+		if !os.IsPermission(err) {
+			return "", err
+		}
+		warnCPUTuneNoDelegationOnce.Do(func() {
+			fmt.Fprintf(os.Stderr, "warning: cannot set cpu weight or burst (cgroup not delegated): %v\n", err)
+		})
+	}
+
 	return cgPath, nil
 }
 
+// SetCgroupCPU writes cpu.weight and cpu.max.burst (in microseconds) of a
+// cgroup; zero values are left alone. cpu.max.burst needs kernel 5.14+ and
+// must not exceed the cpu.max quota.
+func SetCgroupCPU(cgPath string, weight, burstMs int) error {
+	if weight > 0 {
+		if err := os.WriteFile(filepath.Join(cgPath, "cpu.weight"), []byte(strconv.Itoa(weight)), 0644); err != nil {
+			return fmt.Errorf("set cpu.weight: %w", err)
+		}
+	}
+	if burstMs > 0 {
+		err := os.WriteFile(filepath.Join(cgPath, "cpu.max.burst"), []byte(strconv.Itoa(burstMs*1000)), 0644)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("cpu.max.burst not supported (kernel 5.14+ required): %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("set cpu.max.burst: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReclaimCgroupMemory writes the cgroup's current usage to memory.reclaim
+// (kernel 5.19+), which reclaims as much of it as possible: page cache and,
+// with swap available, anonymous memory. Returns how far usage dropped.
+func ReclaimCgroupMemory(cgPath string) (int64, error) {
+	before, err := readCgroupInt(filepath.Join(cgPath, "memory.current"))
+	if err != nil {
+		return 0, err
+	}
+	// EAGAIN means less than the requested amount could be reclaimed.
+	err = os.WriteFile(filepath.Join(cgPath, "memory.reclaim"), []byte(strconv.FormatInt(before, 10)), 0644)
+	if err != nil && !errors.Is(err, unix.EAGAIN) {
+		if os.IsNotExist(err) {
+			return 0, fmt.Errorf("memory.reclaim not supported (kernel 5.19+ required): %w", err)
+		}
+		return 0, fmt.Errorf("write memory.reclaim: %w", err)
+	}
+	after, err := readCgroupInt(filepath.Join(cgPath, "memory.current"))
+	if err != nil {
+		return 0, err
+	}
+	return max(before-after, 0), nil
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	return n, nil
+}
+
 // AttachToCgroup moves the given PID into the cgroup by writing it to cgroup.procs.
 // All descendants of this process inherit the cgroup.
 func AttachToCgroup(cgPath string, pid int) error {
@@ -168,9 +318,22 @@ func AttachToCgroup(cgPath string, pid int) error {
 	return nil
 }
 
-// KillCgroupProcesses sends SIGKILL to all processes in the cgroup (read from cgroup.procs).
-// Used during Destroy to ensure no processes remain before removing the cgroup.
+// KillCgroupProcesses sends SIGKILL to all processes in the cgroup and its child cgroups
+// (nested-container sessions create those). Uses cgroup.kill where the kernel has it
+// (5.14+), otherwise reads cgroup.procs. Used during Destroy to ensure no processes
+// remain before removing the cgroup.
 func KillCgroupProcesses(cgPath string) error {
+	if err := os.WriteFile(filepath.Join(cgPath, "cgroup.kill"), []byte("1"), 0644); err == nil {
+		return nil
+	}
+	if entries, err := os.ReadDir(cgPath); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				_ = KillCgroupProcesses(filepath.Join(cgPath, e.Name()))
+			}
+		}
+	}
+
 	procsPath := filepath.Join(cgPath, "cgroup.procs")
 	data, err := os.ReadFile(procsPath)
 	if err != nil {
@@ -0,0 +1,92 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"golang.org/x/sys/unix"
+)
+
+// sharedChannelSource is the mount source of every shared channel tmpfs, so
+// /proc/mounts inside a session shows at a glance that /shared is shared.
+const sharedChannelSource = "sandkasten-shared"
+
+// MountSharedChannel mounts the channel's tmpfs under data_dir/channels on
+// first use and bind-mounts it at /shared in the session.
+func (d *Driver) MountSharedChannel(ctx context.Context, sessionID, channel string, sizeBytes int64) error {
+	if channel == "" || strings.ContainsAny(channel, `/\`) || strings.Contains(channel, "..") {
+		return fmt.Errorf("invalid shared channel %q", channel)
+	}
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	if state.InitPID <= 0 || state.Mnt == "" {
+		return fmt.Errorf("invalid session state for mount shared channel")
+	}
+
+	d.channelMu.Lock()
+	defer d.channelMu.Unlock()
+	src := d.sharedChannelDir(channel)
+	mounted, err := isMountPoint(src)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		if err := os.MkdirAll(src, 0700); err != nil {
+			return fmt.Errorf("mkdir shared channel %s: %w", src, err)
+		}
+		opts := fmt.Sprintf("size=%d,mode=0770,uid=1000,gid=1000", sizeBytes)
+		if err := unix.Mount(sharedChannelSource, src, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, opts); err != nil {
+			return fmt.Errorf("mount shared channel tmpfs %s: %w", src, err)
+		}
+	}
+	if err := d.bindIntoSession(ctx, state, src, runtime.SharedChannelPath); err != nil {
+		return fmt.Errorf("mount shared channel failed: %w", err)
+	}
+	return nil
+}
+
+// ReleaseSharedChannel unmounts the channel's tmpfs on the host. Sessions
+// still running keep their bind mount, so the memory is freed once the last
+// of them is gone.
+func (d *Driver) ReleaseSharedChannel(ctx context.Context, channel string) error {
+	d.channelMu.Lock()
+	defer d.channelMu.Unlock()
+	dir := d.sharedChannelDir(channel)
+	if mounted, _ := isMountPoint(dir); mounted {
+		if err := unix.Unmount(dir, unix.MNT_DETACH); err != nil {
+			return fmt.Errorf("unmount shared channel %s: %w", dir, err)
+		}
+	}
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove shared channel %s: %w", dir, err)
+	}
+	return nil
+}
+
+func (d *Driver) sharedChannelDir(channel string) string {
+	return filepath.Join(d.dataDir, "channels", channel)
+}
+
+// isMountPoint reports whether dir is the root of a mount, i.e. lives on a
+// different device than its parent. A missing dir is not a mount point.
+func isMountPoint(dir string) (bool, error) {
+	var st, parent unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if err := unix.Stat(filepath.Dir(dir), &parent); err != nil {
+		return false, fmt.Errorf("stat %s: %w", filepath.Dir(dir), err)
+	}
+	return st.Dev != parent.Dev, nil
+}
@@ -0,0 +1,225 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/failpoint"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// maxIdleRunnerConns is how many idle connections are kept per runner socket.
+const maxIdleRunnerConns = 4
+
+// errStaleConn marks a pooled connection the runner closed while it was idle.
+var errStaleConn = errors.New("stale runner connection")
+
+// runnerConn is a connection to a runner socket with its persistent reader.
+// Its first request asks the runner to switch to frames; runners that
+// predate them keep it on JSON lines.
+type runnerConn struct {
+	net.Conn
+	r          *bufio.Reader
+	negotiated bool // the switch to frames was asked for
+	framed     bool // and acknowledged
+}
+
+// runnerConnPool keeps idle connections to runner sockets so agents issuing many
+// small execs skip the dial per request. Keys are socket paths, which embed the
+// init PID and therefore change whenever a session is recreated.
+type runnerConnPool struct {
+	mu   sync.Mutex
+	idle map[string][]*runnerConn
+}
+
+func newRunnerConnPool() *runnerConnPool {
+	return &runnerConnPool{idle: make(map[string][]*runnerConn)}
+}
+
+// do sends req on a pooled or fresh connection and reads its response. A pooled
+// connection that turns out to be closed is discarded and the request is sent
+// once more on a fresh connection; runners that predate connection reuse close
+// after every response.
+func (p *runnerConnPool) do(sockPath string, req protocol.Request) (*protocol.Response, error) {
+	if c := p.get(sockPath); c != nil {
+		resp, err := roundTrip(c, req)
+		if err == nil {
+			p.put(sockPath, c)
+			return resp, nil
+		}
+		c.Close()
+		if !errors.Is(err, errStaleConn) {
+			return nil, err
+		}
+	}
+
+	c, err := dialRunner(sockPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := roundTrip(c, req)
+	if err != nil {
+		c.Close()
+		if errors.Is(err, errStaleConn) {
+			return nil, fmt.Errorf("no response from runner")
+		}
+		return nil, err
+	}
+	p.put(sockPath, c)
+	return resp, nil
+}
+
+func dialRunner(sockPath string) (*runnerConn, error) {
+	conn, err := dialRunnerSocket(sockPath)
+	if err != nil {
+		return nil, err
+	}
+	return &runnerConn{Conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func dialRunnerSocket(sockPath string) (net.Conn, error) {
+	if err := failpoint.Inject(failpoint.RunnerConnect); err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	// Prevent symlink hijack (Confused Deputy): if sockPath were a symlink, we might talk to a malicious socket.
+	if info, err := os.Lstat(sockPath); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("socket %s is a symlink, possible hijack attempt", sockPath)
+		}
+	}
+
+	conn, err := net.DialTimeout("unix", sockPath, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to runner: %w", err)
+	}
+	return conn, nil
+}
+
+// roundTrip writes one request and reads its response, as lines or frames
+// depending on what c negotiated. It returns errStaleConn when the
+// connection was closed before any response arrived.
+func roundTrip(c *runnerConn, req protocol.Request) (*protocol.Response, error) {
+	if !c.negotiated {
+		req.Framing = protocol.FramingLength
+	}
+	if err := writeRequest(c, req); err != nil {
+		if errors.Is(err, errMarshal) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: write request: %v", errStaleConn, err)
+	}
+
+	resp, err := readResponse(c)
+	if err != nil {
+		return nil, err
+	}
+	if !c.negotiated {
+		c.negotiated = true
+		c.framed = resp.Framing == protocol.FramingLength
+	}
+	if resp.ID != req.ID && resp.ID != "" {
+		return nil, fmt.Errorf("runner response id %q does not match request %q", resp.ID, req.ID)
+	}
+	return resp, nil
+}
+
+// errMarshal marks requests that could not be encoded; resending them on
+// another connection would not help.
+var errMarshal = errors.New("marshal request")
+
+func writeRequest(c *runnerConn, req protocol.Request) error {
+	if c.framed {
+		var buf bytes.Buffer
+		if err := protocol.WriteRequestFrame(&buf, req); err != nil {
+			return fmt.Errorf("%w: %v", errMarshal, err)
+		}
+		_, err := c.Write(buf.Bytes())
+		return err
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMarshal, err)
+	}
+	_, err = c.Write(append(reqJSON, '\n'))
+	return err
+}
+
+func readResponse(c *runnerConn) (*protocol.Response, error) {
+	if c.framed {
+		resp, err := protocol.ReadResponseFrame(c.r)
+		if err == io.EOF {
+			return nil, errStaleConn
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read response: %w", err)
+		}
+		return &resp, nil
+	}
+	line, err := protocol.ReadLine(c.r, protocol.MaxLineBytes)
+	if err == io.EOF {
+		return nil, errStaleConn
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (p *runnerConnPool) get(sockPath string) *runnerConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conns := p.idle[sockPath]
+	if len(conns) == 0 {
+		return nil
+	}
+	c := conns[len(conns)-1]
+	p.idle[sockPath] = conns[:len(conns)-1]
+	return c
+}
+
+func (p *runnerConnPool) put(sockPath string, c *runnerConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle[sockPath]) >= maxIdleRunnerConns {
+		c.Close()
+		return
+	}
+	p.idle[sockPath] = append(p.idle[sockPath], c)
+}
+
+// closeSocket drops all idle connections to sockPath (session destroyed).
+func (p *runnerConnPool) closeSocket(sockPath string) {
+	p.mu.Lock()
+	conns := p.idle[sockPath]
+	delete(p.idle, sockPath)
+	p.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (p *runnerConnPool) closeAll() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = make(map[string][]*runnerConn)
+	p.mu.Unlock()
+	for _, conns := range idle {
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+}
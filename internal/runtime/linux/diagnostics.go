@@ -0,0 +1,96 @@
+//go:build linux
+
+// Create failure diagnostics. nsinit reports its own failures only through
+// its log, which is deleted afterwards, so RunNsinit tags errors that carry
+// an errno with "[errno NAME]" and createError keeps the log tail, the launch
+// config and the errno in a runtime.CreateError for the session manager to
+// record.
+package linux
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"golang.org/x/sys/unix"
+)
+
+// logTailBytes is how much of the end of the nsinit log is kept.
+const logTailBytes = 4096
+
+var errnoTag = regexp.MustCompile(`\[errno ([A-Z0-9]+)\]`)
+
+// tagErrno appends the name of the errno in err, if any, in the form
+// createError looks for in the nsinit log.
+func tagErrno(err error) error {
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		if name := unix.ErrnoName(errno); name != "" {
+			return fmt.Errorf("%w [errno %s]", err, name)
+		}
+	}
+	return err
+}
+
+// createError wraps err from Create at stage. cfg and log are nil for
+// failures before nsinit was launched. The errno comes from err itself or,
+// for failures inside nsinit, from the last tag in the log.
+func createError(stage string, cfg *NsinitConfig, log []byte, err error) error {
+	var ce *runtime.CreateError
+	if errors.As(err, &ce) {
+		return err
+	}
+	ce = &runtime.CreateError{Stage: stage, Err: err}
+	if cfg != nil {
+		if data, e := json.Marshal(cfg); e == nil {
+			ce.Config = string(data)
+		}
+	}
+	if len(log) > logTailBytes {
+		log = log[len(log)-logTailBytes:]
+	}
+	ce.LogTail = string(log)
+
+	var errno unix.Errno
+	if errors.As(err, &errno) {
+		ce.Errno = unix.ErrnoName(errno)
+	} else if m := errnoTag.FindAllSubmatch(log, -1); len(m) > 0 {
+		ce.Errno = string(m[len(m)-1][1])
+	}
+	ce.Class = createFailureClass(stage, ce.Errno)
+	ce.Transient = transientCreateFailure(stage, ce.Errno)
+	return ce
+}
+
+// transientCreateFailure reports whether a failure at stage may pass on its
+// own: clone and unshare return EAGAIN while the namespaces of destroyed
+// sessions are still being freed, and cgroup directories race with removal.
+func transientCreateFailure(stage, errno string) bool {
+	switch stage {
+	case "launch", "start", "runner_socket":
+		return errno == "EAGAIN"
+	case "cgroup", "attach_cgroup":
+		return errno == "EAGAIN" || errno == "EBUSY" || errno == "ENOENT"
+	}
+	return false
+}
+
+// createFailureClass classifies a failure at stage. Cgroup failures count as
+// cgroup_permission only when the kernel refused access; others are "other".
+func createFailureClass(stage, errno string) string {
+	switch stage {
+	case "image":
+		return runtime.CreateFailureImageMissing
+	case "filesystem":
+		return runtime.CreateFailureOverlay
+	case "cgroup", "attach_cgroup":
+		if errno == "EPERM" || errno == "EACCES" || errno == "EROFS" {
+			return runtime.CreateFailureCgroupPermission
+		}
+	case "runner_socket":
+		return runtime.CreateFailureRunnerTimeout
+	}
+	return runtime.CreateFailureOther
+}
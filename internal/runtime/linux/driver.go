@@ -19,7 +19,6 @@
 package linux
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -28,6 +27,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -46,6 +46,10 @@ type Driver struct {
 	imageDir        string
 	logger          *slog.Logger
 	ensureNetworkMu sync.Map // sessionID -> *sync.Mutex, for per-session lazy network setup
+	conns           *runnerConnPool
+	runner          string // host runner bind-mounted into sessions; "" = runner layer
+	runnerDigest    runnerDigestCache
+	channelMu       sync.Mutex // serializes shared channel tmpfs setup and teardown
 }
 
 // NewDriver creates and initializes the Linux runtime driver. It runs preflight checks
@@ -62,11 +66,18 @@ func NewDriver(cfg *config.Config, logger *slog.Logger) (*Driver, error) {
 		return nil, fmt.Errorf("mount propagation check failed: %w", err)
 	}
 
+	if parent, err := SetCgroupParent(cfg.HostProtection.CgroupParent); err != nil {
+		return nil, err
+	} else if parent != "" {
+		logger.Info("session cgroups placed under configured parent", "cgroup", parent)
+	}
+
 	d := &Driver{
 		cfg:      cfg,
 		dataDir:  cfg.DataDir,
 		imageDir: filepath.Join(cfg.DataDir, "images"),
 		logger:   logger,
+		conns:    newRunnerConnPool(),
 	}
 
 	dirs := []string{
@@ -82,16 +93,51 @@ func NewDriver(cfg *config.Config, logger *slog.Logger) (*Driver, error) {
 		}
 	}
 
+	runner, err := hostRunner(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("runner injection %s: %w", cfg.Runner.Injection, err)
+	}
+	d.runner = runner
+
+	if cfg.Defaults.NetworkMode == "host" && cfg.Security.HostPorts.Enabled {
+		if err := validateHostPorts(cfg.Security.HostPorts); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.Defaults.NetworkMode == "bridge" {
+		if err := ConfigureBridge(BridgeConfig{
+			Subnet:     cfg.Network.Subnet,
+			Gateway:    cfg.Network.Gateway,
+			MTU:        cfg.Network.MTU,
+			IPv6Subnet: cfg.Network.IPv6Subnet,
+		}); err != nil {
+			return nil, err
+		}
 		if err := SetupHostBridge(); err != nil {
 			logger.Warn("failed to setup host bridge network, bridge mode may not work", "error", err)
 		}
+		d.restoreIPAllocations()
+	}
+
+	if len(cfg.Security.NestedContainers) > 0 {
+		if err := checkNestedIDRange(); err != nil {
+			return nil, err
+		}
+		d.restoreNestedIDs()
+	}
+
+	for _, c := range HostLimitChecks() {
+		if c.Status != "OK" && logger != nil {
+			logger.Warn("host limit may cap concurrent sessions", "limit", c.Name, "details", c.Details, "fix", c.Remediation)
+		}
 	}
 
 	return d, nil
 }
 
 func (d *Driver) Close() error {
+	d.conns.closeAll()
 	return nil
 }
 
@@ -99,48 +145,56 @@ func (d *Driver) Ping(ctx context.Context) error {
 	return DetectCgroupV2()
 }
 
+// CheckDeterminism implements runtime.DeterministicDriver. Pinning the clock
+// needs libfaketime on the host.
+func (d *Driver) CheckDeterminism(det *runtime.Determinism) error {
+	if det.Clock.IsZero() {
+		return nil
+	}
+	if d.cfg.Determinism.FakeTimeLib == "" {
+		return fmt.Errorf("pinning the clock needs determinism.faketime_lib")
+	}
+	if _, err := os.Stat(d.cfg.Determinism.FakeTimeLib); err != nil {
+		return fmt.Errorf("libfaketime: %w", err)
+	}
+	return nil
+}
+
 // Create builds a new sandbox session. Steps:
 //
 // 1. Resolve image lower layer(s): either from meta.json (layered) or image/rootfs (single)
 // 2. SetupFilesystem: overlay mount (lower+upper+work -> mnt), workspace bind, /run/sandkasten, /tmp tmpfs, minimal /dev
 // 3. Prepare /home/sandbox tmpfs and optional resolv.conf (deferred for bridge mode)
-// 4. Create cgroup and write limits (cpu.max, memory.max, pids.max)
+// 4. Create cgroup and write limits (cpu.max, memory.max, pids.max), concurrently with steps 2–3
 // 5. LaunchNsinit: re-exec daemon with CLONE_NEWNS|NEWPID|NEWUTS|NEWIPC|NEWUSER|NEWNET
 // 6. Attach init PID to cgroup
-// 7. Wait for runner socket, then write state.json
+// 7. Wait for runner socket (inotify on /run/sandkasten), then write state.json
 //
 // For bridge network mode, veth/bridge setup is deferred until first Exec (lazy network).
+// Nested-container sessions get a host ID block and an idmapped rootfs (see nested.go).
 func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	return d.create(ctx, opts, false)
+}
+
+// create builds the sandbox of Create. With keepUpper it reuses the upper
+// layer already in the session directory and keeps it on failure (Rebase).
+func (d *Driver) create(ctx context.Context, opts runtime.CreateOpts, keepUpper bool) (_ *runtime.SessionInfo, err error) {
+	defer func() {
+		if err != nil {
+			err = createError("setup", nil, nil, err)
+		}
+	}()
 	if d.logger != nil {
 		d.logger.Debug("runtime create session", "session_id", opts.SessionID, "image", opts.Image, "workspace_id", opts.WorkspaceID)
 	}
 	runnerUID := 1000
 	runnerGID := 1000
 
-	// Resolve lower dirs: layered images have meta.json with "layers" list (runner + base layers)
-	var lower string
-	metaPath := filepath.Join(d.imageDir, opts.Image, "meta.json")
-	if metaData, err := os.ReadFile(metaPath); err == nil {
-		var meta struct {
-			Layers []string `json:"layers"`
-		}
-		if err := json.Unmarshal(metaData, &meta); err == nil && len(meta.Layers) > 0 {
-			var lowerDirs []string
-			lowerDirs = append(lowerDirs, filepath.Join(d.dataDir, "layers", "runner", "rootfs"))
-			for i := len(meta.Layers) - 1; i >= 0; i-- {
-				lowerDirs = append(lowerDirs, filepath.Join(d.dataDir, "layers", meta.Layers[i], "rootfs"))
-			}
-			lower = strings.Join(lowerDirs, ":")
-		}
-	}
-
-	if lower == "" {
-		// Single-layer image: use image/rootfs as lower
-		lower = filepath.Join(d.imageDir, opts.Image, "rootfs")
-		if _, err := os.Stat(lower); os.IsNotExist(err) {
-			return nil, fmt.Errorf("image %s not found at %s", opts.Image, lower)
-		}
+	lowerDirs, imageDigest, err := d.imageLowerDirs(opts.Image)
+	if err != nil {
+		return nil, createError("image", nil, nil, err)
 	}
+	lower := strings.Join(lowerDirs, ":")
 
 	sessionDir := filepath.Join(d.dataDir, "sessions", opts.SessionID)
 	upper := filepath.Join(sessionDir, "upper")
@@ -158,88 +212,202 @@ func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.
 		}
 	}
 
+	// The cgroup does not depend on the rootfs, so create it while the overlay,
+	// tmpfs and /dev mounts are being set up.
+	type cgroupResult struct {
+		path string
+		err  error
+	}
+	cgCh := make(chan cgroupResult, 1)
+	go func() {
+		path, err := CreateCgroup(opts.SessionID, CgroupConfig{
+			CPULimit:   d.cfg.Defaults.CPULimit,
+			MemLimitMB: d.cfg.Defaults.MemLimitMB,
+			PidsLimit:  d.cfg.Defaults.PidsLimit,
+			CPUWeight:  d.cfg.Defaults.CPUWeight,
+			CPUBurstMs: d.cfg.Defaults.CPUBurstMs,
+		})
+		cgCh <- cgroupResult{path, err}
+	}()
+	fsStart := time.Now()
+	abortFS := func(mounted bool) {
+		if cg := <-cgCh; cg.err == nil {
+			_ = RemoveCgroup(opts.SessionID)
+		}
+		if mounted {
+			CleanupMounts(mnt)
+		}
+		d.cleanupSessionDir(sessionDir, keepUpper)
+	}
+
 	if err := SetupFilesystem(lower, upper, work, mnt, workspaceSrc, runnerUID, runnerGID); err != nil {
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("setup filesystem: %w", err)
+		abortFS(false)
+		return nil, createError("filesystem", nil, nil, fmt.Errorf("setup filesystem: %w", err))
 	}
 	// Prepare resolv.conf for all network modes except "none".
 	// This must happen before optional read-only remount so bridge mode works with
 	// readonly_rootfs enabled.
 	if d.cfg.Defaults.NetworkMode != "none" {
 		if err := EnsureResolvConf(mnt); err != nil {
-			CleanupMounts(mnt)
-			d.cleanupSessionDir(sessionDir)
+			abortFS(true)
 			return nil, fmt.Errorf("ensure resolv.conf: %w", err)
 		}
 	}
 
+	if err := WriteMachineID(mnt, runtime.MachineID(opts.SessionID)); err != nil {
+		abortFS(true)
+		return nil, fmt.Errorf("write machine-id: %w", err)
+	}
+
 	if err := os.MkdirAll(filepath.Join(mnt, ".oldroot"), 0700); err != nil {
-		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		abortFS(true)
 		return nil, fmt.Errorf("prepare .oldroot: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Join(mnt, "dev", "pts"), 0755); err != nil {
-		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		abortFS(true)
 		return nil, fmt.Errorf("prepare /dev/pts: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Join(mnt, "home", "sandbox"), 0755); err != nil {
-		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		abortFS(true)
 		return nil, fmt.Errorf("prepare /home/sandbox: %w", err)
 	}
 	if err := MountTmpfs(filepath.Join(mnt, "home", "sandbox"), 128*1024*1024); err != nil {
-		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		abortFS(true)
 		return nil, fmt.Errorf("mount tmpfs /home/sandbox: %w", err)
 	}
 	if err := os.Chown(filepath.Join(mnt, "home", "sandbox"), runnerUID, runnerGID); err != nil {
-		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		abortFS(true)
 		return nil, fmt.Errorf("chown /home/sandbox: %w", err)
 	}
+	// Mount point for a shared channel attached after start; it has to exist
+	// before the rootfs turns read-only.
+	if d.cfg.SharedChannels.Enabled {
+		if err := os.MkdirAll(filepath.Join(mnt, runtime.SharedChannelPath), 0755); err != nil {
+			abortFS(true)
+			return nil, fmt.Errorf("prepare %s: %w", runtime.SharedChannelPath, err)
+		}
+	}
+
+	if det := opts.Determinism; det != nil {
+		if err := SetupRandomFIFOs(mnt); err != nil {
+			abortFS(true)
+			return nil, fmt.Errorf("random devices: %w", err)
+		}
+		if !det.Clock.IsZero() {
+			if err := CopyHostFile(mnt, d.cfg.Determinism.FakeTimeLib, strings.TrimPrefix(runtime.FakeTimeLibPath, "/")); err != nil {
+				abortFS(true)
+				return nil, fmt.Errorf("copy libfaketime: %w", err)
+			}
+		}
+	}
+
+	if d.runner != "" {
+		if err := BindRunner(mnt, d.runner); err != nil {
+			abortFS(true)
+			return nil, fmt.Errorf("bind runner: %w", err)
+		}
+	}
+
+	nested := d.nestedFor(opts.Image)
+	var hostIDBase uint32
+	if nested {
+		if hostIDBase, err = allocateNestedIDs(opts.SessionID); err != nil {
+			abortFS(true)
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				releaseNestedIDs(opts.SessionID)
+			}
+		}()
+		if err := prepareNestedRootfs(mnt, runnerUID); err != nil {
+			abortFS(true)
+			return nil, fmt.Errorf("prepare nested containers: %w", err)
+		}
+		if err := idmapRootfs(sessionDir, mnt, lowerDirs, hostIDBase); err != nil {
+			abortFS(true)
+			return nil, fmt.Errorf("idmap rootfs: %w", err)
+		}
+	}
 
 	if d.cfg.Defaults.ReadonlyRootfs {
 		if err := RemountReadOnly(mnt); err != nil {
-			CleanupMounts(mnt)
-			d.cleanupSessionDir(sessionDir)
+			abortFS(true)
 			return nil, fmt.Errorf("remount readonly rootfs: %w", err)
 		}
 	}
+	fsDur := time.Since(fsStart)
 
-	cgConfig := CgroupConfig{
-		CPULimit:   d.cfg.Defaults.CPULimit,
-		MemLimitMB: d.cfg.Defaults.MemLimitMB,
-		PidsLimit:  d.cfg.Defaults.PidsLimit,
-	}
-	cgPath, err := CreateCgroup(opts.SessionID, cgConfig)
-	if err != nil {
+	cg := <-cgCh
+	if cg.err != nil {
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("create cgroup: %w", err)
+		d.cleanupSessionDir(sessionDir, keepUpper)
+		return nil, createError("cgroup", nil, nil, fmt.Errorf("create cgroup: %w", cg.err))
 	}
+	cgPath := cg.path
+
+	if nested {
+		if err := delegateNestedCgroup(cgPath, hostIDBase); err != nil {
+			_ = RemoveCgroup(opts.SessionID)
+			CleanupMounts(mnt)
+			d.cleanupSessionDir(sessionDir, keepUpper)
+			return nil, err
+		}
+	}
+
+	if ranges, enforce, err := d.hostPortsFor(opts.Image); enforce {
+		if err == nil {
+			err = restrictHostPorts(cgPath, ranges)
+		}
+		if err != nil {
+			_ = RemoveCgroup(opts.SessionID)
+			CleanupMounts(mnt)
+			d.cleanupSessionDir(sessionDir, keepUpper)
+			return nil, fmt.Errorf("restrict host ports: %w", err)
+		}
+	}
+
+	// Watch the runner socket dir before launching so the socket's creation
+	// cannot be missed. The dir is the /run/sandkasten tmpfs mounted above,
+	// which the runner sees after pivot_root.
+	sockWatch, err := watchSocketDir(filepath.Join(mnt, "run", "sandkasten"))
+	if err != nil && d.logger != nil {
+		if limit := classifyInotifyLimit(err); limit != "" {
+			d.logger.Warn("inotify limit reached, polling for runner socket", "limit", limit, "error", err)
+		} else {
+			d.logger.Debug("inotify unavailable, polling for runner socket", "error", err)
+		}
+	}
+	defer sockWatch.Close()
 
 	nsConfig := NsinitConfig{
 		SessionID:   opts.SessionID,
+		Hostname:    runtime.Hostname(opts.SessionID, opts.Hostname),
 		Mnt:         mnt,
 		CgroupPath:  cgPath,
-		RunnerPath:  "/usr/local/bin/runner",
+		RunnerPath:  "/" + sandboxRunnerPath,
 		UID:         runnerUID,
 		GID:         runnerGID,
-		NoNewPrivs:  true,
+		NoNewPrivs:  !nested,
 		NetworkNone: d.cfg.Defaults.NetworkMode != "host",
 		Readonly:    d.cfg.Defaults.ReadonlyRootfs,
 		Seccomp:     d.cfg.Security.Seccomp,
+		Nested:      nested,
+		HostIDBase:  hostIDBase,
 		ShellPrefer: d.cfg.Defaults.ShellPrefer,
 		ExecMode:    d.cfg.Defaults.ExecMode,
 	}
+	if det := opts.Determinism; det != nil {
+		nsConfig.Env = det.Env()
+		nsConfig.RandomSeed = strconv.FormatInt(det.Seed, 10)
+	}
 
 	cmd, nsinitLog, err := LaunchNsinit(nsConfig)
 	if err != nil {
 		_ = RemoveCgroup(opts.SessionID)
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("launch nsinit: %w", err)
+		d.cleanupSessionDir(sessionDir, keepUpper)
+		return nil, createError("launch", &nsConfig, nil, fmt.Errorf("launch nsinit: %w", classifyHostLimit(err)))
 	}
 
 	if err := cmd.Start(); err != nil {
@@ -248,12 +416,18 @@ func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.
 		_ = os.Remove(nsinitLog.Name())
 		_ = RemoveCgroup(opts.SessionID)
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("start nsinit: %w (log: %s)", err, string(logContent))
+		d.cleanupSessionDir(sessionDir, keepUpper)
+		return nil, createError("start", &nsConfig, logContent, fmt.Errorf("start nsinit: %w (log: %s)", classifyHostLimit(err), string(logContent)))
 	}
 
 	initPid := cmd.Process.Pid
 
+	if adj := d.cfg.HostProtection.SessionOOMScoreAdj; adj != 0 {
+		if err := setOOMScoreAdj(initPid, adj); err != nil && d.logger != nil {
+			d.logger.Warn("session oom score not set", "session_id", opts.SessionID, "error", err)
+		}
+	}
+
 	// Lazy network: defer veth/bridge setup until first Exec when network_mode is bridge.
 	// Saves ~50–150ms at session create time.
 	if d.cfg.Defaults.NetworkMode == "bridge" {
@@ -267,20 +441,21 @@ func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.
 		_ = KillProcessForce(initPid)
 		_ = RemoveCgroup(opts.SessionID)
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("attach to cgroup: %w (log: %s)", err, string(logContent))
+		d.cleanupSessionDir(sessionDir, keepUpper)
+		return nil, createError("attach_cgroup", &nsConfig, logContent, fmt.Errorf("attach to cgroup: %w (log: %s)", err, string(logContent)))
 	}
 
 	runnerSock := fmt.Sprintf("/proc/%d/root/run/sandkasten/runner.sock", initPid)
-	if err := d.waitForSocket(ctx, runnerSock, 10*time.Second); err != nil {
+	sockStart := time.Now()
+	if err := d.waitForSocket(ctx, sockWatch, runnerSock, 10*time.Second); err != nil {
 		logContent, _ := os.ReadFile(nsinitLog.Name())
 		_ = nsinitLog.Close()
 		_ = os.Remove(nsinitLog.Name())
 		_ = KillProcessForce(initPid)
 		_ = RemoveCgroup(opts.SessionID)
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
-		return nil, fmt.Errorf("wait for runner socket: %w (nsinit log: %s)", err, string(logContent))
+		d.cleanupSessionDir(sessionDir, keepUpper)
+		return nil, createError("runner_socket", &nsConfig, logContent, fmt.Errorf("wait for runner socket: %w (nsinit log: %s)", err, string(logContent)))
 	}
 
 	_ = nsinitLog.Close()
@@ -292,25 +467,28 @@ func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.
 		CgroupPath: cgPath,
 		Mnt:        mnt,
 		RunnerSock: runnerSock,
+		HostIDBase: hostIDBase,
 	}
 	statePath := filepath.Join(sessionDir, "state.json")
 	if err := d.writeState(statePath, state); err != nil {
 		_ = KillProcessForce(initPid)
 		_ = RemoveCgroup(opts.SessionID)
 		CleanupMounts(mnt)
-		d.cleanupSessionDir(sessionDir)
+		d.cleanupSessionDir(sessionDir, keepUpper)
 		return nil, fmt.Errorf("write state: %w", err)
 	}
 
 	if d.logger != nil {
-		d.logger.Debug("runtime session created", "session_id", opts.SessionID, "init_pid", initPid)
+		d.logger.Debug("runtime session created", "session_id", opts.SessionID, "init_pid", initPid,
+			"fs_ms", fsDur.Milliseconds(), "socket_wait_ms", time.Since(sockStart).Milliseconds())
 	}
 	return &runtime.SessionInfo{
-		SessionID:  opts.SessionID,
-		InitPID:    initPid,
-		CgroupPath: cgPath,
-		Mnt:        mnt,
-		RunnerSock: runnerSock,
+		SessionID:   opts.SessionID,
+		InitPID:     initPid,
+		CgroupPath:  cgPath,
+		Mnt:         mnt,
+		RunnerSock:  runnerSock,
+		ImageDigest: imageDigest,
 	}, nil
 }
 
@@ -364,6 +542,13 @@ func (d *Driver) ensureNetwork(sessionID, statePath string, state *protocol.Sess
 	if err != nil {
 		return fmt.Errorf("allocate ip: %w", err)
 	}
+	// Record the address before it is configured so a daemon crash in between
+	// cannot hand it out twice after restart.
+	state.IP = ip
+	if err := d.writeState(statePath, *state); err != nil {
+		ReleaseIP(sessionID)
+		return fmt.Errorf("record ip: %w", err)
+	}
 	if err := SetupSessionNetwork(sessionID, state.InitPID, ip); err != nil {
 		ReleaseIP(sessionID)
 		return fmt.Errorf("setup session network: %w", err)
@@ -385,46 +570,55 @@ func (d *Driver) ensureNetwork(sessionID, statePath string, state *protocol.Sess
 	return nil
 }
 
-// execViaSocket connects to the runner's Unix socket, sends the JSON request, and reads
-// the JSON response. The socket path is typically /proc/<initPID>/root/run/sandkasten/runner.sock.
-func (d *Driver) execViaSocket(sockPath string, req protocol.Request) (*protocol.Response, error) {
-	// Prevent symlink hijack (Confused Deputy): if sockPath were a symlink, we might talk to a malicious socket.
-	if info, err := os.Lstat(sockPath); err == nil {
-		if info.Mode()&os.ModeSymlink != 0 {
-			return nil, fmt.Errorf("socket %s is a symlink, possible hijack attempt", sockPath)
-		}
-	}
-
-	conn, err := net.DialTimeout("unix", sockPath, 5*time.Second)
+// restoreIPAllocations rebuilds the in-memory IP table from the addresses
+// recorded in state.json. An address is only kept while its init process is
+// alive and its host veth still exists; otherwise nothing holds it anymore.
+func (d *Driver) restoreIPAllocations() {
+	ids, err := d.ListSessionDirIDs(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("connect to runner: %w", err)
+		d.logger.Warn("restore ip allocations: list sessions", "error", err)
+		return
+	}
+	restored, dropped := 0, 0
+	for _, id := range ids {
+		state, err := d.readState(filepath.Join(d.dataDir, "sessions", id, "state.json"))
+		if err != nil || state.IP == "" {
+			continue
+		}
+		running, _ := d.isProcessRunning(state.InitPID)
+		_, vethErr := net.InterfaceByName("skv_" + id[:min(8, len(id))])
+		if !running || vethErr != nil {
+			dropped++
+			continue
+		}
+		if err := ReserveIP(id, state.IP); err != nil {
+			d.logger.Warn("restore ip allocations: duplicate address", "session_id", id, "ip", state.IP, "error", err)
+			dropped++
+			continue
+		}
+		restored++
 	}
-	defer conn.Close()
-
-	reqJSON, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+	if restored > 0 || dropped > 0 {
+		d.logger.Info("restored ip allocations", "restored", restored, "dropped", dropped)
 	}
+}
 
-	if _, err := fmt.Fprintf(conn, "%s\n", reqJSON); err != nil {
-		return nil, fmt.Errorf("write request: %w", err)
+// execViaSocket sends the JSON request to the runner's Unix socket and reads the JSON
+// response, reusing pooled connections. The socket path is typically
+// /proc/<initPID>/root/run/sandkasten/runner.sock. Payloads of at least
+// runner.compress_min_bytes come back compressed and are unpacked here.
+func (d *Driver) execViaSocket(sockPath string, req protocol.Request) (*protocol.Response, error) {
+	if req.CompressMinBytes == 0 {
+		req.CompressMinBytes = d.cfg.Runner.CompressMinBytes
 	}
-
-	scanner := bufio.NewScanner(conn)
-	scanner.Buffer(make([]byte, protocol.MaxOutputBytes+4096), protocol.MaxOutputBytes+4096)
-	if !scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("read response: %w", err)
-		}
-		return nil, fmt.Errorf("no response from runner")
+	resp, err := d.conns.do(sockPath, req)
+	if err != nil {
+		return nil, err
 	}
-
-	var resp protocol.Response
-	if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	if err := protocol.DecompressResponse(resp); err != nil {
+		return nil, fmt.Errorf("runner response: %w", err)
 	}
-
-	return &resp, nil
+	return resp, nil
 }
 
 // Destroy tears down a session: release IP (bridge), kill init process, remove cgroup,
@@ -449,7 +643,19 @@ func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
 		return nil
 	}
 
+	d.stopSandbox(sessionID, state)
+	d.ensureNetworkMu.Delete(sessionID)
+	releaseNestedIDs(sessionID)
+	_ = os.RemoveAll(sessionDir)
+
+	return nil
+}
+
+// stopSandbox kills the processes of a session, removes its cgroup and
+// unmounts its rootfs. The session directory is left alone.
+func (d *Driver) stopSandbox(sessionID string, state *protocol.SessionState) {
 	if state.InitPID > 0 {
+		d.conns.closeSocket(fmt.Sprintf("/proc/%d/root/run/sandkasten/runner.sock", state.InitPID))
 		_ = KillProcess(state.InitPID)
 		time.Sleep(500 * time.Millisecond)
 
@@ -466,11 +672,6 @@ func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
 	if state.Mnt != "" {
 		CleanupMounts(state.Mnt)
 	}
-
-	d.ensureNetworkMu.Delete(sessionID)
-	_ = os.RemoveAll(sessionDir)
-
-	return nil
 }
 
 // IsRunning checks if the session's init PID is still alive via kill -0 semantics.
@@ -506,9 +707,33 @@ func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspace
 		return fmt.Errorf("chown workspace: %w", err)
 	}
 
+	if err := d.bindIntoSession(ctx, state, workspaceSrc, "/workspace"); err != nil {
+		return fmt.Errorf("mount workspace failed: %w", err)
+	}
+	return nil
+}
+
+// HostWorkspace returns the attached workspace directory, which pooled
+// sessions bind-mount inside their mount namespace only, or else /workspace
+// of the session's overlay.
+func (d *Driver) HostWorkspace(sessionID, workspaceID string) string {
+	if workspaceID != "" {
+		return filepath.Join(d.dataDir, "workspaces", workspaceID)
+	}
+	return filepath.Join(d.dataDir, "sessions", sessionID, "mnt", "workspace")
+}
+
+// bindIntoSession bind-mounts the host path src at dst inside the mount
+// namespace of the session. dst must exist. Nested-container sessions get an
+// idmapped bind instead (see bindIdmappedIntoSession).
+func (d *Driver) bindIntoSession(ctx context.Context, state *protocol.SessionState, src, dst string) error {
+	initPID := state.InitPID
+	if state.HostIDBase != 0 {
+		return bindIdmappedIntoSession(initPID, src, dst)
+	}
 	// Primary attempt: mount inside target mount+user namespace, destination path inside sandbox.
-	cmd := exec.CommandContext(ctx, "nsenter", "-t", fmt.Sprint(state.InitPID), "-m", "-U", "-r",
-		"mount", "--bind", workspaceSrc, "/workspace")
+	cmd := exec.CommandContext(ctx, "nsenter", "-t", fmt.Sprint(initPID), "-m", "-U", "-r",
+		"mount", "--bind", src, dst)
 	out, err := cmd.CombinedOutput()
 	if err == nil {
 		return nil
@@ -516,8 +741,8 @@ func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspace
 
 	// Fallback: mount from host namespace via target root path.
 	// This can work when source path resolution inside target ns is restricted.
-	procDst := fmt.Sprintf("/proc/%d/root/workspace", state.InitPID)
-	cmd2 := exec.CommandContext(ctx, "mount", "--bind", workspaceSrc, procDst)
+	procDst := fmt.Sprintf("/proc/%d/root%s", initPID, dst)
+	cmd2 := exec.CommandContext(ctx, "mount", "--bind", src, procDst)
 	out2, err2 := cmd2.CombinedOutput()
 	if err2 == nil {
 		return nil
@@ -525,19 +750,19 @@ func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspace
 
 	// Last resort for readonly rootfs: temporary rw remount inside target ns.
 	if d.cfg.Defaults.ReadonlyRootfs {
-		cmd3 := exec.CommandContext(ctx, "nsenter", "-t", fmt.Sprint(state.InitPID), "-m", "-U", "-r",
+		cmd3 := exec.CommandContext(ctx, "nsenter", "-t", fmt.Sprint(initPID), "-m", "-U", "-r",
 			"sh", "-lc",
-			"mount -o remount,rw / && mount --bind \"$1\" /workspace && mount -o remount,ro /",
-			"_", workspaceSrc,
+			"mount -o remount,rw / && mount --bind \"$1\" \"$2\" && mount -o remount,ro /",
+			"_", src, dst,
 		)
 		out3, err3 := cmd3.CombinedOutput()
 		if err3 == nil {
 			return nil
 		}
-		return fmt.Errorf("mount workspace failed: nsenter=%w (%s); host-proc=%w (%s); rw-fallback=%w (%s)", err, strings.TrimSpace(string(out)), err2, strings.TrimSpace(string(out2)), err3, strings.TrimSpace(string(out3)))
+		return fmt.Errorf("nsenter=%w (%s); host-proc=%w (%s); rw-fallback=%w (%s)", err, strings.TrimSpace(string(out)), err2, strings.TrimSpace(string(out2)), err3, strings.TrimSpace(string(out3)))
 	}
 
-	return fmt.Errorf("mount workspace failed: nsenter=%w (%s); host-proc=%w (%s)", err, strings.TrimSpace(string(out)), err2, strings.TrimSpace(string(out2)))
+	return fmt.Errorf("nsenter=%w (%s); host-proc=%w (%s)", err, strings.TrimSpace(string(out)), err2, strings.TrimSpace(string(out2)))
 }
 
 // ListSessionDirIDs returns session IDs that have a session directory on disk
@@ -560,7 +785,8 @@ func (d *Driver) ListSessionDirIDs(ctx context.Context) ([]string, error) {
 	return ids, nil
 }
 
-// Stats reads memory and CPU usage from the session's cgroup (memory.current, memory.max, cpu.stat).
+// Stats reads memory and CPU usage from the session's cgroup (memory.current,
+// memory.max, memory.peak, cpu.stat). memory.peak needs Linux 5.19.
 func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.SessionStats, error) {
 	statePath := filepath.Join(d.dataDir, "sessions", sessionID, "state.json")
 	state, err := d.readState(statePath)
@@ -579,6 +805,10 @@ func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.Session
 		fmt.Sscanf(string(data), "%d", &stats.MemoryBytes)
 	}
 
+	if data, err := os.ReadFile(filepath.Join(state.CgroupPath, "memory.peak")); err == nil {
+		fmt.Sscanf(string(data), "%d", &stats.MemoryPeak)
+	}
+
 	// Read memory limit
 	if data, err := os.ReadFile(filepath.Join(state.CgroupPath, "memory.max")); err == nil {
 		val := strings.TrimSpace(string(data))
@@ -598,9 +828,74 @@ func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.Session
 		}
 	}
 
+	// Count OOM kills
+	if data, err := os.ReadFile(filepath.Join(state.CgroupPath, "memory.events")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "oom_kill ") {
+				fmt.Sscanf(line, "oom_kill %d", &stats.OOMKills)
+				break
+			}
+		}
+	}
+
+	stats.CPUPressure = cgroupPressure(state.CgroupPath, "cpu.pressure")
+	stats.MemoryPressure = cgroupPressure(state.CgroupPath, "memory.pressure")
+	stats.IOPressure = cgroupPressure(state.CgroupPath, "io.pressure")
+
 	return stats, nil
 }
 
+// ReclaimMemory reclaims the session cgroup's memory; see ReclaimCgroupMemory.
+func (d *Driver) ReclaimMemory(ctx context.Context, sessionID string) (int64, error) {
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return 0, fmt.Errorf("read state: %w", err)
+	}
+	if state.CgroupPath == "" {
+		return 0, fmt.Errorf("no cgroup path for session")
+	}
+	return ReclaimCgroupMemory(state.CgroupPath)
+}
+
+// TuneCPU sets the session cgroup's CPU weight and burst; see SetCgroupCPU.
+func (d *Driver) TuneCPU(ctx context.Context, sessionID string, t runtime.CPUTuning) error {
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	if state.CgroupPath == "" {
+		return fmt.Errorf("no cgroup path for session")
+	}
+	return SetCgroupCPU(state.CgroupPath, t.Weight, t.BurstMs)
+}
+
+// DialPort connects to port inside the session through its runner. Proxy
+// connections bypass the pool: they turn into raw streams.
+func (d *Driver) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	conn, err := dialRunnerSocket(fmt.Sprintf("/proc/%d/root/run/sandkasten/runner.sock", state.InitPID))
+	if err != nil {
+		return nil, err
+	}
+	return runtime.OpenProxy(conn, port)
+}
+
+// Attach starts an interactive shell in the session through its runner.
+func (d *Driver) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	conn, err := dialRunnerSocket(fmt.Sprintf("/proc/%d/root/run/sandkasten/runner.sock", state.InitPID))
+	if err != nil {
+		return nil, err
+	}
+	return runtime.OpenTerminal(conn, opts)
+}
+
 func (d *Driver) isProcessRunning(pid int) (bool, error) {
 	if pid <= 0 {
 		return false, nil
@@ -619,7 +914,10 @@ func (d *Driver) isProcessRunning(pid int) (bool, error) {
 	return true, nil
 }
 
-func (d *Driver) waitForSocket(ctx context.Context, sockPath string, timeout time.Duration) error {
+// waitForSocket waits until sockPath exists. With a socket watch it wakes on
+// the inotify event; the periodic stat is a fallback and the only mechanism
+// when watch is nil.
+func (d *Driver) waitForSocket(ctx context.Context, watch *socketWatch, sockPath string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
 		select {
@@ -630,7 +928,13 @@ func (d *Driver) waitForSocket(ctx context.Context, sockPath string, timeout tim
 		if _, err := os.Stat(sockPath); err == nil {
 			return nil
 		}
-		time.Sleep(50 * time.Millisecond)
+		if watch == nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err := watch.wait(50 * time.Millisecond); err != nil {
+			return fmt.Errorf("watch socket %s: %w", sockPath, err)
+		}
 	}
 	return fmt.Errorf("timeout waiting for socket %s", sockPath)
 }
@@ -655,6 +959,22 @@ func (d *Driver) readState(path string) (*protocol.SessionState, error) {
 	return &state, nil
 }
 
-func (d *Driver) cleanupSessionDir(dir string) {
-	_ = os.RemoveAll(dir)
+// cleanupSessionDir removes a session directory; with keepUpper all of it
+// but the upper layer. The rootfs must be unmounted: mnt is only removed when
+// empty, so files of a still-mounted upper layer are never deleted through it.
+func (d *Driver) cleanupSessionDir(dir string, keepUpper bool) {
+	if !keepUpper {
+		_ = os.RemoveAll(dir)
+		return
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		switch e.Name() {
+		case "upper":
+		case "mnt":
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		default:
+			_ = os.RemoveAll(filepath.Join(dir, e.Name()))
+		}
+	}
 }
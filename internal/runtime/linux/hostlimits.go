@@ -0,0 +1,161 @@
+//go:build linux
+
+// Host limit awareness. Every session costs file descriptors, a set of
+// namespaces, inotify watches and PIDs; when one of these host-wide limits is
+// exhausted the kernel only reports EMFILE/ENOSPC/EAGAIN from clone or fork.
+// HostLimitChecks backs `sandkasten doctor` and the startup warnings, and
+// classifyHostLimit turns those errnos into a runtime.HostLimitError naming
+// the limit that was hit.
+package linux
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	limitNoFile         = "RLIMIT_NOFILE"
+	limitFileMax        = "fs.file-max"
+	limitUserNamespaces = "user.max_user_namespaces"
+	limitInotifyWatches = "fs.inotify.max_user_watches"
+	limitInotifyInsts   = "fs.inotify.max_user_instances"
+	limitPidMax         = "kernel.pid_max"
+	limitThreadsMax     = "kernel.threads-max"
+)
+
+// Recommended minimums. Below these a few dozen concurrent sessions can
+// exhaust the host.
+const (
+	minNoFile         = 65536
+	minUserNamespaces = 1024
+	minInotifyWatches = 8192
+	minPidMax         = 32768
+)
+
+// namespaceSysctls are the per-type namespace limits checked by clone for
+// the namespaces nsinit creates.
+var namespaceSysctls = []string{
+	limitUserNamespaces,
+	"user.max_mnt_namespaces",
+	"user.max_pid_namespaces",
+	"user.max_uts_namespaces",
+	"user.max_ipc_namespaces",
+	"user.max_net_namespaces",
+}
+
+// HostLimitCheck is the result of comparing one host limit against its
+// recommended minimum. Status is "OK", "WARN" or "FAIL"; Remediation says how
+// to raise a limit that is not OK.
+type HostLimitCheck struct {
+	Name        string
+	Status      string
+	Details     string
+	Remediation string
+}
+
+// readSysctl returns the integer value of a sysctl such as "kernel.pid_max",
+// or -1 if it cannot be read.
+func readSysctl(name string) int64 {
+	path := filepath.Join("/proc/sys", strings.ReplaceAll(name, ".", "/"))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// noFileLimit returns the hard RLIMIT_NOFILE of this process. The Go runtime
+// raises the soft limit to the hard limit at startup, so the hard limit is
+// what the daemon actually gets.
+func noFileLimit() int64 {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil {
+		return -1
+	}
+	if rl.Max > 1<<62 {
+		return 1 << 62
+	}
+	return int64(rl.Max)
+}
+
+// HostLimitChecks reports the fd, user namespace, inotify and PID limits of
+// the host. A zero user namespace limit makes sessions impossible and is a
+// FAIL; values under the recommended minimum are a WARN.
+func HostLimitChecks() []HostLimitCheck {
+	userns := hostLimitCheck("User namespaces", limitUserNamespaces, readSysctl(limitUserNamespaces), minUserNamespaces, "sysctl -w user.max_user_namespaces=15000")
+	if readSysctl(limitUserNamespaces) == 0 {
+		userns.Status = "FAIL"
+		userns.Details = fmt.Sprintf("%s = 0, sessions cannot start", limitUserNamespaces)
+	}
+	return []HostLimitCheck{
+		hostLimitCheck("File descriptors", limitNoFile, noFileLimit(), minNoFile, "raise LimitNOFILE in the service unit"),
+		userns,
+		hostLimitCheck("inotify watches", limitInotifyWatches, readSysctl(limitInotifyWatches), minInotifyWatches, "sysctl -w fs.inotify.max_user_watches=524288"),
+		hostLimitCheck("PID limit", limitPidMax, readSysctl(limitPidMax), minPidMax, "sysctl -w kernel.pid_max=4194304"),
+	}
+}
+
+func hostLimitCheck(title, name string, value, min int64, fix string) HostLimitCheck {
+	switch {
+	case value < 0:
+		return HostLimitCheck{Name: title, Status: "WARN", Details: fmt.Sprintf("cannot read %s", name), Remediation: fix}
+	case value < min:
+		return HostLimitCheck{Name: title, Status: "WARN", Details: fmt.Sprintf("%s = %d, recommended >= %d", name, value, min), Remediation: fix}
+	default:
+		return HostLimitCheck{Name: title, Status: "OK", Details: fmt.Sprintf("%s = %d", name, value)}
+	}
+}
+
+// classifyHostLimit maps the errno of a failed clone/fork of nsinit to the
+// host limit that caused it. Other errors are returned unchanged.
+func classifyHostLimit(err error) error {
+	var limit string
+	var value int64
+	switch {
+	case errors.Is(err, unix.EMFILE):
+		limit, value = limitNoFile, noFileLimit()
+	case errors.Is(err, unix.ENFILE):
+		limit, value = limitFileMax, readSysctl(limitFileMax)
+	case errors.Is(err, unix.ENOSPC):
+		// clone returns ENOSPC when any of the namespace limits is reached;
+		// name the first one that is exhausted outright, else user namespaces.
+		limit, value = limitUserNamespaces, readSysctl(limitUserNamespaces)
+		for _, name := range namespaceSysctls {
+			if v := readSysctl(name); v == 0 {
+				limit, value = name, v
+				break
+			}
+		}
+	case errors.Is(err, unix.EAGAIN):
+		limit, value = limitPidMax, readSysctl(limitPidMax)
+		if threads := readSysctl(limitThreadsMax); threads >= 0 && (value < 0 || threads < value) {
+			limit, value = limitThreadsMax, threads
+		}
+	default:
+		return err
+	}
+	return &runtime.HostLimitError{Limit: limit, Value: value, Err: err}
+}
+
+// classifyInotifyLimit names the inotify limit behind a failed watch setup,
+// or returns "" if err is not a limit error.
+func classifyInotifyLimit(err error) string {
+	switch {
+	case errors.Is(err, unix.ENOSPC):
+		return limitInotifyWatches
+	case errors.Is(err, unix.EMFILE):
+		return limitInotifyInsts
+	}
+	return ""
+}
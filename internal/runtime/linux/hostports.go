@@ -0,0 +1,198 @@
+//go:build linux
+
+// Host port allow list: in host network mode sandboxes share the host network
+// namespace and could bind any port. A cgroup BPF program attached to the
+// session cgroup (BPF_CGROUP_INET4_BIND / INET6_BIND) rejects bind() to ports
+// outside the allow list with EPERM. The program is attached before nsinit
+// starts and goes away with the cgroup. Port 0 (kernel-chosen) is always allowed.
+package linux
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// portRange is an inclusive range of ports.
+type portRange struct {
+	lo, hi uint16
+}
+
+// parsePortRanges parses entries like "8080" or "8000-8099".
+func parsePortRanges(entries []string) ([]portRange, error) {
+	ranges := make([]portRange, 0, len(entries))
+	for _, e := range entries {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(e), "-")
+		if !isRange {
+			hi = lo
+		}
+		l, err1 := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+		h, err2 := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+		if err1 != nil || err2 != nil || l == 0 || l > h {
+			return nil, fmt.Errorf("invalid port or range %q", e)
+		}
+		ranges = append(ranges, portRange{lo: uint16(l), hi: uint16(h)})
+	}
+	return ranges, nil
+}
+
+// hostPortsFor returns the allow list for image and whether enforcement applies.
+// A per-image list replaces the global one.
+func (d *Driver) hostPortsFor(image string) ([]portRange, bool, error) {
+	hp := d.cfg.Security.HostPorts
+	if d.cfg.Defaults.NetworkMode != "host" || !hp.Enabled {
+		return nil, false, nil
+	}
+	entries := hp.Allow
+	if img, ok := hp.Images[image]; ok {
+		entries = img
+	}
+	ranges, err := parsePortRanges(entries)
+	return ranges, true, err
+}
+
+// validateHostPorts checks the global and per-image allow lists up front so a
+// typo fails startup instead of every session create.
+func validateHostPorts(hp config.HostPortsConfig) error {
+	if _, err := parsePortRanges(hp.Allow); err != nil {
+		return fmt.Errorf("security.host_ports.allow: %w", err)
+	}
+	for image, entries := range hp.Images {
+		if _, err := parsePortRanges(entries); err != nil {
+			return fmt.Errorf("security.host_ports.images[%s]: %w", image, err)
+		}
+	}
+	return nil
+}
+
+// restrictHostPorts attaches bind filters for ranges to the cgroup at cgPath.
+func restrictHostPorts(cgPath string, ranges []portRange) error {
+	cgFD, err := unix.Open(cgPath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup: %w", err)
+	}
+	defer unix.Close(cgFD)
+
+	insns := bindFilterProgram(ranges)
+	for _, attachType := range []uint32{unix.BPF_CGROUP_INET4_BIND, unix.BPF_CGROUP_INET6_BIND} {
+		progFD, err := loadBindFilter(insns, attachType)
+		if err != nil {
+			return err
+		}
+		err = attachCgroupProgram(cgFD, progFD, attachType)
+		unix.Close(progFD)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bpfInsn is one eBPF instruction.
+type bpfInsn struct {
+	code uint8
+	regs uint8 // src<<4 | dst
+	off  int16
+	imm  int32
+}
+
+// bindFilterProgram returns a BPF_PROG_TYPE_CGROUP_SOCK_ADDR program that
+// returns 1 (allow) when bpf_sock_addr.user_port is 0 or inside ranges, else 0.
+func bindFilterProgram(ranges []portRange) []bpfInsn {
+	const (
+		userPortOff = 24 // offsetof(struct bpf_sock_addr, user_port)
+		r0, r1, r2  = 0, 1, 2
+	)
+	prog := []bpfInsn{
+		{code: unix.BPF_LDX | unix.BPF_MEM | unix.BPF_W, regs: r1<<4 | r2, off: userPortOff},
+		// user_port is in network byte order; convert to host order.
+		{code: unix.BPF_ALU | unix.BPF_END | unix.BPF_TO_BE, regs: r2, imm: 16},
+	}
+	// Jumps to "allow" are patched once its position is known.
+	var allowJumps []int
+	allowJumps = append(allowJumps, len(prog))
+	prog = append(prog, bpfInsn{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, regs: r2, imm: 0})
+	for _, r := range ranges {
+		prog = append(prog, bpfInsn{code: unix.BPF_JMP | unix.BPF_JLT | unix.BPF_K, regs: r2, off: 1, imm: int32(r.lo)})
+		allowJumps = append(allowJumps, len(prog))
+		prog = append(prog, bpfInsn{code: unix.BPF_JMP | unix.BPF_JLE | unix.BPF_K, regs: r2, imm: int32(r.hi)})
+	}
+	prog = append(prog,
+		bpfInsn{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, regs: r0, imm: 0},
+		bpfInsn{code: unix.BPF_JMP | unix.BPF_EXIT},
+	)
+	allow := len(prog)
+	prog = append(prog,
+		bpfInsn{code: unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K, regs: r0, imm: 1},
+		bpfInsn{code: unix.BPF_JMP | unix.BPF_EXIT},
+	)
+	for _, i := range allowJumps {
+		prog[i].off = int16(allow - i - 1)
+	}
+	return prog
+}
+
+// bpfProgLoadAttr is the BPF_PROG_LOAD prefix of union bpf_attr.
+type bpfProgLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	progName           [16]byte
+	progIfindex        uint32
+	expectedAttachType uint32
+}
+
+// bpfProgAttachAttr is the BPF_PROG_ATTACH prefix of union bpf_attr.
+type bpfProgAttachAttr struct {
+	targetFD    uint32
+	attachBpfFD uint32
+	attachType  uint32
+	attachFlags uint32
+}
+
+func loadBindFilter(insns []bpfInsn, attachType uint32) (int, error) {
+	license := []byte("GPL\x00")
+	logBuf := make([]byte, 4096)
+	attr := bpfProgLoadAttr{
+		progType:           unix.BPF_PROG_TYPE_CGROUP_SOCK_ADDR,
+		insnCnt:            uint32(len(insns)),
+		insns:              uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:            uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel:           1,
+		logSize:            uint32(len(logBuf)),
+		logBuf:             uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+		expectedAttachType: attachType,
+	}
+	copy(attr.progName[:], "sk_bind_ports")
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_LOAD, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	runtime.KeepAlive(logBuf)
+	if errno != 0 {
+		return -1, fmt.Errorf("load bind filter: %w (verifier: %s)", errno, strings.TrimRight(string(logBuf), "\x00"))
+	}
+	return int(fd), nil
+}
+
+func attachCgroupProgram(cgFD, progFD int, attachType uint32) error {
+	attr := bpfProgAttachAttr{
+		targetFD:    uint32(cgFD),
+		attachBpfFD: uint32(progFD),
+		attachType:  attachType,
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_BPF, unix.BPF_PROG_ATTACH, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr)); errno != 0 {
+		return fmt.Errorf("attach bind filter: %w", errno)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/elfcheck"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+)
+
+// imageTagsFile holds the tag table of the image store: "repo:tag" -> image name.
+// Tags let callers pin a stable reference (python:latest) while the image it
+// points to is replaced.
+const imageTagsFile = "tags.json"
+
+// ReadImageTags returns the tag table under dataDir (empty if none exists).
+func ReadImageTags(dataDir string) (map[string]string, error) {
+	tags := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(dataDir, "images", imageTagsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", imageTagsFile, err)
+	}
+	return tags, nil
+}
+
+// WriteImageTags replaces the tag table atomically, so a running daemon never
+// reads a partial file.
+func WriteImageTags(dataDir string, tags map[string]string) error {
+	data, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, "images", imageTagsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ResolveImageRef maps an image reference to an image name. "repo:tag" must be
+// in the tag table; a plain name is used as is when that image exists and
+// otherwise falls back to the "name:latest" tag.
+func ResolveImageRef(dataDir, ref string) (string, error) {
+	repo, _, tagged := strings.Cut(ref, ":")
+	if !tagged {
+		if _, err := os.Stat(filepath.Join(dataDir, "images", ref)); err == nil {
+			return ref, nil
+		}
+	}
+	tags, err := ReadImageTags(dataDir)
+	if err != nil {
+		return "", err
+	}
+	if !tagged {
+		if image, ok := tags[repo+":latest"]; ok {
+			return image, nil
+		}
+		return ref, nil
+	}
+	image, ok := tags[ref]
+	if !ok {
+		return "", fmt.Errorf("unknown image tag %s", ref)
+	}
+	return image, nil
+}
+
+// ResolveImage maps an image reference ("python", "python:3.12") to the name
+// of an image in the store.
+func (d *Driver) ResolveImage(ctx context.Context, ref string) (string, error) {
+	return ResolveImageRef(d.dataDir, ref)
+}
+
+// imageLowerDirs returns the overlay lower dirs of image, topmost first, and
+// the digest recorded in its meta.json ("" for images without one). Both come
+// from a single read so they match even while the image is being refreshed.
+func (d *Driver) imageLowerDirs(image string) ([]string, string, error) {
+	metaPath := filepath.Join(d.imageDir, image, "meta.json")
+	digest := ""
+	if metaData, err := os.ReadFile(metaPath); err == nil {
+		var meta struct {
+			Hash   string   `json:"hash"`
+			Layers []string `json:"layers"`
+		}
+		if err := json.Unmarshal(metaData, &meta); err == nil {
+			digest = meta.Hash
+			if len(meta.Layers) > 0 {
+				var lowerDirs []string
+				if d.runner == "" {
+					lowerDirs = append(lowerDirs, filepath.Join(d.dataDir, "layers", "runner", "rootfs"))
+				}
+				for i := len(meta.Layers) - 1; i >= 0; i-- {
+					lowerDirs = append(lowerDirs, filepath.Join(d.dataDir, "layers", meta.Layers[i], "rootfs"))
+				}
+				return lowerDirs, digest, nil
+			}
+		}
+	}
+
+	// Single-layer image: use image/rootfs as lower
+	lower := filepath.Join(d.imageDir, image, "rootfs")
+	if _, err := os.Stat(lower); os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("image %s not found at %s", image, lower)
+	}
+	return []string{lower}, digest, nil
+}
+
+// ImageDigest returns the digest of the current version of image (a name),
+// or "" when the image has no recorded digest.
+func (d *Driver) ImageDigest(ctx context.Context, image string) (string, error) {
+	_, digest, err := d.imageLowerDirs(image)
+	return digest, err
+}
+
+// ImageScan returns the report of `sandkasten image scan` for image (a name).
+// A report of an older version, e.g. from before an image refresh, is
+// ignored.
+func (d *Driver) ImageScan(ctx context.Context, image string) (*imagescan.Report, error) {
+	_, digest, err := d.imageLowerDirs(image)
+	if err != nil {
+		return nil, err
+	}
+	r, err := imagescan.Read(filepath.Join(d.imageDir, image))
+	if err != nil || r == nil || r.ImageDigest != digest {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ValidateImage checks that image (a name or tag) can boot a session without
+// mounting it: all layers are present, the runner is a static executable for
+// the host and /bin/sh exists, matches the host architecture and has its loader.
+func (d *Driver) ValidateImage(ctx context.Context, image string) error {
+	image, err := d.ResolveImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	lowerDirs, _, err := d.imageLowerDirs(image)
+	if err != nil {
+		return err
+	}
+	for _, dir := range lowerDirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("missing layer %s", dir)
+		}
+	}
+
+	// A bind-mounted runner was checked once at startup.
+	if d.runner == "" {
+		runner, err := lookupLayered(lowerDirs, sandboxRunnerPath)
+		if err != nil {
+			return fmt.Errorf("runner not found: %w", err)
+		}
+		if info, err := os.Stat(runner); err != nil || info.Mode()&0o111 == 0 || !info.Mode().IsRegular() {
+			return fmt.Errorf("runner %s is not an executable file", runner)
+		}
+		if err := elfcheck.CheckRunner(runner); err != nil {
+			return err
+		}
+	}
+
+	// /bin/sh is usually a symlink (e.g. to busybox or dash) into the same
+	// rootfs; it must run on this host and find its loader in the image.
+	if _, err := elfcheck.Resolve(lowerDirs, "/bin/sh"); err != nil {
+		return fmt.Errorf("/bin/sh not found: %w", err)
+	}
+	return elfcheck.CheckExecutable(lowerDirs, "/bin/sh")
+}
+
+// lookupLayered returns the path of rel in the topmost layer that has it.
+func lookupLayered(lowerDirs []string, rel string) (string, error) {
+	for _, dir := range lowerDirs {
+		p := filepath.Join(dir, rel)
+		if _, err := os.Lstat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", os.ErrNotExist
+}
@@ -32,6 +32,16 @@ func MountOverlay(lower, upper, work, mnt string) error {
 	return nil
 }
 
+// MountOverlayReadOnly merges the lower dirs (colon-separated, topmost first)
+// read-only at mnt, e.g. to inspect an image without starting a session.
+// overlayfs needs at least two lower dirs without an upper dir.
+func MountOverlayReadOnly(lower, mnt string) error {
+	if err := unix.Mount("overlay", mnt, "overlay", unix.MS_RDONLY, "lowerdir="+lower); err != nil {
+		return fmt.Errorf("mount overlay %s: %w", mnt, err)
+	}
+	return nil
+}
+
 // BindMount makes dst a mirror of src. recursive=true uses MS_REC for directory trees.
 func BindMount(src, dst string, recursive bool) error {
 	flags := unix.MS_BIND
@@ -242,6 +252,28 @@ func CopyHostFile(mnt, hostPath, relPath string) error {
 	return nil
 }
 
+// WriteMachineID writes id to mnt/etc/machine-id. A symlink there (e.g. to
+// /var/lib/dbus/machine-id) is replaced rather than followed.
+func WriteMachineID(mnt, id string) error {
+	dst := filepath.Join(mnt, "etc", "machine-id")
+	if err := MkdirAll(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(dst); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(dst); err != nil {
+				return fmt.Errorf("remove symlink %s: %w", dst, err)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("lstat %s: %w", dst, err)
+	}
+	if err := os.WriteFile(dst, []byte(id+"\n"), 0444); err != nil {
+		return fmt.Errorf("write file %s: %w", dst, err)
+	}
+	return nil
+}
+
 // EnsureResolvConf ensures mnt/etc/resolv.conf exists and contains at least one non-loopback nameserver.
 // If missing, writes fallback (1.1.1.1, 8.8.8.8). If host resolv has only loopback (127.0.0.x),
 // replaces with public resolvers since loopback is unreachable from sandbox net ns.
@@ -293,6 +325,24 @@ func EnsureResolvConf(mnt string) error {
 	return nil
 }
 
+// SetupRandomFIFOs replaces /dev/urandom and /dev/random of a deterministic
+// session with FIFOs, which the runner feeds from a seeded stream.
+func SetupRandomFIFOs(mnt string) error {
+	for _, name := range []string{"urandom", "random"} {
+		dev := filepath.Join(mnt, "dev", name)
+		if err := os.Remove(dev); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", dev, err)
+		}
+		if err := unix.Mkfifo(dev, 0666); err != nil {
+			return fmt.Errorf("mkfifo %s: %w", dev, err)
+		}
+		if err := os.Chmod(dev, 0666); err != nil {
+			return fmt.Errorf("chmod %s: %w", dev, err)
+		}
+	}
+	return nil
+}
+
 // SetupFilesystem builds the sandbox rootfs: overlay mount, resolv/hosts, workspace bind,
 // dedicated /run/sandkasten tmpfs (runner socket dir), /tmp tmpfs, and minimal /dev.
 func SetupFilesystem(lower, upper, work, mnt, workspaceSrc string, runUID, runGID int) error {
@@ -330,7 +380,9 @@ func SetupFilesystem(lower, upper, work, mnt, workspaceSrc string, runUID, runGI
 	if err := MkdirAll(runDst); err != nil {
 		return err
 	}
-	if err := MountTmpfs(runDst, 8*1024*1024); err != nil {
+	// Room for the socket and a runner binary staged by a self-update
+	// (see EnsureRunner) next to the one running.
+	if err := MountTmpfs(runDst, 32*1024*1024); err != nil {
 		return err
 	}
 	if err := os.Chown(runDst, runUID, runGID); err != nil {
@@ -0,0 +1,551 @@
+//go:build linux
+
+// Nested containers: sessions of images listed in security.nested_containers
+// can run rootless podman/buildah. Compared to a regular session they
+//   - run in a user namespace mapped to a block of unprivileged host IDs of
+//     their own instead of host root (see allocateNestedIDs); the rootfs
+//     layers, workspace and tmpfs mounts are idmapped into that block, so
+//     files keep their usual owners on disk;
+//   - keep the capabilities a container runtime needs in the bounding set and
+//     skip no_new_privs, so setuid newuidmap/newgidmap work;
+//   - get a seccomp filter that allows mount, pivot_root, keyctl, setns and unshare;
+//   - map an extra subordinate ID range, listed in /etc/subuid and /etc/subgid;
+//   - get /dev/fuse and /dev/net/tun (fuse-overlayfs, pasta/slirp4netns);
+//   - run in their own cgroup namespace with the session cgroup delegated to
+//     the sandbox user: the runner moves to <cgroup>/init and the session
+//     cgroup's limits still cap everything the nested containers start.
+//
+// Capabilities, setuid binaries and the relaxed syscalls therefore only act
+// on the session's own ID block; files of host root and other sessions are
+// unmapped there.
+package linux
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// nestedSubIDStart and nestedSubIDCount are the subordinate UID/GID range
+	// granted to the sandbox user for nested user namespaces, as seen inside
+	// the session.
+	nestedSubIDStart = 100000
+	nestedSubIDCount = 65536
+
+	// Each nested session maps its IDs 0-65535 and the subordinate range to a
+	// block of nestedIDBlock host IDs. The blocks start at nestedHostIDStart,
+	// above the ranges useradd and systemd-nspawn hand out, and there are
+	// nestedHostIDBlocks of them.
+	nestedIDBlock      = 65536 + nestedSubIDCount
+	nestedHostIDStart  = 0x70000000
+	nestedHostIDBlocks = 1024
+)
+
+var (
+	nestedIDsMu sync.Mutex
+	nestedIDs   = map[string]uint32{} // session ID -> first host ID of its block
+)
+
+// nestedCaps stay in the bounding set of nested-container sessions.
+var nestedCaps = []uintptr{
+	unix.CAP_SYS_ADMIN,
+	unix.CAP_SYS_CHROOT,
+	unix.CAP_SETUID,
+	unix.CAP_SETGID,
+	unix.CAP_SETPCAP,
+	unix.CAP_DAC_OVERRIDE,
+	unix.CAP_FOWNER,
+	unix.CAP_FSETID,
+	unix.CAP_KILL,
+	unix.CAP_MKNOD,
+	unix.CAP_NET_BIND_SERVICE,
+}
+
+// nestedFor reports whether sessions of image may run nested containers.
+func (d *Driver) nestedFor(image string) bool {
+	return slices.Contains(d.cfg.Security.NestedContainers, image)
+}
+
+// allocateNestedIDs assigns the session a block of host IDs no other session
+// holds. Returns an error only if every block is in use.
+func allocateNestedIDs(sessionID string) (uint32, error) {
+	nestedIDsMu.Lock()
+	defer nestedIDsMu.Unlock()
+	if base, ok := nestedIDs[sessionID]; ok {
+		return base, nil
+	}
+	used := make(map[uint32]bool, len(nestedIDs))
+	for _, base := range nestedIDs {
+		used[base] = true
+	}
+	for i := range uint32(nestedHostIDBlocks) {
+		base := nestedHostIDStart + i*nestedIDBlock
+		if !used[base] {
+			nestedIDs[sessionID] = base
+			return base, nil
+		}
+	}
+	return 0, fmt.Errorf("all %d nested-container ID blocks in use", nestedHostIDBlocks)
+}
+
+// reserveNestedIDs marks base as held by sessionID, e.g. when restoring
+// allocations after a restart. It fails if another session holds the block.
+func reserveNestedIDs(sessionID string, base uint32) error {
+	nestedIDsMu.Lock()
+	defer nestedIDsMu.Unlock()
+	if base < nestedHostIDStart || (base-nestedHostIDStart)%nestedIDBlock != 0 || (base-nestedHostIDStart)/nestedIDBlock >= nestedHostIDBlocks {
+		return fmt.Errorf("host id %d is not a nested-container ID block", base)
+	}
+	for id, b := range nestedIDs {
+		if b == base && id != sessionID {
+			return fmt.Errorf("host id block %d already allocated", base)
+		}
+	}
+	nestedIDs[sessionID] = base
+	return nil
+}
+
+// releaseNestedIDs returns the session's block. Idempotent.
+func releaseNestedIDs(sessionID string) {
+	nestedIDsMu.Lock()
+	defer nestedIDsMu.Unlock()
+	delete(nestedIDs, sessionID)
+}
+
+// nestedIDMappings maps the IDs of a nested session, including the
+// subordinate range, to the host block at base.
+func nestedIDMappings(base uint32) []syscall.SysProcIDMap {
+	return []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: int(base), Size: 65536},
+		{ContainerID: nestedSubIDStart, HostID: int(base) + 65536, Size: nestedSubIDCount},
+	}
+}
+
+// checkNestedIDRange fails if a host user's subordinate IDs in /etc/subuid or
+// /etc/subgid overlap the blocks nested sessions are mapped to.
+func checkNestedIDRange() error {
+	lo, hi := uint64(nestedHostIDStart), uint64(nestedHostIDStart)+nestedHostIDBlocks*nestedIDBlock
+	for _, path := range []string{"/etc/subuid", "/etc/subgid"} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Split(strings.TrimSpace(sc.Text()), ":")
+			if len(fields) != 3 {
+				continue
+			}
+			start, err1 := strconv.ParseUint(fields[1], 10, 32)
+			count, err2 := strconv.ParseUint(fields[2], 10, 32)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			if start < hi && start+count > lo {
+				f.Close()
+				return fmt.Errorf("%s: range of %s (%d-%d) overlaps the host IDs of nested-container sessions (%d-%d)", path, fields[0], start, start+count-1, lo, hi-1)
+			}
+		}
+		err = sc.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// restoreNestedIDs rebuilds the in-memory ID block table from the blocks
+// recorded in state.json of sessions whose init process is still alive.
+func (d *Driver) restoreNestedIDs() {
+	ids, err := d.ListSessionDirIDs(context.Background())
+	if err != nil {
+		d.logger.Warn("restore nested id blocks: list sessions", "error", err)
+		return
+	}
+	for _, id := range ids {
+		state, err := d.readState(filepath.Join(d.dataDir, "sessions", id, "state.json"))
+		if err != nil || state.HostIDBase == 0 {
+			continue
+		}
+		if running, _ := d.isProcessRunning(state.InitPID); !running {
+			continue
+		}
+		if err := reserveNestedIDs(id, state.HostIDBase); err != nil {
+			d.logger.Warn("restore nested id blocks", "session_id", id, "error", err)
+		}
+	}
+}
+
+// nestedUserns returns a user namespace mapped like a nested session at base,
+// for idmapped mounts. It is held by a short-lived nsinit process in holder
+// mode (see RunNsinit); the returned fd keeps it alive after that exits.
+func nestedUserns(base uint32) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return -1, fmt.Errorf("get executable path: %w", err)
+	}
+	cmd := exec.Command(self)
+	cmd.Env = append(os.Environ(), EnvNsinit+"="+nsinitHoldUserns)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: nestedIDMappings(base),
+		GidMappings: nestedIDMappings(base),
+	}
+	hold, err := cmd.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("start user namespace holder: %w", err)
+	}
+	fd, err := unix.Open(fmt.Sprintf("/proc/%d/ns/user", cmd.Process.Pid), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	hold.Close()
+	_ = cmd.Wait()
+	if err != nil {
+		return -1, fmt.Errorf("open user namespace: %w", err)
+	}
+	return fd, nil
+}
+
+// idmappedClone returns a detached copy of the mount tree at src whose IDs are
+// mapped through userns. Trees with a filesystem that cannot be idmapped fail
+// with EINVAL.
+func idmappedClone(src string, userns int, recursive bool) (int, error) {
+	flags := unix.OPEN_TREE_CLONE | unix.OPEN_TREE_CLOEXEC
+	setFlags := unix.AT_EMPTY_PATH
+	if recursive {
+		flags |= unix.AT_RECURSIVE
+		setFlags |= unix.AT_RECURSIVE
+	}
+	tree, err := unix.OpenTree(unix.AT_FDCWD, src, uint(flags))
+	if err != nil {
+		return -1, fmt.Errorf("clone mount %s: %w", src, err)
+	}
+	attr := unix.MountAttr{Attr_set: unix.MOUNT_ATTR_IDMAP, Userns_fd: uint64(userns)}
+	if err := unix.MountSetattr(tree, "", uint(setFlags), &attr); err != nil {
+		unix.Close(tree)
+		return -1, fmt.Errorf("idmap mount %s: %w", src, err)
+	}
+	return tree, nil
+}
+
+// idmapRootfs remounts the prepared rootfs at mnt for a nested session with
+// host IDs at base. overlayfs cannot be idmapped itself, so the overlay is
+// mounted again from idmapped views of its layers; the mounts on top of it
+// (workspace, tmpfs, /dev, ...) are moved over as idmapped clones where their
+// filesystem allows it. Files the daemon created while preparing the rootfs
+// are owned by host root on disk and show up as the session's root.
+func idmapRootfs(sessionDir, mnt string, lowerDirs []string, base uint32) error {
+	userns, err := nestedUserns(base)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(userns)
+
+	subs, err := childMounts(mnt)
+	if err != nil {
+		return err
+	}
+	trees := make([]int, len(subs))
+	defer func() {
+		for _, t := range trees {
+			if t > 0 {
+				unix.Close(t)
+			}
+		}
+	}()
+	for i, sub := range subs {
+		tree, err := idmappedClone(sub, userns, true)
+		if errors.Is(err, unix.EINVAL) {
+			tree, err = unix.OpenTree(unix.AT_FDCWD, sub, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC|unix.AT_RECURSIVE)
+		}
+		if err != nil {
+			return fmt.Errorf("clone mount %s: %w", sub, err)
+		}
+		trees[i] = tree
+	}
+
+	// The layers are attached below sessionDir/idmap while the overlay is
+	// mounted; overlayfs keeps private clones, so they are detached again.
+	layerDir := filepath.Join(sessionDir, "idmap")
+	defer func() {
+		if entries, err := os.ReadDir(layerDir); err == nil {
+			for _, e := range entries {
+				_ = unix.Unmount(filepath.Join(layerDir, e.Name()), unix.MNT_DETACH)
+			}
+		}
+		_ = os.RemoveAll(layerDir)
+	}()
+	attach := func(src, name string) (string, error) {
+		dst := filepath.Join(layerDir, name)
+		if err := os.MkdirAll(dst, 0700); err != nil {
+			return "", err
+		}
+		tree, err := idmappedClone(src, userns, false)
+		if err != nil {
+			return "", err
+		}
+		defer unix.Close(tree)
+		if err := unix.MoveMount(tree, "", unix.AT_FDCWD, dst, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+			return "", fmt.Errorf("attach %s: %w", dst, err)
+		}
+		return dst, nil
+	}
+	lower := make([]string, len(lowerDirs))
+	for i, dir := range lowerDirs {
+		if lower[i], err = attach(dir, "l"+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+	// upper and work have to be on the same mount.
+	session, err := attach(sessionDir, "session")
+	if err != nil {
+		return err
+	}
+
+	CleanupMounts(mnt)
+	if err := mountOverlayAs(strings.Join(lower, ":"), filepath.Join(session, "upper"), filepath.Join(session, "work"), mnt, base); err != nil {
+		return err
+	}
+	for i, sub := range subs {
+		if err := unix.MoveMount(trees[i], "", unix.AT_FDCWD, sub, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+			return fmt.Errorf("attach %s: %w", sub, err)
+		}
+	}
+	return nil
+}
+
+// mountOverlayAs mounts the overlay with filesystem IDs uid. overlayfs
+// creates its work dirs and copies up files as its mounter, and host root
+// cannot own files on idmapped layers. Runs on a thread of its own that is
+// discarded afterwards.
+func mountOverlayAs(lower, upper, work, mnt string, uid uint32) error {
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked: the thread ends with this goroutine.
+		goruntime.LockOSThread()
+		errc <- func() error {
+			if err := unix.Setfsuid(int(uid)); err != nil {
+				return fmt.Errorf("setfsuid: %w", err)
+			}
+			if err := unix.Setfsgid(int(uid)); err != nil {
+				return fmt.Errorf("setfsgid: %w", err)
+			}
+			// Changing the fsuid clears the filesystem capabilities (chown,
+			// dac_override, ...) overlayfs needs from the effective set.
+			hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+			var data [2]unix.CapUserData
+			if err := unix.Capget(&hdr, &data[0]); err != nil {
+				return fmt.Errorf("capget: %w", err)
+			}
+			data[0].Effective, data[1].Effective = data[0].Permitted, data[1].Permitted
+			if err := unix.Capset(&hdr, &data[0]); err != nil {
+				return fmt.Errorf("capset: %w", err)
+			}
+			return MountOverlay(lower, upper, work, mnt)
+		}()
+	}()
+	return <-errc
+}
+
+// childMounts returns the mount points of the mounts directly on top of the
+// mount at mnt, in mount order.
+func childMounts(mnt string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("open mountinfo: %w", err)
+	}
+	defer f.Close()
+
+	type entry struct{ id, parent, point string }
+	var entries []entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		entries = append(entries, entry{fields[0], fields[1], unescapeMountPath(fields[4])})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read mountinfo: %w", err)
+	}
+	// The topmost mount at mnt is the last one listed.
+	var top string
+	for _, e := range entries {
+		if e.point == mnt {
+			top = e.id
+		}
+	}
+	if top == "" {
+		return nil, fmt.Errorf("%s is not a mount point", mnt)
+	}
+	var out []string
+	for _, e := range entries {
+		if e.parent == top && e.point != mnt {
+			out = append(out, e.point)
+		}
+	}
+	return out, nil
+}
+
+// delegateNestedCgroup hands the session cgroup to the root of the nested
+// session at base, so nsinit can set up its cgroup namespace (see
+// setupNestedCgroup), which delegates it on to the sandbox user.
+func delegateNestedCgroup(cgPath string, base uint32) error {
+	for _, name := range []string{"", "cgroup.procs", "cgroup.threads", "cgroup.subtree_control"} {
+		if err := os.Lchown(filepath.Join(cgPath, name), int(base), int(base)); err != nil {
+			return fmt.Errorf("delegate cgroup: %w", err)
+		}
+	}
+	return nil
+}
+
+// bindIdmappedIntoSession bind-mounts src at dst inside the session whose init
+// process is initPID, idmapped into the session's user namespace, for nested
+// sessions where a plain bind would show host-owned files as nobody. The
+// mount is attached from a thread that joins the session's mount namespace;
+// the thread is discarded afterwards.
+func bindIdmappedIntoSession(initPID int, src, dst string) error {
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked: the thread ends with this goroutine.
+		goruntime.LockOSThread()
+		errc <- func() error {
+			userns, err := unix.Open(fmt.Sprintf("/proc/%d/ns/user", initPID), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return fmt.Errorf("open user namespace: %w", err)
+			}
+			defer unix.Close(userns)
+			mntns, err := unix.Open(fmt.Sprintf("/proc/%d/ns/mnt", initPID), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return fmt.Errorf("open mount namespace: %w", err)
+			}
+			defer unix.Close(mntns)
+			tree, err := idmappedClone(src, userns, false)
+			if err != nil {
+				return err
+			}
+			defer unix.Close(tree)
+			// setns into a mount namespace needs a thread of its own fs state.
+			if err := unix.Unshare(unix.CLONE_FS); err != nil {
+				return fmt.Errorf("unshare fs: %w", err)
+			}
+			if err := unix.Setns(mntns, unix.CLONE_NEWNS); err != nil {
+				return fmt.Errorf("enter mount namespace: %w", err)
+			}
+			if err := unix.MoveMount(tree, "", unix.AT_FDCWD, dst, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+				return fmt.Errorf("attach %s: %w", dst, err)
+			}
+			return nil
+		}()
+	}()
+	return <-errc
+}
+
+// prepareNestedRootfs adds what a nested-container session needs to the rootfs
+// at mnt. Must run before the rootfs is remounted read-only.
+func prepareNestedRootfs(mnt string, uid int) error {
+	ids := fmt.Sprintf("%d:%d:%d\n", uid, nestedSubIDStart, nestedSubIDCount)
+	for _, name := range []string{"subuid", "subgid"} {
+		path := filepath.Join(mnt, "etc", name)
+		if err := MkdirAll(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(ids), 0644); err != nil {
+			return fmt.Errorf("write /etc/%s: %w", name, err)
+		}
+	}
+
+	devDir := filepath.Join(mnt, "dev")
+	if err := MkdirAll(filepath.Join(devDir, "net")); err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		path         string
+		major, minor uint32
+	}{
+		{filepath.Join(devDir, "fuse"), 10, 229},
+		{filepath.Join(devDir, "net", "tun"), 10, 200},
+	} {
+		if err := unix.Mknod(d.path, unix.S_IFCHR|0666, int(unix.Mkdev(d.major, d.minor))); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("mknod %s: %w", d.path, err)
+		}
+		if err := os.Chmod(d.path, 0666); err != nil {
+			return fmt.Errorf("chmod %s: %w", d.path, err)
+		}
+	}
+
+	// cgroup2 is mounted here by nsinit once it is in its cgroup namespace.
+	sysDir := filepath.Join(mnt, "sys")
+	if err := MkdirAll(sysDir); err != nil {
+		return err
+	}
+	if err := MountTmpfs(sysDir, 1024*1024); err != nil {
+		return err
+	}
+	return MkdirAll(filepath.Join(sysDir, "fs", "cgroup"))
+}
+
+// setupNestedCgroup runs in nsinit after pivot_root. It enters a cgroup
+// namespace rooted at the session cgroup, mounts it at /sys/fs/cgroup, moves
+// itself into the init leaf (a cgroup with child cgroups cannot hold
+// processes) and delegates the tree to uid/gid.
+func setupNestedCgroup(sessionID string, uid, gid int) error {
+	waitForCgroup(sessionID)
+	if err := unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+		return fmt.Errorf("unshare cgroup namespace: %w", err)
+	}
+
+	root := "/sys/fs/cgroup"
+	if err := unix.Mount("cgroup2", root, "cgroup2", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount cgroup2: %w", err)
+	}
+	leaf := filepath.Join(root, "init")
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("create init cgroup: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte("0"), 0644); err != nil {
+		return fmt.Errorf("move to init cgroup: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("read cgroup.controllers: %w", err)
+	}
+	var enable []string
+	for _, c := range strings.Fields(string(data)) {
+		enable = append(enable, "+"+c)
+	}
+	if len(enable) > 0 {
+		if err := os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644); err != nil {
+			return fmt.Errorf("enable controllers: %w", err)
+		}
+	}
+
+	for _, dir := range []string{root, leaf} {
+		for _, name := range []string{"", "cgroup.procs", "cgroup.threads", "cgroup.subtree_control"} {
+			if err := os.Lchown(filepath.Join(dir, name), uid, gid); err != nil {
+				return fmt.Errorf("delegate cgroup: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -1,69 +1,186 @@
 // Bridge network mode: each session gets a veth pair. The host end (skv_<id>) is
 // attached to bridge sk0; the container end (skc_<id>) is moved into the session's
-// network namespace and renamed eth0. IPs are allocated from 10.55.0.0/16; NAT
+// network namespace and renamed eth0. IPs are allocated from the configured subnet
+// (default 10.55.0.0/16), optionally with a ULA IPv6 address alongside; NAT
 // masquerade allows outbound traffic. Setup is lazy (on first Exec) to save ~50-150ms
 // at session create.
 package linux
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"os/exec"
+	"strconv"
 	"sync"
 )
 
 const (
-	BridgeName = "sk0"
-	BridgeIP   = "10.55.0.1/16"
-	Subnet     = "10.55.0.0/16"
+	BridgeName    = "sk0"
+	DefaultSubnet = "10.55.0.0/16"
 )
 
+// BridgeConfig describes the addressing of the sk0 bridge.
+type BridgeConfig struct {
+	Subnet     string // IPv4 CIDR sessions are allocated from
+	Gateway    string // bridge address; "" = first host of Subnet
+	MTU        int    // bridge and veth MTU; 0 = kernel default
+	IPv6Subnet string // ULA CIDR (prefix /96 or shorter); "" = IPv4 only
+}
+
+// bridgeNet is the parsed form of BridgeConfig.
+type bridgeNet struct {
+	subnet   *net.IPNet
+	gateway  net.IP
+	mtu      int
+	subnet6  *net.IPNet
+	gateway6 net.IP
+}
+
 var (
 	ipPoolMu   sync.Mutex
-	usedIPs    = make(map[string]bool)  // IP -> in use
+	usedIPs    = make(map[string]bool)   // IP -> in use
 	sessionIPs = make(map[string]string) // sessionID -> IP
-	nextIP     = net.ParseIP("10.55.0.2")
+	bridge, _  = parseBridgeConfig(BridgeConfig{Subnet: DefaultSubnet})
+	nextHost   = uint32(1) // host offset within bridge.subnet tried next
 )
 
-// incIP increments an IPv4 address in place (big-endian).
-func incIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
-		}
+// ConfigureBridge sets the bridge addressing. Call before SetupHostBridge and
+// before any IP is allocated.
+func ConfigureBridge(cfg BridgeConfig) error {
+	b, err := parseBridgeConfig(cfg)
+	if err != nil {
+		return err
 	}
-}
-
-// AllocateIP assigns a unique IP from the pool to the session. Wraps around the subnet
-// when exhausted; returns error only if the entire pool is in use.
-func AllocateIP(sessionID string) (string, error) {
 	ipPoolMu.Lock()
 	defer ipPoolMu.Unlock()
+	bridge = b
+	nextHost = 1
+	return nil
+}
 
-	startIP := make(net.IP, len(nextIP))
-	copy(startIP, nextIP)
+func parseBridgeConfig(cfg BridgeConfig) (*bridgeNet, error) {
+	_, subnet, err := net.ParseCIDR(cfg.Subnet)
+	if err != nil || subnet.IP.To4() == nil {
+		return nil, fmt.Errorf("network subnet %q: must be an IPv4 CIDR", cfg.Subnet)
+	}
+	if ones, _ := subnet.Mask.Size(); ones < 8 || ones > 30 {
+		return nil, fmt.Errorf("network subnet %q: prefix must be between /8 and /30", cfg.Subnet)
+	}
+	b := &bridgeNet{subnet: subnet, mtu: cfg.MTU}
 
-	for {
-		ipStr := nextIP.String()
-		if !usedIPs[ipStr] {
-			usedIPs[ipStr] = true
-			sessionIPs[sessionID] = ipStr
-			incIP(nextIP)
-			return ipStr, nil
+	if cfg.Gateway == "" {
+		b.gateway = hostIP(subnet, 1)
+	} else {
+		b.gateway = net.ParseIP(cfg.Gateway).To4()
+		if b.gateway == nil || !subnet.Contains(b.gateway) {
+			return nil, fmt.Errorf("network gateway %q: must be an IPv4 address in %s", cfg.Gateway, subnet)
 		}
-		incIP(nextIP)
+		if off := hostOffset(subnet, b.gateway); off == 0 || off == hostCount(subnet)+1 {
+			return nil, fmt.Errorf("network gateway %q: cannot be the network or broadcast address", cfg.Gateway)
+		}
+	}
 
-		// Wrap around when we've left 10.55.0.0/16 subnet.
-		// For IPv4-mapped format, bytes [12:14] are the network octets (10.55).
-		if len(nextIP) >= 14 && (nextIP[12] != 10 || nextIP[13] != 55) {
-			nextIP = net.ParseIP("10.55.0.2")
+	if cfg.IPv6Subnet != "" {
+		_, subnet6, err := net.ParseCIDR(cfg.IPv6Subnet)
+		if err != nil || subnet6.IP.To4() != nil {
+			return nil, fmt.Errorf("network ipv6 subnet %q: must be an IPv6 CIDR", cfg.IPv6Subnet)
+		}
+		if ones, _ := subnet6.Mask.Size(); ones > 96 {
+			return nil, fmt.Errorf("network ipv6 subnet %q: prefix must be /96 or shorter", cfg.IPv6Subnet)
+		}
+		if subnet6.IP[0]&0xfe != 0xfc {
+			return nil, fmt.Errorf("network ipv6 subnet %q: must be a unique local range (fc00::/7)", cfg.IPv6Subnet)
 		}
+		b.subnet6 = subnet6
+		b.gateway6 = make(net.IP, net.IPv6len)
+		copy(b.gateway6, subnet6.IP)
+		b.gateway6[net.IPv6len-1] = 1
+	}
+
+	minMTU := 576
+	if b.subnet6 != nil {
+		minMTU = 1280
+	}
+	if cfg.MTU != 0 && (cfg.MTU < minMTU || cfg.MTU > 65535) {
+		return nil, fmt.Errorf("network mtu %d: must be between %d and 65535", cfg.MTU, minMTU)
+	}
+	return b, nil
+}
+
+// hostCount is the number of usable host addresses in an IPv4 subnet.
+func hostCount(subnet *net.IPNet) uint32 {
+	ones, bits := subnet.Mask.Size()
+	return 1<<(bits-ones) - 2
+}
 
-		if nextIP.Equal(startIP) {
-			return "", fmt.Errorf("ip pool exhausted")
+func hostIP(subnet *net.IPNet, offset uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(subnet.IP.To4())+offset)
+	return ip
+}
+
+func hostOffset(subnet *net.IPNet, ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4()) - binary.BigEndian.Uint32(subnet.IP.To4())
+}
+
+// ipv6For derives a session's IPv6 address by embedding its IPv4 address in the
+// low 32 bits of the IPv6 subnet, so no second allocation table is needed.
+func (b *bridgeNet) ipv6For(ip4 string) string {
+	v4 := net.ParseIP(ip4).To4()
+	if b.subnet6 == nil || v4 == nil {
+		return ""
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, b.subnet6.IP)
+	copy(ip[net.IPv6len-net.IPv4len:], v4)
+	return ip.String()
+}
+
+func (b *bridgeNet) prefixLen() int {
+	ones, _ := b.subnet.Mask.Size()
+	return ones
+}
+
+func (b *bridgeNet) prefixLen6() int {
+	ones, _ := b.subnet6.Mask.Size()
+	return ones
+}
+
+// AllocateIP assigns a unique IP from the bridge subnet to the session, skipping
+// the gateway. Wraps around the subnet; returns error only if every host address
+// is in use.
+func AllocateIP(sessionID string) (string, error) {
+	ipPoolMu.Lock()
+	defer ipPoolMu.Unlock()
+
+	hosts := hostCount(bridge.subnet)
+	for range hosts {
+		off := nextHost
+		nextHost = off%hosts + 1
+		ip := hostIP(bridge.subnet, off)
+		ipStr := ip.String()
+		if ip.Equal(bridge.gateway) || usedIPs[ipStr] {
+			continue
 		}
+		usedIPs[ipStr] = true
+		sessionIPs[sessionID] = ipStr
+		return ipStr, nil
 	}
+	return "", fmt.Errorf("ip pool exhausted")
+}
+
+// ReserveIP marks ip as used by sessionID, e.g. when restoring allocations
+// after a restart. It fails if another session already holds the address.
+func ReserveIP(sessionID, ip string) error {
+	ipPoolMu.Lock()
+	defer ipPoolMu.Unlock()
+	if usedIPs[ip] && sessionIPs[sessionID] != ip {
+		return fmt.Errorf("ip %s already allocated", ip)
+	}
+	usedIPs[ip] = true
+	sessionIPs[sessionID] = ip
+	return nil
 }
 
 // ReleaseIP returns the session's IP to the pool. Idempotent if session had no IP.
@@ -83,20 +200,37 @@ func GetIPForSession(sessionID string) string {
 	return sessionIPs[sessionID]
 }
 
-// SetupHostBridge creates the sk0 bridge with 10.55.0.1/16, enables it, adds iptables
-// MASQUERADE for the subnet, and enables ip_forward. Idempotent; skips if bridge exists.
+// SetupHostBridge creates the sk0 bridge with the gateway address(es), enables it,
+// adds iptables (and ip6tables) MASQUERADE for the subnets, and enables forwarding.
+// Idempotent; if the bridge exists it is only checked against the configuration.
 func SetupHostBridge() error {
-	if err := exec.Command("ip", "link", "show", BridgeName).Run(); err == nil {
-		// Already exists
-		return nil
+	ipPoolMu.Lock()
+	b := bridge
+	ipPoolMu.Unlock()
+
+	if iface, err := net.InterfaceByName(BridgeName); err == nil {
+		return checkHostBridge(iface, b)
 	}
 
+	gateway := fmt.Sprintf("%s/%d", b.gateway, b.prefixLen())
 	commands := [][]string{
 		{"ip", "link", "add", "name", BridgeName, "type", "bridge"},
-		{"ip", "addr", "add", BridgeIP, "dev", BridgeName},
-		{"ip", "link", "set", "dev", BridgeName, "up"},
-		{"iptables", "-t", "nat", "-A", "POSTROUTING", "-s", Subnet, "!", "-o", BridgeName, "-j", "MASQUERADE"},
-		{"sysctl", "-w", "net.ipv4.ip_forward=1"},
+		{"ip", "addr", "add", gateway, "dev", BridgeName},
+	}
+	if b.mtu > 0 {
+		commands = append(commands, []string{"ip", "link", "set", "dev", BridgeName, "mtu", strconv.Itoa(b.mtu)})
+	}
+	commands = append(commands,
+		[]string{"ip", "link", "set", "dev", BridgeName, "up"},
+		[]string{"iptables", "-t", "nat", "-A", "POSTROUTING", "-s", b.subnet.String(), "!", "-o", BridgeName, "-j", "MASQUERADE"},
+		[]string{"sysctl", "-w", "net.ipv4.ip_forward=1"},
+	)
+	if b.subnet6 != nil {
+		commands = append(commands,
+			[]string{"ip", "-6", "addr", "add", fmt.Sprintf("%s/%d", b.gateway6, b.prefixLen6()), "dev", BridgeName, "nodad"},
+			[]string{"ip6tables", "-t", "nat", "-A", "POSTROUTING", "-s", b.subnet6.String(), "!", "-o", BridgeName, "-j", "MASQUERADE"},
+			[]string{"sysctl", "-w", "net.ipv6.conf.all.forwarding=1"},
+		)
 	}
 
 	for _, cmd := range commands {
@@ -108,29 +242,77 @@ func SetupHostBridge() error {
 	return nil
 }
 
+// checkHostBridge reports an existing sk0 that does not carry the configured
+// gateway addresses, e.g. after the subnet was changed.
+func checkHostBridge(iface *net.Interface, b *bridgeNet) error {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("list %s addresses: %w", BridgeName, err)
+	}
+	has4, has6 := false, b.subnet6 == nil
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipn.IP.Equal(b.gateway) {
+			has4 = true
+		}
+		if b.subnet6 != nil && ipn.IP.Equal(b.gateway6) {
+			has6 = true
+		}
+	}
+	if !has4 || !has6 {
+		return fmt.Errorf("bridge %s exists with a different configuration; remove it with `ip link delete %s` to apply the configured network", BridgeName, BridgeName)
+	}
+	return nil
+}
+
 // SetupSessionNetwork creates a veth pair, attaches the host end to sk0, moves the
-// container end into the session's net ns (via pid), renames it to eth0, assigns the IP,
-// and sets the default route via 10.55.0.1. Call with nsinit already running (pid valid).
+// container end into the session's net ns (via pid), renames it to eth0, assigns the IP
+// (and derived IPv6 address), and sets the default routes via the bridge. Call with
+// nsinit already running (pid valid).
 func SetupSessionNetwork(sessionID string, pid int, ip string) error {
+	ipPoolMu.Lock()
+	b := bridge
+	ipPoolMu.Unlock()
+
 	vethHost := "skv_" + sessionID[:8]
 	vethCont := "skc_" + sessionID[:8]
+	ns := []string{"nsenter", "-t", strconv.Itoa(pid), "-n"}
+	inNS := func(args ...string) []string { return append(append([]string{}, ns...), args...) }
 
 	commands := [][]string{
 		{"ip", "link", "add", "name", vethHost, "type", "veth", "peer", "name", vethCont},
+	}
+	if b.mtu > 0 {
+		mtu := strconv.Itoa(b.mtu)
+		commands = append(commands,
+			[]string{"ip", "link", "set", "dev", vethHost, "mtu", mtu},
+			[]string{"ip", "link", "set", "dev", vethCont, "mtu", mtu},
+		)
+	}
+	commands = append(commands,
 		// Attach host side to bridge
-		{"ip", "link", "set", "dev", vethHost, "master", BridgeName},
-		{"ip", "link", "set", "dev", vethHost, "up"},
+		[]string{"ip", "link", "set", "dev", vethHost, "master", BridgeName},
+		[]string{"ip", "link", "set", "dev", vethHost, "up"},
 		// Move container side to namespace
-		{"ip", "link", "set", "dev", vethCont, "netns", fmt.Sprintf("%d", pid)},
+		[]string{"ip", "link", "set", "dev", vethCont, "netns", strconv.Itoa(pid)},
 		// Rename to eth0 inside namespace
-		{"nsenter", "-t", fmt.Sprintf("%d", pid), "-n", "ip", "link", "set", "dev", vethCont, "name", "eth0"},
+		inNS("ip", "link", "set", "dev", vethCont, "name", "eth0"),
 		// Set IP inside namespace
-		{"nsenter", "-t", fmt.Sprintf("%d", pid), "-n", "ip", "addr", "add", ip + "/16", "dev", "eth0"},
+		inNS("ip", "addr", "add", fmt.Sprintf("%s/%d", ip, b.prefixLen()), "dev", "eth0"),
 		// Bring interfaces up inside namespace
-		{"nsenter", "-t", fmt.Sprintf("%d", pid), "-n", "ip", "link", "set", "dev", "eth0", "up"},
-		{"nsenter", "-t", fmt.Sprintf("%d", pid), "-n", "ip", "link", "set", "dev", "lo", "up"},
+		inNS("ip", "link", "set", "dev", "eth0", "up"),
+		inNS("ip", "link", "set", "dev", "lo", "up"),
 		// Set default route inside namespace
-		{"nsenter", "-t", fmt.Sprintf("%d", pid), "-n", "ip", "route", "add", "default", "via", "10.55.0.1"},
+		inNS("ip", "route", "add", "default", "via", b.gateway.String()),
+	)
+	if ip6 := b.ipv6For(ip); ip6 != "" {
+		commands = append(commands,
+			inNS("ip", "-6", "addr", "add", fmt.Sprintf("%s/%d", ip6, b.prefixLen6()), "dev", "eth0", "nodad"),
+			inNS("ip", "-6", "route", "add", "default", "via", b.gateway6.String()),
+		)
 	}
 
 	for _, cmd := range commands {
@@ -139,6 +321,5 @@ func SetupSessionNetwork(sessionID string, pid int, ip string) error {
 		}
 	}
 
-	// Write the resolv.conf file for the container
 	return nil
 }
@@ -16,27 +16,37 @@ package linux
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
+
+	"github.com/p-arndt/sandkasten/internal/failpoint"
 )
 
 const (
 	EnvNsinit = "SANDKASTEN_NSINIT"
 	EnvConfig = "SANDKASTEN_NSINIT_CONFIG"
+
+	// nsinitHoldUserns as EnvNsinit makes the child only hold its user
+	// namespace until stdin is closed (see nestedUserns).
+	nsinitHoldUserns = "userns"
 )
 
 // NsinitConfig is serialized to JSON and passed via env to the nsinit child.
 type NsinitConfig struct {
 	SessionID     string `json:"session_id"`
+	Hostname      string `json:"hostname"`
 	Mnt           string `json:"mnt"`
 	CgroupPath    string `json:"cgroup_path"`
 	RunnerPath    string `json:"runner_path"`
@@ -47,18 +57,35 @@ type NsinitConfig struct {
 	NetworkBridge bool   `json:"network_bridge"`
 	Readonly      bool   `json:"readonly"`
 	Seccomp       string `json:"seccomp"`
+	// Nested relaxes seccomp and capabilities and delegates the cgroup for
+	// rootless container runtimes (see nested.go). HostIDBase is the first
+	// host ID of the session's ID block.
+	Nested     bool   `json:"nested,omitempty"`
+	HostIDBase uint32 `json:"host_id_base,omitempty"`
 	// Runner config: passed as env to runner process
 	ShellPrefer string `json:"shell_prefer,omitempty"` // "sh" to prefer lighter shell
 	ExecMode    string `json:"exec_mode,omitempty"`    // "stateless" for direct exec, no shell
+	// Deterministic sessions: Env replaces variables of the runner's default
+	// environment. RandomSeed has the runner feed the random device FIFOs
+	// (see SetupRandomFIFOs) from a seeded stream and makes getrandom(2)
+	// fail with ENOSYS, so libraries fall back to the devices.
+	Env        []string `json:"env,omitempty"`
+	RandomSeed string   `json:"random_seed,omitempty"`
 }
 
-// IsNsinit returns true when the current process is the nsinit child (SANDKASTEN_NSINIT=1).
+// IsNsinit returns true when the current process is the nsinit child (SANDKASTEN_NSINIT=1)
+// or holds a user namespace for the driver.
 func IsNsinit() bool {
-	return os.Getenv(EnvNsinit) == "1"
+	v := os.Getenv(EnvNsinit)
+	return v == "1" || v == nsinitHoldUserns
 }
 
 // RunNsinit is the entry point for the nsinit child. Parses config from env and runs nsinitMain.
 func RunNsinit() error {
+	if os.Getenv(EnvNsinit) == nsinitHoldUserns {
+		_, _ = io.Copy(io.Discard, os.Stdin)
+		return nil
+	}
 	cfgJSON := os.Getenv(EnvConfig)
 	if cfgJSON == "" {
 		return fmt.Errorf("missing %s", EnvConfig)
@@ -69,14 +96,14 @@ func RunNsinit() error {
 		return fmt.Errorf("parse nsinit config: %w", err)
 	}
 
-	return nsinitMain(cfg)
+	return tagErrno(nsinitMain(cfg))
 }
 
 // nsinitMain performs the actual sandbox setup. Order matters: pivot_root first, then
 // proc/dev mounts, then security (no_new_privs, seccomp, capabilities), then uid/gid.
 func nsinitMain(cfg NsinitConfig) error {
 	// UTS: hostname visible inside sandbox
-	if err := unix.Sethostname([]byte("sk-" + cfg.SessionID[:8])); err != nil {
+	if err := unix.Sethostname([]byte(cfg.Hostname)); err != nil {
 		return fmt.Errorf("sethostname: %w", err)
 	}
 
@@ -120,6 +147,20 @@ func nsinitMain(cfg NsinitConfig) error {
 		return fmt.Errorf("mount devpts: %w", err)
 	}
 
+	// A fresh network namespace starts with lo down; bring it up so services
+	// can listen on localhost and be reached through the runner's port proxy.
+	if cfg.NetworkNone {
+		if err := bringUpLoopback(); err != nil {
+			return fmt.Errorf("bring up lo: %w", err)
+		}
+	}
+
+	if cfg.Nested {
+		if err := setupNestedCgroup(cfg.SessionID, cfg.UID, cfg.GID); err != nil {
+			return err
+		}
+	}
+
 	// Security hardening: block setuid privilege escalation
 	if cfg.NoNewPrivs {
 		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
@@ -127,11 +168,16 @@ func nsinitMain(cfg NsinitConfig) error {
 		}
 	}
 
-	if err := applySeccomp(cfg.Seccomp); err != nil {
+	if err := applySeccomp(cfg.Seccomp, cfg.Nested); err != nil {
 		return fmt.Errorf("apply seccomp: %w", err)
 	}
+	if cfg.RandomSeed != "" {
+		if err := installGetrandomFilter(); err != nil {
+			return fmt.Errorf("apply getrandom filter: %w", err)
+		}
+	}
 
-	if err := dropCapabilities(); err != nil {
+	if err := dropCapabilities(cfg.Nested); err != nil {
 		return fmt.Errorf("drop capabilities: %w", err)
 	}
 
@@ -157,14 +203,9 @@ func nsinitMain(cfg NsinitConfig) error {
 		}
 	}
 
-	// Host attaches us to cgroup after we start; brief wait so cgroup.procs is populated
-	for i := 0; i < 100; i++ {
-		if data, err := os.ReadFile("/proc/self/cgroup"); err == nil {
-			if strings.Contains(string(data), cfg.SessionID) {
-				break
-			}
-		}
-		time.Sleep(10 * time.Millisecond)
+	// Nested sessions already waited and now see their own cgroup namespace.
+	if !cfg.Nested {
+		waitForCgroup(cfg.SessionID)
 	}
 
 	argv := []string{cfg.RunnerPath}
@@ -180,13 +221,60 @@ func nsinitMain(cfg NsinitConfig) error {
 	if cfg.ExecMode != "" {
 		env = append(env, "SANDKASTEN_EXEC_MODE="+cfg.ExecMode)
 	}
+	env = mergeEnv(env, cfg.Env)
+	if cfg.RandomSeed != "" {
+		env = append(env, "SANDKASTEN_RANDOM_SEED="+cfg.RandomSeed)
+	}
 
 	return unix.Exec(cfg.RunnerPath, argv, env)
 }
 
+// mergeEnv returns env with the variables of extra replacing or added to it.
+func mergeEnv(env, extra []string) []string {
+	for _, kv := range extra {
+		key, _, _ := strings.Cut(kv, "=")
+		env = slices.DeleteFunc(env, func(e string) bool { return strings.HasPrefix(e, key+"=") })
+		env = append(env, kv)
+	}
+	return env
+}
+
+// waitForCgroup waits briefly for the host to attach us to the session cgroup,
+// which happens after we start.
+func waitForCgroup(sessionID string) {
+	for i := 0; i < 100; i++ {
+		if data, err := os.ReadFile("/proc/self/cgroup"); err == nil {
+			if strings.Contains(string(data), sessionID) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// bringUpLoopback sets IFF_UP on lo in the current network namespace.
+func bringUpLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
 // dropCapabilities removes dangerous capabilities via PR_CAPBSET_DROP so they cannot
-// be regained. Keeps minimal set (e.g. CAP_NET_BIND_SERVICE for dev servers).
-func dropCapabilities() error {
+// be regained. Keeps minimal set (e.g. CAP_NET_BIND_SERVICE for dev servers). Nested
+// sessions keep nestedCaps.
+func dropCapabilities(nested bool) error {
 	caps := []uintptr{
 		unix.CAP_NET_RAW,
 		unix.CAP_NET_BIND_SERVICE,
@@ -216,6 +304,9 @@ func dropCapabilities() error {
 	}
 
 	for _, cap := range caps {
+		if nested && slices.Contains(nestedCaps, cap) {
+			continue
+		}
 		if err := unix.Prctl(unix.PR_CAPBSET_DROP, cap, 0, 0, 0); err != nil {
 			return fmt.Errorf("drop capability %d: %w", cap, err)
 		}
@@ -238,23 +329,31 @@ func ensureSandboxHome(uid, gid int) error {
 }
 
 // applySeccomp installs a BPF filter that denies dangerous syscalls (bpf, mount, ptrace, etc.).
-// "mvp" allows setns/unshare; "strict" denies them. "off" skips seccomp.
-func applySeccomp(profile string) error {
+// "mvp" allows setns/unshare; "strict" denies them. "off" skips seccomp. Nested sessions
+// get the mvp filter without the mount and keyring syscalls whichever profile is set.
+func applySeccomp(profile string, nested bool) error {
 	switch profile {
 	case "", "off":
 		return nil
 	case "mvp":
-		return installSeccompFilter(false)
+		return installSeccompFilter(false, nested)
 	case "strict":
-		return installSeccompFilter(true)
+		return installSeccompFilter(!nested, nested)
 	default:
 		return fmt.Errorf("unknown profile %q", profile)
 	}
 }
 
 // installSeccompFilter builds and installs the BPF filter. deny list includes SYS_BPF,
-// SYS_MOUNT, SYS_PTRACE, etc. strict=true adds SYS_SETNS and SYS_UNSHARE.
-func installSeccompFilter(strict bool) error {
+// SYS_MOUNT, SYS_PTRACE, etc. strict=true adds SYS_SETNS and SYS_UNSHARE. nested=true
+// leaves out the mount and keyring syscalls container runtimes use. SYS_* numbers are
+// per architecture, so syscalls from any other ABI (i386 or x32 on amd64, AArch32 on
+// arm64) kill the process instead of being matched against the wrong numbers.
+func installSeccompFilter(strict, nested bool) error {
+	if seccompArch == 0 {
+		return fmt.Errorf("seccomp filter not supported on %s", runtime.GOARCH)
+	}
+
 	deny := []uint32{
 		uint32(unix.SYS_BPF),
 		uint32(unix.SYS_USERFAULTFD),
@@ -262,15 +361,20 @@ func installSeccompFilter(strict bool) error {
 		uint32(unix.SYS_PTRACE),
 		uint32(unix.SYS_KEXEC_LOAD),
 		uint32(unix.SYS_OPEN_BY_HANDLE_AT),
-		uint32(unix.SYS_KEYCTL),
-		uint32(unix.SYS_ADD_KEY),
-		uint32(unix.SYS_REQUEST_KEY),
 		uint32(unix.SYS_INIT_MODULE),
 		uint32(unix.SYS_FINIT_MODULE),
 		uint32(unix.SYS_DELETE_MODULE),
-		uint32(unix.SYS_MOUNT),
-		uint32(unix.SYS_UMOUNT2),
-		uint32(unix.SYS_PIVOT_ROOT),
+	}
+
+	if !nested {
+		deny = append(deny,
+			uint32(unix.SYS_KEYCTL),
+			uint32(unix.SYS_ADD_KEY),
+			uint32(unix.SYS_REQUEST_KEY),
+			uint32(unix.SYS_MOUNT),
+			uint32(unix.SYS_UMOUNT2),
+			uint32(unix.SYS_PIVOT_ROOT),
+		)
 	}
 
 	if strict {
@@ -280,11 +384,41 @@ func installSeccompFilter(strict bool) error {
 		)
 	}
 
-	filters := make([]unix.SockFilter, 0, len(deny)*2+2)
-	filters = append(filters, unix.SockFilter{
-		Code: uint16(unix.BPF_LD | unix.BPF_W | unix.BPF_ABS),
-		K:    0,
-	})
+	kill := unix.SockFilter{
+		Code: uint16(unix.BPF_RET | unix.BPF_K),
+		K:    unix.SECCOMP_RET_KILL_PROCESS,
+	}
+	filters := make([]unix.SockFilter, 0, len(deny)*2+7)
+	filters = append(filters,
+		// seccomp_data.arch
+		unix.SockFilter{
+			Code: uint16(unix.BPF_LD | unix.BPF_W | unix.BPF_ABS),
+			K:    4,
+		},
+		unix.SockFilter{
+			Code: uint16(unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K),
+			Jt:   1,
+			Jf:   0,
+			K:    seccompArch,
+		},
+		kill,
+		// seccomp_data.nr
+		unix.SockFilter{
+			Code: uint16(unix.BPF_LD | unix.BPF_W | unix.BPF_ABS),
+			K:    0,
+		},
+	)
+	if seccompX32Bit != 0 {
+		filters = append(filters,
+			unix.SockFilter{
+				Code: uint16(unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K),
+				Jt:   0,
+				Jf:   1,
+				K:    seccompX32Bit,
+			},
+			kill,
+		)
+	}
 
 	for _, nr := range deny {
 		filters = append(filters,
@@ -314,10 +448,42 @@ func installSeccompFilter(strict bool) error {
 	return nil
 }
 
+// installGetrandomFilter makes getrandom(2) fail with ENOSYS, on top of any
+// filter applySeccomp installed, so libc, Python and OpenSSL read the random
+// devices instead. Syscalls of other ABIs are left to that filter.
+func installGetrandomFilter() error {
+	if seccompArch == 0 {
+		return fmt.Errorf("seccomp filter not supported on %s", runtime.GOARCH)
+	}
+	allow := unix.SockFilter{
+		Code: uint16(unix.BPF_RET | unix.BPF_K),
+		K:    unix.SECCOMP_RET_ALLOW,
+	}
+	filters := []unix.SockFilter{
+		// seccomp_data.arch
+		{Code: uint16(unix.BPF_LD | unix.BPF_W | unix.BPF_ABS), K: 4},
+		{Code: uint16(unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K), Jt: 1, Jf: 0, K: seccompArch},
+		allow,
+		// seccomp_data.nr
+		{Code: uint16(unix.BPF_LD | unix.BPF_W | unix.BPF_ABS), K: 0},
+		{Code: uint16(unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K), Jt: 0, Jf: 1, K: uint32(unix.SYS_GETRANDOM)},
+		{Code: uint16(unix.BPF_RET | unix.BPF_K), K: unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+		allow,
+	}
+	prog := unix.SockFprog{Len: uint16(len(filters)), Filter: &filters[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, uintptr(unix.SECCOMP_MODE_FILTER), uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
+
 // LaunchNsinit spawns the nsinit child: same binary with SANDKASTEN_NSINIT=1 and config in env.
 // Cloneflags: NEWNS (mount), NEWPID (isolated PID tree), NEWUTS, NEWIPC, NEWUSER. If
 // NetworkNone, adds NEWNET. Returns the command (caller starts it) and a temp log file.
 func LaunchNsinit(cfg NsinitConfig) (*exec.Cmd, *os.File, error) {
+	if err := failpoint.Inject(failpoint.NsinitLaunch); err != nil {
+		return nil, nil, err
+	}
+	if cfg.Nested && cfg.HostIDBase < nestedHostIDStart {
+		return nil, nil, fmt.Errorf("nested session without host id block")
+	}
 	cfgJSON, err := json.Marshal(cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal nsinit config: %w", err)
@@ -357,6 +523,13 @@ func LaunchNsinit(cfg NsinitConfig) (*exec.Cmd, *os.File, error) {
 		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
 	}
 
+	// Nested sessions are mapped to their own block of unprivileged host IDs,
+	// including the subordinate range from /etc/subuid and /etc/subgid.
+	if cfg.Nested {
+		cmd.SysProcAttr.UidMappings = nestedIDMappings(cfg.HostIDBase)
+		cmd.SysProcAttr.GidMappings = nestedIDMappings(cfg.HostIDBase)
+	}
+
 	cmd.Stdin = nil
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
@@ -0,0 +1,197 @@
+//go:build linux
+
+// Discovery and cleanup of host resources left behind by sessions: cgroups under
+// sandkasten/, skv_/skc_ veth interfaces, IP allocations and mounts below the
+// sessions directory. Destroy removes all of these; a crash or failed teardown
+// can leak them.
+package linux
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"golang.org/x/sys/unix"
+)
+
+// ListHostResources returns every session-owned host resource (used by the
+// reaper to find orphans).
+func (d *Driver) ListHostResources(ctx context.Context) ([]runtime.HostResource, error) {
+	return ScanHostResources(d.dataDir)
+}
+
+// RemoveHostResource releases a single resource returned by ListHostResources.
+func (d *Driver) RemoveHostResource(ctx context.Context, r runtime.HostResource) error {
+	return CleanupHostResource(r)
+}
+
+// ScanHostResources lists session cgroups, veth interfaces, IP allocations of
+// this process and mounts under dataDir/sessions. Mounts are ordered deepest
+// first so they can be unmounted in order.
+func ScanHostResources(dataDir string) ([]runtime.HostResource, error) {
+	var out []runtime.HostResource
+
+	for _, parent := range cgroupParents() {
+		entries, err := os.ReadDir(parent)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read cgroups %s: %w", parent, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				out = append(out, runtime.HostResource{Kind: "cgroup", SessionID: e.Name(), Name: filepath.Join(parent, e.Name())})
+			}
+		}
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if strings.HasPrefix(iface.Name, "skv_") || strings.HasPrefix(iface.Name, "skc_") {
+			out = append(out, runtime.HostResource{Kind: "veth", SessionID: iface.Name[4:], Name: iface.Name})
+		}
+	}
+
+	ipPoolMu.Lock()
+	for id, ip := range sessionIPs {
+		out = append(out, runtime.HostResource{Kind: "ip", SessionID: id, Name: ip})
+	}
+	ipPoolMu.Unlock()
+
+	mounts, err := sessionMounts(filepath.Join(dataDir, "sessions"))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, mounts...), nil
+}
+
+// CleanupHostResource removes r. Resources that are already gone are not an error.
+func CleanupHostResource(r runtime.HostResource) error {
+	switch r.Kind {
+	case "cgroup":
+		return removeCgroupDir(r.Name)
+	case "veth":
+		// Deleting one end of a veth pair removes its peer as well.
+		if _, err := net.InterfaceByName(r.Name); err != nil {
+			return nil
+		}
+		if out, err := exec.Command("ip", "link", "delete", r.Name).CombinedOutput(); err != nil {
+			return fmt.Errorf("delete interface %s: %v: %s", r.Name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	case "ip":
+		ReleaseIP(r.SessionID)
+		return nil
+	case "mount":
+		if err := unix.Unmount(r.Name, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+			return fmt.Errorf("unmount %s: %w", r.Name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown resource kind %q", r.Kind)
+	}
+}
+
+// cgroupParents returns the directories session cgroups are created in. The
+// daemon nests them under its own cgroup (or the configured parent), so a
+// separate process (doctor) also looks at the root hierarchy.
+func cgroupParents() []string {
+	own := sessionCgroupsPath()
+	root := filepath.Join("/sys/fs/cgroup", "sandkasten")
+	if own == root {
+		return []string{own}
+	}
+	return []string{own, root}
+}
+
+// removeCgroupDir kills everything left in the cgroup and removes it, retrying
+// briefly while the killed processes exit.
+func removeCgroupDir(path string) error {
+	if err := KillCgroupProcesses(path); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(path); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				if err := removeCgroupDir(filepath.Join(path, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	var err error
+	for i := 0; i < 10; i++ {
+		err = unix.Rmdir(path)
+		if err == nil || errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		if !errors.Is(err, unix.EBUSY) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("remove cgroup %s: %w", path, err)
+}
+
+// sessionMounts parses /proc/self/mountinfo for mount points below sessionsDir.
+func sessionMounts(sessionsDir string) ([]runtime.HostResource, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("open mountinfo: %w", err)
+	}
+	defer f.Close()
+
+	prefix := filepath.Clean(sessionsDir) + "/"
+	var out []runtime.HostResource
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountPath(fields[4])
+		if !strings.HasPrefix(mountPoint, prefix) {
+			continue
+		}
+		id, _, _ := strings.Cut(strings.TrimPrefix(mountPoint, prefix), "/")
+		out = append(out, runtime.HostResource{Kind: "mount", SessionID: id, Name: mountPoint})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read mountinfo: %w", err)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].Name) > len(out[j].Name) })
+	return out, nil
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space, ...) used in mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
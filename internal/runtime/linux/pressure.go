@@ -0,0 +1,93 @@
+//go:build linux
+
+package linux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// hostMemoryPressure is the PSI file of the whole host.
+const hostMemoryPressure = "/proc/pressure/memory"
+
+// psiLine is one line ("some" or "full") of a PSI file: the share of time, in
+// percent, in which tasks stalled over the last 10, 60 and 300 seconds.
+type psiLine struct {
+	Avg10, Avg60, Avg300 float64
+}
+
+// readPSI parses a pressure file such as /proc/pressure/memory or a cgroup's
+// memory.pressure. The "full" line is missing for cpu on older kernels.
+func readPSI(path string) (some, full psiLine, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return psiLine{}, psiLine{}, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var l psiLine
+		for _, f := range fields[1:] {
+			key, value, _ := strings.Cut(f, "=")
+			v, perr := strconv.ParseFloat(value, 64)
+			if perr != nil {
+				continue
+			}
+			switch key {
+			case "avg10":
+				l.Avg10 = v
+			case "avg60":
+				l.Avg60 = v
+			case "avg300":
+				l.Avg300 = v
+			}
+		}
+		switch fields[0] {
+		case "some":
+			some = l
+		case "full":
+			full = l
+		}
+	}
+	return some, full, nil
+}
+
+// cgroupPressure reads the PSI file name (cpu.pressure, memory.pressure or
+// io.pressure) of a cgroup. It returns nil if the kernel has no PSI.
+func cgroupPressure(cgPath, name string) *protocol.Pressure {
+	some, full, err := readPSI(filepath.Join(cgPath, name))
+	if err != nil {
+		return nil
+	}
+	return &protocol.Pressure{
+		SomeAvg10: some.Avg10, SomeAvg60: some.Avg60, SomeAvg300: some.Avg300,
+		FullAvg10: full.Avg10, FullAvg60: full.Avg60, FullAvg300: full.Avg300,
+	}
+}
+
+// MemoryPressure returns the "some avg10" memory pressure of the host. It
+// fails on kernels built without PSI or booted with psi=0.
+func (d *Driver) MemoryPressure() (float64, error) {
+	some, _, err := readPSI(hostMemoryPressure)
+	if err != nil {
+		return 0, err
+	}
+	return some.Avg10, nil
+}
+
+// setOOMScoreAdj sets the oom_score_adj of pid. Processes it forks afterwards
+// inherit the value, so setting it on nsinit covers the runner and the shell.
+func setOOMScoreAdj(pid, adj int) error {
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(adj)), 0); err != nil {
+		return fmt.Errorf("set oom_score_adj: %w", err)
+	}
+	return nil
+}
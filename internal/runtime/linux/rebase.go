@@ -0,0 +1,49 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// Rebase restarts a session on opts.Image with the upper layer of its
+// overlay, so files the session wrote survive while the image layers below
+// them are swapped. Files it changed that came from the old image keep their
+// changed copy and hide the new image's version; deletions stay deleted.
+// The cgroup, mounts, network and runner are set up from scratch as in
+// Create, so per-session cgroup changes are reset to the defaults.
+func (d *Driver) Rebase(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	sessionDir := filepath.Join(d.dataDir, "sessions", opts.SessionID)
+	if _, err := os.Stat(filepath.Join(sessionDir, "upper")); err != nil {
+		return nil, fmt.Errorf("session upper layer: %w", err)
+	}
+	// Check the image before anything is stopped.
+	if _, _, err := d.imageLowerDirs(opts.Image); err != nil {
+		return nil, createError("image", nil, nil, err)
+	}
+
+	if d.cfg.Defaults.NetworkMode == "bridge" && GetIPForSession(opts.SessionID) != "" {
+		ReleaseIP(opts.SessionID)
+	}
+	// A session whose previous Rebase failed has no state and nothing to stop.
+	if state, err := d.readState(filepath.Join(sessionDir, "state.json")); err == nil {
+		d.stopSandbox(opts.SessionID, state)
+	}
+	d.ensureNetworkMu.Delete(opts.SessionID)
+	releaseNestedIDs(opts.SessionID)
+	d.cleanupSessionDir(sessionDir, true)
+
+	info, err := d.create(ctx, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if d.logger != nil {
+		d.logger.Info("session rebased", "session_id", opts.SessionID, "image", opts.Image, "init_pid", info.InitPID)
+	}
+	return info, nil
+}
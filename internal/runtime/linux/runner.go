@@ -0,0 +1,71 @@
+//go:build linux
+
+package linux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/elfcheck"
+	"github.com/p-arndt/sandkasten/internal/runnerbin"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxRunnerPath is where the runner sits inside every session rootfs.
+const sandboxRunnerPath = "usr/local/bin/runner"
+
+// hostRunner returns the host runner binary for runner.injection "bind" and
+// "embedded", extracting the embedded one to data_dir/runner first. It
+// returns "" for "layer", where the runner comes from the shared runner layer
+// written at pull time. The runner must be a static binary for the host
+// architecture.
+func hostRunner(cfg *config.Config) (string, error) {
+	var runner string
+	switch cfg.Runner.Injection {
+	case config.RunnerInjectionBind:
+		runner = cfg.Runner.Path
+		if runner == "" {
+			exe, err := os.Executable()
+			if err != nil {
+				return "", fmt.Errorf("get executable path: %w", err)
+			}
+			if runner, err = runnerbin.Find(filepath.Dir(exe)); err != nil {
+				return "", err
+			}
+		}
+	case config.RunnerInjectionEmbedded:
+		path, err := runnerbin.Extract(filepath.Join(cfg.DataDir, "runner"))
+		if err != nil {
+			return "", err
+		}
+		runner = path
+	default:
+		return "", nil
+	}
+	info, err := os.Stat(runner)
+	if err != nil {
+		return "", fmt.Errorf("runner binary: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode()&0o111 == 0 {
+		return "", fmt.Errorf("runner binary %s is not an executable file", runner)
+	}
+	if err := elfcheck.CheckRunner(runner); err != nil {
+		return "", err
+	}
+	return runner, nil
+}
+
+// BindRunner bind-mounts the host runner read-only over /usr/local/bin/runner
+// in the rootfs at mnt, so images need no runner of their own.
+func BindRunner(mnt, runner string) error {
+	if err := BindHostFile(mnt, runner, sandboxRunnerPath); err != nil {
+		return err
+	}
+	dst := filepath.Join(mnt, sandboxRunnerPath)
+	if err := unix.Mount("", dst, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("remount runner readonly %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package linux
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is the audit architecture of native syscalls. The i386 ABI
+// (int 0x80) reports AUDIT_ARCH_I386 and numbers syscalls differently, so it
+// would slip past the deny list.
+const seccompArch = unix.AUDIT_ARCH_X86_64
+
+// seccompX32Bit marks x32 ABI syscalls, which report AUDIT_ARCH_X86_64 but
+// use their own numbers.
+const seccompX32Bit = 0x40000000
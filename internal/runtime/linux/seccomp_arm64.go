@@ -0,0 +1,12 @@
+//go:build linux
+
+package linux
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is the audit architecture of native syscalls. AArch32 compat
+// syscalls report AUDIT_ARCH_ARM and use the 32-bit ARM numbers.
+const seccompArch = unix.AUDIT_ARCH_AARCH64
+
+// seccompX32Bit is zero: arm64 has no x32-style ABI sharing the native arch.
+const seccompX32Bit = 0
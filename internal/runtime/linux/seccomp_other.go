@@ -0,0 +1,10 @@
+//go:build linux && !amd64 && !arm64
+
+package linux
+
+// seccompArch is zero on architectures whose filter has not been validated;
+// installSeccompFilter refuses to run there rather than install a filter
+// with the wrong syscall numbers.
+const seccompArch = 0
+
+const seccompX32Bit = 0
@@ -0,0 +1,63 @@
+//go:build linux
+
+package linux
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketWatch is an inotify watch on the runner socket directory. It replaces
+// fixed-interval polling so session create returns as soon as the runner listens.
+type socketWatch struct {
+	fd int
+}
+
+// watchSocketDir watches dir for new entries. Callers fall back to polling
+// when it returns an error.
+func watchSocketDir(dir string) (*socketWatch, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_MOVED_TO); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+	return &socketWatch{fd: fd}, nil
+}
+
+// wait blocks until an event arrives or timeout elapses, then drains pending
+// events. The caller re-checks the socket either way.
+func (w *socketWatch) wait(timeout time.Duration) error {
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+	if err != nil {
+		if errors.Is(err, unix.EINTR) {
+			return nil
+		}
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	for {
+		if _, err := unix.Read(w.fd, buf); err != nil {
+			if errors.Is(err, unix.EAGAIN) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Close releases the watch. Safe on a nil receiver.
+func (w *socketWatch) Close() {
+	if w != nil {
+		unix.Close(w.fd)
+	}
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package linux
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// straceAttachTimeout bounds how long StartTrace waits for strace to attach
+// to the session's processes.
+const straceAttachTimeout = 5 * time.Second
+
+// StartTrace implements runtime.ExecTracer with strace on the host: it
+// attaches to every process in the session's cgroup and follows their
+// children, recording file, process and network syscalls. The sandbox's
+// seccomp filter denies ptrace, so strace cannot run inside. Calls of the
+// runner itself are left out of the report.
+func (d *Driver) StartTrace(ctx context.Context, sessionID string) (func() (*runtime.TraceReport, error), error) {
+	sessionDir := filepath.Join(d.dataDir, "sessions", sessionID)
+	state, err := d.readState(filepath.Join(sessionDir, "state.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	if state.CgroupPath == "" {
+		return nil, fmt.Errorf("no cgroup path for session")
+	}
+	strace := d.cfg.Trace.Strace
+	if strace == "" {
+		strace = "strace"
+	}
+	if strace, err = exec.LookPath(strace); err != nil {
+		return nil, fmt.Errorf("find strace: %w", err)
+	}
+	pids, err := cgroupTreePIDs(state.CgroupPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no processes in session")
+	}
+
+	out, err := os.CreateTemp(sessionDir, "trace-*.log")
+	if err != nil {
+		return nil, fmt.Errorf("create trace file: %w", err)
+	}
+	out.Close()
+	args := []string{"-f", "-qq", "-s", "4096", "-e", "trace=%file,%process,%network", "-e", "signal=none", "-o", out.Name()}
+	for _, pid := range pids {
+		args = append(args, "-p", strconv.Itoa(pid))
+	}
+	cmd := exec.Command(strace, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("start strace: %w", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+
+	if err := waitTraced(ctx, pids, cmd.Process.Pid, done); err != nil {
+		_ = cmd.Process.Kill()
+		<-done
+		os.Remove(out.Name())
+		return nil, fmt.Errorf("attach strace: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	runner := taskIDs(state.InitPID)
+	stop := func() (*runtime.TraceReport, error) {
+		// Threads the runner started during the exec.
+		for tid := range taskIDs(state.InitPID) {
+			runner[tid] = true
+		}
+		// strace detaches from all processes on SIGINT.
+		_ = cmd.Process.Signal(syscall.SIGINT)
+		<-done
+		defer os.Remove(out.Name())
+		f, err := os.Open(out.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read trace: %w", err)
+		}
+		defer f.Close()
+		return runtime.ParseStrace(f, func(pid int) bool { return runner[pid] })
+	}
+	return stop, nil
+}
+
+// waitTraced waits until tracer is attached to all pids that still exist.
+func waitTraced(ctx context.Context, pids []int, tracer int, done <-chan struct{}) error {
+	want := strconv.Itoa(tracer)
+	deadline := time.NewTimer(straceAttachTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		attached := true
+		for _, pid := range pids {
+			data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+			if err != nil {
+				continue // exited
+			}
+			if tracerPID(string(data)) != want {
+				attached = false
+				break
+			}
+		}
+		if attached {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return fmt.Errorf("strace exited")
+		case <-deadline.C:
+			return fmt.Errorf("timed out")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tracerPID returns the TracerPid field of /proc/<pid>/status content.
+func tracerPID(status string) string {
+	for _, line := range strings.Split(status, "\n") {
+		if v, ok := strings.CutPrefix(line, "TracerPid:"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// cgroupTreePIDs returns the processes in cgPath and its child cgroups.
+func cgroupTreePIDs(cgPath string) ([]int, error) {
+	var pids []int
+	err := filepath.WalkDir(cgPath, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || !e.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+		if err != nil {
+			return nil // removed meanwhile
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(field); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read cgroup.procs: %w", err)
+	}
+	return pids, nil
+}
+
+// taskIDs returns the thread IDs of process pid.
+func taskIDs(pid int) map[int]bool {
+	tids := make(map[int]bool)
+	entries, _ := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	for _, e := range entries {
+		if tid, err := strconv.Atoi(e.Name()); err == nil {
+			tids[tid] = true
+		}
+	}
+	return tids
+}
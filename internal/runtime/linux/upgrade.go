@@ -0,0 +1,149 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// runnerDigestCache remembers the sha256 of the current runner binary until
+// the file changes.
+type runnerDigestCache struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	digest  string
+}
+
+// currentRunner returns the path of the runner new sessions get: the host
+// runner for bind and embedded injection, else the one in the runner layer.
+func (d *Driver) currentRunner() string {
+	if d.runner != "" {
+		return d.runner
+	}
+	return filepath.Join(d.dataDir, "layers", "runner", "rootfs", sandboxRunnerPath)
+}
+
+// currentRunnerDigest returns the path and sha256 of the current runner.
+func (d *Driver) currentRunnerDigest() (string, string, error) {
+	path := d.currentRunner()
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	c := &d.runnerDigest
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == path && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return path, c.digest, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", "", err
+	}
+	c.path, c.modTime, c.size = path, info.ModTime(), info.Size()
+	c.digest = hex.EncodeToString(h.Sum(nil))
+	return path, c.digest, nil
+}
+
+// EnsureRunner replaces the runner of a session with the current runner
+// binary when their digests differ. The new binary is uploaded in chunks over
+// the runner socket and the runner re-executes itself from it, keeping its
+// PID, shell and socket. Runners that predate the version request cannot be
+// upgraded and yield an error.
+func (d *Driver) EnsureRunner(ctx context.Context, sessionID string) (bool, error) {
+	state, err := d.readState(filepath.Join(d.dataDir, "sessions", sessionID, "state.json"))
+	if err != nil {
+		return false, fmt.Errorf("read state: %w", err)
+	}
+	path, want, err := d.currentRunnerDigest()
+	if err != nil {
+		// Nothing to compare against; keep the session as it is.
+		return false, nil
+	}
+	sock := fmt.Sprintf("/proc/%d/root/run/sandkasten/runner.sock", state.InitPID)
+
+	have, err := d.runnerVersion(sock)
+	if err != nil {
+		return false, err
+	}
+	if have == want {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("read runner: %w", err)
+	}
+	for off := 0; off < len(data); off += protocol.UpgradeChunkBytes {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		end := min(off+protocol.UpgradeChunkBytes, len(data))
+		resp, err := d.conns.do(sock, protocol.Request{
+			ID:            "upgrade-" + strconv.Itoa(off),
+			Type:          protocol.RequestUpgrade,
+			Digest:        want,
+			Offset:        int64(off),
+			ContentBase64: base64.StdEncoding.EncodeToString(data[off:end]),
+		})
+		if err != nil {
+			return false, fmt.Errorf("upload runner: %w", err)
+		}
+		if resp.Type == protocol.ResponseError {
+			return false, fmt.Errorf("upload runner: %s", resp.Error)
+		}
+	}
+
+	resp, err := d.conns.do(sock, protocol.Request{ID: "upgrade", Type: protocol.RequestUpgrade, Digest: want})
+	// Pooled connections die with the old runner process image.
+	d.conns.closeSocket(sock)
+	if err != nil {
+		return false, fmt.Errorf("upgrade runner: %w", err)
+	}
+	if resp.Type == protocol.ResponseError {
+		return false, fmt.Errorf("upgrade runner: %s", resp.Error)
+	}
+
+	if have, err = d.runnerVersion(sock); err != nil {
+		return false, err
+	}
+	if have != want {
+		return false, fmt.Errorf("runner reports digest %s after upgrade, want %s", have, want)
+	}
+	if d.logger != nil {
+		d.logger.Info("runner upgraded", "session_id", sessionID, "digest", want[:12])
+	}
+	return true, nil
+}
+
+// runnerVersion returns the digest the runner at sock reports.
+func (d *Driver) runnerVersion(sock string) (string, error) {
+	resp, err := d.conns.do(sock, protocol.Request{ID: "version", Type: protocol.RequestVersion})
+	if err != nil {
+		return "", fmt.Errorf("runner version: %w", err)
+	}
+	if resp.Type != protocol.ResponseVersion {
+		return "", fmt.Errorf("runner does not support self-update: %s", resp.Error)
+	}
+	return resp.Digest, nil
+}
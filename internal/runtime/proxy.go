@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// ErrPortUnreachable is returned by DialPort when nothing inside the session
+// accepts connections on the port.
+var ErrPortUnreachable = errors.New("port unreachable")
+
+// OpenProxy sends a proxy request for port over a fresh runner connection and
+// waits for the runner to connect. On success the returned conn is a raw
+// stream to the service; on failure conn is closed.
+func OpenProxy(conn net.Conn, port int) (net.Conn, error) {
+	req := protocol.Request{ID: uuid.New().String()[:8], Type: protocol.RequestProxy, Port: port}
+	r, resp, err := openStream(conn, req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.Type {
+	case protocol.ResponseProxy:
+	case protocol.ResponseError:
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrPortUnreachable, resp.Error)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unexpected runner response %q", resp.Type)
+	}
+	return &proxyConn{Conn: conn, r: r}, nil
+}
+
+// openStream sends req, which turns a fresh runner connection into a stream,
+// and reads the runner's response line. It returns the reader that consumed
+// the response, so no bytes following it are lost. On error conn is closed.
+func openStream(conn net.Conn, req protocol.Request) (*bufio.Reader, protocol.Response, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		conn.Close()
+		return nil, protocol.Response{}, fmt.Errorf("marshal request: %w", err)
+	}
+
+	// The runner answers within seconds (a proxy gives up connecting after
+	// 5s); the deadline only catches a runner that stopped answering.
+	conn.SetDeadline(time.Now().Add(15 * time.Second))
+	if _, err := conn.Write(append(reqJSON, '\n')); err != nil {
+		conn.Close()
+		return nil, protocol.Response{}, fmt.Errorf("write request: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, protocol.Response{}, fmt.Errorf("read response: %w", err)
+	}
+	var resp protocol.Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		conn.Close()
+		return nil, protocol.Response{}, fmt.Errorf("unmarshal response: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return r, resp, nil
+}
+
+// proxyConn reads through the reader that consumed the proxy response, in
+// case the service's first bytes arrived with it.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) { return c.r.Read(p) }
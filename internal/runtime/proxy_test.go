@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRunner answers the proxy request on conn with resp, then echoes.
+func fakeRunner(t *testing.T, conn net.Conn, resp protocol.Response) {
+	t.Helper()
+	go func() {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req protocol.Request
+		if json.Unmarshal(line, &req) != nil || req.Type != protocol.RequestProxy || req.Port != 8000 {
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write(append(data, '\n'))
+		io.Copy(conn, r)
+	}()
+}
+
+func TestOpenProxy(t *testing.T) {
+	client, server := net.Pipe()
+	fakeRunner(t, server, protocol.Response{Type: protocol.ResponseProxy, OK: true})
+
+	conn, err := OpenProxy(client, 8000)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestOpenProxyRefused(t *testing.T) {
+	client, server := net.Pipe()
+	fakeRunner(t, server, protocol.Response{Type: protocol.ResponseError, Error: "connect to port 8000: connection refused"})
+
+	_, err := OpenProxy(client, 8000)
+	assert.ErrorIs(t, err, ErrPortUnreachable)
+	assert.Contains(t, err.Error(), "connection refused")
+}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// AttachOpts selects the shell and the initial size of an attached terminal.
+type AttachOpts struct {
+	Shell string // key of protocol.Shells; "" = the session shell
+	Rows  int    // 0 = protocol.DefaultTerminalRows
+	Cols  int    // 0 = protocol.DefaultTerminalCols
+}
+
+// Terminal is an interactive shell attached to a session. Write sends
+// keystrokes; Read returns what the shell prints and io.EOF once it exited,
+// after which ExitCode is valid. Close hangs up the shell.
+type Terminal interface {
+	io.ReadWriteCloser
+	Resize(rows, cols int) error
+	ExitCode() int
+}
+
+// OpenTerminal sends an attach request over a fresh runner connection (see
+// protocol.RequestAttach). An error the runner reports is returned as is,
+// so callers can match protocol.ErrShellUnavailable. On failure conn is
+// closed.
+func OpenTerminal(conn net.Conn, opts AttachOpts) (Terminal, error) {
+	req := protocol.Request{ID: uuid.New().String()[:8], Type: protocol.RequestAttach, Shell: opts.Shell, Rows: opts.Rows, Cols: opts.Cols}
+	r, resp, err := openStream(conn, req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.Type {
+	case protocol.ResponseAttach:
+	case protocol.ResponseError:
+		conn.Close()
+		return nil, errors.New(resp.Error)
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unexpected runner response %q", resp.Type)
+	}
+	return &runnerTerminal{conn: conn, r: r}, nil
+}
+
+// runnerTerminal speaks the frames of an attach connection.
+type runnerTerminal struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	pending []byte // output not yet returned by Read
+	exited  bool
+	code    int
+	writeMu sync.Mutex // input and resizes come from different goroutines
+}
+
+func (t *runnerTerminal) Read(p []byte) (int, error) {
+	for len(t.pending) == 0 {
+		if t.exited {
+			return 0, io.EOF
+		}
+		resp, err := protocol.ReadResponseFrame(t.r)
+		if err != nil {
+			return 0, err
+		}
+		switch resp.Type {
+		case protocol.ResponseOutput:
+			if t.pending, err = base64.StdEncoding.DecodeString(resp.ContentBase64); err != nil {
+				return 0, fmt.Errorf("decode output: %w", err)
+			}
+		case protocol.ResponseExit:
+			t.exited, t.code = true, resp.ExitCode
+		}
+	}
+	n := copy(p, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+func (t *runnerTerminal) Write(p []byte) (int, error) {
+	if err := t.send(protocol.Request{Type: protocol.RequestInput, ContentBase64: base64.StdEncoding.EncodeToString(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *runnerTerminal) Resize(rows, cols int) error {
+	return t.send(protocol.Request{Type: protocol.RequestResize, Rows: rows, Cols: cols})
+}
+
+func (t *runnerTerminal) send(req protocol.Request) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return protocol.WriteRequestFrame(t.conn, req)
+}
+
+func (t *runnerTerminal) ExitCode() int { return t.code }
+
+func (t *runnerTerminal) Close() error { return t.conn.Close() }
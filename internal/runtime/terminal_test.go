@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAttach answers an attach request on conn with resp, then echoes input
+// frames as output until a resize, which it answers with an exit.
+func fakeAttach(t *testing.T, conn net.Conn, resp protocol.Response) {
+	t.Helper()
+	go func() {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req protocol.Request
+		if json.Unmarshal(line, &req) != nil || req.Type != protocol.RequestAttach || req.Shell != "python" || req.Rows != 24 {
+			return
+		}
+		data, _ := json.Marshal(resp)
+		conn.Write(append(data, '\n'))
+		for {
+			in, err := protocol.ReadRequestFrame(r)
+			if err != nil {
+				return
+			}
+			switch in.Type {
+			case protocol.RequestInput:
+				protocol.WriteResponseFrame(conn, protocol.Response{Type: protocol.ResponseOutput, ContentBase64: in.ContentBase64})
+			case protocol.RequestResize:
+				protocol.WriteResponseFrame(conn, protocol.Response{Type: protocol.ResponseExit, ExitCode: in.Cols})
+			}
+		}
+	}()
+}
+
+func TestOpenTerminal(t *testing.T) {
+	client, server := net.Pipe()
+	fakeAttach(t, server, protocol.Response{Type: protocol.ResponseAttach, OK: true})
+
+	term, err := OpenTerminal(client, AttachOpts{Shell: "python", Rows: 24})
+	require.NoError(t, err)
+	defer term.Close()
+
+	_, err = term.Write([]byte("1+1\r"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(term, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "1+1\r", string(buf))
+
+	require.NoError(t, term.Resize(30, 3))
+	_, err = term.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, term.ExitCode())
+}
+
+func TestOpenTerminalShellUnavailable(t *testing.T) {
+	client, server := net.Pipe()
+	fakeAttach(t, server, protocol.Response{Type: protocol.ResponseError, Error: protocol.ErrShellUnavailable + ": python is not installed in this image"})
+
+	_, err := OpenTerminal(client, AttachOpts{Shell: "python", Rows: 24})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "python is not installed")
+}
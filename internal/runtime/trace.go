@@ -0,0 +1,224 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExecTracer is implemented by drivers that can record what the processes
+// of a session touch while an exec runs.
+type ExecTracer interface {
+	// StartTrace starts recording the session's file, process and network
+	// activity. stop ends the recording and summarizes it.
+	StartTrace(ctx context.Context, sessionID string) (stop func() (*TraceReport, error), err error)
+}
+
+// TraceReport summarizes the activity recorded for an exec. Paths are as
+// the processes passed them, so relative paths are relative to their cwd.
+// Only calls that succeeded are listed, except connection attempts.
+type TraceReport struct {
+	Processes    int            `json:"processes"` // programs executed
+	Execs        []string       `json:"execs,omitempty"`
+	FilesRead    []string       `json:"files_read,omitempty"`
+	FilesWritten []string       `json:"files_written,omitempty"` // opened for writing, created or renamed to
+	FilesDeleted []string       `json:"files_deleted,omitempty"` // removed or renamed away
+	Connections  []string       `json:"connections,omitempty"`   // addresses connected or sent to
+	Listens      []string       `json:"listens,omitempty"`       // addresses bound
+	Syscalls     map[string]int `json:"syscalls,omitempty"`      // calls by name
+	// Truncated reports that a list was cut at MaxTraceEntries.
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"` // why the trace is missing
+}
+
+// MaxTraceEntries caps each list of a TraceReport.
+const MaxTraceEntries = 500
+
+var (
+	// straceLine matches a line of strace -f output: pid, syscall name,
+	// arguments and return value.
+	straceLine = regexp.MustCompile(`^(\d+)\s+([a-z0-9_]+)\((.*)\)\s+=\s+(-?\d+|\?)`)
+	// straceResumed matches the rest of a call strace split in two.
+	straceResumed = regexp.MustCompile(`^(\d+)\s+<\.\.\. ([a-z0-9_]+) resumed>(.*)$`)
+
+	inetAddr  = regexp.MustCompile(`sin_port=htons\((\d+)\), sin_addr=inet_addr\("([^"]+)"\)`)
+	inet6Addr = regexp.MustCompile(`sin6_port=htons\((\d+)\).*inet_pton\(AF_INET6, "([^"]+)"`)
+	unixAddr  = regexp.MustCompile(`sun_path=(@?"(?:[^"\\]|\\.)*")`)
+)
+
+// ParseStrace summarizes the output of strace -f. Calls of the processes
+// for which skip returns true are left out.
+func ParseStrace(r io.Reader, skip func(pid int) bool) (*TraceReport, error) {
+	report := &TraceReport{Syscalls: make(map[string]int)}
+	seen := make(map[string]bool)
+	add := func(list *[]string, kind, s string) {
+		if s == "" || seen[kind+s] {
+			return
+		}
+		seen[kind+s] = true
+		if len(*list) >= MaxTraceEntries {
+			report.Truncated = true
+			return
+		}
+		*list = append(*list, s)
+	}
+
+	unfinished := make(map[string]string) // pid -> start of a split call
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if before, ok := strings.CutSuffix(line, " <unfinished ...>"); ok {
+			if pid, _, ok := strings.Cut(before, " "); ok {
+				unfinished[pid] = before
+			}
+			continue
+		}
+		if m := straceResumed.FindStringSubmatch(line); m != nil {
+			start, ok := unfinished[m[1]]
+			if !ok {
+				continue
+			}
+			delete(unfinished, m[1])
+			line = start + m[3]
+		}
+		m := straceLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		pid, _ := strconv.Atoi(m[1])
+		if skip != nil && skip(pid) {
+			continue
+		}
+		name, args := m[2], m[3]
+		ok := m[4] != "?" && !strings.HasPrefix(m[4], "-")
+		report.Syscalls[name]++
+
+		paths := quotedArgs(args)
+		switch name {
+		case "execve", "execveat":
+			if ok && len(paths) > 0 {
+				report.Processes++
+				add(&report.Execs, "x", paths[0])
+			}
+		case "open", "openat", "openat2", "creat":
+			if !ok || len(paths) == 0 {
+				continue
+			}
+			if name == "creat" || openForWriting(args) {
+				add(&report.FilesWritten, "w", paths[0])
+			} else {
+				add(&report.FilesRead, "r", paths[0])
+			}
+		case "truncate", "mkdir", "mkdirat":
+			if ok && len(paths) > 0 {
+				add(&report.FilesWritten, "w", paths[0])
+			}
+		case "unlink", "unlinkat", "rmdir":
+			if ok && len(paths) > 0 {
+				add(&report.FilesDeleted, "d", paths[0])
+			}
+		case "rename", "renameat", "renameat2":
+			if ok && len(paths) > 1 {
+				add(&report.FilesDeleted, "d", paths[0])
+				add(&report.FilesWritten, "w", paths[1])
+			}
+		case "connect", "sendto":
+			if ok || strings.Contains(line, "EINPROGRESS") {
+				add(&report.Connections, "c", sockAddr(args))
+			}
+		case "bind":
+			if ok {
+				add(&report.Listens, "l", sockAddr(args))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// openForWriting reports whether the flags of an open call allow writing.
+func openForWriting(args string) bool {
+	args = args[strings.LastIndex(args, `"`)+1:] // flags follow the path
+	for _, flag := range []string{"O_WRONLY", "O_RDWR", "O_CREAT", "O_TRUNC", "O_APPEND"} {
+		if strings.Contains(args, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// sockAddr formats the socket address in strace arguments as host:port or
+// unix:path, or returns "" for other families.
+func sockAddr(args string) string {
+	if m := inetAddr.FindStringSubmatch(args); m != nil {
+		return m[2] + ":" + m[1]
+	}
+	if m := inet6Addr.FindStringSubmatch(args); m != nil {
+		return "[" + m[2] + "]:" + m[1]
+	}
+	if m := unixAddr.FindStringSubmatch(args); m != nil {
+		abstract := strings.HasPrefix(m[1], "@")
+		if path := quotedArgs(strings.TrimPrefix(m[1], "@")); len(path) > 0 {
+			if abstract {
+				return "unix:@" + path[0]
+			}
+			return "unix:" + path[0]
+		}
+	}
+	return ""
+}
+
+// quotedArgs returns the C string literals in strace arguments, unescaped,
+// in order. Literals strace cut short keep the part it printed.
+func quotedArgs(args string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		if args[i] != '"' {
+			continue
+		}
+		var b strings.Builder
+		for i++; i < len(args) && args[i] != '"'; i++ {
+			c := args[i]
+			if c != '\\' || i+1 >= len(args) {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			switch e := args[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'x':
+				if i+2 < len(args) {
+					if v, err := strconv.ParseUint(args[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 2
+						continue
+					}
+				}
+				b.WriteByte(e)
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				j := i
+				for j < len(args) && j < i+3 && args[j] >= '0' && args[j] <= '7' {
+					j++
+				}
+				v, _ := strconv.ParseUint(args[i:j], 8, 8)
+				b.WriteByte(byte(v))
+				i = j - 1
+			default:
+				b.WriteByte(e)
+			}
+		}
+		out = append(out, b.String())
+	}
+	return out
+}
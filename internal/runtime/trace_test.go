@@ -0,0 +1,53 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const straceOutput = `100   accept4(3, NULL, NULL, SOCK_CLOEXEC|SOCK_NONBLOCK) = 7
+200   execve("/usr/bin/python3", ["python3", "fetch.py"], 0x7ffd5a1c /* 12 vars */) = 0
+200   openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3
+200   openat(AT_FDCWD, "/etc/missing", O_RDONLY) = -1 ENOENT (No such file or directory)
+200   openat(AT_FDCWD, "out/result \"1\".json", O_WRONLY|O_CREAT|O_TRUNC|O_CLOEXEC, 0666 <unfinished ...>
+201   execve("/bin/sh", ["sh", "-c", "rm old.txt"], 0x55d0 /* 12 vars */) = 0
+200   <... openat resumed>) = 4
+201   unlinkat(AT_FDCWD, "old.txt", 0) = 0
+200   renameat2(AT_FDCWD, "tmp.part", AT_FDCWD, "data.bin", RENAME_NOREPLACE) = 0
+200   connect(5, {sa_family=AF_INET, sin_port=htons(443), sin_addr=inet_addr("93.184.216.34")}, 16) = -1 EINPROGRESS (Operation now in progress)
+200   connect(6, {sa_family=AF_INET6, sin6_port=htons(53), sin6_flowinfo=htonl(0), inet_pton(AF_INET6, "::1", &sin6_addr), sin6_scope_id=0}, 28) = 0
+200   connect(7, {sa_family=AF_UNIX, sun_path="/run/app.sock"}, 110) = -1 ECONNREFUSED (Connection refused)
+200   bind(8, {sa_family=AF_INET, sin_port=htons(8000), sin_addr=inet_addr("0.0.0.0")}, 16) = 0
+200   sendto(5, "GET / HTTP/1.1\r\n", 16, MSG_NOSIGNAL, NULL, 0) = 16
+201   +++ exited with 0 +++
+`
+
+func TestParseStrace(t *testing.T) {
+	report, err := ParseStrace(strings.NewReader(straceOutput), func(pid int) bool { return pid == 100 })
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Processes)
+	assert.Equal(t, []string{"/usr/bin/python3", "/bin/sh"}, report.Execs)
+	assert.Equal(t, []string{"/etc/ld.so.cache"}, report.FilesRead)
+	assert.Equal(t, []string{`out/result "1".json`, "data.bin"}, report.FilesWritten)
+	assert.Equal(t, []string{"old.txt", "tmp.part"}, report.FilesDeleted)
+	assert.Equal(t, []string{"93.184.216.34:443", "[::1]:53"}, report.Connections)
+	assert.Equal(t, []string{"0.0.0.0:8000"}, report.Listens)
+	assert.Equal(t, 3, report.Syscalls["openat"])
+	assert.Zero(t, report.Syscalls["accept4"], "skipped process")
+	assert.False(t, report.Truncated)
+}
+
+func TestParseStrace_Truncated(t *testing.T) {
+	var b strings.Builder
+	for i := range MaxTraceEntries + 1 {
+		b.WriteString(`1  openat(AT_FDCWD, "/f` + strings.Repeat("x", i) + `", O_RDONLY) = 3` + "\n")
+	}
+	report, err := ParseStrace(strings.NewReader(b.String()), nil)
+	require.NoError(t, err)
+	assert.Len(t, report.FilesRead, MaxTraceEntries)
+	assert.True(t, report.Truncated)
+}
@@ -0,0 +1,61 @@
+package wasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitArgs splits a command line into argv with POSIX shell quoting rules
+// for '...', "..." and backslash escapes. There is no shell behind wasm
+// sessions, so expansion, pipes and redirection are not supported.
+func splitArgs(cmd string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range cmd {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,40 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", cmd: "", want: nil},
+		{name: "words", cmd: "python3  -c\tpass", want: []string{"python3", "-c", "pass"}},
+		{name: "single quotes", cmd: `echo 'a "b" \c'`, want: []string{"echo", `a "b" \c`}},
+		{name: "double quotes", cmd: `echo "a 'b' \"c\""`, want: []string{"echo", `a 'b' "c"`}},
+		{name: "empty quoted arg", cmd: `x '' ""`, want: []string{"x", "", ""}},
+		{name: "escaped space", cmd: `cat a\ b`, want: []string{"cat", "a b"}},
+		{name: "adjacent quotes join", cmd: `a'b'"c"d`, want: []string{"abcd"}},
+		{name: "no shell operators", cmd: "ls | wc", want: []string{"ls", "|", "wc"}},
+		{name: "unterminated single quote", cmd: "echo 'a", wantErr: true},
+		{name: "unterminated double quote", cmd: `echo "a`, wantErr: true},
+		{name: "trailing backslash", cmd: `echo a\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitArgs(tt.cmd)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
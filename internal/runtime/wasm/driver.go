@@ -0,0 +1,568 @@
+// Package wasm runs sessions of images with type "wasm" in-process on wazero
+// instead of in a namespace sandbox.
+//
+// A wasm image is a single WASI (preview 1) module. The session has no
+// process between execs: every exec instantiates the module with the command
+// line as argv and the session's workspace directory preopened at /workspace,
+// runs it to completion and discards the instance. Files written to
+// /workspace persist across execs like in any other session. Compiled modules
+// are cached per image, so an exec costs an instantiation, not a compile.
+//
+// Driver wraps the configured runtime and hands every other image to it.
+//
+//	Daemon → Driver.Create() → wasm image? → session dir + marker (no process)
+//	Daemon → Driver.Exec() → instantiate module(argv, /workspace) → output, exit code
+package wasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// ImageType is the meta.json "type" of wasm images.
+const ImageType = "wasm"
+
+// ModuleFile is the module inside a wasm image directory.
+const ModuleFile = "module.wasm"
+
+// sessionFile marks a session directory as a wasm session and survives
+// daemon restarts; wasm sessions hold no other state.
+const sessionFile = "wasm.json"
+
+const (
+	workspaceUID = 1000
+	workspaceGID = 1000
+)
+
+// Runtime is the driver wasm sessions are layered on; it serves all other images.
+type Runtime interface {
+	runtime.Driver
+	ListSessionDirIDs(ctx context.Context) ([]string, error)
+	ListHostResources(ctx context.Context) ([]runtime.HostResource, error)
+	RemoveHostResource(ctx context.Context, r runtime.HostResource) error
+	ResolveImage(ctx context.Context, ref string) (string, error)
+}
+
+type Driver struct {
+	Runtime // non-wasm sessions
+
+	cfg     *config.Config
+	dataDir string
+	logger  *slog.Logger
+	engine  wazero.Runtime
+
+	mu       sync.Mutex
+	modules  map[string]compiledModule // image name -> compiled module
+	sessions map[string]*session
+}
+
+type compiledModule struct {
+	hash   string
+	module wazero.CompiledModule
+}
+
+// session is the marker content of a wasm session.
+type session struct {
+	Image       string `json:"image"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+}
+
+// imageMeta is the subset of an image's meta.json the driver reads.
+type imageMeta struct {
+	Type string `json:"type"`
+	Hash string `json:"hash"`
+}
+
+// NewDriver layers wasm sessions on next. Module memory is capped at
+// defaults.mem_limit_mb.
+func NewDriver(cfg *config.Config, next Runtime, logger *slog.Logger) *Driver {
+	ctx := context.Background()
+	rc := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithCompilationCache(wazero.NewCompilationCache())
+	if mb := cfg.Defaults.MemLimitMB; mb > 0 {
+		rc = rc.WithMemoryLimitPages(uint32(min(mb*16, 65536))) // 64 KiB pages
+	}
+	engine := wazero.NewRuntimeWithConfig(ctx, rc)
+	wasi_snapshot_preview1.MustInstantiate(ctx, engine)
+
+	return &Driver{
+		Runtime:  next,
+		cfg:      cfg,
+		dataDir:  cfg.DataDir,
+		logger:   logger,
+		engine:   engine,
+		modules:  make(map[string]compiledModule),
+		sessions: make(map[string]*session),
+	}
+}
+
+func (d *Driver) Close() error {
+	err := d.engine.Close(context.Background())
+	return errors.Join(err, d.Runtime.Close())
+}
+
+// imageMeta returns the meta of image and whether it is a wasm image.
+func (d *Driver) imageMeta(image string) (imageMeta, bool) {
+	var meta imageMeta
+	data, err := os.ReadFile(filepath.Join(d.dataDir, "images", image, "meta.json"))
+	if err != nil || json.Unmarshal(data, &meta) != nil {
+		return meta, false
+	}
+	return meta, meta.Type == ImageType
+}
+
+// module returns the compiled module of image, recompiling when the image
+// was replaced since the last compile.
+func (d *Driver) module(ctx context.Context, image string) (wazero.CompiledModule, error) {
+	meta, ok := d.imageMeta(image)
+	if !ok {
+		return nil, fmt.Errorf("image %s is not a wasm image", image)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.modules[image]; ok && c.hash == meta.Hash {
+		return c.module, nil
+	}
+	code, err := os.ReadFile(filepath.Join(d.dataDir, "images", image, ModuleFile))
+	if err != nil {
+		return nil, fmt.Errorf("read module: %w", err)
+	}
+	compiled, err := d.engine.CompileModule(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("compile module: %w", err)
+	}
+	d.modules[image] = compiledModule{hash: meta.Hash, module: compiled}
+	return compiled, nil
+}
+
+// session returns the wasm session sessionID, loading its marker after a
+// daemon restart. ok is false for sessions of the wrapped runtime.
+func (d *Driver) session(sessionID string) (*session, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.sessions[sessionID]; ok {
+		return s, true
+	}
+	data, err := os.ReadFile(filepath.Join(d.sessionDir(sessionID), sessionFile))
+	if err != nil {
+		return nil, false
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, false
+	}
+	d.sessions[sessionID] = &s
+	return &s, true
+}
+
+func (d *Driver) saveSession(sessionID string, s *session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.sessionDir(sessionID), sessionFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.sessions[sessionID] = s
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	meta, ok := d.imageMeta(opts.Image)
+	if !ok {
+		return d.Runtime.Create(ctx, opts)
+	}
+	d.logger.Debug("runtime create wasm session", "session_id", opts.SessionID, "image", opts.Image, "workspace_id", opts.WorkspaceID)
+
+	if _, err := d.module(ctx, opts.Image); err != nil {
+		class := runtime.CreateFailureOther
+		if errors.Is(err, fs.ErrNotExist) {
+			class = runtime.CreateFailureImageMissing
+		}
+		return nil, &runtime.CreateError{Stage: "image", Class: class, Err: err}
+	}
+	mnt := filepath.Join(d.sessionDir(opts.SessionID), "mnt")
+	if err := ensureWorkspaceDir(filepath.Join(mnt, "workspace")); err != nil {
+		os.RemoveAll(d.sessionDir(opts.SessionID))
+		return nil, err
+	}
+	if opts.WorkspaceID != "" {
+		if err := ensureWorkspaceDir(d.workspacePath(opts.WorkspaceID)); err != nil {
+			os.RemoveAll(d.sessionDir(opts.SessionID))
+			return nil, err
+		}
+	}
+	if err := d.saveSession(opts.SessionID, &session{Image: opts.Image, WorkspaceID: opts.WorkspaceID}); err != nil {
+		os.RemoveAll(d.sessionDir(opts.SessionID))
+		return nil, fmt.Errorf("write session: %w", err)
+	}
+	return &runtime.SessionInfo{
+		SessionID:   opts.SessionID,
+		Mnt:         mnt,
+		ImageDigest: meta.Hash,
+	}, nil
+}
+
+func (d *Driver) Exec(ctx context.Context, sessionID string, req protocol.Request) (*protocol.Response, error) {
+	s, ok := d.session(sessionID)
+	if !ok {
+		return d.Runtime.Exec(ctx, sessionID, req)
+	}
+	root := d.workspaceRoot(sessionID, s)
+	switch req.Type {
+	case protocol.RequestExec, protocol.RequestExecStream:
+		return d.exec(ctx, s, root, req)
+	case protocol.RequestWrite:
+		return runtime.WriteWorkspaceFile(root, workspaceUID, workspaceGID, req), nil
+	case protocol.RequestRead:
+		return runtime.ReadWorkspaceFile(root, req), nil
+	case protocol.RequestResize:
+		// No terminal: the module's output is captured, not displayed.
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseResize, OK: true}, nil
+	default:
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseError, Error: "unknown request type: " + string(req.Type)}, nil
+	}
+}
+
+// exec runs the module once with req.Cmd split into argv. Output is stdout
+// and stderr interleaved; a trap exits with 1 and appends the trap message.
+func (d *Driver) exec(ctx context.Context, s *session, root string, req protocol.Request) (*protocol.Response, error) {
+	if req.Shell != "" {
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseError, Error: protocol.ErrShellUnavailable + ": wasm sessions run the image's module, not a shell"}, nil
+	}
+	args, err := splitArgs(req.Cmd)
+	if err != nil || len(args) == 0 {
+		msg := "empty command"
+		if err != nil {
+			msg = err.Error()
+		}
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseExec, ExitCode: 2, Cwd: "/workspace", Output: msg + "\n"}, nil
+	}
+	compiled, err := d.module(ctx, s.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Duration(d.cfg.Defaults.MaxExecTimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out := runtime.NewOutputBuffer(req)
+	wfs, err := newWorkspaceFS(root)
+	if err != nil {
+		return nil, fmt.Errorf("open workspace: %w", err)
+	}
+	defer wfs.Close()
+	fsConfig := wazero.NewFSConfig().(sysfs.FSConfig).WithSysFSMount(wfs, "/workspace")
+	modConfig := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(args...).
+		WithEnv("HOME", "/workspace").
+		WithEnv("PWD", "/workspace").
+		WithStdout(out).
+		WithStderr(out).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+
+	start := time.Now()
+	mod, err := d.engine.InstantiateModule(ctx, compiled, modConfig)
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *sys.ExitError
+		switch {
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded:
+			return &protocol.Response{
+				ID:         req.ID,
+				Type:       protocol.ResponseExec,
+				ExitCode:   -1,
+				Output:     "timeout: command exceeded " + timeout.String(),
+				DurationMs: time.Since(start).Milliseconds(),
+			}, nil
+		case errors.As(err, &exitErr):
+			exitCode = int(exitErr.ExitCode())
+		default:
+			fmt.Fprintf(out, "\nwasm: %v\n", err)
+			exitCode = 1
+		}
+	}
+
+	resp := &protocol.Response{
+		ID:         req.ID,
+		Type:       protocol.ResponseExec,
+		ExitCode:   exitCode,
+		Cwd:        "/workspace",
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	out.SetOutput(resp, req.OutputBase64)
+	return resp, nil
+}
+
+func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
+	if _, ok := d.session(sessionID); !ok {
+		return d.Runtime.Destroy(ctx, sessionID)
+	}
+	d.mu.Lock()
+	delete(d.sessions, sessionID)
+	d.mu.Unlock()
+	return os.RemoveAll(d.sessionDir(sessionID))
+}
+
+// IsRunning is true for as long as a wasm session exists; it has no process
+// that could die.
+func (d *Driver) IsRunning(ctx context.Context, sessionID string) (bool, error) {
+	if _, ok := d.session(sessionID); ok {
+		return true, nil
+	}
+	return d.Runtime.IsRunning(ctx, sessionID)
+}
+
+// Stats reports only the memory limit; instances live for one exec.
+func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.SessionStats, error) {
+	if _, ok := d.session(sessionID); !ok {
+		return d.Runtime.Stats(ctx, sessionID)
+	}
+	return &protocol.SessionStats{MemoryLimit: int64(d.cfg.Defaults.MemLimitMB) * 1024 * 1024}, nil
+}
+
+// ReclaimMemory forwards to the wrapped runtime. Wasm sessions hold no memory
+// between execs.
+func (d *Driver) ReclaimMemory(ctx context.Context, sessionID string) (int64, error) {
+	if _, ok := d.session(sessionID); ok {
+		return 0, nil
+	}
+	if r, ok := d.Runtime.(runtime.MemoryReclaimer); ok {
+		return r.ReclaimMemory(ctx, sessionID)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// DialPort forwards to the wrapped runtime. Wasm sessions have no network
+// and run no servers.
+func (d *Driver) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	if _, ok := d.session(sessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if p, ok := d.Runtime.(runtime.PortDialer); ok {
+		return p.DialPort(ctx, sessionID, port)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// Attach forwards to the wrapped runtime. Wasm sessions run the image's
+// module, not a shell.
+func (d *Driver) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	if _, ok := d.session(sessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if a, ok := d.Runtime.(runtime.TerminalAttacher); ok {
+		return a.Attach(ctx, sessionID, opts)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// MemoryPressure forwards to the wrapped runtime, which knows the host.
+func (d *Driver) MemoryPressure() (float64, error) {
+	if r, ok := d.Runtime.(runtime.MemoryPressureReporter); ok {
+		return r.MemoryPressure()
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// EnsureRunner forwards to the wrapped runtime. Wasm sessions have no runner.
+func (d *Driver) EnsureRunner(ctx context.Context, sessionID string) (bool, error) {
+	if _, ok := d.session(sessionID); ok {
+		return false, nil
+	}
+	if u, ok := d.Runtime.(runtime.RunnerUpdater); ok {
+		return u.EnsureRunner(ctx, sessionID)
+	}
+	return false, nil
+}
+
+// MountSharedChannel forwards to the wrapped runtime. Module file access
+// only reaches /workspace, so wasm sessions cannot join a channel.
+func (d *Driver) MountSharedChannel(ctx context.Context, sessionID, channel string, sizeBytes int64) error {
+	if _, ok := d.session(sessionID); ok {
+		return errors.ErrUnsupported
+	}
+	if m, ok := d.Runtime.(runtime.SharedChannelMounter); ok {
+		return m.MountSharedChannel(ctx, sessionID, channel, sizeBytes)
+	}
+	return errors.ErrUnsupported
+}
+
+func (d *Driver) ReleaseSharedChannel(ctx context.Context, channel string) error {
+	if m, ok := d.Runtime.(runtime.SharedChannelMounter); ok {
+		return m.ReleaseSharedChannel(ctx, channel)
+	}
+	return nil
+}
+
+// CheckDeterminism forwards to the wrapped runtime.
+func (d *Driver) CheckDeterminism(det *runtime.Determinism) error {
+	if dd, ok := d.Runtime.(runtime.DeterministicDriver); ok {
+		return dd.CheckDeterminism(det)
+	}
+	return errors.ErrUnsupported
+}
+
+// Rebase forwards to the wrapped runtime. Wasm sessions keep no files outside
+// /workspace, so there is nothing to rebase.
+func (d *Driver) Rebase(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	if _, ok := d.session(opts.SessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if _, ok := d.imageMeta(opts.Image); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if r, ok := d.Runtime.(runtime.ImageRebaser); ok {
+		return r.Rebase(ctx, opts)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// ImageScan forwards to the wrapped runtime. Wasm modules have no
+// packages to scan.
+func (d *Driver) ImageScan(ctx context.Context, image string) (*imagescan.Report, error) {
+	if _, ok := d.imageMeta(image); ok {
+		return nil, nil
+	}
+	if r, ok := d.Runtime.(runtime.ImageScanReader); ok {
+		return r.ImageScan(ctx, image)
+	}
+	return nil, nil
+}
+
+// TuneCPU forwards to the wrapped runtime. Wasm sessions have no cgroup.
+func (d *Driver) TuneCPU(ctx context.Context, sessionID string, t runtime.CPUTuning) error {
+	if _, ok := d.session(sessionID); ok {
+		return errors.ErrUnsupported
+	}
+	if c, ok := d.Runtime.(runtime.CPUTuner); ok {
+		return c.TuneCPU(ctx, sessionID, t)
+	}
+	return errors.ErrUnsupported
+}
+
+// HostWorkspace returns the directory preopened at /workspace.
+func (d *Driver) HostWorkspace(sessionID, workspaceID string) string {
+	return d.workspaceRoot(sessionID, &session{WorkspaceID: workspaceID})
+}
+
+func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error {
+	s, ok := d.session(sessionID)
+	if !ok {
+		return d.Runtime.MountWorkspace(ctx, sessionID, workspaceID)
+	}
+	if _, err := os.Stat(d.workspacePath(workspaceID)); err != nil {
+		return fmt.Errorf("workspace directory %s: %w", workspaceID, err)
+	}
+	return d.saveSession(sessionID, &session{Image: s.Image, WorkspaceID: workspaceID})
+}
+
+// ValidateImage compiles wasm images; others go to the wrapped runtime.
+func (d *Driver) ValidateImage(ctx context.Context, image string) error {
+	name, err := d.ResolveImage(ctx, image)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.imageMeta(name); !ok {
+		return d.Runtime.ValidateImage(ctx, image)
+	}
+	_, err = d.module(ctx, name)
+	return err
+}
+
+func (d *Driver) ImageDigest(ctx context.Context, image string) (string, error) {
+	if meta, ok := d.imageMeta(image); ok {
+		return meta.Hash, nil
+	}
+	return d.Runtime.ImageDigest(ctx, image)
+}
+
+// ListSessionDirIDs adds wasm sessions to those of the wrapped runtime.
+func (d *Driver) ListSessionDirIDs(ctx context.Context) ([]string, error) {
+	ids, err := d.Runtime.ListSessionDirIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(d.dataDir, "sessions"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read sessions dir: %w", err)
+	}
+	for _, e := range entries {
+		if seen[e.Name()] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(d.sessionDir(e.Name()), sessionFile)); err == nil {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+func (d *Driver) sessionDir(sessionID string) string {
+	return filepath.Join(d.dataDir, "sessions", sessionID)
+}
+
+func (d *Driver) workspacePath(workspaceID string) string {
+	return filepath.Join(d.dataDir, "workspaces", workspaceID)
+}
+
+// workspaceRoot is the host directory preopened at /workspace.
+func (d *Driver) workspaceRoot(sessionID string, s *session) string {
+	if s.WorkspaceID != "" {
+		return d.workspacePath(s.WorkspaceID)
+	}
+	return filepath.Join(d.sessionDir(sessionID), "mnt", "workspace")
+}
+
+func ensureWorkspaceDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	if err := os.Chown(dir, workspaceUID, workspaceGID); err != nil {
+		return fmt.Errorf("chown %s: %w", dir, err)
+	}
+	return nil
+}
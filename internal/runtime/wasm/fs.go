@@ -0,0 +1,350 @@
+package wasm
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// workspaceFS is the /workspace preopen. Module file access runs in the
+// daemon, so unlike in a namespace sandbox a symlink would resolve against
+// the host. Every operation therefore goes through an os.Root, which
+// resolves each path component relative to the workspace directory and
+// refuses symlinks leading out of it, also when a namespace session sharing
+// the workspace swaps a component while the operation runs. Symlinks cannot
+// be created. Created files and directories are handed to the sandbox user.
+type workspaceFS struct {
+	experimentalsys.UnimplementedFS
+	root *os.Root
+}
+
+func newWorkspaceFS(dir string) (*workspaceFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &workspaceFS{root: root}, nil
+}
+
+// Close releases the workspace directory.
+func (w *workspaceFS) Close() error {
+	return w.root.Close()
+}
+
+// checkPath returns p, relative to the preopen, as a name inside the root:
+// "." for the workspace itself. It fails with ENOENT for names os.Root would
+// refuse anyway (leading out of the workspace).
+func checkPath(p string) (string, experimentalsys.Errno) {
+	if p == "" || p == "." {
+		return ".", 0
+	}
+	name := path.Clean(p)
+	if path.IsAbs(name) || name == ".." || len(name) > 2 && name[:3] == "../" {
+		return "", experimentalsys.ENOENT
+	}
+	return name, 0
+}
+
+// errno maps an os.Root error to an Errno. Paths escaping the root (through
+// a symlink) are reported as ELOOP, like a symlink loop.
+func errno(err error) experimentalsys.Errno {
+	if err == nil {
+		return 0
+	}
+	var pe *fs.PathError
+	if errors.As(err, &pe) && pe.Err != nil && pe.Err.Error() == "path escapes from parent" {
+		return experimentalsys.ELOOP
+	}
+	return experimentalsys.UnwrapOSError(err)
+}
+
+func (w *workspaceFS) chown(name string) {
+	_ = w.root.Lchown(name, workspaceUID, workspaceGID)
+}
+
+func (w *workspaceFS) OpenFile(p string, flag experimentalsys.Oflag, perm fs.FileMode) (experimentalsys.File, experimentalsys.Errno) {
+	name, e := checkPath(p)
+	if e != 0 {
+		return nil, e
+	}
+	if flag&experimentalsys.O_NOFOLLOW != 0 {
+		if info, err := w.root.Lstat(name); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return nil, experimentalsys.ELOOP
+		}
+	}
+	f, err := w.root.OpenFile(name, osFlag(flag), perm)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if flag&experimentalsys.O_DIRECTORY != 0 {
+		if info, err := f.Stat(); err != nil || !info.IsDir() {
+			f.Close()
+			return nil, experimentalsys.ENOTDIR
+		}
+	}
+	if flag&experimentalsys.O_CREAT != 0 {
+		w.chown(name)
+	}
+	return &workspaceFile{f: f, root: w.root, name: name, append: flag&experimentalsys.O_APPEND != 0}, 0
+}
+
+// osFlag converts wazero open flags to os flags. O_DIRECTORY and O_NOFOLLOW
+// are checked by OpenFile.
+func osFlag(flag experimentalsys.Oflag) int {
+	var f int
+	switch {
+	case flag&experimentalsys.O_RDWR != 0:
+		f = os.O_RDWR
+	case flag&experimentalsys.O_WRONLY != 0:
+		f = os.O_WRONLY
+	default:
+		f = os.O_RDONLY
+	}
+	for _, m := range []struct {
+		from experimentalsys.Oflag
+		to   int
+	}{
+		{experimentalsys.O_APPEND, os.O_APPEND},
+		{experimentalsys.O_CREAT, os.O_CREATE},
+		{experimentalsys.O_EXCL, os.O_EXCL},
+		{experimentalsys.O_TRUNC, os.O_TRUNC},
+		{experimentalsys.O_SYNC, os.O_SYNC},
+	} {
+		if flag&m.from != 0 {
+			f |= m.to
+		}
+	}
+	return f
+}
+
+func (w *workspaceFS) Lstat(p string) (sys.Stat_t, experimentalsys.Errno) {
+	name, e := checkPath(p)
+	if e != 0 {
+		return sys.Stat_t{}, e
+	}
+	info, err := w.root.Lstat(name)
+	if err != nil {
+		return sys.Stat_t{}, errno(err)
+	}
+	return sys.NewStat_t(info), 0
+}
+
+func (w *workspaceFS) Stat(p string) (sys.Stat_t, experimentalsys.Errno) {
+	name, e := checkPath(p)
+	if e != 0 {
+		return sys.Stat_t{}, e
+	}
+	info, err := w.root.Stat(name)
+	if err != nil {
+		return sys.Stat_t{}, errno(err)
+	}
+	return sys.NewStat_t(info), 0
+}
+
+func (w *workspaceFS) Mkdir(p string, perm fs.FileMode) experimentalsys.Errno {
+	name, e := checkPath(p)
+	if e != 0 {
+		return e
+	}
+	if err := w.root.Mkdir(name, perm); err != nil {
+		return errno(err)
+	}
+	w.chown(name)
+	return 0
+}
+
+func (w *workspaceFS) Chmod(p string, perm fs.FileMode) experimentalsys.Errno {
+	name, e := checkPath(p)
+	if e != 0 {
+		return e
+	}
+	return errno(w.root.Chmod(name, perm))
+}
+
+func (w *workspaceFS) Rename(from, to string) experimentalsys.Errno {
+	fromName, e := checkPath(from)
+	if e != 0 {
+		return e
+	}
+	toName, e := checkPath(to)
+	if e != 0 {
+		return e
+	}
+	return errno(w.root.Rename(fromName, toName))
+}
+
+func (w *workspaceFS) Rmdir(p string) experimentalsys.Errno {
+	name, e := checkPath(p)
+	if e != 0 {
+		return e
+	}
+	info, err := w.root.Lstat(name)
+	if err != nil {
+		return errno(err)
+	}
+	if !info.IsDir() {
+		return experimentalsys.ENOTDIR
+	}
+	return errno(w.root.Remove(name))
+}
+
+func (w *workspaceFS) Unlink(p string) experimentalsys.Errno {
+	name, e := checkPath(p)
+	if e != 0 {
+		return e
+	}
+	info, err := w.root.Lstat(name)
+	if err != nil {
+		return errno(err)
+	}
+	if info.IsDir() {
+		return experimentalsys.EISDIR
+	}
+	return errno(w.root.Remove(name))
+}
+
+func (w *workspaceFS) Utimens(p string, atim, mtim int64) experimentalsys.Errno {
+	name, e := checkPath(p)
+	if e != 0 {
+		return e
+	}
+	return errno(w.root.Chtimes(name, utime(atim), utime(mtim)))
+}
+
+// utime converts a wazero timestamp; the zero time leaves it unchanged.
+func utime(nsec int64) time.Time {
+	if nsec == experimentalsys.UTIME_OMIT {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+func (w *workspaceFS) Readlink(p string) (string, experimentalsys.Errno) {
+	name, e := checkPath(p)
+	if e != 0 {
+		return "", e
+	}
+	target, err := w.root.Readlink(name)
+	return target, errno(err)
+}
+
+func (w *workspaceFS) Link(string, string) experimentalsys.Errno {
+	return experimentalsys.EPERM
+}
+
+func (w *workspaceFS) Symlink(string, string) experimentalsys.Errno {
+	return experimentalsys.EPERM
+}
+
+// workspaceFile is a file opened through the workspace root.
+type workspaceFile struct {
+	experimentalsys.UnimplementedFile
+	f      *os.File
+	root   *os.Root
+	name   string
+	append bool
+}
+
+func (w *workspaceFile) stat() (sys.Stat_t, experimentalsys.Errno) {
+	info, err := w.f.Stat()
+	if err != nil {
+		return sys.Stat_t{}, errno(err)
+	}
+	return sys.NewStat_t(info), 0
+}
+
+func (w *workspaceFile) Dev() (uint64, experimentalsys.Errno) {
+	st, e := w.stat()
+	return st.Dev, e
+}
+
+func (w *workspaceFile) Ino() (sys.Inode, experimentalsys.Errno) {
+	st, e := w.stat()
+	return st.Ino, e
+}
+
+func (w *workspaceFile) IsDir() (bool, experimentalsys.Errno) {
+	st, e := w.stat()
+	return st.Mode.IsDir(), e
+}
+
+func (w *workspaceFile) IsAppend() bool {
+	return w.append
+}
+
+func (w *workspaceFile) Stat() (sys.Stat_t, experimentalsys.Errno) {
+	return w.stat()
+}
+
+func (w *workspaceFile) Read(buf []byte) (int, experimentalsys.Errno) {
+	n, err := w.f.Read(buf)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, errno(err)
+}
+
+func (w *workspaceFile) Pread(buf []byte, off int64) (int, experimentalsys.Errno) {
+	n, err := w.f.ReadAt(buf, off)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, errno(err)
+}
+
+// fileOffset keeps vet from mistaking Seek, which returns an Errno as the
+// File interface requires, for a broken io.Seeker.
+type fileOffset = int64
+
+func (w *workspaceFile) Seek(offset fileOffset, whence int) (int64, experimentalsys.Errno) {
+	n, err := w.f.Seek(offset, whence)
+	return n, errno(err)
+}
+
+func (w *workspaceFile) Readdir(n int) ([]experimentalsys.Dirent, experimentalsys.Errno) {
+	entries, err := w.f.ReadDir(n)
+	if err != nil && err != io.EOF {
+		return nil, errno(err)
+	}
+	dirents := make([]experimentalsys.Dirent, 0, len(entries))
+	for _, e := range entries {
+		dirents = append(dirents, experimentalsys.Dirent{Name: e.Name(), Type: e.Type()})
+	}
+	return dirents, 0
+}
+
+func (w *workspaceFile) Write(buf []byte) (int, experimentalsys.Errno) {
+	n, err := w.f.Write(buf)
+	return n, errno(err)
+}
+
+func (w *workspaceFile) Pwrite(buf []byte, off int64) (int, experimentalsys.Errno) {
+	n, err := w.f.WriteAt(buf, off)
+	return n, errno(err)
+}
+
+func (w *workspaceFile) Truncate(size int64) experimentalsys.Errno {
+	return errno(w.f.Truncate(size))
+}
+
+func (w *workspaceFile) Sync() experimentalsys.Errno {
+	return errno(w.f.Sync())
+}
+
+func (w *workspaceFile) Datasync() experimentalsys.Errno {
+	return errno(w.f.Sync())
+}
+
+func (w *workspaceFile) Utimens(atim, mtim int64) experimentalsys.Errno {
+	return errno(w.root.Chtimes(w.name, utime(atim), utime(mtim)))
+}
+
+func (w *workspaceFile) Close() experimentalsys.Errno {
+	return errno(w.f.Close())
+}
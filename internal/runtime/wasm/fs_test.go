@@ -0,0 +1,142 @@
+package wasm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+)
+
+func TestCheckPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		want  string
+		errno experimentalsys.Errno
+	}{
+		{path: "", want: "."},
+		{path: ".", want: "."},
+		{path: "a/b.txt", want: "a/b.txt"},
+		{path: "a/../b.txt", want: "b.txt"},
+		{path: "a/./b/", want: "a/b"},
+		{path: "..", errno: experimentalsys.ENOENT},
+		{path: "../etc/passwd", errno: experimentalsys.ENOENT},
+		{path: "a/../../etc", errno: experimentalsys.ENOENT},
+		{path: "/etc/passwd", errno: experimentalsys.ENOENT},
+		{path: "..foo", want: "..foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, errno := checkPath(tt.path)
+			assert.Equal(t, tt.errno, errno)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestWorkspaceFSConfinement checks that no path, followed through
+// symlinks or "..", reaches outside the workspace.
+func TestWorkspaceFSConfinement(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("host"), 0o600))
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "f.txt"), []byte("ws"), 0o644))
+	require.NoError(t, os.Symlink("sub/f.txt", filepath.Join(dir, "inside")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "abs")))
+	require.NoError(t, os.Symlink("../"+filepath.Base(outside)+"/secret", filepath.Join(dir, "rel")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "outdir")))
+
+	wfs, err := newWorkspaceFS(dir)
+	require.NoError(t, err)
+	defer wfs.Close()
+
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{name: "plain file", path: "sub/f.txt", ok: true},
+		{name: "dot-dot inside", path: "sub/../sub/f.txt", ok: true},
+		{name: "symlink inside", path: "inside", ok: true},
+		{name: "dot-dot out", path: "../" + filepath.Base(outside) + "/secret"},
+		{name: "absolute symlink", path: "abs"},
+		{name: "relative symlink out", path: "rel"},
+		{name: "symlinked directory", path: "outdir/secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, errno := wfs.OpenFile(tt.path, experimentalsys.O_RDONLY, 0)
+			if !tt.ok {
+				assert.NotZero(t, errno)
+				_, errno = wfs.Stat(tt.path)
+				assert.NotZero(t, errno)
+				assert.NotZero(t, wfs.Unlink(tt.path+"/x"))
+				return
+			}
+			require.Zero(t, errno)
+			defer f.Close()
+			buf := make([]byte, 16)
+			n, errno := f.Read(buf)
+			require.Zero(t, errno)
+			assert.Equal(t, "ws", string(buf[:n]))
+		})
+	}
+
+	// Writes through an escaping symlink must not touch the host file.
+	_, errno := wfs.OpenFile("abs", experimentalsys.O_WRONLY|experimentalsys.O_TRUNC, 0)
+	assert.NotZero(t, errno)
+	assert.NotZero(t, wfs.Mkdir("outdir/new", 0o755))
+	assert.NotZero(t, wfs.Rename("sub/f.txt", "outdir/moved"))
+	data, err := os.ReadFile(filepath.Join(outside, "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "host", string(data))
+	_, err = os.Stat(filepath.Join(outside, "new"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, experimentalsys.EPERM, wfs.Symlink("/etc", "etc"))
+	assert.Equal(t, experimentalsys.EPERM, wfs.Link("sub/f.txt", "hard"))
+}
+
+func TestWorkspaceFSFile(t *testing.T) {
+	dir := t.TempDir()
+	wfs, err := newWorkspaceFS(dir)
+	require.NoError(t, err)
+	defer wfs.Close()
+
+	require.Zero(t, wfs.Mkdir("d", 0o755))
+	f, errno := wfs.OpenFile("d/f.txt", experimentalsys.O_RDWR|experimentalsys.O_CREAT, 0o644)
+	require.Zero(t, errno)
+	_, errno = f.Write([]byte("hello"))
+	require.Zero(t, errno)
+	off, errno := f.Seek(1, 0)
+	require.Zero(t, errno)
+	assert.EqualValues(t, 1, off)
+	buf := make([]byte, 8)
+	n, errno := f.Read(buf)
+	require.Zero(t, errno)
+	assert.Equal(t, "ello", string(buf[:n]))
+	n, errno = f.Read(buf)
+	assert.Zero(t, errno)
+	assert.Zero(t, n)
+	require.Zero(t, f.Close())
+
+	d, errno := wfs.OpenFile("d", experimentalsys.O_RDONLY|experimentalsys.O_DIRECTORY, 0)
+	require.Zero(t, errno)
+	entries, errno := d.Readdir(-1)
+	require.Zero(t, errno)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "f.txt", entries[0].Name)
+	require.Zero(t, d.Close())
+
+	_, errno = wfs.OpenFile("d/f.txt", experimentalsys.O_RDONLY|experimentalsys.O_DIRECTORY, 0)
+	assert.Equal(t, experimentalsys.ENOTDIR, errno)
+	assert.Equal(t, experimentalsys.EISDIR, wfs.Unlink("d"))
+	assert.Equal(t, experimentalsys.ENOTDIR, wfs.Rmdir("d/f.txt"))
+	require.Zero(t, wfs.Unlink("d/f.txt"))
+	require.Zero(t, wfs.Rmdir("d"))
+	_, errno = wfs.Stat("d")
+	assert.Equal(t, experimentalsys.ENOENT, errno)
+}
@@ -0,0 +1,178 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// The helpers below serve the exec and fs requests of drivers without a
+// runner in the session, which handle them in the daemon against the
+// workspace directory on the host.
+
+// WorkspaceRel maps a /workspace path to one relative to the workspace root,
+// or "" when it does not name a file below /workspace.
+func WorkspaceRel(p string) string {
+	if !path.IsAbs(p) {
+		p = path.Join("/workspace", p)
+	}
+	p = path.Clean(p)
+	if !strings.HasPrefix(p, "/workspace/") {
+		return ""
+	}
+	return strings.TrimPrefix(p, "/workspace/")
+}
+
+// WriteWorkspaceFile serves a write request against the workspace at root.
+// os.Root keeps it inside the workspace even through symlinks. Created files
+// and directories are handed to uid:gid, the session's sandbox user.
+func WriteWorkspaceFile(root string, uid, gid int, req protocol.Request) *protocol.Response {
+	rel := WorkspaceRel(req.Path)
+	if rel == "" {
+		return ErrorResponse(req.ID, "invalid path: must be a file under /workspace")
+	}
+	content := []byte(req.Text)
+	if req.ContentBase64 != "" {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(req.ContentBase64); err != nil {
+			return ErrorResponse(req.ID, "invalid base64: "+err.Error())
+		}
+	}
+
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return ErrorResponse(req.ID, "open workspace: "+err.Error())
+	}
+	defer r.Close()
+	if dir := path.Dir(rel); dir != "." {
+		if err := r.MkdirAll(dir, 0755); err != nil {
+			return ErrorResponse(req.ID, "mkdir: "+err.Error())
+		}
+		for d := dir; d != "."; d = path.Dir(d) {
+			_ = r.Lchown(d, uid, gid)
+		}
+	}
+	if err := r.WriteFile(rel, content, 0644); err != nil {
+		return ErrorResponse(req.ID, "write: "+err.Error())
+	}
+	_ = r.Lchown(rel, uid, gid)
+	return &protocol.Response{ID: req.ID, Type: protocol.ResponseWrite, OK: true}
+}
+
+// ReadWorkspaceFile serves a read request against the workspace at root.
+func ReadWorkspaceFile(root string, req protocol.Request) *protocol.Response {
+	rel := WorkspaceRel(req.Path)
+	if rel == "" {
+		return ErrorResponse(req.ID, "invalid path: must be a file under /workspace")
+	}
+	maxBytes := req.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = protocol.DefaultMaxReadBytes
+	}
+
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return ErrorResponse(req.ID, "open workspace: "+err.Error())
+	}
+	defer r.Close()
+	f, err := r.Open(rel)
+	if err != nil {
+		return ErrorResponse(req.ID, "open: "+err.Error())
+	}
+	defer f.Close()
+
+	buf := make([]byte, maxBytes+1)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ErrorResponse(req.ID, "read: "+err.Error())
+	}
+	truncated := n > maxBytes
+	if truncated {
+		n = maxBytes
+	}
+	return &protocol.Response{
+		ID:            req.ID,
+		Type:          protocol.ResponseRead,
+		ContentBase64: base64.StdEncoding.EncodeToString(buf[:n]),
+		Truncated:     truncated,
+	}
+}
+
+// ErrorResponse is an error response to request id.
+func ErrorResponse(id, msg string) *protocol.Response {
+	return &protocol.Response{ID: id, Type: protocol.ResponseError, Error: msg}
+}
+
+// OutputBuffer collects command output for a response of up to limit bytes.
+// It keeps the first limit bytes, plus a few more so truncation can find a
+// rune boundary, and with headTail the last limit/2 bytes as well.
+type OutputBuffer struct {
+	head      bytes.Buffer
+	tail      []byte
+	limit     int
+	headTail  bool
+	truncated bool
+}
+
+// NewOutputBuffer returns a buffer sized for the response to req.
+func NewOutputBuffer(req protocol.Request) *OutputBuffer {
+	b := &OutputBuffer{limit: req.OutputLimit(), headTail: req.Truncate == protocol.TruncateHeadTail}
+	if req.OutputBase64 {
+		b.limit = req.Base64OutputLimit()
+	}
+	return b
+}
+
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.limit + utf8.UTFMax - b.head.Len(); room > 0 {
+		k := min(room, len(p))
+		b.head.Write(p[:k])
+		p = p[k:]
+	}
+	if len(p) > 0 {
+		b.truncated = true
+		if b.headTail {
+			b.tail = append(b.tail, p...)
+			if len(b.tail) > b.limit {
+				b.tail = b.tail[len(b.tail)-b.limit/2:]
+			}
+		}
+	}
+	return n, nil
+}
+
+// Text returns the output as text truncated to limit bytes.
+func (b *OutputBuffer) Text() (string, bool) {
+	mode := protocol.TruncateHead
+	if b.headTail {
+		mode = protocol.TruncateHeadTail
+	}
+	return protocol.TruncateOutput(b.head.String()+string(b.tail), b.limit, mode)
+}
+
+// Bytes returns the first limit bytes of the output.
+func (b *OutputBuffer) Bytes() ([]byte, bool) {
+	data := b.head.Bytes()
+	return data[:min(len(data), b.limit)], len(data) > b.limit
+}
+
+// SetOutput stores the buffered output in resp, base64-encoded if the
+// request asked for it.
+func (b *OutputBuffer) SetOutput(resp *protocol.Response, outputBase64 bool) {
+	if outputBase64 {
+		data, truncated := b.Bytes()
+		resp.Output = base64.StdEncoding.EncodeToString(data)
+		resp.Truncated = truncated
+		resp.OutputBase64 = true
+		return
+	}
+	resp.Output, resp.Truncated = b.Text()
+}
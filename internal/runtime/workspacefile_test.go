@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceRel(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/workspace/a/b.txt", "a/b.txt"},
+		{"a/b.txt", "a/b.txt"},
+		{"a/../b.txt", "b.txt"},
+		{"/workspace/a/../../workspace/b.txt", "b.txt"},
+		{"/workspace", ""},
+		{"/workspace/", ""},
+		{".", ""},
+		{"", ""},
+		{"/etc/passwd", ""},
+		{"/workspace-other/f", ""},
+		{"../etc/passwd", ""},
+		{"/workspace/../etc/passwd", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, WorkspaceRel(tt.path), tt.path)
+	}
+}
+
+func TestWorkspaceFileRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	resp := WriteWorkspaceFile(root, os.Getuid(), os.Getgid(), protocol.Request{ID: "1", Path: "/workspace/dir/f.txt", Text: "hello"})
+	require.True(t, resp.OK, resp.Error)
+	data, err := os.ReadFile(filepath.Join(root, "dir", "f.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	resp = ReadWorkspaceFile(root, protocol.Request{ID: "2", Path: "dir/f.txt", MaxBytes: 4})
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hell")), resp.ContentBase64)
+	assert.True(t, resp.Truncated)
+
+	resp = WriteWorkspaceFile(root, os.Getuid(), os.Getgid(), protocol.Request{ID: "3", Path: "/etc/f.txt", Text: "x"})
+	assert.Equal(t, protocol.ResponseError, resp.Type)
+}
+
+func TestOutputBuffer(t *testing.T) {
+	long := strings.Repeat("a", protocol.MaxOutputBytes)
+	tests := []struct {
+		name       string
+		req        protocol.Request
+		writes     []string
+		wantText   string
+		wantPrefix string
+		wantSuffix string
+		truncated  bool
+	}{
+		{name: "plain", writes: []string{"hello\n"}, wantText: "hello\n"},
+		{name: "several writes", writes: []string{"a", "b", "c"}, wantText: "abc"},
+		{name: "head", writes: []string{long, "end"}, wantPrefix: "aaa", truncated: true},
+		{name: "head and tail", req: protocol.Request{Truncate: protocol.TruncateHeadTail}, writes: []string{"start", long, "end"}, wantPrefix: "start", wantSuffix: "end", truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := NewOutputBuffer(tt.req)
+			for _, w := range tt.writes {
+				n, err := out.Write([]byte(w))
+				require.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			text, truncated := out.Text()
+			assert.Equal(t, tt.truncated, truncated)
+			assert.LessOrEqual(t, len(text), protocol.MaxOutputBytes)
+			if tt.wantText != "" {
+				assert.Equal(t, tt.wantText, text)
+			}
+			assert.True(t, strings.HasPrefix(text, tt.wantPrefix))
+			assert.True(t, strings.HasSuffix(text, tt.wantSuffix))
+		})
+	}
+
+	out := NewOutputBuffer(protocol.Request{})
+	out.Write([]byte("hello\n"))
+	resp := &protocol.Response{}
+	out.SetOutput(resp, false)
+	assert.Equal(t, "hello\n", resp.Output)
+	assert.False(t, resp.Truncated)
+
+	out = NewOutputBuffer(protocol.Request{OutputBase64: true})
+	out.Write([]byte{0, 1, 2})
+	resp = &protocol.Response{}
+	out.SetOutput(resp, true)
+	assert.True(t, resp.OutputBase64)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte{0, 1, 2}), resp.Output)
+}
@@ -0,0 +1,428 @@
+// Package wsl runs sessions of WSL targets (wsl.targets) in another WSL2
+// distro instead of in a namespace sandbox, for daemons started in WSL2 on a
+// Windows host (see sandkasten-wsl).
+//
+// A target is a distro such as one with .NET or PowerShell installed, so such
+// workloads need no Linux rootfs image. The session has no process between
+// execs: every exec runs through wsl.exe as root in the target distro, which
+// bind-mounts the session's workspace at /workspace in a private mount
+// namespace and runs the command as the target's unprivileged user under a
+// timeout. Workspaces live below wsl.shared_dir in /mnt/wsl, the tmpfs all
+// WSL2 distros share, so the daemon serves file reads and writes directly.
+//
+// Driver wraps the configured runtime and hands every other image to it.
+//
+//	Daemon → Driver.Create() → target image? → workspace dir + marker (no process)
+//	Daemon → Driver.Exec() → wsl.exe -d <distro> → unshare → runuser <user> → output, exit code
+package wsl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// sessionFile marks a session directory as a WSL session and survives
+// daemon restarts; WSL sessions hold no other state in the daemon.
+const sessionFile = "wsl.json"
+
+// defaultUID is the uid of a target's user when wsl.targets sets none.
+const defaultUID = 1000
+
+// Runtime is the driver WSL sessions are layered on; it serves all other images.
+type Runtime interface {
+	runtime.Driver
+	ListSessionDirIDs(ctx context.Context) ([]string, error)
+	ListHostResources(ctx context.Context) ([]runtime.HostResource, error)
+	RemoveHostResource(ctx context.Context, r runtime.HostResource) error
+	ResolveImage(ctx context.Context, ref string) (string, error)
+}
+
+type Driver struct {
+	Runtime // sessions of other images
+
+	cfg     *config.Config
+	dataDir string
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is the marker content of a WSL session.
+type session struct {
+	Image string `json:"image"`
+}
+
+// NewDriver layers sessions of the configured WSL targets on next.
+func NewDriver(cfg *config.Config, next Runtime, logger *slog.Logger) *Driver {
+	return &Driver{
+		Runtime:  next,
+		cfg:      cfg,
+		dataDir:  cfg.DataDir,
+		logger:   logger,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Ping checks that wsl.exe is reachable before asking the wrapped runtime.
+func (d *Driver) Ping(ctx context.Context) error {
+	if _, err := os.Stat(d.cfg.WSL.Exe); err != nil {
+		return fmt.Errorf("wsl.exe (is WSL interop enabled?): %w", err)
+	}
+	return d.Runtime.Ping(ctx)
+}
+
+// target returns the WSL target image names, if it is one.
+func (d *Driver) target(image string) (config.WSLTarget, bool) {
+	t, ok := d.cfg.WSL.Targets[image]
+	if ok && t.UID == 0 {
+		t.UID = defaultUID
+	}
+	return t, ok
+}
+
+// session returns the WSL session sessionID, loading its marker after a
+// daemon restart. ok is false for sessions of the wrapped runtime.
+func (d *Driver) session(sessionID string) (*session, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.sessions[sessionID]; ok {
+		return s, true
+	}
+	data, err := os.ReadFile(filepath.Join(d.sessionDir(sessionID), sessionFile))
+	if err != nil {
+		return nil, false
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, false
+	}
+	d.sessions[sessionID] = &s
+	return &s, true
+}
+
+func (d *Driver) saveSession(sessionID string, s *session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.sessionDir(sessionID), sessionFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	d.sessions[sessionID] = s
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *Driver) Create(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	t, ok := d.target(opts.Image)
+	if !ok {
+		return d.Runtime.Create(ctx, opts)
+	}
+	d.logger.Debug("runtime create wsl session", "session_id", opts.SessionID, "image", opts.Image, "distro", t.Distro)
+
+	if opts.WorkspaceID != "" {
+		return nil, &runtime.CreateError{Stage: "setup", Err: fmt.Errorf("wsl target %s: persistent workspaces are not supported", opts.Image)}
+	}
+	if err := d.createDirs(opts.SessionID, t); err != nil {
+		d.removeDirs(opts.SessionID)
+		return nil, &runtime.CreateError{Stage: "setup", Err: err}
+	}
+	if err := d.saveSession(opts.SessionID, &session{Image: opts.Image}); err != nil {
+		d.removeDirs(opts.SessionID)
+		return nil, fmt.Errorf("write session: %w", err)
+	}
+	return &runtime.SessionInfo{SessionID: opts.SessionID}, nil
+}
+
+// createDirs creates the marker directory and the shared session directory.
+// The latter is root-only so the target user reaches no other session's
+// workspace through /mnt/wsl; it gets to its own only through /workspace.
+func (d *Driver) createDirs(sessionID string, t config.WSLTarget) error {
+	if err := os.MkdirAll(d.sessionDir(sessionID), 0755); err != nil {
+		return fmt.Errorf("mkdir session dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Join(d.cfg.WSL.SharedDir, "sessions"), 0711); err != nil {
+		return fmt.Errorf("mkdir shared dir: %w", err)
+	}
+	if err := os.Mkdir(d.sharedDir(sessionID), 0700); err != nil {
+		return fmt.Errorf("mkdir shared session dir: %w", err)
+	}
+	ws := d.workspaceRoot(sessionID)
+	if err := os.Mkdir(ws, 0755); err != nil {
+		return fmt.Errorf("mkdir workspace: %w", err)
+	}
+	if err := os.Chown(ws, t.UID, t.UID); err != nil {
+		return fmt.Errorf("chown workspace: %w", err)
+	}
+	return nil
+}
+
+func (d *Driver) removeDirs(sessionID string) error {
+	return errors.Join(os.RemoveAll(d.sharedDir(sessionID)), os.RemoveAll(d.sessionDir(sessionID)))
+}
+
+func (d *Driver) Exec(ctx context.Context, sessionID string, req protocol.Request) (*protocol.Response, error) {
+	s, ok := d.session(sessionID)
+	if !ok {
+		return d.Runtime.Exec(ctx, sessionID, req)
+	}
+	t, ok := d.target(s.Image)
+	if !ok {
+		return runtime.ErrorResponse(req.ID, "wsl target "+s.Image+" is no longer configured"), nil
+	}
+	root := d.workspaceRoot(sessionID)
+	switch req.Type {
+	case protocol.RequestExec, protocol.RequestExecStream:
+		return d.exec(ctx, sessionID, t, req)
+	case protocol.RequestWrite:
+		return runtime.WriteWorkspaceFile(root, t.UID, t.UID, req), nil
+	case protocol.RequestRead:
+		return runtime.ReadWorkspaceFile(root, req), nil
+	case protocol.RequestResize:
+		// No terminal: the command's output is captured, not displayed.
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseResize, OK: true}, nil
+	default:
+		return runtime.ErrorResponse(req.ID, "unknown request type: "+string(req.Type)), nil
+	}
+}
+
+func (d *Driver) Destroy(ctx context.Context, sessionID string) error {
+	if _, ok := d.session(sessionID); !ok {
+		return d.Runtime.Destroy(ctx, sessionID)
+	}
+	d.mu.Lock()
+	delete(d.sessions, sessionID)
+	d.mu.Unlock()
+	return d.removeDirs(sessionID)
+}
+
+// IsRunning is true for as long as a WSL session exists; it has no process
+// between execs that could die.
+func (d *Driver) IsRunning(ctx context.Context, sessionID string) (bool, error) {
+	if _, ok := d.session(sessionID); ok {
+		return true, nil
+	}
+	return d.Runtime.IsRunning(ctx, sessionID)
+}
+
+// Stats reports nothing for WSL sessions: their execs run in the WSL VM,
+// outside of any cgroup of the daemon.
+func (d *Driver) Stats(ctx context.Context, sessionID string) (*protocol.SessionStats, error) {
+	if _, ok := d.session(sessionID); !ok {
+		return d.Runtime.Stats(ctx, sessionID)
+	}
+	return &protocol.SessionStats{}, nil
+}
+
+func (d *Driver) MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error {
+	s, ok := d.session(sessionID)
+	if !ok {
+		return d.Runtime.MountWorkspace(ctx, sessionID, workspaceID)
+	}
+	return fmt.Errorf("wsl target %s: persistent workspaces are not supported", s.Image)
+}
+
+// ValidateImage checks that a target's distro runs and has its user and the
+// tools an exec needs; other images go to the wrapped runtime.
+func (d *Driver) ValidateImage(ctx context.Context, image string) error {
+	t, ok := d.target(image)
+	if !ok {
+		return d.Runtime.ValidateImage(ctx, image)
+	}
+	return d.checkTarget(ctx, t)
+}
+
+// ImageDigest is "" for targets: a distro has no version to pin.
+func (d *Driver) ImageDigest(ctx context.Context, image string) (string, error) {
+	if _, ok := d.target(image); ok {
+		return "", nil
+	}
+	return d.Runtime.ImageDigest(ctx, image)
+}
+
+// ResolveImage maps a target name to itself.
+func (d *Driver) ResolveImage(ctx context.Context, ref string) (string, error) {
+	if _, ok := d.target(ref); ok {
+		return ref, nil
+	}
+	return d.Runtime.ResolveImage(ctx, ref)
+}
+
+// ListSessionDirIDs adds WSL sessions to those of the wrapped runtime.
+func (d *Driver) ListSessionDirIDs(ctx context.Context) ([]string, error) {
+	ids, err := d.Runtime.ListSessionDirIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(d.dataDir, "sessions"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read sessions dir: %w", err)
+	}
+	for _, e := range entries {
+		if seen[e.Name()] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(d.sessionDir(e.Name()), sessionFile)); err == nil {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// ReclaimMemory forwards to the wrapped runtime. WSL sessions hold no memory
+// between execs.
+func (d *Driver) ReclaimMemory(ctx context.Context, sessionID string) (int64, error) {
+	if _, ok := d.session(sessionID); ok {
+		return 0, nil
+	}
+	if r, ok := d.Runtime.(runtime.MemoryReclaimer); ok {
+		return r.ReclaimMemory(ctx, sessionID)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// DialPort forwards to the wrapped runtime. WSL sessions run no servers
+// between execs.
+func (d *Driver) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	if _, ok := d.session(sessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if p, ok := d.Runtime.(runtime.PortDialer); ok {
+		return p.DialPort(ctx, sessionID, port)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// Attach forwards to the wrapped runtime. WSL sessions run each command
+// through wsl.exe and have no terminal.
+func (d *Driver) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	if _, ok := d.session(sessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if a, ok := d.Runtime.(runtime.TerminalAttacher); ok {
+		return a.Attach(ctx, sessionID, opts)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// MemoryPressure forwards to the wrapped runtime, which knows the host.
+func (d *Driver) MemoryPressure() (float64, error) {
+	if r, ok := d.Runtime.(runtime.MemoryPressureReporter); ok {
+		return r.MemoryPressure()
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// EnsureRunner forwards to the wrapped runtime. WSL sessions have no runner.
+func (d *Driver) EnsureRunner(ctx context.Context, sessionID string) (bool, error) {
+	if _, ok := d.session(sessionID); ok {
+		return false, nil
+	}
+	if u, ok := d.Runtime.(runtime.RunnerUpdater); ok {
+		return u.EnsureRunner(ctx, sessionID)
+	}
+	return false, nil
+}
+
+// MountSharedChannel forwards to the wrapped runtime. Channels are tmpfs
+// mounts of the daemon's distro, which WSL sessions cannot see.
+func (d *Driver) MountSharedChannel(ctx context.Context, sessionID, channel string, sizeBytes int64) error {
+	if _, ok := d.session(sessionID); ok {
+		return errors.ErrUnsupported
+	}
+	if m, ok := d.Runtime.(runtime.SharedChannelMounter); ok {
+		return m.MountSharedChannel(ctx, sessionID, channel, sizeBytes)
+	}
+	return errors.ErrUnsupported
+}
+
+func (d *Driver) ReleaseSharedChannel(ctx context.Context, channel string) error {
+	if m, ok := d.Runtime.(runtime.SharedChannelMounter); ok {
+		return m.ReleaseSharedChannel(ctx, channel)
+	}
+	return nil
+}
+
+// CheckDeterminism forwards to the wrapped runtime.
+func (d *Driver) CheckDeterminism(det *runtime.Determinism) error {
+	if dd, ok := d.Runtime.(runtime.DeterministicDriver); ok {
+		return dd.CheckDeterminism(det)
+	}
+	return errors.ErrUnsupported
+}
+
+// Rebase forwards to the wrapped runtime. A WSL session runs in its target
+// distro, which has no image to swap.
+func (d *Driver) Rebase(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	if _, ok := d.session(opts.SessionID); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if _, ok := d.target(opts.Image); ok {
+		return nil, errors.ErrUnsupported
+	}
+	if r, ok := d.Runtime.(runtime.ImageRebaser); ok {
+		return r.Rebase(ctx, opts)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// ImageScan forwards to the wrapped runtime. WSL targets are
+// distros, not images.
+func (d *Driver) ImageScan(ctx context.Context, image string) (*imagescan.Report, error) {
+	if _, ok := d.target(image); ok {
+		return nil, nil
+	}
+	if r, ok := d.Runtime.(runtime.ImageScanReader); ok {
+		return r.ImageScan(ctx, image)
+	}
+	return nil, nil
+}
+
+// TuneCPU forwards to the wrapped runtime. WSL sessions are not in the
+// daemon's cgroups.
+func (d *Driver) TuneCPU(ctx context.Context, sessionID string, t runtime.CPUTuning) error {
+	if _, ok := d.session(sessionID); ok {
+		return errors.ErrUnsupported
+	}
+	if c, ok := d.Runtime.(runtime.CPUTuner); ok {
+		return c.TuneCPU(ctx, sessionID, t)
+	}
+	return errors.ErrUnsupported
+}
+
+func (d *Driver) sessionDir(sessionID string) string {
+	return filepath.Join(d.dataDir, "sessions", sessionID)
+}
+
+// sharedDir holds the session's workspace and exec scripts in /mnt/wsl.
+func (d *Driver) sharedDir(sessionID string) string {
+	return filepath.Join(d.cfg.WSL.SharedDir, "sessions", sessionID)
+}
+
+// workspaceRoot is the directory the target distro mounts at /workspace.
+func (d *Driver) workspaceRoot(sessionID string) string {
+	return filepath.Join(d.sharedDir(sessionID), "workspace")
+}
@@ -0,0 +1,157 @@
+package wsl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// execPath is the PATH of commands run in a target.
+const execPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// timeoutExitCode is the exit code of timeout(1) when the command timed out.
+const timeoutExitCode = 124
+
+// wslGrace is how much longer than the exec timeout wsl.exe may take, for
+// starting the distro and tearing down.
+const wslGrace = 10 * time.Second
+
+// exec runs req.Cmd in the target with the requested or the target's shell.
+// The command line is staged as a script in the shared session directory, so
+// it never passes through the Windows command line wsl.exe is started with.
+func (d *Driver) exec(ctx context.Context, sessionID string, t config.WSLTarget, req protocol.Request) (*protocol.Response, error) {
+	shell := req.Shell
+	if shell == "" {
+		shell = t.Shell
+	}
+	argv, ok := shellArgv(shell, req.Cmd)
+	if !ok {
+		return &protocol.Response{ID: req.ID, Type: protocol.ResponseError, Error: protocol.ErrShellUnavailable + ": wsl targets run " + strings.Join(config.WSLShells, ", ")}, nil
+	}
+
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Duration(d.cfg.Defaults.MaxExecTimeoutMs) * time.Millisecond
+	}
+	script, err := os.CreateTemp(d.sharedDir(sessionID), "exec-*.sh")
+	if err != nil {
+		return nil, fmt.Errorf("stage exec: %w", err)
+	}
+	defer os.Remove(script.Name())
+	_, err = script.WriteString(execScript(d.workspaceRoot(sessionID), t.User, timeout, argv))
+	if err = errors.Join(err, script.Close()); err != nil {
+		return nil, fmt.Errorf("stage exec: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+wslGrace)
+	defer cancel()
+	out := runtime.NewOutputBuffer(req)
+	cmd := d.command(ctx, t.Distro, "root", "unshare", "--mount", "--propagation", "private", "sh", script.Name())
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil, ctx.Err()
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("run wsl.exe: %w", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	if (exitCode == timeoutExitCode && elapsed >= timeout) || ctx.Err() != nil {
+		return &protocol.Response{
+			ID:         req.ID,
+			Type:       protocol.ResponseExec,
+			ExitCode:   -1,
+			Output:     "timeout: command exceeded " + timeout.String(),
+			DurationMs: elapsed.Milliseconds(),
+		}, nil
+	}
+
+	resp := &protocol.Response{
+		ID:         req.ID,
+		Type:       protocol.ResponseExec,
+		ExitCode:   exitCode,
+		Cwd:        "/workspace",
+		DurationMs: elapsed.Milliseconds(),
+	}
+	out.SetOutput(resp, req.OutputBase64)
+	return resp, nil
+}
+
+// checkTarget runs a command as the target's user that needs the distro to
+// start, the user to exist and the tools of an exec to be installed.
+func (d *Driver) checkTarget(ctx context.Context, t config.WSLTarget) error {
+	shell := t.Shell
+	if shell == "" {
+		shell = "bash"
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := d.command(ctx, t.Distro, "root", "runuser", "-u", t.User, "--", "which", "unshare", "timeout", shell)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wsl distro %s: %w: %s", t.Distro, err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// command runs argv in distro as user through wsl.exe, without a login shell.
+func (d *Driver) command(ctx context.Context, distro, user string, argv ...string) *exec.Cmd {
+	args := append([]string{"-d", distro, "-u", user, "--cd", "/", "--exec"}, argv...)
+	return exec.CommandContext(ctx, d.cfg.WSL.Exe, args...)
+}
+
+// shellArgv is the command line running cmd with shell ("" = bash).
+func shellArgv(shell, cmd string) ([]string, bool) {
+	switch shell {
+	case "", "bash":
+		return []string{"bash", "-c", cmd}, true
+	case "sh":
+		return []string{"sh", "-c", cmd}, true
+	case "pwsh":
+		return []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", cmd}, true
+	default:
+		return nil, false
+	}
+}
+
+// execScript is the script the target's root runs in a private mount
+// namespace: it mounts workspace at /workspace and runs argv there as user,
+// with a clean environment, killed after timeout.
+func execScript(workspace, user string, timeout time.Duration, argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		quoted[i] = quote(a)
+	}
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	b.WriteString("mkdir -p /workspace\n")
+	fmt.Fprintf(&b, "mount --bind %s /workspace\n", quote(workspace))
+	b.WriteString("cd /workspace\n")
+	fmt.Fprintf(&b, "exec timeout -k 2 %.3f runuser -u %s -- env -i HOME=/workspace USER=%s PATH=%s %s\n",
+		timeout.Seconds(), quote(user), quote(user), execPath, strings.Join(quoted, " "))
+	return b.String()
+}
+
+// quote single-quotes s for sh.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,188 @@
+package wsl
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// shWords splits words the way sh does, by printing each NUL-terminated.
+func shWords(t *testing.T, words string) []string {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	out, err := exec.Command(sh, "-c", `printf '%s\0' `+words).Output()
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "abc", want: `'abc'`},
+		{name: "empty", in: "", want: `''`},
+		{name: "spaces", in: "a b\tc", want: `'a b	c'`},
+		{name: "single quote", in: "it's", want: `'it'\''s'`},
+		{name: "only quotes", in: "''", want: `''\'''\'''`},
+		{name: "expansions", in: "$HOME `id` $(id) *", want: "'$HOME `id` $(id) *'"},
+		{name: "double quotes and backslash", in: `"a\b"`, want: `'"a\b"'`},
+		{name: "newline", in: "a\nb", want: "'a\nb'"},
+		{name: "operators", in: "a; b && c | d > e", want: `'a; b && c | d > e'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := quote(tt.in)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, []string{tt.in}, shWords(t, got))
+		})
+	}
+}
+
+func TestShellArgv(t *testing.T) {
+	tests := []struct {
+		shell  string
+		want   []string
+		wantOK bool
+	}{
+		{shell: "", want: []string{"bash", "-c", "echo hi"}, wantOK: true},
+		{shell: "bash", want: []string{"bash", "-c", "echo hi"}, wantOK: true},
+		{shell: "sh", want: []string{"sh", "-c", "echo hi"}, wantOK: true},
+		{shell: "pwsh", want: []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}, wantOK: true},
+		{shell: "zsh"},
+		{shell: "cmd.exe"},
+	}
+	for _, tt := range tests {
+		t.Run("shell "+tt.shell, func(t *testing.T) {
+			got, ok := shellArgv(tt.shell, "echo hi")
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExecScript(t *testing.T) {
+	got := execScript("/mnt/wsl/sandkasten/sessions/s1/workspace", "sandbox", 1500*time.Millisecond, []string{"bash", "-c", "echo 'hi'"})
+	want := "set -e\n" +
+		"mkdir -p /workspace\n" +
+		"mount --bind '/mnt/wsl/sandkasten/sessions/s1/workspace' /workspace\n" +
+		"cd /workspace\n" +
+		"exec timeout -k 2 1.500 runuser -u 'sandbox' -- env -i HOME=/workspace USER='sandbox' PATH=" + execPath + ` 'bash' '-c' 'echo '\''hi'\'''` + "\n"
+	assert.Equal(t, want, got)
+}
+
+// TestExecScriptUserCommandLine checks the command line the target's user
+// runs: sh must hand every argument over unchanged, whatever it contains.
+func TestExecScriptUserCommandLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  string
+		shell string
+		cmd   string
+	}{
+		{name: "simple", user: "sandbox", shell: "bash", cmd: "ls -la"},
+		{name: "quotes", user: "sandbox", shell: "bash", cmd: `echo "it's" 'a "test"'`},
+		{name: "expansions stay unexpanded", user: "sandbox", shell: "sh", cmd: "echo $HOME $(id) `id` ~ *"},
+		{name: "operators", user: "sandbox", shell: "bash", cmd: "a; b && c || d | e > f < g &"},
+		{name: "multi-line", user: "sandbox", shell: "bash", cmd: "cd /tmp\nls\n"},
+		{name: "pwsh", user: "dev", shell: "pwsh", cmd: `Write-Output "x"; Get-ChildItem`},
+		{name: "user with quote", user: "o'neil", shell: "bash", cmd: "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, ok := shellArgv(tt.shell, tt.cmd)
+			require.True(t, ok)
+			script := execScript("/ws", tt.user, time.Minute, argv)
+			_, line, ok := strings.Cut(script, "cd /workspace\nexec ")
+			require.True(t, ok, script)
+
+			want := append([]string{
+				"timeout", "-k", "2", "60.000",
+				"runuser", "-u", tt.user, "--",
+				"env", "-i", "HOME=/workspace", "USER=" + tt.user, "PATH=" + execPath,
+			}, argv...)
+			assert.Equal(t, want, shWords(t, line))
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	d := &Driver{cfg: &config.Config{WSL: config.WSLConfig{Exe: "/mnt/c/Windows/System32/wsl.exe"}}}
+	cmd := d.command(context.Background(), "Ubuntu-24.04", "root", "unshare", "--mount", "sh", "/mnt/wsl/x/exec-1.sh")
+	assert.Equal(t, []string{
+		"/mnt/c/Windows/System32/wsl.exe",
+		"-d", "Ubuntu-24.04", "-u", "root", "--cd", "/", "--exec",
+		"unshare", "--mount", "sh", "/mnt/wsl/x/exec-1.sh",
+	}, cmd.Args)
+}
+
+// fakeWSL is a wsl.exe that prints its arguments, one per line, then the
+// staged script, and exits with 3.
+const fakeWSL = `#!/bin/sh
+for a in "$@"; do echo "arg: $a"; done
+for last in "$@"; do :; done
+cat "$last"
+exit 3
+`
+
+func TestExecStagesCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "wsl.exe")
+	require.NoError(t, os.WriteFile(exe, []byte(fakeWSL), 0755))
+	d := &Driver{cfg: &config.Config{
+		Defaults: config.Defaults{MaxExecTimeoutMs: 60000},
+		WSL:      config.WSLConfig{Exe: exe, SharedDir: dir},
+	}}
+	require.NoError(t, os.MkdirAll(d.sharedDir("s1"), 0700))
+
+	cmd := `echo "secret arg" && rm -rf '/x y'`
+	target := config.WSLTarget{Distro: "Ubuntu", User: "sandbox", Shell: "bash"}
+	resp, err := d.exec(context.Background(), "s1", target, protocol.Request{ID: "r1", Type: protocol.RequestExec, Cmd: cmd})
+	require.NoError(t, err)
+	assert.Equal(t, 3, resp.ExitCode)
+
+	var args, script []string
+	for _, line := range strings.Split(strings.TrimSuffix(resp.Output, "\n"), "\n") {
+		if a, ok := strings.CutPrefix(line, "arg: "); ok {
+			args = append(args, a)
+		} else {
+			script = append(script, line)
+		}
+	}
+	require.Len(t, args, 13)
+	assert.Equal(t, []string{"-d", "Ubuntu", "-u", "root", "--cd", "/", "--exec", "unshare", "--mount", "--propagation", "private", "sh"}, args[:12])
+	assert.Equal(t, d.sharedDir("s1"), filepath.Dir(args[12]))
+	for _, a := range args {
+		assert.NotContains(t, a, "secret", "the command must not reach the wsl.exe command line")
+	}
+	assert.Contains(t, strings.Join(script, "\n"), quote(cmd))
+
+	entries, err := os.ReadDir(d.sharedDir("s1"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the staged script is removed")
+}
+
+func TestExecUnknownShell(t *testing.T) {
+	d := &Driver{cfg: &config.Config{}}
+	resp, err := d.exec(context.Background(), "s1", config.WSLTarget{Shell: "bash"}, protocol.Request{ID: "r1", Shell: "zsh", Cmd: "id"})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.ResponseError, resp.Type)
+	assert.Contains(t, resp.Error, protocol.ErrShellUnavailable)
+}
@@ -0,0 +1,159 @@
+// Package scan runs operator-provided content scanners (e.g. ClamAV or a
+// secret scanner) on files before they are written into a sandbox or workspace.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+// Verdict is the outcome of a scan.
+type Verdict string
+
+const (
+	VerdictClean      Verdict = "clean"
+	VerdictReject     Verdict = "reject"
+	VerdictQuarantine Verdict = "quarantine"
+)
+
+// Request describes the content being written.
+type Request struct {
+	Path        string
+	SessionID   string
+	WorkspaceID string
+	Content     []byte
+}
+
+// Result is what a scanner decided about the content.
+type Result struct {
+	Verdict Verdict `json:"verdict"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// Scanner inspects content before it is written.
+type Scanner interface {
+	Scan(ctx context.Context, req Request) (Result, error)
+}
+
+// New returns the configured scanner, or nil if no scanning can ever apply.
+func New(cfg config.ScanConfig) (Scanner, error) {
+	if !cfg.Enabled && !anyEnabled(cfg.Workspaces) {
+		return nil, nil
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	switch {
+	case len(cfg.Command) > 0 && cfg.URL != "":
+		return nil, errors.New("scan: set either command or url, not both")
+	case len(cfg.Command) > 0:
+		return &commandScanner{argv: cfg.Command, timeout: timeout}, nil
+	case cfg.URL != "":
+		return &httpScanner{url: cfg.URL, client: &http.Client{Timeout: timeout}}, nil
+	default:
+		return nil, errors.New("scan: command or url is required when scanning is enabled")
+	}
+}
+
+func anyEnabled(m map[string]bool) bool {
+	for _, v := range m {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+// commandScanner pipes content to an external command. Exit status 0 means
+// clean and 1 means reject (matching clamscan); anything else is an error.
+type commandScanner struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (c *commandScanner) Scan(ctx context.Context, req Request) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.argv[0], c.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(req.Content)
+	cmd.Env = append(cmd.Environ(),
+		"SANDKASTEN_SCAN_PATH="+req.Path,
+		"SANDKASTEN_SCAN_SESSION_ID="+req.SessionID,
+		"SANDKASTEN_SCAN_WORKSPACE_ID="+req.WorkspaceID,
+	)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	if err == nil {
+		return Result{Verdict: VerdictClean}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return Result{Verdict: VerdictReject, Reason: firstLine(out.String())}, nil
+	}
+	return Result{}, fmt.Errorf("scan command: %w: %s", err, firstLine(out.String()))
+}
+
+// httpScanner POSTs content to a callback that answers with a Result as JSON.
+type httpScanner struct {
+	url    string
+	client *http.Client
+}
+
+func (h *httpScanner) Scan(ctx context.Context, req Request) (Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(req.Content))
+	if err != nil {
+		return Result{}, fmt.Errorf("scan callback: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	httpReq.Header.Set("X-Sandkasten-Path", req.Path)
+	httpReq.Header.Set("X-Sandkasten-Session-ID", req.SessionID)
+	httpReq.Header.Set("X-Sandkasten-Workspace-ID", req.WorkspaceID)
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return Result{}, fmt.Errorf("scan callback: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Result{}, fmt.Errorf("scan callback: status %d: %s", resp.StatusCode, firstLine(string(body)))
+	}
+
+	var res Result
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&res); err != nil {
+		return Result{}, fmt.Errorf("scan callback: decode response: %w", err)
+	}
+	switch res.Verdict {
+	case VerdictClean, VerdictReject, VerdictQuarantine:
+		return res, nil
+	default:
+		return Result{}, fmt.Errorf("scan callback: unknown verdict %q", res.Verdict)
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) > 200 {
+		s = s[:200]
+	}
+	return s
+}
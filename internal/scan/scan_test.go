@@ -0,0 +1,87 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDisabled(t *testing.T) {
+	s, err := New(config.ScanConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestNewRequiresBackend(t *testing.T) {
+	_, err := New(config.ScanConfig{Enabled: true})
+	assert.Error(t, err)
+
+	_, err = New(config.ScanConfig{Enabled: true, Command: []string{"true"}, URL: "http://x"})
+	assert.Error(t, err)
+
+	s, err := New(config.ScanConfig{Workspaces: map[string]bool{"ws": true}, Command: []string{"true"}})
+	require.NoError(t, err)
+	assert.NotNil(t, s)
+}
+
+func TestCommandScanner(t *testing.T) {
+	s, err := New(config.ScanConfig{Enabled: true, Command: []string{"sh", "-c", `grep -q EICAR && { echo "found EICAR"; exit 1; } || exit 0`}})
+	require.NoError(t, err)
+
+	res, err := s.Scan(context.Background(), Request{Path: "a.txt", Content: []byte("hello")})
+	require.NoError(t, err)
+	assert.Equal(t, VerdictClean, res.Verdict)
+
+	res, err = s.Scan(context.Background(), Request{Path: "b.txt", Content: []byte("xx EICAR xx")})
+	require.NoError(t, err)
+	assert.Equal(t, VerdictReject, res.Verdict)
+	assert.Equal(t, "found EICAR", res.Reason)
+}
+
+func TestCommandScannerError(t *testing.T) {
+	s, err := New(config.ScanConfig{Enabled: true, Command: []string{"sh", "-c", "exit 2"}})
+	require.NoError(t, err)
+
+	_, err = s.Scan(context.Background(), Request{Content: []byte("x")})
+	assert.Error(t, err)
+}
+
+func TestHTTPScanner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "secrets.env", r.Header.Get("X-Sandkasten-Path"))
+		verdict := VerdictClean
+		if string(body) == "AWS_SECRET_ACCESS_KEY=abc" {
+			verdict = VerdictQuarantine
+		}
+		json.NewEncoder(w).Encode(Result{Verdict: verdict, Reason: "secret detected"})
+	}))
+	defer srv.Close()
+
+	s, err := New(config.ScanConfig{Enabled: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	res, err := s.Scan(context.Background(), Request{Path: "secrets.env", Content: []byte("AWS_SECRET_ACCESS_KEY=abc")})
+	require.NoError(t, err)
+	assert.Equal(t, VerdictQuarantine, res.Verdict)
+}
+
+func TestHTTPScannerBadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s, err := New(config.ScanConfig{Enabled: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	_, err = s.Scan(context.Background(), Request{Content: []byte("x")})
+	assert.Error(t, err)
+}
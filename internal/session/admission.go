@@ -0,0 +1,119 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+	"github.com/p-arndt/sandkasten/internal/pool"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// Create priorities (CreateOpts.Priority). Under host pressure batch creates
+// wait or are rejected first; high-priority creates may take the pool's
+// reserved idle sessions.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityBatch  = "batch"
+)
+
+var (
+	admissionQueueDepth = metrics.Default.NewGaugeVec("sandkasten_admission_queue_depth",
+		"Batch creates waiting for host pressure to drop.")
+	admissionRejected = metrics.Default.NewCounterVec("sandkasten_admission_rejected_total",
+		"Creates rejected under host pressure, by priority.", "priority")
+)
+
+// admissionRetry is how often a queued batch create re-checks the pressure.
+var admissionRetry = 500 * time.Millisecond
+
+// admit lets a create through unless the host is under pressure. Batch
+// creates are held back from the lower admission.batch_memory_pressure on and
+// wait up to admission.batch_queue_seconds for the pressure to drop.
+func (m *Manager) admit(ctx context.Context, priority string) error {
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	if priority != PriorityBatch {
+		err := m.checkHostPressure()
+		if err != nil {
+			admissionRejected.Inc(priority)
+		}
+		return err
+	}
+
+	err := m.checkBatchPressure()
+	if err == nil {
+		return nil
+	}
+	wait := time.Duration(m.cfg.Admission.BatchQueueSeconds) * time.Second
+	if wait <= 0 || !m.enqueueBatch() {
+		admissionRejected.Inc(priority)
+		return err
+	}
+	defer m.dequeueBatch()
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(admissionRetry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			admissionRejected.Inc(priority)
+			return fmt.Errorf("batch create queued for %s: %w", wait, err)
+		case <-ticker.C:
+		}
+		if m.Draining() {
+			return ErrDraining
+		}
+		if err = m.checkBatchPressure(); err == nil {
+			return nil
+		}
+	}
+}
+
+// checkBatchPressure is checkHostPressure with the batch watermark.
+func (m *Manager) checkBatchPressure() error {
+	threshold := m.cfg.Admission.BatchMemoryPressure
+	if threshold <= 0 {
+		return m.checkHostPressure()
+	}
+	r, _ := m.runtime.(runtime.MemoryPressureReporter)
+	err := runtime.CheckMemoryPressure(r, threshold)
+	var limitErr *runtime.HostLimitError
+	if errors.As(err, &limitErr) {
+		limitErr.Limit = "admission.batch_memory_pressure"
+	}
+	return err
+}
+
+// enqueueBatch takes a place in the batch queue; false if it is full.
+func (m *Manager) enqueueBatch() bool {
+	n := m.batchQueued.Add(1)
+	if limit := m.cfg.Admission.BatchQueueMax; limit > 0 && n > int64(limit) {
+		m.batchQueued.Add(-1)
+		return false
+	}
+	admissionQueueDepth.Add(1)
+	return true
+}
+
+func (m *Manager) dequeueBatch() {
+	m.batchQueued.Add(-1)
+	admissionQueueDepth.Add(-1)
+}
+
+// withPriority marks ctx for the pool so high-priority creates can take the
+// reserved idle sessions.
+func withPriority(ctx context.Context, priority string) context.Context {
+	if priority == PriorityHigh {
+		return pool.WithHighPriority(ctx)
+	}
+	return ctx
+}
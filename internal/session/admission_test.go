@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/pool"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// varPressureRuntime is pressureRuntime with a pressure that changes.
+type varPressureRuntime struct {
+	*MockRuntimeDriver
+	mu       sync.Mutex
+	pressure float64
+}
+
+func (r *varPressureRuntime) MemoryPressure() (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pressure, nil
+}
+
+func (r *varPressureRuntime) set(p float64) {
+	r.mu.Lock()
+	r.pressure = p
+	r.mu.Unlock()
+}
+
+func TestAdmit_BatchRejectedBeforeNormal(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.HostProtection.MemoryPressure = 40
+	cfg.Admission.BatchMemoryPressure = 20
+	cfg.Admission.BatchQueueSeconds = 0
+	mgr := NewManager(cfg, st, &varPressureRuntime{MockRuntimeDriver: rt, pressure: 30}, nil, nil)
+
+	rejected := admissionRejected.Value(PriorityBatch)
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", Priority: PriorityBatch})
+	assert.ErrorIs(t, err, ErrHostExhausted)
+	assert.Contains(t, err.Error(), "admission.batch_memory_pressure")
+	assert.Equal(t, rejected+1, admissionRejected.Value(PriorityBatch))
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	_, err = mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.NoError(t, err)
+}
+
+func TestAdmit_BatchQueuesUntilPressureDrops(t *testing.T) {
+	defer func(d time.Duration) { admissionRetry = d }(admissionRetry)
+	admissionRetry = 5 * time.Millisecond
+
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.Admission.BatchMemoryPressure = 20
+	cfg.Admission.BatchQueueSeconds = 10
+	prt := &varPressureRuntime{MockRuntimeDriver: rt, pressure: 30}
+	mgr := NewManager(cfg, st, prt, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", Priority: PriorityBatch})
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return mgr.batchQueued.Load() == 1 }, time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, admissionQueueDepth.Value(), 1.0)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	prt.set(5)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("queued batch create was not admitted")
+	}
+	assert.Zero(t, mgr.batchQueued.Load())
+}
+
+func TestAdmit_BatchQueueFull(t *testing.T) {
+	cfg := testConfig()
+	cfg.Admission.BatchMemoryPressure = 20
+	cfg.Admission.BatchQueueSeconds = 10
+	cfg.Admission.BatchQueueMax = 1
+	mgr := NewManager(cfg, &MockSessionStore{}, &varPressureRuntime{MockRuntimeDriver: &MockRuntimeDriver{}, pressure: 30}, nil, nil)
+	mgr.batchQueued.Store(1)
+
+	err := mgr.admit(context.Background(), PriorityBatch)
+	assert.ErrorIs(t, err, ErrHostExhausted)
+	assert.Equal(t, int64(1), mgr.batchQueued.Load())
+}
+
+func TestAdmit_QueuedBatchCancelled(t *testing.T) {
+	cfg := testConfig()
+	cfg.Admission.BatchMemoryPressure = 20
+	cfg.Admission.BatchQueueSeconds = 10
+	mgr := NewManager(cfg, &MockSessionStore{}, &varPressureRuntime{MockRuntimeDriver: &MockRuntimeDriver{}, pressure: 30}, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := mgr.admit(ctx, PriorityBatch)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, mgr.batchQueued.Load())
+}
+
+func TestCreate_HighPriorityMarksPoolAcquire(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, rt, nil, pl)
+
+	pooledSess := &store.Session{
+		ID: "pool-123", Image: "python", InitPID: 1, CgroupPath: "/cgroup/pool-123",
+		Status: store.StatusPoolIdle, Cwd: "/workspace", ImageDigest: "sha256:v1",
+		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(24 * time.Hour), LastActivity: time.Now().UTC(),
+	}
+	pl.On("Get", mock.MatchedBy(pool.HighPriority), "python", "").Return("pool-123", true)
+	st.On("GetSession", "pool-123").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("sha256:v1", nil)
+	st.On("UpdateSessionStatus", "pool-123", "running").Return(nil)
+	st.On("UpdateSessionActivity", "pool-123", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil) // runs in goroutine
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python", Priority: PriorityHigh})
+	require.NoError(t, err)
+	assert.Equal(t, "pool", info.AcquireSource)
+}
@@ -0,0 +1,329 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/config"
+)
+
+// Approval statuses.
+const (
+	ApprovalPending   = "pending"
+	ApprovalRunning   = "running"
+	ApprovalCompleted = "completed"
+	ApprovalFailed    = "failed"
+	ApprovalDenied    = "denied"
+	ApprovalExpired   = "expired"
+)
+
+// Approval kinds.
+const (
+	ApprovalKindExec   = "exec"
+	ApprovalKindCreate = "create"
+)
+
+// Audit actions for the approval workflow.
+const (
+	AuditActionApprovalRequested = "approval_requested"
+	AuditActionApprovalGranted   = "approval_granted"
+	AuditActionApprovalDenied    = "approval_denied"
+	AuditActionApprovalExpired   = "approval_expired"
+)
+
+var (
+	ErrApprovalPending  = errors.New("operation pending approval")
+	ErrApprovalNotFound = errors.New("approval not found")
+	ErrApprovalDecided  = errors.New("approval already decided")
+)
+
+// finishedApprovalRetention is how long decided approvals stay queryable.
+const finishedApprovalRetention = time.Hour
+
+// Approval is a parked operation waiting for (or resulting from) an approver decision.
+type Approval struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	SessionID string    `json:"session_id,omitempty"`
+	Cmd       string    `json:"cmd,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	DecidedAt time.Time `json:"decided_at,omitempty"`
+	Result    any       `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+
+	tenant string // tenant of the parked request
+	run    func(ctx context.Context) (any, error)
+}
+
+// PendingApprovalError is returned when an operation was parked for approval.
+type PendingApprovalError struct {
+	Approval Approval
+}
+
+func (e *PendingApprovalError) Error() string {
+	return fmt.Sprintf("%s: approval_id=%s", ErrApprovalPending, e.Approval.ID)
+}
+
+func (e *PendingApprovalError) Unwrap() error {
+	return ErrApprovalPending
+}
+
+// ApprovalQueue holds pending approvals in memory. Pending requests are lost on
+// daemon restart, which is equivalent to them expiring.
+type ApprovalQueue struct {
+	timeout           time.Duration
+	execPatterns      []*regexp.Regexp
+	networkedSessions bool
+
+	mu    sync.Mutex
+	items map[string]*Approval
+}
+
+// NewApprovalQueue compiles the approval rules. It returns nil when disabled.
+func NewApprovalQueue(cfg config.ApprovalConfig, networkMode string) (*ApprovalQueue, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.ApproverKey == "" {
+		return nil, fmt.Errorf("approval.approver_key is required when approvals are enabled")
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	q := &ApprovalQueue{
+		timeout:           timeout,
+		networkedSessions: cfg.NetworkedSessions && networkMode != "" && networkMode != "none",
+		items:             make(map[string]*Approval),
+	}
+	for _, p := range cfg.ExecPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("approval exec_patterns %q: %w", p, err)
+		}
+		q.execPatterns = append(q.execPatterns, re)
+	}
+	return q, nil
+}
+
+func (q *ApprovalQueue) execNeedsApproval(cmd string) (string, bool) {
+	for _, re := range q.execPatterns {
+		if re.MatchString(cmd) {
+			return fmt.Sprintf("command matches %q", re.String()), true
+		}
+	}
+	return "", false
+}
+
+func (q *ApprovalQueue) park(a *Approval) Approval {
+	now := time.Now().UTC()
+	a.ID = uuid.New().String()
+	a.Status = ApprovalPending
+	a.CreatedAt = now
+	a.ExpiresAt = now.Add(q.timeout)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pruneLocked(now)
+	q.items[a.ID] = a
+	return *a
+}
+
+// expireLocked marks overdue pending approvals as expired and returns them.
+func (q *ApprovalQueue) expireLocked(now time.Time) []*Approval {
+	var expired []*Approval
+	for _, a := range q.items {
+		if a.Status == ApprovalPending && now.After(a.ExpiresAt) {
+			a.Status = ApprovalExpired
+			a.DecidedAt = now
+			a.run = nil
+			expired = append(expired, a)
+		}
+	}
+	return expired
+}
+
+func (q *ApprovalQueue) pruneLocked(now time.Time) {
+	for id, a := range q.items {
+		if a.Status != ApprovalPending && a.Status != ApprovalRunning && now.Sub(a.DecidedAt) > finishedApprovalRetention {
+			delete(q.items, id)
+		}
+	}
+}
+
+// requireExecApproval parks cmd if it matches an approval rule.
+func (m *Manager) requireExecApproval(ctx context.Context, sessionID, cmd string, opts ExecOpts) error {
+	if m.approvals == nil || isApproved(ctx) {
+		return nil
+	}
+	scope := callerScope(ctx)
+	return m.parkExecApproval(ctx, sessionID, cmd, func(ctx context.Context) (any, error) {
+		return m.Exec(scope(ctx), sessionID, cmd, opts)
+	})
+}
+
+// parkExecApproval holds cmd until an approver decides on it if it matches
+// an approval rule; run performs the operation once approved.
+func (m *Manager) parkExecApproval(ctx context.Context, sessionID, cmd string, run func(ctx context.Context) (any, error)) error {
+	reason, ok := m.approvals.execNeedsApproval(cmd)
+	if !ok {
+		return nil
+	}
+	a := m.approvals.park(&Approval{
+		Kind:      ApprovalKindExec,
+		SessionID: sessionID,
+		Cmd:       cmd,
+		Reason:    reason,
+		tenant:    tenantFrom(ctx),
+		run:       run,
+	})
+	m.recordAudit(sessionID, AuditActionApprovalRequested, fmt.Sprintf("approval_id=%s kind=exec %s", a.ID, reason))
+	return &PendingApprovalError{Approval: a}
+}
+
+// requireCreateApproval parks session creation when networked sessions need approval.
+func (m *Manager) requireCreateApproval(ctx context.Context, image string, opts CreateOpts) error {
+	if m.approvals == nil || isApproved(ctx) || !m.approvals.networkedSessions {
+		return nil
+	}
+	scope := callerScope(ctx)
+	return m.parkCreateApproval(ctx, image, fmt.Sprintf("network_mode=%s", m.cfg.Defaults.NetworkMode),
+		func(ctx context.Context) (any, error) {
+			return m.Create(scope(ctx), opts)
+		})
+}
+
+// parkCreateApproval holds a create until an approver decides on it; run
+// performs the create once approved.
+func (m *Manager) parkCreateApproval(ctx context.Context, image, reason string, run func(ctx context.Context) (any, error)) error {
+	a := m.approvals.park(&Approval{
+		Kind:   ApprovalKindCreate,
+		Image:  image,
+		Reason: reason,
+		tenant: tenantFrom(ctx),
+		run:    run,
+	})
+	m.recordAudit("", AuditActionApprovalRequested, fmt.Sprintf("approval_id=%s kind=create image=%s %s", a.ID, image, reason))
+	return &PendingApprovalError{Approval: a}
+}
+
+// ListApprovals returns all known approvals, newest first. Tenants only see
+// their own; the default tenant and the approver see all.
+func (m *Manager) ListApprovals(ctx context.Context) ([]Approval, error) {
+	if m.approvals == nil {
+		return []Approval{}, nil
+	}
+	q := m.approvals
+	q.mu.Lock()
+	m.auditExpired(q.expireLocked(time.Now().UTC()))
+	out := make([]Approval, 0, len(q.items))
+	tenant := tenantFrom(ctx)
+	for _, a := range q.items {
+		if tenant == "" || a.tenant == tenant {
+			out = append(out, *a)
+		}
+	}
+	q.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// GetApproval returns a single approval, including its result once finished.
+func (m *Manager) GetApproval(ctx context.Context, id string) (*Approval, error) {
+	if m.approvals == nil {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	q := m.approvals
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	m.auditExpired(q.expireLocked(time.Now().UTC()))
+	a, ok := q.items[id]
+	if tenant := tenantFrom(ctx); !ok || tenant != "" && a.tenant != tenant {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	cp := *a
+	return &cp, nil
+}
+
+// DecideApproval approves or denies a pending approval. Approved operations run
+// in the background; poll GetApproval for the result.
+func (m *Manager) DecideApproval(ctx context.Context, id string, approve bool) (*Approval, error) {
+	if m.approvals == nil {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	q := m.approvals
+	now := time.Now().UTC()
+
+	q.mu.Lock()
+	m.auditExpired(q.expireLocked(now))
+	a, ok := q.items[id]
+	if !ok {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	if a.Status != ApprovalPending {
+		status := a.Status
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s (status=%s)", ErrApprovalDecided, id, status)
+	}
+	a.DecidedAt = now
+	run := a.run
+	a.run = nil
+	if approve {
+		a.Status = ApprovalRunning
+	} else {
+		a.Status = ApprovalDenied
+	}
+	cp := *a
+	q.mu.Unlock()
+
+	if !approve {
+		m.recordAudit(a.SessionID, AuditActionApprovalDenied, "approval_id="+id)
+		return &cp, nil
+	}
+
+	m.recordAudit(a.SessionID, AuditActionApprovalGranted, "approval_id="+id)
+	go func() {
+		result, err := run(withApproved(context.Background()))
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		a.DecidedAt = time.Now().UTC()
+		if err != nil {
+			a.Status = ApprovalFailed
+			a.Error = err.Error()
+			return
+		}
+		a.Status = ApprovalCompleted
+		a.Result = result
+	}()
+	return &cp, nil
+}
+
+func (m *Manager) auditExpired(expired []*Approval) {
+	for _, a := range expired {
+		m.recordAudit(a.SessionID, AuditActionApprovalExpired, "approval_id="+a.ID)
+	}
+}
+
+type approvedKey struct{}
+
+// withApproved marks ctx so that the re-run operation skips the approval gate.
+func withApproved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, approvedKey{}, true)
+}
+
+func isApproved(ctx context.Context) bool {
+	v, _ := ctx.Value(approvedKey{}).(bool)
+	return v
+}
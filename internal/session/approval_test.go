@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newApprovalManager(t *testing.T, cfg config.ApprovalConfig) (*Manager, *MockRuntimeDriver, *MockSessionStore) {
+	t.Helper()
+	mgr, rt, st := newTestManager()
+	q, err := NewApprovalQueue(cfg, "none")
+	require.NoError(t, err)
+	mgr.SetApprovals(q)
+	return mgr, rt, st
+}
+
+func TestNewApprovalQueueRequiresKey(t *testing.T) {
+	_, err := NewApprovalQueue(config.ApprovalConfig{Enabled: true}, "none")
+	assert.Error(t, err)
+
+	q, err := NewApprovalQueue(config.ApprovalConfig{Enabled: false}, "none")
+	require.NoError(t, err)
+	assert.Nil(t, q)
+}
+
+func TestExecParkedAndApproved(t *testing.T) {
+	mgr, rt, st := newApprovalManager(t, config.ApprovalConfig{
+		Enabled: true, ApproverKey: "ak", TimeoutSeconds: 60, ExecPatterns: []string{`^pip install`},
+	})
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	// The approved exec runs with the options it was requested with.
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.TimeoutMs == 5000 && req.RawOutput && req.Shell == "sh"
+	})).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace", Output: "ok",
+	}, nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "pip install requests", ExecOpts{TimeoutMs: 5000, RawOutput: true, Shell: "sh"})
+	var pending *PendingApprovalError
+	require.True(t, errors.As(err, &pending))
+	assert.ErrorIs(t, err, ErrApprovalPending)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+
+	a, err := mgr.DecideApproval(context.Background(), pending.Approval.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, ApprovalRunning, a.Status)
+
+	require.Eventually(t, func() bool {
+		got, err := mgr.GetApproval(context.Background(), a.ID)
+		return err == nil && got.Status == ApprovalCompleted
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = mgr.DecideApproval(context.Background(), a.ID, true)
+	assert.ErrorIs(t, err, ErrApprovalDecided)
+}
+
+func TestExecNotMatchingRunsImmediately(t *testing.T) {
+	mgr, rt, st := newApprovalManager(t, config.ApprovalConfig{
+		Enabled: true, ApproverKey: "ak", ExecPatterns: []string{`^pip install`},
+	})
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace",
+	}, nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "ls", ExecOpts{})
+	require.NoError(t, err)
+}
+
+func TestApprovalDeniedAndExpired(t *testing.T) {
+	mgr, _, st := newApprovalManager(t, config.ApprovalConfig{
+		Enabled: true, ApproverKey: "ak", ExecPatterns: []string{`.`},
+	})
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "id", ExecOpts{})
+	var pending *PendingApprovalError
+	require.True(t, errors.As(err, &pending))
+
+	a, err := mgr.DecideApproval(context.Background(), pending.Approval.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, ApprovalDenied, a.Status)
+
+	_, err = mgr.Exec(context.Background(), "s1", "id", ExecOpts{})
+	require.True(t, errors.As(err, &pending))
+	mgr.approvals.items[pending.Approval.ID].ExpiresAt = time.Now().Add(-time.Second)
+
+	_, err = mgr.DecideApproval(context.Background(), pending.Approval.ID, true)
+	assert.ErrorIs(t, err, ErrApprovalDecided)
+
+	list, err := mgr.ListApprovals(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+func TestGetApprovalNotFound(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	_, err := mgr.GetApproval(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrApprovalNotFound)
+}
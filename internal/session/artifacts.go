@@ -0,0 +1,229 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// ArtifactOpts selects the artifacts an exec collects besides its output.
+// Both need the python shell: the command runs under a wrapper that records
+// them with the standard library, so images need no extra packages.
+type ArtifactOpts struct {
+	Coverage bool // lines executed of the command and files under /workspace
+	Profile  bool // cProfile statistics
+}
+
+func (o ArtifactOpts) enabled() bool {
+	return o.Coverage || o.Profile
+}
+
+// ExecArtifacts holds what an exec collected (see ExecOpts.Artifacts).
+type ExecArtifacts struct {
+	Coverage *CoverageReport `json:"coverage,omitempty"`
+	Profile  *ProfileReport  `json:"profile,omitempty"`
+	Error    string          `json:"error,omitempty"` // why the artifacts are missing
+}
+
+// CoverageReport is the line coverage of an exec. The command itself is the
+// file "<cmd>"; files under /workspace are listed once the command ran code
+// of them.
+type CoverageReport struct {
+	Files   []FileCoverage `json:"files"`
+	Lines   int            `json:"lines"`   // executable lines of all files
+	Covered int            `json:"covered"` // of which executed
+	Percent float64        `json:"percent"`
+}
+
+// FileCoverage is the line coverage of one file.
+type FileCoverage struct {
+	Path    string  `json:"path"`
+	Lines   int     `json:"lines"`
+	Covered int     `json:"covered"`
+	Percent float64 `json:"percent"`
+	Missing []int   `json:"missing"` // executable lines that did not run
+}
+
+// ProfileReport is the cProfile summary of an exec.
+type ProfileReport struct {
+	TotalCalls   int     `json:"total_calls"`
+	TotalSeconds float64 `json:"total_seconds"`
+	// Functions are the functions with the highest cumulative time, at most
+	// maxProfileFunctions.
+	Functions []ProfileFunction `json:"functions"`
+}
+
+// ProfileFunction is a row of a cProfile report. Built-in functions have
+// file "~" and line 0.
+type ProfileFunction struct {
+	Function          string  `json:"function"`
+	File              string  `json:"file"`
+	Line              int     `json:"line"`
+	Calls             int     `json:"calls"`
+	PrimitiveCalls    int     `json:"primitive_calls"` // calls not induced by recursion
+	TotalSeconds      float64 `json:"total_seconds"`   // in the function itself
+	CumulativeSeconds float64 `json:"cumulative_seconds"`
+}
+
+// maxProfileFunctions caps ProfileReport.Functions.
+const maxProfileFunctions = 50
+
+// artifactsPath is where the wrapper leaves the artifacts of an exec. Execs
+// of a session are serialized, so one file per session is enough.
+const artifactsPath = "/workspace/.sandkasten/artifacts.json"
+
+// artifactsWrapper runs a python command and records the artifacts. The
+// placeholders are the base64 command, artifactsPath, whether to record
+// coverage and profile, and maxProfileFunctions.
+const artifactsWrapper = `def _sandkasten_run():
+    import base64, dis, json, linecache, os, sys, threading
+    src = base64.b64decode("%s").decode()
+    out = "%s"
+    want_coverage, want_profile = %s, %s
+    try:
+        os.remove(out)
+    except OSError:
+        pass
+
+    hits = {}
+
+    def tracked(path):
+        return path == "<cmd>" or (path.startswith("/workspace/") and not path.startswith("/workspace/.sandkasten/"))
+
+    def trace(frame, event, arg):
+        if not tracked(frame.f_code.co_filename):
+            return None
+        lines = hits.setdefault(frame.f_code.co_filename, set())
+
+        def local(frame, event, arg):
+            if event == "line":
+                lines.add(frame.f_lineno)
+            return local
+        return local
+
+    def executable(code, lines):
+        for _, line in dis.findlinestarts(code):
+            if line:
+                lines.add(line)
+        for const in code.co_consts:
+            if hasattr(const, "co_code"):
+                executable(const, lines)
+
+    def coverage():
+        files = []
+        for path in sorted(hits):
+            try:
+                if path == "<cmd>":
+                    text = src
+                else:
+                    with open(path, "rb") as f:
+                        text = f.read()
+                lines = set()
+                executable(compile(text, path, "exec"), lines)
+            except (OSError, SyntaxError, ValueError):
+                continue
+            run = hits[path] & lines
+            files.append({"path": path, "lines": len(lines), "covered": len(run), "missing": sorted(lines - run)})
+        return {"files": files}
+
+    def profile(prof):
+        import pstats
+        stats = pstats.Stats(prof)
+        rows = []
+        for (path, line, name), (cc, nc, tt, ct, _) in stats.stats.items():
+            rows.append({"function": name, "file": path, "line": line, "calls": nc, "primitive_calls": cc,
+                         "total_seconds": tt, "cumulative_seconds": ct})
+        rows.sort(key=lambda r: r["cumulative_seconds"], reverse=True)
+        return {"total_calls": stats.total_calls, "total_seconds": stats.total_tt, "functions": rows[:%d]}
+
+    linecache.cache["<cmd>"] = (len(src), None, src.splitlines(True), "<cmd>")
+    code = compile(src, "<cmd>", "exec")
+    scope = {"__name__": "__main__", "__builtins__": __builtins__}
+    prof = None
+    if want_profile:
+        import cProfile
+        prof = cProfile.Profile()
+    if want_coverage:
+        threading.settrace(trace)
+        sys.settrace(trace)
+    if prof:
+        prof.enable()
+    try:
+        exec(code, scope)
+    finally:
+        if prof:
+            prof.disable()
+        sys.settrace(None)
+        threading.settrace(None)
+        report = {}
+        if want_coverage:
+            report["coverage"] = coverage()
+        if prof:
+            report["profile"] = profile(prof)
+        os.makedirs(os.path.dirname(out), exist_ok=True)
+        with open(out + ".tmp", "w") as f:
+            json.dump(report, f)
+        os.replace(out + ".tmp", out)
+
+
+_sandkasten_run()
+`
+
+// wrapArtifacts returns the command that runs cmd in shell and collects the
+// artifacts in opts, or cmd itself when opts asks for none.
+func wrapArtifacts(cmd, shell string, opts ArtifactOpts) (string, error) {
+	if !opts.enabled() {
+		return cmd, nil
+	}
+	if shell != "python" {
+		return "", fmt.Errorf("%w: coverage and profile need shell python", ErrShellUnavailable)
+	}
+	return fmt.Sprintf(artifactsWrapper,
+		base64.StdEncoding.EncodeToString([]byte(cmd)), artifactsPath,
+		pythonBool(opts.Coverage), pythonBool(opts.Profile), maxProfileFunctions), nil
+}
+
+func pythonBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return "False"
+}
+
+// collectArtifacts reads the artifacts the wrapper of an exec left in the
+// session. It returns nil when opts asks for none; artifacts that cannot be
+// read, e.g. because the command timed out, report why in Error.
+func (m *Manager) collectArtifacts(ctx context.Context, sessionID string, opts ArtifactOpts) *ExecArtifacts {
+	if !opts.enabled() {
+		return nil
+	}
+	defer m.removeSessionFile(ctx, sessionID, artifactsPath)
+	data, err := m.readSessionFile(ctx, sessionID, artifactsPath)
+	if err != nil {
+		return &ExecArtifacts{Error: "no artifacts recorded: " + err.Error()}
+	}
+	var artifacts ExecArtifacts
+	if err := json.Unmarshal(data, &artifacts); err != nil {
+		return &ExecArtifacts{Error: fmt.Sprintf("decode artifacts: %v", err)}
+	}
+	if c := artifacts.Coverage; c != nil {
+		for i := range c.Files {
+			f := &c.Files[i]
+			f.Percent = percent(f.Covered, f.Lines)
+			c.Lines += f.Lines
+			c.Covered += f.Covered
+		}
+		c.Percent = percent(c.Covered, c.Lines)
+	}
+	return &artifacts
+}
+
+// percent returns n of total in percent, cut to two decimals; 100 when total
+// is 0.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n*10000/total) / 100
+}
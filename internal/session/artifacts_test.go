@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func isRequest(typ protocol.RequestType) any {
+	return mock.MatchedBy(func(req protocol.Request) bool { return req.Type == typ })
+}
+
+func TestExecArtifacts(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	var ran protocol.Request
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && req.Shell == "python"
+	})).Run(func(args mock.Arguments) {
+		ran = args.Get(2).(protocol.Request)
+	}).Return(&protocol.Response{Type: protocol.ResponseExec, Cwd: "/workspace", Output: "2\n"}, nil)
+	report := `{"coverage": {"files": [
+		{"path": "<cmd>", "lines": 3, "covered": 2, "missing": [3]},
+		{"path": "/workspace/lib.py", "lines": 1, "covered": 1, "missing": []}]},
+		"profile": {"total_calls": 4, "total_seconds": 0.5, "functions": [
+		{"function": "add", "file": "/workspace/lib.py", "line": 1, "calls": 1, "primitive_calls": 1,
+		 "total_seconds": 0.25, "cumulative_seconds": 0.5}]}}`
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestRead)).Return(&protocol.Response{
+		Type: protocol.ResponseRead, ContentBase64: base64.StdEncoding.EncodeToString([]byte(report)),
+	}, nil)
+	var removed protocol.Request
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool { return req.Shell == "sh" })).Run(func(args mock.Arguments) {
+		removed = args.Get(2).(protocol.Request)
+	}).Return(&protocol.Response{Type: protocol.ResponseExec}, nil)
+
+	opts := ExecOpts{TimeoutMs: 5000, Shell: "python", Artifacts: ArtifactOpts{Coverage: true, Profile: true}}
+	result, err := mgr.Exec(context.Background(), "s1", "from lib import add\nprint(add(1, 1))", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "2\n", result.Output)
+	assert.Contains(t, ran.Cmd, base64.StdEncoding.EncodeToString([]byte("from lib import add\nprint(add(1, 1))")))
+	assert.Contains(t, ran.Cmd, "want_coverage, want_profile = True, True")
+	assert.Contains(t, removed.Cmd, artifactsPath)
+
+	require.NotNil(t, result.Artifacts)
+	assert.Empty(t, result.Artifacts.Error)
+	cov := result.Artifacts.Coverage
+	require.NotNil(t, cov)
+	assert.Equal(t, 4, cov.Lines)
+	assert.Equal(t, 3, cov.Covered)
+	assert.Equal(t, 75.0, cov.Percent)
+	assert.Equal(t, 66.66, cov.Files[0].Percent)
+	assert.Equal(t, []int{3}, cov.Files[0].Missing)
+	require.NotNil(t, result.Artifacts.Profile)
+	assert.Equal(t, 4, result.Artifacts.Profile.TotalCalls)
+	assert.Equal(t, "add", result.Artifacts.Profile.Functions[0].Function)
+}
+
+func TestExecArtifacts_Missing(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestExec)).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace", ExitCode: 127,
+	}, nil)
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestRead)).Return(&protocol.Response{
+		Type: protocol.ResponseError, Error: "open: no such file or directory",
+	}, nil)
+
+	opts := ExecOpts{TimeoutMs: 5000, Shell: "python", Artifacts: ArtifactOpts{Profile: true}}
+	result, err := mgr.Exec(context.Background(), "s1", "print(1)", opts)
+	require.NoError(t, err)
+	require.NotNil(t, result.Artifacts)
+	assert.True(t, strings.HasPrefix(result.Artifacts.Error, "no artifacts recorded"))
+}
+
+func TestExecArtifacts_NeedPython(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "ls", ExecOpts{TimeoutMs: 5000, Artifacts: ArtifactOpts{Coverage: true}})
+	assert.ErrorIs(t, err, ErrShellUnavailable)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// AuditActionTerminalAttached is recorded for every interactive terminal
+// opened in a session; what is typed into it is not audited.
+const AuditActionTerminalAttached = "terminal_attached"
+
+// ErrAttachUnsupported is returned when the runtime cannot attach terminals.
+var ErrAttachUnsupported = errors.New("terminal attach not supported by runtime")
+
+// Attach starts an interactive shell on a terminal of its own in the
+// session, next to the shell serving exec. Keystrokes cannot be checked
+// against the command policy or exec approvals, so attach is refused while
+// either is configured. The caller must Close the terminal.
+func (m *Manager) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if m.policy != nil || m.approvals != nil {
+		return nil, fmt.Errorf("%w: interactive terminals bypass the command policy and exec approvals", ErrPolicyDenied)
+	}
+	a, ok := m.runtime.(runtime.TerminalAttacher)
+	if !ok {
+		return nil, ErrAttachUnsupported
+	}
+
+	term, err := a.Attach(ctx, sess.ID, opts)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, ErrAttachUnsupported
+	}
+	if err != nil {
+		if msg := err.Error(); strings.HasPrefix(msg, protocol.ErrShellUnavailable) {
+			return nil, fmt.Errorf("%w: %s", ErrShellUnavailable, strings.TrimPrefix(msg, protocol.ErrShellUnavailable+": "))
+		}
+		return nil, fmt.Errorf("attach: %w", err)
+	}
+
+	shell := opts.Shell
+	if shell == "" {
+		shell = "session"
+	}
+	m.recordAudit(sess.ID, AuditActionTerminalAttached, "shell="+shell)
+	m.extendSessionLease(sess.ID, sess.Cwd)
+	return &leasedTerminal{Terminal: term, extend: func() { m.extendSessionLease(sess.ID, sess.Cwd) }, last: time.Now()}, nil
+}
+
+// terminalLeaseInterval throttles the lease extensions of typing.
+const terminalLeaseInterval = time.Minute
+
+// leasedTerminal counts input as session activity, so a session does not
+// expire under someone typing into it.
+type leasedTerminal struct {
+	runtime.Terminal
+	extend func()
+	last   time.Time
+}
+
+func (t *leasedTerminal) Write(p []byte) (int, error) {
+	if time.Since(t.last) >= terminalLeaseInterval {
+		t.last = time.Now()
+		t.extend()
+	}
+	return t.Terminal.Write(p)
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/policy"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// attachRuntime adds runtime.TerminalAttacher to the mock driver.
+type attachRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r attachRuntime) Attach(ctx context.Context, sessionID string, opts runtime.AttachOpts) (runtime.Terminal, error) {
+	args := r.Called(ctx, sessionID, opts)
+	if term := args.Get(0); term != nil {
+		return term.(runtime.Terminal), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// fakeTerminal records the input written to it.
+type fakeTerminal struct {
+	runtime.Terminal
+	input []byte
+}
+
+func (t *fakeTerminal) Write(p []byte) (int, error) {
+	t.input = append(t.input, p...)
+	return len(p), nil
+}
+
+func TestAttach(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.runtime = attachRuntime{rt}
+	term := &fakeTerminal{}
+	opts := runtime.AttachOpts{Shell: "python", Rows: 30, Cols: 100}
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Attach", mock.Anything, "s1", opts).Return(term, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	got, err := mgr.Attach(context.Background(), "s1", opts)
+	require.NoError(t, err)
+	_, err = got.Write([]byte("1+1\r"))
+	require.NoError(t, err)
+	assert.Equal(t, "1+1\r", string(term.input))
+	st.AssertExpectations(t)
+}
+
+func TestAttachErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "unsupported session", err: errors.ErrUnsupported, wantErr: ErrAttachUnsupported},
+		{name: "shell missing", err: fmt.Errorf("%s: python is not installed in this image", protocol.ErrShellUnavailable), wantErr: ErrShellUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr, rt, st := newTestManager()
+			mgr.runtime = attachRuntime{rt}
+			st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+			rt.On("Attach", mock.Anything, "s1", mock.Anything).Return(nil, tt.err)
+
+			_, err := mgr.Attach(context.Background(), "s1", runtime.AttachOpts{Shell: "python"})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAttachUnsupportedRuntime(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.Attach(context.Background(), "s1", runtime.AttachOpts{})
+	assert.ErrorIs(t, err, ErrAttachUnsupported)
+}
+
+func TestAttachRefusedWithPolicy(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.runtime = attachRuntime{rt}
+	pol, err := policy.New(config.PolicyConfig{Enabled: true, DenyPrefixes: []string{"reboot"}}, "none")
+	require.NoError(t, err)
+	mgr.SetPolicy(pol)
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err = mgr.Attach(context.Background(), "s1", runtime.AttachOpts{})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	rt.AssertNotCalled(t, "Attach", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// ErrSharedChannelsDisabled is returned for a create with shared_channel
+// while shared_channels is off or the runtime cannot mount channels.
+var ErrSharedChannelsDisabled = errors.New("shared channels disabled")
+
+// AuditActionSharedChannelAttached records a session joining a shared channel.
+const AuditActionSharedChannelAttached = "shared_channel_attached"
+
+// sharedChannelID maps the channel name a caller uses to the tenant-scoped
+// name the runtime and store know it by, like workspaceDirID. "" = none.
+func (m *Manager) sharedChannelID(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if !m.cfg.SharedChannels.Enabled {
+		return "", ErrSharedChannelsDisabled
+	}
+	if _, ok := m.runtime.(runtime.SharedChannelMounter); !ok {
+		return "", fmt.Errorf("%w: not supported by runtime", ErrSharedChannelsDisabled)
+	}
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return tenant + tenantWorkspaceSep + name, nil
+	}
+	return name, nil
+}
+
+// attachSharedChannel mounts channel at /shared in a running session and
+// records it, so the channel stays alive while the session does.
+func (m *Manager) attachSharedChannel(ctx context.Context, sessionID, channel string) error {
+	mounter := m.runtime.(runtime.SharedChannelMounter)
+	m.channelMu.Lock()
+	defer m.channelMu.Unlock()
+	size := int64(m.cfg.SharedChannels.SizeMB) << 20
+	if err := mounter.MountSharedChannel(ctx, sessionID, channel, size); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			// A layered runtime whose session kind has no /shared.
+			return fmt.Errorf("%w: not supported by runtime", ErrSharedChannelsDisabled)
+		}
+		return fmt.Errorf("attach shared channel: %w", err)
+	}
+	if err := m.store.UpdateSessionSharedChannel(sessionID, channel); err != nil {
+		return fmt.Errorf("attach shared channel: %w", err)
+	}
+	m.recordAudit(sessionID, AuditActionSharedChannelAttached, channel)
+	return nil
+}
+
+// releaseSharedChannel frees the channel's tmpfs once no live session uses it.
+func (m *Manager) releaseSharedChannel(ctx context.Context, channel string) {
+	mounter, ok := m.runtime.(runtime.SharedChannelMounter)
+	if channel == "" || !ok {
+		return
+	}
+	m.channelMu.Lock()
+	defer m.channelMu.Unlock()
+	if n, err := m.store.SharedChannelSessions(channel); err != nil || n > 0 {
+		return
+	}
+	_ = mounter.ReleaseSharedChannel(ctx, channel)
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// channelRuntime adds runtime.SharedChannelMounter to the mock driver.
+type channelRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r channelRuntime) MountSharedChannel(ctx context.Context, sessionID, channel string, sizeBytes int64) error {
+	return r.Called(ctx, sessionID, channel, sizeBytes).Error(0)
+}
+
+func (r channelRuntime) ReleaseSharedChannel(ctx context.Context, channel string) error {
+	return r.Called(ctx, channel).Error(0)
+}
+
+func TestCreate_SharedChannelDisabled(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", SharedChannel: "results"})
+	assert.ErrorIs(t, err, ErrSharedChannelsDisabled)
+
+	// Enabled, but the runtime cannot mount channels.
+	mgr.cfg.SharedChannels = config.SharedChannelsConfig{Enabled: true, SizeMB: 64}
+	_, err = mgr.Create(context.Background(), CreateOpts{Image: "python", SharedChannel: "results"})
+	assert.ErrorIs(t, err, ErrSharedChannelsDisabled)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreate_AttachesTenantSharedChannel(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.SharedChannels = config.SharedChannelsConfig{Enabled: true, SizeMB: 16}
+	mgr := NewManager(cfg, st, channelRuntime{rt}, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("MountSharedChannel", mock.Anything, mock.Anything, "acme_results", int64(16<<20)).Return(nil)
+	st.On("UpdateSessionSharedChannel", mock.Anything, "acme_results").Return(nil)
+
+	info, err := mgr.Create(WithTenant(context.Background(), "acme"), CreateOpts{Image: "python", SharedChannel: "results"})
+	require.NoError(t, err)
+	assert.Equal(t, "results", info.SharedChannel)
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+func TestCreate_SharedChannelMountFailureDestroys(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.SharedChannels = config.SharedChannelsConfig{Enabled: true, SizeMB: 16}
+	mgr := NewManager(cfg, st, channelRuntime{rt}, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("MountSharedChannel", mock.Anything, mock.Anything, "results", int64(16<<20)).Return(assert.AnError)
+	st.On("UpdateSessionStatus", mock.Anything, "destroyed").Return(nil)
+	rt.On("Destroy", mock.Anything, mock.Anything).Return(nil)
+	st.On("SharedChannelSessions", "results").Return(0, nil)
+	rt.On("ReleaseSharedChannel", mock.Anything, "results").Return(nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", SharedChannel: "results"})
+	assert.ErrorIs(t, err, assert.AnError)
+	rt.AssertCalled(t, "Destroy", mock.Anything, mock.Anything)
+	rt.AssertCalled(t, "ReleaseSharedChannel", mock.Anything, "results")
+}
+
+func TestCreate_SharedChannelUnsupportedBySessionKind(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.SharedChannels = config.SharedChannelsConfig{Enabled: true, SizeMB: 16}
+	mgr := NewManager(cfg, st, channelRuntime{rt}, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("MountSharedChannel", mock.Anything, mock.Anything, "results", int64(16<<20)).Return(errors.ErrUnsupported)
+	st.On("UpdateSessionStatus", mock.Anything, "destroyed").Return(nil)
+	rt.On("Destroy", mock.Anything, mock.Anything).Return(nil)
+	st.On("SharedChannelSessions", "results").Return(0, nil)
+	rt.On("ReleaseSharedChannel", mock.Anything, "results").Return(nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", SharedChannel: "results"})
+	assert.ErrorIs(t, err, ErrSharedChannelsDisabled)
+	rt.AssertCalled(t, "Destroy", mock.Anything, mock.Anything)
+}
+
+func TestDestroy_ReleasesSharedChannelOfLastSession(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	mgr := NewManager(testConfig(), st, channelRuntime{rt}, nil, nil)
+	sess := &store.Session{ID: "s1", Status: "running", SharedChannel: "results"}
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionStatus", "s1", mock.Anything).Return(nil)
+	rt.On("Destroy", mock.Anything, "s1").Return(nil)
+	st.On("SharedChannelSessions", "results").Return(1, nil).Once()
+
+	require.NoError(t, mgr.Destroy(context.Background(), "s1"))
+	rt.AssertNotCalled(t, "ReleaseSharedChannel", mock.Anything, mock.Anything)
+
+	st.On("SharedChannelSessions", "results").Return(0, nil).Once()
+	rt.On("ReleaseSharedChannel", mock.Anything, "results").Return(nil)
+	require.NoError(t, mgr.Destroy(context.Background(), "s1"))
+	rt.AssertCalled(t, "ReleaseSharedChannel", mock.Anything, "results")
+}
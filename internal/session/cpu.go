@@ -0,0 +1,105 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+var (
+	// ErrNoCPUTuning is returned for a requested CPU weight or burst on
+	// runtimes that cannot set them per session.
+	ErrNoCPUTuning = errors.New("cpu tuning not supported")
+	// ErrInvalidCPU is returned for a CPU weight or burst out of range.
+	ErrInvalidCPU = errors.New("invalid cpu tuning")
+)
+
+// resolveCPU returns the CPU tuning of a new session: the requested weight
+// and burst, and the weight of its priority where it asks for none. Values
+// equal to the cgroup defaults (defaults.cpu_weight, defaults.cpu_burst_ms)
+// are dropped, and nil is returned if nothing is left. Priority weights are
+// skipped on runtimes that cannot tune sessions.
+func (m *Manager) resolveCPU(req *runtime.CPUTuning, priority string) (*runtime.CPUTuning, error) {
+	var t runtime.CPUTuning
+	if req != nil {
+		t = *req
+	}
+	if t.Weight < 0 || t.Weight > config.MaxCPUWeight {
+		return nil, fmt.Errorf("%w: weight must be between 1 and %d, got %d", ErrInvalidCPU, config.MaxCPUWeight, t.Weight)
+	}
+	if maxBurst := m.cfg.MaxCPUBurstMs(); t.BurstMs < 0 || t.BurstMs > maxBurst {
+		return nil, fmt.Errorf("%w: burst_ms must be between 0 and %d (one period of cpu_limit), got %d", ErrInvalidCPU, maxBurst, t.BurstMs)
+	}
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	if t.Weight == 0 {
+		t.Weight = m.cfg.Defaults.CPUWeightByPriority[priority]
+	}
+	if t.Weight == m.cfg.Defaults.CPUWeight {
+		t.Weight = 0
+	}
+	if t.BurstMs == m.cfg.Defaults.CPUBurstMs {
+		t.BurstMs = 0
+	}
+	if t == (runtime.CPUTuning{}) {
+		return nil, nil
+	}
+	if _, ok := m.runtime.(runtime.CPUTuner); !ok {
+		if req == nil || *req == (runtime.CPUTuning{}) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w by runtime", ErrNoCPUTuning)
+	}
+	return &t, nil
+}
+
+// tuneCPU applies the CPU tuning t (nil = none) to a session's cgroup and,
+// if record is set, stores it with the session.
+func (m *Manager) tuneCPU(ctx context.Context, sessionID string, t *runtime.CPUTuning, record bool) error {
+	if t == nil {
+		return nil
+	}
+	tuner, ok := m.runtime.(runtime.CPUTuner)
+	if !ok {
+		return fmt.Errorf("%w by runtime", ErrNoCPUTuning)
+	}
+	if err := tuner.TuneCPU(ctx, sessionID, *t); errors.Is(err, errors.ErrUnsupported) {
+		return fmt.Errorf("%w by runtime", ErrNoCPUTuning)
+	} else if err != nil {
+		return fmt.Errorf("tune cpu: %w", err)
+	}
+	if !record {
+		return nil
+	}
+	return m.store.UpdateSessionCPU(sessionID, encodeCPU(t))
+}
+
+// encodeCPU stores a CPU tuning as JSON, or an empty string for none.
+func encodeCPU(t *runtime.CPUTuning) string {
+	if t == nil {
+		return ""
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeCPU reverses encodeCPU. A tuning that does not decode is reported as
+// none.
+func decodeCPU(s string) *runtime.CPUTuning {
+	if s == "" {
+		return nil
+	}
+	var t runtime.CPUTuning
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return nil
+	}
+	return &t
+}
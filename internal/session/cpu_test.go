@@ -0,0 +1,99 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type cpuRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r cpuRuntime) TuneCPU(ctx context.Context, sessionID string, t runtime.CPUTuning) error {
+	return r.Called(ctx, sessionID, t).Error(0)
+}
+
+func TestResolveCPU(t *testing.T) {
+	cfg := testConfig()
+	cfg.Defaults.CPULimit = 2
+	cfg.Defaults.CPUWeight = 100
+	cfg.Defaults.CPUWeightByPriority = map[string]int{PriorityHigh: 400, PriorityBatch: 20}
+	mgr := NewManager(cfg, &MockSessionStore{}, cpuRuntime{&MockRuntimeDriver{}}, nil, nil)
+
+	got, err := mgr.resolveCPU(nil, "")
+	require.NoError(t, err)
+	assert.Nil(t, got, "normal priority keeps the defaults")
+
+	got, err = mgr.resolveCPU(nil, PriorityBatch)
+	require.NoError(t, err)
+	assert.Equal(t, &runtime.CPUTuning{Weight: 20}, got)
+
+	got, err = mgr.resolveCPU(&runtime.CPUTuning{Weight: 800, BurstMs: 50}, PriorityHigh)
+	require.NoError(t, err)
+	assert.Equal(t, &runtime.CPUTuning{Weight: 800, BurstMs: 50}, got, "request wins over priority")
+
+	got, err = mgr.resolveCPU(&runtime.CPUTuning{Weight: 100}, PriorityHigh)
+	require.NoError(t, err)
+	assert.Nil(t, got, "the default weight needs no tuning")
+
+	_, err = mgr.resolveCPU(&runtime.CPUTuning{Weight: 10001}, "")
+	assert.ErrorIs(t, err, ErrInvalidCPU)
+	_, err = mgr.resolveCPU(&runtime.CPUTuning{BurstMs: 201}, "")
+	assert.ErrorIs(t, err, ErrInvalidCPU, "burst over one period of cpu_limit")
+}
+
+func TestResolveCPU_Unsupported(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	mgr.cfg.Defaults.CPULimit = 1
+	mgr.cfg.Defaults.CPUWeightByPriority = map[string]int{PriorityHigh: 400}
+
+	got, err := mgr.resolveCPU(nil, PriorityHigh)
+	require.NoError(t, err)
+	assert.Nil(t, got, "priority weights are best effort")
+
+	_, err = mgr.resolveCPU(&runtime.CPUTuning{Weight: 400}, "")
+	assert.ErrorIs(t, err, ErrNoCPUTuning)
+}
+
+func TestCreate_TunesCPU(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.Defaults.CPUWeightByPriority = map[string]int{PriorityBatch: 20}
+	mgr := NewManager(cfg, st, cpuRuntime{rt}, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("TuneCPU", mock.Anything, mock.Anything, runtime.CPUTuning{Weight: 20}).Return(nil)
+	st.On("UpdateSessionCPU", mock.Anything, `{"weight":20}`).Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Priority: PriorityBatch})
+	require.NoError(t, err)
+	assert.Equal(t, &runtime.CPUTuning{Weight: 20}, info.CPU)
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+func TestCreate_PriorityWeightBestEffort(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.Defaults.CPUWeightByPriority = map[string]int{PriorityBatch: 20}
+	mgr := NewManager(cfg, st, cpuRuntime{rt}, nil, nil)
+
+	// A wrapping driver reports sessions it cannot tune, e.g. wasm sessions.
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("TuneCPU", mock.Anything, mock.Anything, runtime.CPUTuning{Weight: 20}).Return(errors.ErrUnsupported)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Priority: PriorityBatch})
+	require.NoError(t, err)
+	assert.Nil(t, info.CPU)
+	st.AssertNotCalled(t, "UpdateSessionCPU", mock.Anything, mock.Anything)
+}
@@ -2,7 +2,10 @@ package session
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,35 +13,122 @@ import (
 	storemod "github.com/p-arndt/sandkasten/internal/store"
 )
 
+// createRetries is how often a create that failed for a transient reason is
+// retried; createRetryBackoff is the wait before the first retry.
+const createRetries = 2
+
+var createRetryBackoff = 100 * time.Millisecond
+
 func (m *Manager) Create(ctx context.Context, opts CreateOpts) (*SessionInfo, error) {
-	image := m.resolveImage(opts.Image)
-	if !isImageNameSafe(image) {
-		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, image)
+	channel, err := m.sharedChannelID(ctx, opts.SharedChannel)
+	if err != nil {
+		return nil, err
+	}
+	cpu, err := m.resolveCPU(opts.CPU, opts.Priority)
+	if err != nil {
+		return nil, err
+	}
+	release, err := m.takeSessionSlot(ctx)
+	if errors.Is(err, ErrSessionLimit) {
+		return nil, m.queueCreate(ctx, opts, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	info, err := m.create(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Pooled sessions start before their channel, CPU tuning and size are
+	// known, so they are set after acquire for every session alike.
+	if err := m.tuneCPU(ctx, info.ID, cpu, true); errors.Is(err, ErrNoCPUTuning) && (opts.CPU == nil || *opts.CPU == (runtime.CPUTuning{})) {
+		cpu = nil // priority weights are best effort, e.g. for wasm sessions
+	} else if err != nil {
+		m.discardCreated(ctx, info.ID, "")
+		return nil, err
+	}
+	info.CPU = cpu
+	if channel != "" {
+		if err := m.attachSharedChannel(ctx, info.ID, channel); err != nil {
+			m.discardCreated(ctx, info.ID, channel)
+			return nil, err
+		}
+		info.SharedChannel = opts.SharedChannel
+	}
+	if opts.Rows == 0 && opts.Cols == 0 {
+		return info, nil
+	}
+	if err := m.resizeTerminal(ctx, info.ID, opts.Rows, opts.Cols); err != nil {
+		m.discardCreated(ctx, info.ID, channel)
+		return nil, err
+	}
+	return info, nil
+}
+
+// discardCreated tears down a session whose create failed after the sandbox
+// started, releasing its shared channel if it was the only user.
+func (m *Manager) discardCreated(ctx context.Context, sessionID, channel string) {
+	_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
+	_ = m.runtime.Destroy(ctx, sessionID)
+	m.releaseSharedChannel(ctx, channel)
+}
+
+func (m *Manager) create(ctx context.Context, opts CreateOpts) (*SessionInfo, error) {
+	if m.Draining() {
+		return nil, ErrDraining
 	}
-	if !m.isImageAllowed(image) {
-		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, image)
+	if err := m.admit(ctx, opts.Priority); err != nil {
+		return nil, err
+	}
+
+	ref, image, err := m.sessionImage(ctx, opts.Image)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.requireCreateApproval(ctx, ref, opts); err != nil {
+		return nil, err
+	}
+	det, err := m.resolveDeterminism(opts.Determinism)
+	if err != nil {
+		return nil, err
 	}
 
 	ttl := m.resolveTTL(opts.TTLSeconds)
 	workspaceID := opts.WorkspaceID
+	if workspaceID != "" {
+		if workspaceID, err = m.workspaceDirID(ctx, workspaceID); err != nil {
+			return nil, err
+		}
+	}
 	acquireDetail := ""
 
 	if err := m.ensureWorkspace(ctx, workspaceID); err != nil {
 		return nil, err
 	}
 
-	// Try pool acquire first (image+workspace aware).
-	if m.pool != nil {
-		if sessionID, ok := m.pool.Get(ctx, image, workspaceID); ok {
+	// Try pool acquire first (image+workspace aware). Pooled sessions already
+	// have their hostname and environment, so a custom hostname or a
+	// determinism profile needs a cold create.
+	if m.pool != nil && opts.Hostname != "" {
+		acquireDetail = "pool_custom_hostname"
+	} else if m.pool != nil && det != nil {
+		acquireDetail = "pool_deterministic"
+	} else if m.pool != nil {
+		if sessionID, ok := m.pool.Get(withPriority(ctx, opts.Priority), image, workspaceID); ok {
 			sess, err := m.store.GetSession(sessionID)
-			if err == nil && sess != nil {
+			if err == nil && sess != nil && !m.poolDigestCurrent(ctx, image, sess) {
+				acquireDetail = "pool_image_digest_mismatch"
+				_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
+				_ = m.runtime.Destroy(ctx, sessionID)
+			} else if err == nil && sess != nil {
 				// Workspace-aware pool entry: already mounted at create time.
 				if workspaceID != "" && sess.WorkspaceID == workspaceID {
 					if info := m.finishPoolAcquire(ctx, sessionID, sess, workspaceID, ttl); info != nil {
 						go m.pool.Refill(context.Background(), image, workspaceID, 1)
 						return info, nil
 					}
-					acquireDetail = "pool_finish_acquire_failed"
+					acquireDetail = poolError("pool_finish_acquire_failed")
 				} else if workspaceID != "" && sess.WorkspaceID != "" && sess.WorkspaceID != workspaceID {
 					acquireDetail = "pool_workspace_mismatch"
 					_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
@@ -49,40 +139,44 @@ func (m *Manager) Create(ctx context.Context, opts CreateOpts) (*SessionInfo, er
 					// Legacy/unbound pool entry: bind-mount workspace when needed.
 					if workspaceID != "" {
 						if err := m.runtime.MountWorkspace(ctx, sessionID, workspaceID); err != nil {
-							acquireDetail = "pool_mount_workspace_failed"
+							acquireDetail = poolError("pool_mount_workspace_failed")
 							_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
 							_ = m.runtime.Destroy(ctx, sessionID)
 						} else if err := m.store.UpdateSessionWorkspace(sessionID, workspaceID); err != nil {
-							acquireDetail = "pool_update_workspace_failed"
+							acquireDetail = poolError("pool_update_workspace_failed")
 							_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
 							_ = m.runtime.Destroy(ctx, sessionID)
 						} else if info := m.finishPoolAcquire(ctx, sessionID, sess, workspaceID, ttl); info != nil {
 							go m.pool.Refill(context.Background(), image, workspaceID, 1)
 							return info, nil
 						} else {
-							acquireDetail = "pool_finish_acquire_failed"
+							acquireDetail = poolError("pool_finish_acquire_failed")
 						}
 					} else if info := m.finishPoolAcquire(ctx, sessionID, sess, workspaceID, ttl); info != nil {
 						go m.pool.Refill(context.Background(), image, "", 0)
 						return info, nil
 					} else {
-						acquireDetail = "pool_finish_acquire_failed"
+						acquireDetail = poolError("pool_finish_acquire_failed")
 					}
 				}
 			} else {
-				acquireDetail = "pool_session_lookup_failed"
+				acquireDetail = poolError("pool_session_lookup_failed")
 			}
 		} else if workspaceID != "" && !m.cfg.Defaults.ReadonlyRootfs {
 			// Optional fallback to global image pool when writable rootfs allows late bind-mount.
-			if sessionID, ok := m.pool.Get(ctx, image, ""); ok {
+			if sessionID, ok := m.pool.Get(withPriority(ctx, opts.Priority), image, ""); ok {
 				sess, err := m.store.GetSession(sessionID)
-				if err == nil && sess != nil {
+				if err == nil && sess != nil && !m.poolDigestCurrent(ctx, image, sess) {
+					acquireDetail = "pool_image_digest_mismatch"
+					_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
+					_ = m.runtime.Destroy(ctx, sessionID)
+				} else if err == nil && sess != nil {
 					if err := m.runtime.MountWorkspace(ctx, sessionID, workspaceID); err != nil {
-						acquireDetail = "pool_mount_workspace_failed"
+						acquireDetail = poolError("pool_mount_workspace_failed")
 						_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
 						_ = m.runtime.Destroy(ctx, sessionID)
 					} else if err := m.store.UpdateSessionWorkspace(sessionID, workspaceID); err != nil {
-						acquireDetail = "pool_update_workspace_failed"
+						acquireDetail = poolError("pool_update_workspace_failed")
 						_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
 						_ = m.runtime.Destroy(ctx, sessionID)
 					} else if info := m.finishPoolAcquire(ctx, sessionID, sess, workspaceID, ttl); info != nil {
@@ -103,14 +197,29 @@ func (m *Manager) Create(ctx context.Context, opts CreateOpts) (*SessionInfo, er
 	now := time.Now().UTC()
 	expiresAt := now.Add(time.Duration(ttl) * time.Second)
 
-	info, err := m.runtime.Create(ctx, runtime.CreateOpts{
+	info, retries, err := m.createSandbox(ctx, runtime.CreateOpts{
 		SessionID:   sessionID,
 		Image:       image,
 		WorkspaceID: workspaceID,
+		Hostname:    opts.Hostname,
+		Determinism: det,
 	})
 	if err != nil {
+		if retries > 0 {
+			return nil, fmt.Errorf("create sandbox (%d retries): %w", retries, err)
+		}
 		return nil, fmt.Errorf("create sandbox: %w", err)
 	}
+	if retries > 0 {
+		acquireDetail = strings.TrimPrefix(acquireDetail+",create_retries="+strconv.Itoa(retries), ",")
+	}
+	if cmds := m.cfg.ImageSetup[image]; len(cmds) > 0 {
+		if err := RunSetupHooks(ctx, m.runtime, sessionID, cmds, m.cfg.Defaults.MaxExecTimeoutMs); err != nil {
+			RecordCreateFailure(m.diag, CreateFailureSourceAPI, sessionID, image, err)
+			_ = m.runtime.Destroy(ctx, sessionID)
+			return nil, fmt.Errorf("create sandbox: %w", err)
+		}
+	}
 
 	sess := &storemod.Session{
 		ID:           sessionID,
@@ -120,6 +229,11 @@ func (m *Manager) Create(ctx context.Context, opts CreateOpts) (*SessionInfo, er
 		Status:       "running",
 		Cwd:          "/workspace",
 		WorkspaceID:  workspaceID,
+		ImageDigest:  info.ImageDigest,
+		Hostname:     opts.Hostname,
+		Determinism:  encodeDeterminism(det),
+		KeyID:        keyIDFrom(ctx),
+		Tenant:       tenantFrom(ctx),
 		CreatedAt:    now,
 		ExpiresAt:    expiresAt,
 		LastActivity: now,
@@ -146,15 +260,77 @@ func (m *Manager) Create(ctx context.Context, opts CreateOpts) (*SessionInfo, er
 		Cwd:           "/workspace",
 		AcquireSource: "cold",
 		AcquireDetail: acquireDetail,
-		WorkspaceID:   workspaceID,
+		WorkspaceID:   opts.WorkspaceID,
+		ImageDigest:   info.ImageDigest,
+		Hostname:      runtime.Hostname(sessionID, opts.Hostname),
+		MachineID:     runtime.MachineID(sessionID),
 		CreatedAt:     now,
 		ExpiresAt:     expiresAt,
+		Determinism:   det,
 	}, nil
 }
 
+// sessionImage checks that the image a caller asked for ("" = the default)
+// may be used and returns its reference and the name of the image to run.
+func (m *Manager) sessionImage(ctx context.Context, requested string) (ref, image string, err error) {
+	ref = m.resolveImage(requested)
+	if !isImageRefSafe(ref) {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidImage, ref)
+	}
+	if !m.isImageAllowed(ref) {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidImage, ref)
+	}
+	if err := m.checkImageAvailable(ref); err != nil {
+		return "", "", err
+	}
+	image, err = m.lookupImage(ctx, ref)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s: %v", ErrInvalidImage, ref, err)
+	}
+	if !isImageNameSafe(image) {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidImage, image)
+	}
+	if err := m.checkImageScan(ctx, image); err != nil {
+		return "", "", err
+	}
+	return ref, image, nil
+}
+
+// createSandbox runs the runtime create, retrying failures the driver marks
+// transient up to createRetries times with doubling backoff. Every failed
+// attempt is recorded; retries is the number of attempts after the first.
+func (m *Manager) createSandbox(ctx context.Context, opts runtime.CreateOpts) (info *runtime.SessionInfo, retries int, err error) {
+	backoff := createRetryBackoff
+	for ; ; retries++ {
+		info, err = m.runtime.Create(ctx, opts)
+		if err == nil {
+			return info, retries, nil
+		}
+		RecordCreateFailure(m.diag, CreateFailureSourceAPI, opts.SessionID, opts.Image, err)
+		if retries == createRetries || !runtime.IsTransientCreateError(err) {
+			return nil, retries, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, retries, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
 // finishPoolAcquire updates session status/activity and returns SessionInfo on success.
 // Returns nil on any error (caller should fall through to normal create).
 func (m *Manager) finishPoolAcquire(ctx context.Context, sessionID string, sess *storemod.Session, workspaceID string, ttl int) *SessionInfo {
+	if u, ok := m.runtime.(runtime.RunnerUpdater); ok {
+		// A runner that cannot be upgraded (e.g. predates the protocol)
+		// is dropped; the caller cold-creates instead.
+		if _, err := u.EnsureRunner(ctx, sessionID); err != nil {
+			_ = m.runtime.Destroy(ctx, sessionID)
+			_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
+			return nil
+		}
+	}
 	now := time.Now().UTC()
 	expiresAt := now.Add(time.Duration(ttl) * time.Second)
 	if err := m.store.UpdateSessionStatus(sessionID, "running"); err != nil {
@@ -167,18 +343,39 @@ func (m *Manager) finishPoolAcquire(ctx context.Context, sessionID string, sess
 		_ = m.runtime.Destroy(ctx, sessionID)
 		return nil
 	}
+	if keyID, tenant := keyIDFrom(ctx), tenantFrom(ctx); keyID != "" || tenant != "" {
+		if err := m.store.UpdateSessionOwner(sessionID, keyID, tenant); err != nil {
+			_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
+			_ = m.runtime.Destroy(ctx, sessionID)
+			return nil
+		}
+	}
 	return &SessionInfo{
 		ID:            sessionID,
 		Image:         sess.Image,
 		Status:        "running",
 		Cwd:           sess.Cwd,
 		AcquireSource: "pool",
-		WorkspaceID:   workspaceID,
+		WorkspaceID:   publicWorkspaceID(tenantFrom(ctx), workspaceID),
+		ImageDigest:   sess.ImageDigest,
+		Hostname:      runtime.Hostname(sessionID, sess.Hostname),
+		MachineID:     runtime.MachineID(sessionID),
 		CreatedAt:     sess.CreatedAt,
 		ExpiresAt:     expiresAt,
 	}
 }
 
+// poolDigestCurrent reports whether a pooled session was built from the current
+// version of image. After an image update the pool may still hold sessions of
+// the old version; handing one out would make the recorded digest a lie.
+func (m *Manager) poolDigestCurrent(ctx context.Context, image string, sess *storemod.Session) bool {
+	digest, err := m.runtime.ImageDigest(ctx, image)
+	if err != nil {
+		return false
+	}
+	return digest == "" || digest == sess.ImageDigest
+}
+
 func (m *Manager) resolveImage(image string) string {
 	if image == "" {
 		return m.cfg.DefaultImage
@@ -197,6 +394,7 @@ func (m *Manager) ensureWorkspace(ctx context.Context, workspaceID string) error
 	if workspaceID == "" || !m.cfg.Workspace.Enabled {
 		return nil
 	}
+	m.recordWorkspace(ctx, workspaceID)
 
 	if m.workspace == nil {
 		return nil
@@ -217,3 +415,11 @@ func (m *Manager) ensureWorkspace(ctx context.Context, workspaceID string) error
 
 	return nil
 }
+
+// checkHostPressure rejects new sessions while the host is under memory
+// pressure (host_protection.memory_pressure), so a busy fleet cannot push
+// the host, and the daemon with it, into the OOM killer.
+func (m *Manager) checkHostPressure() error {
+	r, _ := m.runtime.(runtime.MemoryPressureReporter)
+	return runtime.CheckMemoryPressure(r, m.cfg.HostProtection.MemoryPressure)
+}
@@ -31,6 +31,7 @@ func TestCreateSuccess(t *testing.T) {
 	assert.Equal(t, "running", info.Status)
 	assert.Equal(t, "/workspace", info.Cwd)
 	assert.Equal(t, "cold", info.AcquireSource)
+	assert.Equal(t, "sk-"+info.ID[:8], info.Hostname)
 
 	rt.AssertExpectations(t)
 	st.AssertExpectations(t)
@@ -80,12 +81,13 @@ func TestCreate_PoolHit_NoWorkspace(t *testing.T) {
 
 	pooledSess := &store.Session{
 		ID: "pool-123", Image: "python", InitPID: 1, CgroupPath: "/cgroup/pool-123",
-		Status: store.StatusPoolIdle, Cwd: "/workspace", WorkspaceID: "",
+		Status: store.StatusPoolIdle, Cwd: "/workspace", WorkspaceID: "", ImageDigest: "sha256:v1",
 		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(24 * time.Hour), LastActivity: time.Now().UTC(),
 	}
 
 	pl.On("Get", mock.Anything, "python", "").Return("pool-123", true)
 	st.On("GetSession", "pool-123").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("sha256:v1", nil)
 	st.On("UpdateSessionStatus", "pool-123", "running").Return(nil)
 	st.On("UpdateSessionActivity", "pool-123", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil) // runs in goroutine
@@ -97,12 +99,117 @@ func TestCreate_PoolHit_NoWorkspace(t *testing.T) {
 	assert.Equal(t, "python", info.Image)
 	assert.Equal(t, "running", info.Status)
 	assert.Equal(t, "pool", info.AcquireSource)
+	assert.Equal(t, "sha256:v1", info.ImageDigest)
 
 	rt.AssertNotCalled(t, "Create")
 	pl.AssertNumberOfCalls(t, "Get", 1)
 	st.AssertExpectations(t)
 }
 
+func TestCreate_PoolHit_StaleImageDigest_FallsThroughToNormalCreate(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, rt, nil, pl)
+
+	pooledSess := &store.Session{
+		ID: "pool-old", Image: "python", InitPID: 1, CgroupPath: "/cgroup/pool-old",
+		Status: store.StatusPoolIdle, Cwd: "/workspace", ImageDigest: "sha256:v1",
+		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(24 * time.Hour), LastActivity: time.Now().UTC(),
+	}
+
+	pl.On("Get", mock.Anything, "python", "").Return("pool-old", true)
+	st.On("GetSession", "pool-old").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("sha256:v2", nil)
+	st.On("UpdateSessionStatus", "pool-old", "destroyed").Return(nil)
+	rt.On("Destroy", mock.Anything, "pool-old").Return(nil)
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "new-session", InitPID: 999, CgroupPath: "/cgroup/new-session", ImageDigest: "sha256:v2",
+	}, nil)
+	st.On("CreateSession", mock.MatchedBy(func(s *store.Session) bool {
+		return s.ImageDigest == "sha256:v2"
+	})).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	require.NoError(t, err)
+	assert.Equal(t, "cold", info.AcquireSource)
+	assert.Equal(t, "pool_image_digest_mismatch", info.AcquireDetail)
+	assert.Equal(t, "sha256:v2", info.ImageDigest)
+	rt.AssertCalled(t, "Destroy", mock.Anything, "pool-old")
+	st.AssertExpectations(t)
+}
+
+// runnerUpdaterRuntime adds runtime.RunnerUpdater to the mock driver.
+type runnerUpdaterRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r runnerUpdaterRuntime) EnsureRunner(ctx context.Context, sessionID string) (bool, error) {
+	args := r.Called(ctx, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestCreate_PoolHit_UpgradesRunner(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, runnerUpdaterRuntime{rt}, nil, pl)
+
+	pooledSess := &store.Session{
+		ID: "pool-123", Image: "python", InitPID: 1, CgroupPath: "/cgroup/pool-123",
+		Status: store.StatusPoolIdle, Cwd: "/workspace",
+		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(24 * time.Hour), LastActivity: time.Now().UTC(),
+	}
+
+	pl.On("Get", mock.Anything, "python", "").Return("pool-123", true)
+	st.On("GetSession", "pool-123").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("", nil)
+	rt.On("EnsureRunner", mock.Anything, "pool-123").Return(true, nil)
+	st.On("UpdateSessionStatus", "pool-123", "running").Return(nil)
+	st.On("UpdateSessionActivity", "pool-123", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	require.NoError(t, err)
+	assert.Equal(t, "pool-123", info.ID)
+	assert.Equal(t, "pool", info.AcquireSource)
+	rt.AssertCalled(t, "EnsureRunner", mock.Anything, "pool-123")
+	rt.AssertNotCalled(t, "Create")
+}
+
+func TestCreate_PoolHit_RunnerNotUpgradable_FallsThroughToNormalCreate(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, runnerUpdaterRuntime{rt}, nil, pl)
+
+	pooledSess := &store.Session{
+		ID: "pool-old", Image: "python", InitPID: 1, CgroupPath: "/cgroup/pool-old",
+		Status: store.StatusPoolIdle, Cwd: "/workspace",
+		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(24 * time.Hour), LastActivity: time.Now().UTC(),
+	}
+
+	pl.On("Get", mock.Anything, "python", "").Return("pool-old", true)
+	st.On("GetSession", "pool-old").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("", nil)
+	rt.On("EnsureRunner", mock.Anything, "pool-old").Return(false, fmt.Errorf("runner does not support self-update"))
+	rt.On("Destroy", mock.Anything, "pool-old").Return(nil)
+	st.On("UpdateSessionStatus", "pool-old", "destroyed").Return(nil)
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "new-session", InitPID: 999, CgroupPath: "/cgroup/new-session",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	require.NoError(t, err)
+	assert.Equal(t, "cold", info.AcquireSource)
+	assert.Equal(t, "pool_finish_acquire_failed", info.AcquireDetail)
+	rt.AssertCalled(t, "Destroy", mock.Anything, "pool-old")
+	st.AssertNotCalled(t, "UpdateSessionStatus", "pool-old", "running")
+}
+
 func TestCreate_PoolHit_WithWorkspace(t *testing.T) {
 	rt := &MockRuntimeDriver{}
 	st := &MockSessionStore{}
@@ -121,6 +228,7 @@ func TestCreate_PoolHit_WithWorkspace(t *testing.T) {
 
 	pl.On("Get", mock.Anything, "python", "my-ws").Return("pool-456", true)
 	st.On("GetSession", "pool-456").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("", nil)
 	rt.On("MountWorkspace", mock.Anything, "pool-456", "my-ws").Return(nil)
 	st.On("UpdateSessionWorkspace", "pool-456", "my-ws").Return(nil)
 	st.On("UpdateSessionStatus", "pool-456", "running").Return(nil)
@@ -158,6 +266,7 @@ func TestCreate_PoolHit_MountWorkspaceFails_FallsThroughToNormalCreate(t *testin
 
 	pl.On("Get", mock.Anything, "python", "my-ws").Return("pool-789", true)
 	st.On("GetSession", "pool-789").Return(pooledSess, nil)
+	rt.On("ImageDigest", mock.Anything, "python").Return("", nil)
 	rt.On("MountWorkspace", mock.Anything, "pool-789", "my-ws").Return(fmt.Errorf("mount failed"))
 	st.On("UpdateSessionStatus", "pool-789", "destroyed").Maybe().Return(nil)
 	rt.On("Destroy", mock.Anything, "pool-789").Return(nil)
@@ -169,15 +278,178 @@ func TestCreate_PoolHit_MountWorkspaceFails_FallsThroughToNormalCreate(t *testin
 	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
 	pl.On("Refill", mock.Anything, "python", "my-ws", 1).Maybe().Return(nil)
 
+	poolErrors := createFailures.Value(runtime.CreateFailurePool, CreateFailureSourcePool)
 	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python", WorkspaceID: "my-ws"})
 	require.NoError(t, err)
 	require.NotNil(t, info)
 	assert.NotEmpty(t, info.ID)
 	assert.Equal(t, "python", info.Image)
 	assert.Equal(t, "my-ws", info.WorkspaceID)
+	assert.Equal(t, "pool_mount_workspace_failed", info.AcquireDetail)
+	assert.Equal(t, poolErrors+1, createFailures.Value(runtime.CreateFailurePool, CreateFailureSourcePool))
 
 	rt.AssertCalled(t, "Destroy", mock.Anything, "pool-789")
 	rt.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
 		return opts.WorkspaceID == "my-ws"
 	}))
 }
+
+// pressureRuntime adds runtime.MemoryPressureReporter to the mock driver.
+type pressureRuntime struct {
+	*MockRuntimeDriver
+	pressure float64
+}
+
+func (r pressureRuntime) MemoryPressure() (float64, error) { return r.pressure, nil }
+
+func TestCreate_RejectedUnderMemoryPressure(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.HostProtection.MemoryPressure = 40
+	mgr := NewManager(cfg, st, pressureRuntime{rt, 55}, nil, nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.ErrorIs(t, err, ErrHostExhausted)
+	assert.Contains(t, err.Error(), "host_protection.memory_pressure")
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreate_BelowMemoryPressureWatermark(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.HostProtection.MemoryPressure = 40
+	mgr := NewManager(cfg, st, pressureRuntime{rt, 12.5}, nil, nil)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 1, CgroupPath: "/cgroup/s1",
+	}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	require.NoError(t, err)
+	assert.Equal(t, "cold", info.AcquireSource)
+}
+
+func TestCreate_CustomHostname_SkipsPool(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	cfg := testConfig()
+	mgr := NewManager(cfg, st, rt, nil, pl)
+
+	rt.On("Create", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
+		return opts.Hostname == "build-box"
+	})).Return(&runtime.SessionInfo{SessionID: "new-session"}, nil)
+	st.On("CreateSession", mock.MatchedBy(func(sess *store.Session) bool {
+		return sess.Hostname == "build-box"
+	})).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil) // runs in goroutine
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python", Hostname: "build-box"})
+	require.NoError(t, err)
+	assert.Equal(t, "cold", info.AcquireSource)
+	assert.Equal(t, "pool_custom_hostname", info.AcquireDetail)
+	assert.Equal(t, "build-box", info.Hostname)
+	assert.Equal(t, runtime.MachineID(info.ID), info.MachineID)
+
+	pl.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+// deterministicRuntime adds determinism support to the mock driver.
+type deterministicRuntime struct {
+	*MockRuntimeDriver
+	err error
+}
+
+func (r deterministicRuntime) CheckDeterminism(*runtime.Determinism) error { return r.err }
+
+func TestCreate_Deterministic_SkipsPool(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, deterministicRuntime{rt, nil}, nil, pl)
+	clock := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := runtime.Determinism{Seed: 42, Clock: clock, TZ: "UTC", Locale: "C.UTF-8"}
+
+	rt.On("Create", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
+		return opts.Determinism != nil && *opts.Determinism == want
+	})).Return(&runtime.SessionInfo{SessionID: "new-session"}, nil)
+	st.On("CreateSession", mock.MatchedBy(func(sess *store.Session) bool {
+		return decodeDeterminism(sess.Determinism) != nil && *decodeDeterminism(sess.Determinism) == want
+	})).Return(nil)
+	pl.On("Refill", mock.Anything, "python", "", 0).Maybe().Return(nil) // runs in goroutine
+
+	info, err := mgr.Create(context.Background(), CreateOpts{
+		Image:       "python",
+		Determinism: &runtime.Determinism{Seed: 42, Clock: clock},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pool_deterministic", info.AcquireDetail)
+	require.NotNil(t, info.Determinism)
+	assert.Equal(t, want, *info.Determinism)
+
+	pl.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+func TestCreate_Deterministic_Unsupported(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python", Determinism: &runtime.Determinism{Seed: 1}})
+	assert.ErrorIs(t, err, ErrNoDeterminism)
+
+	mgr = NewManager(testConfig(), &MockSessionStore{}, deterministicRuntime{rt, fmt.Errorf("no libfaketime")}, nil, nil)
+	_, err = mgr.Create(context.Background(), CreateOpts{Image: "python", Determinism: &runtime.Determinism{Seed: 1}})
+	assert.ErrorIs(t, err, ErrNoDeterminism)
+	assert.ErrorContains(t, err, "no libfaketime")
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func transientCreateError() error {
+	return &runtime.CreateError{Stage: "launch", Errno: "EAGAIN", Transient: true, Err: fmt.Errorf("launch nsinit: resource temporarily unavailable")}
+}
+
+func TestCreate_RetriesTransientFailure(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	defer func(d time.Duration) { createRetryBackoff = d }(createRetryBackoff)
+	createRetryBackoff = time.Millisecond
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, transientCreateError()).Once()
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{SessionID: "s1"}, nil).Once()
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "create_retries=1", info.AcquireDetail)
+	rt.AssertNumberOfCalls(t, "Create", 2)
+}
+
+func TestCreate_GivesUpAfterRetries(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+	defer func(d time.Duration) { createRetryBackoff = d }(createRetryBackoff)
+	createRetryBackoff = time.Millisecond
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, transientCreateError())
+
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 retries")
+	rt.AssertNumberOfCalls(t, "Create", 1+createRetries)
+}
+
+func TestCreate_DoesNotRetryPermanentFailure(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, &runtime.CreateError{
+		Stage: "image", Class: runtime.CreateFailureImageMissing, Err: fmt.Errorf("image base not found"),
+	})
+
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	require.Error(t, err)
+	rt.AssertNumberOfCalls(t, "Create", 1)
+}
@@ -0,0 +1,268 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/metrics"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// Operation statuses.
+const (
+	OperationQueued    = "queued"
+	OperationRunning   = "running"
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+	OperationExpired   = "expired"
+)
+
+// OperationKindCreate is the kind of a queued session create.
+const OperationKindCreate = "create"
+
+var (
+	ErrSessionLimit      = errors.New("session limit reached")
+	ErrCreateQueued      = errors.New("create queued")
+	ErrOperationNotFound = errors.New("operation not found")
+)
+
+// finishedOperationRetention is how long finished operations stay queryable.
+const finishedOperationRetention = time.Hour
+
+var (
+	createQueueDepth = metrics.Default.NewGaugeVec("sandkasten_create_queue_depth",
+		"Creates waiting for a free slot under admission.max_sessions.")
+	createQueueExpired = metrics.Default.NewCounterVec("sandkasten_create_queue_expired_total",
+		"Queued creates that got no slot within admission.create_queue_seconds.")
+)
+
+// Operation is a create that was queued because max_sessions was reached.
+// Result is set once the session started.
+type Operation struct {
+	ID         string       `json:"id"`
+	Kind       string       `json:"kind"`
+	Image      string       `json:"image,omitempty"`
+	Status     string       `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	FinishedAt time.Time    `json:"finished_at,omitempty"`
+	Result     *SessionInfo `json:"result,omitempty"`
+	Error      string       `json:"error,omitempty"`
+
+	tenant string // tenant of the queued request
+}
+
+// QueuedCreateError is returned when a create was queued for a free slot.
+type QueuedCreateError struct {
+	Operation Operation
+}
+
+func (e *QueuedCreateError) Error() string {
+	return fmt.Sprintf("%s: operation_id=%s", ErrCreateQueued, e.Operation.ID)
+}
+
+func (e *QueuedCreateError) Unwrap() error {
+	return ErrCreateQueued
+}
+
+// createQueue admits creates up to admission.max_sessions and holds the rest
+// in FIFO order. Like approvals it lives in memory only.
+type createQueue struct {
+	mu       sync.Mutex
+	creating int      // creates holding a slot whose session is not stored yet
+	waiting  []string // queued operation IDs, oldest first
+	items    map[string]*Operation
+}
+
+type sessionSlotKey struct{}
+
+// withSessionSlot marks ctx as holding a slot taken by the queue.
+func withSessionSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionSlotKey{}, true)
+}
+
+type noCreateQueueKey struct{}
+
+// withoutCreateQueue makes creates fail instead of queueing at the limit,
+// e.g. for group members, which start together or not at all.
+func withoutCreateQueue(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCreateQueueKey{}, true)
+}
+
+// takeSessionSlot reserves one of admission.max_sessions for a create and
+// returns the func that gives it back once the create finished. Callers
+// never overtake queued creates.
+func (m *Manager) takeSessionSlot(ctx context.Context) (func(), error) {
+	limit := m.cfg.Admission.MaxSessions
+	if held, _ := ctx.Value(sessionSlotKey{}).(bool); limit <= 0 || held {
+		return func() {}, nil
+	}
+	q := &m.creates
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting) > 0 {
+		return nil, sessionLimitError(limit)
+	}
+	if err := m.slotFreeLocked(limit); err != nil {
+		return nil, err
+	}
+	q.creating++
+	return m.releaseSessionSlot, nil
+}
+
+func (m *Manager) releaseSessionSlot() {
+	m.creates.mu.Lock()
+	m.creates.creating--
+	m.creates.mu.Unlock()
+}
+
+func (m *Manager) slotFreeLocked(limit int) error {
+	n, err := m.store.ActiveSessions()
+	if err != nil {
+		return err
+	}
+	if n+m.creates.creating >= limit {
+		return sessionLimitError(limit)
+	}
+	return nil
+}
+
+func sessionLimitError(limit int) error {
+	return &runtime.HostLimitError{Limit: "admission.max_sessions", Value: int64(limit), Err: ErrSessionLimit}
+}
+
+// queueCreate parks a create that hit the session limit until a slot frees
+// up. It returns limitErr when queueing is off, not allowed or full.
+func (m *Manager) queueCreate(ctx context.Context, opts CreateOpts, limitErr error) error {
+	size := m.cfg.Admission.CreateQueueSize
+	if noQueue, _ := ctx.Value(noCreateQueueKey{}).(bool); size <= 0 || noQueue {
+		return limitErr
+	}
+	if m.Draining() {
+		return ErrDraining
+	}
+	q := &m.creates
+	now := time.Now().UTC()
+	q.mu.Lock()
+	q.pruneLocked(now)
+	if len(q.waiting) >= size {
+		q.mu.Unlock()
+		return fmt.Errorf("create queue full: %w", limitErr)
+	}
+	op := &Operation{
+		ID:        uuid.New().String(),
+		Kind:      OperationKindCreate,
+		Image:     m.resolveImage(opts.Image),
+		Status:    OperationQueued,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(m.cfg.Admission.CreateQueueSeconds) * time.Second),
+		tenant:    tenantFrom(ctx),
+	}
+	if q.items == nil {
+		q.items = make(map[string]*Operation)
+	}
+	q.items[op.ID] = op
+	q.waiting = append(q.waiting, op.ID)
+	createQueueDepth.Set(float64(len(q.waiting)))
+	cp := *op
+	q.mu.Unlock()
+
+	scope := callerScope(ctx)
+	go m.runQueuedCreate(op, func() (*SessionInfo, error) {
+		return m.Create(withSessionSlot(scope(context.Background())), opts)
+	})
+	return &QueuedCreateError{Operation: cp}
+}
+
+// runQueuedCreate waits until op is first in line and a slot is free, then
+// runs create while holding that slot.
+func (m *Manager) runQueuedCreate(op *Operation, create func() (*SessionInfo, error)) {
+	ticker := time.NewTicker(admissionRetry)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		ok, err := m.takeQueuedSlot(op)
+		if err != nil {
+			m.finishOperation(op, nil, err)
+			return
+		}
+		if ok {
+			break
+		}
+	}
+	info, err := create()
+	m.releaseSessionSlot()
+	m.finishOperation(op, info, err)
+}
+
+// takeQueuedSlot gives op the next free slot if it is first in line. It
+// fails once op has waited past its deadline or the daemon drains.
+func (m *Manager) takeQueuedSlot(op *Operation) (bool, error) {
+	q := &m.creates
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dequeue := func() {
+		q.waiting = slices.DeleteFunc(q.waiting, func(id string) bool { return id == op.ID })
+		createQueueDepth.Set(float64(len(q.waiting)))
+	}
+	if m.Draining() {
+		dequeue()
+		return false, ErrDraining
+	}
+	if time.Now().After(op.ExpiresAt) {
+		dequeue()
+		op.Status = OperationExpired
+		createQueueExpired.Inc()
+		return false, fmt.Errorf("no free slot within %s: %w", op.ExpiresAt.Sub(op.CreatedAt), sessionLimitError(m.cfg.Admission.MaxSessions))
+	}
+	if q.waiting[0] != op.ID || m.slotFreeLocked(m.cfg.Admission.MaxSessions) != nil {
+		return false, nil
+	}
+	dequeue()
+	q.creating++
+	op.Status = OperationRunning
+	return true, nil
+}
+
+func (m *Manager) finishOperation(op *Operation, info *SessionInfo, err error) {
+	q := &m.creates
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	op.FinishedAt = time.Now().UTC()
+	switch {
+	case err != nil && op.Status == OperationExpired:
+		op.Error = err.Error()
+	case err != nil:
+		op.Status = OperationFailed
+		op.Error = err.Error()
+	default:
+		op.Status = OperationCompleted
+		op.Result = info
+	}
+}
+
+func (q *createQueue) pruneLocked(now time.Time) {
+	for id, op := range q.items {
+		if !op.FinishedAt.IsZero() && now.Sub(op.FinishedAt) > finishedOperationRetention {
+			delete(q.items, id)
+		}
+	}
+}
+
+// GetOperation returns a queued create, including its session once started.
+func (m *Manager) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	q := &m.creates
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	op, ok := q.items[id]
+	if tenant := tenantFrom(ctx); !ok || tenant != "" && op.tenant != tenant {
+		return nil, fmt.Errorf("%w: %s", ErrOperationNotFound, id)
+	}
+	cp := *op
+	return &cp, nil
+}
@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitedManager(maxSessions, queueSize int) (*Manager, *MockRuntimeDriver, *MockSessionStore) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Admission.MaxSessions = maxSessions
+	mgr.cfg.Admission.CreateQueueSize = queueSize
+	mgr.cfg.Admission.CreateQueueSeconds = 60
+	return mgr, rt, st
+}
+
+func TestCreate_SessionLimitRejectsWithoutQueue(t *testing.T) {
+	mgr, rt, st := newLimitedManager(2, 0)
+	st.On("ActiveSessions").Return(2, nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.ErrorIs(t, err, ErrSessionLimit)
+	assert.ErrorIs(t, err, ErrHostExhausted)
+	var limitErr *runtime.HostLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "admission.max_sessions", limitErr.Limit)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreate_QueuedUntilSlotFrees(t *testing.T) {
+	defer func(d time.Duration) { admissionRetry = d }(admissionRetry)
+	admissionRetry = 5 * time.Millisecond
+
+	mgr, rt, st := newLimitedManager(2, 4)
+	st.On("ActiveSessions").Return(2, nil).Twice()
+	st.On("ActiveSessions").Return(1, nil)
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	ctx := WithTenant(context.Background(), "acme")
+	_, err := mgr.Create(ctx, CreateOpts{Image: "python"})
+	var queued *QueuedCreateError
+	require.ErrorAs(t, err, &queued)
+	assert.Equal(t, OperationQueued, queued.Operation.Status)
+
+	_, err = mgr.GetOperation(WithTenant(context.Background(), "other"), queued.Operation.ID)
+	assert.ErrorIs(t, err, ErrOperationNotFound)
+
+	var op *Operation
+	require.Eventually(t, func() bool {
+		op, err = mgr.GetOperation(ctx, queued.Operation.ID)
+		return err == nil && op.Status == OperationCompleted
+	}, time.Second, 5*time.Millisecond)
+	require.NotNil(t, op.Result)
+	assert.Equal(t, "python", op.Result.Image)
+	assert.Zero(t, mgr.creates.creating)
+	assert.Empty(t, mgr.creates.waiting)
+}
+
+func TestCreate_QueuedCreateExpires(t *testing.T) {
+	defer func(d time.Duration) { admissionRetry = d }(admissionRetry)
+	admissionRetry = 5 * time.Millisecond
+
+	mgr, rt, st := newLimitedManager(1, 4)
+	mgr.cfg.Admission.CreateQueueSeconds = 0
+	st.On("ActiveSessions").Return(1, nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	var queued *QueuedCreateError
+	require.ErrorAs(t, err, &queued)
+
+	require.Eventually(t, func() bool {
+		op, err := mgr.GetOperation(context.Background(), queued.Operation.ID)
+		return err == nil && op.Status == OperationExpired && op.Error != ""
+	}, time.Second, 5*time.Millisecond)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreate_QueueFull(t *testing.T) {
+	mgr, _, st := newLimitedManager(1, 1)
+	mgr.creates.waiting = []string{"earlier"}
+	st.On("ActiveSessions").Return(0, nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.ErrorIs(t, err, ErrSessionLimit, "queued creates are not overtaken")
+	assert.Contains(t, err.Error(), "create queue full")
+}
+
+func TestCreateGroup_DoesNotQueue(t *testing.T) {
+	mgr, _, st := newLimitedManager(1, 4)
+	st.On("ActiveSessions").Return(1, nil)
+
+	_, err := mgr.CreateGroup(context.Background(), GroupCreateOpts{CreateOpts: CreateOpts{Image: "python"}, Count: 2})
+	assert.ErrorIs(t, err, ErrSessionLimit)
+	assert.False(t, errors.Is(err, ErrCreateQueued))
+	assert.Empty(t, mgr.creates.waiting)
+}
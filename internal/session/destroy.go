@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/hooks"
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+// Destroy reasons passed to the destroy hooks.
+const (
+	DestroyReasonDestroyed = "destroyed"
+	DestroyReasonExpired   = "expired"
+	DestroyReasonCrashed   = "crashed"
+)
+
+// AuditActionDestroyHookFailed records a destroy hook that failed.
+const AuditActionDestroyHookFailed = "destroy_hook_failed"
+
+// DestroyNotifier runs the host-side destroy hooks (see hooks.Notifier).
+type DestroyNotifier interface {
+	AfterDestroy(ctx context.Context, ev hooks.DestroyEvent) error
+}
+
+// SetDestroyNotifier installs the host-side destroy hooks (nil = none).
+func (m *Manager) SetDestroyNotifier(n DestroyNotifier) {
+	m.onDestroy = n
+}
+
+// BeforeDestroy runs destroy_hooks.commands in a session that is about to be
+// torn down, e.g. to copy artifacts into its workspace. A failing command is
+// audited; the session is destroyed anyway.
+func (m *Manager) BeforeDestroy(ctx context.Context, sess *storemod.Session) {
+	cmds := m.cfg.DestroyHooks.Commands
+	if len(cmds) == 0 || sess == nil {
+		return
+	}
+	timeout := hooks.Timeout(m.cfg.DestroyHooks)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := runHookCommands(ctx, m.runtime, sess.ID, cmds, int(timeout.Milliseconds())); err != nil {
+		hooks.Failed(hooks.HookCommands)
+		m.recordAudit(sess.ID, AuditActionDestroyHookFailed, "destroy "+err.Error())
+	}
+}
+
+// AfterDestroy releases the shared channel of a torn-down session and runs
+// its host-side destroy hooks in the background. Drain waits for them like
+// for execs.
+func (m *Manager) AfterDestroy(sess *storemod.Session, reason string) {
+	if sess == nil {
+		return
+	}
+	m.releaseSharedChannel(context.Background(), sess.SharedChannel)
+	if m.onDestroy == nil {
+		return
+	}
+	ev := hooks.DestroyEvent{
+		SessionID:   sess.ID,
+		Image:       sess.Image,
+		WorkspaceID: sess.WorkspaceID,
+		Tenant:      sess.Tenant,
+		Reason:      reason,
+		DestroyedAt: time.Now().UTC(),
+	}
+	done := m.trackExec()
+	go func() {
+		defer done()
+		if err := m.onDestroy.AfterDestroy(context.Background(), ev); err != nil {
+			m.recordAudit(sess.ID, AuditActionDestroyHookFailed, err.Error())
+		}
+	}()
+}
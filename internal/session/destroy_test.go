@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/hooks"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	events chan hooks.DestroyEvent
+	err    error
+}
+
+func (f *fakeNotifier) AfterDestroy(ctx context.Context, ev hooks.DestroyEvent) error {
+	f.events <- ev
+	return f.err
+}
+
+func TestDestroy_RunsDestroyHooks(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.DestroyHooks.Commands = []string{"collect-artifacts"}
+	notifier := &fakeNotifier{events: make(chan hooks.DestroyEvent, 1)}
+	mgr.SetDestroyNotifier(notifier)
+	sess := &store.Session{ID: "s1", Image: "python", WorkspaceID: "ws1", Status: "running"}
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionStatus", "s1", "destroying").Return(nil)
+	rt.On("Exec", mock.Anything, "s1", isSetupHook("collect-artifacts")).Return(&protocol.Response{Type: protocol.ResponseExec}, nil)
+	rt.On("Destroy", mock.Anything, "s1").Return(nil)
+	st.On("UpdateSessionStatus", "s1", "destroyed").Return(nil)
+
+	require.NoError(t, mgr.Destroy(context.Background(), "s1"))
+	rt.AssertCalled(t, "Exec", mock.Anything, "s1", isSetupHook("collect-artifacts"))
+
+	select {
+	case ev := <-notifier.events:
+		assert.Equal(t, "s1", ev.SessionID)
+		assert.Equal(t, "python", ev.Image)
+		assert.Equal(t, "ws1", ev.WorkspaceID)
+		assert.Equal(t, DestroyReasonDestroyed, ev.Reason)
+	case <-time.After(time.Second):
+		t.Fatal("destroy notifier not called")
+	}
+	// Drain waits for the hook to finish.
+	require.NoError(t, mgr.Drain(context.Background()))
+}
+
+func TestDestroy_HookFailureStillDestroys(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+	mgr.cfg.DestroyHooks.Commands = []string{"collect-artifacts"}
+	notifier := &fakeNotifier{events: make(chan hooks.DestroyEvent, 1), err: errors.New("destroy webhook: status 503")}
+	mgr.SetDestroyNotifier(notifier)
+	sess := &store.Session{ID: "s1", Status: "running"}
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionStatus", "s1", "destroying").Return(nil)
+	rt.On("Exec", mock.Anything, "s1", isSetupHook("collect-artifacts")).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 2}, nil)
+	rt.On("Destroy", mock.Anything, "s1").Return(nil)
+	st.On("UpdateSessionStatus", "s1", "destroyed").Return(nil)
+	audit.On("AppendAuditEvent", mock.AnythingOfType("*store.AuditEvent")).Return(nil)
+
+	require.NoError(t, mgr.Destroy(context.Background(), "s1"))
+	<-notifier.events
+	require.NoError(t, mgr.Drain(context.Background()))
+
+	rt.AssertCalled(t, "Destroy", mock.Anything, "s1")
+	audit.AssertNumberOfCalls(t, "AppendAuditEvent", 2)
+	ev := audit.Calls[0].Arguments.Get(0).(*store.AuditEvent)
+	assert.Equal(t, AuditActionDestroyHookFailed, ev.Action)
+	assert.Contains(t, ev.Detail, "exit code 2")
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// resolveDeterminism fills in the defaults of a requested determinism profile
+// and checks that the runtime can provide it. It returns nil for nil.
+func (m *Manager) resolveDeterminism(det *runtime.Determinism) (*runtime.Determinism, error) {
+	if det == nil {
+		return nil, nil
+	}
+	d, ok := m.runtime.(runtime.DeterministicDriver)
+	if !ok {
+		return nil, fmt.Errorf("%w by runtime", ErrNoDeterminism)
+	}
+	resolved := *det
+	if resolved.TZ == "" {
+		resolved.TZ = "UTC"
+	}
+	if resolved.Locale == "" {
+		resolved.Locale = "C.UTF-8"
+	}
+	if !resolved.Clock.IsZero() {
+		resolved.Clock = resolved.Clock.UTC()
+	}
+	if err := d.CheckDeterminism(&resolved); errors.Is(err, errors.ErrUnsupported) {
+		return nil, fmt.Errorf("%w by runtime", ErrNoDeterminism)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoDeterminism, err)
+	}
+	return &resolved, nil
+}
+
+// encodeDeterminism stores a determinism profile as JSON, or an empty
+// string for none.
+func encodeDeterminism(det *runtime.Determinism) string {
+	if det == nil {
+		return ""
+	}
+	data, err := json.Marshal(det)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeDeterminism reverses encodeDeterminism. A profile that does not
+// decode is reported as none.
+func decodeDeterminism(s string) *runtime.Determinism {
+	if s == "" {
+		return nil
+	}
+	var det runtime.Determinism
+	if err := json.Unmarshal([]byte(s), &det); err != nil {
+		return nil
+	}
+	return &det
+}
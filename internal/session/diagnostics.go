@@ -0,0 +1,58 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+// Create failure sources.
+const (
+	CreateFailureSourceAPI  = "create"
+	CreateFailureSourcePool = "pool"
+)
+
+var createFailures = metrics.Default.NewCounterVec("sandkasten_session_create_failures_total",
+	"Failed sandbox creates by class (see runtime.CreateFailureClass) and source.", "class", "source")
+
+// RecordCreateFailure counts a failed runtime Create by class and stores it
+// in d (nil = disabled) with the stage, launch config, init log tail and
+// errno the driver attached. Recording is best effort.
+func RecordCreateFailure(d DiagnosticsStore, source, sessionID, image string, err error) {
+	if err == nil {
+		return
+	}
+	class := runtime.CreateFailureClass(err)
+	createFailures.Inc(class, source)
+	if d == nil {
+		return
+	}
+	f := &store.CreateFailure{SessionID: sessionID, Image: image, Source: source, Class: class, Error: err.Error()}
+	var ce *runtime.CreateError
+	if errors.As(err, &ce) {
+		f.Stage, f.Errno, f.Config, f.LogTail = ce.Stage, ce.Errno, ce.Config, ce.LogTail
+	}
+	_ = d.AppendCreateFailure(f)
+}
+
+// poolError counts a pooled session that could not be handed out, so the
+// create fell back to a cold start, and returns detail as the acquire detail.
+func poolError(detail string) string {
+	createFailures.Inc(runtime.CreateFailurePool, CreateFailureSourcePool)
+	return detail
+}
+
+// ListCreateFailures returns the most recent failed creates, newest first.
+// Only the default tenant may read them.
+func (m *Manager) ListCreateFailures(ctx context.Context, limit int) ([]*store.CreateFailure, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.diag == nil {
+		return []*store.CreateFailure{}, nil
+	}
+	return m.diag.ListCreateFailures(limit)
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateFailureIsRecorded(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+	diag := &MockDiagnosticsStore{}
+	mgr.SetDiagnosticsStore(diag)
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, &runtime.CreateError{
+		Stage:   "runner_socket",
+		Class:   runtime.CreateFailureRunnerTimeout,
+		Config:  `{"session_id":"x"}`,
+		LogTail: "nsinit error: pivot_root: operation not permitted [errno EPERM]\n",
+		Errno:   "EPERM",
+		Err:     fmt.Errorf("wait for runner socket: timeout"),
+	})
+	var rec *store.CreateFailure
+	diag.On("AppendCreateFailure", mock.AnythingOfType("*store.CreateFailure")).Run(func(args mock.Arguments) {
+		rec = args.Get(0).(*store.CreateFailure)
+	}).Return(nil)
+
+	before := createFailures.Value(runtime.CreateFailureRunnerTimeout, CreateFailureSourceAPI)
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	require.Error(t, err)
+
+	assert.Equal(t, before+1, createFailures.Value(runtime.CreateFailureRunnerTimeout, CreateFailureSourceAPI))
+	require.NotNil(t, rec)
+	assert.Equal(t, "base", rec.Image)
+	assert.Equal(t, CreateFailureSourceAPI, rec.Source)
+	assert.Equal(t, "runner_socket", rec.Stage)
+	assert.Equal(t, runtime.CreateFailureRunnerTimeout, rec.Class)
+	assert.Equal(t, "EPERM", rec.Errno)
+	assert.Contains(t, rec.LogTail, "pivot_root")
+	assert.Equal(t, "wait for runner socket: timeout", rec.Error)
+}
+
+func TestListCreateFailuresDisabled(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	failures, err := mgr.ListCreateFailures(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+}
+
+func TestCreateFailureUnclassified(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, fmt.Errorf("runtime error"))
+
+	before := createFailures.Value(runtime.CreateFailureOther, CreateFailureSourceAPI)
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	require.Error(t, err)
+	assert.Equal(t, before+1, createFailures.Value(runtime.CreateFailureOther, CreateFailureSourceAPI))
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"golang.org/x/sys/unix"
+)
+
+// ErrDownloadUnsupported is returned by OpenFile for runtimes whose session
+// workspaces are not on the daemon's host.
+var ErrDownloadUnsupported = errors.New("file download not supported by runtime")
+
+// OpenFile opens a file under /workspace of a running session for download.
+// It reads the session's workspace from the host side (see
+// runtime.WorkspaceLocator) instead of going through the runner, so size is
+// not bounded by the runner protocol. The caller closes the file.
+func (m *Manager) OpenFile(ctx context.Context, sessionID, filePath string) (*os.File, error) {
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	locator, ok := m.runtime.(runtime.WorkspaceLocator)
+	if !ok {
+		return nil, ErrDownloadUnsupported
+	}
+
+	rel := runtime.WorkspaceRel(filePath)
+	if rel == "" {
+		return nil, fmt.Errorf("invalid file path")
+	}
+
+	workspaceID := ""
+	if sess.WorkspaceID != "" {
+		workspaceID = m.normalizeWorkspaceID(sess.WorkspaceID)
+	}
+	root := locator.HostWorkspace(sess.ID, workspaceID)
+
+	f, err := openFileNoSymlinkTraversal(root, rel)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+		return nil, err
+	}
+
+	m.extendSessionLease(sessionID, sess.Cwd)
+	return f, nil
+}
+
+// openFileNoSymlinkTraversal opens rootPath/relPath for reading without
+// following any symlink on the way, so a link planted inside the sandbox
+// cannot make the daemon read host files.
+func openFileNoSymlinkTraversal(rootPath, relPath string) (*os.File, error) {
+	parts := strings.Split(relPath, "/")
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return nil, fmt.Errorf("invalid file path")
+		}
+	}
+
+	dirFD, err := unix.Open(rootPath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open workspace: %w", err)
+	}
+	for _, part := range parts[:len(parts)-1] {
+		nextFD, err := unix.Openat(dirFD, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
+		unix.Close(dirFD)
+		if err != nil {
+			if errors.Is(err, unix.ELOOP) || errors.Is(err, unix.ENOTDIR) {
+				return nil, fmt.Errorf("path escapes workspace")
+			}
+			return nil, fmt.Errorf("open directory %q: %w", part, err)
+		}
+		dirFD = nextFD
+	}
+	defer unix.Close(dirFD)
+
+	// O_NONBLOCK keeps a FIFO from blocking the open; it is rejected below.
+	fd, err := unix.Openat(dirFD, parts[len(parts)-1], unix.O_RDONLY|unix.O_CLOEXEC|unix.O_NOFOLLOW|unix.O_NONBLOCK, 0)
+	if err != nil {
+		if errors.Is(err, unix.ELOOP) {
+			return nil, fmt.Errorf("path escapes workspace")
+		}
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFREG {
+		unix.Close(fd)
+		return nil, fmt.Errorf("not a regular file")
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(rootPath, relPath)), nil
+}
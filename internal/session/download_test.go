@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// hostWorkspaceRuntime adds runtime.WorkspaceLocator to the mock driver,
+// with the linux runtime's layout under dataDir.
+type hostWorkspaceRuntime struct {
+	*MockRuntimeDriver
+	dataDir string
+}
+
+func (r hostWorkspaceRuntime) HostWorkspace(sessionID, workspaceID string) string {
+	if workspaceID != "" {
+		return filepath.Join(r.dataDir, "workspaces", workspaceID)
+	}
+	return filepath.Join(r.dataDir, "sessions", sessionID, "mnt", "workspace")
+}
+
+func newDownloadManager(t *testing.T) (*Manager, *MockSessionStore, string) {
+	t.Helper()
+	mgr, rt, st := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.runtime = hostWorkspaceRuntime{rt, mgr.cfg.DataDir}
+	ws := filepath.Join(mgr.cfg.DataDir, "sessions", "s1", "mnt", "workspace")
+	require.NoError(t, os.MkdirAll(filepath.Join(ws, "out"), 0755))
+
+	st.On("GetSession", "s1").Return(&store.Session{
+		ID:        "s1",
+		Status:    "running",
+		Cwd:       "/workspace",
+		ExpiresAt: time.Now().UTC().Add(5 * time.Minute),
+	}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	return mgr, st, ws
+}
+
+func TestOpenFile(t *testing.T) {
+	mgr, _, ws := newDownloadManager(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws, "out", "model.bin"), []byte("weights"), 0644))
+
+	for _, p := range []string{"/workspace/out/model.bin", "out/model.bin"} {
+		f, err := mgr.OpenFile(context.Background(), "s1", p)
+		require.NoError(t, err, p)
+		data, err := io.ReadAll(f)
+		f.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "weights", string(data))
+	}
+}
+
+func TestOpenFileNotFound(t *testing.T) {
+	mgr, _, _ := newDownloadManager(t)
+
+	_, err := mgr.OpenFile(context.Background(), "s1", "/workspace/missing.txt")
+	assert.ErrorIs(t, err, ErrFileNotFound)
+}
+
+func TestOpenFileRejectsSymlinkEscape(t *testing.T) {
+	mgr, _, ws := newDownloadManager(t)
+	secret := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secret, []byte("host"), 0600))
+	require.NoError(t, os.Symlink(secret, filepath.Join(ws, "link")))
+	require.NoError(t, os.Symlink(filepath.Dir(secret), filepath.Join(ws, "dirlink")))
+
+	_, err := mgr.OpenFile(context.Background(), "s1", "/workspace/link")
+	assert.ErrorContains(t, err, "escapes workspace")
+
+	_, err = mgr.OpenFile(context.Background(), "s1", "/workspace/dirlink/secret")
+	assert.ErrorContains(t, err, "escapes workspace")
+
+	_, err = mgr.OpenFile(context.Background(), "s1", "/etc/passwd")
+	assert.ErrorContains(t, err, "invalid file path")
+}
+
+func TestOpenFileRejectsDirectory(t *testing.T) {
+	mgr, _, _ := newDownloadManager(t)
+
+	_, err := mgr.OpenFile(context.Background(), "s1", "/workspace/out")
+	assert.ErrorContains(t, err, "not a regular file")
+}
+
+func TestOpenFileUnsupportedRuntime(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.OpenFile(context.Background(), "s1", "/workspace/out/model.bin")
+	assert.ErrorIs(t, err, ErrDownloadUnsupported)
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// drainState tracks in-flight execs (and destroy hooks) so shutdown can wait
+// for them. The zero
+// value is ready to use.
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	inflight int
+	idle     chan struct{} // closed once draining and no exec is running
+}
+
+// Drain stops accepting new sessions and waits until in-flight execs have
+// returned and the pool has finished refills it already started. It returns
+// an error if ctx is done first. Execs on existing sessions are still served
+// while draining; callers stop the HTTP listener alongside.
+func (m *Manager) Drain(ctx context.Context) error {
+	d := &m.drain
+	d.mu.Lock()
+	d.draining = true
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+		if d.inflight == 0 {
+			close(d.idle)
+		}
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		d.mu.Lock()
+		n := d.inflight
+		d.mu.Unlock()
+		return fmt.Errorf("%d exec(s) still running: %w", n, ctx.Err())
+	}
+
+	if m.pool != nil {
+		if err := m.pool.Drain(ctx); err != nil {
+			return fmt.Errorf("drain pool: %w", err)
+		}
+	}
+	return nil
+}
+
+// Draining reports whether Drain has been called.
+func (m *Manager) Draining() bool {
+	m.drain.mu.Lock()
+	defer m.drain.mu.Unlock()
+	return m.drain.draining
+}
+
+// trackExec registers an in-flight exec or destroy hook; call the returned
+// func when it ends.
+func (m *Manager) trackExec() func() {
+	d := &m.drain
+	d.mu.Lock()
+	d.inflight++
+	d.mu.Unlock()
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.inflight--
+		if d.inflight == 0 && d.idle != nil {
+			select {
+			case <-d.idle:
+			default:
+				close(d.idle)
+			}
+		}
+	}
+}
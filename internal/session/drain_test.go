@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainRejectsCreate(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	require.NoError(t, mgr.Drain(context.Background()))
+	assert.True(t, mgr.Draining())
+
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	assert.ErrorIs(t, err, ErrDraining)
+}
+
+func TestDrainWaitsForInflightExec(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	release := make(chan struct{})
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).
+		Run(func(mock.Arguments) { <-release }).
+		Return(&protocol.Response{Type: protocol.ResponseExec, Cwd: "/workspace"}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	execDone := make(chan error, 1)
+	go func() {
+		_, err := mgr.Exec(context.Background(), "s1", "sleep 1", ExecOpts{TimeoutMs: 5000})
+		execDone <- err
+	}()
+	require.Eventually(t, func() bool {
+		mgr.drain.mu.Lock()
+		defer mgr.drain.mu.Unlock()
+		return mgr.drain.inflight == 1
+	}, time.Second, time.Millisecond)
+
+	shortCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := mgr.Drain(shortCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "1 exec(s) still running")
+
+	drainDone := make(chan error, 1)
+	go func() { drainDone <- mgr.Drain(context.Background()) }()
+	close(release)
+
+	require.NoError(t, <-execDone)
+	require.NoError(t, <-drainDone)
+}
+
+func TestDrainDrainsPool(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	pl := &MockContainerPool{}
+	mgr := NewManager(testConfig(), st, rt, nil, pl)
+
+	pl.On("Drain", mock.Anything).Return(nil)
+
+	require.NoError(t, mgr.Drain(context.Background()))
+	pl.AssertExpectations(t)
+}
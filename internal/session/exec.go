@@ -12,57 +12,121 @@ import (
 	"github.com/p-arndt/sandkasten/protocol"
 )
 
-func (m *Manager) Exec(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool) (*ExecResult, error) {
-	sess, err := m.validateSession(sessionID)
+// ExecOpts are the options of a single exec.
+type ExecOpts struct {
+	TimeoutMs    int
+	RawOutput    bool
+	OutputBase64 bool
+	Shell        string
+	// LineTimestamps sends every line as a chunk of its own, stamped with
+	// the time the runner received it (ExecStream only).
+	LineTimestamps bool
+	// Trace reports the programs, files and network addresses the command
+	// touched in the result.
+	Trace bool
+	// Artifacts selects what the exec collects besides its output.
+	Artifacts ArtifactOpts
+}
+
+func (m *Manager) Exec(ctx context.Context, sessionID, cmd string, opts ExecOpts) (result *ExecResult, err error) {
+	defer m.trackExec()()
+
+	sess, err := m.validateSession(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
+	if err := m.checkCommandPolicy(sess.ID, cmd); err != nil {
+		return nil, err
+	}
+	if err := m.requireExecApproval(ctx, sess.ID, cmd, opts); err != nil {
+		return nil, err
+	}
 
-	timeoutMs = m.enforceMaxTimeout(timeoutMs)
+	opts.TimeoutMs = m.enforceMaxTimeout(opts.TimeoutMs)
 
 	// Serialize exec per session
 	mu := m.sessionLock(sessionID)
 	mu.Lock()
 	defer mu.Unlock()
 
+	started := time.Now()
+	usage := m.startExecUsage(ctx, sess, cmd)
+	defer func() {
+		m.recordExec(sess.ID, cmd, started, result, err)
+		usage.finish(ctx, result)
+	}()
+
 	execID := uuid.New().String()[:8]
 
-	execReq, err := m.prepareExecRequest(ctx, sess.ID, execID, cmd, timeoutMs, rawOutput)
+	runCmd, err := wrapArtifacts(cmd, opts.Shell, opts.Artifacts)
+	if err != nil {
+		return nil, err
+	}
+	execReq, err := m.prepareExecRequest(ctx, sess.ID, execID, runCmd, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	stopTrace, err := m.startTrace(ctx, sess.ID, opts.Trace)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := m.runtime.Exec(ctx, sess.ID, execReq)
+	trace := stopTrace()
 	if err != nil {
 		return nil, fmt.Errorf("exec: %w", err)
 	}
 
 	if resp.Type == protocol.ResponseError {
-		return nil, fmt.Errorf("runner error: %s", resp.Error)
+		return nil, runnerError(resp)
 	}
-	if resp.ExitCode == -1 && strings.HasPrefix(resp.Output, "timeout:") {
-		return nil, fmt.Errorf("%w: %s", ErrTimeout, resp.Output)
+	m.recordShellRestart(sess.ID, resp)
+	if err := m.timeoutError(sess.ID, resp); err != nil {
+		return nil, err
+	}
+
+	overflow, err := m.keepOverflow(sess.ID, execID, resp)
+	if err != nil {
+		return nil, err
 	}
 
 	cwd := m.resolveCwd(resp.Cwd, sess.Cwd)
 	m.extendSessionLease(sessionID, cwd)
+	artifacts := m.collectArtifacts(ctx, sess.ID, opts.Artifacts)
 
-	return &ExecResult{
-		ExitCode:   resp.ExitCode,
-		Cwd:        cwd,
-		Output:     resp.Output,
-		Truncated:  resp.Truncated,
-		DurationMs: resp.DurationMs,
-	}, nil
+	result = &ExecResult{
+		ExecID:         execID,
+		ExitCode:       resp.ExitCode,
+		Cwd:            cwd,
+		Output:         resp.Output,
+		Truncated:      resp.Truncated,
+		OutputOverflow: overflow,
+		DurationMs:     resp.DurationMs,
+		ShellRestarted: resp.ShellRestarted,
+		OutputBase64:   resp.OutputBase64,
+		Trace:          trace,
+		Artifacts:      artifacts,
+	}
+	return result, nil
 }
 
-func (m *Manager) ExecStream(ctx context.Context, sessionID, cmd string, timeoutMs int, rawOutput bool, chunkChan chan<- ExecChunk) error {
-	sess, err := m.validateSession(sessionID)
+// ExecStream runs cmd like Exec and sends its output to chunkChan, ending
+// with a Done chunk.
+func (m *Manager) ExecStream(ctx context.Context, sessionID, cmd string, opts ExecOpts, chunkChan chan<- ExecChunk) (err error) {
+	defer m.trackExec()()
+
+	sess, err := m.validateSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
+	if err := m.checkCommandPolicy(sess.ID, cmd); err != nil {
+		return err
+	}
+	if err := m.requireExecApproval(ctx, sess.ID, cmd, opts); err != nil {
+		return err
+	}
 
-	timeoutMs = m.enforceMaxTimeout(timeoutMs)
+	opts.TimeoutMs = m.enforceMaxTimeout(opts.TimeoutMs)
 
 	// Serialize exec per session
 	mu := m.sessionLock(sessionID)
@@ -71,48 +135,123 @@ func (m *Manager) ExecStream(ctx context.Context, sessionID, cmd string, timeout
 
 	execID := uuid.New().String()[:8]
 	startTime := time.Now()
+	var result *ExecResult
+	usage := m.startExecUsage(ctx, sess, cmd)
+	defer func() {
+		m.recordExec(sess.ID, cmd, startTime, result, err)
+		usage.finish(ctx, result)
+	}()
 
-	execReq, err := m.prepareExecRequest(ctx, sess.ID, execID, cmd, timeoutMs, rawOutput)
+	runCmd, err := wrapArtifacts(cmd, opts.Shell, opts.Artifacts)
 	if err != nil {
 		return err
 	}
+	execReq, err := m.prepareExecRequest(ctx, sess.ID, execID, runCmd, opts)
+	if err != nil {
+		return err
+	}
+	execReq.LineTimestamps = opts.LineTimestamps
+	if opts.LineTimestamps {
+		// Timestamped lines are not kept as overflow, so the runner cuts
+		// them at the response limit.
+		execReq.MaxOutputBytes = m.cfg.Defaults.MaxOutputBytes
+	}
 
+	stopTrace, err := m.startTrace(ctx, sess.ID, opts.Trace)
+	if err != nil {
+		return err
+	}
 	resp, err := m.runtime.Exec(ctx, sess.ID, execReq)
+	trace := stopTrace()
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
 
 	if resp.Type == protocol.ResponseError {
-		return fmt.Errorf("runner error: %s", resp.Error)
+		return runnerError(resp)
+	}
+	m.recordShellRestart(sess.ID, resp)
+	if err := m.timeoutError(sess.ID, resp); err != nil {
+		return err
 	}
-	if resp.ExitCode == -1 && strings.HasPrefix(resp.Output, "timeout:") {
-		return fmt.Errorf("%w: %s", ErrTimeout, resp.Output)
+
+	overflow, err := m.keepOverflow(sess.ID, execID, resp)
+	if err != nil {
+		return err
 	}
 
 	cwd := m.resolveCwd(resp.Cwd, sess.Cwd)
 	m.extendSessionLease(sessionID, cwd)
+	artifacts := m.collectArtifacts(ctx, sess.ID, opts.Artifacts)
+
+	output := resp.Output
+	if resp.Lines != nil {
+		var b strings.Builder
+		for _, line := range resp.Lines {
+			text := line.Text + "\n"
+			b.WriteString(text)
+			select {
+			case chunkChan <- ExecChunk{Output: text, Timestamp: line.Timestamp}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		output = b.String()
+		resp.Output = "" // sent line by line already
+	}
+
+	result = &ExecResult{
+		ExecID:         execID,
+		ExitCode:       resp.ExitCode,
+		Cwd:            cwd,
+		Output:         output,
+		Truncated:      resp.Truncated,
+		OutputOverflow: overflow,
+		DurationMs:     resp.DurationMs,
+		ShellRestarted: resp.ShellRestarted,
+		OutputBase64:   resp.OutputBase64,
+		Trace:          trace,
+		Artifacts:      artifacts,
+	}
 
 	// Send final chunk with complete output
-	chunkChan <- ExecChunk{
-		Output:     resp.Output,
-		Timestamp:  startTime.UnixMilli(),
-		ExitCode:   resp.ExitCode,
-		Cwd:        cwd,
-		DurationMs: resp.DurationMs,
-		Done:       true,
+	select {
+	case chunkChan <- ExecChunk{
+		ExecID:         execID,
+		Output:         resp.Output,
+		Timestamp:      startTime.UnixMilli(),
+		ExitCode:       resp.ExitCode,
+		OutputOverflow: overflow,
+		Cwd:            cwd,
+		DurationMs:     resp.DurationMs,
+		ShellRestarted: resp.ShellRestarted,
+		OutputBase64:   resp.OutputBase64,
+		Trace:          trace,
+		Artifacts:      artifacts,
+		Done:           true,
+	}:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
 	return nil
 }
 
-func (m *Manager) prepareExecRequest(ctx context.Context, sessionID, execID, cmd string, timeoutMs int, rawOutput bool) (protocol.Request, error) {
+func (m *Manager) prepareExecRequest(ctx context.Context, sessionID, execID, cmd string, opts ExecOpts) (protocol.Request, error) {
 	if len(cmd) <= protocol.MaxExecInlineCmdBytes {
 		return protocol.Request{
-			ID:        execID,
-			Type:      protocol.RequestExec,
-			Cmd:       cmd,
-			TimeoutMs: timeoutMs,
-			RawOutput: rawOutput,
+			ID:             execID,
+			Type:           protocol.RequestExec,
+			Cmd:            cmd,
+			TimeoutMs:      opts.TimeoutMs,
+			RawOutput:      opts.RawOutput,
+			OutputBase64:   opts.OutputBase64,
+			Shell:          opts.Shell,
+			KillGraceMs:    m.cfg.Defaults.ExecKillGraceMs,
+			ResetShell:     m.cfg.Defaults.ResetShellOnTimeout,
+			KeepCwd:        m.cfg.Defaults.ShellRestartKeepCwd,
+			Truncate:       m.cfg.Defaults.OutputTruncation,
+			MaxOutputBytes: m.requestOutputLimit(),
 		}, nil
 	}
 
@@ -129,15 +268,20 @@ func (m *Manager) prepareExecRequest(ctx context.Context, sessionID, execID, cmd
 
 	absScriptPath := "/workspace/" + scriptPath
 	quotedPath := shellSingleQuote(absScriptPath)
-	shell := m.stagedExecShell()
-	stagedCmd := fmt.Sprintf("%s %s; __sandkasten_rc=$?; rm -f %s; exit $__sandkasten_rc", shell, quotedPath, quotedPath)
+	stagedCmd := fmt.Sprintf("%s %s; __sandkasten_rc=$?; rm -f %s; exit $__sandkasten_rc", m.stagedInterpreter(opts.Shell), quotedPath, quotedPath)
 
 	return protocol.Request{
-		ID:        execID,
-		Type:      protocol.RequestExec,
-		Cmd:       stagedCmd,
-		TimeoutMs: timeoutMs,
-		RawOutput: rawOutput,
+		ID:             execID,
+		Type:           protocol.RequestExec,
+		Cmd:            stagedCmd,
+		TimeoutMs:      opts.TimeoutMs,
+		RawOutput:      opts.RawOutput,
+		OutputBase64:   opts.OutputBase64,
+		KillGraceMs:    m.cfg.Defaults.ExecKillGraceMs,
+		ResetShell:     m.cfg.Defaults.ResetShellOnTimeout,
+		KeepCwd:        m.cfg.Defaults.ShellRestartKeepCwd,
+		Truncate:       m.cfg.Defaults.OutputTruncation,
+		MaxOutputBytes: m.requestOutputLimit(),
 	}, nil
 }
 
@@ -154,9 +298,70 @@ func (m *Manager) stagedExecShell() string {
 	return "bash"
 }
 
+// stagedInterpreter returns the command line prefix that runs a staged script
+// in shell. Interpreters with several candidate binaries are looked up with
+// command -v, so a missing one fails with exit code 127.
+func (m *Manager) stagedInterpreter(shell string) string {
+	candidates := protocol.Shells[shell]
+	switch len(candidates) {
+	case 0:
+		return m.stagedExecShell()
+	case 1:
+		return candidates[0]
+	}
+	lookups := make([]string, len(candidates))
+	for i, bin := range candidates {
+		lookups[i] = "command -v " + bin
+	}
+	return `"$(` + strings.Join(lookups, " || ") + `)"`
+}
+
+// TimeoutError is returned for an exec that ran out of time. Killed lists the
+// processes of the command the runner terminated.
+type TimeoutError struct {
+	Output     string
+	Killed     []protocol.KilledProcess
+	ShellReset bool // the shell was returned to /workspace
+}
+
+func (e *TimeoutError) Error() string { return ErrTimeout.Error() + ": " + e.Output }
+
+func (e *TimeoutError) Is(target error) bool { return target == ErrTimeout }
+
+// timeoutError returns a *TimeoutError if resp reports a timed-out command.
+// A shell reset moves the session back to /workspace.
+func (m *Manager) timeoutError(sessionID string, resp *protocol.Response) error {
+	if resp.ExitCode != -1 || !strings.HasPrefix(resp.Output, "timeout:") {
+		return nil
+	}
+	if resp.ShellReset {
+		m.extendSessionLease(sessionID, resp.Cwd)
+	}
+	return &TimeoutError{Output: resp.Output, Killed: resp.Killed, ShellReset: resp.ShellReset}
+}
+
+// AuditActionShellRestarted is recorded when the runner replaced a session
+// shell that had exited.
+const AuditActionShellRestarted = "shell_restarted"
+
+func (m *Manager) recordShellRestart(sessionID string, resp *protocol.Response) {
+	if resp.ShellRestarted {
+		m.recordAudit(sessionID, AuditActionShellRestarted, "exec_id="+resp.ID)
+	}
+}
+
+// runnerError converts a runner error response into an error, recognizing a
+// shell the image does not have.
+func runnerError(resp *protocol.Response) error {
+	if strings.HasPrefix(resp.Error, protocol.ErrShellUnavailable) {
+		return fmt.Errorf("%w: %s", ErrShellUnavailable, strings.TrimPrefix(resp.Error, protocol.ErrShellUnavailable+": "))
+	}
+	return fmt.Errorf("runner error: %s", resp.Error)
+}
+
 // validateSession checks if a session exists and is valid for execution.
-func (m *Manager) validateSession(sessionID string) (*storemod.Session, error) {
-	sess, err := m.store.GetSession(sessionID)
+func (m *Manager) validateSession(ctx context.Context, sessionID string) (*storemod.Session, error) {
+	sess, err := m.getOwnSession(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
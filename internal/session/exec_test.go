@@ -43,7 +43,7 @@ func TestExecSuccess(t *testing.T) {
 	}, nil)
 	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 
-	result, err := mgr.Exec(context.Background(), "s1", "echo hello", 5000, false)
+	result, err := mgr.Exec(context.Background(), "s1", "echo hello", ExecOpts{TimeoutMs: 5000})
 	require.NoError(t, err)
 
 	assert.Equal(t, 0, result.ExitCode)
@@ -57,7 +57,7 @@ func TestExecNotFound(t *testing.T) {
 
 	st.On("GetSession", "nonexistent").Return(nil, nil)
 
-	_, err := mgr.Exec(context.Background(), "nonexistent", "ls", 0, false)
+	_, err := mgr.Exec(context.Background(), "nonexistent", "ls", ExecOpts{})
 	assert.ErrorIs(t, err, ErrNotFound)
 }
 
@@ -68,7 +68,7 @@ func TestExecExpired(t *testing.T) {
 
 	st.On("GetSession", "expired").Return(sess, nil)
 
-	_, err := mgr.Exec(context.Background(), "expired", "ls", 0, false)
+	_, err := mgr.Exec(context.Background(), "expired", "ls", ExecOpts{})
 	assert.ErrorIs(t, err, ErrExpired)
 }
 
@@ -79,7 +79,7 @@ func TestExecNotRunning(t *testing.T) {
 
 	st.On("GetSession", "stopped").Return(sess, nil)
 
-	_, err := mgr.Exec(context.Background(), "stopped", "ls", 0, false)
+	_, err := mgr.Exec(context.Background(), "stopped", "ls", ExecOpts{})
 	assert.ErrorIs(t, err, ErrNotRunning)
 }
 
@@ -93,7 +93,7 @@ func TestExecRunnerError(t *testing.T) {
 		Error: "command not found",
 	}, nil)
 
-	_, err := mgr.Exec(context.Background(), "s1", "badcmd", 0, false)
+	_, err := mgr.Exec(context.Background(), "s1", "badcmd", ExecOpts{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "runner error")
 }
@@ -105,7 +105,7 @@ func TestExecRuntimeFailure(t *testing.T) {
 	st.On("GetSession", "s1").Return(sess, nil)
 	rt.On("Exec", mock.Anything, "s1", mock.Anything).Return(nil, fmt.Errorf("runtime exec failed"))
 
-	_, err := mgr.Exec(context.Background(), "s1", "ls", 0, false)
+	_, err := mgr.Exec(context.Background(), "s1", "ls", ExecOpts{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "exec")
 }
@@ -125,7 +125,7 @@ func TestExecStreamSuccess(t *testing.T) {
 	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 
 	chunkChan := make(chan ExecChunk, 10)
-	err := mgr.ExecStream(context.Background(), "s1", "echo streaming output", 5000, false, chunkChan)
+	err := mgr.ExecStream(context.Background(), "s1", "echo streaming output", ExecOpts{TimeoutMs: 5000}, chunkChan)
 	require.NoError(t, err)
 
 	chunk := <-chunkChan
@@ -134,6 +134,34 @@ func TestExecStreamSuccess(t *testing.T) {
 	assert.Equal(t, 0, chunk.ExitCode)
 }
 
+func TestExecStreamLineTimestamps(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.LineTimestamps
+	})).Return(&protocol.Response{
+		Type: protocol.ResponseExec,
+		Cwd:  "/workspace",
+		Lines: []protocol.OutputLine{
+			{Timestamp: 1707390000000, Text: "compiling"},
+			{Timestamp: 1707390004500, Text: "done"},
+		},
+	}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	chunkChan := make(chan ExecChunk, 10)
+	err := mgr.ExecStream(context.Background(), "s1", "make", ExecOpts{TimeoutMs: 5000, LineTimestamps: true}, chunkChan)
+	require.NoError(t, err)
+
+	require.Len(t, chunkChan, 3)
+	assert.Equal(t, ExecChunk{Output: "compiling\n", Timestamp: 1707390000000}, <-chunkChan)
+	assert.Equal(t, ExecChunk{Output: "done\n", Timestamp: 1707390004500}, <-chunkChan)
+	done := <-chunkChan
+	assert.True(t, done.Done)
+	assert.Empty(t, done.Output)
+}
+
 func TestExecTimeoutEnforcement(t *testing.T) {
 	mgr, rt, st := newTestManager()
 	sess := runningSession("s1")
@@ -148,7 +176,7 @@ func TestExecTimeoutEnforcement(t *testing.T) {
 	}, nil)
 	st.On("UpdateSessionActivity", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-	_, err := mgr.Exec(context.Background(), "s1", "echo ok", 999999, false)
+	_, err := mgr.Exec(context.Background(), "s1", "echo ok", ExecOpts{TimeoutMs: 999999})
 	require.NoError(t, err)
 }
 
@@ -163,10 +191,67 @@ func TestExecTimeoutMappedToErrTimeout(t *testing.T) {
 		Output:   "timeout: command exceeded 30s",
 	}, nil)
 
-	_, err := mgr.Exec(context.Background(), "s1", "sleep 999", 1000, false)
+	_, err := mgr.Exec(context.Background(), "s1", "sleep 999", ExecOpts{TimeoutMs: 1000})
 	assert.ErrorIs(t, err, ErrTimeout)
 }
 
+func TestExecTimeoutReportsKilledProcesses(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Defaults.ExecKillGraceMs = 1500
+	mgr.cfg.Defaults.ResetShellOnTimeout = true
+	sess := runningSession("s1")
+	sess.Cwd = "/workspace/src"
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.KillGraceMs == 1500 && req.ResetShell
+	})).Return(&protocol.Response{
+		Type:       protocol.ResponseExec,
+		ExitCode:   -1,
+		Output:     "timeout: command exceeded 1s",
+		Cwd:        "/workspace",
+		Killed:     []protocol.KilledProcess{{PID: 42, Command: "sleep 999", Signal: "SIGTERM"}},
+		ShellReset: true,
+	}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "sleep 999", ExecOpts{TimeoutMs: 1000})
+	assert.ErrorIs(t, err, ErrTimeout)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	assert.Equal(t, []protocol.KilledProcess{{PID: 42, Command: "sleep 999", Signal: "SIGTERM"}}, timeoutErr.Killed)
+	assert.True(t, timeoutErr.ShellReset)
+	assert.Equal(t, "command timeout: timeout: command exceeded 1s", err.Error())
+	st.AssertCalled(t, "UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time"))
+}
+
+func TestExecShellRestarted(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Defaults.ShellRestartKeepCwd = true
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.KeepCwd
+	})).Return(&protocol.Response{
+		ID:             "e1",
+		Type:           protocol.ResponseExec,
+		Cwd:            "/workspace",
+		Output:         "ok",
+		ShellRestarted: true,
+	}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.SessionID == "s1" && ev.Action == AuditActionShellRestarted
+	})).Return(nil)
+
+	result, err := mgr.Exec(context.Background(), "s1", "echo ok", ExecOpts{TimeoutMs: 1000})
+	require.NoError(t, err)
+	assert.True(t, result.ShellRestarted)
+	audit.AssertExpectations(t)
+}
+
 func TestExecStreamTimeoutMappedToErrTimeout(t *testing.T) {
 	mgr, rt, st := newTestManager()
 	sess := runningSession("s1")
@@ -179,7 +264,7 @@ func TestExecStreamTimeoutMappedToErrTimeout(t *testing.T) {
 	}, nil)
 
 	chunkChan := make(chan ExecChunk, 1)
-	err := mgr.ExecStream(context.Background(), "s1", "sleep 999", 1000, false, chunkChan)
+	err := mgr.ExecStream(context.Background(), "s1", "sleep 999", ExecOpts{TimeoutMs: 1000}, chunkChan)
 	assert.ErrorIs(t, err, ErrTimeout)
 }
 
@@ -197,7 +282,7 @@ func TestExecLargeCommandUsesStagedPath(t *testing.T) {
 	})).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 0, Cwd: "/workspace", Output: "ok", DurationMs: 10}, nil).Once()
 	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 
-	result, err := mgr.Exec(context.Background(), "s1", largeCmd, 5000, false)
+	result, err := mgr.Exec(context.Background(), "s1", largeCmd, ExecOpts{TimeoutMs: 5000})
 	require.NoError(t, err)
 	assert.Equal(t, "ok", result.Output)
 }
@@ -217,7 +302,7 @@ func TestExecStreamLargeCommandUsesStagedPath(t *testing.T) {
 	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 
 	chunkChan := make(chan ExecChunk, 1)
-	err := mgr.ExecStream(context.Background(), "s1", largeCmd, 5000, false, chunkChan)
+	err := mgr.ExecStream(context.Background(), "s1", largeCmd, ExecOpts{TimeoutMs: 5000}, chunkChan)
 	require.NoError(t, err)
 	chunk := <-chunkChan
 	assert.True(t, chunk.Done)
@@ -234,6 +319,84 @@ func TestExecRawOutputPropagatesToRuntime(t *testing.T) {
 	})).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 0, Cwd: "/workspace", Output: "ok", DurationMs: 10}, nil)
 	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
 
-	_, err := mgr.Exec(context.Background(), "s1", "echo ok", 5000, true)
+	_, err := mgr.Exec(context.Background(), "s1", "echo ok", ExecOpts{TimeoutMs: 5000, RawOutput: true})
+	require.NoError(t, err)
+}
+
+func TestExecOutputBase64(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && req.OutputBase64
+	})).Return(&protocol.Response{Type: protocol.ResponseExec, Cwd: "/workspace", Output: "AP8=", OutputBase64: true}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	result, err := mgr.Exec(context.Background(), "s1", "cat blob", ExecOpts{TimeoutMs: 5000, OutputBase64: true})
+	require.NoError(t, err)
+	assert.Equal(t, "AP8=", result.Output)
+	assert.True(t, result.OutputBase64)
+}
+
+func TestExecOutputTruncationPropagatesToRuntime(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Defaults.OutputTruncation = protocol.TruncateHeadTail
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Truncate == protocol.TruncateHeadTail
+	})).Return(&protocol.Response{Type: protocol.ResponseExec, Cwd: "/workspace", Output: "ok"}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "make", ExecOpts{TimeoutMs: 5000})
+	require.NoError(t, err)
+}
+
+func TestExecShellPropagatesToRuntime(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	sess := runningSession("s1")
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && req.Shell == "python" && req.Cmd == "print(1)"
+	})).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 0, Cwd: "/workspace", Output: "1", DurationMs: 10}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	result, err := mgr.Exec(context.Background(), "s1", "print(1)", ExecOpts{TimeoutMs: 5000, Shell: "python"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", result.Output)
+}
+
+func TestExecShellUnavailable(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	sess := runningSession("s1")
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type:  protocol.ResponseError,
+		Error: protocol.ErrShellUnavailable + ": node is not installed in this image",
+	}, nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "console.log(1)", ExecOpts{Shell: "node"})
+	assert.ErrorIs(t, err, ErrShellUnavailable)
+	assert.EqualError(t, err, "shell not available: node is not installed in this image")
+}
+
+func TestExecLargeCommandStagedWithShell(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	sess := runningSession("s1")
+	largeCmd := strings.Repeat("x", protocol.MaxExecInlineCmdBytes+1)
+
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestWrite
+	})).Return(&protocol.Response{Type: protocol.ResponseWrite, OK: true}, nil).Once()
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && req.Shell == "" &&
+			strings.HasPrefix(req.Cmd, `"$(command -v python3 || command -v python)" '/workspace/.sandkasten/exec-`)
+	})).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 0, Cwd: "/workspace", Output: "ok", DurationMs: 10}, nil).Once()
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", largeCmd, ExecOpts{TimeoutMs: 5000, Shell: "python"})
 	require.NoError(t, err)
 }
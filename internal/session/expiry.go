@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+// AuditActionExpiring is recorded when a session comes within
+// session_expiry_warning_seconds of its expiry, so agents can renew the
+// lease before the reaper destroys the session mid-task.
+const AuditActionExpiring = "session_expiring"
+
+// expiryWarnings remembers which sessions are inside the warning window, so
+// each approach to expiry is audited once. The zero value is ready to use.
+type expiryWarnings struct {
+	mu     sync.Mutex
+	inside map[string]bool
+}
+
+// set records whether id is inside the window and returns the previous state.
+func (e *expiryWarnings) set(id string, inside bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.inside == nil {
+		e.inside = make(map[string]bool)
+	}
+	was := e.inside[id]
+	if inside {
+		e.inside[id] = true
+	} else {
+		delete(e.inside, id)
+	}
+	return was
+}
+
+// prune forgets every session not in live.
+func (e *expiryWarnings) prune(live map[string]bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id := range e.inside {
+		if !live[id] {
+			delete(e.inside, id)
+		}
+	}
+}
+
+// expiryWindow is session_expiry_warning_seconds; 0 = warnings off.
+func (m *Manager) expiryWindow() time.Duration {
+	return time.Duration(max(m.cfg.SessionExpiryWarning, 0)) * time.Second
+}
+
+// checkExpiry returns the time sess has left and whether that is within the
+// warning window, and audits the session on entering the window.
+func (m *Manager) checkExpiry(sess *storemod.Session, now time.Time) (time.Duration, bool) {
+	window := m.expiryWindow()
+	left := max(sess.ExpiresAt.Sub(now), 0)
+	inside := window > 0 && left <= window
+	if !m.expiring.set(sess.ID, inside) && inside {
+		m.recordAudit(sess.ID, AuditActionExpiring, fmt.Sprintf("expires in %ds at %s", int(left.Seconds()), sess.ExpiresAt.UTC().Format(time.RFC3339)))
+	}
+	return left, inside
+}
+
+// ExpiresIn returns how long a session has left if that is within
+// session_expiry_warning_seconds; ok is false otherwise or with warnings off.
+func (m *Manager) ExpiresIn(ctx context.Context, id string) (left time.Duration, ok bool) {
+	if m.expiryWindow() <= 0 {
+		return 0, false
+	}
+	sess, err := m.getOwnSession(ctx, id)
+	if err != nil || sess == nil || sess.Status != "running" {
+		return 0, false
+	}
+	return m.checkExpiry(sess, time.Now())
+}
+
+// WarnExpiring audits running sessions that entered the warning window since
+// the last check and forgets sessions that are no longer running. The daemon
+// runs it every 10s.
+func (m *Manager) WarnExpiring() error {
+	if m.expiryWindow() <= 0 {
+		return nil
+	}
+	sessions, err := m.store.ListRunningSessions()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	live := make(map[string]bool, len(sessions))
+	for _, sess := range sessions {
+		live[sess.ID] = true
+		m.checkExpiry(sess, now)
+	}
+	m.expiring.prune(live)
+	return nil
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiresIn_Off(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	_, ok := mgr.ExpiresIn(context.Background(), "s1")
+	assert.False(t, ok)
+	mgr.WarnExpiring()
+}
+
+func TestExpiresIn_WithinWindow(t *testing.T) {
+	mgr, _, st := newTestManager()
+	mgr.cfg.SessionExpiryWarning = 60
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+
+	soon := &store.Session{ID: "s1", Status: "running", ExpiresAt: time.Now().Add(45 * time.Second)}
+	later := &store.Session{ID: "s2", Status: "running", ExpiresAt: time.Now().Add(time.Hour)}
+	st.On("GetSession", "s1").Return(soon, nil)
+	st.On("GetSession", "s2").Return(later, nil)
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.SessionID == "s1" && ev.Action == AuditActionExpiring
+	})).Return(nil).Once()
+
+	left, ok := mgr.ExpiresIn(context.Background(), "s1")
+	require.True(t, ok)
+	assert.InDelta(t, 45, left.Seconds(), 2)
+	_, ok = mgr.ExpiresIn(context.Background(), "s2")
+	assert.False(t, ok)
+
+	// Still inside the window: no second event.
+	_, ok = mgr.ExpiresIn(context.Background(), "s1")
+	assert.True(t, ok)
+	audit.AssertExpectations(t)
+}
+
+func TestWarnExpiring_AuditsEachApproachOnce(t *testing.T) {
+	mgr, _, st := newTestManager()
+	mgr.cfg.SessionExpiryWarning = 60
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+
+	sess := &store.Session{ID: "s1", Status: "running", ExpiresAt: time.Now().Add(30 * time.Second)}
+	renewed := &store.Session{ID: "s1", Status: "running", ExpiresAt: time.Now().Add(time.Hour)}
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil).Twice()
+	st.On("ListRunningSessions").Return([]*store.Session{renewed}, nil).Once()
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil).Once()
+	st.On("ListRunningSessions").Return([]*store.Session{}, nil).Once()
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.Action == AuditActionExpiring
+	})).Return(nil).Twice()
+
+	mgr.WarnExpiring()
+	mgr.WarnExpiring()
+	mgr.WarnExpiring() // lease renewed
+	mgr.WarnExpiring() // close to expiry again
+	audit.AssertExpectations(t)
+
+	mgr.WarnExpiring()
+	assert.False(t, mgr.expiring.set("s1", false), "stopped sessions are forgotten")
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -9,10 +10,13 @@ import (
 )
 
 func (m *Manager) Write(ctx context.Context, sessionID, path string, content []byte, isBase64 bool) error {
-	sess, err := m.validateSession(sessionID)
+	sess, err := m.validateSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
+	if err := m.scanContent(ctx, sess.ID, sess.WorkspaceID, path, content, isBase64); err != nil {
+		return err
+	}
 
 	req := buildWriteRequest(path, content, isBase64)
 
@@ -29,7 +33,7 @@ func (m *Manager) Write(ctx context.Context, sessionID, path string, content []b
 }
 
 func (m *Manager) Read(ctx context.Context, sessionID, path string, maxBytes int) (string, bool, error) {
-	sess, err := m.validateSession(sessionID)
+	sess, err := m.validateSession(ctx, sessionID)
 	if err != nil {
 		return "", false, err
 	}
@@ -74,3 +78,31 @@ func buildReadRequest(path string, maxBytes int) protocol.Request {
 		MaxBytes: maxBytes,
 	}
 }
+
+// readSessionFile reads a file the daemon had a command leave in the session,
+// such as a report, in full.
+func (m *Manager) readSessionFile(ctx context.Context, sessionID, path string) ([]byte, error) {
+	resp, err := m.runtime.Exec(ctx, sessionID, buildReadRequest(path, 0))
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	if resp.Type == protocol.ResponseError {
+		return nil, fmt.Errorf("runner error: %s", resp.Error)
+	}
+	if resp.Truncated {
+		return nil, fmt.Errorf("over %d bytes", protocol.DefaultMaxReadBytes)
+	}
+	return base64.StdEncoding.DecodeString(resp.ContentBase64)
+}
+
+// removeSessionFile deletes a file the daemon left in the session, such as a
+// report, so it does not linger in the session's workspace.
+func (m *Manager) removeSessionFile(ctx context.Context, sessionID, path string) {
+	_, _ = m.runtime.Exec(ctx, sessionID, protocol.Request{
+		ID:        uuid.New().String()[:8],
+		Type:      protocol.RequestExec,
+		Cmd:       "rm -f " + shellSingleQuote(path),
+		TimeoutMs: 5000,
+		Shell:     "sh",
+	})
+}
@@ -0,0 +1,188 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+// ErrGroupNotFound is returned for a group without members in the caller's tenant.
+var ErrGroupNotFound = errors.New("session group not found")
+
+// GroupCreateOpts creates Count sessions that share the same options.
+type GroupCreateOpts struct {
+	CreateOpts
+	Count int
+}
+
+// GroupInfo is a session group and its members, oldest first.
+type GroupInfo struct {
+	ID       string        `json:"id"`
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// GroupExecResult is the outcome of a group exec in one member. Error is set
+// instead of Result when the exec could not run (e.g. policy denied).
+type GroupExecResult struct {
+	SessionID string      `json:"session_id"`
+	Result    *ExecResult `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// CreateGroup creates opts.Count sessions as a unit: either all of them start
+// and join a new group, or none is left behind.
+func (m *Manager) CreateGroup(ctx context.Context, opts GroupCreateOpts) (*GroupInfo, error) {
+	if opts.Count <= 0 {
+		return nil, fmt.Errorf("group size must be positive, got %d", opts.Count)
+	}
+	if m.approvals != nil && !isApproved(ctx) && m.approvals.networkedSessions {
+		// One approval covers the whole group; the members then skip theirs.
+		scope := callerScope(ctx)
+		reason := fmt.Sprintf("network_mode=%s group_size=%d", m.cfg.Defaults.NetworkMode, opts.Count)
+		return nil, m.parkCreateApproval(ctx, m.resolveImage(opts.Image), reason,
+			func(ctx context.Context) (any, error) {
+				return m.CreateGroup(scope(ctx), opts)
+			})
+	}
+	groupID := uuid.New().String()[:12]
+	// Members start together or not at all, so none of them may queue.
+	ctx = withoutCreateQueue(ctx)
+
+	infos := make([]*SessionInfo, opts.Count)
+	errs := make([]error, opts.Count)
+	var wg sync.WaitGroup
+	for i := range infos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := m.Create(ctx, opts.CreateOpts)
+			if err == nil {
+				err = m.store.UpdateSessionGroup(info.ID, groupID)
+			}
+			infos[i], errs[i] = info, err
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		// Roll back on a fresh context: the request may have been cancelled.
+		for _, info := range infos {
+			if info != nil {
+				_ = m.Destroy(callerScope(ctx)(context.Background()), info.ID)
+			}
+		}
+		return nil, fmt.Errorf("create group: %w", err)
+	}
+
+	group := &GroupInfo{ID: groupID, Sessions: make([]SessionInfo, len(infos))}
+	for i, info := range infos {
+		info.GroupID = groupID
+		group.Sessions[i] = *info
+	}
+	return group, nil
+}
+
+// GetGroup returns a group with all its members, including finished ones.
+func (m *Manager) GetGroup(ctx context.Context, groupID string) (*GroupInfo, error) {
+	members, err := m.groupMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	group := &GroupInfo{ID: groupID, Sessions: make([]SessionInfo, len(members))}
+	for i, s := range members {
+		group.Sessions[i] = SessionInfo{
+			ID:            s.ID,
+			Image:         s.Image,
+			Status:        s.Status,
+			Cwd:           s.Cwd,
+			WorkspaceID:   publicWorkspaceID(s.Tenant, s.WorkspaceID),
+			ImageDigest:   s.ImageDigest,
+			Hostname:      runtime.Hostname(s.ID, s.Hostname),
+			SharedChannel: publicWorkspaceID(s.Tenant, s.SharedChannel),
+			GroupID:       s.GroupID,
+			MachineID:     runtime.MachineID(s.ID),
+			Thrashing:     m.stats.isThrashing(s.ID),
+			Labels:        s.Labels,
+			CreatedAt:     s.CreatedAt,
+			ExpiresAt:     s.ExpiresAt,
+			Determinism:   decodeDeterminism(s.Determinism),
+			CPU:           decodeCPU(s.CPU),
+		}
+	}
+	return group, nil
+}
+
+// ExecGroup runs cmd in every running member of the group concurrently. A
+// member that fails does not stop the others; its error is reported in its
+// result.
+func (m *Manager) ExecGroup(ctx context.Context, groupID, cmd string, opts ExecOpts) ([]GroupExecResult, error) {
+	members, err := m.groupMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]GroupExecResult, 0, len(members))
+	for _, s := range members {
+		if s.Status == "running" {
+			results = append(results, GroupExecResult{SessionID: s.ID})
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := m.Exec(ctx, results[i].SessionID, cmd, opts)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Result = res
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// DestroyGroup destroys every member of the group that is still alive.
+func (m *Manager) DestroyGroup(ctx context.Context, groupID string) error {
+	members, err := m.groupMembers(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range members {
+		switch s.Status {
+		case "destroyed", "expired", "crashed":
+			continue
+		}
+		if err := m.Destroy(ctx, s.ID); err != nil {
+			errs = append(errs, fmt.Errorf("destroy %s: %w", s.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// groupMembers returns the group's sessions if the group belongs to the
+// caller's tenant.
+func (m *Manager) groupMembers(ctx context.Context, groupID string) ([]*storemod.Session, error) {
+	members, err := m.store.ListGroupSessions(groupID)
+	if err != nil {
+		return nil, err
+	}
+	tenant := tenantFrom(ctx)
+	var own []*storemod.Session
+	for _, s := range members {
+		if s.Tenant == tenant {
+			own = append(own, s)
+		}
+	}
+	if len(own) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, groupID)
+	}
+	return own, nil
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateGroup(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	st.On("UpdateSessionGroup", mock.Anything, mock.Anything).Return(nil)
+
+	group, err := mgr.CreateGroup(context.Background(), GroupCreateOpts{CreateOpts: CreateOpts{Image: "python"}, Count: 3})
+	require.NoError(t, err)
+	require.Len(t, group.Sessions, 3)
+	ids := map[string]bool{}
+	for _, s := range group.Sessions {
+		assert.Equal(t, group.ID, s.GroupID)
+		assert.Equal(t, "python", s.Image)
+		ids[s.ID] = true
+	}
+	assert.Len(t, ids, 3)
+	st.AssertNumberOfCalls(t, "UpdateSessionGroup", 3)
+}
+
+func TestCreateGroup_RollsBackOnFailure(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(nil, errors.New("clone: no space left on device")).Once()
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	st.On("UpdateSessionGroup", mock.Anything, mock.Anything).Return(nil)
+	st.On("GetSession", mock.Anything).Return(&store.Session{Status: "running"}, nil)
+	st.On("UpdateSessionStatus", mock.Anything, mock.Anything).Return(nil)
+	rt.On("Destroy", mock.Anything, mock.Anything).Return(nil)
+
+	_, err := mgr.CreateGroup(context.Background(), GroupCreateOpts{CreateOpts: CreateOpts{Image: "python"}, Count: 3})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no space left on device")
+	rt.AssertNumberOfCalls(t, "Destroy", 2)
+}
+
+func TestExecGroup(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	a, b, done := runningSession("a"), runningSession("b"), runningSession("c")
+	done.Status = "destroyed"
+	for _, s := range []*store.Session{a, b, done} {
+		s.GroupID = "g1"
+	}
+
+	st.On("ListGroupSessions", "g1").Return([]*store.Session{a, b, done}, nil)
+	st.On("GetSession", "a").Return(a, nil)
+	st.On("GetSession", "b").Return(b, nil)
+	rt.On("Exec", mock.Anything, "a", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{Type: protocol.ResponseExec, Output: "a\n", Cwd: "/workspace"}, nil)
+	rt.On("Exec", mock.Anything, "b", mock.AnythingOfType("protocol.Request")).Return(nil, errors.New("runner gone"))
+	st.On("UpdateSessionActivity", "a", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	results, err := mgr.ExecGroup(context.Background(), "g1", "hostname", ExecOpts{TimeoutMs: 5000})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "a", results[0].SessionID)
+	require.NotNil(t, results[0].Result)
+	assert.Equal(t, "a\n", results[0].Result.Output)
+	assert.Equal(t, "b", results[1].SessionID)
+	assert.Nil(t, results[1].Result)
+	assert.Contains(t, results[1].Error, "runner gone")
+}
+
+func TestGroupOfOtherTenantNotFound(t *testing.T) {
+	mgr, _, st := newTestManager()
+	a := runningSession("a")
+	a.GroupID, a.Tenant = "g1", "acme"
+	st.On("ListGroupSessions", "g1").Return([]*store.Session{a}, nil)
+
+	_, err := mgr.GetGroup(context.Background(), "g1")
+	assert.ErrorIs(t, err, ErrGroupNotFound)
+	assert.ErrorIs(t, mgr.DestroyGroup(WithTenant(context.Background(), "other"), "g1"), ErrGroupNotFound)
+
+	group, err := mgr.GetGroup(WithTenant(context.Background(), "acme"), "g1")
+	require.NoError(t, err)
+	assert.Equal(t, "g1", group.Sessions[0].GroupID)
+}
+
+func TestDestroyGroup(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	a, gone := runningSession("a"), runningSession("b")
+	gone.Status = "expired"
+
+	st.On("ListGroupSessions", "g1").Return([]*store.Session{a, gone}, nil)
+	st.On("GetSession", "a").Return(a, nil)
+	st.On("UpdateSessionStatus", "a", mock.Anything).Return(nil)
+	rt.On("Destroy", mock.Anything, "a").Return(nil)
+
+	require.NoError(t, mgr.DestroyGroup(context.Background(), "g1"))
+	rt.AssertNumberOfCalls(t, "Destroy", 1)
+}
@@ -0,0 +1,138 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// ImageStatus is the result of validating an image at startup.
+type ImageStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ConfiguredImages returns the images the daemon is expected to serve: the
+// allowed images (or the default image when unrestricted), pooled images
+// and WSL targets.
+func ConfiguredImages(cfg *config.Config) []string {
+	seen := make(map[string]bool)
+	var images []string
+	add := func(image string) {
+		if image != "" && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	if len(cfg.AllowedImages) > 0 {
+		for _, image := range cfg.AllowedImages {
+			add(image)
+		}
+	} else {
+		add(cfg.DefaultImage)
+	}
+	for image := range cfg.Pool.Images {
+		add(image)
+	}
+	for image := range cfg.WSL.Targets {
+		add(image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// CheckImages validates each image with the runtime.
+func CheckImages(ctx context.Context, rt RuntimeDriver, images []string) []ImageStatus {
+	statuses := make([]ImageStatus, 0, len(images))
+	for _, image := range images {
+		st := ImageStatus{Name: image, Available: true}
+		if !isImageRefSafe(image) {
+			st.Available = false
+			st.Error = "invalid image name"
+		} else if err := rt.ValidateImage(ctx, image); err != nil {
+			st.Available = false
+			st.Error = err.Error()
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+// SetImageResolver installs the lookup for image tags (nil = references are
+// used as image names).
+func (m *Manager) SetImageResolver(r ImageResolver) {
+	m.resolver = r
+}
+
+// lookupImage maps an image reference to the image name to create from.
+func (m *Manager) lookupImage(ctx context.Context, ref string) (string, error) {
+	if m.resolver == nil {
+		return ref, nil
+	}
+	return m.resolver.ResolveImage(ctx, ref)
+}
+
+// SetImageStatus records startup validation results. Creates for images marked
+// unavailable fail with ErrImageUnavailable instead of a runtime error.
+func (m *Manager) SetImageStatus(statuses []ImageStatus) {
+	m.imagesMu.Lock()
+	defer m.imagesMu.Unlock()
+	m.images = make(map[string]ImageStatus, len(statuses))
+	for _, st := range statuses {
+		m.images[st.Name] = st
+	}
+}
+
+// ListImages returns the validation status of the configured images.
+func (m *Manager) ListImages(ctx context.Context) ([]ImageStatus, error) {
+	m.imagesMu.Lock()
+	defer m.imagesMu.Unlock()
+	out := make([]ImageStatus, 0, len(m.images))
+	for _, st := range m.images {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// checkImageAvailable fails for images that did not pass startup validation.
+// Images that were never validated are allowed through.
+func (m *Manager) checkImageAvailable(image string) error {
+	m.imagesMu.Lock()
+	st, ok := m.images[image]
+	m.imagesMu.Unlock()
+	if ok && !st.Available {
+		return fmt.Errorf("%w: %s: %s", ErrImageUnavailable, image, st.Error)
+	}
+	return nil
+}
+
+// checkImageScan refuses image (a name) if its vulnerability scan report has
+// findings of image_scan.block_severity or worse. Images that were not
+// scanned, or not since their last refresh, are allowed.
+func (m *Manager) checkImageScan(ctx context.Context, image string) error {
+	severity := m.cfg.ImageScan.BlockSeverity
+	if severity == "" {
+		return nil
+	}
+	r, ok := m.runtime.(runtime.ImageScanReader)
+	if !ok {
+		return nil
+	}
+	report, err := r.ImageScan(ctx, image)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrImageUnavailable, image, err)
+	}
+	if report == nil {
+		return nil
+	}
+	if n := report.AtLeast(severity); n > 0 {
+		return fmt.Errorf("%w: %s has %d %s or worse findings (%s, scanned %s)", ErrImageVulnerable, image, n, severity, report.Summary(), report.ScannedAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/imagescan"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguredImages(t *testing.T) {
+	cfg := testConfig()
+	cfg.Pool.Images = map[string]int{"python": 2, "node": 1}
+	assert.Equal(t, []string{"base", "node", "python"}, ConfiguredImages(cfg))
+
+	cfg.WSL.Targets = map[string]config.WSLTarget{"dotnet": {Distro: "Ubuntu", User: "sandbox"}}
+	assert.Equal(t, []string{"base", "dotnet", "node", "python"}, ConfiguredImages(cfg))
+
+	cfg.WSL.Targets = nil
+	cfg.AllowedImages = nil
+	cfg.Pool.Images = nil
+	assert.Equal(t, []string{"base"}, ConfiguredImages(cfg))
+}
+
+func TestCheckImagesMarksBrokenImageUnavailable(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+	rt.On("ValidateImage", mock.Anything, "base").Return(nil)
+	rt.On("ValidateImage", mock.Anything, "python").Return(errors.New("runner not found"))
+
+	statuses := CheckImages(context.Background(), rt, []string{"base", "python"})
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Available)
+	assert.False(t, statuses[1].Available)
+	assert.Equal(t, "runner not found", statuses[1].Error)
+
+	mgr.SetImageStatus(statuses)
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.ErrorIs(t, err, ErrImageUnavailable)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	listed, err := mgr.ListImages(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, statuses, listed)
+}
+
+func TestCreateResolvesImageTag(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	resolver := &MockImageResolver{}
+	mgr.SetImageResolver(resolver)
+
+	resolver.On("ResolveImage", mock.Anything, "python:latest").Return("python-312", nil)
+	rt.On("Create", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
+		return opts.Image == "python-312"
+	})).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Image: "python:latest"})
+	require.NoError(t, err)
+	assert.Equal(t, "python-312", info.Image)
+	rt.AssertExpectations(t)
+}
+
+func TestCreateUnknownImageTag(t *testing.T) {
+	mgr, rt, _ := newTestManager()
+	resolver := &MockImageResolver{}
+	mgr.SetImageResolver(resolver)
+
+	resolver.On("ResolveImage", mock.Anything, "python:9").Return("", errors.New("unknown image tag python:9"))
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python:9"})
+	assert.ErrorIs(t, err, ErrInvalidImage)
+	rt.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+type scanRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r scanRuntime) ImageScan(ctx context.Context, image string) (*imagescan.Report, error) {
+	args := r.Called(ctx, image)
+	report, _ := args.Get(0).(*imagescan.Report)
+	return report, args.Error(1)
+}
+
+func TestCreateBlocksVulnerableImage(t *testing.T) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.ImageScan.BlockSeverity = "critical"
+	mgr := NewManager(cfg, st, scanRuntime{rt}, nil, nil)
+
+	rt.On("ImageScan", mock.Anything, "python").Return(&imagescan.Report{Scanner: "trivy", Counts: map[string]int{"critical": 2, "high": 1}}, nil)
+	rt.On("ImageScan", mock.Anything, "base").Return(&imagescan.Report{Scanner: "trivy", Counts: map[string]int{"high": 4}}, nil)
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{InitPID: 1}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Image: "python"})
+	assert.ErrorIs(t, err, ErrImageVulnerable)
+	assert.ErrorContains(t, err, "2 critical or worse findings (2 critical, 1 high")
+
+	_, err = mgr.Create(context.Background(), CreateOpts{Image: "base"})
+	assert.NoError(t, err, "high findings are below block_severity")
+	rt.AssertNumberOfCalls(t, "Create", 1)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/p-arndt/sandkasten/internal/policy"
+	"github.com/p-arndt/sandkasten/internal/pool"
 	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/scan"
 	"github.com/p-arndt/sandkasten/internal/store"
 	"github.com/p-arndt/sandkasten/protocol"
 )
@@ -18,15 +21,34 @@ type RuntimeDriver interface {
 	Ping(ctx context.Context) error
 	Close() error
 	MountWorkspace(ctx context.Context, sessionID string, workspaceID string) error
+	ValidateImage(ctx context.Context, image string) error
+	ImageDigest(ctx context.Context, image string) (string, error)
+}
+
+// ImageResolver maps image references such as "python:3.12" to image names.
+type ImageResolver interface {
+	ResolveImage(ctx context.Context, ref string) (string, error)
 }
 
 type SessionStore interface {
 	CreateSession(sess *store.Session) error
 	GetSession(id string) (*store.Session, error)
-	ListSessions() ([]*store.Session, error)
+	ListTenantSessions(tenant string) ([]*store.Session, error)
+	ListRunningSessions() ([]*store.Session, error)
+	WorkspaceUsage() (map[string]store.WorkspaceUse, error)
 	UpdateSessionActivity(id string, cwd string, expiresAt time.Time) error
 	UpdateSessionStatus(id string, status string) error
 	UpdateSessionWorkspace(id string, workspaceID string) error
+	UpdateSessionSharedChannel(id string, channel string) error
+	UpdateSessionGroup(id string, groupID string) error
+	ListGroupSessions(groupID string) ([]*store.Session, error)
+	SharedChannelSessions(channel string) (int, error)
+	ActiveSessions() (int, error)
+	UpdateSessionExpiry(id string, expiresAt time.Time) error
+	UpdateSessionLabels(id string, labels map[string]string) error
+	UpdateSessionOwner(id string, keyID, tenant string) error
+	UpdateSessionImage(id, image, imageDigest string, initPID int, cgroupPath string) error
+	UpdateSessionCPU(id, cpu string) error
 }
 
 // ContainerPool provides pre-warmed sessions for fast acquisition.
@@ -35,6 +57,11 @@ type ContainerPool interface {
 	Get(ctx context.Context, image string, workspaceID string) (string, bool)
 	Put(ctx context.Context, sessionID string) error
 	Refill(ctx context.Context, image string, workspaceID string, count int) error
+	Resize(ctx context.Context, image string, size int) int
+	RefillAll(ctx context.Context)
+	Flush(ctx context.Context, image string) int
+	Status(ctx context.Context) []pool.KeyStatus
+	Drain(ctx context.Context) error
 }
 
 type WorkspaceManager interface {
@@ -42,3 +69,42 @@ type WorkspaceManager interface {
 	Exists(ctx context.Context, workspaceID string) (bool, error)
 	Delete(ctx context.Context, workspaceID string) error
 }
+
+// CommandPolicy decides whether an exec command may run. nil Violation = allowed.
+type CommandPolicy interface {
+	Check(cmd string) *policy.Violation
+}
+
+// AuditStore persists security-relevant decisions.
+type AuditStore interface {
+	AppendAuditEvent(ev *store.AuditEvent) error
+	ListAuditEvents(sessionID string, limit int) ([]*store.AuditEvent, error)
+}
+
+// WorkspaceStore persists workspace metadata such as descriptions and labels.
+type WorkspaceStore interface {
+	AddWorkspace(ws *store.Workspace) error
+	GetWorkspace(id string) (*store.Workspace, error)
+	ListWorkspaces() (map[string]*store.Workspace, error)
+	UpdateWorkspace(ws *store.Workspace) error
+	SetWorkspaceSize(id string, size int64) error
+	DeleteWorkspace(id string) error
+}
+
+// UsageStore persists usage records for chargeback.
+type UsageStore interface {
+	AppendUsageRecord(rec *store.UsageRecord) error
+	SummarizeUsage(groupBy string, since, until time.Time) ([]*store.UsageSummary, error)
+	SessionExecBytes(sessionID string) (in, out int64, err error)
+}
+
+// DiagnosticsStore keeps the most recent failed creates.
+type DiagnosticsStore interface {
+	AppendCreateFailure(f *store.CreateFailure) error
+	ListCreateFailures(limit int) ([]*store.CreateFailure, error)
+}
+
+// ContentScanner inspects file content before it is written.
+type ContentScanner interface {
+	Scan(ctx context.Context, req scan.Request) (scan.Result, error)
+}
@@ -5,9 +5,11 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
 )
 
 // Sentinel errors for structured error handling
@@ -17,6 +19,29 @@ var (
 	ErrInvalidImage = errors.New("image not allowed")
 	ErrTimeout      = errors.New("command timeout")
 	ErrNotRunning   = errors.New("session not running")
+	ErrPolicyDenied = errors.New("command rejected by policy")
+	ErrScanRejected = errors.New("content rejected by scan")
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileExists   = errors.New("file exists")
+	ErrDraining     = errors.New("daemon is shutting down")
+
+	ErrImageUnavailable = errors.New("image unavailable")
+	ErrImageVulnerable  = errors.New("image blocked by vulnerability scan")
+	ErrInvalidUpdate    = errors.New("invalid session update")
+	ErrPoolDisabled     = errors.New("session pool disabled")
+
+	ErrProxyUnsupported = errors.New("port proxy not supported by runtime")
+	ErrNoDeterminism    = errors.New("deterministic sessions not supported")
+	ErrTraceUnavailable = errors.New("exec tracing not available")
+	ErrPortUnreachable  = runtime.ErrPortUnreachable
+	ErrHostExhausted    = runtime.ErrHostResourcesExhausted
+	ErrShellUnavailable = errors.New("shell not available")
+	ErrUsageDisabled    = errors.New("usage accounting disabled")
+	ErrDefaultTenant    = errors.New("not available to tenant keys")
+
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrWorkspaceExists   = errors.New("workspace exists")
+	ErrInvalidWorkspace  = errors.New("invalid workspace request")
 )
 
 type Manager struct {
@@ -25,22 +50,86 @@ type Manager struct {
 	runtime   RuntimeDriver
 	workspace WorkspaceManager
 	pool      ContainerPool
+	policy    CommandPolicy
+	audit     AuditStore
+	wsMeta    WorkspaceStore
+	usage     UsageStore
+	diag      DiagnosticsStore
+	approvals *ApprovalQueue
+	scanner   ContentScanner
+	resolver  ImageResolver
+	onDestroy DestroyNotifier
+	notifier  EventNotifier
+
+	locks       map[string]*sync.Mutex
+	updateLocks map[string]*sync.Mutex // Update's read-modify-write; separate so updates don't wait for execs
+	locksMu     sync.Mutex
+
+	recordingMu  sync.Mutex
+	recordingSeq map[string]int
 
-	locks   map[string]*sync.Mutex
-	locksMu sync.Mutex
+	drain    drainState
+	stats    statsHistory
+	expiring expiryWarnings
+	overflow outputOverflow
+
+	imagesMu sync.Mutex
+	images   map[string]ImageStatus
+
+	channelMu   sync.Mutex   // orders shared channel attach against release
+	batchQueued atomic.Int64 // batch creates waiting in admit
+	creates     createQueue  // slots and queue for admission.max_sessions
 }
 
 func NewManager(cfg *config.Config, st SessionStore, rt RuntimeDriver, ws WorkspaceManager, pool ContainerPool) *Manager {
 	return &Manager{
-		cfg:       cfg,
-		store:     st,
-		runtime:   rt,
-		workspace: ws,
-		pool:      pool,
-		locks:     make(map[string]*sync.Mutex),
+		cfg:         cfg,
+		store:       st,
+		runtime:     rt,
+		workspace:   ws,
+		pool:        pool,
+		locks:       make(map[string]*sync.Mutex),
+		updateLocks: make(map[string]*sync.Mutex),
+
+		recordingSeq: make(map[string]int),
 	}
 }
 
+// SetPolicy installs the exec command policy (nil = allow all).
+func (m *Manager) SetPolicy(p CommandPolicy) {
+	m.policy = p
+}
+
+// SetAuditStore enables recording of policy decisions.
+func (m *Manager) SetAuditStore(a AuditStore) {
+	m.audit = a
+}
+
+// SetWorkspaceStore enables workspace metadata (nil = disabled).
+func (m *Manager) SetWorkspaceStore(w WorkspaceStore) {
+	m.wsMeta = w
+}
+
+// SetUsageStore enables usage records for execs and sessions (nil = disabled).
+func (m *Manager) SetUsageStore(u UsageStore) {
+	m.usage = u
+}
+
+// SetDiagnosticsStore enables recording of failed creates (nil = disabled).
+func (m *Manager) SetDiagnosticsStore(d DiagnosticsStore) {
+	m.diag = d
+}
+
+// SetApprovals enables the approval workflow (nil = disabled).
+func (m *Manager) SetApprovals(q *ApprovalQueue) {
+	m.approvals = q
+}
+
+// SetScanner installs the content scan hook for file writes (nil = disabled).
+func (m *Manager) SetScanner(s ContentScanner) {
+	m.scanner = s
+}
+
 // sessionLock returns or creates a mutex for the given session ID.
 func (m *Manager) sessionLock(id string) *sync.Mutex {
 	m.locksMu.Lock()
@@ -53,11 +142,31 @@ func (m *Manager) sessionLock(id string) *sync.Mutex {
 	return mu
 }
 
-// removeSessionLock removes the mutex for a destroyed session.
-func (m *Manager) removeSessionLock(id string) {
+// updateLock returns or creates the mutex serializing Update calls for the
+// given session ID.
+func (m *Manager) updateLock(id string) *sync.Mutex {
 	m.locksMu.Lock()
 	defer m.locksMu.Unlock()
+	mu, ok := m.updateLocks[id]
+	if !ok {
+		mu = &sync.Mutex{}
+		m.updateLocks[id] = mu
+	}
+	return mu
+}
+
+// removeSessionLock removes the mutexes for a destroyed session.
+func (m *Manager) removeSessionLock(id string) {
+	m.locksMu.Lock()
 	delete(m.locks, id)
+	delete(m.updateLocks, id)
+	m.locksMu.Unlock()
+
+	m.recordingMu.Lock()
+	delete(m.recordingSeq, id)
+	m.recordingMu.Unlock()
+
+	m.overflow.forget(id)
 }
 
 // CleanupSessionLock removes the mutex for a session (used by reaper).
@@ -80,13 +189,27 @@ func isImageNameSafe(image string) bool {
 	return imageNamePattern.MatchString(image)
 }
 
-// isImageAllowed checks if an image is in the allowed list.
+// imageTagPattern is the tag part of a "name:tag" image reference.
+var imageTagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// isImageRefSafe accepts an image name or a "name:tag" reference.
+func isImageRefSafe(ref string) bool {
+	name, tag, tagged := strings.Cut(ref, ":")
+	if !isImageNameSafe(name) {
+		return false
+	}
+	return !tagged || imageTagPattern.MatchString(tag)
+}
+
+// isImageAllowed checks if an image reference is in the allowed list. An
+// untagged entry also allows every tag of that name.
 func (m *Manager) isImageAllowed(image string) bool {
 	if len(m.cfg.AllowedImages) == 0 {
 		return true // No restrictions
 	}
+	name, _, _ := strings.Cut(image, ":")
 	for _, allowed := range m.cfg.AllowedImages {
-		if allowed == image {
+		if allowed == image || allowed == name {
 			return true
 		}
 	}
@@ -108,26 +231,63 @@ type CreateOpts struct {
 	Image       string
 	TTLSeconds  int
 	WorkspaceID string // optional persistent workspace
+	Rows, Cols  int    // terminal size of the shell; 0 = default
+	Hostname    string // "" = derived from the session ID
+	// SharedChannel mounts a tmpfs shared with the tenant's other sessions
+	// of the same channel at /shared; "" = none.
+	SharedChannel string
+	// Priority is high, normal or batch (see admit); "" = normal.
+	Priority string
+	// Determinism pins the session's clock, time zone, locale and
+	// randomness; nil = none. Empty TZ and Locale default to UTC and C.UTF-8.
+	Determinism *runtime.Determinism
+	// CPU sets the session's CPU weight and burst; nil = the defaults, with
+	// the weight of its priority (defaults.cpu_weight_by_priority).
+	CPU *runtime.CPUTuning
 }
 
 type SessionInfo struct {
-	ID            string    `json:"id"`
-	Image         string    `json:"image"`
-	Status        string    `json:"status"`
-	Cwd           string    `json:"cwd"`
-	AcquireSource string    `json:"acquire_source,omitempty"` // "pool" or "cold" on create
-	AcquireDetail string    `json:"acquire_detail,omitempty"` // optional reason for cold fallback
-	WorkspaceID   string    `json:"workspace_id,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	ExpiresAt     time.Time `json:"expires_at"`
+	ID            string            `json:"id"`
+	Image         string            `json:"image"`
+	Status        string            `json:"status"`
+	Cwd           string            `json:"cwd"`
+	AcquireSource string            `json:"acquire_source,omitempty"` // "pool" or "cold" on create
+	AcquireDetail string            `json:"acquire_detail,omitempty"` // optional reason for cold fallback
+	WorkspaceID   string            `json:"workspace_id,omitempty"`
+	ImageDigest   string            `json:"image_digest,omitempty"` // image version the session was built from
+	Hostname      string            `json:"hostname"`
+	SharedChannel string            `json:"shared_channel,omitempty"` // channel mounted at /shared
+	GroupID       string            `json:"group_id,omitempty"`       // session group created together
+	MachineID     string            `json:"machine_id"`               // content of /etc/machine-id
+	Thrashing     bool              `json:"thrashing,omitempty"`      // memory pressure at or above stats.thrashing_pressure
+	Labels        map[string]string `json:"labels,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+
+	Determinism *runtime.Determinism `json:"determinism,omitempty"`
+	CPU         *runtime.CPUTuning   `json:"cpu,omitempty"` // CPU weight and burst that differ from the defaults
 }
 
 type ExecResult struct {
+	ExecID     string `json:"exec_id,omitempty"`
 	ExitCode   int    `json:"exit_code"`
 	Cwd        string `json:"cwd"`
 	Output     string `json:"output"`
 	Truncated  bool   `json:"truncated"`
 	DurationMs int64  `json:"duration_ms"`
+	// OutputOverflow: Output was cut at defaults.max_output_bytes and the
+	// full output can be paged through with ExecOutput.
+	OutputOverflow bool `json:"output_overflow,omitempty"`
+	// ShellRestarted: the session shell had exited and was replaced, so
+	// shell state such as variables set by earlier execs is gone.
+	ShellRestarted bool `json:"shell_restarted,omitempty"`
+	// OutputBase64: Output holds the raw output bytes, base64-encoded.
+	OutputBase64 bool `json:"output_base64,omitempty"`
+	// Trace is the activity of a traced exec (see ExecOpts.Trace).
+	Trace *runtime.TraceReport `json:"trace,omitempty"`
+	// Artifacts holds the coverage and profile an exec collected (see
+	// ExecOpts.Artifacts).
+	Artifacts *ExecArtifacts `json:"artifacts,omitempty"`
 }
 
 type ExecChunk struct {
@@ -136,5 +296,15 @@ type ExecChunk struct {
 	ExitCode   int    `json:"exit_code"`   // only set on final chunk
 	Cwd        string `json:"cwd"`         // only set on final chunk
 	DurationMs int64  `json:"duration_ms"` // only set on final chunk
-	Done       bool   `json:"done"`        // true on final chunk
+	// ShellRestarted is only set on the final chunk, see ExecResult.
+	ShellRestarted bool `json:"shell_restarted,omitempty"`
+	OutputBase64   bool `json:"output_base64,omitempty"`
+	Done           bool `json:"done"` // true on final chunk
+	// ExecID and OutputOverflow are only set on the final chunk, see
+	// ExecResult.
+	ExecID         string `json:"exec_id,omitempty"`
+	OutputOverflow bool   `json:"output_overflow,omitempty"`
+	// Trace and Artifacts are only set on the final chunk, see ExecResult.
+	Trace     *runtime.TraceReport `json:"trace,omitempty"`
+	Artifacts *ExecArtifacts       `json:"artifacts,omitempty"`
 }
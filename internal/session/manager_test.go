@@ -36,6 +36,26 @@ func TestIsImageAllowed(t *testing.T) {
 	assert.False(t, mgr.isImageAllowed("evil-image"))
 }
 
+func TestIsImageAllowedTags(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	mgr.cfg.AllowedImages = []string{"base", "node:20"}
+
+	assert.True(t, mgr.isImageAllowed("base:latest"))
+	assert.True(t, mgr.isImageAllowed("node:20"))
+	assert.False(t, mgr.isImageAllowed("node:22"))
+	assert.False(t, mgr.isImageAllowed("node"))
+}
+
+func TestIsImageRefSafe(t *testing.T) {
+	assert.True(t, isImageRefSafe("python"))
+	assert.True(t, isImageRefSafe("python:3.12"))
+	assert.True(t, isImageRefSafe("python:latest"))
+	assert.False(t, isImageRefSafe("python:"))
+	assert.False(t, isImageRefSafe(":latest"))
+	assert.False(t, isImageRefSafe("python:../x"))
+	assert.False(t, isImageRefSafe("python:3:12"))
+}
+
 func TestIsImageAllowedNoRestrictions(t *testing.T) {
 	mgr, _, _ := newTestManager()
 	mgr.cfg.AllowedImages = nil
@@ -4,7 +4,9 @@ import (
 	"context"
 	"time"
 
+	"github.com/p-arndt/sandkasten/internal/pool"
 	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/scan"
 	"github.com/p-arndt/sandkasten/internal/store"
 	"github.com/p-arndt/sandkasten/protocol"
 	"github.com/stretchr/testify/mock"
@@ -63,6 +65,25 @@ func (m *MockRuntimeDriver) MountWorkspace(ctx context.Context, sessionID string
 	return args.Error(0)
 }
 
+func (m *MockRuntimeDriver) ValidateImage(ctx context.Context, image string) error {
+	args := m.Called(ctx, image)
+	return args.Error(0)
+}
+
+func (m *MockRuntimeDriver) ImageDigest(ctx context.Context, image string) (string, error) {
+	args := m.Called(ctx, image)
+	return args.String(0), args.Error(1)
+}
+
+type MockImageResolver struct {
+	mock.Mock
+}
+
+func (m *MockImageResolver) ResolveImage(ctx context.Context, ref string) (string, error) {
+	args := m.Called(ctx, ref)
+	return args.String(0), args.Error(1)
+}
+
 type MockSessionStore struct {
 	mock.Mock
 }
@@ -80,7 +101,15 @@ func (m *MockSessionStore) GetSession(id string) (*store.Session, error) {
 	return nil, args.Error(1)
 }
 
-func (m *MockSessionStore) ListSessions() ([]*store.Session, error) {
+func (m *MockSessionStore) ListTenantSessions(tenant string) ([]*store.Session, error) {
+	args := m.Called(tenant)
+	if sessions := args.Get(0); sessions != nil {
+		return sessions.([]*store.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionStore) ListRunningSessions() ([]*store.Session, error) {
 	args := m.Called()
 	if sessions := args.Get(0); sessions != nil {
 		return sessions.([]*store.Session), args.Error(1)
@@ -88,6 +117,14 @@ func (m *MockSessionStore) ListSessions() ([]*store.Session, error) {
 	return nil, args.Error(1)
 }
 
+func (m *MockSessionStore) WorkspaceUsage() (map[string]store.WorkspaceUse, error) {
+	args := m.Called()
+	if usage := args.Get(0); usage != nil {
+		return usage.(map[string]store.WorkspaceUse), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *MockSessionStore) UpdateSessionActivity(id string, cwd string, expiresAt time.Time) error {
 	args := m.Called(id, cwd, expiresAt)
 	return args.Error(0)
@@ -103,6 +140,59 @@ func (m *MockSessionStore) UpdateSessionWorkspace(id string, workspaceID string)
 	return args.Error(0)
 }
 
+func (m *MockSessionStore) UpdateSessionSharedChannel(id string, channel string) error {
+	args := m.Called(id, channel)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) ActiveSessions() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockSessionStore) SharedChannelSessions(channel string) (int, error) {
+	args := m.Called(channel)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockSessionStore) UpdateSessionGroup(id string, groupID string) error {
+	args := m.Called(id, groupID)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) ListGroupSessions(groupID string) ([]*store.Session, error) {
+	args := m.Called(groupID)
+	if sessions := args.Get(0); sessions != nil {
+		return sessions.([]*store.Session), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockSessionStore) UpdateSessionExpiry(id string, expiresAt time.Time) error {
+	args := m.Called(id, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) UpdateSessionLabels(id string, labels map[string]string) error {
+	args := m.Called(id, labels)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) UpdateSessionOwner(id string, keyID, tenant string) error {
+	args := m.Called(id, keyID, tenant)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) UpdateSessionImage(id, image, imageDigest string, initPID int, cgroupPath string) error {
+	args := m.Called(id, image, imageDigest, initPID, cgroupPath)
+	return args.Error(0)
+}
+
+func (m *MockSessionStore) UpdateSessionCPU(id, cpu string) error {
+	args := m.Called(id, cpu)
+	return args.Error(0)
+}
+
 type MockContainerPool struct {
 	mock.Mock
 }
@@ -122,6 +212,31 @@ func (m *MockContainerPool) Refill(ctx context.Context, image string, workspaceI
 	return args.Error(0)
 }
 
+func (m *MockContainerPool) Resize(ctx context.Context, image string, size int) int {
+	args := m.Called(ctx, image, size)
+	return args.Int(0)
+}
+
+func (m *MockContainerPool) RefillAll(ctx context.Context) {
+	m.Called(ctx)
+}
+
+func (m *MockContainerPool) Flush(ctx context.Context, image string) int {
+	args := m.Called(ctx, image)
+	return args.Int(0)
+}
+
+func (m *MockContainerPool) Status(ctx context.Context) []pool.KeyStatus {
+	args := m.Called(ctx)
+	keys, _ := args.Get(0).([]pool.KeyStatus)
+	return keys
+}
+
+func (m *MockContainerPool) Drain(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
 type MockWorkspaceManager struct {
 	mock.Mock
 }
@@ -140,3 +255,68 @@ func (m *MockWorkspaceManager) Delete(ctx context.Context, workspaceID string) e
 	args := m.Called(ctx, workspaceID)
 	return args.Error(0)
 }
+
+type MockAuditStore struct {
+	mock.Mock
+}
+
+func (m *MockAuditStore) AppendAuditEvent(ev *store.AuditEvent) error {
+	args := m.Called(ev)
+	return args.Error(0)
+}
+
+func (m *MockAuditStore) ListAuditEvents(sessionID string, limit int) ([]*store.AuditEvent, error) {
+	args := m.Called(sessionID, limit)
+	if events := args.Get(0); events != nil {
+		return events.([]*store.AuditEvent), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+type MockContentScanner struct {
+	mock.Mock
+}
+
+func (m *MockContentScanner) Scan(ctx context.Context, req scan.Request) (scan.Result, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(scan.Result), args.Error(1)
+}
+
+type MockUsageStore struct {
+	mock.Mock
+}
+
+func (m *MockUsageStore) AppendUsageRecord(rec *store.UsageRecord) error {
+	args := m.Called(rec)
+	return args.Error(0)
+}
+
+func (m *MockUsageStore) SummarizeUsage(groupBy string, since, until time.Time) ([]*store.UsageSummary, error) {
+	args := m.Called(groupBy, since, until)
+	if usage := args.Get(0); usage != nil {
+		return usage.([]*store.UsageSummary), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *MockUsageStore) SessionExecBytes(sessionID string) (int64, int64, error) {
+	args := m.Called(sessionID)
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
+
+type MockDiagnosticsStore struct {
+	mock.Mock
+}
+
+func (m *MockDiagnosticsStore) AppendCreateFailure(f *store.CreateFailure) error {
+	args := m.Called(f)
+	return args.Error(0)
+}
+
+func (m *MockDiagnosticsStore) ListCreateFailures(limit int) ([]*store.CreateFailure, error) {
+	args := m.Called(limit)
+	if failures := args.Get(0); failures != nil {
+		return failures.([]*store.CreateFailure), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
@@ -0,0 +1,54 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// AuditActionOOMKilled records processes of a session killed for running
+// out of memory.
+const AuditActionOOMKilled = "session_oom"
+
+// EventNotifier sends operator notifications (see notify.Notifier).
+type EventNotifier interface {
+	Notify(ev notify.Event)
+}
+
+// SetNotifier installs the operator notifications (nil = none).
+func (m *Manager) SetNotifier(n EventNotifier) {
+	m.notifier = n
+}
+
+// checkOOM audits and notifies OOM kills of sess since the previous sample,
+// whose OOM kill count is prev.
+func (m *Manager) checkOOM(sess *store.Session, prev int64, stats *protocol.SessionStats) {
+	killed := stats.OOMKills - prev
+	if killed <= 0 {
+		return
+	}
+	detail := fmt.Sprintf("%d process(es) killed for running out of memory", killed)
+	m.recordAudit(sess.ID, AuditActionOOMKilled, detail)
+	if m.notifier == nil {
+		return
+	}
+	fields := map[string]string{
+		"image":     sess.Image,
+		"oom_kills": strconv.FormatInt(stats.OOMKills, 10),
+	}
+	if stats.MemoryLimit > 0 {
+		fields["memory_limit_mb"] = strconv.FormatInt(stats.MemoryLimit>>20, 10)
+	}
+	if sess.Tenant != "" {
+		fields["tenant"] = sess.Tenant
+	}
+	m.notifier.Notify(notify.Event{
+		Type:      notify.EventSessionOOM,
+		SessionID: sess.ID,
+		Summary:   fmt.Sprintf("session %s: %s", sess.ID, detail),
+		Fields:    fields,
+	})
+}
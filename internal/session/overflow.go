@@ -0,0 +1,202 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+var (
+	// ErrOutputNotFound is returned for exec output that was never kept or
+	// has expired.
+	ErrOutputNotFound = errors.New("exec output not found")
+	// ErrInvalidOutputRange is returned for an offset past the output.
+	ErrInvalidOutputRange = errors.New("invalid output range")
+)
+
+// DefaultOutputPageBytes is the page size of ExecOutput without a limit.
+const DefaultOutputPageBytes = 1024 * 1024 // 1 MiB
+
+// overflowBudget is how many outputs of defaults.output_overflow_bytes are
+// kept at most; older ones are dropped first.
+const overflowBudget = 4
+
+// OutputPage is a part of the full output of an exec whose response was cut
+// at defaults.max_output_bytes.
+type OutputPage struct {
+	ExecID     string `json:"exec_id"`
+	Offset     int    `json:"offset"`
+	NextOffset int    `json:"next_offset"`
+	TotalBytes int    `json:"total_bytes"`
+	Output     string `json:"output"`
+	// OutputBase64: the exec asked for base64 output; offsets count raw
+	// bytes and Output holds the page's bytes, base64-encoded.
+	OutputBase64 bool `json:"output_base64,omitempty"`
+	// Complete is false when the output was longer than
+	// defaults.output_overflow_bytes, which is all that was kept.
+	Complete bool `json:"complete"`
+}
+
+// outputOverflow keeps the full output of execs over the output limit in
+// memory, bounded in size and time. The zero value is ready to use.
+type outputOverflow struct {
+	mu      sync.Mutex
+	entries map[string]*overflowEntry // by session ID + "/" + exec ID
+	size    int
+}
+
+type overflowEntry struct {
+	sessionID string
+	data      []byte
+	base64    bool
+	complete  bool
+	expires   time.Time
+}
+
+// put keeps e under key, dropping expired entries and then the oldest ones
+// until all of them fit in budget bytes.
+func (o *outputOverflow) put(key string, e *overflowEntry, budget int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.entries == nil {
+		o.entries = make(map[string]*overflowEntry)
+	}
+	now := time.Now()
+	for k, old := range o.entries {
+		if now.After(old.expires) {
+			o.remove(k)
+		}
+	}
+	for o.size+len(e.data) > budget && len(o.entries) > 0 {
+		oldest := ""
+		for k, old := range o.entries {
+			if oldest == "" || old.expires.Before(o.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		o.remove(oldest)
+	}
+	o.entries[key] = e
+	o.size += len(e.data)
+}
+
+func (o *outputOverflow) get(key string) *overflowEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e := o.entries[key]
+	if e == nil || time.Now().After(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// forget drops the outputs of a destroyed session.
+func (o *outputOverflow) forget(sessionID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for k, e := range o.entries {
+		if e.sessionID == sessionID {
+			o.remove(k)
+		}
+	}
+}
+
+func (o *outputOverflow) remove(key string) {
+	o.size -= len(o.entries[key].data)
+	delete(o.entries, key)
+}
+
+// requestOutputLimit is the output limit sent to the runner: the overflow
+// size when overflow is kept, so the daemon sees what it cuts.
+func (m *Manager) requestOutputLimit() int {
+	if n := m.cfg.Defaults.OutputOverflowBytes; n > 0 {
+		return n
+	}
+	return m.cfg.Defaults.MaxOutputBytes
+}
+
+// keepOverflow cuts the output of resp to defaults.max_output_bytes and keeps
+// the full output for ExecOutput. It reports whether it did; output within
+// the limit, timestamped lines and disabled overflow are left alone.
+func (m *Manager) keepOverflow(sessionID, execID string, resp *protocol.Response) (bool, error) {
+	size := m.cfg.Defaults.OutputOverflowBytes
+	if size <= 0 || resp.Lines != nil {
+		return false, nil
+	}
+	req := protocol.Request{MaxOutputBytes: m.cfg.Defaults.MaxOutputBytes}
+	e := &overflowEntry{
+		sessionID: sessionID,
+		base64:    resp.OutputBase64,
+		complete:  !resp.Truncated,
+		expires:   time.Now().Add(time.Duration(m.cfg.Defaults.OutputOverflowSeconds) * time.Second),
+	}
+	if resp.OutputBase64 {
+		raw, err := base64.StdEncoding.DecodeString(resp.Output)
+		if err != nil {
+			return false, fmt.Errorf("decode output: %w", err)
+		}
+		if len(raw) <= req.Base64OutputLimit() {
+			return false, nil
+		}
+		e.data = raw
+		resp.Output = base64.StdEncoding.EncodeToString(raw[:req.Base64OutputLimit()])
+	} else {
+		if len(resp.Output) <= req.OutputLimit() {
+			return false, nil
+		}
+		e.data = []byte(resp.Output)
+		resp.Output, _ = protocol.TruncateOutput(resp.Output, req.OutputLimit(), m.cfg.Defaults.OutputTruncation)
+	}
+	resp.Truncated = true
+	m.overflow.put(sessionID+"/"+execID, e, overflowBudget*size)
+	return true, nil
+}
+
+// ExecOutput returns up to limit bytes of the full output of an exec from
+// offset on; limit 0 = DefaultOutputPageBytes. Pages of text output end on a
+// rune boundary, so the next one starts at NextOffset.
+func (m *Manager) ExecOutput(ctx context.Context, sessionID, execID string, offset, limit int) (*OutputPage, error) {
+	sess, err := m.getOwnSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	e := m.overflow.get(sessionID + "/" + execID)
+	if e == nil {
+		return nil, fmt.Errorf("%w: %s", ErrOutputNotFound, execID)
+	}
+	if offset < 0 || offset > len(e.data) {
+		return nil, fmt.Errorf("%w: offset %d outside of the %d bytes of output", ErrInvalidOutputRange, offset, len(e.data))
+	}
+	if limit <= 0 {
+		limit = DefaultOutputPageBytes
+	}
+	end := min(offset+limit, len(e.data))
+	if !e.base64 {
+		for i := 0; i < utf8.UTFMax && end > offset+1 && end < len(e.data) && !utf8.RuneStart(e.data[end]); i++ {
+			end--
+		}
+	}
+	page := &OutputPage{
+		ExecID:       execID,
+		Offset:       offset,
+		NextOffset:   end,
+		TotalBytes:   len(e.data),
+		OutputBase64: e.base64,
+		Complete:     e.complete,
+	}
+	if e.base64 {
+		page.Output = base64.StdEncoding.EncodeToString(e.data[offset:end])
+	} else {
+		page.Output = string(e.data[offset:end])
+	}
+	return page, nil
+}
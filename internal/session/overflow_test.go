@@ -0,0 +1,144 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func overflowManager(output string, outputBase64 bool) (*Manager, *MockRuntimeDriver) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Defaults.MaxOutputBytes = 1024
+	mgr.cfg.Defaults.OutputOverflowBytes = 4096
+	mgr.cfg.Defaults.OutputOverflowSeconds = 60
+
+	sess := runningSession("s1")
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.MaxOutputBytes == 4096
+	})).Return(&protocol.Response{
+		Type:         protocol.ResponseExec,
+		Cwd:          "/workspace",
+		Output:       output,
+		OutputBase64: outputBase64,
+	}, nil)
+	return mgr, rt
+}
+
+func TestExec_KeepsOverflow(t *testing.T) {
+	full := strings.Repeat("a", 1000) + strings.Repeat("ü", 500)
+	mgr, _ := overflowManager(full, false)
+
+	result, err := mgr.Exec(context.Background(), "s1", "build", ExecOpts{})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.True(t, result.OutputOverflow)
+	assert.LessOrEqual(t, len(result.Output), 1024)
+	require.NotEmpty(t, result.ExecID)
+
+	var b strings.Builder
+	offset := 0
+	for {
+		page, err := mgr.ExecOutput(context.Background(), "s1", result.ExecID, offset, 1001)
+		require.NoError(t, err)
+		assert.Equal(t, len(full), page.TotalBytes)
+		assert.True(t, page.Complete)
+		assert.True(t, strings.HasPrefix(full[page.Offset:], page.Output), "pages end on rune boundaries")
+		b.WriteString(page.Output)
+		if page.NextOffset == page.TotalBytes {
+			break
+		}
+		offset = page.NextOffset
+	}
+	assert.Equal(t, full, b.String())
+
+	_, err = mgr.ExecOutput(context.Background(), "s1", result.ExecID, len(full)+1, 0)
+	assert.ErrorIs(t, err, ErrInvalidOutputRange)
+	_, err = mgr.ExecOutput(context.Background(), "s1", "other", 0, 0)
+	assert.ErrorIs(t, err, ErrOutputNotFound)
+
+	mgr.CleanupSessionLock("s1")
+	_, err = mgr.ExecOutput(context.Background(), "s1", result.ExecID, 0, 0)
+	assert.ErrorIs(t, err, ErrOutputNotFound, "dropped with the session")
+}
+
+// TestExecStream_LineTimestampsIgnoreOverflow checks that timestamped lines,
+// which are never kept, are cut at max_output_bytes, not at the overflow size.
+func TestExecStream_LineTimestampsIgnoreOverflow(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Defaults.MaxOutputBytes = 1024
+	mgr.cfg.Defaults.OutputOverflowBytes = 4096
+	mgr.cfg.Defaults.OutputOverflowSeconds = 60
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.LineTimestamps && req.MaxOutputBytes == 1024
+	})).Return(&protocol.Response{
+		Type:      protocol.ResponseExec,
+		Cwd:       "/workspace",
+		Lines:     []protocol.OutputLine{{Timestamp: 1707390000000, Text: strings.Repeat("a", 1000)}},
+		Truncated: true,
+	}, nil)
+
+	chunkChan := make(chan ExecChunk, 10)
+	require.NoError(t, mgr.ExecStream(context.Background(), "s1", "build", ExecOpts{LineTimestamps: true}, chunkChan))
+	require.Len(t, chunkChan, 2)
+	<-chunkChan
+	done := <-chunkChan
+	assert.True(t, done.Done)
+	assert.False(t, done.OutputOverflow)
+	rt.AssertExpectations(t)
+}
+
+func TestExec_KeepsOverflowBase64(t *testing.T) {
+	raw := make([]byte, 2000)
+	for i := range raw {
+		raw[i] = byte(i)
+	}
+	mgr, _ := overflowManager(base64.StdEncoding.EncodeToString(raw), true)
+
+	result, err := mgr.Exec(context.Background(), "s1", "cat blob", ExecOpts{OutputBase64: true})
+	require.NoError(t, err)
+	require.True(t, result.OutputOverflow)
+	head, err := base64.StdEncoding.DecodeString(result.Output)
+	require.NoError(t, err)
+	assert.Equal(t, raw[:768], head)
+
+	page, err := mgr.ExecOutput(context.Background(), "s1", result.ExecID, 768, 0)
+	require.NoError(t, err)
+	assert.True(t, page.OutputBase64)
+	rest, err := base64.StdEncoding.DecodeString(page.Output)
+	require.NoError(t, err)
+	assert.Equal(t, raw[768:], rest)
+}
+
+func TestExec_OutputWithinLimitNotKept(t *testing.T) {
+	mgr, _ := overflowManager("short\n", false)
+
+	result, err := mgr.Exec(context.Background(), "s1", "echo short", ExecOpts{})
+	require.NoError(t, err)
+	assert.False(t, result.Truncated)
+	assert.False(t, result.OutputOverflow)
+	_, err = mgr.ExecOutput(context.Background(), "s1", result.ExecID, 0, 0)
+	assert.ErrorIs(t, err, ErrOutputNotFound)
+}
+
+func TestOutputOverflow_EvictsOldest(t *testing.T) {
+	var o outputOverflow
+	for i, key := range []string{"s1/a", "s1/b", "s1/c"} {
+		o.put(key, &overflowEntry{sessionID: "s1", data: make([]byte, 100), expires: time.Now().Add(time.Duration(i+1) * time.Minute)}, 250)
+	}
+	assert.Nil(t, o.get("s1/a"))
+	assert.NotNil(t, o.get("s1/b"))
+	assert.NotNil(t, o.get("s1/c"))
+	assert.Equal(t, 200, o.size)
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+)
+
+// AuditActionExecDenied is recorded when the command policy rejects an exec.
+const AuditActionExecDenied = "exec_denied"
+
+// checkCommandPolicy returns ErrPolicyDenied if the configured policy rejects cmd.
+// Rejections are written to the audit log when one is configured.
+func (m *Manager) checkCommandPolicy(sessionID, cmd string) error {
+	if m.policy == nil {
+		return nil
+	}
+	v := m.policy.Check(cmd)
+	if v == nil {
+		return nil
+	}
+	m.recordAudit(sessionID, AuditActionExecDenied, fmt.Sprintf("%s: %s (cmd=%q)", v.Rule, v.Reason, truncateForAudit(cmd)))
+	return fmt.Errorf("%w: %s", ErrPolicyDenied, v.Reason)
+}
+
+// recordAudit appends an audit event; failures are ignored so auditing never
+// blocks the request path.
+func (m *Manager) recordAudit(sessionID, action, detail string) {
+	if m.audit == nil {
+		return
+	}
+	_ = m.audit.AppendAuditEvent(&store.AuditEvent{
+		SessionID: sessionID,
+		Action:    action,
+		Detail:    detail,
+	})
+}
+
+// ListAuditEvents returns recorded audit events, newest first.
+// Only the default tenant may read the log.
+func (m *Manager) ListAuditEvents(ctx context.Context, sessionID string, limit int) ([]*store.AuditEvent, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.audit == nil {
+		return []*store.AuditEvent{}, nil
+	}
+	events, err := m.audit.ListAuditEvents(sessionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []*store.AuditEvent{}
+	}
+	return events, nil
+}
+
+func truncateForAudit(cmd string) string {
+	const max = 512
+	if len(cmd) <= max {
+		return cmd
+	}
+	return cmd[:max] + "..."
+}
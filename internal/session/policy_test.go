@@ -0,0 +1,52 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/policy"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecPolicyDenied(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	audit := &MockAuditStore{}
+	pol, err := policy.New(config.PolicyConfig{Enabled: true, DenyPrefixes: []string{"reboot"}}, "none")
+	require.NoError(t, err)
+	mgr.SetPolicy(pol)
+	mgr.SetAuditStore(audit)
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.SessionID == "s1" && ev.Action == AuditActionExecDenied
+	})).Return(nil)
+
+	_, err = mgr.Exec(context.Background(), "s1", "reboot now", ExecOpts{})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+	audit.AssertExpectations(t)
+}
+
+func TestExecStreamPolicyDenied(t *testing.T) {
+	mgr, _, st := newTestManager()
+	pol, err := policy.New(config.PolicyConfig{Enabled: true, DenyPatterns: []string{`rm\s+-rf\s+/$`}}, "none")
+	require.NoError(t, err)
+	mgr.SetPolicy(pol)
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	err = mgr.ExecStream(context.Background(), "s1", "rm -rf /", ExecOpts{}, make(chan ExecChunk, 1))
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+}
+
+func TestListAuditEventsWithoutStore(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	events, err := mgr.ListAuditEvents(context.Background(), "", 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/pool"
+)
+
+// PoolWarmResult reports the new and previous pool size of an image.
+type PoolWarmResult struct {
+	Image    string `json:"image"`
+	Size     int    `json:"size"`
+	Previous int    `json:"previous"`
+}
+
+// WarmPool sets how many idle sessions the pool keeps for image (empty = the
+// default image) and starts filling it in the background. Shrinking destroys
+// the surplus idle sessions. The size is not persisted: a restart goes back to
+// pool.images. Tenant keys may not resize the shared pool.
+func (m *Manager) WarmPool(ctx context.Context, image string, size int) (*PoolWarmResult, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.pool == nil {
+		return nil, ErrPoolDisabled
+	}
+	if m.Draining() {
+		return nil, ErrDraining
+	}
+
+	ref := m.resolveImage(image)
+	if !isImageRefSafe(ref) || !m.isImageAllowed(ref) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, ref)
+	}
+	if err := m.checkImageAvailable(ref); err != nil {
+		return nil, err
+	}
+	name, err := m.lookupImage(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidImage, ref, err)
+	}
+
+	previous := m.pool.Resize(ctx, name, size)
+	if size > 0 {
+		go m.pool.Refill(context.Background(), name, "", 0)
+	}
+	return &PoolWarmResult{Image: name, Size: size, Previous: previous}, nil
+}
+
+// PoolStatus is the state of the session pool (GET /v1/pool).
+type PoolStatus struct {
+	Keys []pool.KeyStatus `json:"keys"`
+}
+
+// PoolStatus returns the target, idle sessions and refill state of every
+// pool key. Like the other pool controls, it is refused to tenant keys:
+// the pool is shared by every tenant.
+func (m *Manager) PoolStatus(ctx context.Context) (*PoolStatus, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.pool == nil {
+		return nil, ErrPoolDisabled
+	}
+	return &PoolStatus{Keys: m.pool.Status(ctx)}, nil
+}
+
+// PoolDrainResult reports the idle sessions a pool drain destroyed.
+type PoolDrainResult struct {
+	Image     string `json:"image,omitempty"` // "" = every image
+	Discarded int    `json:"discarded"`
+	Refilling bool   `json:"refilling"`
+}
+
+// DrainPool destroys the idle sessions of image ("" = every image), e.g.
+// after the image or its launch config changed, and with refill starts
+// building fresh ones in the background. Sessions already handed out are
+// not touched. Images no longer allowed can still be drained.
+func (m *Manager) DrainPool(ctx context.Context, image string, refill bool) (*PoolDrainResult, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.pool == nil {
+		return nil, ErrPoolDisabled
+	}
+	if refill && m.Draining() {
+		return nil, ErrDraining
+	}
+	name := image
+	if image != "" {
+		if !isImageRefSafe(image) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidImage, image)
+		}
+		// A deleted image may still have pooled sessions.
+		if resolved, err := m.lookupImage(ctx, image); err == nil {
+			name = resolved
+		}
+	}
+	n := m.pool.Flush(ctx, name)
+	if refill {
+		go m.refillPool(name)
+	}
+	return &PoolDrainResult{Image: name, Discarded: n, Refilling: refill}, nil
+}
+
+// PoolRefillResult reports the idle sessions a pool refill is creating.
+type PoolRefillResult struct {
+	Image   string `json:"image,omitempty"` // "" = every image
+	Missing int    `json:"missing"`         // idle sessions below target when the refill started
+}
+
+// RefillPool fills the pool of image ("" = every pooled image) up to its
+// target in the background.
+func (m *Manager) RefillPool(ctx context.Context, image string) (*PoolRefillResult, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.pool == nil {
+		return nil, ErrPoolDisabled
+	}
+	if m.Draining() {
+		return nil, ErrDraining
+	}
+	name := image
+	if image != "" {
+		if !isImageRefSafe(image) || !m.isImageAllowed(image) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidImage, image)
+		}
+		if err := m.checkImageAvailable(image); err != nil {
+			return nil, err
+		}
+		resolved, err := m.lookupImage(ctx, image)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidImage, image, err)
+		}
+		name = resolved
+	}
+
+	res := &PoolRefillResult{Image: name}
+	pooled := false
+	for _, k := range m.pool.Status(ctx) {
+		if k.WorkspaceID != "" || (name != "" && k.Image != name) || k.Target == 0 {
+			continue
+		}
+		pooled = true
+		res.Missing += max(k.Target-k.Idle, 0)
+	}
+	if name != "" && !pooled {
+		return nil, fmt.Errorf("%w: %s is not pooled (set a size with POST /v1/pool/warm)", ErrInvalidImage, name)
+	}
+	go m.refillPool(name)
+	return res, nil
+}
+
+// refillPool fills the pool of image ("" = every image) up to its target.
+func (m *Manager) refillPool(image string) {
+	if image == "" {
+		m.pool.RefillAll(context.Background())
+		return
+	}
+	m.pool.Refill(context.Background(), image, "", 0)
+}
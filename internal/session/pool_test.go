@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/pool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmPool(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	refilled := make(chan struct{})
+	pl.On("Resize", mock.Anything, "python", 4).Return(2)
+	pl.On("Refill", mock.Anything, "python", "", 0).Return(nil).Run(func(mock.Arguments) { close(refilled) })
+
+	res, err := mgr.WarmPool(context.Background(), "python", 4)
+	require.NoError(t, err)
+	assert.Equal(t, &PoolWarmResult{Image: "python", Size: 4, Previous: 2}, res)
+	<-refilled
+}
+
+func TestWarmPoolShrinkDoesNotRefill(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	pl.On("Resize", mock.Anything, "python", 0).Return(3)
+
+	res, err := mgr.WarmPool(context.Background(), "python", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Previous)
+	pl.AssertNotCalled(t, "Refill", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWarmPoolDisabled(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	_, err := mgr.WarmPool(context.Background(), "python", 2)
+	assert.ErrorIs(t, err, ErrPoolDisabled)
+}
+
+func TestWarmPoolImageNotAllowed(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	mgr.pool = &MockContainerPool{}
+
+	_, err := mgr.WarmPool(context.Background(), "evil", 2)
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func TestPoolStatus(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	_, err := mgr.PoolStatus(context.Background())
+	assert.ErrorIs(t, err, ErrPoolDisabled)
+
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	keys := []pool.KeyStatus{{Image: "python", Target: 2, Idle: 1}}
+	pl.On("Status", mock.Anything).Return(keys)
+
+	st, err := mgr.PoolStatus(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, keys, st.Keys)
+}
+
+func TestPoolControlsDefaultTenantOnly(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	acme := WithTenant(context.Background(), "acme")
+
+	_, err := mgr.WarmPool(acme, "python", 256)
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	_, err = mgr.PoolStatus(acme)
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	_, err = mgr.DrainPool(acme, "python", true)
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	_, err = mgr.RefillPool(acme, "")
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	pl.AssertNotCalled(t, "Resize", mock.Anything, mock.Anything, mock.Anything)
+	pl.AssertNotCalled(t, "Status", mock.Anything)
+	pl.AssertNotCalled(t, "Flush", mock.Anything, mock.Anything)
+}
+
+func TestDrainPool(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	pl.On("Flush", mock.Anything, "python").Return(3)
+
+	res, err := mgr.DrainPool(context.Background(), "python", false)
+	require.NoError(t, err)
+	assert.Equal(t, &PoolDrainResult{Image: "python", Discarded: 3}, res)
+	pl.AssertNotCalled(t, "Refill", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Images no longer allowed can still be drained.
+	mgr.cfg.AllowedImages = []string{"node"}
+	refilled := make(chan struct{})
+	pl.On("Flush", mock.Anything, "").Return(5)
+	pl.On("RefillAll", mock.Anything).Return().Run(func(mock.Arguments) { close(refilled) })
+	res, err = mgr.DrainPool(context.Background(), "", true)
+	require.NoError(t, err)
+	assert.Equal(t, &PoolDrainResult{Discarded: 5, Refilling: true}, res)
+	<-refilled
+
+	_, err = mgr.DrainPool(context.Background(), "../etc", false)
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func TestRefillPool(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	pl := &MockContainerPool{}
+	mgr.pool = pl
+	pl.On("Status", mock.Anything).Return([]pool.KeyStatus{
+		{Image: "node", Target: 1, Idle: 1},
+		{Image: "python", Target: 4, Idle: 1},
+		{Image: "python", WorkspaceID: "ws1", Target: 1},
+	})
+	refilled := make(chan struct{})
+	pl.On("Refill", mock.Anything, "python", "", 0).Return(nil).Run(func(mock.Arguments) { close(refilled) })
+
+	res, err := mgr.RefillPool(context.Background(), "python")
+	require.NoError(t, err)
+	assert.Equal(t, &PoolRefillResult{Image: "python", Missing: 3}, res)
+	<-refilled
+
+	_, err = mgr.RefillPool(context.Background(), "ruby")
+	assert.ErrorIs(t, err, ErrInvalidImage, "not pooled")
+}
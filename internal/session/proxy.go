@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// DialPort opens a connection to a TCP port inside the session, relayed by
+// the runner, and counts it as session activity. Used by the HTTP proxy to
+// preview dev servers.
+func (m *Manager) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := m.runtime.(runtime.PortDialer)
+	if !ok {
+		return nil, ErrProxyUnsupported
+	}
+
+	conn, err := d.DialPort(ctx, sess.ID, port)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, ErrProxyUnsupported
+	}
+	if err != nil {
+		return nil, fmt.Errorf("proxy to port %d: %w", port, err)
+	}
+
+	m.extendSessionLease(sessionID, sess.Cwd)
+	return conn, nil
+}
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// portDialerRuntime adds runtime.PortDialer to the mock driver.
+type portDialerRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r portDialerRuntime) DialPort(ctx context.Context, sessionID string, port int) (net.Conn, error) {
+	args := r.Called(ctx, sessionID, port)
+	if conn := args.Get(0); conn != nil {
+		return conn.(net.Conn), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func TestDialPort(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.runtime = portDialerRuntime{rt}
+	client, server := net.Pipe()
+	defer server.Close()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("DialPort", mock.Anything, "s1", 3000).Return(client, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	conn, err := mgr.DialPort(context.Background(), "s1", 3000)
+	require.NoError(t, err)
+	assert.Same(t, client, conn)
+	st.AssertExpectations(t)
+}
+
+func TestDialPortUnreachable(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.runtime = portDialerRuntime{rt}
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("DialPort", mock.Anything, "s1", 3000).Return(nil, ErrPortUnreachable)
+
+	_, err := mgr.DialPort(context.Background(), "s1", 3000)
+	assert.ErrorIs(t, err, ErrPortUnreachable)
+	st.AssertNotCalled(t, "UpdateSessionActivity", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDialPortUnsupported(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.DialPort(context.Background(), "s1", 3000)
+	assert.ErrorIs(t, err, ErrProxyUnsupported)
+}
+
+func TestDialPortNotFound(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "missing").Return(nil, nil)
+
+	_, err := mgr.DialPort(context.Background(), "missing", 3000)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
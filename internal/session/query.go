@@ -4,11 +4,12 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/p-arndt/sandkasten/internal/runtime"
 	"github.com/p-arndt/sandkasten/protocol"
 )
 
 func (m *Manager) Get(ctx context.Context, id string) (*SessionInfo, error) {
-	sess, err := m.store.GetSession(id)
+	sess, err := m.getOwnSession(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -17,18 +18,27 @@ func (m *Manager) Get(ctx context.Context, id string) (*SessionInfo, error) {
 	}
 
 	return &SessionInfo{
-		ID:          sess.ID,
-		Image:       sess.Image,
-		Status:      sess.Status,
-		Cwd:         sess.Cwd,
-		WorkspaceID: sess.WorkspaceID,
-		CreatedAt:   sess.CreatedAt,
-		ExpiresAt:   sess.ExpiresAt,
+		ID:            sess.ID,
+		Image:         sess.Image,
+		Status:        sess.Status,
+		Cwd:           sess.Cwd,
+		WorkspaceID:   publicWorkspaceID(sess.Tenant, sess.WorkspaceID),
+		ImageDigest:   sess.ImageDigest,
+		Hostname:      runtime.Hostname(sess.ID, sess.Hostname),
+		SharedChannel: publicWorkspaceID(sess.Tenant, sess.SharedChannel),
+		GroupID:       sess.GroupID,
+		MachineID:     runtime.MachineID(sess.ID),
+		Thrashing:     m.stats.isThrashing(sess.ID),
+		Labels:        sess.Labels,
+		CreatedAt:     sess.CreatedAt,
+		ExpiresAt:     sess.ExpiresAt,
+		Determinism:   decodeDeterminism(sess.Determinism),
+		CPU:           decodeCPU(sess.CPU),
 	}, nil
 }
 
 func (m *Manager) GetStats(ctx context.Context, id string) (*protocol.SessionStats, error) {
-	sess, err := m.store.GetSession(id)
+	sess, err := m.getOwnSession(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +49,7 @@ func (m *Manager) GetStats(ctx context.Context, id string) (*protocol.SessionSta
 }
 
 func (m *Manager) List(ctx context.Context) ([]SessionInfo, error) {
-	sessions, err := m.store.ListSessions()
+	sessions, err := m.store.ListTenantSessions(tenantFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -47,13 +57,22 @@ func (m *Manager) List(ctx context.Context) ([]SessionInfo, error) {
 	result := make([]SessionInfo, len(sessions))
 	for i, s := range sessions {
 		result[i] = SessionInfo{
-			ID:          s.ID,
-			Image:       s.Image,
-			Status:      s.Status,
-			Cwd:         s.Cwd,
-			WorkspaceID: s.WorkspaceID,
-			CreatedAt:   s.CreatedAt,
-			ExpiresAt:   s.ExpiresAt,
+			ID:            s.ID,
+			Image:         s.Image,
+			Status:        s.Status,
+			Cwd:           s.Cwd,
+			WorkspaceID:   publicWorkspaceID(s.Tenant, s.WorkspaceID),
+			ImageDigest:   s.ImageDigest,
+			Hostname:      runtime.Hostname(s.ID, s.Hostname),
+			SharedChannel: publicWorkspaceID(s.Tenant, s.SharedChannel),
+			GroupID:       s.GroupID,
+			MachineID:     runtime.MachineID(s.ID),
+			Thrashing:     m.stats.isThrashing(s.ID),
+			Labels:        s.Labels,
+			CreatedAt:     s.CreatedAt,
+			ExpiresAt:     s.ExpiresAt,
+			Determinism:   decodeDeterminism(s.Determinism),
+			CPU:           decodeCPU(s.CPU),
 		}
 	}
 
@@ -61,18 +80,21 @@ func (m *Manager) List(ctx context.Context) ([]SessionInfo, error) {
 }
 
 func (m *Manager) Destroy(ctx context.Context, sessionID string) error {
-	sess, err := m.store.GetSession(sessionID)
+	sess, err := m.getOwnSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
 	if sess == nil {
-		return fmt.Errorf("session not found: %s", sessionID)
+		return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
 	}
 
 	_ = m.store.UpdateSessionStatus(sessionID, "destroying")
+	m.RecordSessionUsage(ctx, sess)
+	m.BeforeDestroy(ctx, sess)
 	_ = m.runtime.Destroy(ctx, sessionID)
 	_ = m.store.UpdateSessionStatus(sessionID, "destroyed")
 	m.removeSessionLock(sessionID)
+	m.AfterDestroy(sess, DestroyReasonDestroyed)
 
 	return nil
 }
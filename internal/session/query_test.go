@@ -46,7 +46,7 @@ func TestListSuccess(t *testing.T) {
 	mgr, _, st := newTestManager()
 	now := time.Now().UTC()
 
-	st.On("ListSessions").Return([]*store.Session{
+	st.On("ListTenantSessions", "").Return([]*store.Session{
 		{ID: "s1", Image: "base", Status: "running", Cwd: "/workspace", CreatedAt: now, ExpiresAt: now.Add(5 * time.Minute)},
 		{ID: "s2", Image: "python", Status: "destroyed", Cwd: "/home", CreatedAt: now, ExpiresAt: now.Add(5 * time.Minute)},
 	}, nil)
@@ -61,7 +61,7 @@ func TestListSuccess(t *testing.T) {
 func TestListEmpty(t *testing.T) {
 	mgr, _, st := newTestManager()
 
-	st.On("ListSessions").Return([]*store.Session{}, nil)
+	st.On("ListTenantSessions", "").Return([]*store.Session{}, nil)
 
 	sessions, err := mgr.List(context.Background())
 	require.NoError(t, err)
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+// ErrRebaseUnsupported is returned by Rebase for runtimes that cannot keep a
+// session's files across a change of image.
+var ErrRebaseUnsupported = errors.New("session rebase not supported by runtime")
+
+// AuditActionRebased records a session restarted on another image.
+const AuditActionRebased = "session_rebased"
+
+// Rebase restarts a running session on image ("" = its current image, e.g.
+// to pick up a version pulled by image refresh), keeping the files it wrote.
+// Running processes and the shell are lost; the working directory is reset to
+// /workspace. If the session cannot start on image it is restarted on its old
+// one and the error is returned; if that fails too, it is marked crashed.
+func (m *Manager) Rebase(ctx context.Context, sessionID, image string) (*SessionInfo, error) {
+	rebaser, ok := m.runtime.(runtime.ImageRebaser)
+	if !ok {
+		return nil, ErrRebaseUnsupported
+	}
+	if m.Draining() {
+		return nil, ErrDraining
+	}
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if image == "" {
+		image = sess.Image
+	}
+	_, image, err = m.sessionImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	mu := m.sessionLock(sessionID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	info, err := m.restartOn(ctx, rebaser, sess, image)
+	if errors.Is(err, errors.ErrUnsupported) {
+		// Wrapping drivers refuse before stopping anything.
+		return nil, ErrRebaseUnsupported
+	}
+	if err != nil {
+		if _, rerr := m.restartOn(ctx, rebaser, sess, sess.Image); rerr != nil {
+			_ = m.store.UpdateSessionStatus(sessionID, "crashed")
+			return nil, fmt.Errorf("rebase to %s: %w (restart on %s: %v)", image, err, sess.Image, rerr)
+		}
+		return nil, fmt.Errorf("rebase to %s: %w", image, err)
+	}
+	m.recordAudit(sessionID, AuditActionRebased, fmt.Sprintf("%s (%s) -> %s (%s)", sess.Image, sess.ImageDigest, image, info.ImageDigest))
+	return m.Get(ctx, sessionID)
+}
+
+// restartOn restarts the sandbox of sess on image, re-applies its CPU tuning
+// and shared channel and records the new sandbox. Setup hooks only run for a new image.
+func (m *Manager) restartOn(ctx context.Context, rebaser runtime.ImageRebaser, sess *storemod.Session, image string) (*runtime.SessionInfo, error) {
+	info, err := rebaser.Rebase(ctx, runtime.CreateOpts{
+		SessionID:   sess.ID,
+		Image:       image,
+		WorkspaceID: sess.WorkspaceID,
+		Hostname:    sess.Hostname,
+		Determinism: decodeDeterminism(sess.Determinism),
+	})
+	if err != nil {
+		RecordCreateFailure(m.diag, CreateFailureSourceAPI, sess.ID, image, err)
+		return nil, err
+	}
+	// The new cgroup starts with the defaults.
+	if err := m.tuneCPU(ctx, sess.ID, decodeCPU(sess.CPU), false); err != nil {
+		return nil, err
+	}
+	if sess.SharedChannel != "" {
+		mounter, ok := m.runtime.(runtime.SharedChannelMounter)
+		if !ok {
+			return nil, fmt.Errorf("%w: not supported by runtime", ErrSharedChannelsDisabled)
+		}
+		if err := mounter.MountSharedChannel(ctx, sess.ID, sess.SharedChannel, int64(m.cfg.SharedChannels.SizeMB)<<20); err != nil {
+			return nil, fmt.Errorf("attach shared channel: %w", err)
+		}
+	}
+	if cmds := m.cfg.ImageSetup[image]; len(cmds) > 0 && image != sess.Image {
+		if err := RunSetupHooks(ctx, m.runtime, sess.ID, cmds, m.cfg.Defaults.MaxExecTimeoutMs); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.store.UpdateSessionImage(sess.ID, image, info.ImageDigest, info.InitPID, info.CgroupPath); err != nil {
+		return nil, err
+	}
+	// The new shell starts in /workspace.
+	m.extendSessionLease(sess.ID, "/workspace")
+	return info, nil
+}
@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rebaseRuntime adds runtime.ImageRebaser to the mock driver.
+type rebaseRuntime struct {
+	*MockRuntimeDriver
+}
+
+func (r rebaseRuntime) Rebase(ctx context.Context, opts runtime.CreateOpts) (*runtime.SessionInfo, error) {
+	args := r.Called(ctx, opts)
+	if info := args.Get(0); info != nil {
+		return info.(*runtime.SessionInfo), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func newRebaseManager() (*Manager, *MockRuntimeDriver, *MockSessionStore) {
+	rt := &MockRuntimeDriver{}
+	st := &MockSessionStore{}
+	return NewManager(testConfig(), st, rebaseRuntime{rt}, nil, nil), rt, st
+}
+
+func rebaseTo(image string) any {
+	return mock.MatchedBy(func(opts runtime.CreateOpts) bool { return opts.SessionID == "s1" && opts.Image == image })
+}
+
+func TestRebase_Unsupported(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	_, err := mgr.Rebase(context.Background(), "s1", "python")
+	assert.ErrorIs(t, err, ErrRebaseUnsupported)
+}
+
+func TestRebase(t *testing.T) {
+	mgr, rt, st := newRebaseManager()
+	sess := leasedSession("s1", time.Minute)
+	sess.Cwd = "/workspace/src"
+	sess.WorkspaceID = "ws"
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Rebase", mock.Anything, rebaseTo("python")).Return(&runtime.SessionInfo{
+		SessionID: "s1", InitPID: 42, CgroupPath: "/cgroup/s1", ImageDigest: "sha256:new",
+	}, nil)
+	st.On("UpdateSessionImage", "s1", "python", "sha256:new", 42, "/cgroup/s1").Return(nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.Anything).Return(nil)
+
+	_, err := mgr.Rebase(context.Background(), "s1", "python")
+	require.NoError(t, err)
+	rt.AssertCalled(t, "Rebase", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
+		return opts.WorkspaceID == "ws"
+	}))
+	st.AssertExpectations(t)
+}
+
+func TestRebase_FailureRestartsOldImage(t *testing.T) {
+	mgr, rt, st := newRebaseManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", time.Minute), nil)
+	rt.On("Rebase", mock.Anything, rebaseTo("python")).Return(nil, assert.AnError)
+	rt.On("Rebase", mock.Anything, rebaseTo("base")).Return(&runtime.SessionInfo{SessionID: "s1", InitPID: 43}, nil)
+	st.On("UpdateSessionImage", "s1", "base", "", 43, "").Return(nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.Anything).Return(nil)
+
+	_, err := mgr.Rebase(context.Background(), "s1", "python")
+	assert.ErrorIs(t, err, assert.AnError)
+	st.AssertExpectations(t)
+	st.AssertNotCalled(t, "UpdateSessionStatus", mock.Anything, mock.Anything)
+}
+
+func TestRebase_CrashedWhenOldImageFailsToo(t *testing.T) {
+	mgr, rt, st := newRebaseManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", time.Minute), nil)
+	rt.On("Rebase", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+	st.On("UpdateSessionStatus", "s1", "crashed").Return(nil)
+
+	_, err := mgr.Rebase(context.Background(), "s1", "python")
+	assert.ErrorIs(t, err, assert.AnError)
+	st.AssertCalled(t, "UpdateSessionStatus", "s1", "crashed")
+}
+
+func TestRebase_ImageNotAllowed(t *testing.T) {
+	mgr, rt, st := newRebaseManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", time.Minute), nil)
+
+	_, err := mgr.Rebase(context.Background(), "s1", "evil-image")
+	assert.ErrorIs(t, err, ErrInvalidImage)
+	rt.AssertNotCalled(t, "Rebase", mock.Anything, mock.Anything)
+}
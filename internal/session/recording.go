@@ -0,0 +1,160 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultRecordingOutputBytes = 64 * 1024
+
+// RecordingEntry is one exec in a session transcript.
+type RecordingEntry struct {
+	Seq             int       `json:"seq"`
+	Type            string    `json:"type"`
+	Cmd             string    `json:"cmd"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationMs      int64     `json:"duration_ms"`
+	ExitCode        int       `json:"exit_code"`
+	Cwd             string    `json:"cwd,omitempty"`
+	Output          string    `json:"output,omitempty"`
+	OutputTruncated bool      `json:"output_truncated,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Recording is the full transcript of a session.
+type Recording struct {
+	SessionID string           `json:"session_id"`
+	Entries   []RecordingEntry `json:"entries"`
+}
+
+func (m *Manager) recordingPath(sessionID string) string {
+	return filepath.Join(m.cfg.DataDir, "recordings", sessionID+".jsonl")
+}
+
+// recordExec appends an exec to the session transcript. Recording is best
+// effort: a failure to write must not fail the exec itself.
+func (m *Manager) recordExec(sessionID, cmd string, started time.Time, result *ExecResult, execErr error) {
+	if !m.cfg.Recording.Enabled {
+		return
+	}
+
+	entry := RecordingEntry{
+		Type:       "exec",
+		Cmd:        cmd,
+		StartedAt:  started.UTC(),
+		DurationMs: time.Since(started).Milliseconds(),
+		ExitCode:   -1,
+	}
+	if execErr != nil {
+		entry.Error = execErr.Error()
+	}
+	if result != nil {
+		entry.ExitCode = result.ExitCode
+		entry.Cwd = result.Cwd
+		entry.DurationMs = result.DurationMs
+		entry.Output = result.Output
+		entry.OutputTruncated = result.Truncated
+	}
+	limit := m.cfg.Recording.MaxOutputBytes
+	if limit <= 0 {
+		limit = defaultRecordingOutputBytes
+	}
+	if len(entry.Output) > limit {
+		entry.Output = entry.Output[:limit]
+		entry.OutputTruncated = true
+	}
+
+	m.recordingMu.Lock()
+	defer m.recordingMu.Unlock()
+
+	path := m.recordingPath(sessionID)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	seq, ok := m.recordingSeq[sessionID]
+	if !ok {
+		seq = countLines(path)
+	}
+	entry.Seq = seq + 1
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err == nil {
+		m.recordingSeq[sessionID] = entry.Seq
+	}
+}
+
+// GetRecording returns the transcript of a session. Transcripts outlive the
+// session so they can be reviewed after destroy; once its row is gone too,
+// only the default tenant can read it.
+func (m *Manager) GetRecording(ctx context.Context, sessionID string) (*Recording, error) {
+	rec := &Recording{SessionID: sessionID, Entries: []RecordingEntry{}}
+
+	sess, err := m.store.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tenant := tenantFrom(ctx)
+	if sess != nil && sess.Tenant != tenant || sess == nil && tenant != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	f, err := os.Open(m.recordingPath(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		if sess == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+		}
+		return rec, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e RecordingEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip a torn trailing line
+		}
+		rec.Entries = append(rec.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	return rec, nil
+}
+
+func countLines(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	n := 0
+	buf := make([]byte, 32*1024)
+	for {
+		c, err := f.Read(buf)
+		for _, b := range buf[:c] {
+			if b == '\n' {
+				n++
+			}
+		}
+		if err != nil {
+			return n
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecRecording(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.cfg.Recording.Enabled = true
+	mgr.cfg.Recording.MaxOutputBytes = 4
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace", Output: "hello\n", DurationMs: 3,
+	}, nil).Once()
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type: protocol.ResponseExec, ExitCode: -1, Output: "timeout: command exceeded 10ms",
+	}, nil).Once()
+
+	_, err := mgr.Exec(context.Background(), "s1", "echo hello", ExecOpts{})
+	require.NoError(t, err)
+	_, err = mgr.Exec(context.Background(), "s1", "sleep 10", ExecOpts{TimeoutMs: 10})
+	require.ErrorIs(t, err, ErrTimeout)
+
+	rec, err := mgr.GetRecording(context.Background(), "s1")
+	require.NoError(t, err)
+	require.Len(t, rec.Entries, 2)
+	assert.Equal(t, 1, rec.Entries[0].Seq)
+	assert.Equal(t, "echo hello", rec.Entries[0].Cmd)
+	assert.Equal(t, "hell", rec.Entries[0].Output)
+	assert.True(t, rec.Entries[0].OutputTruncated)
+	assert.Equal(t, 2, rec.Entries[1].Seq)
+	assert.Contains(t, rec.Entries[1].Error, "timeout")
+}
+
+func TestGetRecordingEmpty(t *testing.T) {
+	mgr, _, st := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("GetSession", "missing").Return(nil, nil)
+
+	rec, err := mgr.GetRecording(context.Background(), "s1")
+	require.NoError(t, err)
+	assert.Empty(t, rec.Entries)
+
+	_, err = mgr.GetRecording(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
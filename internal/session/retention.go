@@ -0,0 +1,138 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// AuditActionWorkspaceExpired records a workspace deleted by the retention
+// janitor.
+const AuditActionWorkspaceExpired = "workspace_expired"
+
+// IdleWorkspace is a workspace past workspace.retention_days.
+type IdleWorkspace struct {
+	ID         string    `json:"id"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IdleDays   int       `json:"idle_days"`
+
+	dirID string
+}
+
+// WorkspaceRetentionReport lists the workspaces the retention janitor deletes
+// (or, in dry-run mode, would delete) on its next pass.
+type WorkspaceRetentionReport struct {
+	RetentionDays int              `json:"retention_days"` // 0 = retention off
+	DryRun        bool             `json:"dry_run"`
+	Workspaces    []*IdleWorkspace `json:"workspaces"`
+}
+
+// WorkspaceRetention reports the caller's workspaces that are past the
+// retention period. It never deletes anything.
+func (m *Manager) WorkspaceRetention(ctx context.Context) (*WorkspaceRetentionReport, error) {
+	if !m.cfg.Workspace.Enabled {
+		return nil, fmt.Errorf("workspaces not enabled")
+	}
+	report := &WorkspaceRetentionReport{
+		RetentionDays: m.cfg.Workspace.RetentionDays,
+		DryRun:        m.cfg.Workspace.RetentionDryRun,
+		Workspaces:    []*IdleWorkspace{},
+	}
+	if report.RetentionDays == 0 {
+		return report, nil
+	}
+	idle, err := m.idleWorkspaces(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	tenant := tenantFrom(ctx)
+	for _, w := range idle {
+		if workspaceVisible(tenant, w.dirID) {
+			w.ID = publicWorkspaceID(tenant, w.dirID)
+			report.Workspaces = append(report.Workspaces, w)
+		}
+	}
+	return report, nil
+}
+
+// PurgeIdleWorkspaces deletes the workspaces of all tenants past the
+// retention period and returns how many were deleted. It does nothing when
+// retention is off or in dry-run mode.
+func (m *Manager) PurgeIdleWorkspaces(ctx context.Context) (int, error) {
+	if !m.cfg.Workspace.Enabled || m.cfg.Workspace.RetentionDays == 0 || m.cfg.Workspace.RetentionDryRun {
+		return 0, nil
+	}
+	idle, err := m.idleWorkspaces(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, w := range idle {
+		if err := m.deleteWorkspaceDir(ctx, w.dirID); err != nil {
+			return deleted, err
+		}
+		deleted++
+		m.recordAudit("", AuditActionWorkspaceExpired, fmt.Sprintf("workspace %s idle for %d days", w.dirID, w.IdleDays))
+	}
+	return deleted, nil
+}
+
+// WorkspaceJanitor runs PurgeIdleWorkspaces, PurgeTrash and
+// RefreshWorkspaceSizes once and returns their errors joined.
+func (m *Manager) WorkspaceJanitor(ctx context.Context) error {
+	_, errIdle := m.PurgeIdleWorkspaces(ctx)
+	_, errTrash := m.PurgeTrash(ctx)
+	return errors.Join(errIdle, errTrash, m.RefreshWorkspaceSizes(ctx))
+}
+
+// idleWorkspaces returns the workspaces of all tenants that no session is
+// using and that were last used more than retention_days before now, oldest
+// first. A workspace was last used when a session using it was last active,
+// or when its directory last changed, whichever is later.
+func (m *Manager) idleWorkspaces(now time.Time) ([]*IdleWorkspace, error) {
+	entries, err := os.ReadDir(filepath.Join(m.cfg.DataDir, "workspaces"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read workspaces dir: %w", err)
+	}
+	usage, err := m.store.WorkspaceUsage()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.Add(-time.Duration(m.cfg.Workspace.RetentionDays) * 24 * time.Hour)
+	var idle []*IdleWorkspace
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		use := usage[entry.Name()]
+		if use.InUse {
+			continue
+		}
+		lastUsed := info.ModTime().UTC()
+		if use.LastActivity.After(lastUsed) {
+			lastUsed = use.LastActivity.UTC()
+		}
+		if lastUsed.After(cutoff) {
+			continue
+		}
+		idle = append(idle, &IdleWorkspace{
+			ID:         entry.Name(),
+			LastUsedAt: lastUsed,
+			IdleDays:   int(now.Sub(lastUsed) / (24 * time.Hour)),
+			dirID:      entry.Name(),
+		})
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].LastUsedAt.Before(idle[j].LastUsedAt) })
+	return idle, nil
+}
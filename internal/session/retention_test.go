@@ -0,0 +1,79 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetentionManager sets up workspaces "old" and "in-use" (untouched for
+// 40 days), "recently-used" (dir untouched for 40 days, last session a day
+// ago) and "fresh", with a 30 day retention.
+func newRetentionManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	mgr, _, st := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.cfg.Workspace.Enabled = true
+	mgr.cfg.Workspace.RetentionDays = 30
+
+	root := filepath.Join(mgr.cfg.DataDir, "workspaces")
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, id := range []string{"old", "in-use", "recently-used", "fresh"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, id), 0755))
+		if id != "fresh" {
+			require.NoError(t, os.Chtimes(filepath.Join(root, id), old, old))
+		}
+	}
+	st.On("WorkspaceUsage").Return(map[string]store.WorkspaceUse{
+		"old":           {LastActivity: old.Add(-time.Hour)},
+		"in-use":        {LastActivity: old, InUse: true},
+		"recently-used": {LastActivity: time.Now().Add(-24 * time.Hour)},
+	}, nil)
+	return mgr, root
+}
+
+func TestWorkspaceRetention_Report(t *testing.T) {
+	mgr, root := newRetentionManager(t)
+	mgr.cfg.Workspace.RetentionDryRun = true
+
+	report, err := mgr.WorkspaceRetention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 30, report.RetentionDays)
+	assert.True(t, report.DryRun)
+	require.Len(t, report.Workspaces, 1)
+	assert.Equal(t, "old", report.Workspaces[0].ID)
+	assert.Equal(t, 40, report.Workspaces[0].IdleDays)
+
+	// Dry-run never deletes.
+	n, err := mgr.PurgeIdleWorkspaces(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.DirExists(t, filepath.Join(root, "old"))
+}
+
+func TestWorkspaceRetention_Off(t *testing.T) {
+	mgr, _ := newRetentionManager(t)
+	mgr.cfg.Workspace.RetentionDays = 0
+
+	report, err := mgr.WorkspaceRetention(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Workspaces)
+}
+
+func TestPurgeIdleWorkspaces(t *testing.T) {
+	mgr, root := newRetentionManager(t)
+
+	n, err := mgr.PurgeIdleWorkspaces(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoDirExists(t, filepath.Join(root, "old"))
+	for _, id := range []string{"in-use", "recently-used", "fresh"} {
+		assert.DirExists(t, filepath.Join(root, id))
+	}
+}
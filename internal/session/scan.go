@@ -0,0 +1,109 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/scan"
+)
+
+// Audit actions for the content scan hook.
+const (
+	AuditActionScanClean       = "scan_clean"
+	AuditActionScanRejected    = "scan_rejected"
+	AuditActionScanQuarantined = "scan_quarantined"
+	AuditActionScanError       = "scan_error"
+)
+
+// scanEnabledFor reports whether writes into workspaceID must be scanned.
+// Per-workspace overrides win over the global switch.
+func (m *Manager) scanEnabledFor(workspaceID string) bool {
+	if m.scanner == nil {
+		return false
+	}
+	if workspaceID != "" {
+		if v, ok := m.cfg.Scan.Workspaces[workspaceID]; ok {
+			return v
+		}
+	}
+	return m.cfg.Scan.Enabled
+}
+
+// scanContent runs the scan hook on a pending write. content is decoded first
+// when isBase64 is set. It returns ErrScanRejected for reject/quarantine verdicts.
+func (m *Manager) scanContent(ctx context.Context, sessionID, workspaceID, path string, content []byte, isBase64 bool) error {
+	if !m.scanEnabledFor(workspaceID) {
+		return nil
+	}
+
+	data := content
+	if isBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(string(content))
+		if err != nil {
+			return fmt.Errorf("invalid base64 content: %w", err)
+		}
+		data = decoded
+	}
+
+	res, err := m.scanner.Scan(ctx, scan.Request{
+		Path:        path,
+		SessionID:   sessionID,
+		WorkspaceID: workspaceID,
+		Content:     data,
+	})
+	if err != nil {
+		m.recordAudit(sessionID, AuditActionScanError, fmt.Sprintf("path=%s workspace=%s error=%v", path, workspaceID, err))
+		if m.cfg.Scan.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("%w: scanner unavailable", ErrScanRejected)
+	}
+
+	switch res.Verdict {
+	case scan.VerdictClean:
+		m.recordAudit(sessionID, AuditActionScanClean, fmt.Sprintf("path=%s workspace=%s", path, workspaceID))
+		return nil
+	case scan.VerdictQuarantine:
+		m.quarantine(sessionID, workspaceID, path, data, res)
+		return fmt.Errorf("%w: %s (quarantined)", ErrScanRejected, res.Reason)
+	default:
+		if m.cfg.Scan.Quarantine {
+			m.quarantine(sessionID, workspaceID, path, data, res)
+			return fmt.Errorf("%w: %s (quarantined)", ErrScanRejected, res.Reason)
+		}
+		m.recordAudit(sessionID, AuditActionScanRejected, fmt.Sprintf("path=%s workspace=%s reason=%s", path, workspaceID, res.Reason))
+		return fmt.Errorf("%w: %s", ErrScanRejected, res.Reason)
+	}
+}
+
+// quarantine stores rejected content under data_dir/quarantine for review.
+// The file is never placed in a sandbox or workspace.
+func (m *Manager) quarantine(sessionID, workspaceID, path string, data []byte, res scan.Result) {
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%d-%s", time.Now().UTC().Unix(), hex.EncodeToString(sum[:8]))
+	dir := filepath.Join(m.cfg.DataDir, "quarantine")
+
+	detail := fmt.Sprintf("path=%s workspace=%s reason=%s file=%s", path, workspaceID, res.Reason, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		detail += " store_error=" + err.Error()
+	} else if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		detail += " store_error=" + err.Error()
+	} else {
+		meta, _ := json.Marshal(map[string]string{
+			"path":         path,
+			"session_id":   sessionID,
+			"workspace_id": workspaceID,
+			"reason":       res.Reason,
+			"sha256":       hex.EncodeToString(sum[:]),
+		})
+		_ = os.WriteFile(filepath.Join(dir, name+".json"), meta, 0600)
+	}
+	m.recordAudit(sessionID, AuditActionScanQuarantined, detail)
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newScanManager(t *testing.T, scanCfg config.ScanConfig) (*Manager, *MockContentScanner, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{DataDir: dir, Workspace: config.WorkspaceConfig{Enabled: true}, Scan: scanCfg}
+	mgr := NewManager(cfg, nil, nil, nil, nil)
+	sc := &MockContentScanner{}
+	mgr.SetScanner(sc)
+	return mgr, sc, dir
+}
+
+func TestWriteWorkspaceFile_ScanRejected(t *testing.T) {
+	mgr, sc, dir := newScanManager(t, config.ScanConfig{Enabled: true})
+	sc.On("Scan", mock.Anything, mock.MatchedBy(func(r scan.Request) bool {
+		return r.WorkspaceID == "ws" && r.Path == "bad.sh" && string(r.Content) == "evil"
+	})).Return(scan.Result{Verdict: scan.VerdictReject, Reason: "signature"}, nil)
+
+	err := mgr.WriteWorkspaceFile(context.Background(), "ws", "bad.sh", []byte("evil"), false)
+	assert.ErrorIs(t, err, ErrScanRejected)
+
+	_, statErr := os.Stat(filepath.Join(dir, "workspaces", "ws", "bad.sh"))
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func TestWriteWorkspaceFile_ScanQuarantine(t *testing.T) {
+	mgr, sc, dir := newScanManager(t, config.ScanConfig{Enabled: true})
+	sc.On("Scan", mock.Anything, mock.Anything).Return(scan.Result{Verdict: scan.VerdictQuarantine, Reason: "secret"}, nil)
+
+	err := mgr.WriteWorkspaceFile(context.Background(), "ws", ".env", []byte("TOKEN=x"), false)
+	assert.ErrorIs(t, err, ErrScanRejected)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "quarantine"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2) // content + metadata
+}
+
+func TestWriteWorkspaceFile_ScanDisabledForWorkspace(t *testing.T) {
+	mgr, sc, _ := newScanManager(t, config.ScanConfig{Enabled: true, Workspaces: map[string]bool{"trusted": false}})
+
+	err := mgr.WriteWorkspaceFile(context.Background(), "trusted", "a.txt", []byte("x"), false)
+	require.NoError(t, err)
+	sc.AssertNotCalled(t, "Scan", mock.Anything, mock.Anything)
+}
+
+func TestScanContent_FailOpen(t *testing.T) {
+	mgr, sc, _ := newScanManager(t, config.ScanConfig{Enabled: true, FailOpen: true})
+	sc.On("Scan", mock.Anything, mock.Anything).Return(scan.Result{}, errors.New("scanner down"))
+
+	assert.NoError(t, mgr.scanContent(context.Background(), "s1", "", "a.txt", []byte("x"), false))
+
+	mgr.cfg.Scan.FailOpen = false
+	assert.ErrorIs(t, mgr.scanContent(context.Background(), "s1", "", "a.txt", []byte("x"), false), ErrScanRejected)
+}
+
+func TestWrite_ScanDecodesBase64(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	sc := &MockContentScanner{}
+	mgr.cfg.Scan.Enabled = true
+	mgr.SetScanner(sc)
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	sc.On("Scan", mock.Anything, mock.MatchedBy(func(r scan.Request) bool {
+		return string(r.Content) == "hello" && r.SessionID == "s1"
+	})).Return(scan.Result{Verdict: scan.VerdictReject}, nil)
+
+	err := mgr.Write(context.Background(), "s1", "a.txt", []byte("aGVsbG8="), true)
+	assert.ErrorIs(t, err, ErrScanRejected)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+}
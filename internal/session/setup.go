@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// setupOutputTail is how much of a failed hook command's output is kept in
+// the error.
+const setupOutputTail = 512
+
+// RunSetupHooks runs the image_setup commands of a new session in order,
+// before it is handed out or pooled. A failing hook fails the create.
+func RunSetupHooks(ctx context.Context, rt runtime.Driver, sessionID string, cmds []string, timeoutMs int) error {
+	if err := runHookCommands(ctx, rt, sessionID, cmds, timeoutMs); err != nil {
+		return &runtime.CreateError{
+			Stage: "setup_hook",
+			Class: runtime.CreateFailureOther,
+			Err:   fmt.Errorf("setup %w", err),
+		}
+	}
+	return nil
+}
+
+// runHookCommands runs operator hook commands in a session, stopping at the
+// first that fails. Each runs in a subshell so the session shell keeps its
+// cwd and environment.
+func runHookCommands(ctx context.Context, rt hookExecer, sessionID string, cmds []string, timeoutMs int) error {
+	for _, cmd := range cmds {
+		resp, err := rt.Exec(ctx, sessionID, protocol.Request{
+			ID:        uuid.New().String()[:8],
+			Type:      protocol.RequestExec,
+			Cmd:       "(\n" + cmd + "\n)",
+			TimeoutMs: timeoutMs,
+			Truncate:  protocol.TruncateHeadTail,
+		})
+		if err == nil && resp.Type == protocol.ResponseError {
+			err = fmt.Errorf("runner error: %s", resp.Error)
+		}
+		if err == nil && resp.ExitCode != 0 {
+			out := resp.Output
+			if len(out) > setupOutputTail {
+				out = out[len(out)-setupOutputTail:]
+			}
+			err = fmt.Errorf("exit code %d: %s", resp.ExitCode, out)
+		}
+		if err != nil {
+			return fmt.Errorf("hook %q: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+// hookExecer is the part of the runtime hook commands need.
+type hookExecer interface {
+	Exec(ctx context.Context, sessionID string, req protocol.Request) (*protocol.Response, error)
+}
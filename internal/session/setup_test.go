@@ -0,0 +1,54 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func isSetupHook(cmd string) interface{} {
+	return mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && strings.Contains(req.Cmd, cmd)
+	})
+}
+
+func TestCreate_RunsImageSetupHooks(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.ImageSetup = map[string][]string{"base": {"warm-a", "warm-b"}}
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{SessionID: "test-session"}, nil)
+	rt.On("Exec", mock.Anything, mock.AnythingOfType("string"), isSetupHook("warm-a")).Return(&protocol.Response{Type: protocol.ResponseExec}, nil).Once()
+	rt.On("Exec", mock.Anything, mock.AnythingOfType("string"), isSetupHook("warm-b")).Return(&protocol.Response{Type: protocol.ResponseExec}, nil).Once()
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "base", info.Image)
+	rt.AssertExpectations(t)
+}
+
+func TestCreate_SetupHookFailureDestroysSession(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.ImageSetup = map[string][]string{"base": {"warm-a", "warm-b"}}
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{SessionID: "test-session"}, nil)
+	rt.On("Exec", mock.Anything, mock.AnythingOfType("string"), isSetupHook("warm-a")).Return(&protocol.Response{Type: protocol.ResponseExec, ExitCode: 1, Output: "ModuleNotFoundError"}, nil)
+	rt.On("Destroy", mock.Anything, mock.AnythingOfType("string")).Return(nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ModuleNotFoundError")
+	var ce *runtime.CreateError
+	require.True(t, errors.As(err, &ce))
+	assert.Equal(t, "setup_hook", ce.Stage)
+	rt.AssertCalled(t, "Destroy", mock.Anything, mock.AnythingOfType("string"))
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, isSetupHook("warm-b"))
+	st.AssertNotCalled(t, "CreateSession", mock.Anything)
+}
@@ -0,0 +1,171 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// Audit actions recorded when a session's memory pressure crosses
+// stats.thrashing_pressure.
+const (
+	AuditActionThrashing      = "session_thrashing"
+	AuditActionThrashingEnded = "session_thrashing_ended"
+)
+
+// StatsSample is one entry of a session's stats history.
+type StatsSample struct {
+	Time time.Time `json:"time"`
+	protocol.SessionStats
+}
+
+// StatsHistory is the recent stats of a session, oldest sample first.
+type StatsHistory struct {
+	SessionID       string        `json:"session_id"`
+	IntervalSeconds int           `json:"interval_seconds"`
+	Thrashing       bool          `json:"thrashing"`
+	Samples         []StatsSample `json:"samples"`
+}
+
+// statsHistory keeps the sampled stats of running sessions in memory. The
+// zero value is ready to use.
+type statsHistory struct {
+	mu        sync.Mutex
+	samples   map[string][]StatsSample
+	thrashing map[string]bool
+}
+
+// add appends a sample, keeping at most limit per session.
+func (h *statsHistory) add(id string, s StatsSample, limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.samples == nil {
+		h.samples = make(map[string][]StatsSample)
+	}
+	samples := append(h.samples[id], s)
+	if len(samples) > limit {
+		samples = samples[len(samples)-limit:]
+	}
+	h.samples[id] = samples
+}
+
+// setThrashing records whether id is thrashing and returns the previous state.
+func (h *statsHistory) setThrashing(id string, thrashing bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.thrashing == nil {
+		h.thrashing = make(map[string]bool)
+	}
+	was := h.thrashing[id]
+	if thrashing {
+		h.thrashing[id] = true
+	} else {
+		delete(h.thrashing, id)
+	}
+	return was
+}
+
+func (h *statsHistory) isThrashing(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.thrashing[id]
+}
+
+// lastOOMKills returns the OOM kill count of the newest sample of id, or 0.
+func (h *statsHistory) lastOOMKills(id string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := h.samples[id]
+	if len(samples) == 0 {
+		return 0
+	}
+	return samples[len(samples)-1].OOMKills
+}
+
+// get returns a copy of the samples of id.
+func (h *statsHistory) get(id string) []StatsSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]StatsSample{}, h.samples[id]...)
+}
+
+// prune forgets every session not in live.
+func (h *statsHistory) prune(live map[string]bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id := range h.samples {
+		if !live[id] {
+			delete(h.samples, id)
+		}
+	}
+	for id := range h.thrashing {
+		if !live[id] {
+			delete(h.thrashing, id)
+		}
+	}
+}
+
+// SampleStats takes one stats sample of every running session and forgets
+// sessions that are no longer running. The daemon runs it every
+// stats.history_interval_seconds.
+func (m *Manager) SampleStats(ctx context.Context) error {
+	sessions, err := m.store.ListRunningSessions()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	limit := max(m.cfg.Stats.HistorySamples, 1)
+	live := make(map[string]bool, len(sessions))
+	for _, sess := range sessions {
+		live[sess.ID] = true
+		stats, err := m.runtime.Stats(ctx, sess.ID)
+		if err != nil {
+			continue
+		}
+		prevOOM := m.stats.lastOOMKills(sess.ID)
+		m.stats.add(sess.ID, StatsSample{Time: now, SessionStats: *stats}, limit)
+		m.updateThrashing(sess.ID, stats)
+		m.checkOOM(sess, prevOOM, stats)
+	}
+	m.stats.prune(live)
+	return nil
+}
+
+// updateThrashing flags the session while its memory pressure is at or above
+// stats.thrashing_pressure and records an audit event when that changes.
+func (m *Manager) updateThrashing(id string, stats *protocol.SessionStats) {
+	threshold := m.cfg.Stats.ThrashingPressure
+	if threshold <= 0 || stats.MemoryPressure == nil {
+		return
+	}
+	pressure := stats.MemoryPressure.SomeAvg10
+	thrashing := pressure >= threshold
+	was := m.stats.setThrashing(id, thrashing)
+	switch {
+	case thrashing && !was:
+		m.recordAudit(id, AuditActionThrashing, fmt.Sprintf("memory pressure %.1f%% >= %g%%", pressure, threshold))
+	case !thrashing && was:
+		m.recordAudit(id, AuditActionThrashingEnded, fmt.Sprintf("memory pressure %.1f%%", pressure))
+	}
+}
+
+// GetStatsHistory returns the sampled stats of a session. It is empty when
+// sampling is off (stats.history_interval_seconds: 0) or has not run yet.
+func (m *Manager) GetStatsHistory(ctx context.Context, id string) (*StatsHistory, error) {
+	sess, err := m.getOwnSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return &StatsHistory{
+		SessionID:       sess.ID,
+		IntervalSeconds: m.cfg.Stats.HistoryIntervalSeconds,
+		Thrashing:       m.stats.isThrashing(sess.ID),
+		Samples:         m.stats.get(sess.ID),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/notify"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func memPressure(avg10 float64) *protocol.SessionStats {
+	return &protocol.SessionStats{MemoryBytes: 1 << 20, MemoryPressure: &protocol.Pressure{SomeAvg10: avg10}}
+}
+
+func TestSampleStats_KeepsBoundedHistory(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Stats.HistoryIntervalSeconds = 15
+	mgr.cfg.Stats.HistorySamples = 2
+
+	sess := &store.Session{ID: "s1", Status: "running"}
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil)
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(1), nil).Once()
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(2), nil).Once()
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(3), nil).Once()
+
+	for range 3 {
+		mgr.SampleStats(context.Background())
+	}
+
+	hist, err := mgr.GetStatsHistory(context.Background(), "s1")
+	require.NoError(t, err)
+	assert.Equal(t, 15, hist.IntervalSeconds)
+	require.Len(t, hist.Samples, 2)
+	assert.Equal(t, 2.0, hist.Samples[0].MemoryPressure.SomeAvg10)
+	assert.Equal(t, 3.0, hist.Samples[1].MemoryPressure.SomeAvg10)
+	assert.False(t, hist.Thrashing, "no threshold configured")
+}
+
+func TestSampleStats_FlagsThrashingAndRecordsEvents(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Stats.HistorySamples = 10
+	mgr.cfg.Stats.ThrashingPressure = 50
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+
+	sess := &store.Session{ID: "s1", Image: "python", Status: "running"}
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil)
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(72.34), nil).Twice()
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(10), nil).Once()
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.Action == AuditActionThrashing && ev.Detail == "memory pressure 72.3% >= 50%"
+	})).Return(nil).Once()
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.Action == AuditActionThrashingEnded
+	})).Return(nil).Once()
+
+	mgr.SampleStats(context.Background())
+	info, err := mgr.Get(context.Background(), "s1")
+	require.NoError(t, err)
+	assert.True(t, info.Thrashing)
+
+	// Still thrashing: no second event.
+	mgr.SampleStats(context.Background())
+	mgr.SampleStats(context.Background())
+	info, err = mgr.Get(context.Background(), "s1")
+	require.NoError(t, err)
+	assert.False(t, info.Thrashing)
+	audit.AssertExpectations(t)
+}
+
+func TestSampleStats_ForgetsStoppedSessions(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Stats.HistorySamples = 10
+	mgr.cfg.Stats.ThrashingPressure = 50
+
+	sess := &store.Session{ID: "s1", Status: "running"}
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil).Once()
+	st.On("ListRunningSessions").Return([]*store.Session{}, nil).Once()
+	st.On("GetSession", "s1").Return(sess, nil)
+	rt.On("Stats", mock.Anything, "s1").Return(memPressure(90), nil)
+
+	mgr.SampleStats(context.Background())
+	assert.True(t, mgr.stats.isThrashing("s1"))
+
+	mgr.SampleStats(context.Background())
+	assert.False(t, mgr.stats.isThrashing("s1"))
+	hist, err := mgr.GetStatsHistory(context.Background(), "s1")
+	require.NoError(t, err)
+	assert.Empty(t, hist.Samples)
+}
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (n *recordingNotifier) Notify(ev notify.Event) {
+	n.events = append(n.events, ev)
+}
+
+func TestSampleStats_NotifiesOOMKills(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Stats.HistorySamples = 10
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+	n := &recordingNotifier{}
+	mgr.SetNotifier(n)
+
+	sess := &store.Session{ID: "s1", Image: "python", Status: "running"}
+	st.On("ListRunningSessions").Return([]*store.Session{sess}, nil)
+	oom := func(kills int64) *protocol.SessionStats {
+		return &protocol.SessionStats{MemoryLimit: 512 << 20, OOMKills: kills}
+	}
+	rt.On("Stats", mock.Anything, "s1").Return(oom(0), nil).Once()
+	rt.On("Stats", mock.Anything, "s1").Return(oom(2), nil).Twice()
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.Action == AuditActionOOMKilled && ev.Detail == "2 process(es) killed for running out of memory"
+	})).Return(nil).Once()
+
+	for range 3 {
+		mgr.SampleStats(context.Background())
+	}
+
+	require.Len(t, n.events, 1, "only new kills are reported")
+	ev := n.events[0]
+	assert.Equal(t, notify.EventSessionOOM, ev.Type)
+	assert.Equal(t, "s1", ev.SessionID)
+	assert.Equal(t, map[string]string{"image": "python", "oom_kills": "2", "memory_limit_mb": "512"}, ev.Fields)
+	audit.AssertExpectations(t)
+}
+
+func TestGetStatsHistory_NotFound(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "missing").Return(nil, nil)
+
+	_, err := mgr.GetStatsHistory(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+type tenantKey struct{}
+
+// tenantWorkspaceSep joins tenant and workspace ID in the directory names of
+// tenant workspaces. Workspace IDs cannot contain it, so the default tenant
+// cannot address a tenant's directory.
+const tenantWorkspaceSep = "_"
+
+// WithTenant scopes ctx to tenant: sessions created with it belong to the
+// tenant, other tenants' sessions look like missing ones, and workspace IDs
+// resolve inside the tenant's namespace. "" is the default tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantFrom(ctx context.Context) string {
+	v, _ := ctx.Value(tenantKey{}).(string)
+	return v
+}
+
+// TenantFrom returns the tenant ctx was scoped to with WithTenant.
+func TenantFrom(ctx context.Context) string {
+	return tenantFrom(ctx)
+}
+
+// callerScope captures the API key and tenant of ctx, for operations that run
+// later on a fresh context (approved requests).
+func callerScope(ctx context.Context) func(context.Context) context.Context {
+	keyID, tenant := keyIDFrom(ctx), tenantFrom(ctx)
+	return func(ctx context.Context) context.Context {
+		return WithTenant(withKeyID(ctx, keyID), tenant)
+	}
+}
+
+// RequireDefaultTenant refuses tenant callers of host-wide views and
+// controls (audit log, usage, diagnostics, pool, jobs, health), whose data
+// spans tenants.
+func RequireDefaultTenant(ctx context.Context) error {
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return fmt.Errorf("%w: %s", ErrDefaultTenant, tenant)
+	}
+	return nil
+}
+
+// getOwnSession returns session id if it belongs to the caller's tenant, and
+// nil (not found) if it does not exist or belongs to another tenant.
+func (m *Manager) getOwnSession(ctx context.Context, id string) (*storemod.Session, error) {
+	sess, err := m.store.GetSession(id)
+	if err != nil || sess == nil {
+		return nil, err
+	}
+	if sess.Tenant != tenantFrom(ctx) {
+		return nil, nil
+	}
+	return sess, nil
+}
+
+// workspaceDirID maps the workspace ID a caller uses to its directory name
+// under data_dir/workspaces: "<tenant>_<id>" for tenants, "<id>" for the
+// default tenant.
+func (m *Manager) workspaceDirID(ctx context.Context, workspaceID string) (string, error) {
+	shortID := m.normalizeWorkspaceID(workspaceID)
+	if shortID == "" {
+		return "", fmt.Errorf("invalid workspace id")
+	}
+	if strings.Contains(shortID, tenantWorkspaceSep) {
+		return "", fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspaceID)
+	}
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return tenant + tenantWorkspaceSep + shortID, nil
+	}
+	return shortID, nil
+}
+
+// publicWorkspaceID is the inverse of workspaceDirID.
+func publicWorkspaceID(tenant, dirID string) string {
+	if tenant == "" {
+		return dirID
+	}
+	return strings.TrimPrefix(dirID, tenant+tenantWorkspaceSep)
+}
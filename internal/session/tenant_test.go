@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOtherTenantSessionNotFound(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	sess := runningSession("s1")
+	sess.Tenant = "acme"
+	st.On("GetSession", "s1").Return(sess, nil)
+
+	for _, ctx := range []context.Context{context.Background(), WithTenant(context.Background(), "globex")} {
+		_, err := mgr.Get(ctx, "s1")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = mgr.Exec(ctx, "s1", "ls", ExecOpts{})
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, mgr.Destroy(ctx, "s1"), ErrNotFound)
+	}
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+	rt.AssertNotCalled(t, "Destroy", mock.Anything, mock.Anything)
+
+	info, err := mgr.Get(WithTenant(context.Background(), "acme"), "s1")
+	require.NoError(t, err)
+	assert.Equal(t, "s1", info.ID)
+}
+
+func TestListScopedToTenant(t *testing.T) {
+	mgr, _, st := newTestManager()
+	sess := runningSession("s1")
+	sess.Tenant = "acme"
+	sess.WorkspaceID = "acme_data"
+	st.On("ListTenantSessions", "acme").Return([]*store.Session{sess}, nil)
+
+	sessions, err := mgr.List(WithTenant(context.Background(), "acme"))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "data", sessions[0].WorkspaceID)
+}
+
+func TestCreateTenantWorkspaceNamespaced(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.MatchedBy(func(opts runtime.CreateOpts) bool {
+		return opts.WorkspaceID == "acme_data"
+	})).Return(&runtime.SessionInfo{SessionID: "test-session"}, nil)
+	st.On("CreateSession", mock.MatchedBy(func(sess *store.Session) bool {
+		return sess.Tenant == "acme" && sess.WorkspaceID == "acme_data"
+	})).Return(nil)
+
+	info, err := mgr.Create(WithTenant(context.Background(), "acme"), CreateOpts{WorkspaceID: "data"})
+	require.NoError(t, err)
+	assert.Equal(t, "data", info.WorkspaceID)
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+func TestTenantWorkspacesIsolated(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{DataDir: dir, Workspace: config.WorkspaceConfig{Enabled: true}}
+	mgr := NewManager(cfg, nil, nil, nil, nil)
+	acme := WithTenant(context.Background(), "acme")
+
+	require.NoError(t, mgr.WriteWorkspaceFile(acme, "data", "a.txt", []byte("acme"), false))
+	require.NoError(t, mgr.WriteWorkspaceFile(context.Background(), "data", "a.txt", []byte("default"), false))
+
+	data, err := os.ReadFile(filepath.Join(dir, "workspaces", "acme_data", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", string(data))
+
+	list, err := mgr.ListWorkspaces(acme)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "data", list[0].ID)
+
+	list, err = mgr.ListWorkspaces(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "data", list[0].ID)
+
+	_, _, err = mgr.ReadWorkspaceFile(context.Background(), "acme_data", "a.txt", 0)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+	assert.ErrorIs(t, mgr.DeleteWorkspace(context.Background(), "acme_data"), ErrWorkspaceNotFound)
+
+	_, err = mgr.ListWorkspaceFiles(WithTenant(context.Background(), "globex"), "data", "")
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+}
+
+func TestTenantApprovalsHidden(t *testing.T) {
+	mgr, _, st := newTestManager()
+	q, err := NewApprovalQueue(config.ApprovalConfig{Enabled: true, ApproverKey: "approver", ExecPatterns: []string{`^rm `}}, "none")
+	require.NoError(t, err)
+	mgr.SetApprovals(q)
+	sess := runningSession("s1")
+	sess.Tenant = "acme"
+	st.On("GetSession", "s1").Return(sess, nil)
+
+	acme := WithTenant(context.Background(), "acme")
+	_, err = mgr.Exec(acme, "s1", "rm -rf build", ExecOpts{})
+	var pending *PendingApprovalError
+	require.ErrorAs(t, err, &pending)
+
+	list, err := mgr.ListApprovals(WithTenant(context.Background(), "globex"))
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = mgr.GetApproval(WithTenant(context.Background(), "globex"), pending.Approval.ID)
+	assert.ErrorIs(t, err, ErrApprovalNotFound)
+
+	list, err = mgr.ListApprovals(acme)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = mgr.ListApprovals(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestHostWideViewsDefaultTenantOnly(t *testing.T) {
+	mgr, _, _ := newTestManager()
+	audit, usage, diag := &MockAuditStore{}, &MockUsageStore{}, &MockDiagnosticsStore{}
+	mgr.SetAuditStore(audit)
+	mgr.SetUsageStore(usage)
+	mgr.SetDiagnosticsStore(diag)
+	audit.On("ListAuditEvents", "", 10).Return([]*store.AuditEvent{{SessionID: "globex-session"}}, nil)
+	usage.On("SummarizeUsage", "key", mock.Anything, mock.Anything).Return([]*store.UsageSummary{{Group: "globex-key"}}, nil)
+	diag.On("ListCreateFailures", 10).Return([]*store.CreateFailure{{SessionID: "globex-session"}}, nil)
+
+	acme := WithTenant(context.Background(), "acme")
+	_, err := mgr.ListAuditEvents(acme, "", 10)
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	_, err = mgr.SummarizeUsage(acme, "key", time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	_, err = mgr.ListCreateFailures(acme, 10)
+	assert.ErrorIs(t, err, ErrDefaultTenant)
+	audit.AssertNotCalled(t, "ListAuditEvents", mock.Anything, mock.Anything)
+	usage.AssertNotCalled(t, "SummarizeUsage", mock.Anything, mock.Anything, mock.Anything)
+	diag.AssertNotCalled(t, "ListCreateFailures", mock.Anything)
+
+	events, err := mgr.ListAuditEvents(context.Background(), "", 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	summary, err := mgr.SummarizeUsage(context.Background(), "key", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, summary, 1)
+	failures, err := mgr.ListCreateFailures(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Len(t, failures, 1)
+}
@@ -0,0 +1,39 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/p-arndt/sandkasten/protocol"
+)
+
+// Resize sets the terminal size of the session shell; 0 keeps the current
+// rows or cols. Wide tables and ncurses programs wrap at the terminal width.
+func (m *Manager) Resize(ctx context.Context, sessionID string, rows, cols int) error {
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := m.resizeTerminal(ctx, sess.ID, rows, cols); err != nil {
+		return err
+	}
+	m.extendSessionLease(sessionID, sess.Cwd)
+	return nil
+}
+
+func (m *Manager) resizeTerminal(ctx context.Context, sessionID string, rows, cols int) error {
+	resp, err := m.runtime.Exec(ctx, sessionID, protocol.Request{
+		ID:   uuid.New().String()[:8],
+		Type: protocol.RequestResize,
+		Rows: rows,
+		Cols: cols,
+	})
+	if err != nil {
+		return fmt.Errorf("resize: %w", err)
+	}
+	if resp.Type == protocol.ResponseError {
+		return fmt.Errorf("runner error: %s", resp.Error)
+	}
+	return nil
+}
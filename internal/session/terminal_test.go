@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func isResize(rows, cols int) interface{} {
+	return mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestResize && req.Rows == rows && req.Cols == cols
+	})
+}
+
+func TestResize(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", isResize(50, 200)).Return(&protocol.Response{Type: protocol.ResponseResize, OK: true}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	require.NoError(t, mgr.Resize(context.Background(), "s1", 50, 200))
+	rt.AssertExpectations(t)
+	st.AssertExpectations(t)
+}
+
+func TestResizeRunnerError(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", isResize(0, 70000)).Return(&protocol.Response{Type: protocol.ResponseError, Error: "cols out of range"}, nil)
+
+	err := mgr.Resize(context.Background(), "s1", 0, 70000)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cols out of range")
+	st.AssertNotCalled(t, "UpdateSessionActivity", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResizeNotFound(t *testing.T) {
+	mgr, _, st := newTestManager()
+
+	st.On("GetSession", "nonexistent").Return(nil, nil)
+
+	err := mgr.Resize(context.Background(), "nonexistent", 50, 200)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateWithTerminalSize(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{SessionID: "test-session"}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("Exec", mock.Anything, mock.AnythingOfType("string"), isResize(50, 200)).Return(&protocol.Response{Type: protocol.ResponseResize, OK: true}, nil)
+
+	info, err := mgr.Create(context.Background(), CreateOpts{Rows: 50, Cols: 200})
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	rt.AssertCalled(t, "Exec", mock.Anything, info.ID, isResize(50, 200))
+}
+
+func TestCreateResizeFailureDestroysSession(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{SessionID: "test-session"}, nil)
+	st.On("CreateSession", mock.AnythingOfType("*store.Session")).Return(nil)
+	rt.On("Exec", mock.Anything, mock.AnythingOfType("string"), isResize(50, 0)).Return(&protocol.Response{Type: protocol.ResponseError, Error: "no terminal"}, nil)
+	st.On("UpdateSessionStatus", mock.AnythingOfType("string"), "destroyed").Return(nil)
+	rt.On("Destroy", mock.Anything, mock.AnythingOfType("string")).Return(nil)
+
+	_, err := mgr.Create(context.Background(), CreateOpts{Rows: 50})
+	require.Error(t, err)
+	rt.AssertCalled(t, "Destroy", mock.Anything, mock.AnythingOfType("string"))
+}
@@ -0,0 +1,204 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// junitSuite is a <testsuite> or <testsuites> element of a JUnit XML report.
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string       `xml:"name,attr"`
+	Classname string       `xml:"classname,attr"`
+	Time      string       `xml:"time,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// parseJUnit reads the test cases of a JUnit XML report (pytest
+// --junitxml).
+func parseJUnit(data []byte) ([]TestCase, error) {
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var cases []TestCase
+	var walk func(s junitSuite)
+	walk = func(s junitSuite) {
+		for _, jc := range s.Cases {
+			c := TestCase{Name: jc.Name, Suite: jc.Classname, Status: TestPassed}
+			if secs, err := strconv.ParseFloat(jc.Time, 64); err == nil {
+				c.DurationMs = secondsToMs(secs)
+			}
+			var res *junitResult
+			switch {
+			case jc.Error != nil:
+				c.Status, res = TestError, jc.Error
+			case jc.Failure != nil:
+				c.Status, res = TestFailed, jc.Failure
+			case jc.Skipped != nil:
+				c.Status, res = TestSkipped, jc.Skipped
+			}
+			if res != nil {
+				c.Message = res.Message
+				c.Details = strings.TrimSpace(res.Text)
+			}
+			cases = append(cases, c)
+		}
+		for _, sub := range s.Suites {
+			walk(sub)
+		}
+	}
+	walk(root)
+	return cases, nil
+}
+
+// goTestEvent is a line of go test -json output.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+	// ImportPath and FailedBuild name the test binary of build output and
+	// of a package that did not build (Go 1.24 and later).
+	ImportPath  string
+	FailedBuild string
+}
+
+// parseGoTestJSON reads the test cases of go test -json output. A package
+// that failed without a failing test, e.g. because it did not build, is an
+// error case named after the package.
+func parseGoTestJSON(data []byte) ([]TestCase, error) {
+	var cases []TestCase
+	output := make(map[string]*strings.Builder) // package + test -> output
+	failedTests := make(map[string]bool)        // packages
+	events := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev goTestEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil || ev.Action == "" {
+			continue
+		}
+		events++
+		key := ev.Package + "\x00" + ev.Test
+		if ev.Action == "build-output" {
+			key = ev.ImportPath + "\x00"
+		}
+		switch ev.Action {
+		case "output", "build-output":
+			b := output[key]
+			if b == nil {
+				b = &strings.Builder{}
+				output[key] = b
+			}
+			if b.Len() < maxTestDetailsBytes {
+				b.WriteString(ev.Output)
+			}
+		case "pass", "fail", "skip":
+			details := ""
+			if b := output[key]; b != nil && ev.Action == "fail" {
+				details = strings.TrimSpace(b.String())
+			}
+			delete(output, key)
+			if ev.Test == "" {
+				if b := output[ev.FailedBuild+"\x00"]; b != nil && ev.FailedBuild != "" {
+					details = strings.TrimSpace(b.String() + details)
+				}
+				if ev.Action == "fail" && !failedTests[ev.Package] {
+					cases = append(cases, TestCase{Name: ev.Package, Suite: ev.Package, Status: TestError, DurationMs: secondsToMs(ev.Elapsed), Details: details})
+				}
+				continue
+			}
+			status := map[string]string{"pass": TestPassed, "fail": TestFailed, "skip": TestSkipped}[ev.Action]
+			if status == TestFailed {
+				failedTests[ev.Package] = true
+			}
+			cases = append(cases, TestCase{Name: ev.Test, Suite: ev.Package, Status: status, DurationMs: secondsToMs(ev.Elapsed), Details: details})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if events == 0 {
+		return nil, fmt.Errorf("no test events")
+	}
+	return cases, nil
+}
+
+// jestReport is the part of a jest --json report RunTests reads.
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"`
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Title           string   `json:"title"`
+			Status          string   `json:"status"`
+			Duration        float64  `json:"duration"`
+			FailureMessages []string `json:"failureMessages"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+// parseJestJSON reads the test cases of a jest --json report. A test file
+// that failed without results, e.g. because it does not compile, is an
+// error case.
+func parseJestJSON(data []byte) ([]TestCase, error) {
+	var report jestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var cases []TestCase
+	for _, file := range report.TestResults {
+		if len(file.AssertionResults) == 0 && file.Status == "failed" {
+			cases = append(cases, TestCase{Name: file.Name, Suite: file.Name, Status: TestError, Message: firstLine(file.Message), Details: file.Message})
+			continue
+		}
+		for _, a := range file.AssertionResults {
+			c := TestCase{Name: a.FullName, Suite: file.Name, DurationMs: int64(a.Duration)}
+			if c.Name == "" {
+				c.Name = a.Title
+			}
+			switch a.Status {
+			case "passed":
+				c.Status = TestPassed
+			case "failed":
+				c.Status = TestFailed
+				c.Details = strings.Join(a.FailureMessages, "\n")
+				c.Message = firstLine(c.Details)
+			default: // pending, skipped, todo, disabled
+				c.Status = TestSkipped
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+func secondsToMs(secs float64) int64 {
+	return int64(math.Round(secs * 1000))
+}
@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Test frameworks RunTests supports.
+const (
+	TestFrameworkPytest = "pytest"
+	TestFrameworkGo     = "go"
+	TestFrameworkJest   = "jest"
+)
+
+// Test case statuses.
+const (
+	TestPassed  = "passed"
+	TestFailed  = "failed"
+	TestSkipped = "skipped"
+	TestError   = "error" // could not run, e.g. a fixture or the build failed
+)
+
+// TestOpts configures a test run.
+type TestOpts struct {
+	Framework string
+	Path      string   // test file, directory or package; "" runs the framework's default
+	Args      []string // extra arguments for the framework
+	TimeoutMs int
+}
+
+// TestReport is the outcome of a test run.
+type TestReport struct {
+	Framework  string     `json:"framework"`
+	Passed     int        `json:"passed"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Errors     int        `json:"errors"`
+	Cases      []TestCase `json:"cases"`
+	ExitCode   int        `json:"exit_code"`
+	DurationMs int64      `json:"duration_ms"`
+	Output     string     `json:"output"` // console output of the framework
+	Truncated  bool       `json:"truncated,omitempty"`
+	// Error says why no results were parsed, e.g. the framework is not
+	// installed; Output then usually tells more.
+	Error string `json:"error,omitempty"`
+}
+
+// TestCase is the result of one test.
+type TestCase struct {
+	Name       string `json:"name"`
+	Suite      string `json:"suite,omitempty"` // class, package or file
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Message    string `json:"message,omitempty"` // short failure message
+	Details    string `json:"details,omitempty"` // traceback or test output of failures
+}
+
+// maxTestDetailsBytes caps TestCase.Message and Details.
+const maxTestDetailsBytes = 8 << 10
+
+// RunTests runs a test framework in the session and returns its results,
+// parsed from the framework's machine-readable report. The command runs like
+// an exec in the session shell, so it is subject to the command policy and
+// approval rules.
+func (m *Manager) RunTests(ctx context.Context, sessionID string, opts TestOpts) (*TestReport, error) {
+	reportPath := fmt.Sprintf("/workspace/.sandkasten/test-report-%s", uuid.New().String()[:8])
+	cmd, parse, err := testCommand(opts, reportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkCommandPolicy(sess.ID, cmd); err != nil {
+		return nil, err
+	}
+	if m.approvals != nil && !isApproved(ctx) {
+		scope := callerScope(ctx)
+		err := m.parkExecApproval(ctx, sess.ID, cmd, func(ctx context.Context) (any, error) {
+			return m.RunTests(scope(ctx), sessionID, opts)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := m.Exec(ctx, sess.ID, cmd, ExecOpts{TimeoutMs: opts.TimeoutMs})
+	if err != nil {
+		return nil, err
+	}
+	defer m.removeSessionFile(ctx, sess.ID, reportPath)
+
+	report := &TestReport{
+		Framework:  opts.Framework,
+		ExitCode:   result.ExitCode,
+		DurationMs: result.DurationMs,
+		Output:     result.Output,
+		Truncated:  result.Truncated,
+	}
+	data, err := m.readSessionFile(ctx, sess.ID, reportPath)
+	if err != nil {
+		report.Error = fmt.Sprintf("no %s report: %v", opts.Framework, err)
+		return report, nil
+	}
+	cases, err := parse(data)
+	if err != nil {
+		report.Error = fmt.Sprintf("parse %s report: %v", opts.Framework, err)
+		return report, nil
+	}
+	report.Cases = cases
+	for i := range report.Cases {
+		c := &report.Cases[i]
+		c.Message = truncateDetails(c.Message)
+		c.Details = truncateDetails(c.Details)
+		switch c.Status {
+		case TestPassed:
+			report.Passed++
+		case TestFailed:
+			report.Failed++
+		case TestSkipped:
+			report.Skipped++
+		case TestError:
+			report.Errors++
+		}
+	}
+	return report, nil
+}
+
+// testCommand returns the shell command that runs the tests of opts and
+// writes the framework's report to reportPath, and the parser of the
+// report.
+func testCommand(opts TestOpts, reportPath string) (string, func([]byte) ([]TestCase, error), error) {
+	var words []string
+	var parse func([]byte) ([]TestCase, error)
+	path := opts.Path
+	switch opts.Framework {
+	case TestFrameworkPytest:
+		words = append([]string{"python3", "-m", "pytest", "--junitxml=" + reportPath}, opts.Args...)
+		parse = parseJUnit
+	case TestFrameworkGo:
+		if path == "" {
+			path = "./..."
+		}
+		words = append([]string{"go", "test", "-json"}, opts.Args...)
+		parse = parseGoTestJSON
+	case TestFrameworkJest:
+		words = append([]string{"npx", "--no-install", "jest", "--json", "--outputFile=" + reportPath}, opts.Args...)
+		parse = parseJestJSON
+	default:
+		return "", nil, fmt.Errorf("unknown test framework %q", opts.Framework)
+	}
+	if path != "" {
+		words = append(words, path)
+	}
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = shellWord(w)
+	}
+	cmd := strings.Join(quoted, " ")
+	switch opts.Framework {
+	case TestFrameworkGo:
+		cmd += " > " + shellWord(reportPath)
+	case TestFrameworkJest:
+		// Keep color codes out of the failure messages in the report.
+		cmd = "FORCE_COLOR=0 " + cmd
+	}
+	return "mkdir -p /workspace/.sandkasten && " + cmd, parse, nil
+}
+
+// plainShellWord matches words the shell takes literally.
+var plainShellWord = regexp.MustCompile(`^[A-Za-z0-9_./=:,@%+-]+$`)
+
+// shellWord quotes w for the shell unless it needs no quoting, which keeps
+// the command readable in the audit log.
+func shellWord(w string) string {
+	if plainShellWord.MatchString(w) {
+		return w
+	}
+	return shellSingleQuote(w)
+}
+
+// truncateDetails cuts s to maxTestDetailsBytes, keeping UTF-8 valid.
+func truncateDetails(s string) string {
+	if len(s) <= maxTestDetailsBytes {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxTestDetailsBytes], "") + "\n[truncated]"
+}
@@ -0,0 +1,179 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/config"
+	"github.com/p-arndt/sandkasten/internal/policy"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJUnit(t *testing.T) {
+	report := `<?xml version="1.0" encoding="utf-8"?>
+<testsuites><testsuite name="pytest" errors="1" failures="1" skipped="1" tests="4" time="0.05">
+<testcase classname="test_math" name="test_add" time="0.001" />
+<testcase classname="test_math" name="test_sub" time="0.0025"><failure message="assert 1 == 2">def test_sub():
+&gt;       assert 1 == 2
+E       assert 1 == 2</failure></testcase>
+<testcase classname="test_math" name="test_later" time="0"><skipped type="pytest.skip" message="not yet">test_math.py:9: not yet</skipped></testcase>
+<testcase classname="test_math" name="test_db" time="0"><error message="failed on setup with &quot;KeyError&quot;">fixture db</error></testcase>
+</testsuite></testsuites>`
+
+	cases, err := parseJUnit([]byte(report))
+	require.NoError(t, err)
+	require.Len(t, cases, 4)
+	assert.Equal(t, TestCase{Name: "test_add", Suite: "test_math", Status: TestPassed, DurationMs: 1}, cases[0])
+	assert.Equal(t, TestFailed, cases[1].Status)
+	assert.Equal(t, int64(3), cases[1].DurationMs)
+	assert.Equal(t, "assert 1 == 2", cases[1].Message)
+	assert.Contains(t, cases[1].Details, ">       assert 1 == 2")
+	assert.Equal(t, TestSkipped, cases[2].Status)
+	assert.Equal(t, "not yet", cases[2].Message)
+	assert.Equal(t, TestError, cases[3].Status)
+	assert.Equal(t, `failed on setup with "KeyError"`, cases[3].Message)
+
+	// Older pytest versions write a single <testsuite> root.
+	cases, err = parseJUnit([]byte(`<testsuite><testcase classname="t" name="test_ok" time="0.1"/></testsuite>`))
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+	assert.Equal(t, "test_ok", cases[0].Name)
+}
+
+func TestParseGoTestJSON(t *testing.T) {
+	report := `{"Action":"start","Package":"ex/a"}
+{"Action":"run","Package":"ex/a","Test":"TestPass"}
+{"Action":"output","Package":"ex/a","Test":"TestPass","Output":"=== RUN   TestPass\n"}
+{"Action":"pass","Package":"ex/a","Test":"TestPass","Elapsed":0.012}
+{"Action":"run","Package":"ex/a","Test":"TestFail"}
+{"Action":"output","Package":"ex/a","Test":"TestFail","Output":"    a_test.go:7: boom\n"}
+{"Action":"fail","Package":"ex/a","Test":"TestFail","Elapsed":0}
+{"Action":"skip","Package":"ex/a","Test":"TestSkip","Elapsed":0}
+{"Action":"fail","Package":"ex/a","Elapsed":0.02}
+{"ImportPath":"ex/b.test","Action":"build-output","Output":"b/b_test.go:3:14: expected ')', found '{'\n"}
+{"ImportPath":"ex/b.test","Action":"build-fail"}
+{"Action":"fail","Package":"ex/b","Elapsed":0,"FailedBuild":"ex/b.test"}
+ok  	ex/c	(cached)
+`
+	cases, err := parseGoTestJSON([]byte(report))
+	require.NoError(t, err)
+	require.Len(t, cases, 4)
+	assert.Equal(t, TestCase{Name: "TestPass", Suite: "ex/a", Status: TestPassed, DurationMs: 12}, cases[0])
+	assert.Equal(t, TestFailed, cases[1].Status)
+	assert.Equal(t, "a_test.go:7: boom", cases[1].Details)
+	assert.Equal(t, TestSkipped, cases[2].Status)
+	assert.Equal(t, TestCase{Name: "ex/b", Suite: "ex/b", Status: TestError, Details: "b/b_test.go:3:14: expected ')', found '{'"}, cases[3])
+
+	_, err = parseGoTestJSON([]byte("go: command not found\n"))
+	assert.Error(t, err)
+}
+
+func TestParseJestJSON(t *testing.T) {
+	report := `{"numTotalTests": 3, "testResults": [
+		{"name": "/workspace/sum.test.js", "status": "failed", "message": "", "assertionResults": [
+			{"ancestorTitles": ["sum"], "title": "adds", "fullName": "sum adds", "status": "passed", "duration": 3, "failureMessages": []},
+			{"ancestorTitles": ["sum"], "title": "subtracts", "fullName": "sum subtracts", "status": "failed", "duration": 1,
+			 "failureMessages": ["Error: expect(received).toBe(expected)\n\nExpected: 1\nReceived: 2"]},
+			{"ancestorTitles": [], "title": "later", "fullName": "later", "status": "pending", "failureMessages": []}]},
+		{"name": "/workspace/broken.test.js", "status": "failed", "message": "SyntaxError: Unexpected token (1:5)\n  > 1 | foo(", "assertionResults": []}]}`
+
+	cases, err := parseJestJSON([]byte(report))
+	require.NoError(t, err)
+	require.Len(t, cases, 4)
+	assert.Equal(t, TestCase{Name: "sum adds", Suite: "/workspace/sum.test.js", Status: TestPassed, DurationMs: 3}, cases[0])
+	assert.Equal(t, TestFailed, cases[1].Status)
+	assert.Equal(t, "Error: expect(received).toBe(expected)", cases[1].Message)
+	assert.Contains(t, cases[1].Details, "Received: 2")
+	assert.Equal(t, TestSkipped, cases[2].Status)
+	assert.Equal(t, TestError, cases[3].Status)
+	assert.Equal(t, "SyntaxError: Unexpected token (1:5)", cases[3].Message)
+}
+
+func TestTestCommand(t *testing.T) {
+	cmd, _, err := testCommand(TestOpts{Framework: TestFrameworkPytest, Path: "tests/test_api.py", Args: []string{"-k", "not slow"}}, "/workspace/.sandkasten/r")
+	require.NoError(t, err)
+	assert.Equal(t, "mkdir -p /workspace/.sandkasten && python3 -m pytest --junitxml=/workspace/.sandkasten/r -k 'not slow' tests/test_api.py", cmd)
+
+	cmd, _, err = testCommand(TestOpts{Framework: TestFrameworkGo, Args: []string{"-run", "TestX"}}, "/workspace/.sandkasten/r")
+	require.NoError(t, err)
+	assert.Equal(t, "mkdir -p /workspace/.sandkasten && go test -json -run TestX ./... > /workspace/.sandkasten/r", cmd)
+
+	cmd, _, err = testCommand(TestOpts{Framework: TestFrameworkJest}, "/workspace/.sandkasten/r")
+	require.NoError(t, err)
+	assert.Equal(t, "mkdir -p /workspace/.sandkasten && FORCE_COLOR=0 npx --no-install jest --json --outputFile=/workspace/.sandkasten/r", cmd)
+
+	_, _, err = testCommand(TestOpts{Framework: "mocha"}, "/workspace/.sandkasten/r")
+	assert.Error(t, err)
+}
+
+func TestRunTests(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	var reportPath string
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool {
+		return req.Type == protocol.RequestExec && strings.Contains(req.Cmd, "pytest")
+	})).Run(func(args mock.Arguments) {
+		cmd := args.Get(2).(protocol.Request).Cmd
+		reportPath = strings.Fields(cmd[strings.Index(cmd, "--junitxml=")+len("--junitxml="):])[0]
+	}).Return(&protocol.Response{Type: protocol.ResponseExec, Cwd: "/workspace", ExitCode: 1, Output: "1 failed, 1 passed\n", DurationMs: 250}, nil)
+	report := `<testsuites><testsuite>
+<testcase classname="test_m" name="test_a" time="0.01"/>
+<testcase classname="test_m" name="test_b" time="0.02"><failure message="assert False">trace</failure></testcase>
+</testsuite></testsuites>`
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestRead)).Return(&protocol.Response{
+		Type: protocol.ResponseRead, ContentBase64: base64.StdEncoding.EncodeToString([]byte(report)),
+	}, nil)
+	var removed string
+	rt.On("Exec", mock.Anything, "s1", mock.MatchedBy(func(req protocol.Request) bool { return req.Shell == "sh" })).Run(func(args mock.Arguments) {
+		removed = args.Get(2).(protocol.Request).Cmd
+	}).Return(&protocol.Response{Type: protocol.ResponseExec}, nil)
+
+	res, err := mgr.RunTests(context.Background(), "s1", TestOpts{Framework: TestFrameworkPytest, TimeoutMs: 5000})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Passed)
+	assert.Equal(t, 1, res.Failed)
+	assert.Equal(t, 1, res.ExitCode)
+	assert.Equal(t, int64(250), res.DurationMs)
+	assert.Equal(t, "1 failed, 1 passed\n", res.Output)
+	assert.Empty(t, res.Error)
+	require.Len(t, res.Cases, 2)
+	assert.Equal(t, "assert False", res.Cases[1].Message)
+	assert.Equal(t, "rm -f '"+reportPath+"'", removed)
+}
+
+func TestRunTests_NoReport(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestExec)).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace", ExitCode: 1, Output: "No module named pytest\n",
+	}, nil)
+	rt.On("Exec", mock.Anything, "s1", isRequest(protocol.RequestRead)).Return(&protocol.Response{
+		Type: protocol.ResponseError, Error: "open: no such file or directory",
+	}, nil)
+
+	res, err := mgr.RunTests(context.Background(), "s1", TestOpts{Framework: TestFrameworkPytest})
+	require.NoError(t, err)
+	assert.Contains(t, res.Error, "no pytest report")
+	assert.Empty(t, res.Cases)
+	assert.Equal(t, "No module named pytest\n", res.Output)
+}
+
+func TestRunTests_Policy(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	pol, err := policy.New(config.PolicyConfig{Enabled: true, DenyPatterns: []string{`\bgo test\b`}}, "none")
+	require.NoError(t, err)
+	mgr.SetPolicy(pol)
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err = mgr.RunTests(context.Background(), "s1", TestOpts{Framework: TestFrameworkGo})
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+}
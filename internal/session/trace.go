@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+// startTrace starts tracing an exec in the session if trace is set. The
+// returned function ends the trace and returns its report, or nil when not
+// tracing. A trace that fails after the exec ran reports why in Error.
+func (m *Manager) startTrace(ctx context.Context, sessionID string, trace bool) (func() *runtime.TraceReport, error) {
+	if !trace {
+		return func() *runtime.TraceReport { return nil }, nil
+	}
+	if !m.cfg.Trace.Enabled {
+		return nil, fmt.Errorf("%w: trace.enabled is off", ErrTraceUnavailable)
+	}
+	tracer, ok := m.runtime.(runtime.ExecTracer)
+	if !ok {
+		return nil, fmt.Errorf("%w by runtime", ErrTraceUnavailable)
+	}
+	stop, err := tracer.StartTrace(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTraceUnavailable, err)
+	}
+	return func() *runtime.TraceReport {
+		report, err := stop()
+		if err != nil {
+			return &runtime.TraceReport{Error: err.Error()}
+		}
+		return report
+	}, nil
+}
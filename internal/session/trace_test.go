@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// tracingRuntime adds exec tracing to the mock driver.
+type tracingRuntime struct {
+	*MockRuntimeDriver
+	report  *runtime.TraceReport
+	stopErr error
+	started int
+}
+
+func (r *tracingRuntime) StartTrace(ctx context.Context, sessionID string) (func() (*runtime.TraceReport, error), error) {
+	r.started++
+	return func() (*runtime.TraceReport, error) { return r.report, r.stopErr }, nil
+}
+
+func newTracingManager(t *testing.T, tracer *tracingRuntime) *Manager {
+	t.Helper()
+	st := &MockSessionStore{}
+	cfg := testConfig()
+	cfg.Trace.Enabled = true
+	mgr := NewManager(cfg, st, tracer, nil, nil)
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+	tracer.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type: protocol.ResponseExec, Cwd: "/workspace", Output: "ok\n",
+	}, nil)
+	return mgr
+}
+
+func TestExecTrace(t *testing.T) {
+	tracer := &tracingRuntime{
+		MockRuntimeDriver: &MockRuntimeDriver{},
+		report:            &runtime.TraceReport{Processes: 1, Execs: []string{"/usr/bin/curl"}},
+	}
+	mgr := newTracingManager(t, tracer)
+
+	result, err := mgr.Exec(context.Background(), "s1", "curl example.com", ExecOpts{TimeoutMs: 5000})
+	require.NoError(t, err)
+	assert.Nil(t, result.Trace, "not asked for")
+	assert.Zero(t, tracer.started)
+
+	result, err = mgr.Exec(context.Background(), "s1", "curl example.com", ExecOpts{TimeoutMs: 5000, Trace: true})
+	require.NoError(t, err)
+	assert.Equal(t, tracer.report, result.Trace)
+	assert.Equal(t, "ok\n", result.Output)
+
+	tracer.stopErr = fmt.Errorf("read trace: no such file")
+	result, err = mgr.Exec(context.Background(), "s1", "curl example.com", ExecOpts{TimeoutMs: 5000, Trace: true})
+	require.NoError(t, err)
+	require.NotNil(t, result.Trace)
+	assert.Equal(t, "read trace: no such file", result.Trace.Error)
+}
+
+func TestExecTrace_Unavailable(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	mgr.cfg.Trace.Enabled = true
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "ls", ExecOpts{TimeoutMs: 5000, Trace: true})
+	assert.ErrorIs(t, err, ErrTraceUnavailable)
+	rt.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+
+	tracer := &tracingRuntime{MockRuntimeDriver: &MockRuntimeDriver{}}
+	mgr = newTracingManager(t, tracer)
+	mgr.cfg.Trace.Enabled = false
+	_, err = mgr.Exec(context.Background(), "s1", "ls", ExecOpts{TimeoutMs: 5000, Trace: true})
+	assert.ErrorIs(t, err, ErrTraceUnavailable)
+	assert.Zero(t, tracer.started)
+}
@@ -0,0 +1,171 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// AuditActionWorkspacePurged records a deleted workspace removed from the
+// trash after workspace.trash_days.
+const AuditActionWorkspacePurged = "workspace_purged"
+
+// trashDir holds deleted workspaces under their directory names until they
+// are restored or purged. A deleted workspace's deletion time is its mtime.
+func (m *Manager) trashDir() string {
+	return filepath.Join(m.cfg.DataDir, "workspaces-trash")
+}
+
+// trashWorkspace moves a workspace to the trash, replacing a trashed
+// workspace of the same ID. Deleting a workspace that does not exist is not
+// an error, as without the trash.
+func (m *Manager) trashWorkspace(ctx context.Context, dirID string) error {
+	src := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("delete workspace: %w", err)
+	}
+	if err := os.MkdirAll(m.trashDir(), 0700); err != nil {
+		return fmt.Errorf("delete workspace: %w", err)
+	}
+	if err := m.purgeTrashed(ctx, dirID); err != nil {
+		return err
+	}
+	dst := filepath.Join(m.trashDir(), dirID)
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("delete workspace: %w", err)
+	}
+	now := time.Now()
+	if err := os.Chtimes(dst, now, now); err != nil {
+		return fmt.Errorf("delete workspace: %w", err)
+	}
+	return nil
+}
+
+// purgeTrashed removes a workspace from the trash for good.
+func (m *Manager) purgeTrashed(ctx context.Context, dirID string) error {
+	dir := filepath.Join(m.trashDir(), dirID)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	live := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
+	_, err := os.Stat(live)
+	liveExists := err == nil
+	if m.workspace == nil || liveExists {
+		// A live workspace of the same ID shares the workspace manager's
+		// state (e.g. its encryption key) and metadata, so only the files go.
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("purge workspace: %w", err)
+		}
+		if liveExists {
+			return nil
+		}
+		return m.forgetWorkspace(dirID)
+	}
+	// The workspace manager deletes by workspace ID, so the workspace goes
+	// back in place first.
+	if err := os.Rename(dir, live); err != nil {
+		return fmt.Errorf("purge workspace: %w", err)
+	}
+	return m.deleteWorkspaceDir(ctx, dirID)
+}
+
+// ListDeletedWorkspaces lists the caller's workspaces in the trash, most
+// recently deleted first.
+func (m *Manager) ListDeletedWorkspaces(ctx context.Context) ([]*WorkspaceInfo, error) {
+	if !m.cfg.Workspace.Enabled {
+		return nil, fmt.Errorf("workspaces not enabled")
+	}
+	entries, err := os.ReadDir(m.trashDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read workspace trash: %w", err)
+	}
+	tenant := tenantFrom(ctx)
+	keep := time.Duration(m.cfg.Workspace.TrashDays) * 24 * time.Hour
+	result := make([]*WorkspaceInfo, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || !workspaceVisible(tenant, entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		deletedAt := info.ModTime().UTC()
+		purgeAt := deletedAt.Add(keep)
+		result = append(result, &WorkspaceInfo{
+			ID:        publicWorkspaceID(tenant, entry.Name()),
+			DeletedAt: &deletedAt,
+			PurgeAt:   &purgeAt,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DeletedAt.After(*result[j].DeletedAt) })
+	return result, nil
+}
+
+// RestoreWorkspace moves a deleted workspace back out of the trash. It fails
+// with ErrWorkspaceExists if a workspace of the same ID was created since.
+func (m *Manager) RestoreWorkspace(ctx context.Context, workspaceID string) (*WorkspaceInfo, error) {
+	if !m.cfg.Workspace.Enabled {
+		return nil, fmt.Errorf("workspaces not enabled")
+	}
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	src := filepath.Join(m.trashDir(), dirID)
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s is not in the trash", ErrWorkspaceNotFound, workspaceID)
+		}
+		return nil, fmt.Errorf("restore workspace: %w", err)
+	}
+	dst := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceExists, workspaceID)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, fmt.Errorf("restore workspace: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return nil, fmt.Errorf("restore workspace: %w", err)
+	}
+	return &WorkspaceInfo{ID: publicWorkspaceID(tenantFrom(ctx), dirID)}, nil
+}
+
+// PurgeTrash removes the workspaces of all tenants that have been in the
+// trash for workspace.trash_days and returns how many were removed.
+func (m *Manager) PurgeTrash(ctx context.Context) (int, error) {
+	if !m.cfg.Workspace.Enabled {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(m.trashDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read workspace trash: %w", err)
+	}
+	cutoff := time.Now().Add(-time.Duration(m.cfg.Workspace.TrashDays) * 24 * time.Hour)
+	purged := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := m.purgeTrashed(ctx, entry.Name()); err != nil {
+			return purged, err
+		}
+		purged++
+		m.recordAudit("", AuditActionWorkspacePurged, fmt.Sprintf("workspace %s deleted %s", entry.Name(), info.ModTime().UTC().Format(time.RFC3339)))
+	}
+	return purged, nil
+}
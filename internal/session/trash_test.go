@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTrashManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	mgr, _, _ := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.cfg.Workspace.Enabled = true
+	mgr.cfg.Workspace.TrashDays = 7
+	root := filepath.Join(mgr.cfg.DataDir, "workspaces")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "project"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "project", "main.py"), []byte("print(1)"), 0644))
+	return mgr, root
+}
+
+func TestDeleteWorkspace_TrashAndRestore(t *testing.T) {
+	mgr, root := newTrashManager(t)
+	ctx := context.Background()
+
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "project"))
+	assert.NoDirExists(t, filepath.Join(root, "project"))
+	live, err := mgr.ListWorkspaces(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, live)
+
+	deleted, err := mgr.ListDeletedWorkspaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "project", deleted[0].ID)
+	assert.WithinDuration(t, time.Now(), *deleted[0].DeletedAt, time.Minute)
+	assert.Equal(t, 7*24*time.Hour, deleted[0].PurgeAt.Sub(*deleted[0].DeletedAt))
+
+	ws, err := mgr.RestoreWorkspace(ctx, "project")
+	require.NoError(t, err)
+	assert.Equal(t, "project", ws.ID)
+	data, err := os.ReadFile(filepath.Join(root, "project", "main.py"))
+	require.NoError(t, err)
+	assert.Equal(t, "print(1)", string(data))
+
+	_, err = mgr.RestoreWorkspace(ctx, "project")
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+}
+
+func TestRestoreWorkspace_Exists(t *testing.T) {
+	mgr, root := newTrashManager(t)
+	ctx := context.Background()
+
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "project"))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "project"), 0755))
+
+	_, err := mgr.RestoreWorkspace(ctx, "project")
+	assert.ErrorIs(t, err, ErrWorkspaceExists)
+
+	// Deleting the new workspace replaces the trashed one.
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "project"))
+	_, err = mgr.RestoreWorkspace(ctx, "project")
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(root, "project", "main.py"))
+}
+
+func TestDeleteWorkspace_NoTrash(t *testing.T) {
+	mgr, root := newTrashManager(t)
+	mgr.cfg.Workspace.TrashDays = 0
+
+	require.NoError(t, mgr.DeleteWorkspace(context.Background(), "project"))
+	assert.NoDirExists(t, filepath.Join(root, "project"))
+	deleted, err := mgr.ListDeletedWorkspaces(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	mgr, root := newTrashManager(t)
+	ctx := context.Background()
+	ws := &MockWorkspaceManager{}
+	mgr.workspace = ws
+	audit := &MockAuditStore{}
+	mgr.SetAuditStore(audit)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "recent"), 0755))
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "project"))
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "recent"))
+	old := time.Now().Add(-8 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(mgr.trashDir(), "project"), old, old))
+
+	// The workspace manager deletes the purged workspace in place.
+	ws.On("Delete", mock.Anything, "project").Return(nil).Run(func(mock.Arguments) {
+		assert.DirExists(t, filepath.Join(root, "project"))
+		os.RemoveAll(filepath.Join(root, "project"))
+	})
+	audit.On("AppendAuditEvent", mock.MatchedBy(func(ev *store.AuditEvent) bool {
+		return ev.Action == AuditActionWorkspacePurged
+	})).Return(nil).Once()
+
+	n, err := mgr.PurgeTrash(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	ws.AssertExpectations(t)
+	audit.AssertExpectations(t)
+
+	deleted, err := mgr.ListDeletedWorkspaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "recent", deleted[0].ID)
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+)
+
+const (
+	// maxLeaseSeconds caps how far in the future an updated lease may end.
+	maxLeaseSeconds = 86400
+	maxLabels       = 64
+)
+
+// UpdateOpts changes a running session's lease and labels. Nil fields are left alone.
+type UpdateOpts struct {
+	// TTLSeconds sets the remaining lifetime from now, or with TTLDelta moves
+	// the current expiry by that many seconds. A lease ending in the past
+	// expires the session; the reaper destroys it on its next pass.
+	TTLSeconds *int
+	TTLDelta   bool
+	// Labels are merged into the session's labels; a nil value removes the key.
+	Labels map[string]*string
+}
+
+// Update applies opts to a running session and returns its new state.
+func (m *Manager) Update(ctx context.Context, sessionID string, opts UpdateOpts) (*SessionInfo, error) {
+	if _, err := m.validateSession(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	// Labels and relative TTLs are read, changed and written back: serialize
+	// concurrent updates and re-read the session under the lock.
+	mu := m.updateLock(sessionID)
+	mu.Lock()
+	defer mu.Unlock()
+	sess, err := m.validateSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.TTLSeconds != nil {
+		now := time.Now().UTC()
+		delta := time.Duration(*opts.TTLSeconds) * time.Second
+		expiresAt := now.Add(delta)
+		if opts.TTLDelta {
+			expiresAt = sess.ExpiresAt.Add(delta)
+		}
+		if expiresAt.Before(now) {
+			expiresAt = now
+		}
+		if expiresAt.Sub(now) > maxLeaseSeconds*time.Second {
+			return nil, fmt.Errorf("%w: lease must not end more than %d seconds from now", ErrInvalidUpdate, maxLeaseSeconds)
+		}
+		if err := m.store.UpdateSessionExpiry(sessionID, expiresAt); err != nil {
+			return nil, err
+		}
+		sess.ExpiresAt = expiresAt
+	}
+
+	if len(opts.Labels) > 0 {
+		labels := maps.Clone(sess.Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(opts.Labels))
+		}
+		for k, v := range opts.Labels {
+			if v == nil {
+				delete(labels, k)
+			} else {
+				labels[k] = *v
+			}
+		}
+		if len(labels) > maxLabels {
+			return nil, fmt.Errorf("%w: at most %d labels per session", ErrInvalidUpdate, maxLabels)
+		}
+		if err := m.store.UpdateSessionLabels(sessionID, labels); err != nil {
+			return nil, err
+		}
+		sess.Labels = labels
+	}
+
+	return &SessionInfo{
+		ID:          sess.ID,
+		Image:       sess.Image,
+		Status:      sess.Status,
+		Cwd:         sess.Cwd,
+		WorkspaceID: publicWorkspaceID(sess.Tenant, sess.WorkspaceID),
+		ImageDigest: sess.ImageDigest,
+		Hostname:    runtime.Hostname(sess.ID, sess.Hostname),
+		MachineID:   runtime.MachineID(sess.ID),
+		Thrashing:   m.stats.isThrashing(sess.ID),
+		Labels:      sess.Labels,
+		CreatedAt:   sess.CreatedAt,
+		ExpiresAt:   sess.ExpiresAt,
+		Determinism: decodeDeterminism(sess.Determinism),
+		CPU:         decodeCPU(sess.CPU),
+	}, nil
+}
@@ -0,0 +1,151 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func leasedSession(id string, expiresIn time.Duration) *store.Session {
+	now := time.Now().UTC()
+	return &store.Session{
+		ID:        id,
+		Image:     "base",
+		Status:    "running",
+		Cwd:       "/workspace",
+		Labels:    map[string]string{"team": "infra", "run": "1"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiresIn),
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func strPtr(s string) *string { return &s }
+
+func TestUpdateAbsoluteTTL(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", time.Minute), nil)
+	st.On("UpdateSessionExpiry", "s1", mock.Anything).Return(nil)
+
+	info, err := mgr.Update(context.Background(), "s1", UpdateOpts{TTLSeconds: intPtr(3600)})
+	require.NoError(t, err)
+
+	assert.WithinDuration(t, time.Now().Add(time.Hour), info.ExpiresAt, 5*time.Second)
+	st.AssertCalled(t, "UpdateSessionExpiry", "s1", info.ExpiresAt)
+	st.AssertNotCalled(t, "UpdateSessionLabels", mock.Anything, mock.Anything)
+}
+
+func TestUpdateDeltaTTL(t *testing.T) {
+	mgr, _, st := newTestManager()
+	sess := leasedSession("s1", 10*time.Minute)
+	want := sess.ExpiresAt.Add(-5 * time.Minute)
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionExpiry", "s1", want).Return(nil)
+
+	info, err := mgr.Update(context.Background(), "s1", UpdateOpts{TTLSeconds: intPtr(-300), TTLDelta: true})
+	require.NoError(t, err)
+	assert.Equal(t, want, info.ExpiresAt)
+}
+
+func TestUpdateForceExpire(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", 10*time.Minute), nil)
+	st.On("UpdateSessionExpiry", "s1", mock.Anything).Return(nil)
+
+	info, err := mgr.Update(context.Background(), "s1", UpdateOpts{TTLSeconds: intPtr(-3600), TTLDelta: true})
+	require.NoError(t, err)
+	assert.False(t, info.ExpiresAt.After(time.Now()))
+}
+
+func TestUpdateTTLTooLong(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", 20*time.Hour), nil)
+
+	_, err := mgr.Update(context.Background(), "s1", UpdateOpts{TTLSeconds: intPtr(8 * 3600), TTLDelta: true})
+	assert.ErrorIs(t, err, ErrInvalidUpdate)
+	st.AssertNotCalled(t, "UpdateSessionExpiry", mock.Anything, mock.Anything)
+}
+
+func TestUpdateMergesLabels(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", time.Minute), nil)
+	want := map[string]string{"team": "ml", "owner": "alice"}
+	st.On("UpdateSessionLabels", "s1", want).Return(nil)
+
+	info, err := mgr.Update(context.Background(), "s1", UpdateOpts{Labels: map[string]*string{
+		"team":  strPtr("ml"),
+		"owner": strPtr("alice"),
+		"run":   nil,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, want, info.Labels)
+	st.AssertNotCalled(t, "UpdateSessionExpiry", mock.Anything, mock.Anything)
+}
+
+func TestUpdateExpiredSession(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "s1").Return(leasedSession("s1", -time.Minute), nil)
+
+	_, err := mgr.Update(context.Background(), "s1", UpdateOpts{TTLSeconds: intPtr(600)})
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestUpdateNotFound(t *testing.T) {
+	mgr, _, st := newTestManager()
+	st.On("GetSession", "missing").Return(nil, nil)
+
+	_, err := mgr.Update(context.Background(), "missing", UpdateOpts{TTLSeconds: intPtr(600)})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// rowStore keeps one session row and returns copies of it, like the real
+// store.
+type rowStore struct {
+	*MockSessionStore
+	mu  sync.Mutex
+	row store.Session
+}
+
+func (s *rowStore) GetSession(id string) (*store.Session, error) {
+	s.mu.Lock()
+	row := s.row
+	row.Labels = maps.Clone(s.row.Labels)
+	s.mu.Unlock()
+	time.Sleep(time.Millisecond) // let other updates read the same row
+	return &row, nil
+}
+
+func (s *rowStore) UpdateSessionLabels(id string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.row.Labels = maps.Clone(labels)
+	return nil
+}
+
+func TestUpdateConcurrentLabels(t *testing.T) {
+	mgr, _, st := newTestManager()
+	rows := &rowStore{MockSessionStore: st, row: *leasedSession("s1", time.Minute)}
+	mgr.store = rows
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := mgr.Update(context.Background(), "s1", UpdateOpts{Labels: map[string]*string{fmt.Sprintf("k%d", i): strPtr("v")}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, rows.row.Labels, 22, "no update lost another's labels")
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+type keyIDKey struct{}
+
+// KeyID returns a stable identifier for apiKey that is safe to store and
+// show: the first 12 hex digits of its SHA-256.
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// WithAPIKey tags ctx with the API key making the request. Sessions and usage
+// records are attributed to its KeyID.
+func WithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return withKeyID(ctx, KeyID(apiKey))
+}
+
+func withKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, keyIDKey{}, keyID)
+}
+
+// keyIDFrom returns the KeyID ctx was tagged with, or "" (no API key configured).
+func keyIDFrom(ctx context.Context) string {
+	v, _ := ctx.Value(keyIDKey{}).(string)
+	return v
+}
+
+// execUsage measures one exec for its usage record. A nil *execUsage (usage
+// accounting disabled) is a no-op.
+type execUsage struct {
+	m         *Manager
+	sess      *storemod.Session
+	keyID     string
+	bytesIn   int64
+	started   time.Time
+	cpuBefore int64
+}
+
+// startExecUsage samples the session's CPU time before an exec runs.
+func (m *Manager) startExecUsage(ctx context.Context, sess *storemod.Session, cmd string) *execUsage {
+	if m.usage == nil {
+		return nil
+	}
+	u := &execUsage{
+		m:       m,
+		sess:    sess,
+		keyID:   keyIDFrom(ctx),
+		bytesIn: int64(len(cmd)),
+		started: time.Now(),
+	}
+	if stats, err := m.runtime.Stats(ctx, sess.ID); err == nil {
+		u.cpuBefore = stats.CPUUsageUsec
+	}
+	return u
+}
+
+// finish writes the exec's usage record. CPU time is the growth of the whole
+// session's counter, so background processes count toward the exec that
+// overlapped them. Failures are ignored: accounting never fails an exec.
+func (u *execUsage) finish(ctx context.Context, result *ExecResult) {
+	if u == nil {
+		return
+	}
+	rec := &storemod.UsageRecord{
+		Kind:      storemod.UsageKindExec,
+		SessionID: u.sess.ID,
+		KeyID:     u.keyID,
+		Image:     u.sess.Image,
+		WallMs:    time.Since(u.started).Milliseconds(),
+		BytesIn:   u.bytesIn,
+	}
+	if result != nil {
+		rec.BytesOut = int64(len(result.Output))
+	}
+	if stats, err := u.m.runtime.Stats(ctx, u.sess.ID); err == nil {
+		rec.CPUUsec = max(stats.CPUUsageUsec-u.cpuBefore, 0)
+		rec.PeakMemoryBytes = max(stats.MemoryPeak, stats.MemoryBytes)
+	}
+	_ = u.m.usage.AppendUsageRecord(rec)
+}
+
+// RecordSessionUsage writes the usage record of a session that is about to be
+// torn down: its lifetime, total CPU time, peak memory and exec bytes. Call it
+// before the sandbox is destroyed, while its counters can still be read.
+func (m *Manager) RecordSessionUsage(ctx context.Context, sess *storemod.Session) {
+	if m.usage == nil || sess == nil {
+		return
+	}
+	rec := &storemod.UsageRecord{
+		Kind:      storemod.UsageKindSession,
+		SessionID: sess.ID,
+		KeyID:     sess.KeyID,
+		Image:     sess.Image,
+		WallMs:    time.Since(sess.CreatedAt).Milliseconds(),
+	}
+	if stats, err := m.runtime.Stats(ctx, sess.ID); err == nil {
+		rec.CPUUsec = stats.CPUUsageUsec
+		rec.PeakMemoryBytes = max(stats.MemoryPeak, stats.MemoryBytes)
+	}
+	if in, out, err := m.usage.SessionExecBytes(sess.ID); err == nil {
+		rec.BytesIn, rec.BytesOut = in, out
+	}
+	_ = m.usage.AppendUsageRecord(rec)
+}
+
+// SummarizeUsage aggregates usage records by "key", "image" or "day". Only
+// the default tenant may read them.
+func (m *Manager) SummarizeUsage(ctx context.Context, groupBy string, since, until time.Time) ([]*storemod.UsageSummary, error) {
+	if err := RequireDefaultTenant(ctx); err != nil {
+		return nil, err
+	}
+	if m.usage == nil {
+		return nil, ErrUsageDisabled
+	}
+	return m.usage.SummarizeUsage(groupBy, since, until)
+}
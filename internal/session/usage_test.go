@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/runtime"
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/p-arndt/sandkasten/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyIDIsStableAndShort(t *testing.T) {
+	assert.Equal(t, KeyID("sk-secret"), KeyID("sk-secret"))
+	assert.NotEqual(t, KeyID("sk-secret"), KeyID("sk-other"))
+	assert.Len(t, KeyID("sk-secret"), 12)
+	assert.NotContains(t, KeyID("sk-secret"), "secret")
+}
+
+func TestExecRecordsUsage(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	usage := &MockUsageStore{}
+	mgr.SetUsageStore(usage)
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Stats", mock.Anything, "s1").Return(&protocol.SessionStats{CPUUsageUsec: 1000, MemoryBytes: 4096}, nil).Once()
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type:   protocol.ResponseExec,
+		Cwd:    "/workspace",
+		Output: "hello\n",
+	}, nil)
+	rt.On("Stats", mock.Anything, "s1").Return(&protocol.SessionStats{CPUUsageUsec: 1750, MemoryBytes: 4096, MemoryPeak: 8192}, nil).Once()
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	var rec *store.UsageRecord
+	usage.On("AppendUsageRecord", mock.AnythingOfType("*store.UsageRecord")).Run(func(args mock.Arguments) {
+		rec = args.Get(0).(*store.UsageRecord)
+	}).Return(nil)
+
+	ctx := WithAPIKey(context.Background(), "sk-secret")
+	_, err := mgr.Exec(ctx, "s1", "echo hello", ExecOpts{})
+	require.NoError(t, err)
+
+	require.NotNil(t, rec)
+	assert.Equal(t, store.UsageKindExec, rec.Kind)
+	assert.Equal(t, "s1", rec.SessionID)
+	assert.Equal(t, KeyID("sk-secret"), rec.KeyID)
+	assert.Equal(t, "base", rec.Image)
+	assert.Equal(t, int64(750), rec.CPUUsec)
+	assert.Equal(t, int64(len("echo hello")), rec.BytesIn)
+	assert.Equal(t, int64(len("hello\n")), rec.BytesOut)
+	assert.Equal(t, int64(8192), rec.PeakMemoryBytes)
+}
+
+func TestExecWithoutUsageStoreSkipsStats(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	st.On("GetSession", "s1").Return(runningSession("s1"), nil)
+	rt.On("Exec", mock.Anything, "s1", mock.AnythingOfType("protocol.Request")).Return(&protocol.Response{
+		Type: protocol.ResponseExec,
+		Cwd:  "/workspace",
+	}, nil)
+	st.On("UpdateSessionActivity", "s1", "/workspace", mock.AnythingOfType("time.Time")).Return(nil)
+
+	_, err := mgr.Exec(context.Background(), "s1", "true", ExecOpts{})
+	require.NoError(t, err)
+	rt.AssertNotCalled(t, "Stats", mock.Anything, mock.Anything)
+}
+
+func TestDestroyRecordsSessionUsage(t *testing.T) {
+	mgr, rt, st := newTestManager()
+	usage := &MockUsageStore{}
+	mgr.SetUsageStore(usage)
+
+	sess := runningSession("s1")
+	sess.KeyID = "abc123def456"
+	sess.CreatedAt = time.Now().Add(-time.Minute)
+	st.On("GetSession", "s1").Return(sess, nil)
+	st.On("UpdateSessionStatus", "s1", mock.Anything).Return(nil)
+	rt.On("Stats", mock.Anything, "s1").Return(&protocol.SessionStats{CPUUsageUsec: 5000, MemoryBytes: 1024, MemoryPeak: 2048}, nil)
+	rt.On("Destroy", mock.Anything, "s1").Return(nil)
+	usage.On("SessionExecBytes", "s1").Return(int64(10), int64(200), nil)
+	usage.On("AppendUsageRecord", mock.MatchedBy(func(rec *store.UsageRecord) bool {
+		return rec.Kind == store.UsageKindSession && rec.KeyID == "abc123def456" &&
+			rec.CPUUsec == 5000 && rec.PeakMemoryBytes == 2048 &&
+			rec.BytesIn == 10 && rec.BytesOut == 200 && rec.WallMs >= time.Minute.Milliseconds()
+	})).Return(nil)
+
+	require.NoError(t, mgr.Destroy(context.Background(), "s1"))
+	usage.AssertExpectations(t)
+}
+
+func TestCreateAttributesSessionToAPIKey(t *testing.T) {
+	mgr, rt, st := newTestManager()
+
+	rt.On("Create", mock.Anything, mock.AnythingOfType("runtime.CreateOpts")).Return(&runtime.SessionInfo{
+		SessionID: "test-session",
+	}, nil)
+	st.On("CreateSession", mock.MatchedBy(func(sess *store.Session) bool {
+		return sess.KeyID == KeyID("sk-secret")
+	})).Return(nil)
+
+	_, err := mgr.Create(WithAPIKey(context.Background(), "sk-secret"), CreateOpts{})
+	require.NoError(t, err)
+	st.AssertExpectations(t)
+}
+
+func TestSummarizeUsageDisabled(t *testing.T) {
+	mgr, _, _ := newTestManager()
+
+	_, err := mgr.SummarizeUsage(context.Background(), "day", time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, ErrUsageDisabled)
+}
@@ -6,12 +6,21 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/p-arndt/sandkasten/protocol"
+	"time"
 )
 
 type WorkspaceInfo struct {
 	ID string `json:"id"`
+	// Metadata, set when the daemon keeps workspace metadata.
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	KeyID       string            `json:"key_id,omitempty"`
+	CreatedAt   *time.Time        `json:"created_at,omitempty"`
+	LastUsedAt  *time.Time        `json:"last_used_at,omitempty"`
+	SizeBytes   int64             `json:"size_bytes,omitempty"`
+	// DeletedAt and PurgeAt are set for workspaces in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
 }
 
 func (m *Manager) ListWorkspaces(ctx context.Context) ([]*WorkspaceInfo, error) {
@@ -28,13 +37,27 @@ func (m *Manager) ListWorkspaces(ctx context.Context) ([]*WorkspaceInfo, error)
 		return nil, fmt.Errorf("read workspaces dir: %w", err)
 	}
 
+	meta, usage, err := m.workspaceMetadata()
+	if err != nil {
+		return nil, err
+	}
+	tenant := tenantFrom(ctx)
 	result := make([]*WorkspaceInfo, 0)
 	for _, entry := range entries {
-		if entry.IsDir() {
-			result = append(result, &WorkspaceInfo{
-				ID: entry.Name(),
-			})
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if !workspaceVisible(tenant, name) {
+			continue
+		}
+		info := &WorkspaceInfo{
+			ID: publicWorkspaceID(tenant, name),
 		}
+		if fi, err := entry.Info(); err == nil && meta != nil {
+			fillWorkspaceInfo(info, fi, meta[name], usage[name])
+		}
+		result = append(result, info)
 	}
 	return result, nil
 }
@@ -44,12 +67,49 @@ func (m *Manager) DeleteWorkspace(ctx context.Context, workspaceID string) error
 		return fmt.Errorf("workspaces not enabled")
 	}
 
-	shortID := strings.TrimPrefix(workspaceID, protocol.WorkspaceVolumePrefix)
-	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", shortID)
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if m.cfg.Workspace.TrashDays > 0 {
+		return m.trashWorkspace(ctx, dirID)
+	}
+	return m.deleteWorkspaceDir(ctx, dirID)
+}
+
+// workspaceVisible reports whether the workspace directory name belongs to
+// tenant ("" = no tenant).
+func workspaceVisible(tenant, name string) bool {
+	if tenant == "" {
+		return !strings.Contains(name, tenantWorkspaceSep)
+	}
+	return strings.HasPrefix(name, tenant+tenantWorkspaceSep)
+}
+
+func (m *Manager) deleteWorkspaceDir(ctx context.Context, dirID string) error {
+	if m.workspace != nil {
+		if err := m.workspace.Delete(ctx, dirID); err != nil {
+			return fmt.Errorf("delete workspace: %w", err)
+		}
+		return m.forgetWorkspace(dirID)
+	}
+	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
 
 	if err := os.RemoveAll(workspacePath); err != nil {
 		return fmt.Errorf("delete workspace: %w", err)
 	}
 
+	return m.forgetWorkspace(dirID)
+}
+
+// unlockWorkspace lets the workspace manager prepare an existing workspace,
+// e.g. load its encryption key, before the daemon reads it directly.
+func (m *Manager) unlockWorkspace(ctx context.Context, dirID string) error {
+	if m.workspace == nil {
+		return nil
+	}
+	if _, err := m.workspace.Exists(ctx, dirID); err != nil {
+		return fmt.Errorf("open workspace: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,245 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// CopyOpts copies files from one of the caller's workspaces into another.
+type CopyOpts struct {
+	Src string // source workspace ID
+	// Paths are files or directories relative to the source workspace root,
+	// copied to the same paths in the destination. Empty copies everything.
+	Paths []string
+	// Overwrite replaces existing files; otherwise the copy fails with
+	// ErrFileExists before anything is written.
+	Overwrite bool
+}
+
+// CopyResult reports what a workspace copy wrote.
+type CopyResult struct {
+	Files  int   `json:"files"`
+	Bytes  int64 `json:"bytes"`
+	Cloned int   `json:"cloned"` // files shared copy-on-write (reflink) with the source
+}
+
+// copyEntry is one directory, regular file or symlink to copy.
+type copyEntry struct {
+	rel    string // slash-separated, relative to both workspace roots
+	src    string // absolute source path
+	mode   fs.FileMode
+	target string // symlink target
+}
+
+// CopyWorkspaceFiles copies files between two of the caller's workspaces on
+// the host, creating the destination workspace if needed. Files are cloned
+// copy-on-write where the filesystem supports it and copied otherwise; they
+// are never hard-linked, which would let writes in one workspace show up in
+// the other. Symlinks are copied as symlinks, never followed.
+func (m *Manager) CopyWorkspaceFiles(ctx context.Context, workspaceID string, opts CopyOpts) (*CopyResult, error) {
+	if !m.cfg.Workspace.Enabled {
+		return nil, fmt.Errorf("workspaces not enabled")
+	}
+	dstDir, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	srcDir, err := m.workspaceDirID(ctx, opts.Src)
+	if err != nil {
+		return nil, err
+	}
+	if srcDir == dstDir {
+		return nil, fmt.Errorf("%w: cannot copy a workspace into itself", ErrInvalidWorkspace)
+	}
+	srcPath := filepath.Join(m.cfg.DataDir, "workspaces", srcDir)
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, opts.Src)
+	}
+	if err := m.unlockWorkspace(ctx, srcDir); err != nil {
+		return nil, err
+	}
+
+	entries, err := m.collectCopyEntries(srcPath, opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.ensureWorkspace(ctx, dstDir); err != nil {
+		return nil, err
+	}
+	dstPath := filepath.Join(m.cfg.DataDir, "workspaces", dstDir)
+	if err := os.MkdirAll(dstPath, 0755); err != nil {
+		return nil, fmt.Errorf("create workspace directory: %w", err)
+	}
+	realDst, err := filepath.EvalSymlinks(dstPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve workspace path: %w", err)
+	}
+	if !opts.Overwrite {
+		for _, e := range entries {
+			if e.mode.IsDir() {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(realDst, filepath.FromSlash(e.rel))); err == nil {
+				return nil, fmt.Errorf("%w: %s", ErrFileExists, e.rel)
+			}
+		}
+	}
+
+	rootFD, err := unix.Open(realDst, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open workspace: %w", err)
+	}
+	defer unix.Close(rootFD)
+
+	result := &CopyResult{}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := copyEntryTo(rootFD, e, opts.Overwrite, result); err != nil {
+			return result, fmt.Errorf("copy %s: %w", e.rel, err)
+		}
+	}
+	return result, nil
+}
+
+// collectCopyEntries lists what to copy from the workspace at root, parents
+// before children. Paths resolving outside the workspace are rejected.
+func (m *Manager) collectCopyEntries(root string, paths []string) ([]copyEntry, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve workspace path: %w", err)
+	}
+	if len(paths) == 0 {
+		paths = []string{""}
+	}
+	var entries []copyEntry
+	for _, p := range paths {
+		rel := ""
+		if p != "" {
+			if rel = m.safeWorkspacePath(p); rel == "" {
+				return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidWorkspace, p)
+			}
+		}
+		start, err := filepath.EvalSymlinks(filepath.Join(realRoot, rel))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%w: %s", ErrFileNotFound, p)
+			}
+			return nil, fmt.Errorf("resolve path: %w", err)
+		}
+		within, err := filepath.Rel(realRoot, start)
+		if err != nil || within == ".." || strings.HasPrefix(within, ".."+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("path escapes workspace")
+		}
+		err = filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			sub, err := filepath.Rel(start, path)
+			if err != nil {
+				return err
+			}
+			e := copyEntry{rel: filepath.ToSlash(filepath.Join(rel, sub)), src: path}
+			if e.rel == "." {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			e.mode = info.Mode()
+			switch {
+			case d.Type()&fs.ModeSymlink != 0:
+				if e.target, err = os.Readlink(path); err != nil {
+					return err
+				}
+			case !d.IsDir() && !d.Type().IsRegular():
+				return nil // devices, sockets and pipes stay behind
+			}
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read workspace: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// copyEntryTo writes e below rootFD without following symlinks in the
+// destination.
+func copyEntryTo(rootFD int, e copyEntry, overwrite bool, result *CopyResult) error {
+	parts := strings.Split(e.rel, "/")
+	if e.mode.IsDir() {
+		fd, err := openDirNoFollow(rootFD, parts)
+		if err != nil {
+			return err
+		}
+		return unix.Close(fd)
+	}
+
+	dirFD, err := openDirNoFollow(rootFD, parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirFD)
+	name := parts[len(parts)-1]
+
+	if e.mode&fs.ModeSymlink != 0 {
+		if overwrite {
+			if err := unix.Unlinkat(dirFD, name, 0); err != nil && !errors.Is(err, unix.ENOENT) {
+				return err
+			}
+		}
+		if err := unix.Symlinkat(e.target, dirFD, name); err != nil {
+			return err
+		}
+		result.Files++
+		return nil
+	}
+
+	flags := unix.O_WRONLY | unix.O_CREAT | unix.O_CLOEXEC | unix.O_NOFOLLOW | unix.O_EXCL
+	if overwrite {
+		flags = unix.O_WRONLY | unix.O_CREAT | unix.O_CLOEXEC | unix.O_NOFOLLOW | unix.O_TRUNC
+	}
+	fd, err := unix.Openat(dirFD, name, flags, uint32(e.mode.Perm()))
+	if err != nil {
+		if errors.Is(err, unix.ELOOP) {
+			return fmt.Errorf("path escapes workspace")
+		}
+		return err
+	}
+	dst := os.NewFile(uintptr(fd), name)
+	defer dst.Close()
+
+	src, err := os.Open(e.src)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var n int64
+	if err := cloneFile(dst, src); err == nil {
+		info, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		n = info.Size()
+		result.Cloned++
+	} else if n, err = io.Copy(dst, src); err != nil {
+		return err
+	}
+	result.Files++
+	result.Bytes += n
+	return dst.Close()
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package session
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a reflink of src (FICLONE), sharing its extents on
+// filesystems that support it (btrfs, xfs).
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package session
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not available outside Linux; callers fall back to a copy.
+func cloneFile(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
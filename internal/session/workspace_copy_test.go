@@ -0,0 +1,89 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCopyManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	mgr, _, _ := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.cfg.Workspace.Enabled = true
+	root := filepath.Join(mgr.cfg.DataDir, "workspaces")
+	tmpl := filepath.Join(root, "template")
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpl, "src", "empty"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpl, "README.md"), []byte("# scaffold"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpl, "src", "run.sh"), []byte("echo hi"), 0755))
+	require.NoError(t, os.Symlink("src/run.sh", filepath.Join(tmpl, "run")))
+	return mgr, root
+}
+
+func TestCopyWorkspaceFiles_All(t *testing.T) {
+	mgr, root := newCopyManager(t)
+	ctx := context.Background()
+
+	res, err := mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "template"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Files)
+	assert.Equal(t, int64(len("# scaffold")+len("echo hi")), res.Bytes)
+
+	dst := filepath.Join(root, "project")
+	data, err := os.ReadFile(filepath.Join(dst, "src", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "echo hi", string(data))
+	info, err := os.Stat(filepath.Join(dst, "src", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.DirExists(t, filepath.Join(dst, "src", "empty"))
+	target, err := os.Readlink(filepath.Join(dst, "run"))
+	require.NoError(t, err)
+	assert.Equal(t, "src/run.sh", target)
+
+	// The copy is independent of the template.
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "README.md"), []byte("# mine"), 0644))
+	data, err = os.ReadFile(filepath.Join(root, "template", "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# scaffold", string(data))
+}
+
+func TestCopyWorkspaceFiles_Overwrite(t *testing.T) {
+	mgr, root := newCopyManager(t)
+	ctx := context.Background()
+	dst := filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(dst, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "README.md"), []byte("# mine"), 0644))
+
+	_, err := mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "template", Paths: []string{"README.md", "src"}})
+	assert.ErrorIs(t, err, ErrFileExists)
+	assert.NoDirExists(t, filepath.Join(dst, "src"), "nothing is written on conflict")
+
+	res, err := mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "template", Paths: []string{"README.md", "src"}, Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Files)
+	data, err := os.ReadFile(filepath.Join(dst, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# scaffold", string(data))
+	assert.NoFileExists(t, filepath.Join(dst, "run"))
+}
+
+func TestCopyWorkspaceFiles_Rejected(t *testing.T) {
+	mgr, root := newCopyManager(t)
+	ctx := context.Background()
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "template", "escape")))
+
+	_, err := mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "missing"})
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+	_, err = mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "template", Paths: []string{"nope.txt"}})
+	assert.ErrorIs(t, err, ErrFileNotFound)
+	_, err = mgr.CopyWorkspaceFiles(ctx, "template", CopyOpts{Src: "template"})
+	assert.ErrorIs(t, err, ErrInvalidWorkspace)
+	_, err = mgr.CopyWorkspaceFiles(ctx, "project", CopyOpts{Src: "template", Paths: []string{"escape"}})
+	assert.ErrorContains(t, err, "path escapes workspace")
+}
@@ -25,14 +25,17 @@ func (m *Manager) ListWorkspaceFiles(ctx context.Context, workspaceID, dirPath s
 		return nil, fmt.Errorf("workspaces not enabled")
 	}
 
-	shortID := m.normalizeWorkspaceID(workspaceID)
-	if shortID == "" {
-		return nil, fmt.Errorf("invalid workspace id")
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
 	}
 
-	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", shortID)
+	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
 	if _, err := os.Stat(workspacePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("workspace not found: %s", shortID)
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspaceID)
+	}
+	if err := m.unlockWorkspace(ctx, dirID); err != nil {
+		return nil, err
 	}
 
 	safePath := m.safeWorkspacePath(dirPath)
@@ -74,9 +77,9 @@ func (m *Manager) ReadWorkspaceFile(ctx context.Context, workspaceID, filePath s
 		return "", false, fmt.Errorf("workspaces not enabled")
 	}
 
-	shortID := m.normalizeWorkspaceID(workspaceID)
-	if shortID == "" {
-		return "", false, fmt.Errorf("invalid workspace id")
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return "", false, err
 	}
 
 	safePath := m.safeWorkspacePath(filePath)
@@ -84,7 +87,10 @@ func (m *Manager) ReadWorkspaceFile(ctx context.Context, workspaceID, filePath s
 		return "", false, fmt.Errorf("invalid file path")
 	}
 
-	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", shortID)
+	if err := m.unlockWorkspace(ctx, dirID); err != nil {
+		return "", false, err
+	}
+	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
 	fullPath := filepath.Join(workspacePath, safePath)
 
 	// Resolve symlinks and ensure the resolved path stays inside the workspace (prevents symlink escape).
@@ -140,9 +146,9 @@ func (m *Manager) WriteWorkspaceFile(ctx context.Context, workspaceID, filePath
 		return fmt.Errorf("workspaces not enabled")
 	}
 
-	shortID := m.normalizeWorkspaceID(workspaceID)
-	if shortID == "" {
-		return fmt.Errorf("invalid workspace id")
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return err
 	}
 
 	safePath := m.safeWorkspacePath(filePath)
@@ -150,7 +156,10 @@ func (m *Manager) WriteWorkspaceFile(ctx context.Context, workspaceID, filePath
 		return fmt.Errorf("invalid file path")
 	}
 
-	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", shortID)
+	if err := m.ensureWorkspace(ctx, dirID); err != nil {
+		return err
+	}
+	workspacePath := filepath.Join(m.cfg.DataDir, "workspaces", dirID)
 	if err := os.MkdirAll(workspacePath, 0755); err != nil {
 		return fmt.Errorf("create workspace directory: %w", err)
 	}
@@ -178,6 +187,10 @@ func (m *Manager) WriteWorkspaceFile(ctx context.Context, workspaceID, filePath
 		data = content
 	}
 
+	if err := m.scanContent(ctx, "", dirID, safePath, data, false); err != nil {
+		return err
+	}
+
 	if err := writeWorkspaceFileNoSymlinkTraversal(realWorkspacePath, safePath, data); err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
@@ -202,40 +215,11 @@ func writeWorkspaceFileNoSymlinkTraversal(rootPath, relPath string, data []byte)
 	}
 	defer unix.Close(rootFD)
 
-	currentFD := rootFD
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		if part == "" || part == "." || part == ".." {
-			return fmt.Errorf("invalid file path")
-		}
-
-		nextFD, openErr := unix.Openat(currentFD, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
-		if openErr != nil {
-			if errors.Is(openErr, unix.ENOENT) {
-				if mkErr := unix.Mkdirat(currentFD, part, 0755); mkErr != nil && !errors.Is(mkErr, unix.EEXIST) {
-					return fmt.Errorf("create directory %q: %w", part, mkErr)
-				}
-				nextFD, openErr = unix.Openat(currentFD, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
-			}
-			if openErr != nil {
-				if errors.Is(openErr, unix.ELOOP) {
-					return fmt.Errorf("path escapes workspace")
-				}
-				return fmt.Errorf("open directory %q: %w", part, openErr)
-			}
-		}
-
-		if currentFD != rootFD {
-			_ = unix.Close(currentFD)
-		}
-		currentFD = nextFD
+	currentFD, err := openDirNoFollow(rootFD, parts[:len(parts)-1])
+	if err != nil {
+		return err
 	}
-
-	defer func() {
-		if currentFD != rootFD {
-			_ = unix.Close(currentFD)
-		}
-	}()
+	defer unix.Close(currentFD)
 
 	fileFD, err := unix.Openat(currentFD, fileName, unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0644)
 	if err != nil {
@@ -260,6 +244,44 @@ func writeWorkspaceFileNoSymlinkTraversal(rootPath, relPath string, data []byte)
 	return nil
 }
 
+// openDirNoFollow opens the directory parts below rootFD, creating missing
+// directories, and fails if any part is a symlink. The caller closes the
+// returned descriptor.
+func openDirNoFollow(rootFD int, parts []string) (int, error) {
+	currentFD, err := unix.FcntlInt(uintptr(rootFD), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			_ = unix.Close(currentFD)
+			return -1, fmt.Errorf("invalid file path")
+		}
+
+		nextFD, openErr := unix.Openat(currentFD, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
+		if openErr != nil {
+			if errors.Is(openErr, unix.ENOENT) {
+				if mkErr := unix.Mkdirat(currentFD, part, 0755); mkErr != nil && !errors.Is(mkErr, unix.EEXIST) {
+					_ = unix.Close(currentFD)
+					return -1, fmt.Errorf("create directory %q: %w", part, mkErr)
+				}
+				nextFD, openErr = unix.Openat(currentFD, part, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0)
+			}
+			if openErr != nil {
+				_ = unix.Close(currentFD)
+				if errors.Is(openErr, unix.ELOOP) {
+					return -1, fmt.Errorf("path escapes workspace")
+				}
+				return -1, fmt.Errorf("open directory %q: %w", part, openErr)
+			}
+		}
+
+		_ = unix.Close(currentFD)
+		currentFD = nextFD
+	}
+	return currentFD, nil
+}
+
 func (m *Manager) normalizeWorkspaceID(workspaceID string) string {
 	short := strings.TrimPrefix(workspaceID, protocol.WorkspaceVolumePrefix)
 	if short != "" {
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	storemod "github.com/p-arndt/sandkasten/internal/store"
+)
+
+// WorkspaceUpdate changes a workspace's metadata. Nil fields are left alone.
+type WorkspaceUpdate struct {
+	Description *string
+	// Labels are merged into the workspace's labels; a nil value removes the key.
+	Labels map[string]*string
+}
+
+// recordWorkspace records who created a workspace and when. Metadata of an
+// existing workspace is kept; failures only cost the metadata.
+func (m *Manager) recordWorkspace(ctx context.Context, dirID string) {
+	if m.wsMeta == nil {
+		return
+	}
+	_ = m.wsMeta.AddWorkspace(&storemod.Workspace{
+		ID:        dirID,
+		KeyID:     keyIDFrom(ctx),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// forgetWorkspace removes the metadata of a deleted workspace.
+func (m *Manager) forgetWorkspace(dirID string) error {
+	if m.wsMeta == nil {
+		return nil
+	}
+	return m.wsMeta.DeleteWorkspace(dirID)
+}
+
+// workspaceMetadata returns the metadata and session use of all workspaces,
+// or nil maps when workspace metadata is disabled.
+func (m *Manager) workspaceMetadata() (map[string]*storemod.Workspace, map[string]storemod.WorkspaceUse, error) {
+	if m.wsMeta == nil {
+		return nil, nil, nil
+	}
+	meta, err := m.wsMeta.ListWorkspaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	usage, err := m.store.WorkspaceUsage()
+	if err != nil {
+		return nil, nil, err
+	}
+	return meta, usage, nil
+}
+
+// fillWorkspaceInfo adds the metadata of the workspace directory fi to info.
+// Like the retention janitor, it counts a workspace as last used when a
+// session using it was last active or its directory last changed, whichever
+// is later. Workspaces created before metadata was kept have none but that.
+func fillWorkspaceInfo(info *WorkspaceInfo, fi fs.FileInfo, meta *storemod.Workspace, use storemod.WorkspaceUse) {
+	lastUsed := fi.ModTime().UTC()
+	if use.LastActivity.After(lastUsed) {
+		lastUsed = use.LastActivity.UTC()
+	}
+	info.LastUsedAt = &lastUsed
+	if meta == nil {
+		return
+	}
+	createdAt := meta.CreatedAt.UTC()
+	info.Description = meta.Description
+	info.Labels = meta.Labels
+	info.KeyID = meta.KeyID
+	info.CreatedAt = &createdAt
+	info.SizeBytes = meta.SizeBytes
+}
+
+// GetWorkspace returns one of the caller's workspaces.
+func (m *Manager) GetWorkspace(ctx context.Context, workspaceID string) (*WorkspaceInfo, error) {
+	if !m.cfg.Workspace.Enabled {
+		return nil, fmt.Errorf("workspaces not enabled")
+	}
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(filepath.Join(m.cfg.DataDir, "workspaces", dirID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspaceID)
+		}
+		return nil, fmt.Errorf("read workspace: %w", err)
+	}
+	info := &WorkspaceInfo{ID: publicWorkspaceID(tenantFrom(ctx), dirID)}
+	if m.wsMeta == nil {
+		return info, nil
+	}
+	meta, err := m.wsMeta.GetWorkspace(dirID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := m.store.WorkspaceUsage()
+	if err != nil {
+		return nil, err
+	}
+	fillWorkspaceInfo(info, fi, meta, usage[dirID])
+	return info, nil
+}
+
+// UpdateWorkspace applies opts to one of the caller's workspaces and returns
+// its new state.
+func (m *Manager) UpdateWorkspace(ctx context.Context, workspaceID string, opts WorkspaceUpdate) (*WorkspaceInfo, error) {
+	info, err := m.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if m.wsMeta == nil {
+		return nil, fmt.Errorf("workspace metadata not enabled")
+	}
+	dirID, err := m.workspaceDirID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Description != nil {
+		info.Description = *opts.Description
+	}
+	if len(opts.Labels) > 0 {
+		labels := maps.Clone(info.Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(opts.Labels))
+		}
+		for k, v := range opts.Labels {
+			if v == nil {
+				delete(labels, k)
+			} else {
+				labels[k] = *v
+			}
+		}
+		if len(labels) > maxLabels {
+			return nil, fmt.Errorf("%w: at most %d labels per workspace", ErrInvalidWorkspace, maxLabels)
+		}
+		info.Labels = labels
+	}
+
+	ws := &storemod.Workspace{
+		ID:          dirID,
+		Description: info.Description,
+		Labels:      info.Labels,
+		KeyID:       keyIDFrom(ctx),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := m.wsMeta.UpdateWorkspace(ws); err != nil {
+		return nil, err
+	}
+	if info.CreatedAt == nil {
+		// Workspaces created before metadata was kept get it now.
+		info.KeyID = ws.KeyID
+		info.CreatedAt = &ws.CreatedAt
+	}
+	return info, nil
+}
+
+// RefreshWorkspaceSizes measures the size of the workspaces of all tenants
+// and records it in their metadata.
+func (m *Manager) RefreshWorkspaceSizes(ctx context.Context) error {
+	if !m.cfg.Workspace.Enabled || m.wsMeta == nil {
+		return nil
+	}
+	root := filepath.Join(m.cfg.DataDir, "workspaces")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read workspaces dir: %w", err)
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		size, err := dirSize(filepath.Join(root, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if err := m.wsMeta.SetWorkspaceSize(entry.Name(), size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirSize sums the sizes of the regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWorkspaceMetaManager(t *testing.T) (*Manager, *store.Store, string) {
+	t.Helper()
+	mgr, _, st := newTestManager()
+	mgr.cfg.DataDir = t.TempDir()
+	mgr.cfg.Workspace.Enabled = true
+	meta, err := store.New(":memory:", 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { meta.Close() })
+	mgr.SetWorkspaceStore(meta)
+	activity := time.Now().Add(time.Hour).UTC()
+	st.On("WorkspaceUsage").Return(map[string]store.WorkspaceUse{
+		"project": {LastActivity: activity},
+	}, nil)
+	root := filepath.Join(mgr.cfg.DataDir, "workspaces")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "project"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "project", "main.py"), []byte("print(1)"), 0644))
+	return mgr, meta, root
+}
+
+func TestWorkspaceMetadata(t *testing.T) {
+	mgr, _, _ := newWorkspaceMetaManager(t)
+	ctx := WithAPIKey(context.Background(), "sk-test")
+
+	mgr.recordWorkspace(ctx, "project")
+	require.NoError(t, mgr.RefreshWorkspaceSizes(ctx))
+
+	team := "data"
+	desc := "ETL scratch space"
+	ws, err := mgr.UpdateWorkspace(ctx, "project", WorkspaceUpdate{
+		Description: &desc,
+		Labels:      map[string]*string{"team": &team},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, desc, ws.Description)
+	assert.Equal(t, map[string]string{"team": "data"}, ws.Labels)
+
+	ws, err = mgr.GetWorkspace(ctx, "project")
+	require.NoError(t, err)
+	assert.Equal(t, desc, ws.Description)
+	assert.Equal(t, map[string]string{"team": "data"}, ws.Labels)
+	assert.Equal(t, KeyID("sk-test"), ws.KeyID)
+	assert.Equal(t, int64(len("print(1)")), ws.SizeBytes)
+	require.NotNil(t, ws.CreatedAt)
+	assert.WithinDuration(t, time.Now(), *ws.CreatedAt, time.Minute)
+	require.NotNil(t, ws.LastUsedAt)
+	assert.True(t, ws.LastUsedAt.After(time.Now()), "session activity is later than the directory mtime")
+
+	list, err := mgr.ListWorkspaces(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, desc, list[0].Description)
+
+	ws, err = mgr.UpdateWorkspace(ctx, "project", WorkspaceUpdate{Labels: map[string]*string{"team": nil}})
+	require.NoError(t, err)
+	assert.Empty(t, ws.Labels)
+	assert.Equal(t, desc, ws.Description)
+}
+
+func TestWorkspaceMetadata_NotFound(t *testing.T) {
+	mgr, _, _ := newWorkspaceMetaManager(t)
+
+	_, err := mgr.GetWorkspace(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+	desc := "x"
+	_, err = mgr.UpdateWorkspace(context.Background(), "missing", WorkspaceUpdate{Description: &desc})
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+}
+
+func TestWorkspaceMetadata_DeletedWithWorkspace(t *testing.T) {
+	mgr, meta, _ := newWorkspaceMetaManager(t)
+	ctx := context.Background()
+
+	mgr.recordWorkspace(ctx, "project")
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "project"))
+
+	ws, err := meta.GetWorkspace("project")
+	require.NoError(t, err)
+	assert.Nil(t, ws)
+}
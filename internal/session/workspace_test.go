@@ -2,12 +2,14 @@ package session
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/p-arndt/sandkasten/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -152,3 +154,40 @@ func TestWorkspaceFSDisabled(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "workspaces not enabled")
 }
+
+func TestWorkspaceManagerHooks(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{DataDir: dir, Workspace: config.WorkspaceConfig{Enabled: true}}
+	ws := &MockWorkspaceManager{}
+	mgr := NewManager(cfg, nil, nil, ws, nil)
+	ctx := context.Background()
+
+	// Writes let the manager create (and encrypt) a new workspace first.
+	ws.On("Exists", mock.Anything, "enc-ws").Return(false, nil).Once()
+	ws.On("Create", mock.Anything, "enc-ws", mock.Anything).Return(nil).Once()
+	require.NoError(t, mgr.WriteWorkspaceFile(ctx, "enc-ws", "a.txt", []byte("x"), false))
+
+	// Reads unlock an existing workspace.
+	ws.On("Exists", mock.Anything, "enc-ws").Return(true, nil).Twice()
+	_, _, err := mgr.ReadWorkspaceFile(ctx, "enc-ws", "a.txt", 0)
+	require.NoError(t, err)
+	_, err = mgr.ListWorkspaceFiles(ctx, "enc-ws", ".")
+	require.NoError(t, err)
+
+	ws.On("Delete", mock.Anything, "enc-ws").Return(nil).Once()
+	require.NoError(t, mgr.DeleteWorkspace(ctx, "enc-ws"))
+	ws.AssertExpectations(t)
+}
+
+func TestWorkspaceUnlockFailure(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{DataDir: dir, Workspace: config.WorkspaceConfig{Enabled: true}}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "workspaces", "locked"), 0755))
+	ws := &MockWorkspaceManager{}
+	ws.On("Exists", mock.Anything, "locked").Return(true, errors.New("different master key"))
+	mgr := NewManager(cfg, nil, nil, ws, nil)
+
+	_, err := mgr.ListWorkspaceFiles(context.Background(), "locked", ".")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "different master key")
+}
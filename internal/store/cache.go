@@ -0,0 +1,180 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+var (
+	cacheHits = metrics.Default.NewCounterVec("sandkasten_store_session_cache_hits_total",
+		"GetSession calls served from the in-memory session cache.")
+	cacheMisses = metrics.Default.NewCounterVec("sandkasten_store_session_cache_misses_total",
+		"GetSession calls that had to query SQLite.")
+	activityFlushes = metrics.Default.NewCounterVec("sandkasten_store_activity_flushed_total",
+		"Coalesced session activity updates written to SQLite.")
+)
+
+// sessionCache keeps rows of live sessions in memory and coalesces
+// last_activity/expires_at updates, which happen on every exec, into periodic
+// batched writes. Terminal sessions are never cached.
+type sessionCache struct {
+	mu    sync.Mutex
+	rows  map[string]*Session
+	dirty map[string]struct{}
+}
+
+// EnableSessionCache turns on the session cache. Activity updates for cached
+// sessions are written by FlushActivity, which the daemon runs every
+// db_activity_flush_ms, and always before queries that filter on expiry, so
+// the reaper never sees a stale lease. Must be called before the store is shared.
+func (s *Store) EnableSessionCache() {
+	s.cache = &sessionCache{
+		rows:  make(map[string]*Session),
+		dirty: make(map[string]struct{}),
+	}
+}
+
+// FlushActivity writes all pending activity updates in one transaction.
+func (s *Store) FlushActivity() error {
+	c := s.cache
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if len(c.dirty) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	pending := make([]Session, 0, len(c.dirty))
+	for id := range c.dirty {
+		if row, ok := c.rows[id]; ok {
+			pending = append(pending, *row)
+		}
+	}
+	c.dirty = make(map[string]struct{})
+	c.mu.Unlock()
+
+	defer s.observe("flush_activity", time.Now())
+	err := retryOnBusy("flush_activity", func() error {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, row := range pending {
+			if _, err := tx.Exec(
+				`UPDATE sessions SET cwd = ?, last_activity = ?, expires_at = ? WHERE id = ?`,
+				row.Cwd, row.LastActivity.UTC(), row.ExpiresAt.UTC(), row.ID,
+			); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		// Re-queue so the next flush retries; newer in-memory values still win.
+		c.mu.Lock()
+		for _, row := range pending {
+			if _, ok := c.rows[row.ID]; ok {
+				c.dirty[row.ID] = struct{}{}
+			}
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("flushing session activity: %w", err)
+	}
+	activityFlushes.Add(float64(len(pending)))
+	return nil
+}
+
+func isTerminalStatus(status string) bool {
+	switch status {
+	case "destroyed", "expired", "crashed":
+		return true
+	}
+	return false
+}
+
+// get returns a copy of the cached row.
+func (c *sessionCache) get(id string) (*Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *row
+	return &cp, true
+}
+
+func (c *sessionCache) put(sess *Session) {
+	if isTerminalStatus(sess.Status) {
+		return
+	}
+	cp := *sess
+	c.mu.Lock()
+	c.rows[sess.ID] = &cp
+	c.mu.Unlock()
+}
+
+// touch applies an activity update in memory. It reports false when the
+// session is not cached and the caller must write through.
+func (c *sessionCache) touch(id, cwd string, now, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[id]
+	if !ok {
+		return false
+	}
+	row.Cwd = cwd
+	row.LastActivity = now
+	row.ExpiresAt = expiresAt
+	c.dirty[id] = struct{}{}
+	return true
+}
+
+// setExpiry is touch for lease changes that are not activity: only expires_at
+// moves. It reports false when the session is not cached.
+func (c *sessionCache) setExpiry(id string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[id]
+	if !ok {
+		return false
+	}
+	row.ExpiresAt = expiresAt
+	c.dirty[id] = struct{}{}
+	return true
+}
+
+// update mutates a cached row in place, evicting it once terminal. It returns
+// the row's pending activity, if any, so eviction does not drop it.
+func (c *sessionCache) update(id string, fn func(*Session)) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[id]
+	if !ok {
+		return nil
+	}
+	fn(row)
+	if !isTerminalStatus(row.Status) {
+		return nil
+	}
+	delete(c.rows, id)
+	if _, dirty := c.dirty[id]; !dirty {
+		return nil
+	}
+	delete(c.dirty, id)
+	cp := *row
+	return &cp
+}
+
+func (c *sessionCache) remove(id string) {
+	c.mu.Lock()
+	delete(c.rows, id)
+	delete(c.dirty, id)
+	c.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxCreateFailures is how many create failures are kept; older ones are
+// dropped as new ones are recorded.
+const MaxCreateFailures = 50
+
+// CreateFailure is a failed sandbox create, kept so it can be debugged
+// without host access.
+type CreateFailure struct {
+	ID        int64     `json:"id"`
+	SessionID string    `json:"session_id"`
+	Image     string    `json:"image"`
+	Source    string    `json:"source"` // "create" or "pool"
+	Stage     string    `json:"stage,omitempty"`
+	Class     string    `json:"class"` // e.g. "image_missing", see runtime.CreateFailureClass
+	Error     string    `json:"error"`
+	Errno     string    `json:"errno,omitempty"`
+	Config    string    `json:"config,omitempty"`   // sandbox launch config (JSON)
+	LogTail   string    `json:"log_tail,omitempty"` // end of the sandbox init log
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AppendCreateFailure records f and drops all but the newest
+// MaxCreateFailures records.
+func (s *Store) AppendCreateFailure(f *CreateFailure) error {
+	defer s.observe("append_create_failure", time.Now())
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now().UTC()
+	}
+	err := retryOnBusy("append_create_failure", func() error {
+		result, e := s.db.Exec(
+			`INSERT INTO create_failures (session_id, image, source, stage, class, error, errno, config, log_tail, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.SessionID, f.Image, f.Source, f.Stage, f.Class, f.Error, f.Errno, f.Config, f.LogTail, f.CreatedAt.UTC(),
+		)
+		if e != nil {
+			return e
+		}
+		f.ID, _ = result.LastInsertId()
+		_, e = s.db.Exec(`DELETE FROM create_failures WHERE id <= ?`, f.ID-MaxCreateFailures)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("inserting create failure: %w", err)
+	}
+	return nil
+}
+
+// ListCreateFailures returns the newest failures first; limit <= 0 means all
+// that are kept.
+func (s *Store) ListCreateFailures(limit int) ([]*CreateFailure, error) {
+	defer s.observe("list_create_failures", time.Now())
+	if limit <= 0 {
+		limit = MaxCreateFailures
+	}
+	rows, err := s.db.Query(
+		`SELECT id, session_id, image, source, stage, class, error, errno, config, log_tail, created_at
+		 FROM create_failures ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing create failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []*CreateFailure{}
+	for rows.Next() {
+		var f CreateFailure
+		if err := rows.Scan(&f.ID, &f.SessionID, &f.Image, &f.Source, &f.Stage, &f.Class, &f.Error, &f.Errno,
+			&f.Config, &f.LogTail, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning create failure: %w", err)
+		}
+		failures = append(failures, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating create failures: %w", err)
+	}
+	return failures, nil
+}
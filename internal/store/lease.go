@@ -0,0 +1,72 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Lease is the daemon lease used for active/passive HA: only the holder of an
+// unexpired lease may run sessions out of the data dir.
+type Lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcquireLease takes or renews the daemon lease for holder until ttl from
+// now. It reports false, without error, while another holder's lease is
+// still valid.
+func (s *Store) AcquireLease(holder string, ttl time.Duration) (bool, error) {
+	defer s.observe("acquire_lease", time.Now())
+	now := time.Now()
+	var acquired bool
+	err := retryOnBusy("acquire_lease", func() error {
+		result, e := s.db.Exec(
+			`INSERT INTO daemon_lease (id, holder, expires_at) VALUES (1, ?, ?)
+			 ON CONFLICT(id) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+			 WHERE daemon_lease.holder = excluded.holder OR daemon_lease.expires_at < ?`,
+			holder, now.Add(ttl).UnixMilli(), now.UnixMilli(),
+		)
+		if e != nil {
+			return e
+		}
+		n, e := result.RowsAffected()
+		acquired = n > 0
+		return e
+	})
+	if err != nil {
+		return false, fmt.Errorf("acquiring lease: %w", err)
+	}
+	return acquired, nil
+}
+
+// ReleaseLease gives up the lease if holder still has it, so a standby can
+// take over without waiting for it to expire.
+func (s *Store) ReleaseLease(holder string) error {
+	defer s.observe("release_lease", time.Now())
+	err := retryOnBusy("release_lease", func() error {
+		_, e := s.db.Exec(`DELETE FROM daemon_lease WHERE id = 1 AND holder = ?`, holder)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("releasing lease: %w", err)
+	}
+	return nil
+}
+
+// GetLease returns the current lease, expired or not; nil if there is none.
+func (s *Store) GetLease() (*Lease, error) {
+	defer s.observe("get_lease", time.Now())
+	var l Lease
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT holder, expires_at FROM daemon_lease WHERE id = 1`).Scan(&l.Holder, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying lease: %w", err)
+	}
+	l.ExpiresAt = time.UnixMilli(expiresAt).UTC()
+	return &l, nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// MaintenanceOptions selects the optional, more expensive maintenance steps.
+type MaintenanceOptions struct {
+	// Vacuum rebuilds the whole database file. Blocks writers for its duration;
+	// also converts databases created before auto_vacuum=INCREMENTAL was enabled.
+	Vacuum bool
+	// FullIntegrityCheck runs integrity_check instead of the faster quick_check.
+	FullIntegrityCheck bool
+}
+
+// MaintenanceReport summarizes one maintenance run.
+type MaintenanceReport struct {
+	CheckpointBusy      bool          `json:"checkpoint_busy"`
+	WALFrames           int           `json:"wal_frames"`
+	CheckpointedFrames  int           `json:"checkpointed_frames"`
+	FreelistPagesBefore int           `json:"freelist_pages_before"`
+	FreelistPagesAfter  int           `json:"freelist_pages_after"`
+	Vacuumed            bool          `json:"vacuumed"`
+	IntegrityOK         bool          `json:"integrity_ok"`
+	IntegrityErrors     []string      `json:"integrity_errors,omitempty"`
+	Duration            time.Duration `json:"duration"`
+}
+
+// Maintenance checkpoints and truncates the WAL, releases free pages and
+// verifies database integrity. Safe to run while the daemon is serving.
+func (s *Store) Maintenance(ctx context.Context, opts MaintenanceOptions) (*MaintenanceReport, error) {
+	start := time.Now()
+	defer queryDuration.ObserveSince(start, "maintenance")
+	rep := &MaintenanceReport{}
+
+	// All pragmas below must run on the same connection.
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("maintenance: acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	var busy int
+	if err := conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &rep.WALFrames, &rep.CheckpointedFrames); err != nil {
+		return nil, fmt.Errorf("maintenance: wal checkpoint: %w", err)
+	}
+	rep.CheckpointBusy = busy != 0
+
+	if err := conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&rep.FreelistPagesBefore); err != nil {
+		return nil, fmt.Errorf("maintenance: freelist count: %w", err)
+	}
+
+	if opts.Vacuum {
+		if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			return nil, fmt.Errorf("maintenance: set auto_vacuum: %w", err)
+		}
+		if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+			return nil, fmt.Errorf("maintenance: vacuum: %w", err)
+		}
+		rep.Vacuumed = true
+	} else if _, err := conn.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return nil, fmt.Errorf("maintenance: incremental vacuum: %w", err)
+	}
+
+	if err := conn.QueryRowContext(ctx, "PRAGMA freelist_count").Scan(&rep.FreelistPagesAfter); err != nil {
+		return nil, fmt.Errorf("maintenance: freelist count: %w", err)
+	}
+
+	check := "PRAGMA quick_check"
+	if opts.FullIntegrityCheck {
+		check = "PRAGMA integrity_check"
+	}
+	rows, err := conn.QueryContext(ctx, check)
+	if err != nil {
+		return nil, fmt.Errorf("maintenance: integrity check: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("maintenance: integrity check: %w", err)
+		}
+		if line != "ok" {
+			rep.IntegrityErrors = append(rep.IntegrityErrors, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("maintenance: integrity check: %w", err)
+	}
+	rep.IntegrityOK = len(rep.IntegrityErrors) == 0
+
+	rep.Duration = time.Since(start)
+	return rep, nil
+}
+
+// MaintenancePass runs the periodic Maintenance of the daemon and fails if
+// the integrity check found problems.
+func (s *Store) MaintenancePass(ctx context.Context, logger *slog.Logger) error {
+	rep, err := s.Maintenance(ctx, MaintenanceOptions{})
+	if err != nil {
+		return err
+	}
+	logger.Debug("db maintenance",
+		"wal_frames", rep.WALFrames,
+		"checkpointed", rep.CheckpointedFrames,
+		"checkpoint_busy", rep.CheckpointBusy,
+		"freed_pages", rep.FreelistPagesBefore-rep.FreelistPagesAfter,
+		"duration", rep.Duration)
+	if !rep.IntegrityOK {
+		return fmt.Errorf("db integrity check failed: %s", strings.Join(rep.IntegrityErrors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/p-arndt/sandkasten/internal/metrics"
+)
+
+var (
+	queryDuration = metrics.Default.NewHistogramVec("sandkasten_store_query_duration_seconds",
+		"Duration of store operations, including busy retries.", nil, "op")
+	busyRetries = metrics.Default.NewCounterVec("sandkasten_store_busy_retries_total",
+		"Store operations retried after SQLITE_BUSY.", "op")
+	busyErrors = metrics.Default.NewCounterVec("sandkasten_store_busy_errors_total",
+		"Store operations that still hit SQLITE_BUSY after all retries.", "op")
+	slowQueries = metrics.Default.NewCounterVec("sandkasten_store_slow_queries_total",
+		"Store operations slower than the slow query threshold.", "op")
+)
+
+// SetSlowQueryLog logs every store operation slower than threshold at warn
+// level. A zero threshold or nil logger disables the log; metrics are always kept.
+func (s *Store) SetSlowQueryLog(threshold time.Duration, logger *slog.Logger) {
+	s.slowThreshold = threshold
+	s.logger = logger
+}
+
+// observe records the duration of op. Use as: defer s.observe("op", time.Now()).
+func (s *Store) observe(op string, start time.Time) {
+	d := time.Since(start)
+	queryDuration.Observe(d.Seconds(), op)
+	if s.slowThreshold <= 0 || d < s.slowThreshold {
+		return
+	}
+	slowQueries.Inc(op)
+	if s.logger != nil {
+		s.logger.Warn("slow store operation", "op", op, "duration_ms", d.Milliseconds(), "threshold_ms", s.slowThreshold.Milliseconds())
+	}
+}
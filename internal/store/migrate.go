@@ -0,0 +1,275 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations: NNNN_name.up.sql and
+// NNNN_name.down.sql, numbered from 0001 without gaps. Add a new pair for
+// every schema change; never edit a migration that has been released.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	// ErrSchemaTooNew is returned for a database migrated by a newer
+	// sandkasten than this one.
+	ErrSchemaTooNew = errors.New("database schema is newer than this build")
+	// ErrSchemaOutdated is returned by CheckSchema while migrations are
+	// pending.
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+)
+
+// Migration is one step of the schema.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"-"`
+	Down    string `json:"-"`
+}
+
+// AppliedMigration is a migration recorded in schema_version.
+type AppliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationStatus compares a database with the migrations of this build.
+type MigrationStatus struct {
+	Current int                `json:"current"`
+	Latest  int                `json:"latest"`
+	Applied []AppliedMigration `json:"applied"`
+	Pending []Migration        `json:"pending"`
+}
+
+const createSchemaVersionTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at DATETIME NOT NULL
+);
+`
+
+// legacyColumns are the columns databases from before versioned migrations
+// may lack; they were added by ALTER TABLE at every start back then.
+var legacyColumns = []struct{ table, column, def string }{
+	{"sessions", "init_pid", "INTEGER NOT NULL DEFAULT 0"},
+	{"sessions", "cgroup_path", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "image_digest", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "labels", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "key_id", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "tenant", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "hostname", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "shared_channel", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "group_id", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "determinism", "TEXT NOT NULL DEFAULT ''"},
+	{"create_failures", "class", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Migrations returns the migrations of this build in order.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %w", err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, dir, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		num, label, ok2 := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || !ok2 || err != nil || version <= 0 || (dir != "up" && dir != "down") {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", name, err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if dir == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+	}
+	return out, nil
+}
+
+// MigrationStatus reports the applied and pending migrations.
+func (s *Store) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, createSchemaVersionTableSQL); err != nil {
+		return nil, fmt.Errorf("creating schema_version: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_version: %w", err)
+	}
+	defer rows.Close()
+	st := &MigrationStatus{Latest: len(migrations), Applied: []AppliedMigration{}, Pending: []Migration{}}
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("reading schema_version: %w", err)
+		}
+		st.Applied = append(st.Applied, a)
+		st.Current = max(st.Current, a.Version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading schema_version: %w", err)
+	}
+	if st.Current < st.Latest {
+		st.Pending = migrations[st.Current:]
+	}
+	return st, nil
+}
+
+// CheckSchema returns ErrSchemaOutdated while migrations are pending and
+// ErrSchemaTooNew if the database has migrations this build lacks.
+func (s *Store) CheckSchema(ctx context.Context) error {
+	st, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case st.Current > st.Latest:
+		return fmt.Errorf("%w: version %d, this build knows %d", ErrSchemaTooNew, st.Current, st.Latest)
+	case st.Current < st.Latest:
+		return fmt.Errorf("%w: version %d, %d migration(s) pending; run `sandkasten db migrate`", ErrSchemaOutdated, st.Current, len(st.Pending))
+	}
+	return nil
+}
+
+// Migrate applies up or down migrations until the schema is at version
+// target (-1 = latest) and returns the migrations it ran, in order. Each
+// migration runs in a transaction with its schema_version change.
+func (s *Store) Migrate(ctx context.Context, target int) ([]Migration, error) {
+	st, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.Current > st.Latest {
+		return nil, fmt.Errorf("%w: version %d, this build knows %d", ErrSchemaTooNew, st.Current, st.Latest)
+	}
+	if target < 0 {
+		target = st.Latest
+	}
+	if target > st.Latest {
+		return nil, fmt.Errorf("no migration %d; the latest is %d", target, st.Latest)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if st.Current == 0 && target > 0 {
+		if err := s.adoptLegacySchema(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var ran []Migration
+	for v := st.Current; v < target; v++ {
+		m := migrations[v]
+		if err := s.runMigration(ctx, m.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return ran, fmt.Errorf("migration %04d_%s up: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	for v := st.Current; v > target; v-- {
+		m := migrations[v-1]
+		if err := s.runMigration(ctx, m.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version = ?`, m.Version)
+			return err
+		}); err != nil {
+			return ran, fmt.Errorf("migration %04d_%s down: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+func (s *Store) runMigration(ctx context.Context, script string, record func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("recording version: %w", err)
+	}
+	return tx.Commit()
+}
+
+// adoptLegacySchema adds the columns a database from before versioned
+// migrations may lack, so the baseline migration finds the schema it
+// creates. Databases without the tables are left alone.
+func (s *Store) adoptLegacySchema(ctx context.Context) error {
+	for _, c := range legacyColumns {
+		rows, err := s.db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, c.table)
+		if err != nil {
+			return fmt.Errorf("reading columns of %s: %w", c.table, err)
+		}
+		exists, found := false, false
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return fmt.Errorf("reading columns of %s: %w", c.table, err)
+			}
+			exists = true
+			found = found || name == c.column
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("reading columns of %s: %w", c.table, err)
+		}
+		if !exists || found {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.def)); err != nil {
+			return fmt.Errorf("adding %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
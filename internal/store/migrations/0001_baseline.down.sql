@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS workspaces;
+DROP TABLE IF EXISTS daemon_lease;
+DROP TABLE IF EXISTS create_failures;
+DROP TABLE IF EXISTS usage_records;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,83 @@
+-- Schema as of the introduction of versioned migrations. Databases created
+-- before then are brought up to it by adoptLegacySchema first, so every
+-- statement here must be idempotent.
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id            TEXT PRIMARY KEY,
+	image         TEXT NOT NULL,
+	init_pid      INTEGER NOT NULL DEFAULT 0,
+	cgroup_path   TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL DEFAULT 'running',
+	cwd           TEXT NOT NULL DEFAULT '/workspace',
+	workspace_id  TEXT,
+	image_digest  TEXT NOT NULL DEFAULT '',
+	hostname      TEXT NOT NULL DEFAULT '',
+	shared_channel TEXT NOT NULL DEFAULT '',
+	group_id      TEXT NOT NULL DEFAULT '',
+	labels        TEXT NOT NULL DEFAULT '',
+	determinism   TEXT NOT NULL DEFAULT '',
+	key_id        TEXT NOT NULL DEFAULT '',
+	tenant        TEXT NOT NULL DEFAULT '',
+	created_at    DATETIME NOT NULL,
+	expires_at    DATETIME NOT NULL,
+	last_activity DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_status ON sessions(status);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_workspace_id ON sessions(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_group_id ON sessions(group_id);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL DEFAULT '',
+	action     TEXT NOT NULL,
+	detail     TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_session_id ON audit_events(session_id);
+
+CREATE TABLE IF NOT EXISTS usage_records (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind              TEXT NOT NULL,
+	session_id        TEXT NOT NULL,
+	key_id            TEXT NOT NULL DEFAULT '',
+	image             TEXT NOT NULL DEFAULT '',
+	cpu_usec          INTEGER NOT NULL DEFAULT 0,
+	wall_ms           INTEGER NOT NULL DEFAULT 0,
+	bytes_in          INTEGER NOT NULL DEFAULT 0,
+	bytes_out         INTEGER NOT NULL DEFAULT 0,
+	peak_memory_bytes INTEGER NOT NULL DEFAULT 0,
+	created_at        DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_usage_records_created_at ON usage_records(created_at);
+
+CREATE TABLE IF NOT EXISTS create_failures (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL DEFAULT '',
+	image      TEXT NOT NULL DEFAULT '',
+	source     TEXT NOT NULL DEFAULT '',
+	stage      TEXT NOT NULL DEFAULT '',
+	class      TEXT NOT NULL DEFAULT '',
+	error      TEXT NOT NULL DEFAULT '',
+	errno      TEXT NOT NULL DEFAULT '',
+	config     TEXT NOT NULL DEFAULT '',
+	log_tail   TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
+
+-- expires_at is unix milliseconds so expiry can be compared in SQL.
+CREATE TABLE IF NOT EXISTS daemon_lease (
+	id         INTEGER PRIMARY KEY CHECK (id = 1),
+	holder     TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+	id              TEXT PRIMARY KEY,
+	description     TEXT NOT NULL DEFAULT '',
+	labels          TEXT NOT NULL DEFAULT '',
+	key_id          TEXT NOT NULL DEFAULT '',
+	created_at      DATETIME NOT NULL,
+	size_bytes      INTEGER NOT NULL DEFAULT 0,
+	size_updated_at DATETIME
+);
@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN cpu TEXT NOT NULL DEFAULT '';
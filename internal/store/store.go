@@ -1,13 +1,18 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
+
+	"github.com/p-arndt/sandkasten/internal/failpoint"
 )
 
 // Sentinel errors
@@ -26,9 +31,13 @@ func isBusyLock(err error) bool {
 }
 
 // retryOnBusy runs fn and retries on SQLITE_BUSY with exponential backoff.
-func retryOnBusy(fn func() error) error {
+// op labels the retry metrics.
+func retryOnBusy(op string, fn func() error) error {
 	const maxAttempts = 4
 	backoff := 25 * time.Millisecond
+	if err := failpoint.Inject(failpoint.StoreWrite); err != nil {
+		return err
+	}
 	var lastErr error
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		lastErr = fn()
@@ -36,10 +45,12 @@ func retryOnBusy(fn func() error) error {
 			return lastErr
 		}
 		if attempt < maxAttempts-1 {
+			busyRetries.Inc(op)
 			time.Sleep(backoff)
 			backoff *= 2
 		}
 	}
+	busyErrors.Inc(op)
 	return lastErr
 }
 
@@ -48,44 +59,44 @@ func retryOnBusy(fn func() error) error {
 const StatusPoolIdle = "pool_idle"
 
 type Session struct {
-	ID           string    `json:"id"`
-	Image        string    `json:"image"`
-	InitPID      int       `json:"init_pid"`
-	CgroupPath   string    `json:"cgroup_path"`
-	Status       string    `json:"status"`
-	Cwd          string    `json:"cwd"`
-	WorkspaceID  string    `json:"workspace_id,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	LastActivity time.Time `json:"last_activity,omitempty"`
+	ID            string            `json:"id"`
+	Image         string            `json:"image"`
+	InitPID       int               `json:"init_pid"`
+	CgroupPath    string            `json:"cgroup_path"`
+	Status        string            `json:"status"`
+	Cwd           string            `json:"cwd"`
+	WorkspaceID   string            `json:"workspace_id,omitempty"`
+	ImageDigest   string            `json:"image_digest,omitempty"`
+	Hostname      string            `json:"hostname,omitempty"`       // "" = derived from the session ID
+	SharedChannel string            `json:"shared_channel,omitempty"` // tenant-scoped channel mounted at /shared
+	GroupID       string            `json:"group_id,omitempty"`       // session group created together
+	Labels        map[string]string `json:"labels,omitempty"`
+	KeyID         string            `json:"key_id,omitempty"` // fingerprint of the API key that created it
+	Tenant        string            `json:"tenant,omitempty"` // "" = default tenant
+	CreatedAt     time.Time         `json:"created_at"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+	LastActivity  time.Time         `json:"last_activity,omitempty"`
+	Determinism   string            `json:"determinism,omitempty"` // JSON of the session's runtime.Determinism; "" = none
+	CPU           string            `json:"cpu,omitempty"`         // JSON of the session's runtime.CPUTuning; "" = cgroup defaults
+}
+
+// AuditEvent is a security-relevant decision (e.g. a rejected exec).
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	SessionID string    `json:"session_id,omitempty"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Store struct {
 	db *sql.DB
-}
 
-const createTableSQL = `
-CREATE TABLE IF NOT EXISTS sessions (
-	id            TEXT PRIMARY KEY,
-	image         TEXT NOT NULL,
-	init_pid      INTEGER NOT NULL DEFAULT 0,
-	cgroup_path   TEXT NOT NULL DEFAULT '',
-	status        TEXT NOT NULL DEFAULT 'running',
-	cwd           TEXT NOT NULL DEFAULT '/workspace',
-	workspace_id  TEXT,
-	created_at    DATETIME NOT NULL,
-	expires_at    DATETIME NOT NULL,
-	last_activity DATETIME NOT NULL
-);
-CREATE INDEX IF NOT EXISTS idx_sessions_status ON sessions(status);
-CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
-CREATE INDEX IF NOT EXISTS idx_sessions_workspace_id ON sessions(workspace_id);
-`
-
-const migrateAddRuntimeFieldsSQL = `
-ALTER TABLE sessions ADD COLUMN init_pid INTEGER NOT NULL DEFAULT 0;
-ALTER TABLE sessions ADD COLUMN cgroup_path TEXT NOT NULL DEFAULT '';
-`
+	slowThreshold time.Duration
+	logger        *slog.Logger
+
+	cache *sessionCache // nil = disabled; see EnableSessionCache
+}
 
 // DefaultMaxOpenConns is the default connection pool size for concurrent reads.
 // WAL mode allows multiple readers + 1 writer; more conns improve read throughput.
@@ -100,17 +111,35 @@ func dsnWithPragmas(dbPath string) string {
 	// synchronous=NORMAL: safe in WAL, ~50x faster writes than FULL
 	// cache_size=-64000: 64MB page cache
 	// temp_store=MEMORY: temp tables in RAM
+	// auto_vacuum=INCREMENTAL: lets Maintenance return free pages to the OS
+	// (only takes effect on new databases or after a full VACUUM)
 	return dbPath + "?_pragma=busy_timeout(15000)" +
+		"&_pragma=auto_vacuum(INCREMENTAL)" +
 		"&_pragma=journal_mode(WAL)" +
 		"&_pragma=synchronous(NORMAL)" +
 		"&_pragma=cache_size(-64000)" +
 		"&_pragma=temp_store(MEMORY)"
 }
 
-// New opens the store. maxOpenConns controls the connection pool size (0 = default 4).
+// New opens the store and migrates its schema to the latest version.
+// maxOpenConns controls the connection pool size (0 = default 4).
 // For high scale: 4–8 allows concurrent reads while writers serialize; SQLite remains
 // single-writer. For very high write throughput, consider PostgreSQL.
 func New(dbPath string, maxOpenConns int) (*Store, error) {
+	s, err := Open(dbPath, maxOpenConns)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Migrate(context.Background(), -1); err != nil {
+		s.db.Close()
+		return nil, fmt.Errorf("running migrations: %w", err)
+	}
+	return s, nil
+}
+
+// Open opens the store without touching its schema; see CheckSchema and
+// Migrate.
+func Open(dbPath string, maxOpenConns int) (*Store, error) {
 	dsn := dsnWithPragmas(dbPath)
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
@@ -123,48 +152,61 @@ func New(dbPath string, maxOpenConns int) (*Store, error) {
 	db.SetMaxOpenConns(maxOpenConns)
 	db.SetMaxIdleConns(maxOpenConns)
 
-	if _, err := db.Exec(createTableSQL); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("running migrations: %w", err)
-	}
-
-	// Run migration for runtime fields (idempotent)
-	db.Exec(migrateAddRuntimeFieldsSQL) // Ignore error if columns exist
-
 	return &Store{db: db}, nil
 }
 
 func (s *Store) Close() error {
+	s.FlushActivity()
 	return s.db.Close()
 }
 
 func (s *Store) CreateSession(sess *Session) error {
-	err := retryOnBusy(func() error {
+	defer s.observe("create_session", time.Now())
+	err := retryOnBusy("create_session", func() error {
 		_, e := s.db.Exec(
-			`INSERT INTO sessions (id, image, init_pid, cgroup_path, status, cwd, workspace_id, created_at, expires_at, last_activity)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			sess.ID, sess.Image, sess.InitPID, sess.CgroupPath, sess.Status, sess.Cwd, sess.WorkspaceID,
-			sess.CreatedAt.UTC(), sess.ExpiresAt.UTC(), sess.LastActivity.UTC(),
+			`INSERT INTO sessions (id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sess.ID, sess.Image, sess.InitPID, sess.CgroupPath, sess.Status, sess.Cwd, sess.WorkspaceID, sess.ImageDigest, sess.Hostname, sess.SharedChannel, sess.GroupID,
+			encodeLabels(sess.Labels), sess.Determinism, sess.CPU, sess.KeyID, sess.Tenant, sess.CreatedAt.UTC(), sess.ExpiresAt.UTC(), sess.LastActivity.UTC(),
 		)
 		return e
 	})
 	if err != nil {
 		return fmt.Errorf("inserting session: %w", err)
 	}
+	if s.cache != nil {
+		s.cache.put(sess)
+	}
 	return nil
 }
 
 func (s *Store) GetSession(id string) (*Session, error) {
+	defer s.observe("get_session", time.Now())
+	if s.cache != nil {
+		if sess, ok := s.cache.get(id); ok {
+			cacheHits.Inc()
+			return sess, nil
+		}
+		cacheMisses.Inc()
+	}
 	row := s.db.QueryRow(
-		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, created_at, expires_at, last_activity
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
 		 FROM sessions WHERE id = ?`, id,
 	)
-	return scanSession(row)
+	sess, err := scanSession(row)
+	if err == nil && sess != nil && s.cache != nil {
+		s.cache.put(sess)
+	}
+	return sess, err
 }
 
 func (s *Store) ListSessions() ([]*Session, error) {
+	defer s.observe("list_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
 	rows, err := s.db.Query(
-		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, created_at, expires_at, last_activity
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
 		 FROM sessions ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -174,9 +216,47 @@ func (s *Store) ListSessions() ([]*Session, error) {
 	return scanSessions(rows)
 }
 
+// ListGroupSessions returns the members of a session group, oldest first.
+func (s *Store) ListGroupSessions(groupID string) ([]*Session, error) {
+	defer s.observe("list_group_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
+		 FROM sessions WHERE group_id = ? ORDER BY created_at, id`, groupID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing group sessions: %w", err)
+	}
+	defer rows.Close()
+	return scanSessions(rows)
+}
+
+// ListTenantSessions is ListSessions restricted to one tenant.
+func (s *Store) ListTenantSessions(tenant string) ([]*Session, error) {
+	defer s.observe("list_tenant_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
+		 FROM sessions WHERE tenant = ? ORDER BY created_at DESC`, tenant,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing tenant sessions: %w", err)
+	}
+	defer rows.Close()
+	return scanSessions(rows)
+}
+
 func (s *Store) UpdateSessionActivity(id string, cwd string, expiresAt time.Time) error {
+	defer s.observe("update_session_activity", time.Now())
+	if s.cache != nil && s.cache.touch(id, cwd, time.Now().UTC(), expiresAt.UTC()) {
+		return nil
+	}
 	var result sql.Result
-	err := retryOnBusy(func() error {
+	err := retryOnBusy("update_session_activity", func() error {
 		var e error
 		result, e = s.db.Exec(
 			`UPDATE sessions SET cwd = ?, last_activity = ?, expires_at = ? WHERE id = ?`,
@@ -191,8 +271,9 @@ func (s *Store) UpdateSessionActivity(id string, cwd string, expiresAt time.Time
 }
 
 func (s *Store) UpdateSessionStatus(id string, status string) error {
+	defer s.observe("update_session_status", time.Now())
 	var result sql.Result
-	err := retryOnBusy(func() error {
+	err := retryOnBusy("update_session_status", func() error {
 		var e error
 		result, e = s.db.Exec(
 			`UPDATE sessions SET status = ? WHERE id = ?`, status, id,
@@ -202,12 +283,23 @@ func (s *Store) UpdateSessionStatus(id string, status string) error {
 	if err != nil {
 		return fmt.Errorf("updating session status: %w", err)
 	}
-	return checkRowAffected(result, id)
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		// Persist activity still pending for a session leaving the cache.
+		if pending := s.cache.update(id, func(row *Session) { row.Status = status }); pending != nil {
+			s.db.Exec(`UPDATE sessions SET cwd = ?, last_activity = ?, expires_at = ? WHERE id = ?`,
+				pending.Cwd, pending.LastActivity.UTC(), pending.ExpiresAt.UTC(), id)
+		}
+	}
+	return nil
 }
 
 func (s *Store) UpdateSessionWorkspace(id string, workspaceID string) error {
+	defer s.observe("update_session_workspace", time.Now())
 	var result sql.Result
-	err := retryOnBusy(func() error {
+	err := retryOnBusy("update_session_workspace", func() error {
 		var e error
 		result, e = s.db.Exec(
 			`UPDATE sessions SET workspace_id = ? WHERE id = ?`, workspaceID, id,
@@ -217,12 +309,181 @@ func (s *Store) UpdateSessionWorkspace(id string, workspaceID string) error {
 	if err != nil {
 		return fmt.Errorf("updating session workspace: %w", err)
 	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.WorkspaceID = workspaceID })
+	}
+	return nil
+}
+
+// UpdateSessionSharedChannel records the shared channel attached to the session.
+func (s *Store) UpdateSessionSharedChannel(id string, channel string) error {
+	defer s.observe("update_session_shared_channel", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_shared_channel", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`UPDATE sessions SET shared_channel = ? WHERE id = ?`, channel, id,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session shared channel: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.SharedChannel = channel })
+	}
+	return nil
+}
+
+// UpdateSessionGroup records the group the session belongs to.
+func (s *Store) UpdateSessionGroup(id string, groupID string) error {
+	defer s.observe("update_session_group", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_group", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`UPDATE sessions SET group_id = ? WHERE id = ?`, groupID, id,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session group: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.GroupID = groupID })
+	}
+	return nil
+}
+
+// UpdateSessionImage records the image and sandbox of a session that was
+// restarted on another image.
+func (s *Store) UpdateSessionImage(id, image, imageDigest string, initPID int, cgroupPath string) error {
+	defer s.observe("update_session_image", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_image", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`UPDATE sessions SET image = ?, image_digest = ?, init_pid = ?, cgroup_path = ? WHERE id = ?`,
+			image, imageDigest, initPID, cgroupPath, id,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session image: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) {
+			row.Image, row.ImageDigest, row.InitPID, row.CgroupPath = image, imageDigest, initPID, cgroupPath
+		})
+	}
+	return nil
+}
+
+// UpdateSessionCPU records the CPU tuning (JSON) applied to the session.
+func (s *Store) UpdateSessionCPU(id, cpu string) error {
+	defer s.observe("update_session_cpu", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_cpu", func() error {
+		var e error
+		result, e = s.db.Exec(`UPDATE sessions SET cpu = ? WHERE id = ?`, cpu, id)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session cpu: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.CPU = cpu })
+	}
+	return nil
+}
+
+// UpdateSessionExpiry moves the session's lease end without recording activity.
+func (s *Store) UpdateSessionExpiry(id string, expiresAt time.Time) error {
+	defer s.observe("update_session_expiry", time.Now())
+	if s.cache != nil && s.cache.setExpiry(id, expiresAt.UTC()) {
+		return nil
+	}
+	var result sql.Result
+	err := retryOnBusy("update_session_expiry", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`UPDATE sessions SET expires_at = ? WHERE id = ?`, expiresAt.UTC(), id,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session expiry: %w", err)
+	}
 	return checkRowAffected(result, id)
 }
 
+// UpdateSessionLabels replaces the session's labels.
+func (s *Store) UpdateSessionLabels(id string, labels map[string]string) error {
+	defer s.observe("update_session_labels", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_labels", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`UPDATE sessions SET labels = ? WHERE id = ?`, encodeLabels(labels), id,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session labels: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.Labels = labels })
+	}
+	return nil
+}
+
+// UpdateSessionOwner records the API key and tenant a pooled session was
+// handed to.
+func (s *Store) UpdateSessionOwner(id string, keyID, tenant string) error {
+	defer s.observe("update_session_owner", time.Now())
+	var result sql.Result
+	err := retryOnBusy("update_session_owner", func() error {
+		var e error
+		result, e = s.db.Exec(`UPDATE sessions SET key_id = ?, tenant = ? WHERE id = ?`, keyID, tenant, id)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating session owner: %w", err)
+	}
+	if err := checkRowAffected(result, id); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.update(id, func(row *Session) { row.KeyID, row.Tenant = keyID, tenant })
+	}
+	return nil
+}
+
 func (s *Store) ListExpiredSessions() ([]*Session, error) {
+	defer s.observe("list_expired_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
 	rows, err := s.db.Query(
-		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, created_at, expires_at, last_activity
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
 		 FROM sessions WHERE status = 'running' AND expires_at <= ?`,
 		time.Now().UTC(),
 	)
@@ -234,8 +495,12 @@ func (s *Store) ListExpiredSessions() ([]*Session, error) {
 }
 
 func (s *Store) ListRunningSessions() ([]*Session, error) {
+	defer s.observe("list_running_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
 	rows, err := s.db.Query(
-		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, created_at, expires_at, last_activity
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
 		 FROM sessions WHERE status = 'running'`,
 	)
 	if err != nil {
@@ -245,9 +510,95 @@ func (s *Store) ListRunningSessions() ([]*Session, error) {
 	return scanSessions(rows)
 }
 
+// WorkspaceUse is how sessions have used a workspace.
+type WorkspaceUse struct {
+	LastActivity time.Time // newest last_activity of its sessions
+	InUse        bool      // a session using it is not torn down yet
+}
+
+// WorkspaceUsage returns the use of every workspace that sessions in the
+// store have mounted, keyed by workspace directory ID.
+func (s *Store) WorkspaceUsage() (map[string]WorkspaceUse, error) {
+	defer s.observe("workspace_usage", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT workspace_id, status, last_activity FROM sessions WHERE workspace_id != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("listing workspace usage: %w", err)
+	}
+	defer rows.Close()
+	usage := make(map[string]WorkspaceUse)
+	for rows.Next() {
+		var id, status string
+		var lastActivity time.Time
+		if err := rows.Scan(&id, &status, &lastActivity); err != nil {
+			return nil, fmt.Errorf("scanning workspace usage: %w", err)
+		}
+		u := usage[id]
+		if lastActivity.After(u.LastActivity) {
+			u.LastActivity = lastActivity
+		}
+		switch status {
+		case "destroyed", "expired", "crashed":
+		default:
+			u.InUse = true
+		}
+		usage[id] = u
+	}
+	return usage, rows.Err()
+}
+
+// SharedChannelSessions counts the sessions that still use a shared channel,
+// i.e. are neither destroyed, expired nor crashed.
+func (s *Store) SharedChannelSessions(channel string) (int, error) {
+	defer s.observe("shared_channel_sessions", time.Now())
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM sessions WHERE shared_channel = ? AND status NOT IN ('destroyed', 'expired', 'crashed')`, channel,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("counting shared channel sessions: %w", err)
+	}
+	return n, nil
+}
+
+// ActiveSessions counts the sessions handed out to callers, i.e. neither
+// idle in the pool nor destroyed, expired or crashed.
+func (s *Store) ActiveSessions() (int, error) {
+	defer s.observe("active_sessions", time.Now())
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM sessions WHERE status NOT IN ('pool_idle', 'destroyed', 'expired', 'crashed')`,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("counting active sessions: %w", err)
+	}
+	return n, nil
+}
+
+// ListPoolIdleSessions returns pre-warmed sessions waiting in the pool, oldest first.
+func (s *Store) ListPoolIdleSessions() ([]*Session, error) {
+	defer s.observe("list_pool_idle_sessions", time.Now())
+	if err := s.FlushActivity(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(
+		`SELECT id, image, init_pid, cgroup_path, status, cwd, workspace_id, image_digest, hostname, shared_channel, group_id, labels, determinism, cpu, key_id, tenant, created_at, expires_at, last_activity
+		 FROM sessions WHERE status = ? ORDER BY created_at`,
+		StatusPoolIdle,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing pool idle sessions: %w", err)
+	}
+	defer rows.Close()
+	return scanSessions(rows)
+}
+
 func (s *Store) DeleteSession(id string) error {
+	defer s.observe("delete_session", time.Now())
 	var result sql.Result
-	err := retryOnBusy(func() error {
+	err := retryOnBusy("delete_session", func() error {
 		var e error
 		result, e = s.db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
 		return e
@@ -255,9 +606,71 @@ func (s *Store) DeleteSession(id string) error {
 	if err != nil {
 		return fmt.Errorf("deleting session: %w", err)
 	}
+	if s.cache != nil {
+		s.cache.remove(id)
+	}
 	return checkRowAffected(result, id)
 }
 
+func (s *Store) AppendAuditEvent(ev *AuditEvent) error {
+	defer s.observe("append_audit_event", time.Now())
+	if ev.CreatedAt.IsZero() {
+		ev.CreatedAt = time.Now().UTC()
+	}
+	var result sql.Result
+	err := retryOnBusy("append_audit_event", func() error {
+		var e error
+		result, e = s.db.Exec(
+			`INSERT INTO audit_events (session_id, action, detail, created_at) VALUES (?, ?, ?, ?)`,
+			ev.SessionID, ev.Action, ev.Detail, ev.CreatedAt.UTC(),
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("inserting audit event: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		ev.ID = id
+	}
+	return nil
+}
+
+// ListAuditEvents returns the newest events first. An empty sessionID lists all
+// sessions; limit <= 0 means 100.
+func (s *Store) ListAuditEvents(sessionID string, limit int) ([]*AuditEvent, error) {
+	defer s.observe("list_audit_events", time.Now())
+	if limit <= 0 {
+		limit = 100
+	}
+	query := `SELECT id, session_id, action, detail, created_at FROM audit_events`
+	args := []any{}
+	if sessionID != "" {
+		query += ` WHERE session_id = ?`
+		args = append(args, sessionID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		var ev AuditEvent
+		if err := rows.Scan(&ev.ID, &ev.SessionID, &ev.Action, &ev.Detail, &ev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning audit event: %w", err)
+		}
+		events = append(events, &ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating audit events: %w", err)
+	}
+	return events, nil
+}
+
 type scannable interface {
 	Scan(dest ...any) error
 }
@@ -265,9 +678,10 @@ type scannable interface {
 func scanSession(row scannable) (*Session, error) {
 	var sess Session
 	var workspaceID sql.NullString
+	var labels string
 	err := row.Scan(
 		&sess.ID, &sess.Image, &sess.InitPID, &sess.CgroupPath, &sess.Status, &sess.Cwd,
-		&workspaceID, &sess.CreatedAt, &sess.ExpiresAt, &sess.LastActivity,
+		&workspaceID, &sess.ImageDigest, &sess.Hostname, &sess.SharedChannel, &sess.GroupID, &labels, &sess.Determinism, &sess.CPU, &sess.KeyID, &sess.Tenant, &sess.CreatedAt, &sess.ExpiresAt, &sess.LastActivity,
 	)
 	if workspaceID.Valid {
 		sess.WorkspaceID = workspaceID.String
@@ -278,9 +692,23 @@ func scanSession(row scannable) (*Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("scanning session: %w", err)
 	}
+	if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &sess.Labels); err != nil {
+			return nil, fmt.Errorf("decoding session labels: %w", err)
+		}
+	}
 	return &sess, nil
 }
 
+// encodeLabels stores labels as a JSON object, or an empty string for none.
+func encodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
 func scanSessions(rows *sql.Rows) ([]*Session, error) {
 	var sessions []*Session
 	for rows.Next() {
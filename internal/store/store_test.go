@@ -1,9 +1,16 @@
 package store
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/p-arndt/sandkasten/internal/failpoint"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +41,8 @@ func testSession(id string) *Session {
 func TestCreateAndGetSession(t *testing.T) {
 	st := newTestStore(t)
 	sess := testSession("test-1")
+	sess.ImageDigest = "sha256:abc"
+	sess.Hostname = "build-box"
 
 	require.NoError(t, st.CreateSession(sess))
 
@@ -47,6 +56,8 @@ func TestCreateAndGetSession(t *testing.T) {
 	assert.Equal(t, sess.CgroupPath, got.CgroupPath)
 	assert.Equal(t, sess.Status, got.Status)
 	assert.Equal(t, sess.Cwd, got.Cwd)
+	assert.Equal(t, "sha256:abc", got.ImageDigest)
+	assert.Equal(t, "build-box", got.Hostname)
 }
 
 func TestGetSessionNotFound(t *testing.T) {
@@ -127,6 +138,68 @@ func TestUpdateSessionActivity(t *testing.T) {
 	assert.Equal(t, "/home", got.Cwd)
 }
 
+func TestUpdateSessionExpiry(t *testing.T) {
+	st := newTestStore(t)
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	past := time.Now().UTC().Add(-time.Minute)
+	require.NoError(t, st.UpdateSessionExpiry("s1", past))
+
+	expired, err := st.ListExpiredSessions()
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "s1", expired[0].ID)
+	assert.Equal(t, "/workspace", expired[0].Cwd)
+
+	assert.Error(t, st.UpdateSessionExpiry("nonexistent", past))
+}
+
+func TestUpdateSessionLabels(t *testing.T) {
+	st := newTestStore(t)
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	got, err := st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Nil(t, got.Labels)
+
+	require.NoError(t, st.UpdateSessionLabels("s1", map[string]string{"team": "infra"}))
+	got, err = st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "infra"}, got.Labels)
+
+	require.NoError(t, st.UpdateSessionLabels("s1", nil))
+	got, err = st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Nil(t, got.Labels)
+}
+
+func TestUpdateSessionImage(t *testing.T) {
+	st := newTestStore(t)
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	require.NoError(t, st.UpdateSessionImage("s1", "python-patched", "sha256:abc", 4242, "/sys/fs/cgroup/sandkasten/s1"))
+	got, err := st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "python-patched", got.Image)
+	assert.Equal(t, "sha256:abc", got.ImageDigest)
+	assert.Equal(t, 4242, got.InitPID)
+	assert.Equal(t, "/sys/fs/cgroup/sandkasten/s1", got.CgroupPath)
+
+	assert.Error(t, st.UpdateSessionImage("nope", "python", "", 1, ""))
+}
+
+func TestUpdateSessionCPU(t *testing.T) {
+	st := newTestStore(t)
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	require.NoError(t, st.UpdateSessionCPU("s1", `{"weight":400}`))
+	got, err := st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Equal(t, `{"weight":400}`, got.CPU)
+
+	assert.Error(t, st.UpdateSessionCPU("nope", ""))
+}
+
 func TestListExpiredSessions(t *testing.T) {
 	st := newTestStore(t)
 
@@ -162,6 +235,127 @@ func TestListRunningSessions(t *testing.T) {
 	assert.Equal(t, "running-1", sessions[0].ID)
 }
 
+func TestWorkspaceUsage(t *testing.T) {
+	st := newTestStore(t)
+
+	old := testSession("old")
+	old.WorkspaceID = "ws1"
+	old.Status = "destroyed"
+	old.LastActivity = time.Now().UTC().Add(-48 * time.Hour)
+	require.NoError(t, st.CreateSession(old))
+	newer := testSession("newer")
+	newer.WorkspaceID = "ws1"
+	newer.Status = "expired"
+	newer.LastActivity = time.Now().UTC().Add(-time.Hour)
+	require.NoError(t, st.CreateSession(newer))
+	running := testSession("running")
+	running.WorkspaceID = "ws2"
+	require.NoError(t, st.CreateSession(running))
+	require.NoError(t, st.CreateSession(testSession("no-workspace")))
+
+	usage, err := st.WorkspaceUsage()
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+	assert.False(t, usage["ws1"].InUse)
+	assert.WithinDuration(t, newer.LastActivity, usage["ws1"].LastActivity, time.Second)
+	assert.True(t, usage["ws2"].InUse)
+}
+
+func TestActiveSessions(t *testing.T) {
+	st := newTestStore(t)
+
+	require.NoError(t, st.CreateSession(testSession("a")))
+	require.NoError(t, st.CreateSession(testSession("b")))
+	idle := testSession("c")
+	idle.Status = StatusPoolIdle
+	require.NoError(t, st.CreateSession(idle))
+
+	n, err := st.ActiveSessions()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, st.UpdateSessionStatus("a", "expired"))
+	n, err = st.ActiveSessions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestSharedChannelSessions(t *testing.T) {
+	st := newTestStore(t)
+
+	a := testSession("a")
+	a.SharedChannel = "acme_results"
+	require.NoError(t, st.CreateSession(a))
+	require.NoError(t, st.CreateSession(testSession("b")))
+	require.NoError(t, st.UpdateSessionSharedChannel("b", "acme_results"))
+
+	got, err := st.GetSession("b")
+	require.NoError(t, err)
+	assert.Equal(t, "acme_results", got.SharedChannel)
+
+	n, err := st.SharedChannelSessions("acme_results")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, st.UpdateSessionStatus("a", "destroyed"))
+	n, err = st.SharedChannelSessions("acme_results")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Error(t, st.UpdateSessionSharedChannel("missing", "x"))
+}
+
+func TestSessionDeterminism(t *testing.T) {
+	st := newTestStore(t)
+
+	sess := testSession("a")
+	sess.Determinism = `{"seed":42,"tz":"UTC","locale":"C.UTF-8"}`
+	require.NoError(t, st.CreateSession(sess))
+	require.NoError(t, st.CreateSession(testSession("b")))
+
+	got, err := st.GetSession("a")
+	require.NoError(t, err)
+	assert.Equal(t, sess.Determinism, got.Determinism)
+	got, err = st.GetSession("b")
+	require.NoError(t, err)
+	assert.Empty(t, got.Determinism)
+}
+
+func TestListGroupSessions(t *testing.T) {
+	st := newTestStore(t)
+
+	a := testSession("a")
+	a.GroupID = "g1"
+	require.NoError(t, st.CreateSession(a))
+	require.NoError(t, st.CreateSession(testSession("b")))
+	require.NoError(t, st.UpdateSessionGroup("b", "g1"))
+	require.NoError(t, st.CreateSession(testSession("other")))
+
+	members, err := st.ListGroupSessions("g1")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	assert.Equal(t, "g1", members[0].GroupID)
+	assert.Equal(t, "g1", members[1].GroupID)
+
+	members, err = st.ListGroupSessions("missing")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestListPoolIdleSessions(t *testing.T) {
+	st := newTestStore(t)
+
+	require.NoError(t, st.CreateSession(testSession("running-1")))
+	idle := testSession("idle-1")
+	idle.Status = StatusPoolIdle
+	require.NoError(t, st.CreateSession(idle))
+
+	sessions, err := st.ListPoolIdleSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "idle-1", sessions[0].ID)
+}
+
 func TestDeleteSession(t *testing.T) {
 	st := newTestStore(t)
 	require.NoError(t, st.CreateSession(testSession("s1")))
@@ -211,3 +405,411 @@ func TestDuplicateSessionID(t *testing.T) {
 	err := st.CreateSession(testSession("dup"))
 	assert.Error(t, err)
 }
+
+func TestAuditEvents(t *testing.T) {
+	st := newTestStore(t)
+
+	require.NoError(t, st.AppendAuditEvent(&AuditEvent{SessionID: "s1", Action: "exec_denied", Detail: "deny_prefix"}))
+	require.NoError(t, st.AppendAuditEvent(&AuditEvent{SessionID: "s2", Action: "exec_denied"}))
+	ev := &AuditEvent{SessionID: "s1", Action: "exec_denied", Detail: "network_disabled"}
+	require.NoError(t, st.AppendAuditEvent(ev))
+	assert.NotZero(t, ev.ID)
+
+	all, err := st.ListAuditEvents("", 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	s1, err := st.ListAuditEvents("s1", 10)
+	require.NoError(t, err)
+	require.Len(t, s1, 2)
+	assert.Equal(t, "network_disabled", s1[0].Detail) // newest first
+}
+
+func TestCreateFailures(t *testing.T) {
+	st := newTestStore(t)
+
+	for i := 0; i < MaxCreateFailures+5; i++ {
+		require.NoError(t, st.AppendCreateFailure(&CreateFailure{
+			SessionID: fmt.Sprintf("s%d", i), Image: "python", Source: "create", Stage: "start", Class: "other",
+			Error: "start nsinit: operation not permitted", Errno: "EPERM",
+		}))
+	}
+
+	all, err := st.ListCreateFailures(0)
+	require.NoError(t, err)
+	require.Len(t, all, MaxCreateFailures)
+	assert.Equal(t, fmt.Sprintf("s%d", MaxCreateFailures+4), all[0].SessionID) // newest first
+	assert.Equal(t, "EPERM", all[0].Errno)
+	assert.Equal(t, "other", all[0].Class)
+
+	two, err := st.ListCreateFailures(2)
+	require.NoError(t, err)
+	assert.Len(t, two, 2)
+}
+
+func TestUsageSummary(t *testing.T) {
+	st := newTestStore(t)
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	for _, rec := range []*UsageRecord{
+		{Kind: UsageKindExec, SessionID: "s1", KeyID: "k1", Image: "python", CPUUsec: 50, WallMs: 10, BytesIn: 5, BytesOut: 100, PeakMemoryBytes: 1000, CreatedAt: day1},
+		{Kind: UsageKindExec, SessionID: "s1", KeyID: "k1", Image: "python", CPUUsec: 70, WallMs: 20, BytesIn: 7, BytesOut: 300, PeakMemoryBytes: 3000, CreatedAt: day1},
+		{Kind: UsageKindSession, SessionID: "s1", KeyID: "k1", Image: "python", CPUUsec: 500, WallMs: 60000, BytesIn: 12, BytesOut: 400, PeakMemoryBytes: 3000, CreatedAt: day1},
+		{Kind: UsageKindExec, SessionID: "s2", KeyID: "k2", Image: "base", WallMs: 5, BytesIn: 2, BytesOut: 1, PeakMemoryBytes: 500, CreatedAt: day2},
+	} {
+		require.NoError(t, st.AppendUsageRecord(rec))
+		assert.NotZero(t, rec.ID)
+	}
+
+	byKey, err := st.SummarizeUsage("key", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, byKey, 2)
+	assert.Equal(t, &UsageSummary{
+		Group: "k1", Sessions: 1, Execs: 2, CPUUsec: 500, SessionWallMs: 60000, ExecWallMs: 30,
+		BytesIn: 12, BytesOut: 400, PeakMemoryBytes: 3000,
+	}, byKey[0])
+	assert.Equal(t, "k2", byKey[1].Group)
+
+	byDay, err := st.SummarizeUsage("day", day2, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, byDay, 1)
+	assert.Equal(t, "2026-03-02", byDay[0].Group)
+	assert.Equal(t, int64(1), byDay[0].Execs)
+
+	in, out, err := st.SessionExecBytes("s1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), in)
+	assert.Equal(t, int64(400), out)
+
+	_, err = st.SummarizeUsage("week", time.Time{}, time.Time{})
+	assert.Error(t, err)
+}
+
+func TestUpdateSessionOwner(t *testing.T) {
+	st := newTestStore(t)
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	require.NoError(t, st.UpdateSessionOwner("s1", "k1", "acme"))
+	sess, err := st.GetSession("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", sess.KeyID)
+	assert.Equal(t, "acme", sess.Tenant)
+
+	assert.Error(t, st.UpdateSessionOwner("missing", "k1", "acme"))
+}
+
+func TestListTenantSessions(t *testing.T) {
+	st := newTestStore(t)
+	acme := testSession("s1")
+	acme.Tenant = "acme"
+	require.NoError(t, st.CreateSession(acme))
+	require.NoError(t, st.CreateSession(testSession("s2")))
+
+	sessions, err := st.ListTenantSessions("acme")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s1", sessions[0].ID)
+	assert.Equal(t, "acme", sessions[0].Tenant)
+
+	sessions, err = st.ListTenantSessions("")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s2", sessions[0].ID)
+}
+
+func TestMaintenance(t *testing.T) {
+	st, err := New(filepath.Join(t.TempDir(), "maint.db"), 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, st.CreateSession(testSession(fmt.Sprintf("s-%d", i))))
+	}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, st.DeleteSession(fmt.Sprintf("s-%d", i)))
+	}
+
+	rep, err := st.Maintenance(context.Background(), MaintenanceOptions{})
+	require.NoError(t, err)
+	assert.True(t, rep.IntegrityOK)
+	assert.False(t, rep.CheckpointBusy)
+	assert.LessOrEqual(t, rep.FreelistPagesAfter, rep.FreelistPagesBefore)
+
+	rep, err = st.Maintenance(context.Background(), MaintenanceOptions{Vacuum: true, FullIntegrityCheck: true})
+	require.NoError(t, err)
+	assert.True(t, rep.Vacuumed)
+	assert.True(t, rep.IntegrityOK)
+	assert.Equal(t, 0, rep.FreelistPagesAfter)
+}
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "baseline", migrations[0].Name)
+
+	st, err := New(filepath.Join(t.TempDir(), "migrate.db"), 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+	ctx := context.Background()
+	require.NoError(t, st.CheckSchema(ctx))
+
+	ran, err := st.Migrate(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, ran, len(migrations))
+	assert.ErrorIs(t, st.CheckSchema(ctx), ErrSchemaOutdated)
+	assert.Error(t, st.CreateSession(testSession("s1")), "tables dropped")
+
+	ran, err = st.Migrate(ctx, -1)
+	require.NoError(t, err)
+	assert.Len(t, ran, len(migrations))
+	require.NoError(t, st.CreateSession(testSession("s1")))
+
+	status, err := st.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), status.Current)
+	assert.Empty(t, status.Pending)
+
+	_, err = st.db.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', ?)`, len(migrations)+1, time.Now())
+	require.NoError(t, err)
+	assert.ErrorIs(t, st.CheckSchema(ctx), ErrSchemaTooNew)
+	_, err = st.Migrate(ctx, -1)
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := Open(path, 1)
+	require.NoError(t, err)
+	// A sessions table from before most columns were added.
+	_, err = legacy.db.Exec(`CREATE TABLE sessions (
+		id            TEXT PRIMARY KEY,
+		image         TEXT NOT NULL,
+		status        TEXT NOT NULL DEFAULT 'running',
+		cwd           TEXT NOT NULL DEFAULT '/workspace',
+		workspace_id  TEXT,
+		created_at    DATETIME NOT NULL,
+		expires_at    DATETIME NOT NULL,
+		last_activity DATETIME NOT NULL
+	)`)
+	require.NoError(t, err)
+	_, err = legacy.db.Exec(`INSERT INTO sessions (id, image, created_at, expires_at, last_activity) VALUES ('old', 'base', ?, ?, ?)`,
+		time.Now().UTC(), time.Now().UTC().Add(time.Hour), time.Now().UTC())
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	st, err := New(path, 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	sess, err := st.GetSession("old")
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+	assert.Equal(t, "base", sess.Image)
+	require.NoError(t, st.CreateSession(testSession("new")))
+	require.NoError(t, st.AppendCreateFailure(&CreateFailure{Image: "base", Class: "oom"}))
+}
+
+func TestStoreMetrics(t *testing.T) {
+	st := newTestStore(t)
+	var logs bytes.Buffer
+	st.SetSlowQueryLog(time.Nanosecond, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	before := queryDuration.Count("create_session")
+	slowBefore := slowQueries.Value("create_session")
+	require.NoError(t, st.CreateSession(testSession("metrics-1")))
+
+	assert.Equal(t, before+1, queryDuration.Count("create_session"))
+	assert.Equal(t, slowBefore+1, slowQueries.Value("create_session"))
+	assert.Contains(t, logs.String(), "slow store operation")
+	assert.Contains(t, logs.String(), "op=create_session")
+}
+
+func TestRetryOnBusyCountsRetries(t *testing.T) {
+	retriesBefore := busyRetries.Value("test_op")
+	errorsBefore := busyErrors.Value("test_op")
+
+	calls := 0
+	err := retryOnBusy("test_op", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("database is locked (5) (SQLITE_BUSY)")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, retriesBefore+2, busyRetries.Value("test_op"))
+	assert.Equal(t, errorsBefore, busyErrors.Value("test_op"))
+}
+
+func TestSessionCacheCoalescesActivity(t *testing.T) {
+	st := newTestStore(t)
+	st.EnableSessionCache()
+	require.NoError(t, st.CreateSession(testSession("cache-1")))
+
+	newExpiry := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, st.UpdateSessionActivity("cache-1", "/tmp", newExpiry))
+
+	got, err := st.GetSession("cache-1")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp", got.Cwd)
+
+	// Not yet written to SQLite.
+	var cwd string
+	require.NoError(t, st.db.QueryRow(`SELECT cwd FROM sessions WHERE id = ?`, "cache-1").Scan(&cwd))
+	assert.Equal(t, "/workspace", cwd)
+
+	require.NoError(t, st.FlushActivity())
+	require.NoError(t, st.db.QueryRow(`SELECT cwd FROM sessions WHERE id = ?`, "cache-1").Scan(&cwd))
+	assert.Equal(t, "/tmp", cwd)
+}
+
+func TestSessionCacheFlushesBeforeExpiryQuery(t *testing.T) {
+	st := newTestStore(t)
+	st.EnableSessionCache()
+	sess := testSession("cache-2")
+	sess.ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	require.NoError(t, st.CreateSession(sess))
+
+	// Extending the lease must be visible to the reaper's query.
+	require.NoError(t, st.UpdateSessionActivity("cache-2", "/workspace", time.Now().UTC().Add(time.Hour)))
+	expired, err := st.ListExpiredSessions()
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func TestSessionCacheExpiryVisibleToReaper(t *testing.T) {
+	st := newTestStore(t)
+	st.EnableSessionCache()
+	require.NoError(t, st.CreateSession(testSession("cache-4")))
+	_, err := st.GetSession("cache-4")
+	require.NoError(t, err)
+
+	require.NoError(t, st.UpdateSessionExpiry("cache-4", time.Now().UTC().Add(-time.Second)))
+	expired, err := st.ListExpiredSessions()
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "cache-4", expired[0].ID)
+}
+
+func TestSessionCacheEvictsTerminal(t *testing.T) {
+	st := newTestStore(t)
+	st.EnableSessionCache()
+	require.NoError(t, st.CreateSession(testSession("cache-3")))
+	require.NoError(t, st.UpdateSessionActivity("cache-3", "/src", time.Now().UTC().Add(time.Hour)))
+
+	require.NoError(t, st.UpdateSessionStatus("cache-3", "destroyed"))
+	_, cached := st.cache.get("cache-3")
+	assert.False(t, cached)
+
+	got, err := st.GetSession("cache-3")
+	require.NoError(t, err)
+	assert.Equal(t, "destroyed", got.Status)
+	assert.Equal(t, "/src", got.Cwd, "pending activity is persisted on eviction")
+}
+
+func TestInjectedWriteFailure(t *testing.T) {
+	failpoint.Enable()
+	st := newTestStore(t)
+	require.NoError(t, failpoint.Set(failpoint.StoreWrite, "1*error"))
+	t.Cleanup(failpoint.Reset)
+
+	err := st.CreateSession(testSession("sess-fp"))
+	require.ErrorIs(t, err, failpoint.ErrInjected)
+	got, err := st.GetSession("sess-fp")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	require.NoError(t, st.CreateSession(testSession("sess-fp")))
+}
+
+func TestDaemonLease(t *testing.T) {
+	st := newTestStore(t)
+
+	l, err := st.GetLease()
+	require.NoError(t, err)
+	assert.Nil(t, l)
+
+	ok, err := st.AcquireLease("primary", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The standby can't take a valid lease; the holder can renew it.
+	ok, err = st.AcquireLease("standby", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = st.AcquireLease("primary", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	l, err = st.GetLease()
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	assert.Equal(t, "primary", l.Holder)
+	assert.True(t, l.ExpiresAt.After(time.Now()))
+
+	// Releasing as someone else is a no-op.
+	require.NoError(t, st.ReleaseLease("standby"))
+	ok, err = st.AcquireLease("standby", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, st.ReleaseLease("primary"))
+	ok, err = st.AcquireLease("standby", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestDaemonLeaseExpiry(t *testing.T) {
+	st := newTestStore(t)
+
+	ok, err := st.AcquireLease("primary", -time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = st.AcquireLease("standby", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	l, err := st.GetLease()
+	require.NoError(t, err)
+	assert.Equal(t, "standby", l.Holder)
+}
+
+func TestWorkspaceMetadata(t *testing.T) {
+	st := newTestStore(t)
+
+	ws, err := st.GetWorkspace("proj")
+	require.NoError(t, err)
+	assert.Nil(t, ws)
+
+	created := time.Now().UTC().Add(-time.Hour)
+	require.NoError(t, st.AddWorkspace(&Workspace{ID: "proj", KeyID: "abc123", CreatedAt: created}))
+	// A second add keeps the first owner.
+	require.NoError(t, st.AddWorkspace(&Workspace{ID: "proj", KeyID: "other", CreatedAt: time.Now()}))
+	require.NoError(t, st.UpdateWorkspace(&Workspace{ID: "proj", Description: "the project", Labels: map[string]string{"team": "a"}}))
+	require.NoError(t, st.SetWorkspaceSize("proj", 4096))
+	require.NoError(t, st.SetWorkspaceSize("legacy", 10))
+
+	ws, err = st.GetWorkspace("proj")
+	require.NoError(t, err)
+	require.NotNil(t, ws)
+	assert.Equal(t, "abc123", ws.KeyID)
+	assert.WithinDuration(t, created, ws.CreatedAt, time.Second)
+	assert.Equal(t, "the project", ws.Description)
+	assert.Equal(t, map[string]string{"team": "a"}, ws.Labels)
+	assert.Equal(t, int64(4096), ws.SizeBytes)
+	assert.False(t, ws.SizeUpdatedAt.IsZero())
+
+	all, err := st.ListWorkspaces()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, int64(10), all["legacy"].SizeBytes)
+
+	require.NoError(t, st.DeleteWorkspace("proj"))
+	ws, err = st.GetWorkspace("proj")
+	require.NoError(t, err)
+	assert.Nil(t, ws)
+}
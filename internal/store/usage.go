@@ -0,0 +1,136 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Usage record kinds.
+const (
+	UsageKindExec    = "exec"
+	UsageKindSession = "session"
+)
+
+// UsageRecord is the resource use of one exec or of a whole session, written
+// when it finishes.
+type UsageRecord struct {
+	ID              int64     `json:"id"`
+	Kind            string    `json:"kind"` // exec | session
+	SessionID       string    `json:"session_id"`
+	KeyID           string    `json:"key_id,omitempty"`
+	Image           string    `json:"image"`
+	CPUUsec         int64     `json:"cpu_usec"`
+	WallMs          int64     `json:"wall_ms"`
+	BytesIn         int64     `json:"bytes_in"`
+	BytesOut        int64     `json:"bytes_out"`
+	PeakMemoryBytes int64     `json:"peak_memory_bytes"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// UsageSummary aggregates usage records for one group. Session records carry
+// the totals billed (CPU, lifetime, peak memory); exec records carry the
+// per-command numbers, so the two kinds are summed separately.
+type UsageSummary struct {
+	Group           string `json:"group"`
+	Sessions        int64  `json:"sessions"`
+	Execs           int64  `json:"execs"`
+	CPUUsec         int64  `json:"cpu_usec"`
+	SessionWallMs   int64  `json:"session_wall_ms"`
+	ExecWallMs      int64  `json:"exec_wall_ms"`
+	BytesIn         int64  `json:"bytes_in"`
+	BytesOut        int64  `json:"bytes_out"`
+	PeakMemoryBytes int64  `json:"peak_memory_bytes"`
+}
+
+// usageGroupColumns maps the supported group_by values to SQL expressions.
+var usageGroupColumns = map[string]string{
+	"key":   "key_id",
+	"image": "image",
+	"day":   "substr(created_at, 1, 10)",
+}
+
+func (s *Store) AppendUsageRecord(rec *UsageRecord) error {
+	defer s.observe("append_usage_record", time.Now())
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	err := retryOnBusy("append_usage_record", func() error {
+		result, e := s.db.Exec(
+			`INSERT INTO usage_records (kind, session_id, key_id, image, cpu_usec, wall_ms, bytes_in, bytes_out, peak_memory_bytes, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			rec.Kind, rec.SessionID, rec.KeyID, rec.Image, rec.CPUUsec, rec.WallMs, rec.BytesIn, rec.BytesOut,
+			rec.PeakMemoryBytes, rec.CreatedAt.UTC(),
+		)
+		if e == nil {
+			rec.ID, _ = result.LastInsertId()
+		}
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("inserting usage record: %w", err)
+	}
+	return nil
+}
+
+// SummarizeUsage aggregates the records created in [since, until) by groupBy
+// ("key", "image" or "day"). Zero times leave that end open.
+func (s *Store) SummarizeUsage(groupBy string, since, until time.Time) ([]*UsageSummary, error) {
+	defer s.observe("summarize_usage", time.Now())
+	col, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported usage grouping %q", groupBy)
+	}
+
+	query := `SELECT ` + col + ` AS grp,
+		SUM(kind = 'session'), SUM(kind = 'exec'),
+		SUM(CASE WHEN kind = 'session' THEN cpu_usec ELSE 0 END),
+		SUM(CASE WHEN kind = 'session' THEN wall_ms ELSE 0 END),
+		SUM(CASE WHEN kind = 'exec' THEN wall_ms ELSE 0 END),
+		SUM(CASE WHEN kind = 'exec' THEN bytes_in ELSE 0 END),
+		SUM(CASE WHEN kind = 'exec' THEN bytes_out ELSE 0 END),
+		MAX(peak_memory_bytes)
+		FROM usage_records WHERE 1 = 1`
+	var args []any
+	if !since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, since.UTC())
+	}
+	if !until.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, until.UTC())
+	}
+	query += ` GROUP BY grp ORDER BY grp`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("summarizing usage: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []*UsageSummary{}
+	for rows.Next() {
+		var u UsageSummary
+		if err := rows.Scan(&u.Group, &u.Sessions, &u.Execs, &u.CPUUsec, &u.SessionWallMs, &u.ExecWallMs,
+			&u.BytesIn, &u.BytesOut, &u.PeakMemoryBytes); err != nil {
+			return nil, fmt.Errorf("scanning usage summary: %w", err)
+		}
+		summaries = append(summaries, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating usage summaries: %w", err)
+	}
+	return summaries, nil
+}
+
+// SessionExecBytes returns the exec bytes recorded for a session so far.
+func (s *Store) SessionExecBytes(sessionID string) (in, out int64, err error) {
+	defer s.observe("session_exec_bytes", time.Now())
+	err = s.db.QueryRow(
+		`SELECT COALESCE(SUM(bytes_in), 0), COALESCE(SUM(bytes_out), 0) FROM usage_records WHERE session_id = ? AND kind = 'exec'`,
+		sessionID,
+	).Scan(&in, &out)
+	if err != nil {
+		return 0, 0, fmt.Errorf("summing session exec bytes: %w", err)
+	}
+	return in, out, nil
+}
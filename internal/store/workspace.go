@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Workspace is the metadata of a persistent workspace. The files live in
+// data_dir/workspaces/<ID>; ID is the workspace directory ID.
+type Workspace struct {
+	ID            string            `json:"id"`
+	Description   string            `json:"description,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	KeyID         string            `json:"key_id,omitempty"` // fingerprint of the API key that created it
+	CreatedAt     time.Time         `json:"created_at"`
+	SizeBytes     int64             `json:"size_bytes"`
+	SizeUpdatedAt time.Time         `json:"size_updated_at"` // zero = never measured
+}
+
+// AddWorkspace records ws unless the workspace already has metadata, which
+// is kept.
+func (s *Store) AddWorkspace(ws *Workspace) error {
+	defer s.observe("add_workspace", time.Now())
+	err := retryOnBusy("add_workspace", func() error {
+		_, e := s.db.Exec(
+			`INSERT INTO workspaces (id, description, labels, key_id, created_at) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(id) DO NOTHING`,
+			ws.ID, ws.Description, encodeLabels(ws.Labels), ws.KeyID, ws.CreatedAt.UTC(),
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("inserting workspace: %w", err)
+	}
+	return nil
+}
+
+// GetWorkspace returns the metadata of a workspace, or nil if it has none.
+func (s *Store) GetWorkspace(id string) (*Workspace, error) {
+	defer s.observe("get_workspace", time.Now())
+	row := s.db.QueryRow(
+		`SELECT id, description, labels, key_id, created_at, size_bytes, size_updated_at FROM workspaces WHERE id = ?`, id)
+	ws, err := scanWorkspace(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return ws, err
+}
+
+// ListWorkspaces returns the metadata of all workspaces keyed by ID.
+func (s *Store) ListWorkspaces() (map[string]*Workspace, error) {
+	defer s.observe("list_workspaces", time.Now())
+	rows, err := s.db.Query(
+		`SELECT id, description, labels, key_id, created_at, size_bytes, size_updated_at FROM workspaces`)
+	if err != nil {
+		return nil, fmt.Errorf("listing workspaces: %w", err)
+	}
+	defer rows.Close()
+	result := make(map[string]*Workspace)
+	for rows.Next() {
+		ws, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[ws.ID] = ws
+	}
+	return result, rows.Err()
+}
+
+// UpdateWorkspace sets the description and labels of a workspace, creating
+// its metadata if it has none.
+func (s *Store) UpdateWorkspace(ws *Workspace) error {
+	defer s.observe("update_workspace", time.Now())
+	err := retryOnBusy("update_workspace", func() error {
+		_, e := s.db.Exec(
+			`INSERT INTO workspaces (id, description, labels, key_id, created_at) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(id) DO UPDATE SET description = excluded.description, labels = excluded.labels`,
+			ws.ID, ws.Description, encodeLabels(ws.Labels), ws.KeyID, ws.CreatedAt.UTC(),
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating workspace: %w", err)
+	}
+	return nil
+}
+
+// SetWorkspaceSize records the measured size of a workspace, creating its
+// metadata with created_at now if it has none.
+func (s *Store) SetWorkspaceSize(id string, size int64) error {
+	defer s.observe("set_workspace_size", time.Now())
+	now := time.Now().UTC()
+	err := retryOnBusy("set_workspace_size", func() error {
+		_, e := s.db.Exec(
+			`INSERT INTO workspaces (id, created_at, size_bytes, size_updated_at) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(id) DO UPDATE SET size_bytes = excluded.size_bytes, size_updated_at = excluded.size_updated_at`,
+			id, now, size, now,
+		)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("updating workspace size: %w", err)
+	}
+	return nil
+}
+
+// DeleteWorkspace removes the metadata of a workspace. Deleting metadata that
+// does not exist is not an error.
+func (s *Store) DeleteWorkspace(id string) error {
+	defer s.observe("delete_workspace", time.Now())
+	err := retryOnBusy("delete_workspace", func() error {
+		_, e := s.db.Exec(`DELETE FROM workspaces WHERE id = ?`, id)
+		return e
+	})
+	if err != nil {
+		return fmt.Errorf("deleting workspace: %w", err)
+	}
+	return nil
+}
+
+func scanWorkspace(row interface{ Scan(...any) error }) (*Workspace, error) {
+	var ws Workspace
+	var labels string
+	var sizeUpdatedAt sql.NullTime
+	if err := row.Scan(&ws.ID, &ws.Description, &labels, &ws.KeyID, &ws.CreatedAt, &ws.SizeBytes, &sizeUpdatedAt); err != nil {
+		return nil, fmt.Errorf("scanning workspace: %w", err)
+	}
+	if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &ws.Labels); err != nil {
+			return nil, fmt.Errorf("decoding workspace labels: %w", err)
+		}
+	}
+	ws.SizeUpdatedAt = sizeUpdatedAt.Time
+	return &ws, nil
+}
@@ -0,0 +1,31 @@
+// Command gen writes tools.json from the OpenAPI spec; see go:generate in
+// package toolschema.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/p-arndt/sandkasten/internal/toolschema"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: gen <openapi.yaml> <tools.json>")
+		os.Exit(2)
+	}
+	spec, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	out, err := toolschema.Generate(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(os.Args[2], out, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
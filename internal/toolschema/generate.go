@@ -0,0 +1,218 @@
+package toolschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// definitions lists the generated tools. Parameters are looked up by name in
+// the operation's query parameters and JSON request body; path parameters
+// (session and workspace IDs) are left to the caller.
+var definitions = []struct {
+	name        string
+	operationID string
+	description string
+	params      []string
+	required    []string // required by the tool though optional in the spec
+}{
+	{
+		name:        "run_code",
+		operationID: "execCommand",
+		description: "Run a shell command in the sandbox, e.g. `python3 main.py`, and return its exit code, working directory and combined stdout/stderr. The shell is persistent between calls.",
+		params:      []string{"cmd", "timeout_ms"},
+	},
+	{
+		name:        "read_file",
+		operationID: "readFile",
+		description: "Read a file from the sandbox. The content is returned base64-encoded.",
+		params:      []string{"path", "max_bytes"},
+	},
+	{
+		name:        "write_file",
+		operationID: "writeFile",
+		description: "Write a text file in the sandbox, replacing it if it exists.",
+		params:      []string{"path", "text"},
+		required:    []string{"text"}, // the API takes text or content_base64
+	},
+	{
+		name:        "run_tests",
+		operationID: "runTests",
+		description: "Run the project's tests in the sandbox with pytest, go test or jest and return the status of each test case, with the failure message and traceback of failed ones.",
+		params:      []string{"framework", "path"},
+	},
+	{
+		name:        "list_files",
+		operationID: "listWorkspaceFiles",
+		description: "List a directory in the sandbox's workspace.",
+		params:      []string{"path"},
+	},
+}
+
+// Generate builds tools.json from the OpenAPI document spec.
+func Generate(spec []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	g := generator{doc: doc}
+
+	out := make([]Tool, 0, len(definitions))
+	for _, def := range definitions {
+		method, path, op, pathItem := g.findOperation(def.operationID)
+		if op == nil {
+			return nil, fmt.Errorf("%s: operation %q not in spec", def.name, def.operationID)
+		}
+		params, required := g.collectParams(pathItem, op)
+		t := Tool{
+			Name:        def.name,
+			Description: def.description,
+			Method:      method,
+			Path:        "/v1" + path,
+			Parameters:  Schema{Type: "object", Properties: map[string]Schema{}},
+		}
+		for _, name := range def.params {
+			raw, ok := params[name]
+			if !ok {
+				return nil, fmt.Errorf("%s: operation %s has no parameter %q", def.name, def.operationID, name)
+			}
+			s, err := toSchema(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: parameter %s: %w", def.name, name, err)
+			}
+			t.Parameters.Properties[name] = s
+			if required[name] || slices.Contains(def.required, name) {
+				t.Parameters.Required = append(t.Parameters.Required, name)
+			}
+		}
+		out = append(out, t)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type generator struct {
+	doc map[string]any
+}
+
+// findOperation returns the operation with the given operationId and the path
+// item that holds it.
+func (g generator) findOperation(id string) (method, path string, op, pathItem map[string]any) {
+	paths, _ := g.doc["paths"].(map[string]any)
+	for p, item := range paths {
+		item, _ := item.(map[string]any)
+		for m, o := range item {
+			o, ok := o.(map[string]any)
+			if ok && o["operationId"] == id {
+				return strings.ToUpper(m), p, o, item
+			}
+		}
+	}
+	return "", "", nil, nil
+}
+
+// collectParams gathers the schemas of op's query parameters and JSON body
+// properties by name, and which of them are required.
+func (g generator) collectParams(pathItem, op map[string]any) (params map[string]map[string]any, required map[string]bool) {
+	params = map[string]map[string]any{}
+	required = map[string]bool{}
+
+	var list []any
+	list = append(list, asSlice(pathItem["parameters"])...)
+	list = append(list, asSlice(op["parameters"])...)
+	for _, p := range list {
+		p := g.resolve(p)
+		if p["in"] != "query" {
+			continue
+		}
+		name, _ := p["name"].(string)
+		schema := maps.Clone(g.resolve(p["schema"]))
+		if schema == nil {
+			schema = map[string]any{}
+		}
+		if d, ok := p["description"]; ok && schema["description"] == nil {
+			schema["description"] = d
+		}
+		params[name] = schema
+		required[name], _ = p["required"].(bool)
+	}
+
+	body := g.resolve(op["requestBody"])
+	content, _ := body["content"].(map[string]any)
+	media, _ := content["application/json"].(map[string]any)
+	if media == nil {
+		return params, required
+	}
+	schema := g.resolve(media["schema"])
+	props, _ := schema["properties"].(map[string]any)
+	for name, prop := range props {
+		params[name] = g.resolve(prop)
+	}
+	for _, name := range asSlice(schema["required"]) {
+		if n, ok := name.(string); ok {
+			required[n] = true
+		}
+	}
+	return params, required
+}
+
+// resolve follows a local $ref ("#/components/...").
+func (g generator) resolve(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m
+	}
+	var cur any = g.doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node, _ := cur.(map[string]any)
+		cur = node[part]
+	}
+	return g.resolve(cur)
+}
+
+func toSchema(m map[string]any) (Schema, error) {
+	typ, _ := m["type"].(string)
+	switch typ {
+	case "string", "integer", "number", "boolean":
+	default:
+		return Schema{}, fmt.Errorf("unsupported type %q", typ)
+	}
+	s := Schema{Type: typ, Default: m["default"]}
+	s.Description, _ = m["description"].(string)
+	s.Enum = asSlice(m["enum"])
+	if v, ok := number(m["minimum"]); ok {
+		s.Minimum = &v
+	}
+	if v, ok := number(m["maximum"]); ok {
+		s.Maximum = &v
+	}
+	if v, ok := number(m["maxLength"]); ok {
+		n := int(v)
+		s.MaxLength = &n
+	}
+	return s, nil
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
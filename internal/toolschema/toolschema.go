@@ -0,0 +1,90 @@
+// Package toolschema describes the sandbox operations as JSON-Schema function
+// definitions for LLM tool calling (OpenAI function calling, Anthropic tool
+// use).
+//
+// The definitions are generated from docs/openapi.yaml so their parameters
+// always match the API: tools.json is written by Generate and embedded here.
+// Run "go generate ./internal/toolschema" after changing the spec; the tests
+// fail while tools.json is stale.
+package toolschema
+
+//go:generate go run ./gen ../../docs/openapi.yaml tools.json
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+)
+
+// Output formats accepted by Render.
+const (
+	FormatOpenAI    = "openai"
+	FormatAnthropic = "anthropic"
+)
+
+// Tool is one generated function definition.
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Method      string `json:"method"`
+	Path        string `json:"path"` // API route, e.g. /v1/sessions/{id}/exec
+	Parameters  Schema `json:"parameters"`
+}
+
+// Schema is the JSON Schema subset tool parameters use.
+type Schema struct {
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Properties  map[string]Schema `json:"properties,omitempty"`
+	Required    []string          `json:"required,omitempty"`
+	Enum        []any             `json:"enum,omitempty"`
+	Default     any               `json:"default,omitempty"`
+	Minimum     *float64          `json:"minimum,omitempty"`
+	Maximum     *float64          `json:"maximum,omitempty"`
+	MaxLength   *int              `json:"maxLength,omitempty"`
+}
+
+//go:embed tools.json
+var toolsJSON []byte
+
+var tools []Tool
+
+func init() {
+	if err := json.Unmarshal(toolsJSON, &tools); err != nil {
+		panic(fmt.Sprintf("toolschema: invalid tools.json: %v", err))
+	}
+}
+
+// Tools returns the generated definitions.
+func Tools() []Tool {
+	return tools
+}
+
+// Render returns the definitions in the tool format of an LLM API, and the
+// API route behind each tool ("POST /v1/sessions/{id}/exec").
+func Render(format string) (defs []any, routes map[string]string, err error) {
+	routes = make(map[string]string, len(tools))
+	for _, t := range tools {
+		routes[t.Name] = t.Method + " " + t.Path
+		switch format {
+		case FormatOpenAI:
+			defs = append(defs, map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name":        t.Name,
+					"description": t.Description,
+					"parameters":  t.Parameters,
+				},
+			})
+		case FormatAnthropic:
+			defs = append(defs, map[string]any{
+				"name":         t.Name,
+				"description":  t.Description,
+				"input_schema": t.Parameters,
+			})
+		default:
+			return nil, nil, fmt.Errorf("unknown format %q (want %s or %s)", format, FormatOpenAI, FormatAnthropic)
+		}
+	}
+	return defs, routes, nil
+}
@@ -0,0 +1,61 @@
+package toolschema
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolsJSONUpToDate(t *testing.T) {
+	spec, err := os.ReadFile("../../docs/openapi.yaml")
+	require.NoError(t, err)
+	got, err := Generate(spec)
+	require.NoError(t, err)
+	assert.Equal(t, string(got), string(toolsJSON), "tools.json is stale; run go generate ./internal/toolschema")
+}
+
+func TestTools(t *testing.T) {
+	var names []string
+	for _, tool := range Tools() {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"run_code", "read_file", "write_file", "run_tests", "list_files"}, names)
+
+	run := Tools()[0]
+	assert.Equal(t, "POST", run.Method)
+	assert.Equal(t, "/v1/sessions/{id}/exec", run.Path)
+	assert.Equal(t, "string", run.Parameters.Properties["cmd"].Type)
+	assert.Equal(t, []string{"cmd"}, run.Parameters.Required)
+}
+
+func TestRender(t *testing.T) {
+	defs, routes, err := Render(FormatOpenAI)
+	require.NoError(t, err)
+	require.Len(t, defs, 5)
+	fn := defs[0].(map[string]any)
+	assert.Equal(t, "function", fn["type"])
+	assert.Equal(t, "run_code", fn["function"].(map[string]any)["name"])
+	assert.Equal(t, "POST /v1/sessions/{id}/exec", routes["run_code"])
+
+	defs, _, err = Render(FormatAnthropic)
+	require.NoError(t, err)
+	tool := defs[2].(map[string]any)
+	assert.Equal(t, "write_file", tool["name"])
+	assert.Equal(t, []string{"path", "text"}, tool["input_schema"].(Schema).Required)
+
+	_, _, err = Render("gemini")
+	assert.Error(t, err)
+}
+
+func TestGenerateMissingOperation(t *testing.T) {
+	spec := `paths:
+  /sessions/{id}/exec:
+    post:
+      operationId: somethingElse
+`
+	_, err := Generate([]byte(spec))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"execCommand" not in spec`)
+}
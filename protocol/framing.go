@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FramingLength is the Framing a client puts on the first request of a
+// connection to switch it from JSON lines to length-prefixed frames. A runner
+// that supports frames echoes it in its response, which is still a line; every
+// message after that, in both directions, is a frame. Runners that predate
+// frames ignore the field and the connection stays on lines.
+//
+// A frame is an 8-byte header, the big-endian lengths of a JSON message and
+// of a binary body, followed by both. The body carries the decoded
+// ContentBase64 of write requests and read responses, so file contents cross
+// the socket without base64 overhead, and no message is limited by a line
+// buffer.
+const FramingLength = "length"
+
+// MaxFrameBytes caps each of the two parts of a frame.
+const MaxFrameBytes = 64 * 1024 * 1024 // 64 MiB
+
+// MaxLineBytes caps a JSON line on connections that did not switch to
+// frames. Lines grow to it as needed; it fits the largest output limit.
+const MaxLineBytes = MaxFrameBytes
+
+// ErrLineTooLong is returned by ReadLine for lines over its limit.
+var ErrLineTooLong = errors.New("line too long")
+
+// ReadLine reads one newline-terminated message of at most limit bytes from
+// r, without the newline. It reads only up to the newline, so r can be
+// switched to frames right after.
+func ReadLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > limit+1 {
+			return nil, ErrLineTooLong
+		}
+		line = append(line, chunk...)
+		switch {
+		case err == nil:
+			return line[:len(line)-1], nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && len(line) > 0:
+			return line, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// WriteRequestFrame writes req as one frame, its content as the body.
+func WriteRequestFrame(w io.Writer, req Request) error {
+	body, err := base64.StdEncoding.DecodeString(req.ContentBase64)
+	if err != nil {
+		return fmt.Errorf("decode content: %w", err)
+	}
+	req.ContentBase64 = ""
+	return writeFrame(w, req, body)
+}
+
+// ReadRequestFrame reads a frame written by WriteRequestFrame.
+func ReadRequestFrame(r io.Reader) (Request, error) {
+	var req Request
+	body, err := readFrame(r, &req)
+	if err != nil {
+		return Request{}, err
+	}
+	if len(body) > 0 {
+		req.ContentBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return req, nil
+}
+
+// WriteResponseFrame writes resp as one frame, its content as the body.
+func WriteResponseFrame(w io.Writer, resp Response) error {
+	body, err := base64.StdEncoding.DecodeString(resp.ContentBase64)
+	if err != nil {
+		return fmt.Errorf("decode content: %w", err)
+	}
+	resp.ContentBase64 = ""
+	return writeFrame(w, resp, body)
+}
+
+// ReadResponseFrame reads a frame written by WriteResponseFrame.
+func ReadResponseFrame(r io.Reader) (Response, error) {
+	var resp Response
+	body, err := readFrame(r, &resp)
+	if err != nil {
+		return Response{}, err
+	}
+	if len(body) > 0 {
+		resp.ContentBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return resp, nil
+}
+
+func writeFrame(w io.Writer, msg any, body []byte) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal frame: %w", err)
+	}
+	if len(data) > MaxFrameBytes || len(body) > MaxFrameBytes {
+		return fmt.Errorf("frame over %d bytes", MaxFrameBytes)
+	}
+	frame := make([]byte, 8, 8+len(data)+len(body))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(body)))
+	frame = append(append(frame, data...), body...)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame decodes the JSON of the next frame into msg and returns its body.
+// It returns io.EOF when r ends between frames.
+func readFrame(r io.Reader, msg any) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	dataLen := binary.BigEndian.Uint32(header[0:4])
+	bodyLen := binary.BigEndian.Uint32(header[4:8])
+	if dataLen > MaxFrameBytes || bodyLen > MaxFrameBytes {
+		return nil, fmt.Errorf("frame over %d bytes", MaxFrameBytes)
+	}
+	buf := make([]byte, int(dataLen)+int(bodyLen))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("read frame: %w", io.ErrUnexpectedEOF)
+	}
+	if err := json.Unmarshal(buf[:dataLen], msg); err != nil {
+		return nil, fmt.Errorf("unmarshal frame: %w", err)
+	}
+	return buf[dataLen:], nil
+}
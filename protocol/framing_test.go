@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameRoundtrip(t *testing.T) {
+	content := []byte{0, 1, 2, '\n', 0xff}
+	var buf bytes.Buffer
+	require.NoError(t, WriteRequestFrame(&buf, Request{
+		ID:            "w-1",
+		Type:          RequestWrite,
+		Path:          "/workspace/bin",
+		ContentBase64: base64.StdEncoding.EncodeToString(content),
+	}))
+	require.NoError(t, WriteResponseFrame(&buf, Response{ID: "e-1", Type: ResponseExec, Output: "a\nb\n"}))
+
+	// The content travels as the raw body, not inside the JSON.
+	assert.Equal(t, uint32(len(content)), binary.BigEndian.Uint32(buf.Bytes()[4:8]))
+
+	req, err := ReadRequestFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "w-1", req.ID)
+	assert.Equal(t, "/workspace/bin", req.Path)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(content), req.ContentBase64)
+
+	resp, err := ReadResponseFrame(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", resp.Output)
+	assert.Empty(t, resp.ContentBase64)
+
+	_, err = ReadResponseFrame(&buf)
+	assert.Equal(t, io.EOF, err, "end between frames")
+}
+
+func TestReadFrame_Invalid(t *testing.T) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[0:4], MaxFrameBytes+1)
+	_, err := ReadResponseFrame(bytes.NewReader(header[:]))
+	assert.Error(t, err)
+
+	binary.BigEndian.PutUint32(header[0:4], 10)
+	_, err = ReadResponseFrame(bytes.NewReader(append(header[:], `{"id"`...)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReadLine(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", 40)+"\nshort\nlast"), 16)
+	line, err := ReadLine(r, 64)
+	require.NoError(t, err)
+	assert.Len(t, line, 40)
+
+	line, err = ReadLine(r, 64)
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(line))
+
+	line, err = ReadLine(r, 64)
+	require.NoError(t, err)
+	assert.Equal(t, "last", string(line))
+
+	_, err = ReadLine(r, 64)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = ReadLine(bufio.NewReader(strings.NewReader(strings.Repeat("x", 100)+"\n")), 64)
+	assert.ErrorIs(t, err, ErrLineTooLong)
+}
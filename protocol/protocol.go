@@ -2,6 +2,15 @@
 // the sandbox daemon and the runner binary inside containers.
 package protocol
 
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
 // Request is the envelope sent from daemon → runner.
 type Request struct {
 	ID   string      `json:"id"`
@@ -11,6 +20,24 @@ type Request struct {
 	Cmd       string `json:"cmd,omitempty"`
 	TimeoutMs int    `json:"timeout_ms,omitempty"`
 	RawOutput bool   `json:"raw_output,omitempty"`
+	Shell     string `json:"shell,omitempty"` // key of Shells; "" = the session shell
+	// OutputBase64 returns the command's output bytes unmodified, base64
+	// encoded in Output, instead of PTY text.
+	OutputBase64 bool `json:"output_base64,omitempty"`
+	// KillGraceMs is how long the processes of a timed-out command get
+	// between SIGTERM and SIGKILL; 0 = SIGKILL right away.
+	KillGraceMs int  `json:"kill_grace_ms,omitempty"`
+	ResetShell  bool `json:"reset_shell,omitempty"` // return the shell to /workspace after a timeout
+	// KeepCwd restarts a shell that exited in the cwd of the last exec
+	// instead of /workspace.
+	KeepCwd bool `json:"keep_cwd,omitempty"`
+	// Truncate is how output over the output limit is cut, see TruncateOutput.
+	Truncate string `json:"truncate,omitempty"`
+	// MaxOutputBytes caps the output returned, see OutputLimit.
+	MaxOutputBytes int `json:"max_output_bytes,omitempty"`
+	// LineTimestamps returns the output as Lines, each with the time the
+	// runner received it, instead of Output.
+	LineTimestamps bool `json:"line_timestamps,omitempty"`
 
 	// Write fields
 	Path          string `json:"path,omitempty"`
@@ -19,6 +46,26 @@ type Request struct {
 
 	// Read fields
 	MaxBytes int `json:"max_bytes,omitempty"`
+
+	// Proxy fields
+	Port int `json:"port,omitempty"`
+
+	// Upgrade fields
+	Offset int64  `json:"offset,omitempty"`
+	Digest string `json:"digest,omitempty"` // sha256 hex of the new runner binary
+
+	// Resize fields; 0 keeps the current value
+	Rows int `json:"rows,omitempty"`
+	Cols int `json:"cols,omitempty"`
+
+	// CompressMinBytes asks the runner to compress the response payload
+	// when it is at least this large, see CompressResponse; 0 = never.
+	// Runners that predate it ignore it and answer uncompressed.
+	CompressMinBytes int `json:"compress_min_bytes,omitempty"`
+
+	// Framing on the first request of a connection asks to switch it to
+	// frames, see FramingLength.
+	Framing string `json:"framing,omitempty"`
 }
 
 type RequestType string
@@ -28,6 +75,30 @@ const (
 	RequestExecStream RequestType = "exec_stream" // streaming exec
 	RequestWrite      RequestType = "write"
 	RequestRead       RequestType = "read"
+	// RequestProxy turns the connection into a raw byte stream to Port on the
+	// sandbox's loopback interface. It must be the only request on its
+	// connection, and the client must wait for the proxy response before
+	// sending data.
+	RequestProxy RequestType = "proxy"
+	// RequestVersion asks the runner for its protocol version and the digest
+	// of its binary.
+	RequestVersion RequestType = "version"
+	// RequestUpgrade replaces the runner in place. Requests with
+	// ContentBase64 stage a chunk of the new binary at Offset; the final
+	// request without content verifies the staged binary against Digest and
+	// re-executes the runner from it, handing over the shell and the socket.
+	RequestUpgrade RequestType = "upgrade"
+	// RequestResize sets the size of the shell's terminal to Rows x Cols.
+	// Runners without a terminal (stateless mode) accept it and do nothing.
+	RequestResize RequestType = "resize"
+	// RequestAttach starts Shell ("" = the session shell) on a terminal of
+	// its own, Rows x Cols, and turns the connection into frames relaying
+	// it. It must be the only request on its connection. After the attach
+	// response the client sends input requests (ContentBase64 = keystrokes)
+	// and resize requests; the runner sends output responses and, when the
+	// shell exits, an exit response with its ExitCode before closing.
+	RequestAttach RequestType = "attach"
+	RequestInput  RequestType = "input" // terminal input of an attach
 )
 
 // Response is the envelope sent from runner → daemon.
@@ -41,6 +112,18 @@ type Response struct {
 	Output     string `json:"output,omitempty"`
 	Truncated  bool   `json:"truncated,omitempty"`
 	DurationMs int64  `json:"duration_ms,omitempty"`
+	// Killed lists the processes of a timed-out command the runner
+	// terminated; ShellReset reports that the shell was reset afterwards.
+	Killed     []KilledProcess `json:"killed,omitempty"`
+	ShellReset bool            `json:"shell_reset,omitempty"`
+	// ShellRestarted reports that the shell had exited and was replaced by
+	// a new one before or while running the command; its state is gone.
+	ShellRestarted bool `json:"shell_restarted,omitempty"`
+	// OutputBase64 reports that Output holds the raw output bytes,
+	// base64-encoded.
+	OutputBase64 bool `json:"output_base64,omitempty"`
+	// Lines holds the output of a request with LineTimestamps.
+	Lines []OutputLine `json:"lines,omitempty"`
 
 	// Streaming exec fields (for exec_chunk)
 	Chunk     string `json:"chunk,omitempty"`     // output chunk
@@ -54,6 +137,31 @@ type Response struct {
 
 	// Error fields
 	Error string `json:"error,omitempty"`
+
+	// Version response fields
+	Version int    `json:"version,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+
+	// Compression is how Output and ContentBase64 are compressed; "" =
+	// not at all. See CompressResponse.
+	Compression string `json:"compression,omitempty"`
+
+	// Framing acknowledges the switch to frames asked for by the request.
+	Framing string `json:"framing,omitempty"`
+}
+
+// KilledProcess is a process of a timed-out command and the signal that
+// ended it ("SIGTERM" or "SIGKILL").
+type KilledProcess struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	Signal  string `json:"signal"`
+}
+
+// OutputLine is one line of exec output without its newline.
+type OutputLine struct {
+	Timestamp int64  `json:"timestamp"` // unix ms the line's last byte was received
+	Text      string `json:"text"`
 }
 
 type ResponseType string
@@ -64,18 +172,197 @@ const (
 	ResponseExecDone  ResponseType = "exec_done"  // streaming complete
 	ResponseWrite     ResponseType = "write"
 	ResponseRead      ResponseType = "read"
+	ResponseProxy     ResponseType = "proxy" // relay established; raw bytes follow
 	ResponseError     ResponseType = "error"
 	ResponseReady     ResponseType = "ready"
+	ResponseVersion   ResponseType = "version"
+	ResponseUpgrade   ResponseType = "upgrade"
+	ResponseResize    ResponseType = "resize"
+	ResponseAttach    ResponseType = "attach" // terminal started; frames follow
+	ResponseOutput    ResponseType = "output" // terminal output of an attach
+	ResponseExit      ResponseType = "exit"   // attached shell exited
 )
 
+// Version is the runner protocol version reported in version responses.
+// Bump it with changes the daemon must know the runner supports.
+const Version = 1
+
+// UpgradeChunkBytes is the size of the binary chunks of an upgrade.
+const UpgradeChunkBytes = 1024 * 1024 // 1 MiB
+
 // ReadyMessage is emitted by the runner on startup.
 type ReadyMessage struct {
 	Type ResponseType `json:"type"` // always "ready"
 }
 
+// Shells maps the interpreter names an exec request may select to the
+// binaries tried, in order, on the sandbox's PATH.
+var Shells = map[string][]string{
+	"bash":   {"bash"},
+	"sh":     {"sh"},
+	"python": {"python3", "python"},
+	"node":   {"node"},
+}
+
+// ErrShellUnavailable starts the runner's error message when the image has
+// none of the binaries for the requested shell.
+const ErrShellUnavailable = "shell unavailable"
+
+// Default terminal size of the session shell.
+const (
+	DefaultTerminalRows = 40
+	DefaultTerminalCols = 120
+)
+
 // MaxOutputBytes is the default cap on exec output.
 const MaxOutputBytes = 5 * 1024 * 1024 // 5 MB
 
+// MaxOutputBytesLimit bounds Request.MaxOutputBytes, so a response still
+// fits in a frame.
+const MaxOutputBytesLimit = 32 * 1024 * 1024 // 32 MiB
+
+// OutputLimit is the cap on the output of r: MaxOutputBytes unless the
+// request sets one, at most MaxOutputBytesLimit.
+func (r Request) OutputLimit() int {
+	if r.MaxOutputBytes <= 0 {
+		return MaxOutputBytes
+	}
+	return min(r.MaxOutputBytes, MaxOutputBytesLimit)
+}
+
+// Base64OutputLimit caps the raw output of a request with OutputBase64, so
+// its encoding fits in OutputLimit.
+func (r Request) Base64OutputLimit() int {
+	return r.OutputLimit() / 4 * 3
+}
+
+// Truncation modes for output over MaxOutputBytes.
+const (
+	TruncateHead     = "head"      // keep the start (default)
+	TruncateHeadTail = "head_tail" // keep the start and the end, where build logs report errors
+)
+
+// TruncatedMarker stands in for the middle of output cut with TruncateHeadTail.
+const TruncatedMarker = "\n...[output truncated]...\n"
+
+// TruncateOutput cuts s to at most limit bytes and reports whether it did.
+// Cuts are moved to rune boundaries so no multibyte character is split.
+func TruncateOutput(s string, limit int, mode string) (string, bool) {
+	if len(s) <= limit {
+		return s, false
+	}
+	if mode != TruncateHeadTail {
+		return s[:runeBoundary(s, limit, -1)], true
+	}
+	half := (limit - len(TruncatedMarker)) / 2
+	head := s[:runeBoundary(s, half, -1)]
+	tail := s[runeBoundary(s, len(s)-half, 1):]
+	return head + TruncatedMarker + tail, true
+}
+
+// runeBoundary moves i by dir until s[i] starts a rune. It gives up after
+// utf8.UTFMax steps, so invalid UTF-8 is cut where it is.
+func runeBoundary(s string, i, dir int) int {
+	for n := 0; n < utf8.UTFMax && i > 0 && i < len(s) && !utf8.RuneStart(s[i]); n++ {
+		i += dir
+	}
+	return i
+}
+
+// CompressionGzip marks a response whose Output and ContentBase64 hold the
+// base64 encoding of the gzip-compressed payload.
+const CompressionGzip = "gzip"
+
+// CompressResponse gzips the Output and ContentBase64 of resp when their
+// payload is at least minBytes and compression makes it smaller. Output is
+// compressed as is; ContentBase64 is decoded first so the file bytes, not
+// their encoding, are compressed.
+func CompressResponse(resp *Response, minBytes int) error {
+	if minBytes <= 0 || resp.Compression != "" {
+		return nil
+	}
+	content, err := base64.StdEncoding.DecodeString(resp.ContentBase64)
+	if err != nil {
+		return fmt.Errorf("decode content: %w", err)
+	}
+	if len(resp.Output)+len(content) < minBytes {
+		return nil
+	}
+	output, err := gzipBase64([]byte(resp.Output))
+	if err != nil {
+		return err
+	}
+	packed, err := gzipBase64(content)
+	if err != nil {
+		return err
+	}
+	if len(output)+len(packed) >= len(resp.Output)+len(resp.ContentBase64) {
+		return nil
+	}
+	resp.Output, resp.ContentBase64 = output, packed
+	resp.Compression = CompressionGzip
+	return nil
+}
+
+// DecompressResponse undoes CompressResponse.
+func DecompressResponse(resp *Response) error {
+	switch resp.Compression {
+	case "":
+		return nil
+	case CompressionGzip:
+	default:
+		return fmt.Errorf("unknown response compression %q", resp.Compression)
+	}
+	if resp.Output != "" {
+		output, err := gunzipBase64(resp.Output)
+		if err != nil {
+			return fmt.Errorf("decompress output: %w", err)
+		}
+		resp.Output = string(output)
+	}
+	if resp.ContentBase64 != "" {
+		content, err := gunzipBase64(resp.ContentBase64)
+		if err != nil {
+			return fmt.Errorf("decompress content: %w", err)
+		}
+		resp.ContentBase64 = base64.StdEncoding.EncodeToString(content)
+	}
+	resp.Compression = ""
+	return nil
+}
+
+func gzipBase64(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", fmt.Errorf("gzip: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("gzip: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func gunzipBase64(s string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// MaxBase64OutputBytes caps the raw output of an exec with OutputBase64 and
+// the default output limit, see Request.Base64OutputLimit.
+const MaxBase64OutputBytes = MaxOutputBytes / 4 * 3
+
 // MaxExecInlineCmdBytes is the max size of an exec command sent directly to runner PTY.
 const MaxExecInlineCmdBytes = 16 * 1024 // 16 KiB
 
@@ -117,13 +404,35 @@ type SessionState struct {
 	CgroupPath   string `json:"cgroup_path"`
 	Mnt          string `json:"mnt"`
 	RunnerSock   string `json:"runner_sock"`
-	NetworkReady bool   `json:"network_ready"` // true after lazy network setup (bridge mode)
+	NetworkReady bool   `json:"network_ready"`          // true after lazy network setup (bridge mode)
+	IP           string `json:"ip,omitempty"`           // bridge address, recorded before the veth is set up
+	HostIDBase   uint32 `json:"host_id_base,omitempty"` // first host ID of a nested-container session's ID block
 }
 
 type SessionStats struct {
 	MemoryBytes  int64 `json:"memory_bytes"`
 	MemoryLimit  int64 `json:"memory_limit,omitempty"`
+	MemoryPeak   int64 `json:"memory_peak,omitempty"` // highest usage since start; 0 = unknown
 	CPUUsageUsec int64 `json:"cpu_usage_usec"`
+	OOMKills     int64 `json:"oom_kills,omitempty"` // processes killed for running out of memory
+
+	// Pressure stall information of the session cgroup; nil where the
+	// kernel or runtime does not provide it.
+	CPUPressure    *Pressure `json:"cpu_pressure,omitempty"`
+	MemoryPressure *Pressure `json:"memory_pressure,omitempty"`
+	IOPressure     *Pressure `json:"io_pressure,omitempty"`
+}
+
+// Pressure is the share of time, in percent, in which some or all tasks of a
+// session stalled waiting for a resource, averaged over 10, 60 and 300
+// seconds. Full is zero for cpu on kernels before 5.13.
+type Pressure struct {
+	SomeAvg10  float64 `json:"some_avg10"`
+	SomeAvg60  float64 `json:"some_avg60"`
+	SomeAvg300 float64 `json:"some_avg300"`
+	FullAvg10  float64 `json:"full_avg10"`
+	FullAvg60  float64 `json:"full_avg60"`
+	FullAvg300 float64 `json:"full_avg300"`
 }
 
 // SentinelBegin is the marker written before a command.
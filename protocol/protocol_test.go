@@ -1,8 +1,11 @@
 package protocol
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -120,6 +123,8 @@ func TestRequestTypes(t *testing.T) {
 	assert.Equal(t, RequestType("exec_stream"), RequestExecStream)
 	assert.Equal(t, RequestType("write"), RequestWrite)
 	assert.Equal(t, RequestType("read"), RequestRead)
+	assert.Equal(t, RequestType("version"), RequestVersion)
+	assert.Equal(t, RequestType("upgrade"), RequestUpgrade)
 }
 
 func TestResponseTypes(t *testing.T) {
@@ -130,6 +135,8 @@ func TestResponseTypes(t *testing.T) {
 	assert.Equal(t, ResponseType("read"), ResponseRead)
 	assert.Equal(t, ResponseType("error"), ResponseError)
 	assert.Equal(t, ResponseType("ready"), ResponseReady)
+	assert.Equal(t, ResponseType("version"), ResponseVersion)
+	assert.Equal(t, ResponseType("upgrade"), ResponseUpgrade)
 }
 
 func TestReadyMessage(t *testing.T) {
@@ -141,3 +148,49 @@ func TestReadyMessage(t *testing.T) {
 	require.NoError(t, json.Unmarshal(data, &decoded))
 	assert.Equal(t, ResponseReady, decoded.Type)
 }
+
+func TestTruncateOutput(t *testing.T) {
+	out, truncated := TruncateOutput("short", 10, TruncateHead)
+	assert.False(t, truncated)
+	assert.Equal(t, "short", out)
+
+	// "é" is two bytes; a cut after 3 bytes would split the second one.
+	out, truncated = TruncateOutput("aéé", 4, TruncateHead)
+	assert.True(t, truncated)
+	assert.Equal(t, "aé", out)
+
+	log := strings.Repeat("ü", 100) + "error: build failed"
+	limit := len(TruncatedMarker) + 41
+	out, truncated = TruncateOutput(log, limit, TruncateHeadTail)
+	assert.True(t, truncated)
+	assert.LessOrEqual(t, len(out), limit)
+	assert.True(t, utf8.ValidString(out))
+	assert.True(t, strings.HasPrefix(out, "üüüüüüüüüü"))
+	assert.True(t, strings.HasSuffix(out, TruncatedMarker+"error: build failed"))
+}
+
+func TestCompressResponse(t *testing.T) {
+	output := strings.Repeat("build step ok\n", 1000)
+	content := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 4096)))
+	resp := Response{ID: "c-1", Type: ResponseExec, Output: output, ContentBase64: content}
+
+	require.NoError(t, CompressResponse(&resp, 1024))
+	assert.Equal(t, CompressionGzip, resp.Compression)
+	assert.Less(t, len(resp.Output), len(output))
+	assert.Less(t, len(resp.ContentBase64), len(content))
+
+	require.NoError(t, DecompressResponse(&resp))
+	assert.Empty(t, resp.Compression)
+	assert.Equal(t, output, resp.Output)
+	assert.Equal(t, content, resp.ContentBase64)
+
+	small := Response{Output: "hello\n"}
+	require.NoError(t, CompressResponse(&small, 1024))
+	assert.Empty(t, small.Compression, "below the threshold")
+	assert.Equal(t, "hello\n", small.Output)
+
+	require.NoError(t, CompressResponse(&small, 0))
+	assert.Empty(t, small.Compression, "0 = never")
+
+	assert.Error(t, DecompressResponse(&Response{Compression: "lz4"}))
+}
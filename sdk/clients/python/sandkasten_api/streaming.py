@@ -0,0 +1,112 @@
+"""Streaming exec over Server-Sent Events.
+
+The generated ExecApi.exec_stream reads the whole event stream into a string.
+exec_stream yields each event as it arrives instead. This file is hand-written
+and kept across regeneration (see .openapi-generator-ignore).
+
+Example:
+    >>> from sandkasten_api import ApiClient, Configuration
+    >>> from sandkasten_api.models import ExecChunkEvent
+    >>> from sandkasten_api.streaming import exec_stream
+    >>> config = Configuration(host="http://localhost:8080/v1", access_token="sk-...")
+    >>> with ApiClient(config) as client:
+    ...     for event in exec_stream(client, session_id, "pip install numpy"):
+    ...         if isinstance(event, ExecChunkEvent):
+    ...             print(event.chunk, end="")
+"""
+
+import json
+from typing import Iterable, Iterator, Optional, Tuple, Union
+from urllib.parse import quote
+
+from sandkasten_api.api_client import ApiClient
+from sandkasten_api.exceptions import ApiException
+from sandkasten_api.models.exec_chunk_event import ExecChunkEvent
+from sandkasten_api.models.exec_done_event import ExecDoneEvent
+from sandkasten_api.models.exec_error_event import ExecErrorEvent
+
+ExecEvent = Union[ExecChunkEvent, ExecDoneEvent, ExecErrorEvent]
+
+__all__ = ["ExecEvent", "exec_stream", "iter_sse"]
+
+
+def exec_stream(
+    api_client: ApiClient,
+    session_id: str,
+    cmd: str,
+    *,
+    timeout_ms: Optional[int] = None,
+    raw_output: bool = False,
+    shell: Optional[str] = None,
+) -> Iterator[ExecEvent]:
+    """Run cmd in the session and yield its output as it is produced.
+
+    Yields ExecChunkEvent for each output chunk, then a final ExecDoneEvent
+    (exit code, cwd, duration) or ExecErrorEvent.
+
+    Raises:
+        ApiException: The daemon rejected the request before streaming.
+    """
+    body: dict = {"cmd": cmd}
+    if timeout_ms is not None:
+        body["timeout_ms"] = timeout_ms
+    if raw_output:
+        body["raw_output"] = True
+    if shell:
+        body["shell"] = shell
+
+    config = api_client.configuration
+    headers = dict(api_client.default_headers)
+    headers["Content-Type"] = "application/json"
+    headers["Accept"] = "text/event-stream"
+    if config.access_token:
+        headers["Authorization"] = f"Bearer {config.access_token}"
+    url = f"{config.host}/sessions/{quote(session_id, safe='')}/exec/stream"
+
+    resp = api_client.rest_client.pool_manager.request(
+        "POST",
+        url,
+        body=json.dumps(body).encode(),
+        headers=headers,
+        preload_content=False,
+    )
+    try:
+        if resp.status != 200:
+            raise ApiException(
+                status=resp.status,
+                reason=resp.reason,
+                body=resp.read().decode("utf-8", errors="replace"),
+            )
+        for event, data in iter_sse(resp):
+            if event == "chunk":
+                yield ExecChunkEvent.from_json(data)
+            elif event == "done":
+                yield ExecDoneEvent.from_json(data)
+                return
+            elif event == "error":
+                yield ExecErrorEvent.from_json(data)
+                return
+    finally:
+        resp.release_conn()
+
+
+def iter_sse(lines: Iterable[bytes]) -> Iterator[Tuple[str, str]]:
+    """Parse a Server-Sent Events stream into (event, data) pairs."""
+    event, data = "message", []
+    for raw in lines:
+        line = raw.decode("utf-8").rstrip("\r\n")
+        if not line:
+            if data:
+                yield event, "\n".join(data)
+            event, data = "message", []
+        elif line.startswith(":"):
+            continue
+        else:
+            field, _, value = line.partition(":")
+            value = value.removeprefix(" ")
+            if field == "event":
+                event = value
+            elif field == "data":
+                data.append(value)
+    if data:
+        yield event, "\n".join(data)
@@ -0,0 +1,118 @@
+// Streaming exec over Server-Sent Events.
+//
+// The generated ExecApi.execStream buffers the whole event stream into a
+// string. execStream yields each event as it arrives instead. This file is
+// hand-written and kept across regeneration (see .openapi-generator-ignore).
+//
+//   import { Configuration } from "@sandkasten/api";
+//   import { execStream } from "@sandkasten/api/streaming";
+//
+//   const config = new Configuration({ basePath: "http://localhost:8080/v1", accessToken: "sk-..." });
+//   for await (const ev of execStream(config, sessionId, { cmd: "npm test" })) {
+//     if (ev.type === "chunk") process.stdout.write(ev.data.chunk);
+//   }
+
+import { Configuration, ResponseError } from "./runtime";
+import {
+  ExecChunkEventFromJSON,
+  ExecDoneEventFromJSON,
+  ExecErrorEventFromJSON,
+  ExecRequestToJSON,
+} from "./models/index";
+import type { ExecChunkEvent, ExecDoneEvent, ExecErrorEvent, ExecRequest } from "./models/index";
+
+export type ExecEvent =
+  | { type: "chunk"; data: ExecChunkEvent }
+  | { type: "done"; data: ExecDoneEvent }
+  | { type: "error"; data: ExecErrorEvent };
+
+/**
+ * Run a command in the session and yield its output as it is produced: a
+ * "chunk" event per output chunk, then one "done" or "error" event.
+ *
+ * Throws ResponseError if the daemon rejects the request before streaming.
+ */
+export async function* execStream(
+  config: Configuration,
+  sessionId: string,
+  request: ExecRequest,
+  signal?: AbortSignal,
+): AsyncGenerator<ExecEvent> {
+  const headers: Record<string, string> = {
+    ...config.headers,
+    "Content-Type": "application/json",
+    Accept: "text/event-stream",
+  };
+  if (config.accessToken) {
+    headers.Authorization = `Bearer ${await config.accessToken("bearerAuth", [])}`;
+  }
+
+  const fetchApi = config.fetchApi ?? fetch;
+  const response = await fetchApi(
+    `${config.basePath}/sessions/${encodeURIComponent(sessionId)}/exec/stream`,
+    {
+      method: "POST",
+      headers,
+      body: JSON.stringify(ExecRequestToJSON(request)),
+      credentials: config.credentials,
+      signal,
+    },
+  );
+  if (!response.ok || !response.body) {
+    throw new ResponseError(response, "exec stream request failed");
+  }
+
+  for await (const { event, data } of parseSSE(response.body)) {
+    const json = JSON.parse(data);
+    switch (event) {
+      case "chunk":
+        yield { type: "chunk", data: ExecChunkEventFromJSON(json) };
+        break;
+      case "done":
+        yield { type: "done", data: ExecDoneEventFromJSON(json) };
+        return;
+      case "error":
+        yield { type: "error", data: ExecErrorEventFromJSON(json) };
+        return;
+    }
+  }
+}
+
+/** Parse a Server-Sent Events body into events. */
+export async function* parseSSE(
+  body: ReadableStream<Uint8Array>,
+): AsyncGenerator<{ event: string; data: string }> {
+  const reader = body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = "";
+  let event = "message";
+  let data: string[] = [];
+
+  try {
+    for (;;) {
+      const { done, value } = await reader.read();
+      buffer += done ? decoder.decode() : decoder.decode(value, { stream: true });
+
+      let nl: number;
+      while ((nl = buffer.indexOf("\n")) >= 0) {
+        const line = buffer.slice(0, nl).replace(/\r$/, "");
+        buffer = buffer.slice(nl + 1);
+        if (line === "") {
+          if (data.length > 0) yield { event, data: data.join("\n") };
+          event = "message";
+          data = [];
+        } else if (!line.startsWith(":")) {
+          const colon = line.indexOf(":");
+          const field = colon < 0 ? line : line.slice(0, colon);
+          const val = colon < 0 ? "" : line.slice(colon + 1).replace(/^ /, "");
+          if (field === "event") event = val;
+          else if (field === "data") data.push(val);
+        }
+      }
+      if (done) break;
+    }
+    if (data.length > 0) yield { event, data: data.join("\n") };
+  } finally {
+    reader.releaseLock();
+  }
+}
@@ -0,0 +1,69 @@
+"""LangChain integration for Sandkasten.
+
+Exposes SandboxTools (create/exec/read/write) as LangChain tools.
+Requires: pip install sandkasten[langchain] or pip install langchain-core
+
+The tools are async: call them with ainvoke, or use an async agent executor.
+"""
+
+from __future__ import annotations
+
+from typing import TYPE_CHECKING
+
+from .tools import TOOL_NAMES, SandboxTools
+
+try:
+    from langchain_core.tools import BaseTool, BaseToolkit, StructuredTool
+except ImportError as e:
+    raise ImportError(
+        "LangChain is required for sandkasten.langchain. "
+        "Install with: pip install sandkasten[langchain] or pip install langchain-core"
+    ) from e
+
+if TYPE_CHECKING:
+    from .client import SandboxClient
+
+
+def create_langchain_tools(tools: SandboxTools) -> list[BaseTool]:
+    """Wrap each SandboxTools method as a StructuredTool named sandbox_<method>."""
+    return [
+        StructuredTool.from_function(
+            coroutine=getattr(tools, name),
+            name=f"sandbox_{name}",
+            parse_docstring=True,
+        )
+        for name in TOOL_NAMES
+    ]
+
+
+class SandkastenToolkit(BaseToolkit):
+    """LangChain toolkit backed by one Sandkasten session.
+
+    Example:
+        >>> toolkit = SandkastenToolkit.from_client(client, image="python")
+        >>> agent = create_react_agent(llm, toolkit.get_tools())
+        >>> ...
+        >>> await toolkit.sandbox.close()
+    """
+
+    sandbox: SandboxTools
+
+    model_config = {"arbitrary_types_allowed": True}
+
+    @classmethod
+    def from_client(
+        cls,
+        client: "SandboxClient",
+        *,
+        image: str = "python",
+        workspace_id: str | None = None,
+    ) -> "SandkastenToolkit":
+        """Build a toolkit whose session is created on first use."""
+        return cls(sandbox=SandboxTools(client, image=image, workspace_id=workspace_id))
+
+    def get_tools(self) -> list[BaseTool]:
+        """Return sandbox_create_session, sandbox_exec, sandbox_read_file and sandbox_write_file."""
+        return create_langchain_tools(self.sandbox)
+
+
+__all__ = ["SandkastenToolkit", "create_langchain_tools"]
@@ -0,0 +1,61 @@
+"""LlamaIndex integration for Sandkasten.
+
+Exposes SandboxTools (create/exec/read/write) as a LlamaIndex ToolSpec.
+Requires: pip install sandkasten[llamaindex] or pip install llama-index-core
+"""
+
+from __future__ import annotations
+
+from typing import TYPE_CHECKING
+
+from .tools import TOOL_NAMES, SandboxTools
+
+try:
+    from llama_index.core.tools import FunctionTool
+    from llama_index.core.tools.tool_spec.base import BaseToolSpec
+except ImportError as e:
+    raise ImportError(
+        "LlamaIndex is required for sandkasten.llamaindex. "
+        "Install with: pip install sandkasten[llamaindex] or pip install llama-index-core"
+    ) from e
+
+if TYPE_CHECKING:
+    from .client import SandboxClient
+
+
+class SandkastenToolSpec(BaseToolSpec):
+    """LlamaIndex tool spec backed by one Sandkasten session.
+
+    Example:
+        >>> spec = SandkastenToolSpec(client, image="python")
+        >>> agent = FunctionAgent(tools=spec.to_tool_list(), llm=llm)
+        >>> ...
+        >>> await spec.sandbox.close()
+    """
+
+    spec_functions = [f"sandbox_{name}" for name in TOOL_NAMES]
+
+    def __init__(
+        self,
+        client: "SandboxClient",
+        *,
+        image: str = "python",
+        workspace_id: str | None = None,
+    ):
+        """Bind the spec to a client; the session is created on first use."""
+        self.sandbox = SandboxTools(client, image=image, workspace_id=workspace_id)
+
+    def to_tool_list(self, spec_functions=None, func_to_metadata_mapping=None) -> list[FunctionTool]:
+        """Return one async FunctionTool per sandbox operation."""
+        metadata = func_to_metadata_mapping or {}
+        return [
+            FunctionTool.from_defaults(
+                async_fn=getattr(self.sandbox, name.removeprefix("sandbox_")),
+                name=name,
+                tool_metadata=metadata.get(name),
+            )
+            for name in spec_functions or self.spec_functions
+        ]
+
+
+__all__ = ["SandkastenToolSpec"]
@@ -3,7 +3,7 @@
 import base64
 import json
 from pathlib import Path
-from typing import TYPE_CHECKING, AsyncIterator, BinaryIO
+from typing import TYPE_CHECKING, AsyncIterator, BinaryIO, Optional
 
 import httpx
 
@@ -15,6 +15,13 @@ if TYPE_CHECKING:
     from .client import SandboxClient
 
 
+def _exec_body(cmd: str, timeout_ms: int, raw_output: bool, shell: Optional[str]) -> dict:
+    body = {"cmd": cmd, "timeout_ms": timeout_ms, "raw_output": raw_output}
+    if shell:
+        body["shell"] = shell
+    return body
+
+
 class Session:
     """A stateful sandbox session with persistent shell and filesystem.
 
@@ -47,6 +54,7 @@ class Session:
         *,
         timeout_ms: int = 30000,
         raw_output: bool = False,
+        shell: Optional[str] = None,
     ) -> ExecResult:
         """Execute a shell command in the sandbox.
 
@@ -59,6 +67,8 @@ class Session:
             cmd: Shell command to execute
             timeout_ms: Timeout in milliseconds (default 30000)
             raw_output: Return raw PTY output (keeps ANSI and CRLF)
+            shell: Run cmd with "bash", "sh", "python" or "node" instead of
+                the session shell; the image must have the interpreter
 
         Returns:
             ExecResult with exit code, output, and current directory
@@ -76,7 +86,7 @@ class Session:
         """
         resp = await self._client._http.post(
             f"/v1/sessions/{self._id}/exec",
-            json={"cmd": cmd, "timeout_ms": timeout_ms, "raw_output": raw_output},
+            json=_exec_body(cmd, timeout_ms, raw_output, shell),
         )
         resp.raise_for_status()
         data = resp.json()
@@ -95,6 +105,7 @@ class Session:
         *,
         timeout_ms: int = 30000,
         raw_output: bool = False,
+        shell: Optional[str] = None,
     ) -> AsyncIterator[ExecChunk]:
         """Execute a command and stream output chunks in real-time.
 
@@ -107,6 +118,8 @@ class Session:
             cmd: Shell command to execute
             timeout_ms: Timeout in milliseconds (default 30000)
             raw_output: Return raw PTY output (keeps ANSI and CRLF)
+            shell: Run cmd with "bash", "sh", "python" or "node" instead of
+                the session shell; the image must have the interpreter
 
         Yields:
             ExecChunk objects with output and metadata
@@ -124,7 +137,7 @@ class Session:
         async with self._client._http.stream(
             "POST",
             f"/v1/sessions/{self._id}/exec/stream",
-            json={"cmd": cmd, "timeout_ms": timeout_ms, "raw_output": raw_output},
+            json=_exec_body(cmd, timeout_ms, raw_output, shell),
         ) as resp:
             resp.raise_for_status()
 
@@ -0,0 +1,135 @@
+"""Framework-neutral sandbox tools.
+
+SandboxTools is the single definition behind the LangChain and LlamaIndex
+adapters (sandkasten.langchain, sandkasten.llamaindex): each public coroutine
+becomes one tool, with its name, signature and docstring as the tool schema.
+"""
+
+from __future__ import annotations
+
+from typing import TYPE_CHECKING
+
+if TYPE_CHECKING:
+    from .client import SandboxClient
+    from .session import Session
+
+TOOL_NAMES = ("create_session", "exec", "read_file", "write_file")
+"""SandboxTools methods exposed as tools, in the order adapters list them."""
+
+
+class SandboxTools:
+    """Create/exec/read/write tools over one sandbox session.
+
+    The session is created on first use (or by the create_session tool) and
+    reused by every later call, so the shell keeps its cwd and environment.
+
+    Example:
+        >>> tools = SandboxTools(client, image="python")
+        >>> print(await tools.exec("python3 -V"))
+        >>> await tools.close()
+    """
+
+    def __init__(
+        self,
+        client: "SandboxClient",
+        *,
+        image: str = "python",
+        workspace_id: str | None = None,
+        session: "Session | None" = None,
+    ):
+        """Bind tools to a client.
+
+        Args:
+            client: SandboxClient used to create the session.
+            image: Image for sessions the tools create (default 'python').
+            workspace_id: Persistent workspace to mount in created sessions.
+            session: Existing session to use instead of creating one.
+        """
+        self._client = client
+        self._image = image
+        self._workspace_id = workspace_id
+        self._session = session
+
+    @property
+    def session(self) -> "Session | None":
+        """The session the tools currently use, if any."""
+        return self._session
+
+    async def _current(self) -> "Session":
+        if self._session is None:
+            self._session = await self._client.create_session(
+                image=self._image, workspace_id=self._workspace_id
+            )
+        return self._session
+
+    async def create_session(self, image: str | None = None) -> str:
+        """Start a fresh sandbox, destroying the current one.
+
+        Args:
+            image: Image to use, e.g. 'python' or 'node' (default: the configured image).
+
+        Returns:
+            The new session ID.
+        """
+        await self.close()
+        self._session = await self._client.create_session(
+            image=image or self._image, workspace_id=self._workspace_id
+        )
+        return f"session_id={self._session.id}"
+
+    async def exec(self, cmd: str, timeout_ms: int = 30000) -> str:
+        """Run a shell command in the sandbox.
+
+        The shell is persistent: cd, environment variables and background
+        processes carry over between calls.
+
+        Args:
+            cmd: Shell command, e.g. 'pip install pandas' or 'python main.py'.
+            timeout_ms: Timeout in milliseconds (default 30000).
+
+        Returns:
+            exit_code, cwd and the combined output, separated by ---.
+        """
+        session = await self._current()
+        result = await session.exec(cmd, timeout_ms=timeout_ms)
+        return f"exit_code={result.exit_code}\ncwd={result.cwd}\n---\n{result.output}"
+
+    async def read_file(self, path: str, max_bytes: int | None = None) -> str:
+        """Read a text file from the sandbox.
+
+        Args:
+            path: File path, relative to /workspace or absolute.
+            max_bytes: Maximum bytes to read (omit for the whole file).
+
+        Returns:
+            The file contents; '(truncated)' is appended if cut short.
+        """
+        session = await self._current()
+        result = await session.read(path, max_bytes=max_bytes)
+        text = result.content.decode("utf-8", errors="replace")
+        if result.truncated:
+            text += "\n(truncated)"
+        return text
+
+    async def write_file(self, path: str, content: str) -> str:
+        """Write a text file in the sandbox, replacing it if it exists.
+
+        Args:
+            path: File path, relative to /workspace or absolute.
+            content: Text to write.
+
+        Returns:
+            Confirmation with the path written.
+        """
+        session = await self._current()
+        await session.write(path, content)
+        return f"wrote {path}"
+
+    async def close(self) -> None:
+        """Destroy the current session, if any."""
+        if self._session is not None:
+            session, self._session = self._session, None
+            await session.destroy()
+
+
+__all__ = ["SandboxTools", "TOOL_NAMES"]
@@ -0,0 +1,78 @@
+"""Tests for SandboxTools."""
+
+from unittest.mock import AsyncMock, MagicMock
+
+import pytest
+
+from sandkasten import SandboxClient
+from sandkasten.tools import TOOL_NAMES, SandboxTools
+from sandkasten.types import ExecResult, ReadResult
+
+
+@pytest.fixture
+def session():
+    s = MagicMock()
+    s.id = "sess-123"
+    s.exec = AsyncMock(
+        return_value=ExecResult(exit_code=0, cwd="/workspace", output="hi\n", truncated=False, duration_ms=5)
+    )
+    s.read = AsyncMock(return_value=ReadResult(path="/workspace/a.txt", content=b"abc", truncated=True))
+    s.write = AsyncMock()
+    s.destroy = AsyncMock()
+    return s
+
+
+@pytest.fixture
+def client(session):
+    c = MagicMock(spec=SandboxClient)
+    c.create_session = AsyncMock(return_value=session)
+    return c
+
+
+@pytest.mark.asyncio
+async def test_session_created_on_first_use(client, session):
+    """The first tool call creates the session; later calls reuse it."""
+    tools = SandboxTools(client, image="node", workspace_id="ws-1")
+
+    out = await tools.exec("echo hi")
+    await tools.exec("pwd")
+
+    assert out == "exit_code=0\ncwd=/workspace\n---\nhi\n"
+    client.create_session.assert_awaited_once_with(image="node", workspace_id="ws-1")
+    assert tools.session is session
+
+
+@pytest.mark.asyncio
+async def test_read_and_write(client, session):
+    """read_file decodes and marks truncation; write_file confirms the path."""
+    tools = SandboxTools(client)
+
+    assert await tools.read_file("a.txt") == "abc\n(truncated)"
+    assert await tools.write_file("b.txt", "x") == "wrote b.txt"
+    session.write.assert_awaited_once_with("b.txt", "x")
+
+
+@pytest.mark.asyncio
+async def test_create_session_replaces_current(client, session):
+    """create_session destroys the current session before starting a new one."""
+    tools = SandboxTools(client, session=session)
+
+    assert await tools.create_session(image="base") == "session_id=sess-123"
+
+    session.destroy.assert_awaited_once()
+    client.create_session.assert_awaited_once_with(image="base", workspace_id=None)
+
+
+@pytest.mark.asyncio
+async def test_close_without_session(client):
+    """close is a no-op before any tool ran."""
+    tools = SandboxTools(client)
+    await tools.close()
+    client.create_session.assert_not_called()
+
+
+def test_tool_names_are_methods():
+    """Every name adapters expose is a coroutine method with a docstring."""
+    for name in TOOL_NAMES:
+        method = getattr(SandboxTools, name)
+        assert method.__doc__
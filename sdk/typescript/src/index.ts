@@ -3,6 +3,7 @@ export { Session } from "./session.js";
 export type {
   ExecResult,
   ExecChunk,
+  ExecShell,
   SessionInfo,
   WorkspaceInfo,
   SandboxClientOptions,
@@ -1,5 +1,5 @@
 import type { SandboxClient } from "./client.js";
-import type { ExecResult, ReadResult, SessionInfo, ExecChunk } from "./types.js";
+import type { ExecResult, ExecShell, ReadResult, SessionInfo, ExecChunk } from "./types.js";
 
 export class Session {
   readonly id: string;
@@ -13,7 +13,7 @@ export class Session {
 
   async exec(
     cmd: string,
-    opts?: { timeoutMs?: number; rawOutput?: boolean }
+    opts?: { timeoutMs?: number; rawOutput?: boolean; shell?: ExecShell }
   ): Promise<ExecResult> {
     const res = await this.client.fetch(`/v1/sessions/${this.id}/exec`, {
       method: "POST",
@@ -21,6 +21,7 @@ export class Session {
         cmd,
         timeout_ms: opts?.timeoutMs,
         raw_output: opts?.rawOutput,
+        shell: opts?.shell,
       }),
     });
     return res.json();
@@ -28,7 +29,7 @@ export class Session {
 
   async *execStream(
     cmd: string,
-    opts?: { timeoutMs?: number; rawOutput?: boolean }
+    opts?: { timeoutMs?: number; rawOutput?: boolean; shell?: ExecShell }
   ): AsyncIterableIterator<ExecChunk> {
     const res = await this.client.fetch(`/v1/sessions/${this.id}/exec/stream`, {
       method: "POST",
@@ -36,6 +37,7 @@ export class Session {
         cmd,
         timeout_ms: opts?.timeoutMs,
         raw_output: opts?.rawOutput,
+        shell: opts?.shell,
       }),
     });
 
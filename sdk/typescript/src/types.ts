@@ -20,6 +20,9 @@ export interface SessionInfo {
   last_activity?: string;
 }
 
+/** Interpreter that runs an exec command instead of the session shell. */
+export type ExecShell = "bash" | "sh" | "python" | "node";
+
 export interface ExecResult {
   exit_code: number;
   cwd: string;
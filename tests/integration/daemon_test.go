@@ -0,0 +1,281 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The daemon suite runs the real sandkasten binary (the linux runtime re-execs
+// the daemon as nsinit, which a test binary cannot do) against a data dir
+// holding a single busybox image. It needs root, cgroups v2 and a statically
+// linked busybox: SANDKASTEN_TEST_BUSYBOX, or busybox on PATH.
+
+const fixtureImage = "busybox"
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	buildErr  error
+)
+
+// requireRoot skips tests that need the linux runtime when it cannot run here.
+func requireRoot(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("linux runtime tests require root")
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		t.Skip("linux runtime tests require cgroups v2 at /sys/fs/cgroup")
+	}
+}
+
+// buildBinaries compiles the daemon and a static runner once per test run.
+func buildBinaries(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		binDir, buildErr = os.MkdirTemp("", "sandkasten-it-bin-")
+		if buildErr != nil {
+			return
+		}
+		for _, b := range []struct {
+			name string
+			pkg  string
+			env  []string
+		}{
+			{"sandkasten", "../../cmd/sandkasten", nil},
+			{"runner", "../../cmd/runner", []string{"CGO_ENABLED=0"}},
+		} {
+			cmd := exec.Command("go", "build", "-o", filepath.Join(binDir, b.name), b.pkg)
+			cmd.Env = append(os.Environ(), b.env...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				buildErr = fmt.Errorf("build %s: %w\n%s", b.name, err, out)
+				return
+			}
+		}
+	})
+	require.NoError(t, buildErr)
+	return binDir
+}
+
+// findBusybox returns a statically linked busybox binary or skips the test.
+func findBusybox(t *testing.T) string {
+	t.Helper()
+	path := os.Getenv("SANDKASTEN_TEST_BUSYBOX")
+	if path == "" {
+		p, err := exec.LookPath("busybox")
+		if err != nil {
+			t.Skip("busybox not found (set SANDKASTEN_TEST_BUSYBOX)")
+		}
+		path = p
+	}
+	f, err := elf.Open(path)
+	require.NoError(t, err, "open busybox")
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			t.Skipf("%s is dynamically linked; a static busybox is required", path)
+		}
+	}
+	return path
+}
+
+// writeBusyboxImage lays out images/busybox/rootfs under dataDir: busybox with
+// a symlink per applet, the runner, and a /bin/bash shim because the runner
+// pipes commands into bash.
+func writeBusyboxImage(t *testing.T, dataDir, busybox, runner string) {
+	t.Helper()
+	rootfs := filepath.Join(dataDir, "images", fixtureImage, "rootfs")
+	for _, dir := range []string{"bin", "etc", "tmp", "workspace", "usr/local/bin"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(rootfs, dir), 0755))
+	}
+	copyExecutable(t, busybox, filepath.Join(rootfs, "bin", "busybox"))
+	copyExecutable(t, runner, filepath.Join(rootfs, "usr", "local", "bin", "runner"))
+
+	out, err := exec.Command(busybox, "--list").Output()
+	require.NoError(t, err, "busybox --list")
+	for _, applet := range strings.Fields(string(out)) {
+		if applet == "busybox" || applet == "bash" {
+			continue
+		}
+		require.NoError(t, os.Symlink("busybox", filepath.Join(rootfs, "bin", applet)))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "bin", "bash"), []byte("#!/bin/sh\nexec /bin/sh \"$@\"\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc", "passwd"), []byte("root:x:0:0:root:/root:/bin/sh\nsandbox:x:1000:1000:sandbox:/home/sandbox:/bin/sh\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "etc", "group"), []byte("root:x:0:\nsandbox:x:1000:\n"), 0644))
+}
+
+func copyExecutable(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, data, 0755))
+}
+
+// daemonOptions is the part of the config individual tests vary.
+type daemonOptions struct {
+	poolSize int // idle busybox sessions; 0 disables the pool
+}
+
+type daemon struct {
+	baseURL string
+	dataDir string
+	cmd     *exec.Cmd
+	logs    logBuffer
+}
+
+// logBuffer collects daemon output; it is read while the daemon still writes.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// startDaemon runs sandkasten against a fresh data dir with the busybox image
+// and stops it when the test ends.
+func startDaemon(t *testing.T, opts daemonOptions) *daemon {
+	t.Helper()
+	requireRoot(t)
+	busybox := findBusybox(t)
+	bins := buildBinaries(t)
+
+	dataDir, err := os.MkdirTemp("", "sandkasten-it-data-")
+	require.NoError(t, err)
+	writeBusyboxImage(t, dataDir, busybox, filepath.Join(bins, "runner"))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pool := "pool:\n  enabled: false\n"
+	if opts.poolSize > 0 {
+		pool = fmt.Sprintf("pool:\n  enabled: true\n  images:\n    %s: %d\n", fixtureImage, opts.poolSize)
+	}
+	cfg := fmt.Sprintf(`listen: %q
+api_key: %q
+data_dir: %q
+db_path: %q
+default_image: %s
+allowed_images: [%s]
+session_ttl_seconds: 120
+image_validation: fail
+drain_timeout_seconds: 5
+workspace:
+  enabled: true
+defaults:
+  cpu_limit: 0.5
+  mem_limit_mb: 128
+  pids_limit: 64
+  max_exec_timeout_ms: 30000
+  network_mode: none
+  readonly_rootfs: true
+  shell_prefer: sh
+%s`, addr, testAPIKey, dataDir, filepath.Join(dataDir, "sandkasten.db"), fixtureImage, fixtureImage, pool)
+	cfgPath := filepath.Join(dataDir, "sandkasten.yaml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0644))
+
+	d := &daemon{baseURL: "http://" + addr, dataDir: dataDir}
+	d.cmd = exec.Command(filepath.Join(bins, "sandkasten"), "--config", cfgPath, "--log-level", "debug")
+	d.cmd.Stdout = &d.logs
+	d.cmd.Stderr = &d.logs
+	require.NoError(t, d.cmd.Start())
+	t.Cleanup(func() { d.stop(t) })
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		resp, err := http.Get(d.baseURL + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return d
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("daemon did not become healthy:\n%s", d.logs.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// stop destroys the sessions the daemon still runs (pooled ones included),
+// terminates it, lets "sandkasten doctor --fix" remove anything left over and
+// deletes the data dir.
+func (d *daemon) stop(t *testing.T) {
+	d.destroyAll(t)
+
+	_ = d.cmd.Process.Signal(syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		_ = d.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		_ = d.cmd.Process.Kill()
+		<-done
+	}
+	if t.Failed() {
+		t.Logf("daemon log:\n%s", d.logs.String())
+	}
+
+	cfgPath := filepath.Join(d.dataDir, "sandkasten.yaml")
+	doctor := exec.Command(filepath.Join(binDir, "sandkasten"), "doctor", "--fix", "--config", cfgPath)
+	if out, err := doctor.CombinedOutput(); err != nil {
+		t.Logf("sandkasten doctor --fix: %v\n%s", err, out)
+	}
+	if err := os.RemoveAll(d.dataDir); err != nil {
+		t.Logf("remove data dir: %v", err)
+	}
+}
+
+func (d *daemon) destroyAll(t *testing.T) {
+	c := newTestClient(d.baseURL, testAPIKey)
+	if resp, err := c.do("POST", "/v1/pool/warm", map[string]any{"image": fixtureImage, "size": 0}); err == nil {
+		resp.Body.Close()
+	}
+	resp, err := c.do("GET", "/v1/sessions", nil)
+	if err != nil {
+		t.Logf("list sessions: %v", err)
+		return
+	}
+	var sessions []map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&sessions)
+	resp.Body.Close()
+	for _, s := range sessions {
+		if s["status"] != "running" {
+			continue
+		}
+		id, _ := s["id"].(string)
+		if resp, err := c.do("DELETE", "/v1/sessions/"+id, nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+}
@@ -26,6 +26,7 @@ const testAPIKey = "sk-integration-test"
 
 func startTestServer(t *testing.T) (string, func()) {
 	t.Helper()
+	requireRoot(t)
 
 	cfg := &config.Config{
 		Listen:            "127.0.0.1:0",
@@ -29,16 +29,26 @@ func newTestClient(baseURL, apiKey string) *testClient {
 
 func (c *testClient) doRequest(t *testing.T, method, path string, body any) *http.Response {
 	t.Helper()
+	resp, err := c.do(method, path, body)
+	require.NoError(t, err)
+	return resp
+}
 
+// do is doRequest for callers that cannot fail the test, such as cleanups.
+func (c *testClient) do(method, path string, body any) (*http.Response, error) {
 	var reqBody io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
-		require.NoError(t, err)
+		if err != nil {
+			return nil, err
+		}
 		reqBody = bytes.NewReader(data)
 	}
 
 	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
-	require.NoError(t, err)
+	if err != nil {
+		return nil, err
+	}
 
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
@@ -47,9 +57,7 @@ func (c *testClient) doRequest(t *testing.T, method, path string, body any) *htt
 		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
 
-	resp, err := c.client.Do(req)
-	require.NoError(t, err)
-	return resp
+	return c.client.Do(req)
 }
 
 func (c *testClient) createSession(t *testing.T, image string, ttl int) map[string]any {
@@ -62,6 +70,40 @@ func (c *testClient) createSession(t *testing.T, image string, ttl int) map[stri
 	return decodeResponse(t, resp)
 }
 
+func (c *testClient) createSessionWithWorkspace(t *testing.T, image, workspaceID string) map[string]any {
+	t.Helper()
+	resp := c.doRequest(t, "POST", "/v1/sessions", map[string]any{
+		"image":        image,
+		"workspace_id": workspaceID,
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode, "failed to create session")
+	return decodeResponse(t, resp)
+}
+
+func (c *testClient) getSession(t *testing.T, sessionID string) map[string]any {
+	t.Helper()
+	resp := c.doRequest(t, "GET", fmt.Sprintf("/v1/sessions/%s", sessionID), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return decodeResponse(t, resp)
+}
+
+// countSessions returns how many listed sessions have the given status.
+func (c *testClient) countSessions(t *testing.T, status string) int {
+	t.Helper()
+	resp := c.doRequest(t, "GET", "/v1/sessions", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var sessions []map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sessions))
+	n := 0
+	for _, s := range sessions {
+		if s["status"] == status {
+			n++
+		}
+	}
+	return n
+}
+
 func (c *testClient) exec(t *testing.T, sessionID, cmd string) map[string]any {
 	t.Helper()
 	resp := c.doRequest(t, "POST", fmt.Sprintf("/v1/sessions/%s/exec", sessionID), map[string]any{
@@ -0,0 +1,152 @@
+//go:build integration && linux
+
+package integration
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinux_CreateExecDestroy(t *testing.T) {
+	d := startDaemon(t, daemonOptions{})
+	client := newTestClient(d.baseURL, testAPIKey)
+
+	sess := client.createSession(t, fixtureImage, 60)
+	id := sess["id"].(string)
+	assert.Equal(t, "running", sess["status"])
+	assert.Equal(t, "cold", sess["acquire_source"])
+
+	res := client.exec(t, id, "echo hello")
+	assert.EqualValues(t, 0, res["exit_code"])
+	assert.Equal(t, "hello\n", res["output"])
+
+	res = client.exec(t, id, "false")
+	assert.EqualValues(t, 1, res["exit_code"])
+
+	// The shell is persistent: cwd and environment survive between execs.
+	client.exec(t, id, "cd /tmp && export GREETING=hi")
+	res = client.exec(t, id, "echo $GREETING $(pwd)")
+	assert.Equal(t, "hi /tmp\n", res["output"])
+	assert.Equal(t, "/tmp", res["cwd"])
+
+	client.destroySession(t, id)
+	got := client.getSession(t, id)
+	assert.Equal(t, "destroyed", got["status"])
+	assert.NoDirExists(t, filepath.Join(d.dataDir, "sessions", id))
+}
+
+func TestLinux_FileSystem(t *testing.T) {
+	d := startDaemon(t, daemonOptions{})
+	client := newTestClient(d.baseURL, testAPIKey)
+
+	id := client.createSession(t, fixtureImage, 60)["id"].(string)
+
+	client.writeFile(t, id, "/workspace/hello.txt", "hello from the host")
+	res := client.readFile(t, id, "/workspace/hello.txt")
+	content, err := base64.StdEncoding.DecodeString(res["content_base64"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "hello from the host", string(content))
+
+	res = client.exec(t, id, "cat /workspace/hello.txt && echo written > /workspace/out.txt")
+	assert.EqualValues(t, 0, res["exit_code"])
+	assert.Contains(t, res["output"], "hello from the host")
+
+	res = client.readFile(t, id, "/workspace/out.txt")
+	content, err = base64.StdEncoding.DecodeString(res["content_base64"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "written\n", string(content))
+
+	// readonly_rootfs: only /workspace, /tmp and the home dir are writable.
+	res = client.exec(t, id, "touch /etc/sandkasten-it")
+	assert.NotEqualValues(t, 0, res["exit_code"])
+
+	resp := client.doRequest(t, "GET", fmt.Sprintf("/v1/sessions/%s/fs/read?path=/workspace/missing.txt", id), nil)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestLinux_WorkspacePersists(t *testing.T) {
+	d := startDaemon(t, daemonOptions{})
+	client := newTestClient(d.baseURL, testAPIKey)
+
+	first := client.createSessionWithWorkspace(t, fixtureImage, "it-workspace")
+	id := first["id"].(string)
+	res := client.exec(t, id, "echo kept > /workspace/state.txt")
+	require.EqualValues(t, 0, res["exit_code"])
+	client.destroySession(t, id)
+
+	assert.FileExists(t, filepath.Join(d.dataDir, "workspaces", "it-workspace", "state.txt"))
+
+	second := client.createSessionWithWorkspace(t, fixtureImage, "it-workspace")
+	res = client.exec(t, second["id"].(string), "cat /workspace/state.txt")
+	assert.Equal(t, "kept\n", res["output"])
+}
+
+func TestLinux_Pool(t *testing.T) {
+	d := startDaemon(t, daemonOptions{poolSize: 2})
+	client := newTestClient(d.baseURL, testAPIKey)
+
+	waitFor(t, 30*time.Second, "pool to fill", func() bool {
+		return client.countSessions(t, "pool_idle") == 2
+	})
+
+	sess := client.createSession(t, fixtureImage, 60)
+	assert.Equal(t, "pool", sess["acquire_source"])
+	res := client.exec(t, sess["id"].(string), "echo pooled")
+	assert.Equal(t, "pooled\n", res["output"])
+
+	// The pool refills in the background after an acquire.
+	waitFor(t, 30*time.Second, "pool to refill", func() bool {
+		return client.countSessions(t, "pool_idle") == 2
+	})
+
+	resp := client.doRequest(t, "POST", "/v1/pool/warm", map[string]any{"image": fixtureImage, "size": 0})
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, 0, client.countSessions(t, "pool_idle"))
+
+	sess = client.createSession(t, fixtureImage, 60)
+	assert.Equal(t, "cold", sess["acquire_source"])
+}
+
+func TestLinux_ReaperExpiresSession(t *testing.T) {
+	d := startDaemon(t, daemonOptions{})
+	client := newTestClient(d.baseURL, testAPIKey)
+
+	id := client.createSession(t, fixtureImage, 60)["id"].(string)
+	sessionDir := filepath.Join(d.dataDir, "sessions", id)
+	require.DirExists(t, sessionDir)
+
+	resp := client.doRequest(t, "PATCH", "/v1/sessions/"+id, map[string]any{"ttl_seconds": 0})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = client.doRequest(t, "POST", fmt.Sprintf("/v1/sessions/%s/exec", id), map[string]any{"cmd": "true"})
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	resp.Body.Close()
+
+	// The reaper runs every 30 seconds.
+	waitFor(t, 45*time.Second, "reaper to expire the session", func() bool {
+		return client.getSession(t, id)["status"] == "expired"
+	})
+	assert.NoDirExists(t, sessionDir)
+}
+
+// waitFor polls cond until it holds or timeout passes.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for %s", timeout, what)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}